@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/state"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// adoptResult is the outcome of adopting a single kubeconfig entry
+type adoptResult string
+
+const (
+	// adoptAdopted entries are marked as managed by this tool
+	adoptAdopted adoptResult = "adopted"
+	// adoptAlreadyManaged entries already carry this tool's metadata
+	adoptAlreadyManaged adoptResult = "already_managed"
+	// adoptUnknownCluster entries point at a cluster Rancher doesn't know (anymore)
+	adoptUnknownCluster adoptResult = "unknown_cluster"
+	// adoptNameMismatch entries whose context, cluster and user are named differently can't
+	// be managed, since the tool addresses all three by the cluster's name
+	adoptNameMismatch adoptResult = "name_mismatch"
+)
+
+// adoption reports what adopt did, or would do, with one kubeconfig context
+type adoption struct {
+	Context   string
+	ClusterID string
+	Result    adoptResult
+}
+
+// NewAdoptCmd creates the command that marks existing kubeconfig entries of Rancher clusters as managed.
+func NewAdoptCmd() *cobra.Command {
+	adoptCmd := &cobra.Command{
+		Use:   "adopt",
+		Short: "Mark existing kubeconfig entries of Rancher clusters as managed by this tool",
+		Long: "Scans the kubeconfig for entries that connect through the Rancher server (server URLs\n" +
+			"containing /k8s/clusters/<id>), matches them to the clusters Rancher knows and marks\n" +
+			"them as managed, so renamed clusters get their entries renamed and edits made outside\n" +
+			"the tool are detected, as for entries the tool created itself.\n" +
+			"Entries of unknown clusters are reported and left alone.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runAdopt,
+	}
+
+	adoptCmd.Flags().StringP("config", "c", "", "Path to kubeconfig file (default: ~/.kube/config)")
+	adoptCmd.Flags().Bool("dry-run", false, "Report the entries that would be adopted without modifying kubeconfig")
+	adoptCmd.Flags().String("state-file", "", "Path to the state file tracking managed entries (default: <user cache dir>/rancher-kubeconfig-updater/state.json)")
+	addRancherFlags(adoptCmd)
+	addSaveFlags(adoptCmd)
+
+	return adoptCmd
+}
+
+func runAdopt(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the report, so logs go to stderr
+	zapLogger := logger.NewLoggerWithWriter(os.Stderr, zapcore.WarnLevel)
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	kubeconfigPath, _ := cmd.Flags().GetString("config")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	saveOpts, err := saveOptions(cmd, zapLogger)
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		if err := checkRootWrite(cmd, kubeconfigPath); err != nil {
+			return err
+		}
+	}
+
+	kubecfg, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig file: %w", err)
+	}
+	base := kubecfg.DeepCopy()
+
+	client, rancherURL, err := newRancherClient(cmd, zapLogger)
+	if err != nil {
+		return err
+	}
+	clusters, err := client.ListClusters()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve cluster list from Rancher: %w", err)
+	}
+
+	adoptions, err := adoptEntries(kubecfg, rancherURL, clusters)
+	if err != nil {
+		return err
+	}
+
+	adopted := 0
+	for _, a := range adoptions {
+		if a.Result == adoptAdopted {
+			adopted++
+		}
+	}
+	if adopted > 0 && !dryRun {
+		// The adopted entries are recorded as unmodified, so later edits to them are detected
+		st, stateKey := loadState(cmd, kubeconfigPath, zapLogger)
+		if st != nil {
+			for _, a := range adoptions {
+				if sum, ok := kubeconfig.EntryChecksum(kubecfg, a.Context); ok && a.Result == adoptAdopted {
+					st.SetChecksum(stateKey, a.Context, sum)
+				}
+			}
+		}
+		if _, err := saveWithState(base, kubecfg, kubeconfigPath, st, saveOpts, zapLogger); err != nil {
+			return err
+		}
+	}
+
+	return writeAdoptions(cmd.OutOrStdout(), adoptions, dryRun)
+}
+
+// adoptEntries marks the unmanaged entries of kubecfg that connect through the Rancher server
+// at rancherURL as managed, if Rancher knows their cluster. Entries are reported by context
+// name; contexts of other servers are left out.
+func adoptEntries(kubecfg *api.Config, rancherURL string, clusters rancher.Clusters) ([]adoption, error) {
+	known := make(map[string]bool, len(clusters))
+	for _, c := range clusters {
+		known[c.ID] = true
+	}
+	proxyPrefix := strings.TrimSuffix(rancherURL, "/") + "/k8s/clusters/"
+
+	names := make([]string, 0, len(kubecfg.Contexts))
+	for name := range kubecfg.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var adoptions []adoption
+	for _, name := range names {
+		ctx := kubecfg.Contexts[name]
+		if ctx == nil {
+			continue
+		}
+		cluster, ok := kubecfg.Clusters[ctx.Cluster]
+		if !ok || cluster == nil {
+			continue
+		}
+		clusterID, ok := strings.CutPrefix(cluster.Server, proxyPrefix)
+		if !ok {
+			continue
+		}
+		clusterID, _, _ = strings.Cut(clusterID, "/")
+
+		a := adoption{Context: name, ClusterID: clusterID}
+		switch {
+		case kubeconfig.IsManaged(kubecfg, name):
+			a.Result = adoptAlreadyManaged
+		case !known[clusterID]:
+			a.Result = adoptUnknownCluster
+		case ctx.Cluster != name || ctx.AuthInfo != name:
+			a.Result = adoptNameMismatch
+		default:
+			// The last rotation is unknown, so the metadata doesn't claim one
+			if err := kubeconfig.SetMetadata(kubecfg, name, kubeconfig.NewMetadata(rancherURL, clusterID, time.Time{})); err != nil {
+				return nil, err
+			}
+			a.Result = adoptAdopted
+		}
+		adoptions = append(adoptions, a)
+	}
+	return adoptions, nil
+}
+
+// saveWithState writes kubecfg together with the state (optional), after merging changes other
+// tools made to the file since base was read. It returns the kubeconfig that was written.
+func saveWithState(base, kubecfg *api.Config, kubeconfigPath string, st *state.State, saveOpts []kubeconfig.SaveOption, zapLogger *zap.Logger) (*api.Config, error) {
+	kubecfg, err := mergeExternalChanges(base, kubecfg, kubeconfigPath, zapLogger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-read kubeconfig file before saving: %w", err)
+	}
+
+	tx := kubeconfig.NewTransaction()
+	if _, err := tx.StageKubeconfig(kubecfg, kubeconfigPath, zapLogger, saveOpts...); err != nil {
+		return nil, fmt.Errorf("failed to save kubeconfig file: %w", err)
+	}
+	if st != nil {
+		if err := st.Stage(tx); err != nil {
+			zapLogger.Warn("Failed to save state file", zap.Error(err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to save kubeconfig file: %w", err)
+	}
+	return kubecfg, nil
+}
+
+// writeAdoptions prints the adopted and skipped entries as an aligned table followed by a summary line
+func writeAdoptions(w io.Writer, adoptions []adoption, dryRun bool) error {
+	if len(adoptions) == 0 {
+		_, err := fmt.Fprintln(w, "No kubeconfig entries connect through this Rancher server")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "CONTEXT\tCLUSTER ID\tRESULT")
+	adopted := 0
+	for _, a := range adoptions {
+		if a.Result == adoptAdopted {
+			adopted++
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", a.Context, a.ClusterID, a.Result)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	verb := "Adopted"
+	if dryRun {
+		verb = "Would adopt"
+	}
+	_, err := fmt.Fprintf(w, "\n%s %d of %d entries\n", verb, adopted, len(adoptions))
+	return err
+}
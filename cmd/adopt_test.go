@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/state"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// addEntry adds a cluster, context and user named name connecting to server
+func addEntry(kubecfg *api.Config, name, server string) {
+	kubecfg.Clusters[name] = &api.Cluster{Server: server}
+	kubecfg.AuthInfos[name] = &api.AuthInfo{Token: "kubeconfig-u-abc:secret"}
+	kubecfg.Contexts[name] = &api.Context{Cluster: name, AuthInfo: name}
+}
+
+func TestAdoptEntries(t *testing.T) {
+	const rancherURL = "https://rancher.example.com"
+	kubecfg := api.NewConfig()
+	addEntry(kubecfg, "prod", rancherURL+"/k8s/clusters/c-prod")
+	addEntry(kubecfg, "gone", rancherURL+"/k8s/clusters/c-gone")
+	addEntry(kubecfg, "managed", rancherURL+"/k8s/clusters/c-managed")
+	require.NoError(t, kubeconfig.SetMetadata(kubecfg, "managed", kubeconfig.NewMetadata(rancherURL, "c-managed", time.Time{})))
+	addEntry(kubecfg, "other", "https://other.example.com/k8s/clusters/c-prod")
+	addEntry(kubecfg, "direct", "https://10.0.0.1:6443")
+	kubecfg.Contexts["alias"] = &api.Context{Cluster: "prod", AuthInfo: "prod"}
+
+	clusters := rancher.Clusters{{ID: "c-prod", Name: "prod"}, {ID: "c-managed", Name: "managed"}}
+	adoptions, err := adoptEntries(kubecfg, rancherURL+"/", clusters)
+	require.NoError(t, err)
+
+	assert.Equal(t, []adoption{
+		{Context: "alias", ClusterID: "c-prod", Result: adoptNameMismatch},
+		{Context: "gone", ClusterID: "c-gone", Result: adoptUnknownCluster},
+		{Context: "managed", ClusterID: "c-managed", Result: adoptAlreadyManaged},
+		{Context: "prod", ClusterID: "c-prod", Result: adoptAdopted},
+	}, adoptions)
+
+	md, ok := kubeconfig.GetMetadata(kubecfg, "prod")
+	require.True(t, ok)
+	assert.Equal(t, rancherURL, md.RancherURL)
+	assert.Equal(t, "c-prod", md.ClusterID)
+	assert.True(t, md.LastRotated.IsZero(), "the last rotation of an adopted entry is unknown")
+	assert.False(t, kubeconfig.IsManaged(kubecfg, "gone"))
+	assert.False(t, kubeconfig.IsManaged(kubecfg, "other"))
+}
+
+func TestAdoptCmd(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "me", rancher.Cluster{ID: "c-prod", Name: "prod"})
+
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "config")
+	statePath := filepath.Join(dir, "state.json")
+	kubecfg := api.NewConfig()
+	addEntry(kubecfg, "prod", server.URL+"/k8s/clusters/c-prod")
+	addEntry(kubecfg, "gone", server.URL+"/k8s/clusters/c-gone")
+	require.NoError(t, clientcmd.WriteToFile(*kubecfg, kubeconfigPath))
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	run := func(args ...string) string {
+		var out bytes.Buffer
+		cmd := NewAdoptCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs(append([]string{"--server", server.URL, "--user", "admin", "-c", kubeconfigPath, "--state-file", statePath}, args...))
+		require.NoError(t, cmd.Execute())
+		return out.String()
+	}
+
+	out := run("--dry-run")
+	assert.Contains(t, out, "Would adopt 1 of 2 entries")
+	saved, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	require.NoError(t, err)
+	assert.False(t, kubeconfig.IsManaged(saved, "prod"), "a dry run changes nothing")
+
+	out = run()
+	assert.Contains(t, out, "unknown_cluster")
+	assert.Contains(t, out, "Adopted 1 of 2 entries")
+	saved, err = kubeconfig.LoadKubeconfig(kubeconfigPath)
+	require.NoError(t, err)
+	assert.True(t, kubeconfig.IsManaged(saved, "prod"))
+	assert.False(t, kubeconfig.IsManaged(saved, "gone"))
+
+	st, err := state.Load(statePath)
+	require.NoError(t, err)
+	abs, err := filepath.Abs(kubeconfigPath)
+	require.NoError(t, err)
+	recorded, ok := st.Checksum(abs, "prod")
+	require.True(t, ok, "adopted entries are recorded as unmodified")
+	current, _ := kubeconfig.EntryChecksum(saved, "prod")
+	assert.Equal(t, current, recorded)
+
+	out = run()
+	assert.Contains(t, out, "already_managed")
+	assert.Contains(t, out, "Adopted 0 of 2 entries")
+}
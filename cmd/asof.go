@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/plan"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// parseAsOf reads --as-of, a date (midnight in local time) or an RFC 3339 time in the future.
+// It returns the zero time when the run is not a preview.
+func parseAsOf(cmd *cobra.Command) (time.Time, error) {
+	value := config.GetConfig(cmd, "as-of", "AS_OF")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	asOf, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		if asOf, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q: use e.g. 2025-12-01 or 2025-12-01T09:00:00Z", value)
+		}
+	}
+	if !asOf.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("date %s is not in the future", value)
+	}
+	return asOf, nil
+}
+
+// printAsOf lists the tokens that the preview found would be refreshed as of asOf
+func printAsOf(out io.Writer, asOf time.Time, p *plan.Plan) error {
+	if _, err := fmt.Fprintf(out, "As of %s, %d token(s) would be refreshed:\n", asOf.Format(time.RFC3339), len(p.UpdatedTokens)); err != nil {
+		return err
+	}
+	if len(p.UpdatedTokens) == 0 {
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CONTEXT\tCLUSTER ID\tTOKEN\tREASON")
+	for _, change := range p.UpdatedTokens {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Context, change.ClusterID, orDash(change.OldTokenName), change.Reason)
+	}
+	return w.Flush()
+}
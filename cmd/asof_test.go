@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/plan"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestParseAsOf(t *testing.T) {
+	future := time.Now().AddDate(0, 1, 0)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: ""},
+		{value: future.Format(time.DateOnly), want: time.Date(future.Year(), future.Month(), future.Day(), 0, 0, 0, 0, time.Local)},
+		{value: future.UTC().Truncate(time.Second).Format(time.RFC3339), want: future.UTC().Truncate(time.Second)},
+		{value: "2020-01-01", wantErr: true},
+		{value: "next month", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("AS_OF", "")
+			cmd := NewRootCmd()
+			require.NoError(t, cmd.Flags().Set("as-of", tt.value))
+			got, err := parseAsOf(cmd)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "got %s", got)
+		})
+	}
+}
+
+func TestUpdate_AsOf(t *testing.T) {
+	// prod's token expires in 40 days, dev's in 100 days
+	expiries := map[string]time.Time{
+		"kubeconfig-u-prod": time.Now().Add(40 * 24 * time.Hour),
+		"kubeconfig-u-dev":  time.Now().Add(100 * 24 * time.Hour),
+	}
+	clusters := rancher.Clusters{{ID: "c-prod", Name: "prod"}, {ID: "c-dev", Name: "dev"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/v3/tokens/")
+		switch {
+		case r.URL.Path == "/v3-public/localProviders/local":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "session-token"}`))
+		case r.URL.Path == "/v3/clusters":
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": clusters})
+		case !expiries[name].IsZero():
+			_, _ = fmt.Fprintf(w, `{"expiresAt": %q, "ttl": 1000}`, expiries[name].UTC().Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "config")
+	kubecfg := api.NewConfig()
+	for _, c := range clusters {
+		kubecfg.Clusters[c.Name] = &api.Cluster{Server: server.URL + "/k8s/clusters/" + c.ID}
+		kubecfg.AuthInfos[c.Name] = &api.AuthInfo{Token: "kubeconfig-u-" + c.Name + ":secret"}
+		kubecfg.Contexts[c.Name] = &api.Context{Cluster: c.Name, AuthInfo: c.Name}
+	}
+	require.NoError(t, clientcmd.WriteToFile(*kubecfg, kubeconfigPath))
+	before, err := os.ReadFile(kubeconfigPath)
+	require.NoError(t, err)
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("AS_OF", "")
+	var out bytes.Buffer
+	cmd := NewRootCmd()
+	cmd.SetOut(&out)
+	asOf := time.Now().AddDate(0, 0, 20).Format(time.DateOnly)
+	cmd.SetArgs([]string{"--server", server.URL, "--user", "admin", "-c", kubeconfigPath, "--state-file", filepath.Join(dir, "state.json"), "--as-of", asOf})
+	require.NoError(t, cmd.Execute())
+
+	assert.Contains(t, out.String(), "1 token(s) would be refreshed")
+	assert.Contains(t, out.String(), "prod")
+	assert.NotContains(t, out.String(), "dev")
+	after, err := os.ReadFile(kubeconfigPath)
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after), "a preview changes nothing")
+}
+
+func TestPrintAsOf(t *testing.T) {
+	p := plan.New(true)
+	p.UpdateToken("prod", "c-prod", "kubeconfig-u-abc:secret", "", "expires_soon")
+	var out bytes.Buffer
+	require.NoError(t, printAsOf(&out, time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), p))
+	assert.Equal(t, "As of 2026-12-01T00:00:00Z, 1 token(s) would be refreshed:\n"+
+		"CONTEXT  CLUSTER ID  TOKEN             REASON\n"+
+		"prod     c-prod      kubeconfig-u-abc  expires_soon\n", out.String())
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"rancher-kubeconfig-updater/internal/audit"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewAuditCmd creates the read-only command that reports drift between the kubeconfig and Rancher.
+func NewAuditCmd() *cobra.Command {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Report differences between the local kubeconfig and Rancher without changing anything",
+		Long: "Checks every kubeconfig entry that belongs to the Rancher server and reports findings:\n" +
+			"entries for deleted clusters, server URLs that don't match Rancher, tokens Rancher\n" +
+			"doesn't know, expired tokens, tokens belonging to other users, and global tokens that\n" +
+			"work on every cluster instead of one.\n" +
+			"The kubeconfig is never modified.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runAudit,
+	}
+
+	auditCmd.Flags().StringP("config", "c", "", "Path to kubeconfig file (default: ~/.kube/config)")
+	auditCmd.Flags().String("format", "text", "Output format: 'text' or 'json'")
+	auditCmd.Flags().String("fail-on", "", "Exit with status 1 if a finding has at least this severity: 'low', 'medium' or 'high'")
+	addRancherFlags(auditCmd)
+
+	return auditCmd
+}
+
+func runAudit(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the report, so logs go to stderr
+	zapLogger := logger.NewLoggerWithWriter(os.Stderr, zapcore.WarnLevel)
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	kubeconfigPath, _ := cmd.Flags().GetString("config")
+	format, _ := cmd.Flags().GetString("format")
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid format %q. Must be 'text' or 'json'", format)
+	}
+
+	var failOn audit.Severity
+	if value, _ := cmd.Flags().GetString("fail-on"); value != "" {
+		var err error
+		if failOn, err = audit.ParseSeverity(value); err != nil {
+			return err
+		}
+	}
+
+	kubecfg, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig file: %w", err)
+	}
+
+	client, rancherURL, err := newRancherClient(cmd, zapLogger)
+	if err != nil {
+		return err
+	}
+
+	findings, err := audit.Run(kubecfg, rancherURL, client, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		err = writeAuditJSON(cmd.OutOrStdout(), findings)
+	} else {
+		err = writeAuditText(cmd.OutOrStdout(), findings)
+	}
+	if err != nil {
+		return err
+	}
+
+	if failOn != "" {
+		for _, f := range findings {
+			if f.Severity.Rank() >= failOn.Rank() {
+				return &ExitError{Code: 1}
+			}
+		}
+	}
+	return nil
+}
+
+// writeAuditText prints findings as an aligned table followed by a summary line
+func writeAuditText(w io.Writer, findings []audit.Finding) error {
+	if len(findings) == 0 {
+		_, err := fmt.Fprintln(w, i18n.T(i18n.AuditNoFindings))
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SEVERITY\tCODE\tCONTEXT\tSCOPE\tMESSAGE")
+	counts := make(map[audit.Severity]int)
+	for _, f := range findings {
+		counts[f.Severity]++
+		scope := string(f.Scope)
+		if scope == "" {
+			scope = "-"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", f.Severity, f.Code, f.Context, scope, f.Message)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%s\n", i18n.T(i18n.AuditSummary,
+		len(findings), counts[audit.SeverityHigh], counts[audit.SeverityMedium], counts[audit.SeverityLow]))
+	return err
+}
+
+// writeAuditJSON prints findings as a JSON document
+func writeAuditJSON(w io.Writer, findings []audit.Finding) error {
+	if findings == nil {
+		findings = []audit.Finding{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Findings []audit.Finding `json:"findings"`
+	}{findings})
+}
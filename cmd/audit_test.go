@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"rancher-kubeconfig-updater/internal/audit"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditCmd_FlagsRegistered(t *testing.T) {
+	cmd := NewAuditCmd()
+
+	assert.NotNil(t, cmd.Flags().Lookup("config"))
+	assert.Equal(t, "text", cmd.Flags().Lookup("format").DefValue)
+	assert.NotNil(t, cmd.Flags().Lookup("fail-on"))
+	assert.NotNil(t, cmd.Flags().Lookup("user"))
+}
+
+func TestWriteAuditText(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeAuditText(&buf, []audit.Finding{
+		{Severity: audit.SeverityHigh, Code: audit.CodeUnknownToken, Context: "prod", Message: "token kubeconfig-u-x is not known to Rancher"},
+		{Severity: audit.SeverityMedium, Code: audit.CodeDeletedCluster, Context: "old", Message: "cluster c-old no longer exists in Rancher"},
+	})
+	require.NoError(t, err)
+
+	output := buf.String()
+	assert.Contains(t, output, "SEVERITY")
+	assert.Contains(t, output, "unknown_token")
+	assert.Contains(t, output, "2 findings (high: 1, medium: 1, low: 0)")
+
+	buf.Reset()
+	require.NoError(t, writeAuditText(&buf, nil))
+	assert.Contains(t, buf.String(), "No findings")
+}
+
+func TestWriteAuditText_Localized(t *testing.T) {
+	i18n.SetLanguage(i18n.TraditionalChinese)
+	t.Cleanup(func() { i18n.SetLanguage(i18n.English) })
+
+	var buf bytes.Buffer
+	require.NoError(t, writeAuditText(&buf, nil))
+	assert.Contains(t, buf.String(), "沒有發現問題")
+}
+
+func TestWriteAuditJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeAuditJSON(&buf, nil))
+
+	var decoded struct {
+		Findings []audit.Finding `json:"findings"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.NotNil(t, decoded.Findings)
+	assert.Empty(t, decoded.Findings)
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// parseAutoCreateOnly reads the comma-separated glob patterns of --auto-create-only, or returns
+// nil when auto-creation isn't limited
+func parseAutoCreateOnly(cmd *cobra.Command) ([]string, error) {
+	value := config.GetConfig(cmd, "auto-create-only", "AUTO_CREATE_ONLY")
+	var patterns []string
+	for pattern := range strings.SplitSeq(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid cluster pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if value != "" && len(patterns) == 0 {
+		return nil, fmt.Errorf("no cluster pattern in %q", value)
+	}
+	return patterns, nil
+}
+
+// newClusters returns the clusters whose entries auto-create would add: clusters with neither an
+// entry of their name nor a managed entry of an earlier name, which would only be renamed
+func newClusters(kubecfg *api.Config, clusters rancher.Clusters, opts clusterOptions) rancher.Clusters {
+	var added rancher.Clusters
+	for _, v := range clusters {
+		if !pipeline.AutoCreates(v, opts.Options) {
+			continue
+		}
+		if _, exists := kubecfg.AuthInfos[v.Name]; exists {
+			continue
+		}
+		if _, found := kubeconfig.FindManagedEntry(kubecfg, opts.RancherURL, v.ID); found {
+			continue
+		}
+		added = append(added, v)
+	}
+	return added
+}
+
+// declinedClusters lets the user pick the new clusters to add with opts.selectNew and returns the
+// IDs of the others. Without a prompt, every new cluster is added.
+func declinedClusters(kubecfg *api.Config, clusters rancher.Clusters, opts clusterOptions, zapLogger *zap.Logger) map[string]bool {
+	if opts.selectNew == nil {
+		return nil
+	}
+	added := newClusters(kubecfg, clusters, opts)
+	if len(added) == 0 {
+		return nil
+	}
+	names := make([]string, len(added))
+	for i, v := range added {
+		names[i] = v.Name
+	}
+	selected := make(map[string]bool)
+	for _, name := range opts.selectNew(names) {
+		selected[name] = true
+	}
+	declined := make(map[string]bool)
+	for _, v := range added {
+		if !selected[v.Name] {
+			declined[v.ID] = true
+		}
+	}
+	zapLogger.Info("Selected new clusters to add", zap.Int("selected", len(added)-len(declined)), zap.Int("declined", len(declined)))
+	return declined
+}
+
+// parseSelection parses an answer picking from n numbered items: "all", "none" or numbers and
+// ranges such as "1,3-5". It returns the chosen items' indexes in ascending order.
+func parseSelection(answer string, n int) ([]int, error) {
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	switch answer {
+	case "", "n", "none":
+		return nil, nil
+	case "a", "all":
+		all := make([]int, n)
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+	chosen := make([]bool, n)
+	for part := range strings.SplitSeq(answer, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number or range", part)
+		}
+		last, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number or range", part)
+		}
+		if first < 1 || last > n || first > last {
+			return nil, fmt.Errorf("%q is not between 1 and %d", part, n)
+		}
+		for i := first; i <= last; i++ {
+			chosen[i-1] = true
+		}
+	}
+	var indexes []int
+	for i, ok := range chosen {
+		if ok {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes, nil
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/history"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestParseAutoCreateOnly(t *testing.T) {
+	t.Setenv("AUTO_CREATE_ONLY", "")
+	patterns, err := parseAutoCreateOnly(NewRootCmd())
+	require.NoError(t, err)
+	assert.Nil(t, patterns)
+
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--auto-create-only", " prod-*, c-m-abc12 ,"}))
+	patterns, err = parseAutoCreateOnly(cmd)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prod-*", "c-m-abc12"}, patterns)
+
+	t.Setenv("AUTO_CREATE_ONLY", "prod-[")
+	_, err = parseAutoCreateOnly(NewRootCmd())
+	assert.ErrorContains(t, err, `invalid cluster pattern "prod-["`)
+
+	t.Setenv("AUTO_CREATE_ONLY", " , ")
+	_, err = parseAutoCreateOnly(NewRootCmd())
+	assert.Error(t, err)
+}
+
+func TestUpdate_AutoCreateOnly(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "me",
+		rancher.Cluster{ID: "c-prod", Name: "prod-eu"},
+		rancher.Cluster{ID: "c-dev", Name: "dev"},
+		rancher.Cluster{ID: "c-sandbox", Name: "sandbox"})
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "config")
+	statePath := filepath.Join(dir, "state.json")
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("AUTO_CREATE_ONLY", "")
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--server", server.URL, "--user", "admin", "-c", kubeconfigPath, "--state-file", statePath,
+		"--auto-create-only", "prod-*,c-dev"})
+	require.NoError(t, cmd.Execute())
+
+	saved, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	require.NoError(t, err)
+	assert.Contains(t, saved.Contexts, "prod-eu")
+	assert.Contains(t, saved.Contexts, "dev")
+	assert.NotContains(t, saved.Contexts, "sandbox")
+
+	runs, err := history.Load(history.PathFor(statePath))
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, history.OutcomeSucceeded, runs[0].Outcome, "unmatched clusters are skipped, not failed")
+	assert.Contains(t, runs[0].Clusters, history.Cluster{Cluster: "sandbox", Result: history.ResultSkipped, Reason: pipeline.SkipReasonNotAutoCreated})
+}
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   []int
+	}{
+		{answer: "", want: nil},
+		{answer: "none", want: nil},
+		{answer: "All", want: []int{0, 1, 2, 3}},
+		{answer: "3, 1", want: []int{0, 2}},
+		{answer: "2-4,3", want: []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		got, err := parseSelection(tt.answer+"\n", 4)
+		require.NoError(t, err, tt.answer)
+		assert.Equal(t, tt.want, got, tt.answer)
+	}
+
+	for _, answer := range []string{"5", "0", "3-2", "prod", "1-x"} {
+		_, err := parseSelection(answer, 4)
+		assert.Error(t, err, answer)
+	}
+}
+
+func TestDeclinedClusters(t *testing.T) {
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-me:secret"}
+	clusters := rancher.Clusters{
+		{ID: "c-prod", Name: "prod"},
+		{ID: "c-dev", Name: "dev"},
+		{ID: "c-sandbox", Name: "sandbox"},
+	}
+	var asked []string
+	opts := clusterOptions{
+		Options: pipeline.Options{
+			AutoCreate: true,
+		},
+		selectNew: func(names []string) []string {
+			asked = names
+			return []string{"dev"}
+		},
+	}
+
+	declined := declinedClusters(kubecfg, clusters, opts, zap.NewNop())
+	assert.Equal(t, []string{"dev", "sandbox"}, asked, "only clusters without an entry are offered")
+	assert.Equal(t, map[string]bool{"c-sandbox": true}, declined)
+
+	// Without a prompt, or when there is nothing new, nobody is asked
+	opts.selectNew = nil
+	assert.Nil(t, declinedClusters(kubecfg, clusters, opts, zap.NewNop()))
+	asked = nil
+	opts.selectNew = func(names []string) []string { asked = names; return nil }
+	assert.Nil(t, declinedClusters(kubecfg, clusters[:1], opts, zap.NewNop()))
+	assert.Nil(t, asked)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"runtime"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// browserLoginTimeout bounds how long a browser login waits for the user
+	browserLoginTimeout = 15 * time.Minute
+	// browserLoginPollInterval is how often Rancher is asked whether the user has logged in
+	browserLoginPollInterval = 3 * time.Second
+)
+
+// loginInBrowser logs in through Rancher's web UI: the login page is opened in the default
+// browser and printed, so it can also be opened on another machine, and the token is
+// picked up once the user has logged in. With --device-code no local browser is tried.
+func loginInBrowser(settings rancherSettings, logger *zap.Logger) (*rancher.Client, error) {
+	request, err := rancher.NewLoginRequest(settings.url, settings.insecureSkipTLSVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.deviceCode {
+		fmt.Fprint(os.Stderr, i18n.T(i18n.PromptRemoteLogin, request.URL))
+	} else {
+		fmt.Fprint(os.Stderr, i18n.T(i18n.PromptBrowserLogin, request.URL))
+		if err := openBrowser(request.URL); err != nil {
+			logger.Debug("Failed to open the browser", zap.Error(err))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), browserLoginTimeout)
+	defer cancel()
+	token, err := request.Wait(ctx, browserLoginPollInterval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with Rancher: %w", err)
+	}
+	logger.Debug("Successfully authenticated with Rancher in the browser")
+	return rancher.NewClientWithToken(settings.url, token, logger, settings.insecureSkipTLSVerify, settings.clientOptions()...), nil
+}
+
+// openBrowser opens url in the default browser without waiting for it
+func openBrowser(url string) error {
+	var browser *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		browser = exec.Command("open", url)
+	case "windows":
+		browser = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		browser = exec.Command("xdg-open", url)
+	}
+	if err := browser.Start(); err != nil {
+		return err
+	}
+	// Reap the launcher in the background; the browser itself keeps running
+	go func() { _ = browser.Wait() }()
+	return nil
+}
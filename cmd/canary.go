@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// canaryTimeout bounds the request that checks the canary's new token
+const canaryTimeout = 30 * time.Second
+
+// checkAccess checks the credentials of a kubeconfig entry against its cluster. A variable so
+// tests can replace it: the credentials are only sent over TLS.
+var checkAccess = kubeconfig.CheckAccess
+
+// canaryFirst returns clusters with the --canary cluster, matched by name or ID like --cluster,
+// moved to the front. It is an error if the canary is not among clusters, since the run would
+// otherwise go ahead unprotected.
+func canaryFirst(clusters rancher.Clusters, canary string) (rancher.Clusters, error) {
+	for i, c := range clusters {
+		if strings.EqualFold(c.Name, canary) || strings.EqualFold(c.ID, canary) {
+			ordered := make(rancher.Clusters, 0, len(clusters))
+			ordered = append(ordered, c)
+			ordered = append(ordered, clusters[:i]...)
+			return append(ordered, clusters[i+1:]...), nil
+		}
+	}
+	return nil, fmt.Errorf("canary cluster %q is not among the clusters to update", canary)
+}
+
+// verifyCanary checks that the cluster accepts the new token of the canary's kubeconfig entry
+func verifyCanary(ctx context.Context, kubecfg *api.Config, v rancher.Cluster) error {
+	ctx, cancel := context.WithTimeout(ctx, canaryTimeout)
+	defer cancel()
+	if err := checkAccess(ctx, kubecfg, v.Name); err != nil {
+		return fmt.Errorf("new token of canary cluster %s does not work: %w", v.Name, err)
+	}
+	return nil
+}
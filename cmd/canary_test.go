@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// newCanaryServer returns a Rancher stub that records in generated the IDs of the clusters
+// whose kubeconfigs were generated, in order. The token of each cluster ends in its ID.
+func newCanaryServer(t *testing.T, generated *[]string, clusters ...rancher.Cluster) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v3-public/localProviders/local":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "session-token"}`))
+		case r.URL.Path == "/v3/clusters":
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": clusters})
+		case r.URL.Query().Get("action") == "generateKubeconfig":
+			id := strings.TrimPrefix(r.URL.Path, "/v3/clusters/")
+			mu.Lock()
+			*generated = append(*generated, id)
+			mu.Unlock()
+			for _, c := range clusters {
+				if c.ID == id {
+					_ = json.NewEncoder(w).Encode(map[string]string{"config": generatedKubeconfig(c.Name, c.ID, "kubeconfig-u-abc:"+c.ID)})
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// rejectToken replaces the cluster check with one that rejects the token ending in broken
+func rejectToken(t *testing.T, broken string) {
+	previous := checkAccess
+	checkAccess = func(ctx context.Context, c *api.Config, name string) error {
+		if authInfo := c.AuthInfos[name]; authInfo == nil || strings.HasSuffix(authInfo.Token, ":"+broken) {
+			return errors.New("cluster rejected the credentials with status 401")
+		}
+		return nil
+	}
+	t.Cleanup(func() { checkAccess = previous })
+}
+
+// processWithCanary runs processServer against server with --canary canary on an empty kubeconfig
+func processWithCanary(t *testing.T, server *httptest.Server, canary string) (*api.Config, serverResult) {
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("CANARY", "")
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", server.URL, "--user", "admin", "--canary", canary}))
+	settings, err := resolveRancherSettings(cmd)
+	require.NoError(t, err)
+
+	kubecfg := api.NewConfig()
+	opts := clusterOptions{Options: pipeline.Options{AutoCreate: true, ThresholdDays: 30}}
+	result := processServer(cmd, settings, newCredentialSource(cmd, settings), kubecfg, opts, nil, io.Discard, zap.NewNop())
+	return kubecfg, result
+}
+
+func TestProcessServer_Canary(t *testing.T) {
+	var generated []string
+	server := newCanaryServer(t, &generated,
+		rancher.Cluster{ID: "c-prod", Name: "prod"}, rancher.Cluster{ID: "c-dev", Name: "dev"}, rancher.Cluster{ID: "c-canary", Name: "canary"})
+	// Only the canary is checked, the token of prod would be rejected
+	rejectToken(t, "c-prod")
+
+	kubecfg, result := processWithCanary(t, server, "canary")
+	require.NoError(t, result.err)
+	assert.Equal(t, 3, result.updated)
+	assert.Equal(t, []string{"c-canary", "c-prod", "c-dev"}, generated, "the canary is refreshed first")
+	assert.Len(t, kubecfg.AuthInfos, 3)
+}
+
+func TestProcessServer_CanaryFails(t *testing.T) {
+	var generated []string
+	rejectToken(t, "c-canary")
+	server := newCanaryServer(t, &generated,
+		rancher.Cluster{ID: "c-prod", Name: "prod"}, rancher.Cluster{ID: "c-canary", Name: "canary"})
+
+	_, result := processWithCanary(t, server, "c-canary")
+	require.Error(t, result.err)
+	assert.ErrorContains(t, result.err, "canary cluster canary failed, the remaining 1 clusters were not updated")
+	assert.ErrorContains(t, result.err, "status 401")
+	assert.Equal(t, 1, result.failed)
+	assert.Equal(t, []string{"c-canary"}, generated, "no other cluster is refreshed")
+}
+
+func TestProcessServer_CanaryNotFound(t *testing.T) {
+	var generated []string
+	server := newCanaryServer(t, &generated, rancher.Cluster{ID: "c-prod", Name: "prod"})
+
+	_, result := processWithCanary(t, server, "staging")
+	assert.ErrorContains(t, result.err, `canary cluster "staging" is not among the clusters to update`)
+	assert.Empty(t, generated)
+}
+
+func TestCanaryFirst(t *testing.T) {
+	clusters := rancher.Clusters{{ID: "c-1", Name: "one"}, {ID: "c-2", Name: "two"}, {ID: "c-3", Name: "three"}}
+	ordered, err := canaryFirst(clusters, "TWO")
+	require.NoError(t, err)
+	assert.Equal(t, rancher.Clusters{{ID: "c-2", Name: "two"}, {ID: "c-1", Name: "one"}, {ID: "c-3", Name: "three"}}, ordered)
+	assert.Equal(t, "c-1", clusters[0].ID, "the input is not modified")
+
+	ordered, err = canaryFirst(clusters, "c-3")
+	require.NoError(t, err)
+	assert.Equal(t, "c-3", ordered[0].ID)
+}
+
+func TestProcessServers_RejectsCanary(t *testing.T) {
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("CANARY", "")
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--canary", "dev"}))
+	settings := rancherSettings{servers: []string{"https://a.example.com", "https://b.example.com"}}
+
+	_, _, err := processServers(cmd, settings, nil, api.NewConfig(), clusterOptions{}, zap.NewNop())
+	assert.ErrorContains(t, err, "--canary works with a single Rancher server")
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/checkpoint"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/state"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// defaultCheckpointEvery is how many refreshed clusters are saved together with --checkpoint
+const defaultCheckpointEvery = 10
+
+// openCheckpoint loads the --checkpoint file, or returns nil when no checkpoint was requested.
+// Progress is saved by writing the kubeconfig file part way through the run, which a
+// kubeconfig kept in a secret manager does not support.
+func openCheckpoint(cmd *cobra.Command, output *secretOutput, rancherURL string, zapLogger *zap.Logger) (*checkpoint.Checkpoint, error) {
+	path := config.GetConfig(cmd, "checkpoint", "CHECKPOINT")
+	if path == "" {
+		return nil, nil
+	}
+	if output != nil {
+		return nil, fmt.Errorf("--checkpoint can't be combined with --output")
+	}
+
+	kubeconfigPath, err := kubeconfig.ResolvePath(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err := filepath.Abs(kubeconfigPath); err == nil {
+		kubeconfigPath = abs
+	}
+
+	cp, resumed, err := checkpoint.Load(path, kubeconfigPath, rancherURL, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if resumed {
+		zapLogger.Info("Resuming interrupted run from checkpoint",
+			zap.String("checkpoint", path),
+			zap.Int("clustersDone", len(cp.Done)),
+			zap.Time("started", cp.Started))
+	}
+	return cp, nil
+}
+
+// checkpointEvery returns after how many refreshed clusters progress is saved
+func checkpointEvery(cmd *cobra.Command) int {
+	if every := config.GetInt(cmd, "checkpoint-every", "CHECKPOINT_EVERY"); every > 0 {
+		return every
+	}
+	return defaultCheckpointEvery
+}
+
+// progressSaver saves the kubeconfig together with the checkpoint every few refreshed
+// clusters. All methods are safe on a nil *progressSaver and one without a checkpoint,
+// which save nothing.
+type progressSaver struct {
+	cp       *checkpoint.Checkpoint
+	every    int
+	saveOpts []kubeconfig.SaveOption
+	// base is the kubeconfig as last read from or written to the file
+	base *api.Config
+	// unsaved counts the clusters refreshed since progress was last saved
+	unsaved int
+}
+
+// checkpoint returns the checkpoint, or nil when progress is not saved
+func (p *progressSaver) checkpoint() *checkpoint.Checkpoint {
+	if p == nil {
+		return nil
+	}
+	return p.cp
+}
+
+// isDone reports whether an interrupted run already finished the cluster
+func (p *progressSaver) isDone(clusterID string) bool {
+	return p.checkpoint().IsDone(clusterID)
+}
+
+// done records a finished cluster and saves kubecfg, which is updated in place with the
+// changes other programs made to the file, once enough clusters were refreshed.
+func (p *progressSaver) done(kubecfg *api.Config, clusterID string, refreshed bool, st *state.State, zapLogger *zap.Logger) error {
+	if p.checkpoint() == nil {
+		return nil
+	}
+	p.cp.MarkDone(clusterID, time.Now())
+	if refreshed {
+		p.unsaved++
+	}
+	if p.unsaved < p.every {
+		return nil
+	}
+
+	saved, err := commitKubeconfig(p.base, kubecfg, st, p.cp, p.saveOpts, zapLogger)
+	if err != nil {
+		return err
+	}
+	*kubecfg = *saved
+	p.base = saved.DeepCopy()
+	p.unsaved = 0
+	zapLogger.Info("Saved progress to checkpoint", zap.Int("clustersDone", len(p.cp.Done)))
+	return nil
+}
+
+// finish deletes the checkpoint once every cluster of the cycle is done
+func (p *progressSaver) finish(zapLogger *zap.Logger) {
+	if p.checkpoint() == nil {
+		return
+	}
+	if err := p.cp.Remove(); err != nil {
+		zapLogger.Warn("Failed to remove checkpoint after completing the run", zap.Error(err))
+	}
+}
+
+// commitKubeconfig merges changes other tools made to the file since base was read and
+// writes kubecfg together with the state and checkpoint (both optional), so they never
+// disagree. Returns the kubeconfig as written.
+func commitKubeconfig(base, kubecfg *api.Config, st *state.State, cp *checkpoint.Checkpoint, saveOpts []kubeconfig.SaveOption, zapLogger *zap.Logger) (*api.Config, error) {
+	kubecfg, err := mergeExternalChanges(base, kubecfg, configPath, zapLogger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-read kubeconfig file before saving: %w", err)
+	}
+
+	tx := kubeconfig.NewTransaction()
+	if _, err := tx.StageKubeconfig(kubecfg, configPath, zapLogger, saveOpts...); err != nil {
+		return nil, fmt.Errorf("failed to save kubeconfig file: %w", err)
+	}
+	if st != nil {
+		if err := st.Stage(tx); err != nil {
+			zapLogger.Warn("Failed to save state file", zap.Error(err))
+		}
+	}
+	if cp != nil {
+		if err := cp.Stage(tx); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to save kubeconfig file: %w", err)
+	}
+	return kubecfg, nil
+}
+
+// skipReasonCheckpoint is the plan skip reason for clusters an interrupted run already finished
+const skipReasonCheckpoint = "done_in_checkpoint"
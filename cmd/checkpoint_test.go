@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// newCheckpointTestCmd returns a command with the checkpoint flags parsed from args
+func newCheckpointTestCmd(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("CHECKPOINT_EVERY", "")
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("checkpoint", "", "")
+	cmd.Flags().Int("checkpoint-every", defaultCheckpointEvery, "")
+	require.NoError(t, cmd.ParseFlags(args))
+	return cmd
+}
+
+// useConfigPath points the global --config value at path for the duration of the test
+func useConfigPath(t *testing.T, path string) {
+	t.Helper()
+	previous := configPath
+	configPath = path
+	t.Cleanup(func() { configPath = previous })
+}
+
+func TestOpenCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	useConfigPath(t, filepath.Join(dir, "config"))
+
+	cp, err := openCheckpoint(newCheckpointTestCmd(t), nil, "https://rancher.example.com", zap.NewNop())
+	require.NoError(t, err)
+	assert.Nil(t, cp, "no checkpoint without --checkpoint")
+
+	cmd := newCheckpointTestCmd(t, "--checkpoint", filepath.Join(dir, "checkpoint.json"))
+	cp, err = openCheckpoint(cmd, nil, "https://rancher.example.com", zap.NewNop())
+	require.NoError(t, err)
+	require.NotNil(t, cp)
+	assert.Equal(t, filepath.Join(dir, "config"), cp.Kubeconfig)
+
+	_, err = openCheckpoint(cmd, &secretOutput{ref: "azkv://vault/kubeconfig"}, "https://rancher.example.com", zap.NewNop())
+	assert.ErrorContains(t, err, "can't be combined with --output")
+}
+
+func TestCheckpointEvery(t *testing.T) {
+	assert.Equal(t, defaultCheckpointEvery, checkpointEvery(newCheckpointTestCmd(t)))
+	assert.Equal(t, 3, checkpointEvery(newCheckpointTestCmd(t, "--checkpoint-every", "3")))
+	assert.Equal(t, defaultCheckpointEvery, checkpointEvery(newCheckpointTestCmd(t, "--checkpoint-every", "0")))
+}
+
+func TestCommitKubeconfig_SavesCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	useConfigPath(t, filepath.Join(dir, "config"))
+	cmd := newCheckpointTestCmd(t, "--checkpoint", filepath.Join(dir, "checkpoint.json"))
+	cp, err := openCheckpoint(cmd, nil, "https://rancher.example.com", zap.NewNop())
+	require.NoError(t, err)
+
+	base := api.NewConfig()
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-new:newsecret"}
+	cp.MarkDone("c-prod", time.Now())
+
+	saved, err := commitKubeconfig(base, kubecfg, nil, cp, nil, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "kubeconfig-u-new:newsecret", saved.AuthInfos["prod"].Token)
+
+	written, err := kubeconfig.LoadKubeconfig(filepath.Join(dir, "config"))
+	require.NoError(t, err)
+	assert.Equal(t, "kubeconfig-u-new:newsecret", written.AuthInfos["prod"].Token)
+
+	// The next run resumes after the saved cluster
+	resumed, err := openCheckpoint(cmd, nil, "https://rancher.example.com", zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, resumed.IsDone("c-prod"))
+
+	require.NoError(t, resumed.Remove())
+	_, err = os.Stat(filepath.Join(dir, "checkpoint.json"))
+	assert.True(t, os.IsNotExist(err))
+}
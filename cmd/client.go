@@ -0,0 +1,685 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/credprovider"
+	"rancher-kubeconfig-updater/internal/federation"
+	"rancher-kubeconfig-updater/internal/metrics"
+	"rancher-kubeconfig-updater/internal/profile"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/secretstore"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// addRancherFlags registers the flags needed to authenticate with Rancher.
+// Values are resolved through the config package, so they are not bound to variables.
+func addRancherFlags(cmd *cobra.Command) {
+	cmd.Flags().Var(&listFlag{}, "server", "Rancher server URL, e.g. https://rancher.example.com; updating accepts several, repeated or comma-separated (default: from RANCHER_URL env)")
+	cmd.Flags().String("auth-type", "", "Authentication type: 'local', 'ldap', 'github', 'googleoauth' and 'saml' which log in through the browser, or 'oidc' for any OpenID Connect provider (default: from RANCHER_AUTH_TYPE env or 'local')")
+	cmd.Flags().String("auth-provider-name", "", "Name of the auth provider instance to log in through, for admins running several, e.g. corp-ldap (default: 'local', 'openldap' or 'genericoidc')")
+	cmd.Flags().String("issuer", "", "Issuer URL of the OpenID Connect provider for --auth-type oidc, e.g. https://login.example.com/realms/corp")
+	cmd.Flags().Bool("device-code", false, "Log in without a local browser, e.g. on a jump host: print an address (and code) to open on another device (github, googleoauth, saml and oidc logins)")
+	cmd.Flags().String("oidc-client-id", "", "Client ID for --auth-type oidc; the client must allow PKCE and redirects to http://127.0.0.1")
+	cmd.Flags().StringP("user", "u", "", "Rancher Username")
+	cmd.Flags().StringP("password", "p", "", "Rancher Password")
+	// Set NoOptDefVal for password to allow interactive prompt when flag is present without value
+	cmd.Flags().Lookup("password").NoOptDefVal = "-"
+	cmd.Flags().Bool("insecure-skip-tls-verify", false, "Skip TLS certificate verification (insecure, use only for development/testing)")
+	cmd.Flags().Bool("cache-session", false, "Reuse the Rancher login session between runs (stored encrypted with DPAPI on Windows)")
+	cmd.Flags().Bool("remember-password", false, "Store the password for later runs (stored encrypted with DPAPI on Windows)")
+	cmd.Flags().String("credential-command", "", "Shell command that prints the Rancher password or API token, e.g. \"op read op://vault/rancher/password\"")
+	cmd.Flags().Float64("qps", 0, "Maximum Rancher API requests per second across the whole run, e.g. to stay under an API gateway quota (default: unlimited)")
+	cmd.Flags().String("profiles-config", "", "Profiles file whose every profile's Rancher server is updated, each with its own auth type, credentials, TLS settings and cluster filters")
+	cmd.Flags().String("api-token", "", "Rancher API token (token-xxxxx:secret) to use instead of logging in, e.g. in CI; prefer the RANCHER_TOKEN env var")
+	cmd.Flags().String("federated-token", "", "Log in with the CI job's OIDC token instead of a secret: 'github-actions', 'gitlab', 'env:NAME' or 'file:PATH' (implies --auth-type oidc)")
+	cmd.Flags().String("federated-audience", "", "Audience of the GitHub Actions token for --federated-token (default: --oidc-client-id)")
+	cmd.Flags().String("credentials-from", "", "Secret reference of the Rancher password or API token: op://vault/item/field, bw://item[/field], gcp-sm://projects/PROJECT/secrets/SECRET or azkv://VAULT/SECRET")
+}
+
+// listFlag is a string flag that may be repeated; the values are joined with commas, so it
+// reads like a comma-separated string flag
+type listFlag struct {
+	value string
+}
+
+func (f *listFlag) String() string {
+	return f.value
+}
+
+func (f *listFlag) Set(value string) error {
+	if f.value != "" {
+		value = f.value + "," + value
+	}
+	f.value = value
+	return nil
+}
+
+func (f *listFlag) Type() string {
+	return "string"
+}
+
+// parseAuthType converts the auth-type setting into a rancher.AuthType
+func parseAuthType(value string) (rancher.AuthType, error) {
+	switch value {
+	case "", "local":
+		return rancher.AuthTypeLocal, nil
+	case "ldap":
+		return rancher.AuthTypeLDAP, nil
+	case "github":
+		return rancher.AuthTypeGitHub, nil
+	case "googleoauth":
+		return rancher.AuthTypeGoogleOAuth, nil
+	case "saml":
+		return rancher.AuthTypeSAML, nil
+	case "oidc":
+		return rancher.AuthTypeOIDC, nil
+	default:
+		return "", fmt.Errorf("invalid auth-type value %q. Must be 'local', 'ldap', 'github', 'googleoauth', 'saml' or 'oidc'", value)
+	}
+}
+
+// parseServerURL validates the Rancher URL setting
+func parseServerURL(value string) (string, error) {
+	if value == "" {
+		return "", fmt.Errorf("rancher URL is required: pass --server or set RANCHER_URL")
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid Rancher URL %q (from --server or RANCHER_URL): must be an http:// or https:// URL such as https://rancher.example.com", value)
+	}
+	return value, nil
+}
+
+// sameServer reports whether the Rancher URLs a and b name the same server
+func sameServer(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "/"), strings.TrimSuffix(b, "/"))
+}
+
+// parseServerURLs validates a comma-separated list of Rancher URLs. Duplicates are dropped,
+// also when they differ in a trailing slash or the case of the host.
+func parseServerURLs(value string) ([]string, error) {
+	var servers []string
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		server, err := parseServerURL(part)
+		if err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(servers, func(s string) bool { return sameServer(s, server) }) {
+			continue
+		}
+		servers = append(servers, server)
+	}
+	if len(servers) == 0 {
+		_, err := parseServerURL("")
+		return nil, err
+	}
+	return servers, nil
+}
+
+// rancherSettings holds the validated Rancher connection settings
+type rancherSettings struct {
+	// url is the first of servers, the one commands working with a single Rancher use
+	url      string
+	servers  []string
+	username string
+	authType rancher.AuthType
+	// authProviderName selects a provider instance other than the auth type's default (empty for the default)
+	authProviderName string
+	// oidcIssuer and oidcClientID configure --auth-type oidc logins
+	oidcIssuer   string
+	oidcClientID string
+	// deviceCode logs in on another device instead of opening a local browser
+	deviceCode            bool
+	insecureSkipTLSVerify bool
+	cacheSession          bool
+	rememberPassword      bool
+	// provider supplies the password or API token instead of -p/RANCHER_PASSWORD (nil if not configured)
+	provider credprovider.Provider
+	// apiToken is a Rancher API token from --api-token/RANCHER_TOKEN, used without logging in (empty if not given)
+	apiToken string
+	// federatedToken fetches the CI job's OIDC token for --federated-token (nil if not given)
+	federatedToken federation.Source
+	// federatedAudience is the audience the CI token is requested for
+	federatedAudience string
+	// qps limits the Rancher API requests per second (0 for no limit)
+	qps float64
+	// limiter enforces qps for all clients of the run together (nil for no limit)
+	limiter *rancher.RateLimiter
+	// profile names the profile of --profiles-config these settings come from (empty without profiles)
+	profile string
+	// ownCredentials is set when the profile has a credential source of its own instead of the flags'
+	ownCredentials bool
+	// clusters and includeLocal filter the server's clusters like --cluster and --include-local
+	clusters     string
+	includeLocal bool
+	// clusterSource selects where the clusters come from, see parseClusterSource
+	clusterSource string
+	// profiles holds the settings of every profile, the first of which these are (nil without profiles)
+	profiles []rancherSettings
+	// apiMetrics records the requests of the clients created from these settings, e.g. while the
+	// daemon serves --listen (nil otherwise)
+	apiMetrics *metrics.Registry
+	// apiErrors records the error responses of the clients created from these settings, e.g.
+	// while a support bundle is collected (nil otherwise)
+	apiErrors *rancher.ErrorLog
+	// clock is the time the clients created from these settings judge tokens at, e.g. the
+	// --as-of date of a preview (nil for the current time)
+	clock rancher.Clock
+}
+
+// clientOptions returns the options of the Rancher clients created from s. The requests are
+// timed into apiMetrics before the rate limit so that waiting for it is not counted. Error
+// responses are recorded in apiErrors, and tokens are judged as of clock.
+func (s rancherSettings) clientOptions() []rancher.ClientOption {
+	var opts []rancher.ClientOption
+	if s.apiErrors != nil {
+		opts = append(opts, rancher.WithErrorLog(s.apiErrors))
+	}
+	if s.clock != nil {
+		opts = append(opts, rancher.WithClock(s.clock))
+	}
+	if registry := s.apiMetrics; registry != nil {
+		opts = append(opts, rancher.WithRequestTimer(func(method, path string, status int, elapsed time.Duration) {
+			registry.Observe(rancher.Endpoint(method, path), status, elapsed)
+		}))
+	}
+	return append(opts, rancher.WithRateLimiter(s.limiter), rancher.WithAuthProviderName(s.authProviderName))
+}
+
+// authKey identifies the login provider in cache keys. Default providers keep the plain auth
+// type, so sessions and passwords stored before provider names existed are still found.
+func (s rancherSettings) authKey() string {
+	if s.authProviderName == "" {
+		return string(s.authType)
+	}
+	return string(s.authType) + "/" + s.authProviderName
+}
+
+// resolveRancherSettings reads the Rancher settings with priority Flag > Env > Default and
+// validates them without prompting or contacting Rancher. With --profiles-config every
+// profile is resolved on its own, falling back to the flags for what it leaves out. Every
+// problem is reported in a single error, so a misconfigured environment can be fixed in one go.
+func resolveRancherSettings(cmd *cobra.Command) (rancherSettings, error) {
+	path := config.GetConfig(cmd, "profiles-config", "PROFILES_CONFIG")
+	if path == "" {
+		settings, problems := resolveProfile(cmd, profile.Profile{})
+		if len(problems) > 0 {
+			return rancherSettings{}, fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+		}
+		settings.url = settings.servers[0]
+		settings.limiter = rancher.NewRateLimiter(settings.qps)
+		return settings, nil
+	}
+
+	cfg, err := profile.Load(path)
+	if err != nil {
+		return rancherSettings{}, err
+	}
+	var problems []string
+	if cmd.Flags().Changed("server") {
+		problems = append(problems, "--server and --profiles-config both name the Rancher servers: use only one of them")
+	}
+	profiles := make([]rancherSettings, 0, len(cfg.Profiles))
+	var servers []string
+	for _, p := range cfg.Profiles {
+		// Run-wide settings can't differ between the servers of one run
+		if keys := p.RunSettings(); len(keys) > 0 {
+			problems = append(problems, fmt.Sprintf("profile %s: %s apply to the whole run and are only read for the profile selected with --profile", p.Name, strings.Join(keys, ", ")))
+		}
+		settings, profileProblems := resolveProfile(cmd, p)
+		for _, problem := range profileProblems {
+			problems = append(problems, fmt.Sprintf("profile %s: %s", p.Name, problem))
+		}
+		if len(profileProblems) == 0 {
+			settings.url = settings.servers[0]
+			servers = append(servers, settings.url)
+		}
+		profiles = append(profiles, settings)
+	}
+	if len(problems) > 0 {
+		return rancherSettings{}, fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+
+	// The first profile stands in for commands working with a single Rancher
+	settings := profiles[0]
+	settings.servers = servers
+	settings.profiles = profiles
+	settings.limiter = rancher.NewRateLimiter(settings.qps)
+	return settings, nil
+}
+
+// resolveProfile resolves the settings of one profile; the zero profile takes every setting
+// from the flags and environment. It returns the problems found instead of an error.
+func resolveProfile(cmd *cobra.Command, p profile.Profile) (rancherSettings, []string) {
+	var problems []string
+
+	var servers []string
+	var err error
+	if p.Server != "" {
+		var server string
+		server, err = parseServerURL(p.Server)
+		servers = []string{server}
+	} else {
+		servers, err = parseServerURLs(config.GetConfig(cmd, "server", "RANCHER_URL"))
+	}
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	// A profile with its own credential source replaces the one from the flags as a whole
+	var provider credprovider.Provider
+	providerFlag := ""
+	ownCredentials := p.CredentialCommand != "" || p.CredentialsFrom != ""
+	line, reference := p.CredentialCommand, p.CredentialsFrom
+	apiToken, federatedValue := "", ""
+	if !ownCredentials {
+		line = config.GetConfig(cmd, "credential-command", "RANCHER_CREDENTIAL_COMMAND")
+		reference = config.GetConfig(cmd, "credentials-from", "RANCHER_CREDENTIALS_FROM")
+		apiToken = strings.TrimSpace(config.GetConfig(cmd, "api-token", "RANCHER_TOKEN"))
+		federatedValue = strings.TrimSpace(config.GetConfig(cmd, "federated-token", "RANCHER_FEDERATED_TOKEN"))
+	}
+	var federatedToken federation.Source
+	if federatedValue != "" {
+		federatedToken, err = federation.ParseSource(federatedValue)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		if apiToken != "" || line != "" || reference != "" {
+			problems = append(problems, "--federated-token and --api-token, --credential-command or --credentials-from both provide the credential: use only one of them")
+		}
+		if cmd.Flags().Changed("password") {
+			problems = append(problems, "-p and --federated-token both provide the credential: use only one of them")
+		}
+	}
+	switch {
+	case apiToken != "" && (line != "" || reference != ""):
+		problems = append(problems, "--api-token and --credential-command or --credentials-from both provide the credential: use only one of them")
+	case apiToken != "":
+		// Only the token is needed, which Rancher itself validates on the first request
+		providerFlag = "--api-token"
+	case line != "" && reference != "":
+		problems = append(problems, "--credential-command and --credentials-from both provide the password: use only one of them")
+	case line != "":
+		provider, providerFlag = credprovider.NewCommand(line), "--credential-command"
+	case reference != "":
+		provider, err = credprovider.FromReference(reference)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		providerFlag = "--credentials-from"
+	}
+	if providerFlag != "" && !ownCredentials && cmd.Flags().Changed("password") {
+		problems = append(problems, fmt.Sprintf("-p and %s both provide the password: use only one of them", providerFlag))
+	}
+
+	authTypeValue := profileValue(cmd, p.AuthType, "auth-type", "RANCHER_AUTH_TYPE")
+	if federatedValue != "" && authTypeValue == "" {
+		// The CI token is only ever accepted by Rancher's OIDC provider
+		authTypeValue = string(rancher.AuthTypeOIDC)
+	}
+	authType, err := parseAuthType(authTypeValue)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	if federatedValue != "" && err == nil && authType != rancher.AuthTypeOIDC {
+		problems = append(problems, fmt.Sprintf("--federated-token logs in through Rancher's OIDC provider, not %s: drop --auth-type or set it to oidc", authType))
+	}
+	authProviderName := strings.TrimSpace(profileValue(cmd, p.AuthProviderName, "auth-provider-name", "RANCHER_AUTH_PROVIDER_NAME"))
+	if authProviderName != "" && authType.UsesBrowser() {
+		problems = append(problems, fmt.Sprintf("--auth-provider-name only applies to local, ldap and oidc logins; %s logins pick the provider in the browser", authType))
+	}
+	oidcIssuer := profileValue(cmd, p.Issuer, "issuer", "RANCHER_OIDC_ISSUER")
+	oidcClientID := profileValue(cmd, p.OIDCClientID, "oidc-client-id", "RANCHER_OIDC_CLIENT_ID")
+	switch {
+	case federatedValue != "":
+		// Without an issuer Rancher trusts the CI platform itself and the token is passed on as is
+		if oidcIssuer != "" {
+			if err := validateIssuer(oidcIssuer); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+		if oidcIssuer != "" && oidcClientID == "" {
+			problems = append(problems, "OIDC client ID is required to exchange the --federated-token at --issuer: pass --oidc-client-id or set RANCHER_OIDC_CLIENT_ID")
+		}
+	case authType == rancher.AuthTypeOIDC && providerFlag == "":
+		if err := validateIssuer(oidcIssuer); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if oidcClientID == "" {
+			problems = append(problems, "OIDC client ID is required for --auth-type oidc: pass --oidc-client-id or set RANCHER_OIDC_CLIENT_ID")
+		}
+	}
+	federatedAudience := config.GetConfig(cmd, "federated-audience", "RANCHER_FEDERATED_AUDIENCE")
+	if federatedAudience == "" {
+		federatedAudience = oidcClientID
+	}
+
+	deviceCode := config.GetBool(cmd, "device-code", "RANCHER_DEVICE_CODE")
+	if deviceCode && authType.TakesPassword() {
+		problems = append(problems, fmt.Sprintf("--device-code only applies to github, googleoauth, saml and oidc logins, not %s", authType))
+	}
+	if deviceCode && federatedValue != "" {
+		problems = append(problems, "--device-code and --federated-token both choose how to log in: use only one of them")
+	}
+
+	// An API token from a credential provider or a browser login needs no username; a password is checked once it is known
+	username := profileValue(cmd, p.User, "user", "RANCHER_USERNAME")
+	if username == "" && providerFlag == "" && authType.TakesPassword() {
+		problems = append(problems, "rancher username is required: pass --user or set RANCHER_USERNAME")
+	}
+
+	clusterSource, err := parseClusterSource(profileValue(cmd, p.ClusterSource, "cluster-source", "CLUSTER_SOURCE"))
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	qps := config.GetFloat(cmd, "qps", "RANCHER_QPS")
+	if qps < 0 {
+		problems = append(problems, fmt.Sprintf("invalid qps value %v: must not be negative", qps))
+	}
+
+	settings := rancherSettings{
+		servers:               servers,
+		username:              username,
+		authType:              authType,
+		authProviderName:      authProviderName,
+		oidcIssuer:            oidcIssuer,
+		oidcClientID:          oidcClientID,
+		deviceCode:            deviceCode,
+		insecureSkipTLSVerify: profileBool(cmd, p.InsecureSkipTLSVerify, "insecure-skip-tls-verify", "RANCHER_INSECURE_SKIP_TLS_VERIFY"),
+		cacheSession:          config.GetBool(cmd, "cache-session", "RANCHER_CACHE_SESSION"),
+		rememberPassword:      config.GetBool(cmd, "remember-password", "RANCHER_REMEMBER_PASSWORD"),
+		provider:              provider,
+		apiToken:              apiToken,
+		federatedToken:        federatedToken,
+		federatedAudience:     federatedAudience,
+		qps:                   qps,
+		profile:               p.Name,
+		ownCredentials:        ownCredentials,
+		clusters:              clusterFlag,
+		includeLocal:          profileBool(cmd, p.IncludeLocal, "include-local", "INCLUDE_LOCAL"),
+		clusterSource:         clusterSource,
+	}
+	if len(p.Clusters) > 0 {
+		settings.clusters = strings.Join(p.Clusters, ",")
+	}
+
+	// A cached session or stored password can stand in for the password, which is only known after looking
+	passwordGiven := cmd.Flags().Changed("password") || os.Getenv("RANCHER_PASSWORD") != "" || providerFlag != ""
+	if !passwordGiven && !settings.cacheSession && !settings.rememberPassword && authType.TakesPassword() {
+		problems = append(problems, "rancher password is required: pass -p to enter it interactively or set RANCHER_PASSWORD")
+	}
+
+	return settings, problems
+}
+
+// profileValue returns the profile's value, or the flag or environment variable when the profile leaves it empty
+func profileValue(cmd *cobra.Command, value, flagName, envKey string) string {
+	if value != "" {
+		return value
+	}
+	return config.GetConfig(cmd, flagName, envKey)
+}
+
+// profileBool returns the profile's value, or the flag or environment variable when the profile leaves it unset
+func profileBool(cmd *cobra.Command, value *bool, flagName, envKey string) bool {
+	if value != nil {
+		return *value
+	}
+	return config.GetBool(cmd, flagName, envKey)
+}
+
+// perServer returns the settings of every server to process: the profiles, or a copy of the
+// settings for each URL of --server. The profiles share the run's apiMetrics, apiErrors and clock.
+func (s rancherSettings) perServer() []rancherSettings {
+	if len(s.profiles) > 0 {
+		all := slices.Clone(s.profiles)
+		for i := range all {
+			all[i].apiMetrics, all[i].apiErrors, all[i].clock, all[i].limiter = s.apiMetrics, s.apiErrors, s.clock, s.limiter
+		}
+		return all
+	}
+	all := make([]rancherSettings, 0, len(s.servers))
+	for _, server := range s.servers {
+		serverSettings := s
+		serverSettings.url = server
+		all = append(all, serverSettings)
+	}
+	return all
+}
+
+// newRancherClient resolves the Rancher settings from flags and environment
+// variables and returns an authenticated client together with the Rancher URL.
+// With --cache-session a previously stored login session is reused while Rancher
+// still accepts it, and with --remember-password a stored password is used when
+// none is given.
+func newRancherClient(cmd *cobra.Command, logger *zap.Logger) (*rancher.Client, string, error) {
+	settings, err := resolveRancherSettings(cmd)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(settings.servers) > 1 {
+		return nil, "", fmt.Errorf("%s works with a single Rancher server, but %d are configured in --server/RANCHER_URL or --profiles-config", cmd.Name(), len(settings.servers))
+	}
+
+	credentials := newCredentialSource(cmd, settings)
+	defer credentials.clear()
+	return connectRancher(settings, credentials, logger)
+}
+
+// connectRancher returns an authenticated client for settings.url, taking the password or
+// API token from credentials only when no cached session can be reused. An API token from
+// --api-token is used as is, without logging in or caching anything.
+func connectRancher(settings rancherSettings, credentials *credentialSource, logger *zap.Logger) (*rancher.Client, string, error) {
+	if settings.apiToken != "" {
+		return clientFromAPIToken(settings, []byte(settings.apiToken), "--api-token", logger)
+	}
+
+	var store *secretstore.Store
+	if settings.cacheSession || settings.rememberPassword {
+		dir, err := secretstore.ServerDir(settings.url)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to locate secret store: %w", err)
+		}
+		store = secretstore.New(dir)
+	}
+
+	sessionKey := fmt.Sprintf("session:%s|%s|%s", settings.url, settings.username, settings.authKey())
+	if settings.cacheSession {
+		if token, err := store.Load(sessionKey); err == nil {
+			client := rancher.NewClientWithToken(settings.url, string(token), logger, settings.insecureSkipTLSVerify, settings.clientOptions()...)
+			err := client.VerifyToken()
+			if err == nil {
+				logger.Debug("Reusing cached Rancher session")
+				return client, settings.url, nil
+			}
+			// The session may well be valid, it just can't be checked while the server is unreachable
+			if isConnectionError(err) {
+				return nil, "", err
+			}
+			logger.Debug("Cached Rancher session is no longer valid, logging in again")
+			_ = store.Delete(sessionKey)
+		}
+	}
+
+	// Browser, OIDC and federated logins take no password; the token comes from Rancher's web UI,
+	// the OIDC provider or the CI platform
+	var login func(rancherSettings, *zap.Logger) (*rancher.Client, error)
+	switch {
+	case settings.federatedToken != nil:
+		login = loginWithFederatedToken
+	case settings.authType.UsesBrowser():
+		login = loginInBrowser
+	case settings.authType == rancher.AuthTypeOIDC:
+		login = loginWithOIDC
+	}
+	if login != nil && settings.provider == nil {
+		client, err := login(settings, logger)
+		if err != nil {
+			return nil, "", err
+		}
+		if settings.cacheSession {
+			if err := store.Save(sessionKey, []byte(client.SessionToken())); err != nil {
+				logger.Warn("Failed to cache Rancher session", zap.Error(err))
+			}
+		}
+		return client, settings.url, nil
+	}
+
+	// The secret is shared by every server and wiped by the owner of credentials
+	rancherPassword, err := credentials.get()
+	if err != nil {
+		return nil, "", err
+	}
+	if settings.provider != nil {
+		if credprovider.Classify(rancherPassword) == credprovider.KindToken {
+			return clientFromAPIToken(settings, rancherPassword, settings.provider.Name(), logger)
+		}
+		if settings.username == "" {
+			return nil, "", fmt.Errorf("rancher username is required to log in with the password from %s: pass --user or set RANCHER_USERNAME", settings.provider.Name())
+		}
+	}
+
+	passwordKey := fmt.Sprintf("password:%s|%s|%s", settings.url, settings.username, settings.authKey())
+	if settings.rememberPassword && len(rancherPassword) == 0 {
+		if stored, err := store.Load(passwordKey); err == nil {
+			defer clear(stored)
+			rancherPassword = stored
+		}
+	}
+	if len(rancherPassword) == 0 {
+		return nil, "", fmt.Errorf("rancher password is required: pass -p to enter it interactively or set RANCHER_PASSWORD")
+	}
+
+	client, err := rancher.NewClient(settings.url, settings.username, rancherPassword, settings.authType, logger, settings.insecureSkipTLSVerify,
+		settings.clientOptions()...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to authenticate with Rancher: %w", err)
+	}
+
+	// Failing to cache only costs a login next time, so it is not fatal
+	if settings.cacheSession {
+		if err := store.Save(sessionKey, []byte(client.SessionToken())); err != nil {
+			logger.Warn("Failed to cache Rancher session", zap.Error(err))
+		}
+	}
+	if settings.rememberPassword && settings.provider == nil && len(rancherPassword) > 0 {
+		if err := store.Save(passwordKey, rancherPassword); err != nil {
+			logger.Warn("Failed to store Rancher password", zap.Error(err))
+		}
+	}
+
+	return client, settings.url, nil
+}
+
+// credentialSource reads the password or API token from the provider, -p or RANCHER_PASSWORD
+// on first use and hands the same secret to every later caller, so logging in to several
+// Rancher servers prompts or queries the secret manager only once.
+type credentialSource struct {
+	cmd      *cobra.Command
+	provider credprovider.Provider
+
+	once   sync.Once
+	secret []byte
+	err    error
+}
+
+func newCredentialSource(cmd *cobra.Command, settings rancherSettings) *credentialSource {
+	return &credentialSource{cmd: cmd, provider: settings.provider}
+}
+
+// get returns the secret, reading it on the first call. Callers must not modify it.
+func (s *credentialSource) get() ([]byte, error) {
+	s.once.Do(func() {
+		if s.provider != nil {
+			s.secret, s.err = credprovider.Fetch(commandContext(s.cmd), s.provider)
+			return
+		}
+		s.secret, s.err = config.GetPassword(s.cmd, "password", "RANCHER_PASSWORD")
+		if s.err != nil {
+			s.err = fmt.Errorf("failed to read password: %w", s.err)
+		}
+	})
+	return s.secret, s.err
+}
+
+// credentialsPerServer returns the credential source of each server. Servers logging in with
+// the flags' credentials share one source, so the password is read once; profiles with a
+// credential source of their own get a source each. shared was made for settings and is
+// reused when settings use the flags' credentials. The returned function wipes the new sources.
+func credentialsPerServer(cmd *cobra.Command, settings rancherSettings, shared *credentialSource) ([]*credentialSource, func()) {
+	if settings.ownCredentials {
+		shared = nil
+	}
+	var created []*credentialSource
+	sources := make([]*credentialSource, 0, len(settings.servers))
+	for _, serverSettings := range settings.perServer() {
+		source := shared
+		if serverSettings.ownCredentials || source == nil {
+			source = newCredentialSource(cmd, serverSettings)
+			created = append(created, source)
+			if !serverSettings.ownCredentials {
+				shared = source
+			}
+		}
+		sources = append(sources, source)
+	}
+	return sources, func() {
+		for _, source := range created {
+			source.clear()
+		}
+	}
+}
+
+// clear wipes the secret once no more logins need it. A password only lives in the login
+// request, which is wiped too; an API token is kept by the client as a string and stays in
+// memory for as long as the client does.
+func (s *credentialSource) clear() {
+	clear(s.secret)
+}
+
+// clientFromAPIToken returns a client that uses a Rancher API token from source, --api-token
+// or a credential provider, instead of logging in. The token is verified first so a revoked
+// or mistyped token fails with a clear error rather than on the first API call.
+func clientFromAPIToken(settings rancherSettings, token []byte, source string, logger *zap.Logger) (*rancher.Client, string, error) {
+	client := rancher.NewClientWithToken(settings.url, string(token), logger, settings.insecureSkipTLSVerify, settings.clientOptions()...)
+	if err := client.VerifyToken(); err != nil {
+		if isConnectionError(err) {
+			return nil, "", err
+		}
+		return nil, "", fmt.Errorf("rancher rejected the API token from %s: %w", source, err)
+	}
+	return client, settings.url, nil
+}
+
+// commandContext returns the command's context, or a background context when it has none
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// findCluster returns the cluster whose name or ID matches nameOrID (case-insensitive)
+func findCluster(clusters rancher.Clusters, nameOrID string) (*rancher.Cluster, error) {
+	for i := range clusters {
+		if strings.EqualFold(clusters[i].Name, nameOrID) || strings.EqualFold(clusters[i].ID, nameOrID) {
+			return &clusters[i], nil
+		}
+	}
+	return nil, fmt.Errorf("cluster %s not found in Rancher", nameOrID)
+}
@@ -0,0 +1,467 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newSessionTestServer returns a Rancher stub that counts logins and accepts only the issued token
+func newSessionTestServer(t *testing.T, logins *int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3-public/localProviders/local":
+			atomic.AddInt32(logins, 1)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "session-token"}`))
+		case "/v3/users":
+			if r.Header.Get("Authorization") != "Bearer session-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"data": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newClientTestCmd(args ...string) *cobra.Command {
+	cmd := &cobra.Command{Use: "test"}
+	addRancherFlags(cmd)
+	_ = cmd.ParseFlags(args)
+	return cmd
+}
+
+func TestNewRancherClient_CacheSession(t *testing.T) {
+	var logins int32
+	server := newSessionTestServer(t, &logins)
+	t.Setenv("RANCHER_URL", server.URL)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("RANCHER_PASSWORD", "secret")
+
+	for i := 0; i < 2; i++ {
+		client, _, err := newRancherClient(newClientTestCmd("--user", "admin", "--cache-session"), zap.NewNop())
+		require.NoError(t, err)
+		assert.Equal(t, "session-token", client.SessionToken())
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&logins), "second run should reuse the cached session")
+}
+
+func TestNewRancherClient_WithoutCacheSessionLogsInEveryTime(t *testing.T) {
+	var logins int32
+	server := newSessionTestServer(t, &logins)
+	t.Setenv("RANCHER_URL", server.URL)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("RANCHER_PASSWORD", "secret")
+
+	for i := 0; i < 2; i++ {
+		_, _, err := newRancherClient(newClientTestCmd("--user", "admin"), zap.NewNop())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&logins))
+}
+
+func TestNewRancherClient_ServerFlag(t *testing.T) {
+	var logins int32
+	server := newSessionTestServer(t, &logins)
+	t.Setenv("RANCHER_URL", "https://unreachable.invalid")
+	t.Setenv("RANCHER_PASSWORD", "secret")
+
+	_, rancherURL, err := newRancherClient(newClientTestCmd("--server", server.URL, "--user", "admin"), zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, server.URL, rancherURL)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&logins))
+}
+
+func TestParseServerURL(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{"https://rancher.example.com", ""},
+		{"http://localhost:8080/", ""},
+		{"", "pass --server or set RANCHER_URL"},
+		{"rancher.example.com", "must be an http:// or https:// URL"},
+		{"ftp://rancher.example.com", "must be an http:// or https:// URL"},
+		{"https://", "must be an http:// or https:// URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseServerURL(tt.value)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.value, got)
+		})
+	}
+}
+
+func TestResolveRancherSettings_ReportsAllProblems(t *testing.T) {
+	t.Setenv("RANCHER_URL", "")
+	t.Setenv("RANCHER_USERNAME", "")
+	t.Setenv("RANCHER_PASSWORD", "")
+	t.Setenv("RANCHER_AUTH_TYPE", "")
+
+	_, err := resolveRancherSettings(newClientTestCmd("--auth-type", "kerberos"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--server or set RANCHER_URL")
+	assert.Contains(t, err.Error(), "--user or set RANCHER_USERNAME")
+	assert.Contains(t, err.Error(), `invalid auth-type value "kerberos"`)
+	assert.Contains(t, err.Error(), "-p to enter it interactively or set RANCHER_PASSWORD")
+}
+
+func TestResolveRancherSettings_Valid(t *testing.T) {
+	t.Setenv("RANCHER_URL", "https://rancher.example.com")
+	t.Setenv("RANCHER_USERNAME", "admin")
+	t.Setenv("RANCHER_PASSWORD", "")
+
+	// A cached session may make the password unnecessary
+	settings, err := resolveRancherSettings(newClientTestCmd("--cache-session", "--auth-type", "ldap"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://rancher.example.com", settings.url)
+	assert.Equal(t, "admin", settings.username)
+	assert.Equal(t, rancher.AuthTypeLDAP, settings.authType)
+	assert.True(t, settings.cacheSession)
+	assert.Empty(t, settings.authProviderName)
+	assert.Equal(t, "ldap", settings.authKey())
+}
+
+func TestResolveRancherSettings_BrowserLoginNeedsNoPassword(t *testing.T) {
+	t.Setenv("RANCHER_URL", "https://rancher.example.com")
+	t.Setenv("RANCHER_USERNAME", "")
+	t.Setenv("RANCHER_PASSWORD", "")
+	t.Setenv("RANCHER_AUTH_PROVIDER_NAME", "")
+
+	settings, err := resolveRancherSettings(newClientTestCmd("--auth-type", "github"))
+	require.NoError(t, err)
+	assert.Equal(t, rancher.AuthTypeGitHub, settings.authType)
+
+	settings, err = resolveRancherSettings(newClientTestCmd("--auth-type", "googleoauth"))
+	require.NoError(t, err)
+	assert.Equal(t, rancher.AuthTypeGoogleOAuth, settings.authType)
+
+	settings, err = resolveRancherSettings(newClientTestCmd("--auth-type", "saml"))
+	require.NoError(t, err)
+	assert.Equal(t, rancher.AuthTypeSAML, settings.authType)
+
+	_, err = resolveRancherSettings(newClientTestCmd("--auth-type", "github", "--auth-provider-name", "corp"))
+	assert.ErrorContains(t, err, "--auth-provider-name only applies to local, ldap and oidc logins")
+}
+
+func TestResolveRancherSettings_OIDC(t *testing.T) {
+	t.Setenv("RANCHER_URL", "https://rancher.example.com")
+	t.Setenv("RANCHER_USERNAME", "")
+	t.Setenv("RANCHER_PASSWORD", "")
+	t.Setenv("RANCHER_OIDC_ISSUER", "")
+	t.Setenv("RANCHER_OIDC_CLIENT_ID", "")
+
+	settings, err := resolveRancherSettings(newClientTestCmd("--auth-type", "oidc", "--issuer", "https://login.example.com/realms/corp",
+		"--oidc-client-id", "kubeconfig-updater", "--auth-provider-name", "corp-sso"))
+	require.NoError(t, err)
+	assert.Equal(t, rancher.AuthTypeOIDC, settings.authType)
+	assert.Equal(t, "https://login.example.com/realms/corp", settings.oidcIssuer)
+	assert.Equal(t, "kubeconfig-updater", settings.oidcClientID)
+	assert.Equal(t, "oidc/corp-sso", settings.authKey())
+
+	_, err = resolveRancherSettings(newClientTestCmd("--auth-type", "oidc", "--issuer", "login.example.com"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid OIDC issuer "login.example.com"`)
+	assert.Contains(t, err.Error(), "pass --oidc-client-id or set RANCHER_OIDC_CLIENT_ID")
+}
+
+func TestResolveRancherSettings_Profiles(t *testing.T) {
+	t.Setenv("RANCHER_URL", "")
+	t.Setenv("RANCHER_USERNAME", "admin")
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("RANCHER_AUTH_TYPE", "")
+	t.Setenv("PROFILES_CONFIG", "")
+	t.Setenv("INCLUDE_LOCAL", "true")
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+profiles:
+  - name: prod
+    server: https://rancher.prod.example.com
+    auth-type: ldap
+    user: alice
+    clusters: [prod-eu, prod-us]
+  - name: lab
+    server: https://rancher.lab.example.com
+    credential-command: echo lab-token
+    insecure-skip-tls-verify: true
+    include-local: false
+`), 0o600))
+
+	settings, err := resolveRancherSettings(newClientTestCmd("--profiles-config", path, "--qps", "5"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://rancher.prod.example.com", "https://rancher.lab.example.com"}, settings.servers)
+	assert.Equal(t, "https://rancher.prod.example.com", settings.url, "the first profile stands in for single-server commands")
+
+	all := settings.perServer()
+	require.Len(t, all, 2)
+	assert.Equal(t, "prod", all[0].profile)
+	assert.Equal(t, rancher.AuthTypeLDAP, all[0].authType)
+	assert.Equal(t, "alice", all[0].username)
+	assert.Equal(t, "prod-eu,prod-us", all[0].clusters)
+	assert.True(t, all[0].includeLocal, "unset settings fall back to the flags")
+	assert.False(t, all[0].ownCredentials)
+	assert.Equal(t, rancher.AuthTypeLocal, all[1].authType)
+	assert.Equal(t, "admin", all[1].username)
+	assert.True(t, all[1].insecureSkipTLSVerify)
+	assert.False(t, all[1].includeLocal)
+	assert.True(t, all[1].ownCredentials)
+	assert.NotNil(t, all[1].provider)
+	require.NotNil(t, settings.limiter)
+	assert.Same(t, settings.limiter, all[0].limiter, "--qps limits the requests to all servers together")
+	assert.Same(t, settings.limiter, all[1].limiter)
+}
+
+func TestResolveRancherSettings_ProfileProblems(t *testing.T) {
+	t.Setenv("RANCHER_USERNAME", "admin")
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("PROFILES_CONFIG", "")
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+profiles:
+  - name: prod
+    server: rancher.prod.example.com
+  - name: lab
+    server: https://rancher.lab.example.com
+    auth-type: kerberos
+`), 0o600))
+
+	_, err := resolveRancherSettings(newClientTestCmd("--profiles-config", path, "--server", "https://rancher.example.com"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--server and --profiles-config both name the Rancher servers")
+	assert.Contains(t, err.Error(), `profile prod: invalid Rancher URL "rancher.prod.example.com"`)
+	assert.Contains(t, err.Error(), `profile lab: invalid auth-type value "kerberos"`)
+}
+
+func TestResolveRancherSettings_DeviceCode(t *testing.T) {
+	t.Setenv("RANCHER_URL", "https://rancher.example.com")
+	t.Setenv("RANCHER_USERNAME", "admin")
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("RANCHER_DEVICE_CODE", "")
+
+	settings, err := resolveRancherSettings(newClientTestCmd("--auth-type", "github", "--device-code"))
+	require.NoError(t, err)
+	assert.True(t, settings.deviceCode)
+
+	_, err = resolveRancherSettings(newClientTestCmd("--auth-type", "ldap", "--device-code"))
+	assert.ErrorContains(t, err, "--device-code only applies to github, googleoauth, saml and oidc logins, not ldap")
+}
+
+func TestResolveRancherSettings_AuthProviderName(t *testing.T) {
+	t.Setenv("RANCHER_URL", "https://rancher.example.com")
+	t.Setenv("RANCHER_USERNAME", "admin")
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("RANCHER_AUTH_PROVIDER_NAME", "corp-ldap")
+
+	settings, err := resolveRancherSettings(newClientTestCmd("--auth-type", "ldap"))
+	require.NoError(t, err)
+	assert.Equal(t, "corp-ldap", settings.authProviderName)
+	assert.Equal(t, "ldap/corp-ldap", settings.authKey())
+}
+
+func TestNewRancherClient_CredentialCommandPassword(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell command")
+	}
+	var logins int32
+	server := newSessionTestServer(t, &logins)
+	t.Setenv("RANCHER_URL", server.URL)
+	t.Setenv("RANCHER_PASSWORD", "")
+
+	client, _, err := newRancherClient(newClientTestCmd("--user", "admin", "--credential-command", "echo secret"), zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "session-token", client.SessionToken())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&logins))
+}
+
+func TestNewRancherClient_CredentialCommandAPIToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell command")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/users" || r.Header.Get("Authorization") != "Bearer token-abc12:apisecret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": []}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("RANCHER_URL", server.URL)
+	t.Setenv("RANCHER_USERNAME", "")
+	t.Setenv("RANCHER_PASSWORD", "")
+
+	// An API token needs no username and no login
+	client, _, err := newRancherClient(newClientTestCmd("--credential-command", "echo token-abc12:apisecret"), zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "token-abc12:apisecret", client.SessionToken())
+
+	_, _, err = newRancherClient(newClientTestCmd("--credential-command", "echo token-abc12:revoked"), zap.NewNop())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected the API token")
+}
+
+func TestResolveRancherSettings_PasswordAndCredentialCommand(t *testing.T) {
+	t.Setenv("RANCHER_URL", "https://rancher.example.com")
+	t.Setenv("RANCHER_USERNAME", "admin")
+
+	_, err := resolveRancherSettings(newClientTestCmd("-p=secret", "--credential-command", "echo secret"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "use only one of them")
+}
+
+func TestResolveRancherSettings_CredentialsFrom(t *testing.T) {
+	t.Setenv("RANCHER_URL", "https://rancher.example.com")
+	t.Setenv("RANCHER_USERNAME", "")
+	t.Setenv("RANCHER_PASSWORD", "")
+
+	settings, err := resolveRancherSettings(newClientTestCmd("--credentials-from", "op://Private/Rancher/password"))
+	require.NoError(t, err)
+	require.NotNil(t, settings.provider)
+	assert.Equal(t, "1Password op://Private/Rancher/password", settings.provider.Name())
+
+	_, err = resolveRancherSettings(newClientTestCmd("--credentials-from", "op://Private/Rancher"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid 1Password reference")
+
+	_, err = resolveRancherSettings(newClientTestCmd("--credentials-from", "op://Private/Rancher/password", "--credential-command", "echo secret"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "use only one of them")
+}
+
+func TestNewRancherClient_APIToken(t *testing.T) {
+	var logins int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v3-public/localProviders/local" {
+			atomic.AddInt32(&logins, 1)
+		}
+		if r.URL.Path != "/v3/users" || r.Header.Get("Authorization") != "Bearer token-abc12:apisecret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": []}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("RANCHER_URL", server.URL)
+	t.Setenv("RANCHER_USERNAME", "")
+	t.Setenv("RANCHER_PASSWORD", "")
+	t.Setenv("RANCHER_TOKEN", "token-abc12:apisecret")
+
+	// The token needs no username or password and replaces the login
+	client, _, err := newRancherClient(newClientTestCmd(), zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "token-abc12:apisecret", client.SessionToken())
+	assert.Zero(t, atomic.LoadInt32(&logins))
+
+	// Headless machines of a GitHub-federated Rancher use an API key instead of the browser
+	client, _, err = newRancherClient(newClientTestCmd("--auth-type", "github"), zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "token-abc12:apisecret", client.SessionToken())
+
+	_, _, err = newRancherClient(newClientTestCmd("--api-token", "token-abc12:revoked"), zap.NewNop())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected the API token from --api-token")
+}
+
+func TestResolveRancherSettings_APIToken(t *testing.T) {
+	t.Setenv("RANCHER_URL", "https://rancher.example.com")
+	t.Setenv("RANCHER_USERNAME", "")
+	t.Setenv("RANCHER_PASSWORD", "")
+	t.Setenv("RANCHER_TOKEN", "")
+
+	settings, err := resolveRancherSettings(newClientTestCmd("--api-token", " token-abc12:apisecret\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "token-abc12:apisecret", settings.apiToken)
+
+	_, err = resolveRancherSettings(newClientTestCmd("--api-token", "token-abc12:apisecret", "--credential-command", "echo secret"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "use only one of them")
+
+	_, err = resolveRancherSettings(newClientTestCmd("--api-token", "token-abc12:apisecret", "-p=secret"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "use only one of them")
+}
+
+func TestResolveRancherSettings_FederatedToken(t *testing.T) {
+	t.Setenv("RANCHER_URL", "https://rancher.example.com")
+	t.Setenv("RANCHER_USERNAME", "")
+	t.Setenv("RANCHER_PASSWORD", "")
+	t.Setenv("RANCHER_TOKEN", "")
+	t.Setenv("RANCHER_AUTH_TYPE", "")
+	t.Setenv("RANCHER_OIDC_ISSUER", "")
+	t.Setenv("RANCHER_OIDC_CLIENT_ID", "")
+	t.Setenv("RANCHER_FEDERATED_TOKEN", "")
+	t.Setenv("RANCHER_FEDERATED_AUDIENCE", "")
+
+	// Rancher trusting the CI platform itself needs neither an issuer nor credentials
+	settings, err := resolveRancherSettings(newClientTestCmd("--federated-token", "github-actions", "--oidc-client-id", "rancher"))
+	require.NoError(t, err)
+	assert.Equal(t, rancher.AuthTypeOIDC, settings.authType)
+	assert.Equal(t, "github-actions", settings.federatedToken.String())
+	assert.Equal(t, "rancher", settings.federatedAudience)
+
+	_, err = resolveRancherSettings(newClientTestCmd("--federated-token", "gitlab", "--issuer", "https://login.example.com/realms/corp"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "OIDC client ID is required to exchange the --federated-token")
+
+	_, err = resolveRancherSettings(newClientTestCmd("--federated-token", "gitlab", "--auth-type", "ldap"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--federated-token logs in through Rancher's OIDC provider, not ldap")
+
+	_, err = resolveRancherSettings(newClientTestCmd("--federated-token", "gitlab", "--api-token", "token-abc12:apisecret"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "use only one of them")
+
+	_, err = resolveRancherSettings(newClientTestCmd("--federated-token", "vault"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid federated token source "vault"`)
+}
+
+func TestNewRancherClient_FederatedToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/v3-public/genericOIDCProviders/genericoidc" || body["idToken"] != "ci-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token": "token-fed12:secret"}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("RANCHER_URL", server.URL)
+	t.Setenv("RANCHER_USERNAME", "")
+	t.Setenv("RANCHER_PASSWORD", "")
+	t.Setenv("RANCHER_TOKEN", "")
+	t.Setenv("RANCHER_AUTH_TYPE", "")
+	t.Setenv("RANCHER_OIDC_ISSUER", "")
+	t.Setenv("RANCHER_FEDERATED_TOKEN", "env:TEST_CI_TOKEN")
+	t.Setenv("TEST_CI_TOKEN", "ci-token")
+
+	client, _, err := newRancherClient(newClientTestCmd(), zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "token-fed12:secret", client.SessionToken())
+}
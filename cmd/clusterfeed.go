@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"errors"
+	"iter"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// errFeedStopped ends the listing of a feed nobody reads any more
+var errFeedStopped = errors.New("cluster feed stopped")
+
+// streamingSource returns source if the clusters of the server can be processed while they
+// arrive, or nil when the run needs the whole list first: to pick the clusters named with
+// --cluster or in a cluster list, to order the canary first, to ask which new clusters to
+// add, or to skip the checkpoint's clusters.
+func streamingSource(source rancher.ClusterSource, settings rancherSettings, canary string, opts clusterOptions, progress *progressSaver) rancher.ClusterStreamer {
+	stream, ok := source.(rancher.ClusterStreamer)
+	if !ok || settings.clusters != "" || canary != "" || opts.clusterList != nil ||
+		opts.selectNew != nil || progress.checkpoint() != nil {
+		return nil
+	}
+	return stream
+}
+
+// withoutLocalCluster is excludeLocalCluster for clusters that are still arriving
+func withoutLocalCluster(clusters iter.Seq[rancher.Cluster], logger *zap.Logger) iter.Seq[rancher.Cluster] {
+	return func(yield func(rancher.Cluster) bool) {
+		for v := range clusters {
+			if v.ID == localClusterID {
+				logger.Info("Skipping Rancher management cluster", zap.String("cluster", v.Name))
+				continue
+			}
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// clusterFeed lists the clusters of a server in the background and hands them out as they
+// arrive, so the first clusters are processed while the rest of a long list is still being
+// read. The list is read at the speed it arrives, however long processing takes, so Rancher
+// never has to hold the response open for a slow reader.
+type clusterFeed struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	queue   []rancher.Cluster
+	// received counts the clusters that arrived so far
+	received int
+	done     bool
+	stopped  bool
+	err      error
+}
+
+// startClusterFeed starts listing the clusters of source
+func startClusterFeed(source rancher.ClusterStreamer) *clusterFeed {
+	f := &clusterFeed{}
+	f.changed = sync.NewCond(&f.mu)
+	go func() {
+		err := source.StreamClusters(func(v rancher.Cluster) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if f.stopped {
+				return errFeedStopped
+			}
+			f.queue = append(f.queue, v)
+			f.received++
+			f.changed.Broadcast()
+			return nil
+		})
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.done = true
+		if !errors.Is(err, errFeedStopped) {
+			f.err = err
+		}
+		f.changed.Broadcast()
+	}()
+	return f
+}
+
+// ready waits until the first cluster arrived or the listing ended. It returns the error of a
+// listing that failed before any cluster arrived, which can be retried as a whole.
+func (f *clusterFeed) ready() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for f.received == 0 && !f.done {
+		f.changed.Wait()
+	}
+	if f.received == 0 {
+		return f.err
+	}
+	return nil
+}
+
+// clusters yields the clusters in the order they arrive, until the listing ended
+func (f *clusterFeed) clusters() iter.Seq[rancher.Cluster] {
+	return func(yield func(rancher.Cluster) bool) {
+		for {
+			f.mu.Lock()
+			for len(f.queue) == 0 && !f.done {
+				f.changed.Wait()
+			}
+			if len(f.queue) == 0 {
+				f.mu.Unlock()
+				return
+			}
+			v := f.queue[0]
+			f.queue = f.queue[1:]
+			f.mu.Unlock()
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// stop ends the listing early; clusters arriving from now on are dropped
+func (f *clusterFeed) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = true
+	f.queue = nil
+}
+
+// wait waits for the listing to end and returns its error
+func (f *clusterFeed) wait() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for !f.done {
+		f.changed.Wait()
+	}
+	return f.err
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// fakeStreamer hands out its clusters, then fails with err
+type fakeStreamer struct {
+	rancher.ClusterSource
+	clusters rancher.Clusters
+	err      error
+}
+
+func (f *fakeStreamer) StreamClusters(fn func(rancher.Cluster) error) error {
+	for _, v := range f.clusters {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+func TestClusterFeed(t *testing.T) {
+	clusters := rancher.Clusters{{ID: "local", Name: "local"}, {ID: "c-1", Name: "prod"}, {ID: "c-2", Name: "dev"}}
+	feed := startClusterFeed(&fakeStreamer{clusters: clusters})
+	require.NoError(t, feed.ready())
+	assert.Equal(t, clusters, rancher.Clusters(slices.Collect(feed.clusters())))
+	assert.NoError(t, feed.wait())
+
+	feed = startClusterFeed(&fakeStreamer{clusters: clusters})
+	names := slices.Collect(func(yield func(string) bool) {
+		for v := range withoutLocalCluster(feed.clusters(), zap.NewNop()) {
+			yield(v.Name)
+		}
+	})
+	assert.Equal(t, []string{"prod", "dev"}, names)
+}
+
+func TestClusterFeed_Errors(t *testing.T) {
+	broken := errors.New("connection reset")
+
+	// A list failing before any cluster arrived can be retried as a whole
+	feed := startClusterFeed(&fakeStreamer{err: broken})
+	assert.ErrorIs(t, feed.ready(), broken)
+
+	// One breaking off later hands out what arrived, then reports the error
+	feed = startClusterFeed(&fakeStreamer{clusters: rancher.Clusters{{ID: "c-1", Name: "prod"}}, err: broken})
+	require.NoError(t, feed.ready())
+	assert.Len(t, slices.Collect(feed.clusters()), 1)
+	assert.ErrorIs(t, feed.wait(), broken)
+
+	// A stopped feed ends the listing without an error
+	feed = startClusterFeed(&fakeStreamer{clusters: rancher.Clusters{{ID: "c-1"}, {ID: "c-2"}, {ID: "c-3"}}})
+	feed.stop()
+	assert.NoError(t, feed.wait())
+}
+
+func TestStreamingSource(t *testing.T) {
+	client := rancher.NewClientWithToken("https://rancher.example.com", "token", zap.NewNop(), false)
+	assert.NotNil(t, streamingSource(client, rancherSettings{}, "", clusterOptions{}, nil))
+	assert.Nil(t, streamingSource(client, rancherSettings{clusters: "prod"}, "", clusterOptions{}, nil), "--cluster picks from the whole list")
+	assert.Nil(t, streamingSource(client, rancherSettings{}, "prod", clusterOptions{}, nil), "the canary is ordered first")
+	assert.Nil(t, streamingSource(client, rancherSettings{}, "", clusterOptions{selectNew: func(names []string) []string { return names }}, nil))
+}
+
+func TestProcessServer_ListBreaksOff(t *testing.T) {
+	var logins int32
+	fleet := newFleetServer(t, &logins, "admin", rancher.Cluster{ID: "c-1", Name: "prod"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v3/clusters" {
+			// The connection drops in the middle of the second cluster
+			_, _ = w.Write([]byte(`{"data": [{"id": "c-1", "name": "prod"}, {"id": "c-2", "na`))
+			return
+		}
+		r.URL.Host = fleet.Listener.Addr().String()
+		r.URL.Scheme = "http"
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	defer server.Close()
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", server.URL, "--user", "admin"}))
+	settings, err := resolveRancherSettings(cmd)
+	require.NoError(t, err)
+
+	kubecfg := api.NewConfig()
+	opts := clusterOptions{Options: pipeline.Options{AutoCreate: true, ThresholdDays: 30}, concurrency: 1}
+	result := processServer(cmd, settings, newCredentialSource(cmd, settings), kubecfg, opts, nil, io.Discard, zap.NewNop())
+	assert.ErrorContains(t, result.err, "unexpected EOF")
+	assert.Equal(t, 1, result.updated, "the clusters before the break are processed")
+	assert.Equal(t, "kubeconfig-u-admin:secret", kubecfg.AuthInfos["prod"].Token)
+}
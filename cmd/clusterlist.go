@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"rancher-kubeconfig-updater/internal/clusterlist"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/rancher"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// skipReasonNotInRancher is the plan reason for listed clusters Rancher doesn't know
+const skipReasonNotInRancher = "not_in_rancher"
+
+// loadClusterList reads the --cluster-list file, or returns nil when no list is given
+func loadClusterList(cmd *cobra.Command) (*clusterlist.List, error) {
+	path := config.GetConfig(cmd, "cluster-list", "CLUSTER_LIST")
+	if path == "" {
+		return nil, nil
+	}
+	return clusterlist.Load(path)
+}
+
+// selectListedClusters returns the clusters of the list in its order, each named after the
+// context its entry gets, and the namespaces of the contexts that have one. Listed clusters
+// Rancher doesn't know are reported and left out, as is a cluster listed a second time.
+func selectListedClusters(clusters rancher.Clusters, list *clusterlist.List, opts clusterOptions, zapLogger *zap.Logger) (rancher.Clusters, map[string]string) {
+	selected := make(rancher.Clusters, 0, len(list.Clusters))
+	namespaces := make(map[string]string)
+	listedIDs := make(map[string]bool)
+	contexts := make(map[string]bool)
+
+	for _, e := range list.Clusters {
+		var match *rancher.Cluster
+		for i := range clusters {
+			if e.Matches(clusters[i].Name, clusters[i].ID) {
+				match = &clusters[i]
+				break
+			}
+		}
+		if match == nil {
+			zapLogger.Warn("Listed cluster not found in Rancher", zap.String("cluster", e.Cluster), zap.String("server", opts.RancherURL))
+			opts.Plan.Skip(e.ContextName(e.Cluster), skipReasonNotInRancher)
+			continue
+		}
+
+		v := *match
+		v.Name = e.ContextName(match.Name)
+		switch {
+		case listedIDs[v.ID]:
+			zapLogger.Warn("Cluster is listed more than once, only its first entry is used",
+				zap.String("cluster", e.Cluster), zap.String("clusterID", v.ID))
+			continue
+		case contexts[v.Name]:
+			zapLogger.Warn("Context name of listed cluster is already used by another listed cluster, skipping it",
+				zap.String("cluster", e.Cluster), zap.String("context", v.Name))
+			continue
+		}
+		listedIDs[v.ID] = true
+		contexts[v.Name] = true
+
+		selected = append(selected, v)
+		if e.Namespace != "" {
+			namespaces[v.Name] = e.Namespace
+		}
+	}
+	return selected, namespaces
+}
+
+// setContextNamespace makes namespace the default namespace of the context named name
+func setContextNamespace(kubecfg *api.Config, name, namespace string) {
+	if ctx, ok := kubecfg.Contexts[name]; ok && ctx != nil {
+		ctx.Namespace = namespace
+	}
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/clusterlist"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/plan"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSelectListedClusters(t *testing.T) {
+	clusters := rancher.Clusters{{ID: "c-prod", Name: "prod"}, {ID: "c-dev", Name: "dev"}, {ID: "c-stage", Name: "stage"}}
+	list := &clusterlist.List{Clusters: []clusterlist.Entry{
+		{Cluster: "c-stage"},
+		{Cluster: "Prod", Context: "acme-prod", Namespace: "payments"},
+		{Cluster: "gone", Context: "acme-gone"},
+		{Cluster: "c-prod", Context: "prod-again"},
+		{Cluster: "dev", Context: "stage"},
+	}}
+	opts := clusterOptions{Options: pipeline.Options{Plan: plan.New(false)}}
+
+	selected, namespaces := selectListedClusters(clusters, list, opts, zap.NewNop())
+
+	assert.Equal(t, rancher.Clusters{{ID: "c-stage", Name: "stage"}, {ID: "c-prod", Name: "acme-prod"}}, selected,
+		"listed clusters keep the list's order and get their context names; duplicates are left out")
+	assert.Equal(t, map[string]string{"acme-prod": "payments"}, namespaces)
+	assert.Equal(t, "prod", clusters[0].Name, "Rancher's cluster list is not modified")
+	require.Len(t, opts.Plan.Skipped, 1)
+	assert.Equal(t, plan.Skip{Context: "acme-gone", Reason: skipReasonNotInRancher}, opts.Plan.Skipped[0])
+}
+
+func TestUpdate_ClusterList(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "me", rancher.Cluster{ID: "c-prod", Name: "prod"}, rancher.Cluster{ID: "c-dev", Name: "dev"})
+
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "config")
+	listPath := filepath.Join(dir, "clusters.csv")
+	require.NoError(t, os.WriteFile(listPath, []byte("cluster,context,namespace\nprod,acme-prod,payments\nmissing\n"), 0600))
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("CLUSTER_LIST", "")
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--server", server.URL, "--user", "admin", "-c", kubeconfigPath, "--state-file", filepath.Join(dir, "state.json"), "--cluster-list", listPath})
+	require.NoError(t, cmd.Execute())
+
+	saved, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	require.NoError(t, err)
+	require.Contains(t, saved.Contexts, "acme-prod", "the entry is created without --auto-create")
+	assert.Equal(t, "payments", saved.Contexts["acme-prod"].Namespace)
+	assert.Equal(t, "acme-prod", saved.Contexts["acme-prod"].Cluster)
+	assert.Equal(t, "kubeconfig-u-me:secret", saved.AuthInfos["acme-prod"].Token)
+	assert.NotContains(t, saved.Contexts, "prod")
+	assert.NotContains(t, saved.Contexts, "dev", "unlisted clusters are left out")
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/profile"
+
+	"github.com/spf13/cobra"
+)
+
+// addConfigFileFlags registers the flags selecting the config file and its profile
+func addConfigFileFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("config-file", "", "Profiles file to take persistent settings from with --profile, in the format of --profiles-config (default: ~/.config/rancher-kubeconfig-updater/config.yaml)")
+	cmd.PersistentFlags().String("profile", "", "Profile of the config file to take settings from, e.g. prod; flags and environment variables still override it (default: the file's default-profile)")
+}
+
+// singleClusterCommands take one cluster with --cluster rather than a list to filter by, so
+// the profile's clusters do not apply to them
+var singleClusterCommands = map[string]bool{"credential": true, "exec": true, "history": true}
+
+// applyConfigFile sets the flags the selected profile of the config file configures. The
+// config file is a profiles file as read by --profiles-config, which takes its place when
+// given. A missing config file is only an error when it was asked for, or a profile was that
+// has no .env.<profile> file either.
+func applyConfigFile(cmd *cobra.Command) error {
+	name := config.GetConfig(cmd, "profile", "RANCHER_PROFILE")
+	// --profiles-config runs every profile of its file instead of selecting one
+	if config.GetConfig(cmd, "profiles-config", "PROFILES_CONFIG") != "" {
+		return nil
+	}
+	path := config.GetConfig(cmd, "config-file", "CONFIG_FILE")
+	explicit := path != ""
+	if !explicit {
+		var err error
+		path, err = profile.DefaultPath()
+		if err != nil {
+			if name != "" {
+				return fmt.Errorf("failed to locate the config file for --profile %s: %w", name, err)
+			}
+			return nil
+		}
+	}
+
+	f, err := profile.Load(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		// The profile may select only a .env.<profile> file
+		if name != "" && !envProfileExists(name) {
+			return fmt.Errorf("--profile %s needs a config file or a .env.%s file, but neither %s nor .env.%s exists", name, name, path, name)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p, ok, err := f.Select(name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if !ok {
+		return nil
+	}
+
+	settings := p.Settings()
+	if singleClusterCommands[cmd.Name()] {
+		kept := settings[:0]
+		for _, s := range settings {
+			if s.Flag != "cluster" {
+				kept = append(kept, s)
+			}
+		}
+		settings = kept
+	}
+	return config.Apply(cmd, settings)
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigFile writes a config file to the default location under a temporary XDG_CONFIG_HOME
+func writeConfigFile(t *testing.T, content string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("RANCHER_PROFILE", "")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "rancher-kubeconfig-updater"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rancher-kubeconfig-updater", "config.yaml"), []byte(content), 0o600))
+}
+
+const testConfigFile = `
+default-profile: dev
+profiles:
+  - name: dev
+    server: https://rancher.dev.example.com
+    user: dev-admin
+  - name: prod
+    server: https://rancher.prod.example.com
+    auth-type: ldap
+    clusters: [prod-eu, prod-us]
+    kubeconfig: /tmp/prod.kubeconfig
+    threshold-days: 7
+`
+
+func TestApplyConfigFile(t *testing.T) {
+	writeConfigFile(t, testConfigFile)
+	t.Setenv("RANCHER_URL", "")
+	t.Setenv("RANCHER_USERNAME", "")
+	t.Setenv("RANCHER_AUTH_TYPE", "")
+	t.Setenv("TOKEN_THRESHOLD_DAYS", "")
+
+	// The default profile applies without --profile
+	rootCmd := NewRootCmd()
+	require.NoError(t, applyConfigFile(rootCmd))
+	server, _ := rootCmd.Flags().GetString("server")
+	user, _ := rootCmd.Flags().GetString("user")
+	assert.Equal(t, "https://rancher.dev.example.com", server)
+	assert.Equal(t, "dev-admin", user)
+
+	rootCmd = NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--profile", "prod", "--threshold-days", "14"}))
+	require.NoError(t, applyConfigFile(rootCmd))
+	authType, _ := rootCmd.Flags().GetString("auth-type")
+	cluster, _ := rootCmd.Flags().GetString("cluster")
+	kubeconfigPath, _ := rootCmd.Flags().GetString("config")
+	threshold, _ := rootCmd.Flags().GetInt("threshold-days")
+	assert.Equal(t, "ldap", authType)
+	assert.Equal(t, "prod-eu,prod-us", cluster)
+	assert.Equal(t, "/tmp/prod.kubeconfig", kubeconfigPath)
+	assert.Equal(t, 14, threshold, "flags override the config file")
+
+	// Environment variables override the config file too
+	t.Setenv("RANCHER_URL", "https://rancher.env.example.com")
+	rootCmd = NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--profile", "prod"}))
+	require.NoError(t, applyConfigFile(rootCmd))
+	server, _ = rootCmd.Flags().GetString("server")
+	assert.Empty(t, server, "RANCHER_URL is used instead")
+
+	rootCmd = NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--profile", "staging"}))
+	assert.ErrorContains(t, applyConfigFile(rootCmd), `profile "staging" is not defined, known profiles: dev, prod`)
+}
+
+func TestApplyConfigFile_Missing(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("RANCHER_PROFILE", "")
+
+	// Without a config file nothing changes, unless a profile was asked for
+	require.NoError(t, applyConfigFile(NewRootCmd()))
+
+	rootCmd := NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--profile", "prod"}))
+	assert.ErrorContains(t, applyConfigFile(rootCmd), "--profile prod needs a config file or a .env.prod file")
+
+	// A profile may only select a .env.<profile> file
+	require.NoError(t, os.WriteFile(".env.prod", []byte("TEST_ENV_PROFILE=prod\n"), 0o600))
+	t.Setenv("TEST_ENV_PROFILE", "")
+	require.NoError(t, os.Unsetenv("TEST_ENV_PROFILE"))
+	rootCmd = NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--profile", "prod"}))
+	require.NoError(t, applyGlobalFlags(rootCmd, nil))
+	assert.Equal(t, "prod", os.Getenv("TEST_ENV_PROFILE"))
+
+	rootCmd = NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--config-file", filepath.Join(t.TempDir(), "missing.yaml")}))
+	assert.ErrorContains(t, applyConfigFile(rootCmd), "failed to read profiles")
+}
+
+func TestApplyConfigFile_ProfilesConfig(t *testing.T) {
+	writeConfigFile(t, testConfigFile)
+	t.Setenv("RANCHER_URL", "")
+
+	// --profiles-config runs the profiles of its own file, the config file's default is not applied
+	rootCmd := NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--profiles-config", filepath.Join(t.TempDir(), "profiles.yaml")}))
+	require.NoError(t, applyConfigFile(rootCmd))
+	assert.False(t, rootCmd.Flags().Changed("server"))
+
+	// Run-wide settings can't be given per server
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testConfigFile), 0o600))
+	rootCmd = NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--profiles-config", path}))
+	_, err := resolveRancherSettings(rootCmd)
+	assert.ErrorContains(t, err, "profile prod: kubeconfig, threshold-days apply to the whole run and are only read for the profile selected with --profile")
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"iter"
+	"net/url"
+	"rancher-kubeconfig-updater/internal/rancher"
+
+	"go.uber.org/zap"
+)
+
+// contextNames keeps the kubeconfig entries of a run against several Rancher servers apart.
+// Every cluster name gets the server's host appended, e.g. local@rancher-eu.example.com.
+// Qualifying every name, not only those more than one server uses, keeps the names the same
+// from run to run, whichever servers could be reached or which clusters they have. A nil
+// *contextNames changes no name.
+type contextNames struct {
+	// hosts maps each server of the run to the host its names are qualified with
+	hosts map[string]string
+}
+
+// newContextNames returns the names of a run against servers, or nil for a single server
+func newContextNames(servers []string) *contextNames {
+	if len(servers) < 2 {
+		return nil
+	}
+	n := &contextNames{hosts: make(map[string]string, len(servers))}
+	for _, s := range servers {
+		host := s
+		if u, err := url.Parse(s); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		n.hosts[s] = host
+	}
+	return n
+}
+
+// name returns the entry name of the cluster named name on server
+func (n *contextNames) name(server, name string) string {
+	if n == nil {
+		return name
+	}
+	return name + "@" + n.hosts[server]
+}
+
+// qualify returns the clusters of server with their names qualified with the server's host.
+// The namespaces of entries, keyed by name, are moved along.
+func (n *contextNames) qualify(server string, clusters rancher.Clusters, namespaces map[string]string, zapLogger *zap.Logger) (rancher.Clusters, map[string]string) {
+	if n == nil {
+		return clusters, namespaces
+	}
+	qualified := make(rancher.Clusters, len(clusters))
+	for i, v := range clusters {
+		name := n.name(server, v.Name)
+		zapLogger.Debug("Qualifying cluster name with its Rancher server", zap.String("cluster", v.Name), zap.String("entry", name))
+		if namespace, ok := namespaces[v.Name]; ok {
+			namespaces[name] = namespace
+			delete(namespaces, v.Name)
+		}
+		v.Name = name
+		qualified[i] = v
+	}
+	return qualified, namespaces
+}
+
+// qualifyEach is qualify for clusters that are still arriving
+func (n *contextNames) qualifyEach(server string, clusters iter.Seq[rancher.Cluster]) iter.Seq[rancher.Cluster] {
+	if n == nil {
+		return clusters
+	}
+	return func(yield func(rancher.Cluster) bool) {
+		for v := range clusters {
+			v.Name = n.name(server, v.Name)
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
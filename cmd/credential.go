@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"rancher-kubeconfig-updater/internal/credcache"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// execCredentialAPIVersion is the client.authentication.k8s.io version emitted by the plugin
+const execCredentialAPIVersion = "client.authentication.k8s.io/v1"
+
+// execCredentialObject is the ExecCredential object kubectl expects on the plugin's stdout
+type execCredentialObject struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Status     execCredentialStatus `json:"status"`
+}
+
+type execCredentialStatus struct {
+	Token               string `json:"token"`
+	ExpirationTimestamp string `json:"expirationTimestamp,omitempty"`
+}
+
+// NewCredentialCmd creates the kubectl exec-credential plugin command.
+func NewCredentialCmd() *cobra.Command {
+	credentialCmd := &cobra.Command{
+		Use:   "credential",
+		Short: "kubectl exec-credential plugin that prints a Rancher cluster token",
+		Long: "Prints an ExecCredential for the given cluster. The local credential cache server\n" +
+			"is consulted first so concurrent kubectl invocations share one Rancher login;\n" +
+			"if it is not running, the token is fetched from Rancher directly.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runCredential,
+	}
+
+	credentialCmd.Flags().String("cluster", "", "Cluster name or ID to print the credential for")
+	_ = credentialCmd.MarkFlagRequired("cluster")
+	credentialCmd.Flags().String("socket", "", "Credential cache socket path (default: from RANCHER_CREDENTIAL_CACHE_SOCKET env or the user cache dir)")
+	addRancherFlags(credentialCmd)
+
+	credentialCmd.AddCommand(newCredentialServeCmd())
+
+	return credentialCmd
+}
+
+// newCredentialServeCmd creates the command that runs the credential cache server
+func newCredentialServeCmd() *cobra.Command {
+	serveCmd := &cobra.Command{
+		Use:          "serve",
+		Short:        "Run the local credential cache server for the exec-credential plugin",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runCredentialServe,
+	}
+
+	serveCmd.Flags().String("socket", "", "Credential cache socket path (default: from RANCHER_CREDENTIAL_CACHE_SOCKET env or the user cache dir)")
+	serveCmd.Flags().Duration("refresh-before", time.Hour, "Refresh cached tokens in the background when they expire within this duration")
+	addRancherFlags(serveCmd)
+
+	return serveCmd
+}
+
+func runCredential(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the ExecCredential, so logs go to stderr
+	zapLogger := logger.NewLoggerWithWriter(os.Stderr, zapcore.WarnLevel)
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	cluster, _ := cmd.Flags().GetString("cluster")
+	socketPath, err := resolveSocketPath(cmd)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), 2*time.Minute)
+	defer cancel()
+
+	cred, err := credcache.Lookup(ctx, socketPath, cluster)
+	if err != nil {
+		zapLogger.Debug("Credential cache unavailable, fetching token from Rancher", zap.Error(err))
+
+		client, _, err := newRancherClient(cmd, zapLogger)
+		if err != nil {
+			return err
+		}
+		cred, err = fetchClusterCredential(client, cluster)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeExecCredential(cmd.OutOrStdout(), cred)
+}
+
+func runCredentialServe(cmd *cobra.Command, args []string) error {
+	zapLogger := logger.NewLogger()
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	socketPath, err := resolveSocketPath(cmd)
+	if err != nil {
+		return err
+	}
+	refreshBefore, _ := cmd.Flags().GetDuration("refresh-before")
+
+	client, _, err := newRancherClient(cmd, zapLogger)
+	if err != nil {
+		return err
+	}
+
+	cache := credcache.NewCache(func(ctx context.Context, cluster string) (credcache.Credential, error) {
+		zapLogger.Info("Fetching cluster token from Rancher", zap.String("cluster", cluster))
+		return fetchClusterCredential(client, cluster)
+	}, refreshBefore)
+
+	listener, err := credcache.Listen(socketPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	zapLogger.Info("Credential cache server listening", zap.String("socket", socketPath))
+	return credcache.Serve(ctx, listener, cache)
+}
+
+// resolveSocketPath returns the --socket flag value or the default socket path
+func resolveSocketPath(cmd *cobra.Command) (string, error) {
+	if socketPath, _ := cmd.Flags().GetString("socket"); socketPath != "" {
+		return socketPath, nil
+	}
+	return credcache.DefaultSocketPath()
+}
+
+// fetchClusterCredential generates a kubeconfig for the cluster and returns its token and expiration
+func fetchClusterCredential(client *rancher.Client, clusterNameOrID string) (credcache.Credential, error) {
+	clusters, err := client.ListClusters()
+	if err != nil {
+		return credcache.Credential{}, fmt.Errorf("failed to retrieve cluster list from Rancher: %w", err)
+	}
+
+	target, err := findCluster(clusters, clusterNameOrID)
+	if err != nil {
+		return credcache.Credential{}, err
+	}
+
+	clusterKubeconfig, err := client.GetClusterKubeconfig(target.ID)
+	if err != nil {
+		return credcache.Credential{}, err
+	}
+
+	token, ok := kubeconfig.ExtractTokenFromKubeconfig(clusterKubeconfig)
+	if !ok {
+		if _, isExec := kubeconfig.ExtractExecFromKubeconfig(clusterKubeconfig); isExec {
+			return credcache.Credential{}, fmt.Errorf("rancher returned no token for cluster %s because kubeconfig-generate-token is disabled on the server; exec-credential mode requires generated tokens", target.Name)
+		}
+		return credcache.Credential{}, fmt.Errorf("failed to extract token from kubeconfig for cluster %s", target.Name)
+	}
+
+	expiresAt, err := client.GetTokenExpiration(token)
+	if err != nil {
+		return credcache.Credential{}, fmt.Errorf("failed to check token expiration: %w", err)
+	}
+
+	return credcache.Credential{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// writeExecCredential prints cred as an ExecCredential object
+func writeExecCredential(w io.Writer, cred credcache.Credential) error {
+	out := execCredentialObject{
+		APIVersion: execCredentialAPIVersion,
+		Kind:       "ExecCredential",
+		Status:     execCredentialStatus{Token: cred.Token},
+	}
+	if !cred.ExpiresAt.IsZero() {
+		out.Status.ExpirationTimestamp = cred.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"rancher-kubeconfig-updater/internal/credcache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteExecCredential(t *testing.T) {
+	tests := []struct {
+		name               string
+		cred               credcache.Credential
+		expectedExpiration string
+	}{
+		{
+			name:               "expiring token",
+			cred:               credcache.Credential{Token: "kubeconfig-u-abc:secret", ExpiresAt: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)},
+			expectedExpiration: "2025-03-01T12:00:00Z",
+		},
+		{
+			name:               "never expiring token",
+			cred:               credcache.Credential{Token: "kubeconfig-u-abc:secret"},
+			expectedExpiration: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, writeExecCredential(&buf, tt.cred))
+
+			var out map[string]interface{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+			assert.Equal(t, "client.authentication.k8s.io/v1", out["apiVersion"])
+			assert.Equal(t, "ExecCredential", out["kind"])
+
+			status := out["status"].(map[string]interface{})
+			assert.Equal(t, "kubeconfig-u-abc:secret", status["token"])
+			if tt.expectedExpiration == "" {
+				assert.NotContains(t, status, "expirationTimestamp")
+			} else {
+				assert.Equal(t, tt.expectedExpiration, status["expirationTimestamp"])
+			}
+		})
+	}
+}
+
+func TestCredentialCmd_FlagsRegistered(t *testing.T) {
+	cmd := NewCredentialCmd()
+
+	assert.NotNil(t, cmd.Flags().Lookup("cluster"))
+	assert.NotNil(t, cmd.Flags().Lookup("socket"))
+	assert.NotNil(t, cmd.Flags().Lookup("user"))
+	assert.NotNil(t, cmd.Flags().Lookup("password"))
+
+	serveCmd, _, err := cmd.Find([]string{"serve"})
+	require.NoError(t, err)
+	assert.Equal(t, "serve", serveCmd.Name())
+	assert.NotNil(t, serveCmd.Flags().Lookup("refresh-before"))
+}
+
+func TestExecCredentialFlag_FlagRegistered(t *testing.T) {
+	cmd := NewRootCmd()
+
+	flag := cmd.Flags().Lookup("exec-credential")
+	assert.NotNil(t, flag, "exec-credential flag should be registered")
+	assert.Equal(t, "false", flag.DefValue)
+
+	credentialCmd, _, err := cmd.Find([]string{"credential"})
+	require.NoError(t, err)
+	assert.Equal(t, "credential", credentialCmd.Name())
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/grafana"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/metrics"
+	"rancher-kubeconfig-updater/internal/schedule"
+	"rancher-kubeconfig-updater/internal/status"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// defaultOwnerLabel is the Rancher cluster label naming a cluster's owner in reports
+const defaultOwnerLabel = "owner"
+
+// addDaemonFlags registers the flags that keep the updater running
+func addDaemonFlags(cmd *cobra.Command) {
+	cmd.Flags().Duration("interval", 0, "Keep running and update the kubeconfig every interval, e.g. 6h (daemon mode)")
+	cmd.Flags().StringArray("schedule", nil, "Keep running and update the kubeconfig at the times of this cron expression, e.g. \"0 6 * * 1-5\" or \"@every 2h\"; repeat the flag to combine expressions (daemon mode, instead of --interval)")
+	cmd.Flags().String("schedule-timezone", "", "Time zone of the --schedule expressions, e.g. Europe/Berlin (default: the local time zone)")
+	cmd.Flags().Duration("jitter", 0, "Wait a random time up to this before each update, so machines started at the same time don't all reach Rancher at once, e.g. 15m")
+	cmd.Flags().Duration("stagger", 0, "Wait a random time up to this before each cluster and each additional Rancher server, spreading a run's API calls, e.g. 2s")
+	cmd.Flags().String("listen", "", "In daemon mode, serve token expiry data for Grafana's JSON API and Infinity datasources and Rancher API metrics at /metrics on this address, e.g. :9090")
+	cmd.Flags().Duration("self-check-interval", 0, "In daemon mode, check this often, e.g. 24h, that every token could still be refreshed and notify about clusters where the refresh would fail")
+}
+
+// statusSnapshot holds the token statuses collected after the latest update
+type statusSnapshot struct {
+	mu        sync.Mutex
+	entries   []status.Entry
+	collected time.Time
+}
+
+func (s *statusSnapshot) set(entries []status.Entry, collected time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries, s.collected = entries, collected
+}
+
+func (s *statusSnapshot) get() ([]status.Entry, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries, s.collected
+}
+
+// daemonHandler serves the Rancher API metrics at /metrics and the Grafana datasource at every other path
+func daemonHandler(source grafana.Source, registry *metrics.Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", registry)
+	mux.Handle("/", grafana.NewHandler(source))
+	return mux
+}
+
+// parseSchedule returns the daemon's schedule: every --interval or at the times of the --schedule
+// expressions, or nil when neither is given
+func parseSchedule(cmd *cobra.Command) (schedule.Schedule, error) {
+	interval := config.GetDuration(cmd, "interval", "INTERVAL")
+	// Cron expressions contain commas, so the environment variable separates them with semicolons
+	specs, _ := cmd.Flags().GetStringArray("schedule")
+	if !cmd.Flags().Changed("schedule") {
+		specs = nil
+		for spec := range strings.SplitSeq(os.Getenv("SCHEDULE"), ";") {
+			if spec = strings.TrimSpace(spec); spec != "" {
+				specs = append(specs, spec)
+			}
+		}
+	}
+	switch {
+	case len(specs) > 0 && interval > 0:
+		return nil, errors.New("--interval and --schedule can't be combined")
+	case interval > 0:
+		return schedule.Every(interval), nil
+	case len(specs) == 0:
+		return nil, nil
+	}
+
+	location := time.Local
+	if tz := config.GetConfig(cmd, "schedule-timezone", "SCHEDULE_TIMEZONE"); tz != "" {
+		var err error
+		if location, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("invalid schedule time zone: %w", err)
+		}
+	}
+	return schedule.Parse(specs, location)
+}
+
+// runDaemon updates the kubeconfig at the times of sched until the process is interrupted, each
+// update after a random delay up to jitter. A failed update is logged and retried at the next
+// time; updates are skipped while a required address can't be reached. --listen serves the token
+// expiries and API metrics, and --self-check-interval adds periodic self-checks.
+func runDaemon(cmd *cobra.Command, args []string, sched schedule.Schedule, jitter time.Duration, required []string) {
+	zapLogger := logger.NewLogger()
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	ctx, stop := signal.NotifyContext(commandContext(cmd), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var snapshot statusSnapshot
+	// apiMetrics records the Rancher API requests of the updates while serving --listen
+	var apiMetrics *metrics.Registry
+	listen := config.GetConfig(cmd, "listen", "LISTEN_ADDRESS")
+	if listen != "" {
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			zapLogger.Error("Failed to listen for Grafana", zap.String("address", listen), zap.Error(err))
+			return
+		}
+		apiMetrics = metrics.New()
+		server := &http.Server{Handler: daemonHandler(snapshot.get, apiMetrics), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				zapLogger.Error("Grafana datasource stopped", zap.Error(err))
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+		zapLogger.Info("Serving token expiry data for Grafana and metrics for Prometheus", zap.String("address", listener.Addr().String()))
+	}
+
+	selfCheckInterval := config.GetDuration(cmd, "self-check-interval", "SELF_CHECK_INTERVAL")
+	var lastSelfCheck time.Time
+
+	zapLogger.Info("Daemon mode enabled", zap.Stringer("schedule", sched), zap.Duration("jitter", jitter))
+	for {
+		if !waitJitter(ctx, jitter, zapLogger) {
+			zapLogger.Info("Daemon stopped")
+			return
+		}
+		if addr, err := firstUnreachable(ctx, required); err != nil {
+			zapLogger.Info("Skipping update, required address is unreachable", zap.String("address", addr), zap.Error(err))
+		} else {
+			update(cmd, args, apiMetrics)
+			if listen != "" {
+				entries, err := collectStatus(cmd, apiMetrics, zapLogger)
+				if err != nil {
+					zapLogger.Warn("Failed to collect token expiry data, Grafana keeps showing the previous data", zap.Error(err))
+				} else {
+					snapshot.set(entries, time.Now())
+				}
+			}
+			if selfCheckInterval > 0 && time.Since(lastSelfCheck) >= selfCheckInterval {
+				lastSelfCheck = time.Now()
+				selfCheck(cmd, apiMetrics, zapLogger)
+			}
+		}
+
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			zapLogger.Error("Schedule has no further update times, stopping the daemon", zap.Stringer("schedule", sched))
+			return
+		}
+		zapLogger.Info("Next update scheduled", zap.Time("at", next))
+		if err := sleepContext(ctx, time.Until(next)); err != nil {
+			zapLogger.Info("Daemon stopped")
+			return
+		}
+	}
+}
+
+// waitJitter waits a random time up to jitter before an update. It returns false if ctx
+// ended while waiting.
+func waitJitter(ctx context.Context, jitter time.Duration, zapLogger *zap.Logger) bool {
+	delay := randomDelay(jitter)
+	if delay == 0 {
+		return true
+	}
+	zapLogger.Info("Waiting before updating to spread the load on Rancher", zap.Duration("delay", delay))
+	return sleepContext(ctx, delay) == nil
+}
+
+// randomDelay returns a random duration in [0, max), or 0 if max is not positive
+func randomDelay(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
+
+// sleepContext waits for d, or until ctx ends
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// collectStatus looks up the token expiry of the kubeconfig's entries on every Rancher server.
+// The requests are recorded in apiMetrics, if it is not nil.
+func collectStatus(cmd *cobra.Command, apiMetrics *metrics.Registry, zapLogger *zap.Logger) ([]status.Entry, error) {
+	output, err := parseOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var kubecfg *api.Config
+	if output != nil {
+		kubecfg, err = output.load(commandContext(cmd))
+	} else {
+		kubecfg, err = kubeconfig.LoadKubeconfig(configPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := resolveRancherSettings(cmd)
+	if err != nil {
+		return nil, err
+	}
+	settings.apiMetrics = apiMetrics
+	credentials := newCredentialSource(cmd, settings)
+	defer credentials.clear()
+
+	var entries []status.Entry
+	sources, clearSources := credentialsPerServer(cmd, settings, credentials)
+	defer clearSources()
+	for i, serverSettings := range settings.perServer() {
+		client, rancherURL, err := connectRancher(serverSettings, sources[i], zapLogger)
+		if err != nil {
+			return nil, err
+		}
+		serverEntries := status.Collect(kubecfg, rancherURL, client)
+		if clusters, err := client.ListClusters(); err == nil {
+			status.SetOwners(serverEntries, clusters, defaultOwnerLabel)
+		}
+		entries = append(entries, serverEntries...)
+	}
+	return entries, nil
+}
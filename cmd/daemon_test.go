@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"rancher-kubeconfig-updater/internal/metrics"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/status"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDaemonFlags_Registered(t *testing.T) {
+	cmd := NewRootCmd()
+
+	assert.Equal(t, "0s", cmd.Flags().Lookup("interval").DefValue)
+	assert.NotNil(t, cmd.Flags().Lookup("listen"))
+	assert.Equal(t, "0s", cmd.Flags().Lookup("jitter").DefValue)
+	assert.Equal(t, "0s", cmd.Flags().Lookup("stagger").DefValue)
+}
+
+func TestParseSchedule(t *testing.T) {
+	t.Setenv("INTERVAL", "")
+	t.Setenv("SCHEDULE", "")
+	t.Setenv("SCHEDULE_TIMEZONE", "")
+
+	cmd := NewRootCmd()
+	sched, err := parseSchedule(cmd)
+	require.NoError(t, err)
+	assert.Nil(t, sched, "without --interval or --schedule the updater runs once")
+
+	cmd = NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--interval", "6h"}))
+	sched, err = parseSchedule(cmd)
+	require.NoError(t, err)
+	assert.Equal(t, "every 6h0m0s", sched.String())
+
+	cmd = NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--schedule", "0 6 * * 1-5", "--schedule", "@every 4h", "--schedule-timezone", "Europe/Berlin"}))
+	sched, err = parseSchedule(cmd)
+	require.NoError(t, err)
+	assert.Equal(t, "0 6 * * 1-5; @every 4h (Europe/Berlin)", sched.String())
+
+	t.Setenv("SCHEDULE", "0 6 * * 1-5; 0 12 * * 6,0")
+	t.Setenv("SCHEDULE_TIMEZONE", "UTC")
+	sched, err = parseSchedule(NewRootCmd())
+	require.NoError(t, err)
+	assert.Equal(t, "0 6 * * 1-5; 0 12 * * 6,0 (UTC)", sched.String())
+
+	cmd = NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--interval", "6h"}))
+	_, err = parseSchedule(cmd)
+	assert.ErrorContains(t, err, "can't be combined")
+
+	t.Setenv("SCHEDULE_TIMEZONE", "Nowhere/Atlantis")
+	_, err = parseSchedule(NewRootCmd())
+	assert.ErrorContains(t, err, "invalid schedule time zone")
+}
+
+func TestStatusSnapshot(t *testing.T) {
+	var s statusSnapshot
+	entries, collected := s.get()
+	assert.Nil(t, entries)
+	assert.True(t, collected.IsZero())
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.set([]status.Entry{{Context: "prod"}}, at)
+	entries, collected = s.get()
+	assert.Equal(t, []status.Entry{{Context: "prod"}}, entries)
+	assert.Equal(t, at, collected)
+}
+
+func TestDaemonHandler(t *testing.T) {
+	registry := metrics.New()
+	registry.Observe("list_clusters", http.StatusOK, 10*time.Millisecond)
+	handler := daemonHandler(func() ([]status.Entry, time.Time) { return nil, time.Time{} }, registry)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `rancher_api_requests_total{endpoint="list_clusters",code="200"} 1`)
+
+	// The Grafana datasource keeps answering its health check
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRancherSettings_ClientOptions(t *testing.T) {
+	settings := rancherSettings{qps: 5}
+	assert.Len(t, settings.clientOptions(), 2)
+
+	settings.apiMetrics = metrics.New()
+	assert.Len(t, settings.clientOptions(), 3)
+	settings.apiErrors = rancher.NewErrorLog(10)
+	assert.Len(t, settings.clientOptions(), 4)
+	settings.clock = rancher.FixedClock(time.Now().AddDate(0, 0, 20))
+	assert.Len(t, settings.clientOptions(), 5)
+
+	// Profiles share the run's metrics, error log, clock and rate limit
+	settings.limiter = rancher.NewRateLimiter(settings.qps)
+	settings.profiles = []rancherSettings{{url: "https://a.example.com"}, {url: "https://b.example.com"}}
+	for _, serverSettings := range settings.perServer() {
+		assert.Same(t, settings.apiMetrics, serverSettings.apiMetrics)
+		assert.Same(t, settings.apiErrors, serverSettings.apiErrors)
+		assert.Equal(t, settings.clock, serverSettings.clock)
+		assert.Same(t, settings.limiter, serverSettings.limiter)
+	}
+	assert.Nil(t, settings.profiles[0].apiMetrics, "the profiles themselves are left alone")
+}
+
+func TestRandomDelay(t *testing.T) {
+	assert.Zero(t, randomDelay(0))
+	assert.Zero(t, randomDelay(-time.Second))
+	for range 100 {
+		d := randomDelay(time.Minute)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.Less(t, d, time.Minute)
+	}
+}
+
+func TestWaitJitter(t *testing.T) {
+	assert.True(t, waitJitter(context.Background(), 0, zap.NewNop()))
+	assert.True(t, waitJitter(context.Background(), time.Millisecond, zap.NewNop()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	assert.False(t, waitJitter(ctx, time.Hour, zap.NewNop()), "an interrupted wait does not update")
+	assert.Less(t, time.Since(start), time.Second)
+}
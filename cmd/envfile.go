@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/config"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+// addEnvFileFlag registers the flag naming an extra file of environment variables
+func addEnvFileFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("env-file", "", "File with environment variables to load, taking precedence over .env.<profile> and .env, e.g. ~/rancher/prod.env")
+}
+
+// loadEnvFiles loads the variables of --env-file, then .env.<profile> for --profile, then .env
+// from the working directory. Variables that are already set are never overridden, so this
+// order is also the precedence, after the environment itself. Only a missing --env-file is an
+// error; the .env files are optional.
+func loadEnvFiles(cmd *cobra.Command) error {
+	if path := config.GetConfig(cmd, "env-file", "ENV_FILE"); path != "" {
+		if err := godotenv.Load(path); err != nil {
+			return fmt.Errorf("failed to load --env-file: %w", err)
+		}
+	}
+
+	// The --env-file may select the profile as well
+	files := []string{".env"}
+	if profile := config.GetConfig(cmd, "profile", "RANCHER_PROFILE"); profile != "" {
+		if filepath.Base(profile) != profile || profile == ".." {
+			return fmt.Errorf("invalid profile name %q: must not contain a path", profile)
+		}
+		files = []string{".env." + profile, ".env"}
+	}
+	for _, file := range files {
+		if err := godotenv.Load(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to load %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// envProfileExists reports whether the .env.<profile> file of profile exists
+func envProfileExists(profile string) bool {
+	_, err := os.Stat(".env." + profile)
+	return err == nil
+}
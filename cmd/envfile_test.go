@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadEnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile(".env", []byte("RANCHER_URL=https://rancher.dev.example.com\nRANCHER_USERNAME=shared\nTEST_ENV_LEVEL=dotenv\n"), 0o600))
+	require.NoError(t, os.WriteFile(".env.prod", []byte("RANCHER_URL=https://rancher.prod.example.com\nTEST_ENV_LEVEL=profile\n"), 0o600))
+	extra := filepath.Join(dir, "extra.env")
+	require.NoError(t, os.WriteFile(extra, []byte("TEST_ENV_LEVEL=env-file\n"), 0o600))
+	for _, key := range []string{"RANCHER_URL", "RANCHER_USERNAME", "TEST_ENV_LEVEL", "ENV_FILE", "RANCHER_PROFILE"} {
+		t.Setenv(key, "")
+		// Unset rather than empty, as godotenv only fills in variables that are not set at all
+		require.NoError(t, os.Unsetenv(key))
+	}
+
+	rootCmd := NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--profile", "prod", "--env-file", extra}))
+	require.NoError(t, loadEnvFiles(rootCmd))
+	assert.Equal(t, "env-file", os.Getenv("TEST_ENV_LEVEL"), "--env-file takes precedence over the .env files")
+	assert.Equal(t, "https://rancher.prod.example.com", os.Getenv("RANCHER_URL"), ".env.prod takes precedence over .env")
+	assert.Equal(t, "shared", os.Getenv("RANCHER_USERNAME"), ".env fills in the rest")
+
+	// Variables of the environment are never overridden
+	t.Setenv("RANCHER_URL", "https://rancher.example.com")
+	require.NoError(t, loadEnvFiles(NewRootCmd()))
+	assert.Equal(t, "https://rancher.example.com", os.Getenv("RANCHER_URL"))
+}
+
+func TestLoadEnvFiles_Errors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("ENV_FILE", "")
+	t.Setenv("RANCHER_PROFILE", "")
+
+	// A profile without a .env file of its own is fine
+	rootCmd := NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--profile", "dev"}))
+	require.NoError(t, loadEnvFiles(rootCmd))
+
+	rootCmd = NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--env-file", "missing.env"}))
+	assert.ErrorContains(t, loadEnvFiles(rootCmd), "failed to load --env-file")
+
+	rootCmd = NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--profile", "../prod"}))
+	assert.ErrorContains(t, loadEnvFiles(rootCmd), "invalid profile name")
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"rancher-kubeconfig-updater/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// addEventFlags adds the flags of the lifecycle event stream
+func addEventFlags(cmd *cobra.Command) {
+	cmd.Flags().String("events", "", "Stream one JSON event per lifecycle step (login, cluster-start, decision, token-generated, saved, finished) for wrappers and GUIs: 'ndjson'")
+	cmd.Flags().Int("events-fd", 1, "File descriptor the --events stream is written to, e.g. 3; on stdout (1) the logs move to stderr")
+}
+
+// openEventStream returns where --events streams to and whether that is stdout, or a nil writer
+// when no stream was requested
+func openEventStream(cmd *cobra.Command) (io.Writer, bool, error) {
+	format := config.GetConfig(cmd, "events", "EVENTS")
+	if format == "" {
+		return nil, false, nil
+	}
+	if format != "ndjson" {
+		return nil, false, fmt.Errorf("invalid events format %q. Must be 'ndjson'", format)
+	}
+	fd := config.GetInt(cmd, "events-fd", "EVENTS_FD")
+	switch {
+	case fd == 1:
+		return cmd.OutOrStdout(), true, nil
+	case fd == 2:
+		return os.Stderr, false, nil
+	case fd < 0:
+		return nil, false, fmt.Errorf("invalid events file descriptor %d", fd)
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if _, err := f.Stat(); err != nil {
+		return nil, false, fmt.Errorf("events file descriptor %d is not open: %w", fd, err)
+	}
+	return f, false, nil
+}
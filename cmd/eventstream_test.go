@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/eventstream"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenEventStream(t *testing.T) {
+	t.Setenv("EVENTS", "")
+	t.Setenv("EVENTS_FD", "")
+	w, onStdout, err := openEventStream(NewRootCmd())
+	require.NoError(t, err)
+	assert.Nil(t, w)
+	assert.False(t, onStdout)
+
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--events", "ndjson"}))
+	w, onStdout, err = openEventStream(cmd)
+	require.NoError(t, err)
+	assert.NotNil(t, w)
+	assert.True(t, onStdout)
+
+	t.Setenv("EVENTS", "json")
+	_, _, err = openEventStream(NewRootCmd())
+	assert.ErrorContains(t, err, `invalid events format "json"`)
+
+	t.Setenv("EVENTS", "ndjson")
+	t.Setenv("EVENTS_FD", "987")
+	_, _, err = openEventStream(NewRootCmd())
+	assert.ErrorContains(t, err, "events file descriptor 987 is not open")
+}
+
+func TestUpdate_EventStream(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "me", rancher.Cluster{ID: "c-prod", Name: "prod"})
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "config")
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("EVENTS", "")
+	t.Setenv("EVENTS_FD", "")
+	cmd := NewRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--server", server.URL, "--user", "admin", "-c", kubeconfigPath,
+		"--state-file", filepath.Join(dir, "state.json"), "-a", "--events", "ndjson"})
+	require.NoError(t, cmd.Execute())
+
+	var events []eventstream.Event
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var e eventstream.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e), "stdout holds only events: %s", scanner.Text())
+		events = append(events, e)
+	}
+	types := make([]string, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+	}
+	assert.Equal(t, []string{
+		eventstream.TypeLogin, eventstream.TypeClusterStart, eventstream.TypeDecision,
+		eventstream.TypeTokenGenerated, eventstream.TypeSaved, eventstream.TypeFinished,
+	}, types)
+	assert.Equal(t, "prod", events[1].Cluster)
+	require.NotNil(t, events[2].Regenerate)
+	assert.True(t, *events[2].Regenerate)
+	assert.NotEmpty(t, events[3].TokenName)
+	assert.Equal(t, kubeconfigPath, events[4].Path)
+	assert.Equal(t, "succeeded", events[5].Outcome)
+	assert.Equal(t, events[0].RunID, events[5].RunID)
+}
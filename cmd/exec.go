@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// NewExecCmd creates the command that refreshes one cluster's token and then runs a command against it.
+func NewExecCmd() *cobra.Command {
+	execCmd := &cobra.Command{
+		Use:   "exec --cluster NAME [flags] -- command [args...]",
+		Short: "Ensure a fresh token for a cluster, then run a command against it",
+		Long: "Refreshes the cluster's token in the kubeconfig if needed, then runs the command\n" +
+			"with KUBECONFIG pointing at a kubeconfig whose current context is that cluster.\n" +
+			"The command's exit code is propagated.",
+		Args:          cobra.MinimumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          runExec,
+	}
+
+	// Everything after the first positional argument belongs to the wrapped command
+	execCmd.Flags().SetInterspersed(false)
+
+	execCmd.Flags().String("cluster", "", "Cluster name or ID to run the command against")
+	_ = execCmd.MarkFlagRequired("cluster")
+	execCmd.Flags().StringP("config", "c", "", "Path to kubeconfig file (default: ~/.kube/config)")
+	execCmd.Flags().Int("threshold-days", 30, "Expiration threshold in days")
+	execCmd.Flags().Bool("force-refresh", false, "Bypass expiration checks and force regeneration")
+	execCmd.Flags().String("state-file", "", "Path to the state file tracking managed entries (default: <user cache dir>/rancher-kubeconfig-updater/state.json)")
+	addGatewayFlag(execCmd)
+	addRancherFlags(execCmd)
+	addSaveFlags(execCmd)
+
+	return execCmd
+}
+
+func runExec(cmd *cobra.Command, args []string) error {
+	// The child owns stdout, so logs go to stderr to keep its output parseable
+	zapLogger := logger.NewLoggerWithWriter(os.Stderr, zapcore.InfoLevel)
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	clusterName, _ := cmd.Flags().GetString("cluster")
+	kubeconfigPath, _ := cmd.Flags().GetString("config")
+
+	cluster, kubecfg, err := ensureFreshCluster(cmd, kubeconfigPath, clusterName, zapLogger)
+	if err != nil {
+		zapLogger.Error("Failed to refresh cluster token", zap.String("cluster", clusterName), zap.Error(err))
+		return &ExitError{Code: 1}
+	}
+
+	childCfg, err := contextOnlyConfig(kubecfg, cluster.Name)
+	if err != nil {
+		zapLogger.Error("Failed to prepare kubeconfig for command", zap.Error(err))
+		return &ExitError{Code: 1}
+	}
+
+	childPath, cleanup, err := writeTempKubeconfig(childCfg)
+	if err != nil {
+		zapLogger.Error("Failed to write temporary kubeconfig", zap.Error(err))
+		return &ExitError{Code: 1}
+	}
+	defer cleanup()
+
+	code, err := runChild(cmd.Context(), args, []string{"KUBECONFIG=" + childPath})
+	if err != nil {
+		zapLogger.Error("Failed to run command", zap.String("command", args[0]), zap.Error(err))
+		return &ExitError{Code: 127}
+	}
+	if code != 0 {
+		return &ExitError{Code: code}
+	}
+	return nil
+}
+
+// ensureFreshCluster refreshes the token of a single cluster in the kubeconfig at kubeconfigPath
+// when needed, saving the kubeconfig if it changed. The entry is created if it does not exist.
+func ensureFreshCluster(cmd *cobra.Command, kubeconfigPath, clusterNameOrID string, zapLogger *zap.Logger) (*rancher.Cluster, *api.Config, error) {
+	clusters, kubecfg, err := ensureFreshClusters(cmd, kubeconfigPath, func(all rancher.Clusters) (rancher.Clusters, error) {
+		cluster, err := findCluster(all, clusterNameOrID)
+		if err != nil {
+			return nil, err
+		}
+		return rancher.Clusters{*cluster}, nil
+	}, zapLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &clusters[0], kubecfg, nil
+}
+
+// ensureFreshClusters refreshes the tokens of the clusters chosen by selectClusters from
+// Rancher's cluster list, like ensureFreshCluster does for one. The first failing cluster
+// aborts the refresh, but the tokens already created for the clusters before it are saved,
+// so they are not left behind in Rancher without a kubeconfig entry.
+func ensureFreshClusters(cmd *cobra.Command, kubeconfigPath string, selectClusters func(rancher.Clusters) (rancher.Clusters, error), zapLogger *zap.Logger) (rancher.Clusters, *api.Config, error) {
+	saveOpts, err := saveOptions(cmd, zapLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkRootWrite(cmd, kubeconfigPath); err != nil {
+		return nil, nil, err
+	}
+	gateways, err := loadGateways(cmd, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kubecfg, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load kubeconfig file: %w", err)
+	}
+	baseKubecfg := kubecfg.DeepCopy()
+	st, stateKey := loadState(cmd, kubeconfigPath, zapLogger)
+
+	client, rancherURL, err := newRancherClient(cmd, zapLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	all, err := client.ListClusters()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve cluster list from Rancher: %w", err)
+	}
+
+	clusters, err := selectClusters(all)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := pipeline.Options{
+		RancherURL:     rancherURL,
+		ThresholdDays:  config.GetInt(cmd, "threshold-days", "TOKEN_THRESHOLD_DAYS"),
+		ForceRefresh:   config.GetBool(cmd, "force-refresh", "FORCE_REFRESH"),
+		AutoCreate:     true,
+		Gateways:       gateways,
+		State:          st,
+		KubeconfigPath: stateKey,
+		Hint:           Hint,
+	}
+
+	anyUpdated := false
+	var processErr error
+	for _, cluster := range clusters {
+		result := pipeline.Process(commandContext(cmd), client, kubecfg, cluster, opts, zapLogger)
+		if result.Err != nil {
+			processErr = result.Err
+			break
+		}
+		if result.Updated {
+			anyUpdated = true
+			// Recorded like a normal run does, so the next run does not take the entry for a manual edit
+			if sum, ok := kubeconfig.EntryChecksum(kubecfg, cluster.Name); ok && st != nil {
+				st.SetChecksum(stateKey, cluster.Name, sum)
+			}
+		}
+	}
+
+	if anyUpdated {
+		if kubecfg, err = saveWithState(baseKubecfg, kubecfg, kubeconfigPath, st, saveOpts, zapLogger); err != nil {
+			return nil, nil, errors.Join(processErr, err)
+		}
+	}
+	if processErr != nil {
+		return nil, nil, processErr
+	}
+
+	return clusters, kubecfg, nil
+}
+
+// contextOnlyConfig returns a copy of kubecfg reduced to the given context, which becomes the current context
+func contextOnlyConfig(kubecfg *api.Config, contextName string) (*api.Config, error) {
+	if _, exists := kubecfg.Contexts[contextName]; !exists {
+		return nil, fmt.Errorf("context %s not found in kubeconfig", contextName)
+	}
+
+	cfg := kubecfg.DeepCopy()
+	cfg.CurrentContext = contextName
+	if err := api.MinifyConfig(cfg); err != nil {
+		return nil, fmt.Errorf("failed to minify kubeconfig: %w", err)
+	}
+	return cfg, nil
+}
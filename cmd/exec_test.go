@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"io"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestExecCmd_FlagsRegistered(t *testing.T) {
+	cmd := NewExecCmd()
+
+	for _, name := range []string{"cluster", "config", "threshold-days", "force-refresh", "user", "password"} {
+		assert.NotNil(t, cmd.Flags().Lookup(name), "%s flag should be registered", name)
+	}
+
+	err := cmd.ParseFlags([]string{"--cluster", "prod", "kubectl", "get", "pods", "--cluster", "other"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kubectl", "get", "pods", "--cluster", "other"}, cmd.Flags().Args())
+
+	cluster, _ := cmd.Flags().GetString("cluster")
+	assert.Equal(t, "prod", cluster)
+}
+
+func TestContextOnlyConfig(t *testing.T) {
+	kubecfg := api.NewConfig()
+	for _, name := range []string{"prod", "staging"} {
+		kubecfg.Clusters[name] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/" + name}
+		kubecfg.AuthInfos[name] = &api.AuthInfo{Token: "token-" + name + ":secret"}
+		kubecfg.Contexts[name] = &api.Context{Cluster: name, AuthInfo: name}
+	}
+	kubecfg.CurrentContext = "staging"
+
+	cfg, err := contextOnlyConfig(kubecfg, "prod")
+	require.NoError(t, err)
+
+	assert.Equal(t, "prod", cfg.CurrentContext)
+	assert.Len(t, cfg.Contexts, 1)
+	assert.Len(t, cfg.Clusters, 1)
+	assert.Len(t, cfg.AuthInfos, 1)
+	assert.Equal(t, "token-prod:secret", cfg.AuthInfos["prod"].Token)
+
+	// The original kubeconfig must not be modified
+	assert.Equal(t, "staging", kubecfg.CurrentContext)
+	assert.Len(t, kubecfg.Contexts, 2)
+
+	_, err = contextOnlyConfig(kubecfg, "missing")
+	assert.Error(t, err)
+}
+
+func TestEnsureFreshClusters_SavesBeforeFailure(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "admin", rancher.Cluster{ID: "c-1", Name: "prod"})
+	kubeconfigPath := filepath.Join(t.TempDir(), "config")
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("STATE_FILE", filepath.Join(t.TempDir(), "state.json"))
+	cmd := NewExecCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", server.URL, "--user", "admin", "--config", kubeconfigPath}))
+
+	// The second cluster disappeared from the server, so creating its token fails
+	_, _, err := ensureFreshClusters(cmd, kubeconfigPath, func(all rancher.Clusters) (rancher.Clusters, error) {
+		return append(all, rancher.Cluster{ID: "c-gone", Name: "gone"}), nil
+	}, zap.NewNop())
+	require.Error(t, err)
+
+	// The token created for the first cluster is not lost
+	saved, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	require.NoError(t, err)
+	require.Contains(t, saved.AuthInfos, "prod")
+	assert.Equal(t, "kubeconfig-u-admin:secret", saved.AuthInfos["prod"].Token)
+	assert.NotContains(t, saved.AuthInfos, "gone")
+}
+
+func TestEnsureFreshCluster_RecordsChecksum(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "admin", rancher.Cluster{ID: "c-1", Name: "prod"})
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "config")
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("STATE_FILE", filepath.Join(dir, "state.json"))
+	t.Setenv("CHECKPOINT", "")
+
+	// An earlier run wrote the entry and recorded its checksum
+	kubecfg, err := clientcmd.Load([]byte(generatedKubeconfig("prod", "c-1", "kubeconfig-u-admin:old")))
+	require.NoError(t, err)
+	require.NoError(t, kubeconfig.SaveKubeconfig(kubecfg, kubeconfigPath, zap.NewNop()))
+	st, stateKey := loadState(NewRootCmd(), kubeconfigPath, zap.NewNop())
+	require.NotNil(t, st)
+	sum, _ := kubeconfig.EntryChecksum(kubecfg, "prod")
+	st.SetChecksum(stateKey, "prod", sum)
+	require.NoError(t, st.Save())
+
+	cmd := NewExecCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", server.URL, "--user", "admin", "--config", kubeconfigPath, "--force-refresh"}))
+	_, kubecfg, err = ensureFreshCluster(cmd, kubeconfigPath, "prod", zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "kubeconfig-u-admin:secret", kubecfg.AuthInfos["prod"].Token)
+
+	// A normal run does not take the entry exec wrote for a manual edit
+	rootCmd := NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--server", server.URL, "--user", "admin", "--force-refresh"}))
+	settings, err := resolveRancherSettings(rootCmd)
+	require.NoError(t, err)
+	st, stateKey = loadState(rootCmd, kubeconfigPath, zap.NewNop())
+	require.NotNil(t, st)
+	opts := clusterOptions{Options: pipeline.Options{ThresholdDays: 30, ForceRefresh: true, State: st, KubeconfigPath: stateKey}}
+	result := processServer(rootCmd, settings, newCredentialSource(rootCmd, settings), kubecfg, opts, nil, io.Discard, zap.NewNop())
+	require.NoError(t, result.err)
+	assert.Equal(t, 1, result.updated)
+	assert.Equal(t, 0, result.skipped)
+}
@@ -0,0 +1,13 @@
+package cmd
+
+import "fmt"
+
+// ExitError reports the exit code a command wants the process to terminate with.
+// It is used by wrapper commands to propagate the exit code of the child process.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
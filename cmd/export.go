@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/export"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/readonly"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// NewExportCmd creates the read-only command that describes the kubeconfig's Rancher clusters for other tools.
+func NewExportCmd() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export --format FORMAT",
+		Short: "Describe the Rancher clusters in the kubeconfig for other tools",
+		Long: "Prints the Rancher clusters of the kubeconfig in a format other tools consume.\n" +
+			"Formats:\n" +
+			"  ansible-inventory  Ansible inventory JSON, one host per cluster with its kubeconfig\n" +
+			"                     and context; also works as a dynamic inventory script (--list, --host)\n" +
+			"  contexts           One standalone kubeconfig per cluster, for Lens sync folders and k9s;\n" +
+			"                     written to --dir, or printed as a multi-document YAML stream\n" +
+			"Neither Rancher nor the kubeconfig is contacted or modified.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runExport,
+	}
+
+	exportCmd.Flags().StringP("config", "c", "", "Path to kubeconfig file (default: ~/.kube/config)")
+	exportCmd.Flags().String("format", "", "Output format: 'ansible-inventory' or 'contexts'")
+	_ = exportCmd.MarkFlagRequired("format")
+	exportCmd.Flags().Bool("list", false, "Print the whole inventory (dynamic inventory script protocol, the default)")
+	exportCmd.Flags().String("host", "", "Print only the variables of this inventory host (dynamic inventory script protocol)")
+	exportCmd.Flags().String("dir", "", "Directory to write the per-context kubeconfigs of the 'contexts' format to")
+
+	return exportCmd
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+	if format != "ansible-inventory" && format != "contexts" {
+		return fmt.Errorf("invalid format %q. Must be 'ansible-inventory' or 'contexts'", format)
+	}
+
+	configPath, _ := cmd.Flags().GetString("config")
+	kubeconfigPath, err := kubeconfig.ResolvePath(configPath)
+	if err != nil {
+		return err
+	}
+	if abs, err := filepath.Abs(kubeconfigPath); err == nil {
+		kubeconfigPath = abs
+	}
+
+	kubecfg, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig file: %w", err)
+	}
+	clusters := export.Clusters(kubecfg)
+
+	if format == "contexts" {
+		if dir, _ := cmd.Flags().GetString("dir"); dir != "" {
+			return writeContextFiles(kubecfg, dir)
+		}
+		return printContextFiles(cmd.OutOrStdout(), kubecfg)
+	}
+
+	var out []byte
+	if host, _ := cmd.Flags().GetString("host"); host != "" {
+		// Unknown hosts have no variables
+		vars := map[string]string{}
+		for _, c := range clusters {
+			if c.Context == host {
+				vars = export.AnsibleHostVars(c, kubeconfigPath)
+			}
+		}
+		out, err = json.MarshalIndent(vars, "", "  ")
+	} else {
+		out, err = export.AnsibleInventory(clusters, kubeconfigPath)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(out))
+	return err
+}
+
+// writeContextFiles writes one kubeconfig per Rancher context of kubecfg into dir. The files
+// are replaced atomically and together, so tools watching the directory never read a
+// partial file or a mix of old and new tokens.
+func writeContextFiles(kubecfg *api.Config, dir string) error {
+	files, err := export.ContextFiles(kubecfg, export.Clusters(kubecfg))
+	if err != nil {
+		return err
+	}
+	if err := readonly.Check(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create context directory: %w", err)
+	}
+
+	tx := kubeconfig.NewTransaction()
+	for _, f := range files {
+		data, err := clientcmd.Write(*f.Config)
+		if err != nil {
+			return fmt.Errorf("failed to serialize context %s: %w", f.Config.CurrentContext, err)
+		}
+		tx.Stage(filepath.Join(dir, f.Name), data, 0600)
+	}
+	return tx.Commit()
+}
+
+// printContextFiles prints the per-context kubeconfigs of kubecfg as a multi-document YAML stream
+func printContextFiles(w io.Writer, kubecfg *api.Config) error {
+	files, err := export.ContextFiles(kubecfg, export.Clusters(kubecfg))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		data, err := clientcmd.Write(*f.Config)
+		if err != nil {
+			return fmt.Errorf("failed to serialize context %s: %w", f.Config.CurrentContext, err)
+		}
+		if _, err := fmt.Fprintf(w, "---\n# %s\n%s", f.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
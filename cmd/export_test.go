@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runExportCmd runs the export command with args and returns its output
+func runExportCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmd := NewExportCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestExportCmd_AnsibleInventory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte(tokenKubeconfig), 0600))
+
+	out, err := runExportCmd(t, "--format", "ansible-inventory", "--config", path, "--list")
+	require.NoError(t, err)
+	var inventory map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(out), &inventory))
+	assert.Contains(t, inventory, "rancher_clusters")
+	assert.Contains(t, inventory, "cluster_prod")
+
+	out, err = runExportCmd(t, "--format", "ansible-inventory", "--config", path, "--host", "prod")
+	require.NoError(t, err)
+	var vars map[string]string
+	require.NoError(t, json.Unmarshal([]byte(out), &vars))
+	assert.Equal(t, "prod", vars["kube_context"])
+	assert.Equal(t, path, vars["kubeconfig"])
+
+	out, err = runExportCmd(t, "--format", "ansible-inventory", "--config", path, "--host", "unknown")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{}`, out)
+}
+
+func TestExportCmd_InvalidFormat(t *testing.T) {
+	_, err := runExportCmd(t, "--format", "csv")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid format")
+}
+
+func TestExportCmd_Contexts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte(tokenKubeconfig), 0600))
+
+	dir := filepath.Join(t.TempDir(), "lens")
+	_, err := runExportCmd(t, "--format", "contexts", "--config", path, "--dir", dir)
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, "prod.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "current-context: prod")
+	assert.Contains(t, string(data), "kubeconfig-u-new:newsecret")
+
+	out, err := runExportCmd(t, "--format", "contexts", "--config", path)
+	require.NoError(t, err)
+	assert.Contains(t, out, "---\n# prod.yaml\n")
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/gateway"
+
+	"github.com/spf13/cobra"
+)
+
+// addGatewayFlag registers the flag naming the per-cluster gateway configuration
+func addGatewayFlag(cmd *cobra.Command) {
+	cmd.Flags().String("gateway-config", "", "YAML file routing clusters through Teleport or another identity-aware proxy (server address and exec plugin per cluster)")
+}
+
+// loadGateways reads the gateway configuration, or returns nil when none is configured.
+// Gateway exec plugins authenticate next to the Rancher token, so they can't be combined
+// with exec-credential mode, where the token itself comes from an exec plugin.
+func loadGateways(cmd *cobra.Command, execCredential bool) (*gateway.Config, error) {
+	path := config.GetConfig(cmd, "gateway-config", "GATEWAY_CONFIG")
+	if path == "" {
+		return nil, nil
+	}
+	gateways, err := gateway.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if execCredential && gateways.HasExec() {
+		return nil, fmt.Errorf("gateway exec plugins in %s can't be combined with --exec-credential", path)
+	}
+	return gateways, nil
+}
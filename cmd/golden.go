@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/golden"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// loadGolden fetches the --golden-kubeconfig, or returns nil when none is given
+func loadGolden(cmd *cobra.Command) (*api.Config, string, error) {
+	source := config.GetConfig(cmd, "golden-kubeconfig", "GOLDEN_KUBECONFIG")
+	if source == "" {
+		return nil, "", nil
+	}
+	cfg, err := golden.Fetch(commandContext(cmd), source)
+	return cfg, source, err
+}
+
+// applyGolden merges the clusters and contexts of the golden kubeconfig into kubecfg, which
+// already holds this run's tokens, and records the differences in the plan
+func applyGolden(kubecfg, goldenCfg *api.Config, source string, opts clusterOptions, zapLogger *zap.Logger) golden.Diff {
+	diff := golden.Merge(kubecfg, goldenCfg, source)
+	prefix := ""
+	if opts.DryRun {
+		prefix = "[DRY-RUN] "
+	}
+	for _, name := range diff.Added {
+		zapLogger.Info(prefix+"Added context from golden kubeconfig", zap.String("context", name))
+		opts.Plan.AddContext(name, "")
+	}
+	for _, name := range diff.Updated {
+		zapLogger.Info(prefix+"Updated context from golden kubeconfig", zap.String("context", name))
+	}
+	for _, name := range diff.Removed {
+		zapLogger.Info(prefix+"Removed context no longer in golden kubeconfig", zap.String("context", name))
+		opts.Plan.Prune(name, "")
+	}
+	for _, skip := range diff.Skipped {
+		zapLogger.Warn("Skipped context of golden kubeconfig", zap.String("context", skip.Context), zap.String("reason", skip.Reason))
+		opts.Plan.Skip(skip.Context, skip.Reason)
+	}
+	zapLogger.Info(prefix+"Applied golden kubeconfig", zap.String("source", source),
+		zap.Int("added", len(diff.Added)), zap.Int("updated", len(diff.Updated)),
+		zap.Int("removed", len(diff.Removed)), zap.Int("skipped", len(diff.Skipped)))
+	return diff
+}
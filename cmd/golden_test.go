@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate_GoldenKubeconfig(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "me", rancher.Cluster{ID: "c-prod", Name: "prod"})
+
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "config")
+	goldenPath := filepath.Join(dir, "golden.yaml")
+	require.NoError(t, os.WriteFile(goldenPath, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://rancher.example.com/k8s/clusters/c-prod
+contexts:
+- name: eu-prod
+  context:
+    cluster: prod
+    user: someone-else
+    namespace: apps
+`), 0600))
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("GOLDEN_KUBECONFIG", "")
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--server", server.URL, "--user", "admin", "-c", kubeconfigPath, "--auto-create",
+		"--state-file", filepath.Join(dir, "state.json"), "--golden-kubeconfig", goldenPath})
+	require.NoError(t, cmd.Execute())
+
+	saved, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	require.NoError(t, err)
+	require.Contains(t, saved.Contexts, "eu-prod")
+	assert.Equal(t, "prod", saved.Contexts["eu-prod"].AuthInfo, "the golden context uses the token of this run")
+	assert.Equal(t, "apps", saved.Contexts["eu-prod"].Namespace)
+	assert.Equal(t, "kubeconfig-u-me:secret", saved.AuthInfos["prod"].Token)
+	assert.NotContains(t, saved.AuthInfos, "someone-else")
+}
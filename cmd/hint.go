@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/appdir"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// hints recognize common failures and tell what to change, naming the flag or environment
+// variable. They are tried in order; the first that returns a hint wins.
+var hints = []func(err error) string{
+	noHomeDirHint,
+	noAppDirHint,
+	kubeconfigDirectoryHint,
+	unknownAuthorityHint,
+	loginRejectedHint,
+	kubeconfigForbiddenHint,
+}
+
+// Hint returns what to change to fix err, or "" if err is not a known failure.
+func Hint(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, hint := range hints {
+		if h := hint(err); h != "" {
+			return h
+		}
+	}
+	return ""
+}
+
+// hintField returns a log field with the hint for err, or a field that logs nothing
+func hintField(err error) zap.Field {
+	if h := Hint(err); h != "" {
+		return zap.String("hint", h)
+	}
+	return zap.Skip()
+}
+
+// noHomeDirHint recognizes a default kubeconfig path on a machine without a home directory,
+// e.g. a scratch or distroless container
+func noHomeDirHint(err error) string {
+	if !errors.Is(err, kubeconfig.ErrNoHomeDir) {
+		return ""
+	}
+	return "There is no home directory to find ~/.kube/config in (typical for containers without a passwd entry): " +
+		"pass the kubeconfig path with --config or KUBECONFIG, e.g. KUBECONFIG=/config/kubeconfig"
+}
+
+// noAppDirHint recognizes a missing cache directory for the state file, run history and stored secrets
+func noAppDirHint(err error) string {
+	if !errors.Is(err, appdir.ErrNoDir) {
+		return ""
+	}
+	return "There is no user cache directory for the state file, run history and stored secrets (typical for containers without a home directory): " +
+		"pass a writable directory with --state-dir or STATE_DIR, e.g. STATE_DIR=/data"
+}
+
+// kubeconfigDirectoryHint recognizes a kubeconfig path, usually from KUBECONFIG, that is a directory
+func kubeconfigDirectoryHint(err error) string {
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) {
+		return ""
+	}
+	if info, statErr := os.Stat(pathErr.Path); statErr != nil || !info.IsDir() {
+		return ""
+	}
+	return fmt.Sprintf("%s is a directory, not a kubeconfig file: point --config or KUBECONFIG at a file in it, e.g. KUBECONFIG=%s",
+		pathErr.Path, filepath.Join(pathErr.Path, "config"))
+}
+
+// unknownAuthorityHint recognizes a Rancher certificate signed by a CA the system doesn't trust
+func unknownAuthorityHint(err error) string {
+	var authorityErr x509.UnknownAuthorityError
+	if !errors.As(err, &authorityErr) && !strings.Contains(err.Error(), "certificate signed by unknown authority") {
+		return ""
+	}
+	return "Rancher's certificate is signed by a CA this machine doesn't trust: add the CA certificate to the system trust store " +
+		"(on Linux, SSL_CERT_FILE=/path/to/ca.pem works too), or for testing only pass --insecure-skip-tls-verify (RANCHER_INSECURE_SKIP_TLS_VERIFY=true)"
+}
+
+// loginRejectedHint recognizes a login Rancher rejected with 401 Unauthorized
+func loginRejectedHint(err error) string {
+	if !strings.Contains(err.Error(), "login failed with status 401") {
+		return ""
+	}
+	return "Rancher rejected the username or password: check --user (RANCHER_USERNAME) and --password (RANCHER_PASSWORD); " +
+		"users of LDAP or Active Directory need --auth-type ldap (RANCHER_AUTH_TYPE)"
+}
+
+// kubeconfigForbiddenHint recognizes a generateKubeconfig request Rancher refused with 403 Forbidden
+func kubeconfigForbiddenHint(err error) string {
+	if !strings.Contains(err.Error(), "failed to get kubeconfig, status 403") {
+		return ""
+	}
+	return "Your Rancher user may not generate kubeconfigs for this cluster: ask a Rancher admin to make you a member of it, " +
+		"or leave it out with --cluster"
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"rancher-kubeconfig-updater/internal/appdir"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// statusServer returns a server answering every request with status
+func statusServer(t *testing.T, status int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"type":"error","status":"` + fmt.Sprint(status) + `"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHint(t *testing.T) {
+	_, dirErr := kubeconfig.LoadKubeconfig(t.TempDir())
+	require.Error(t, dirErr)
+
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	_, tlsErr := rancher.NewClient(tlsServer.URL, "admin", []byte("password"), rancher.AuthTypeLocal, zap.NewNop(), false)
+	require.Error(t, tlsErr)
+
+	_, loginErr := rancher.NewClient(statusServer(t, http.StatusUnauthorized).URL, "admin", []byte("password"), rancher.AuthTypeLocal, zap.NewNop(), false)
+	require.Error(t, loginErr)
+
+	client := rancher.NewClientWithToken(statusServer(t, http.StatusForbidden).URL, "token-abc:secret", zap.NewNop(), false)
+	_, forbiddenErr := client.GetClusterKubeconfig("c-prod")
+	require.Error(t, forbiddenErr)
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"no home directory", fmt.Errorf("failed to load kubeconfig file: %w", kubeconfig.ErrNoHomeDir), "--config or KUBECONFIG"},
+		{"no state directory", fmt.Errorf("failed to locate secret store: %w", appdir.ErrNoDir), "--state-dir or STATE_DIR"},
+		{"kubeconfig is a directory", dirErr, "KUBECONFIG="},
+		{"unknown certificate authority", fmt.Errorf("failed to authenticate with Rancher: %w", tlsErr), "--insecure-skip-tls-verify"},
+		{"login rejected", fmt.Errorf("failed to authenticate with Rancher: %w", loginErr), "--password (RANCHER_PASSWORD)"},
+		{"kubeconfig forbidden", forbiddenErr, "--cluster"},
+		{"unknown failure", errors.New("failed to list clusters, status 500: boom"), ""},
+		{"no error", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hint := Hint(tt.err)
+			if tt.want == "" {
+				assert.Empty(t, hint)
+			} else {
+				assert.Contains(t, hint, tt.want)
+			}
+		})
+	}
+}
+
+func TestHintField(t *testing.T) {
+	enc := zapcore.NewMapObjectEncoder()
+	hintField(errors.New("login failed with status 401: unauthorized")).AddTo(enc)
+	assert.Contains(t, enc.Fields["hint"], "RANCHER_USERNAME")
+
+	enc = zapcore.NewMapObjectEncoder()
+	hintField(errors.New("boom")).AddTo(enc)
+	assert.Empty(t, enc.Fields)
+}
@@ -0,0 +1,375 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/history"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"rancher-kubeconfig-updater/internal/state"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewLastRunCmd creates the command that shows the report of the latest run.
+func NewLastRunCmd() *cobra.Command {
+	lastRunCmd := &cobra.Command{
+		Use:   "last-run",
+		Short: "Show what the latest run did to each cluster and why",
+		Long: "Shows the report of the latest run, read from the history next to the state file:\n" +
+			"its outcome, the result of each cluster with the reason, the names of replaced tokens,\n" +
+			"and the errors it logged. Scheduled runs and daemon mode record their runs too.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runLastRun,
+	}
+
+	lastRunCmd.Flags().String("format", "text", "Output format: 'text' or 'json'")
+	lastRunCmd.Flags().String("state-file", "", "Path to the state file; the history is kept next to it (default: in the user cache directory)")
+
+	return lastRunCmd
+}
+
+// NewHistoryCmd creates the command that lists the recorded runs.
+func NewHistoryCmd() *cobra.Command {
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "List the outcomes of previous runs",
+		Long: "Lists the recorded runs, newest first, with their outcome and how many clusters were\n" +
+			"updated, skipped or failed. With --cluster, shows what each run did to that cluster,\n" +
+			"e.g. to find out when its token was last rotated and why.\n" +
+			"The last " + fmt.Sprint(history.Keep) + " runs are kept.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runHistory,
+	}
+
+	historyCmd.Flags().String("cluster", "", "Show the result of this cluster (context name or cluster ID) in each run")
+	historyCmd.Flags().Int("limit", 20, "Show at most this many runs (0 for all)")
+	historyCmd.Flags().String("format", "text", "Output format: 'text' or 'json'")
+	historyCmd.Flags().String("state-file", "", "Path to the state file; the history is kept next to it (default: in the user cache directory)")
+
+	return historyCmd
+}
+
+func runLastRun(cmd *cobra.Command, args []string) error {
+	format, err := historyFormat(cmd)
+	if err != nil {
+		return err
+	}
+	runs, err := loadHistory(cmd)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		_, err := fmt.Fprintln(cmd.OutOrStdout(), "No runs recorded yet")
+		return err
+	}
+	last := runs[len(runs)-1]
+	if format == "json" {
+		return writeJSON(cmd.OutOrStdout(), last)
+	}
+	return writeRunText(cmd.OutOrStdout(), last)
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	format, err := historyFormat(cmd)
+	if err != nil {
+		return err
+	}
+	limit, _ := cmd.Flags().GetInt("limit")
+	if limit < 0 {
+		return fmt.Errorf("invalid limit %d. Must not be negative", limit)
+	}
+	cluster, _ := cmd.Flags().GetString("cluster")
+
+	runs, err := loadHistory(cmd)
+	if err != nil {
+		return err
+	}
+	// Newest first
+	recent := make([]history.Run, 0, len(runs))
+	for i := len(runs) - 1; i >= 0; i-- {
+		if cluster != "" && !hasCluster(runs[i], cluster) {
+			continue
+		}
+		recent = append(recent, runs[i])
+		if len(recent) == limit {
+			break
+		}
+	}
+
+	if format == "json" {
+		if cluster != "" {
+			for i := range recent {
+				recent[i].Clusters = clusterResults(recent[i], cluster)
+			}
+		}
+		return writeJSON(cmd.OutOrStdout(), recent)
+	}
+	if len(recent) == 0 {
+		if cluster != "" {
+			_, err := fmt.Fprintf(cmd.OutOrStdout(), "No runs recorded for cluster %s\n", cluster)
+			return err
+		}
+		_, err := fmt.Fprintln(cmd.OutOrStdout(), "No runs recorded yet")
+		return err
+	}
+	if cluster != "" {
+		return writeClusterHistoryText(cmd.OutOrStdout(), recent, cluster)
+	}
+	return writeHistoryText(cmd.OutOrStdout(), recent)
+}
+
+// historyFormat returns the --format of last-run and history
+func historyFormat(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("format")
+	if format != "text" && format != "json" {
+		return "", fmt.Errorf("invalid format %q. Must be 'text' or 'json'", format)
+	}
+	return format, nil
+}
+
+// loadHistory reads the runs recorded next to the state file, oldest first
+func loadHistory(cmd *cobra.Command) ([]history.Run, error) {
+	path, err := historyPath(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return history.Load(path)
+}
+
+// historyPath returns the history file next to the state file of --state-file or the default one
+func historyPath(cmd *cobra.Command) (string, error) {
+	statePath := config.GetConfig(cmd, "state-file", "STATE_FILE")
+	if statePath == "" {
+		var err error
+		if statePath, err = state.DefaultPath(); err != nil {
+			return "", err
+		}
+	}
+	return history.PathFor(statePath), nil
+}
+
+// saveRun appends run to the history file. Failures are only logged: the history must never
+// fail a run that did its work.
+func saveRun(cmd *cobra.Command, run history.Run, zapLogger *zap.Logger) {
+	if readonly.Enabled() {
+		zapLogger.Debug("Read-only mode, run is not recorded")
+		return
+	}
+	path, err := historyPath(cmd)
+	if err != nil {
+		zapLogger.Warn("Failed to locate run history", zap.Error(err))
+		return
+	}
+	runs, err := history.Load(path)
+	if err != nil {
+		// A damaged history is started over rather than growing unreadable
+		zapLogger.Warn("Failed to read run history, starting a new one", zap.String("path", path), zap.Error(err))
+		runs = nil
+	}
+	data, err := history.Encode(append(runs, run))
+	if err != nil {
+		zapLogger.Warn("Failed to record run", zap.Error(err))
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		zapLogger.Warn("Failed to record run", zap.String("path", path), zap.Error(err))
+		return
+	}
+	tx := kubeconfig.NewTransaction()
+	tx.Stage(path, data, 0600)
+	if err := tx.Commit(); err != nil {
+		zapLogger.Warn("Failed to record run", zap.String("path", path), zap.Error(err))
+	}
+}
+
+// recordErrors returns zapLogger that also records every error it logs in record, so the run
+// report keeps errors that are not tied to a cluster, like a failed login
+func recordErrors(zapLogger *zap.Logger, record *history.Recorder) *zap.Logger {
+	return zapLogger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, &errorRecorderCore{record: record})
+	}))
+}
+
+// errorRecorderCore is a zapcore.Core that records the message and error of every entry at
+// error level or above in a history.Recorder
+type errorRecorderCore struct {
+	record  *history.Recorder
+	context []zapcore.Field
+}
+
+// Enabled tells whether entries at level are recorded
+func (c *errorRecorderCore) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.ErrorLevel
+}
+
+// With returns a core that also looks for the error in fields
+func (c *errorRecorderCore) With(fields []zapcore.Field) zapcore.Core {
+	return &errorRecorderCore{record: c.record, context: append(append([]zapcore.Field(nil), c.context...), fields...)}
+}
+
+// Check adds the core to ce if the entry's level is enabled
+func (c *errorRecorderCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+// Write records the message with the error field of the entry or its logger, if any
+func (c *errorRecorderCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range append(append([]zapcore.Field(nil), c.context...), fields...) {
+		field.AddTo(enc)
+	}
+	message := entry.Message
+	if err, ok := enc.Fields["error"].(string); ok {
+		message += ": " + err
+	}
+	c.record.Error(logger.Redact(message))
+	return nil
+}
+
+// Sync does nothing, entries are recorded in memory
+func (c *errorRecorderCore) Sync() error {
+	return nil
+}
+
+// hasCluster tells whether run has a result for cluster, by context name or cluster ID
+func hasCluster(run history.Run, cluster string) bool {
+	return len(clusterResults(run, cluster)) > 0
+}
+
+// clusterResults returns the results of run for cluster, by context name or cluster ID
+func clusterResults(run history.Run, cluster string) []history.Cluster {
+	var results []history.Cluster
+	for _, c := range run.Clusters {
+		if c.Cluster == cluster || (c.ClusterID != "" && c.ClusterID == cluster) {
+			results = append(results, c)
+		}
+	}
+	return results
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// runTime formats the start of a run in local time
+func runTime(run history.Run) string {
+	return run.StartedAt.Local().Format("2006-01-02 15:04:05")
+}
+
+// runOutcome returns the outcome of run, marked for dry runs
+func runOutcome(run history.Run) string {
+	if run.DryRun {
+		return run.Outcome + " (dry run)"
+	}
+	return run.Outcome
+}
+
+// writeRunText prints the report of run followed by a table of its clusters and its errors
+func writeRunText(w io.Writer, run history.Run) error {
+	_, _ = fmt.Fprintf(w, "Run %s at %s (took %s): %s\n", run.ID, runTime(run),
+		run.FinishedAt.Sub(run.StartedAt).Round(time.Second), runOutcome(run))
+	if run.Kubeconfig != "" {
+		_, _ = fmt.Fprintf(w, "Kubeconfig: %s (saved: %t)\n", run.Kubeconfig, run.Saved)
+	}
+	if len(run.Servers) > 0 {
+		_, _ = fmt.Fprintf(w, "Rancher: %s\n", strings.Join(run.Servers, ", "))
+	}
+
+	if len(run.Clusters) > 0 {
+		_, _ = fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "CLUSTER\tRESULT\tREASON\tTOKEN")
+		for _, c := range run.Clusters {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Cluster, c.Result, orDash(clusterReason(c)), orDash(tokenChange(c)))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(run.Errors) > 0 {
+		_, _ = fmt.Fprintln(w, "\nErrors:")
+		for _, e := range run.Errors {
+			_, _ = fmt.Fprintf(w, "  %s\n", e)
+		}
+	}
+	return nil
+}
+
+// writeHistoryText prints one line per run
+func writeHistoryText(w io.Writer, runs []history.Run) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "STARTED\tRUN\tOUTCOME\tUPDATED\tSKIPPED\tFAILED\tERRORS")
+	for _, run := range runs {
+		counts := make(map[string]int)
+		for _, c := range run.Clusters {
+			counts[c.Result]++
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\n", runTime(run), run.ID, runOutcome(run),
+			counts[history.ResultUpdated]+counts[history.ResultCreated], counts[history.ResultSkipped], counts[history.ResultFailed], len(run.Errors))
+	}
+	return tw.Flush()
+}
+
+// writeClusterHistoryText prints the result of cluster in each run
+func writeClusterHistoryText(w io.Writer, runs []history.Run, cluster string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "STARTED\tRUN\tRESULT\tREASON\tTOKEN")
+	for _, run := range runs {
+		for _, c := range clusterResults(run, cluster) {
+			result := c.Result
+			if run.DryRun {
+				result += " (dry run)"
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", runTime(run), run.ID, result, orDash(clusterReason(c)), orDash(tokenChange(c)))
+		}
+	}
+	return tw.Flush()
+}
+
+// clusterReason returns why the cluster got its result: the reason, or the error of a failure
+func clusterReason(c history.Cluster) string {
+	if c.Error != "" {
+		return c.Error
+	}
+	return c.Reason
+}
+
+// tokenChange describes the token names of a replaced token, e.g. "kubeconfig-a -> kubeconfig-b"
+func tokenChange(c history.Cluster) string {
+	switch {
+	case c.OldTokenName != "" && c.NewTokenName != "":
+		return c.OldTokenName + " -> " + c.NewTokenName
+	case c.NewTokenName != "":
+		return c.NewTokenName
+	default:
+		return c.OldTokenName
+	}
+}
+
+// orDash returns s, or "-" when it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/history"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestUpdate_RecordsRun(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "east", rancher.Cluster{ID: "c-east", Name: "east"})
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--server", server.URL, "--user", "admin", "--auto-create", "-c", filepath.Join(dir, "config"), "--state-file", statePath})
+	require.NoError(t, cmd.Execute())
+
+	runs, err := history.Load(history.PathFor(statePath))
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, history.OutcomeSucceeded, runs[0].Outcome)
+	assert.True(t, runs[0].Saved)
+	assert.Equal(t, []string{server.URL}, runs[0].Servers)
+	assert.Equal(t, []history.Cluster{{Cluster: "east", ClusterID: "c-east", Result: history.ResultCreated, Reason: "new_context"}}, runs[0].Clusters)
+
+	var out bytes.Buffer
+	cmd = NewRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"last-run", "--state-file", statePath})
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "Run "+runs[0].ID)
+	assert.Contains(t, out.String(), "succeeded")
+	assert.Contains(t, out.String(), "east")
+}
+
+func TestUpdate_RecordsFailedLogin(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	down := closedAddress(t)
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--server", "http://" + down, "--user", "admin", "-c", filepath.Join(dir, "config"), "--state-file", statePath})
+	require.NoError(t, cmd.Execute())
+
+	runs, err := history.Load(history.PathFor(statePath))
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, history.OutcomeFailed, runs[0].Outcome)
+	assert.False(t, runs[0].Saved)
+	require.NotEmpty(t, runs[0].Errors)
+	assert.Contains(t, runs[0].Errors[0], "connection refused")
+}
+
+// writeHistory writes runs to the history file next to a state file in a new directory and
+// returns the state file
+func writeHistory(t *testing.T, runs ...history.Run) string {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	data, err := history.Encode(runs)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(history.PathFor(statePath), data, 0600))
+	return statePath
+}
+
+func TestHistoryCmd(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	statePath := writeHistory(t,
+		history.Run{ID: "run-1", StartedAt: start, Outcome: history.OutcomeSucceeded, Saved: true, Clusters: []history.Cluster{
+			{Cluster: "prod", ClusterID: "c-prod", Result: history.ResultUpdated, Reason: "expiring_soon", OldTokenName: "kubeconfig-u-a", NewTokenName: "kubeconfig-u-b"},
+			{Cluster: "dev", ClusterID: "c-dev", Result: history.ResultSkipped, Reason: "token_valid"},
+		}},
+		history.Run{ID: "run-2", StartedAt: start.Add(24 * time.Hour), Outcome: history.OutcomePartial, Saved: true, Clusters: []history.Cluster{
+			{Cluster: "prod", ClusterID: "c-prod", Result: history.ResultSkipped, Reason: "token_valid"},
+			{Cluster: "dev", ClusterID: "c-dev", Result: history.ResultFailed, Error: "403 Forbidden"},
+		}, Errors: []string{"Failed to process cluster: 403 Forbidden"}},
+		history.Run{ID: "run-3", StartedAt: start.Add(48 * time.Hour), Outcome: history.OutcomeFailed, Errors: []string{"Failed to log in"}, Clusters: []history.Cluster{}},
+	)
+
+	execute := func(args ...string) string {
+		var out bytes.Buffer
+		cmd := NewRootCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs(append(args, "--state-file", statePath))
+		require.NoError(t, cmd.Execute())
+		return out.String()
+	}
+
+	out := execute("history")
+	assert.Regexp(t, `(?s)run-3\s+failed\s+0\s+0\s+0\s+1.*run-2\s+partial\s+0\s+1\s+1\s+1.*run-1\s+succeeded\s+1\s+1\s+0\s+0`, out)
+
+	out = execute("history", "--limit", "1")
+	assert.Contains(t, out, "run-3")
+	assert.NotContains(t, out, "run-2")
+
+	out = execute("history", "--cluster", "c-prod")
+	assert.Regexp(t, `(?s)run-2\s+skipped\s+token_valid.*run-1\s+updated\s+expiring_soon\s+kubeconfig-u-a -> kubeconfig-u-b`, out)
+	assert.NotContains(t, out, "run-3")
+
+	var runs []history.Run
+	require.NoError(t, json.Unmarshal([]byte(execute("history", "--cluster", "dev", "--format", "json")), &runs))
+	require.Len(t, runs, 2)
+	assert.Equal(t, []history.Cluster{{Cluster: "dev", ClusterID: "c-dev", Result: history.ResultFailed, Error: "403 Forbidden"}}, runs[0].Clusters)
+
+	out = execute("last-run")
+	assert.Contains(t, out, "Run run-3")
+	assert.Contains(t, out, "Failed to log in")
+
+	var last history.Run
+	require.NoError(t, json.Unmarshal([]byte(execute("last-run", "--format", "json")), &last))
+	assert.Equal(t, "run-3", last.ID)
+}
+
+func TestHistoryCmd_Empty(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	for _, name := range []string{"history", "last-run"} {
+		var out bytes.Buffer
+		cmd := NewRootCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs([]string{name, "--state-file", statePath})
+		require.NoError(t, cmd.Execute())
+		assert.Equal(t, "No runs recorded yet\n", out.String())
+	}
+}
+
+func TestRecordErrors(t *testing.T) {
+	record := history.NewRecorder("run", time.Now(), false)
+	zapLogger := recordErrors(zap.NewNop(), record).With(zap.Error(errors.New("dial tcp: connection refused")))
+	zapLogger.Warn("Retrying")
+	zapLogger.Error("Failed to log in")
+	zapLogger.Error("Failed to save kubeconfig", zap.Error(errors.New("disk full: token-abc:leakedsecret")))
+
+	run := record.Finish(nil, time.Now())
+	assert.Equal(t, []string{"Failed to log in: dial tcp: connection refused", "Failed to save kubeconfig: disk full: token-abc:[REDACTED]"}, run.Errors)
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/status"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// NewListCmd creates the read-only command that lists Rancher's clusters with their kubeconfig entries.
+func NewListCmd() *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the Rancher clusters, whether the kubeconfig has an entry and when its token expires",
+		Long: "Lists every cluster of the Rancher server, whether the kubeconfig has an entry for it\n" +
+			"and, if so, when the entry's token expires and how many days are left. Unlike status,\n" +
+			"which starts from the kubeconfig, clusters without an entry are listed too, with\n" +
+			"their description, Kubernetes version, provider and node count.\n" +
+			"The kubeconfig is never modified.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runList,
+	}
+
+	listCmd.Flags().StringP("config", "c", "", "Path to kubeconfig file (default: ~/.kube/config)")
+	listCmd.Flags().StringP("output", "o", "table", "Output format: 'table', 'json' or 'yaml'")
+	addRancherFlags(listCmd)
+
+	return listCmd
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the list, so logs go to stderr
+	zapLogger := logger.NewLoggerWithWriter(os.Stderr, zapcore.WarnLevel)
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	output, _ := cmd.Flags().GetString("output")
+	if output != "table" && output != "json" && output != "yaml" {
+		return fmt.Errorf("invalid output %q. Must be 'table', 'json' or 'yaml'", output)
+	}
+	kubeconfigPath, _ := cmd.Flags().GetString("config")
+	kubecfg, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig file: %w", err)
+	}
+
+	client, rancherURL, err := newRancherClient(cmd, zapLogger)
+	if err != nil {
+		return err
+	}
+	clusters, err := client.ListClusters()
+	if err != nil {
+		return fmt.Errorf("failed to list clusters: %w", err)
+	}
+	list := status.ListClusters(status.Collect(kubecfg, rancherURL, client), clusters, time.Now())
+
+	switch output {
+	case "json":
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	case "yaml":
+		enc := yaml.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent(2)
+		if err := enc.Encode(list); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return writeListTable(cmd.OutOrStdout(), list)
+	}
+}
+
+// writeListTable prints the clusters as an aligned table
+func writeListTable(w io.Writer, list []status.ClusterStatus) error {
+	if len(list) == 0 {
+		_, err := fmt.Fprintln(w, i18n.T(i18n.ListEmpty))
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, i18n.T(i18n.ListHeader))
+	for _, s := range list {
+		inKubeconfig, expires, daysLeft := i18n.T(i18n.ListNo), "-", "-"
+		if s.InKubeconfig {
+			inKubeconfig = i18n.T(i18n.ListYes)
+			expires = i18n.T(i18n.ListUnknown)
+			if s.Error != "" {
+				expires += ": " + s.Error
+			}
+		}
+		switch {
+		case s.NeverExpires:
+			expires = i18n.T(i18n.ListNever)
+		case !s.ExpiresAt.IsZero():
+			expires = s.ExpiresAt.Format(time.RFC3339)
+		}
+		if s.DaysLeft != nil {
+			daysLeft = strconv.Itoa(*s.DaysLeft)
+		}
+		nodes := "-"
+		if s.NodeCount > 0 {
+			nodes = strconv.Itoa(s.NodeCount)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Cluster, s.ClusterID, orDash(s.KubernetesVersion),
+			orDash(s.Provider), nodes, inKubeconfig, orDash(s.Context), expires, daysLeft, orDash(s.Description))
+	}
+	return tw.Flush()
+}
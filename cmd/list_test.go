@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/status"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestListCmd_InvalidOutput(t *testing.T) {
+	cmd := NewListCmd()
+	cmd.SetArgs([]string{"--output", "csv"})
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid output "csv"`)
+}
+
+func TestListCmd_YAML(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "admin", rancher.Cluster{ID: "c-prod", Name: "prod"}, rancher.Cluster{ID: "c-new", Name: "new"})
+	kubeconfigPath := filepath.Join(t.TempDir(), "config")
+	entry := strings.Replace(generatedKubeconfig("prod", "c-prod", "kubeconfig-u-admin:secret"), "https://rancher.example.com", server.URL, 1)
+	require.NoError(t, os.WriteFile(kubeconfigPath, []byte(entry), 0600))
+
+	t.Setenv("RANCHER_URL", server.URL)
+	t.Setenv("RANCHER_USERNAME", "admin")
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	cmd := NewListCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"-c", kubeconfigPath, "-o", "yaml"})
+	require.NoError(t, cmd.Execute())
+
+	var list []status.ClusterStatus
+	require.NoError(t, yaml.Unmarshal(out.Bytes(), &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "new", list[0].Cluster)
+	assert.False(t, list[0].InKubeconfig)
+	assert.Equal(t, "prod", list[1].Cluster)
+	assert.True(t, list[1].InKubeconfig)
+	assert.Equal(t, "prod", list[1].Context)
+	assert.NotEmpty(t, list[1].Error, "the stub doesn't know the token")
+}
+
+func TestWriteListTable(t *testing.T) {
+	days := 3
+	var buf bytes.Buffer
+	err := writeListTable(&buf, []status.ClusterStatus{
+		{Cluster: "dev", ClusterID: "c-dev", InKubeconfig: true, Context: "dev", NeverExpires: true},
+		{Cluster: "new", ClusterID: "c-new", KubernetesVersion: "v1.30.4+rke2r1", Provider: "rke2", NodeCount: 3, Description: "Staging"},
+		{Cluster: "prod", ClusterID: "c-prod", InKubeconfig: true, Context: "prod", ExpiresAt: time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC), DaysLeft: &days},
+		{Cluster: "test", ClusterID: "c-test", InKubeconfig: true, Context: "test"},
+	})
+	require.NoError(t, err)
+
+	output := buf.String()
+	assert.Contains(t, output, "IN KUBECONFIG")
+	assert.Regexp(t, `dev\s+c-dev\s+-\s+-\s+-\s+yes\s+dev\s+never\s+-\s+-\n`, output)
+	assert.Regexp(t, `new\s+c-new\s+v1\.30\.4\+rke2r1\s+rke2\s+3\s+no\s+-\s+-\s+-\s+Staging\n`, output)
+	assert.Regexp(t, `prod\s+c-prod\s+-\s+-\s+-\s+yes\s+prod\s+2026-03-04T12:00:00Z\s+3\s+-\n`, output)
+	assert.Regexp(t, `test\s+c-test\s+-\s+-\s+-\s+yes\s+test\s+unknown\s+-\s+-\n`, output, "no trailing colon without an error")
+
+	buf.Reset()
+	require.NoError(t, writeListTable(&buf, nil))
+	assert.Contains(t, buf.String(), "No clusters found")
+}
+
+func TestWriteListTable_Translated(t *testing.T) {
+	i18n.SetLanguage(i18n.TraditionalChinese)
+	t.Cleanup(func() { i18n.SetLanguage(i18n.English) })
+
+	var buf bytes.Buffer
+	require.NoError(t, writeListTable(&buf, []status.ClusterStatus{{Cluster: "dev", ClusterID: "c-dev", InKubeconfig: true, Context: "dev", NeverExpires: true}}))
+	assert.Contains(t, buf.String(), "剩餘天數")
+	assert.Regexp(t, `dev\s+c-dev\s+-\s+-\s+-\s+是\s+dev\s+永不\s+-\s+-\n`, buf.String())
+}
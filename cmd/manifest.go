@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/manifest"
+	"rancher-kubeconfig-updater/internal/readonly"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// defaultManifestSecret is the Secret a manifest creates unless --manifest-secret says otherwise
+const defaultManifestSecret = "default/rancher-kubeconfig"
+
+// addManifestFlags registers the flags that export the kubeconfig as a Kubernetes manifest
+func addManifestFlags(cmd *cobra.Command) {
+	cmd.Flags().String("manifest", "", "Also write the refreshed kubeconfig as a Kubernetes manifest to this file ('-' for stdout)")
+	cmd.Flags().String("manifest-format", "", "Manifest kind: 'secret' (default), 'sealed-secret' (needs --seal-cert) or 'external-secret' (needs --output and --secret-store)")
+	cmd.Flags().String("manifest-secret", "", "Namespace and name of the Secret the manifest creates (default: "+defaultManifestSecret+")")
+	cmd.Flags().String("seal-cert", "", "Certificate of the sealed-secrets controller, as printed by kubeseal --fetch-cert")
+	cmd.Flags().String("secret-store", "", "SecretStore the ExternalSecret reads the --output secret from: NAME or ClusterSecretStore/NAME")
+}
+
+// manifestExport is a validated --manifest request
+type manifestExport struct {
+	path   string
+	format manifest.Format
+	target manifest.Target
+	// sealKey encrypts sealed-secret manifests
+	sealKey *rsa.PublicKey
+	// store and remoteKey locate the kubeconfig for external-secret manifests
+	store     manifest.StoreRef
+	remoteKey string
+}
+
+// resolveManifestExport reads and validates the manifest settings. A nil result means no
+// manifest was requested.
+func resolveManifestExport(cmd *cobra.Command, output *secretOutput) (*manifestExport, error) {
+	path := config.GetConfig(cmd, "manifest", "MANIFEST")
+	if path == "" {
+		return nil, nil
+	}
+
+	format, err := manifest.ParseFormat(config.GetConfig(cmd, "manifest-format", "MANIFEST_FORMAT"))
+	if err != nil {
+		return nil, err
+	}
+	secret := config.GetConfig(cmd, "manifest-secret", "MANIFEST_SECRET")
+	if secret == "" {
+		secret = defaultManifestSecret
+	}
+	target, err := manifest.ParseTarget(secret)
+	if err != nil {
+		return nil, err
+	}
+	m := &manifestExport{path: path, format: format, target: target}
+
+	switch format {
+	case manifest.FormatSealedSecret:
+		certPath := config.GetConfig(cmd, "seal-cert", "SEAL_CERT")
+		if certPath == "" {
+			return nil, errors.New("--manifest-format sealed-secret needs the controller certificate: pass --seal-cert or set SEAL_CERT")
+		}
+		certPEM, err := os.ReadFile(certPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sealing certificate: %w", err)
+		}
+		if m.sealKey, err = manifest.ParseSealingKey(certPEM); err != nil {
+			return nil, fmt.Errorf("invalid sealing certificate %s: %w", certPath, err)
+		}
+	case manifest.FormatExternalSecret:
+		if output == nil {
+			return nil, errors.New("--manifest-format external-secret reads the kubeconfig from a secret manager: pass --output as well")
+		}
+		store := config.GetConfig(cmd, "secret-store", "SECRET_STORE")
+		if store == "" {
+			return nil, errors.New("--manifest-format external-secret needs the secret store: pass --secret-store or set SECRET_STORE")
+		}
+		if m.store, err = manifest.ParseStoreRef(store); err != nil {
+			return nil, err
+		}
+		m.remoteKey = output.secret.name()
+	}
+	return m, nil
+}
+
+// write renders the manifest for kubecfg and writes it to the requested file or stdout
+func (m *manifestExport) write(kubecfg *api.Config) error {
+	var doc []byte
+	if m.format == manifest.FormatExternalSecret {
+		var err error
+		if doc, err = manifest.ExternalSecret(m.target, m.store, m.remoteKey); err != nil {
+			return err
+		}
+	} else {
+		data, err := clientcmd.Write(*kubecfg)
+		if err != nil {
+			return fmt.Errorf("failed to serialize kubeconfig: %w", err)
+		}
+		defer clear(data)
+		if m.format == manifest.FormatSealedSecret {
+			doc, err = manifest.SealedSecret(m.target, data, m.sealKey)
+		} else {
+			doc, err = manifest.Secret(m.target, data)
+		}
+		if err != nil {
+			return err
+		}
+		defer clear(doc)
+	}
+
+	if m.path == "-" {
+		_, err := os.Stdout.Write(doc)
+		return err
+	}
+	if err := readonly.Check(m.path); err != nil {
+		return err
+	}
+	// A plain Secret holds the tokens, so the file is private like the kubeconfig
+	if err := os.WriteFile(m.path, doc, 0600); err != nil {
+		return fmt.Errorf("failed to write manifest file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/azkv"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// newManifestTestCmd returns a command with the manifest flags parsed from args and the manifest env vars cleared
+func newManifestTestCmd(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	for _, env := range []string{"MANIFEST", "MANIFEST_FORMAT", "MANIFEST_SECRET", "SEAL_CERT", "SECRET_STORE"} {
+		t.Setenv(env, "")
+	}
+	cmd := &cobra.Command{Use: "test"}
+	addManifestFlags(cmd)
+	_ = cmd.ParseFlags(args)
+	return cmd
+}
+
+func TestResolveManifestExport(t *testing.T) {
+	m, err := resolveManifestExport(newManifestTestCmd(t), nil)
+	require.NoError(t, err)
+	assert.Nil(t, m, "no manifest without --manifest")
+
+	m, err = resolveManifestExport(newManifestTestCmd(t, "--manifest", "out.yaml", "--manifest-secret", "ci/kube"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ci", m.target.Namespace)
+
+	output := &secretOutput{ref: "azkv://vault/kubeconfig", secret: azureSecret{ref: azkv.Ref{Name: "kubeconfig"}}}
+	m, err = resolveManifestExport(newManifestTestCmd(t, "--manifest", "-", "--manifest-format", "external-secret", "--secret-store", "azure"), output)
+	require.NoError(t, err)
+	assert.Equal(t, "kubeconfig", m.remoteKey)
+}
+
+func TestResolveManifestExport_Invalid(t *testing.T) {
+	for name, args := range map[string][]string{
+		"unknown format":                  {"--manifest", "-", "--manifest-format", "helm"},
+		"sealed without certificate":      {"--manifest", "-", "--manifest-format", "sealed-secret"},
+		"sealed with unreadable cert":     {"--manifest", "-", "--manifest-format", "sealed-secret", "--seal-cert", "/nonexistent"},
+		"external without secret manager": {"--manifest", "-", "--manifest-format", "external-secret", "--secret-store", "s"},
+		"bad secret name":                 {"--manifest", "-", "--manifest-secret", "a/b/c"},
+	} {
+		_, err := resolveManifestExport(newManifestTestCmd(t, args...), nil)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestManifestExport_WriteSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.yaml")
+	m, err := resolveManifestExport(newManifestTestCmd(t, "--manifest", path), nil)
+	require.NoError(t, err)
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-abc:secret"}
+	require.NoError(t, m.write(kubecfg))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "kind: Secret")
+	assert.Contains(t, string(data), "name: rancher-kubeconfig")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	if filepath.Separator == '/' {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
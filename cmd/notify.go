@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/notify"
+	"rancher-kubeconfig-updater/internal/rancher"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// loadNotifyConfig reads the --notify-config file and adds the desktop with --notify desktop,
+// or returns nil when notifications are off
+func loadNotifyConfig(cmd *cobra.Command) (*notify.Config, error) {
+	var cfg *notify.Config
+	if path := config.GetConfig(cmd, "notify-config", "NOTIFY_CONFIG"); path != "" {
+		var err error
+		if cfg, err = notify.Load(path); err != nil {
+			return nil, err
+		}
+	}
+	switch target := config.GetConfig(cmd, "notify", "NOTIFY"); target {
+	case "":
+		return cfg, nil
+	case "desktop":
+		return cfg.WithDesktop(), nil
+	default:
+		return nil, fmt.Errorf("invalid notify value %q: must be 'desktop'", target)
+	}
+}
+
+// sendNotifications routes the recorded events to the configured sinks. Notifications are
+// best effort: a failing sink is logged but does not change the outcome of the run.
+func sendNotifications(cmd *cobra.Command, cfg *notify.Config, events *notify.Recorder, zapLogger *zap.Logger) {
+	if cfg == nil {
+		return
+	}
+	if err := notify.Notify(commandContext(cmd), cfg, events.Events()); err != nil {
+		zapLogger.Warn("Failed to send notifications", zap.Error(err))
+	}
+}
+
+// recordResult records the outcome of processing a cluster for notifications and the run history:
+// a failure, or a rotation unless in dry-run mode
+func recordResult(v rancher.Cluster, updated bool, err error, opts clusterOptions) {
+	switch {
+	case err != nil:
+		opts.history.Fail(v.Name, v.ID, err)
+		opts.Events.Add(notify.Event{Type: notify.EventFailed, Cluster: v.Name, ClusterID: v.ID, Server: opts.RancherURL, Message: err.Error()})
+	case updated && !opts.DryRun:
+		opts.Events.Add(notify.Event{Type: notify.EventRotated, Cluster: v.Name, ClusterID: v.ID, Server: opts.RancherURL, Message: "kubeconfig entry updated"})
+	}
+}
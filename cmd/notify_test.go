@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/notify"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordResult(t *testing.T) {
+	events := notify.NewRecorder()
+	opts := clusterOptions{Options: pipeline.Options{RancherURL: "https://rancher.example.com", Events: events}}
+	cluster := rancher.Cluster{ID: "c-prod", Name: "prod"}
+
+	recordResult(cluster, true, nil, opts)
+	recordResult(cluster, false, errors.New("boom"), opts)
+	recordResult(cluster, false, nil, opts)
+	opts.DryRun = true
+	recordResult(cluster, true, nil, opts)
+
+	got := events.Events()
+	require.Len(t, got, 2)
+	assert.Equal(t, notify.EventRotated, got[0].Type)
+	assert.Equal(t, "c-prod", got[0].ClusterID)
+	assert.Equal(t, "https://rancher.example.com", got[0].Server)
+	assert.Equal(t, notify.EventFailed, got[1].Type)
+	assert.Equal(t, "boom", got[1].Message)
+
+	// Without a notification config nothing is recorded
+	recordResult(cluster, true, nil, clusterOptions{})
+}
+
+func TestLoadNotifyConfig(t *testing.T) {
+	cmd := NewRootCmd()
+	cfg, err := loadNotifyConfig(cmd)
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	path := filepath.Join(t.TempDir(), "notify.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("sinks:\n  hook:\n    type: webhook\n    url: https://example.com/hook\nrules:\n  - notify: [hook]\n"), 0600))
+	require.NoError(t, cmd.Flags().Set("notify-config", path))
+	cfg, err = loadNotifyConfig(cmd)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hook"}, cfg.Route(notify.Event{Type: notify.EventFailed}))
+
+	require.NoError(t, cmd.Flags().Set("notify", "desktop"))
+	cfg, err = loadNotifyConfig(cmd)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--notify desktop", "hook"}, cfg.Route(notify.Event{Type: notify.EventFailed}))
+
+	require.NoError(t, cmd.Flags().Set("notify", "slack"))
+	_, err = loadNotifyConfig(cmd)
+	assert.ErrorContains(t, err, "invalid notify value")
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"rancher-kubeconfig-updater/internal/federation"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"rancher-kubeconfig-updater/internal/oidc"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// federatedLoginTimeout limits fetching and exchanging the CI token, which involves nobody
+const federatedLoginTimeout = time.Minute
+
+// validateIssuer checks the --issuer setting of OIDC logins
+func validateIssuer(value string) error {
+	if value == "" {
+		return fmt.Errorf("OIDC issuer is required for --auth-type oidc: pass --issuer or set RANCHER_OIDC_ISSUER")
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid OIDC issuer %q: must be an http:// or https:// URL such as https://login.example.com/realms/corp", value)
+	}
+	return nil
+}
+
+// loginWithOIDC logs in with the OIDC provider in the browser, or on another device with
+// --device-code, and exchanges the resulting ID token for a Rancher token through Rancher's
+// generic OIDC provider.
+func loginWithOIDC(settings rancherSettings, logger *zap.Logger) (*rancher.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), browserLoginTimeout)
+	defer cancel()
+
+	cfg := oidc.Config{Issuer: settings.oidcIssuer, ClientID: settings.oidcClientID}
+	var tokens oidc.Tokens
+	var err error
+	if settings.deviceCode {
+		tokens, err = oidc.DeviceLogin(ctx, cfg, func(code oidc.DeviceCode) {
+			fmt.Fprint(os.Stderr, i18n.T(i18n.PromptDeviceCode, code.VerificationURI, code.UserCode))
+		})
+	} else {
+		tokens, err = oidc.Login(ctx, cfg, func(authURL string) {
+			fmt.Fprint(os.Stderr, i18n.T(i18n.PromptOIDCLogin, authURL))
+			if err := openBrowser(authURL); err != nil {
+				logger.Debug("Failed to open the browser", zap.Error(err))
+			}
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to log in with %s: %w", settings.oidcIssuer, err)
+	}
+
+	token, err := rancher.ExchangeIDToken(settings.url, tokens.IDToken, settings.insecureSkipTLSVerify, settings.clientOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with Rancher: %w", err)
+	}
+	logger.Debug("Successfully authenticated with Rancher through OIDC")
+	return rancher.NewClientWithToken(settings.url, token, logger, settings.insecureSkipTLSVerify, settings.clientOptions()...), nil
+}
+
+// loginWithFederatedToken logs in with the OIDC token the CI platform issued to the job. With
+// --issuer the token is first exchanged for an ID token of that provider, otherwise Rancher's
+// generic OIDC provider has to trust the CI platform itself.
+func loginWithFederatedToken(settings rancherSettings, logger *zap.Logger) (*rancher.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), federatedLoginTimeout)
+	defer cancel()
+
+	var exchanger federation.Exchanger = federation.Direct{}
+	if settings.oidcIssuer != "" {
+		exchanger = federation.TokenExchange{Config: oidc.Config{Issuer: settings.oidcIssuer, ClientID: settings.oidcClientID}}
+	}
+	idToken, err := federation.Login(ctx, settings.federatedToken, settings.federatedAudience, exchanger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a federated token from %s: %w", settings.federatedToken, err)
+	}
+
+	token, err := rancher.ExchangeIDToken(settings.url, idToken, settings.insecureSkipTLSVerify, settings.clientOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with Rancher: %w", err)
+	}
+	logger.Debug("Successfully authenticated with Rancher through a federated CI token", zap.Stringer("source", settings.federatedToken))
+	return rancher.NewClientWithToken(settings.url, token, logger, settings.insecureSkipTLSVerify, settings.clientOptions()...), nil
+}
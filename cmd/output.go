@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rancher-kubeconfig-updater/internal/azkv"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/gcpsm"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// secretOutput keeps the kubeconfig in a cloud secret manager instead of a file,
+// for runs in Cloud Run jobs, AKS pods and other places without a persistent disk
+type secretOutput struct {
+	// ref is the secret reference as given, used in logs and as the state key
+	ref    string
+	secret kubeconfigSecret
+}
+
+// kubeconfigSecret is a secret in a secret manager that holds the kubeconfig
+type kubeconfigSecret interface {
+	// latest returns the current value, or nil when the secret has none yet
+	latest(ctx context.Context) ([]byte, error)
+	// store saves data as the new current value
+	store(ctx context.Context, data []byte) error
+	// name is the secret's name within its project or vault, as External Secrets refers to it
+	name() string
+}
+
+// parseOutput resolves --output. A nil result means the kubeconfig file is used.
+func parseOutput(cmd *cobra.Command) (*secretOutput, error) {
+	value := config.GetConfig(cmd, "output", "OUTPUT")
+	if value == "" {
+		return nil, nil
+	}
+
+	var secret kubeconfigSecret
+	switch {
+	case strings.HasPrefix(value, gcpsm.Scheme):
+		ref, err := gcpsm.ParseRef(value)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Version != "latest" {
+			return nil, fmt.Errorf("output %q must not name a version: every run adds a new one", value)
+		}
+		secret = gcpSecret{ref: ref, client: gcpsm.NewClient()}
+	case strings.HasPrefix(value, azkv.Scheme):
+		ref, err := azkv.ParseRef(value)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Version != "" {
+			return nil, fmt.Errorf("output %q must not name a version: every run adds a new one", value)
+		}
+		secret = azureSecret{ref: ref, client: azkv.NewClient()}
+	default:
+		return nil, fmt.Errorf("unsupported output %q: only %s and %s references are supported, use --config for files", value, gcpsm.Scheme, azkv.Scheme)
+	}
+
+	if cmd.Flags().Changed("config") {
+		return nil, errors.New("--config and --output both name the kubeconfig: use only one of them")
+	}
+	return &secretOutput{ref: value, secret: secret}, nil
+}
+
+// load reads the kubeconfig from the secret. A secret without a value yields an empty
+// kubeconfig, like a missing file does.
+func (o *secretOutput) load(ctx context.Context) (*api.Config, error) {
+	data, err := o.secret.latest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return api.NewConfig(), nil
+	}
+	defer clear(data)
+
+	kubecfg, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig from %s: %w", o.ref, err)
+	}
+	return kubecfg, nil
+}
+
+// save stores kubecfg as the new value of the secret
+func (o *secretOutput) save(ctx context.Context, kubecfg *api.Config) error {
+	data, err := clientcmd.Write(*kubecfg)
+	if err != nil {
+		return fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+	defer clear(data)
+	return o.secret.store(ctx, data)
+}
+
+// gcpSecret is a Google Secret Manager secret; every save adds a version
+type gcpSecret struct {
+	ref    gcpsm.Ref
+	client *gcpsm.Client
+}
+
+func (s gcpSecret) latest(ctx context.Context) ([]byte, error) {
+	data, err := s.client.Access(ctx, s.ref)
+	if errors.Is(err, gcpsm.ErrNotFound) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s gcpSecret) store(ctx context.Context, data []byte) error {
+	err := s.client.AddVersion(ctx, s.ref, data)
+	if errors.Is(err, gcpsm.ErrNotFound) {
+		return fmt.Errorf("secret %s does not exist, create it with: gcloud secrets create %s --project %s", s.ref, s.ref.Secret, s.ref.Project)
+	}
+	return err
+}
+
+func (s gcpSecret) name() string {
+	return s.ref.Secret
+}
+
+// azureSecret is an Azure Key Vault secret; it is created by the first save
+type azureSecret struct {
+	ref    azkv.Ref
+	client *azkv.Client
+}
+
+func (s azureSecret) latest(ctx context.Context) ([]byte, error) {
+	data, err := s.client.Get(ctx, s.ref)
+	if errors.Is(err, azkv.ErrNotFound) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s azureSecret) store(ctx context.Context, data []byte) error {
+	return s.client.Set(ctx, s.ref, data, "application/yaml")
+}
+
+func (s azureSecret) name() string {
+	return s.ref.Name
+}
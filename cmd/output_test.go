@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newOutputTestCmd(args ...string) *cobra.Command {
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("output", "", "")
+	cmd.Flags().StringP("config", "c", "", "")
+	_ = cmd.ParseFlags(args)
+	return cmd
+}
+
+func TestParseOutput(t *testing.T) {
+	t.Setenv("OUTPUT", "")
+
+	output, err := parseOutput(newOutputTestCmd())
+	require.NoError(t, err)
+	assert.Nil(t, output, "without --output the kubeconfig file is used")
+
+	output, err = parseOutput(newOutputTestCmd("--output", "gcp-sm://projects/p/secrets/kubeconfig"))
+	require.NoError(t, err)
+	require.NotNil(t, output)
+	assert.Equal(t, "gcp-sm://projects/p/secrets/kubeconfig", output.ref)
+	assert.IsType(t, gcpSecret{}, output.secret)
+
+	output, err = parseOutput(newOutputTestCmd("--output", "azkv://myvault/kubeconfig"))
+	require.NoError(t, err)
+	assert.IsType(t, azureSecret{}, output.secret)
+
+	t.Setenv("OUTPUT", "gcp-sm://projects/p/secrets/from-env")
+	output, err = parseOutput(newOutputTestCmd())
+	require.NoError(t, err)
+	assert.Equal(t, "gcp-sm://projects/p/secrets/from-env", output.ref)
+}
+
+func TestParseOutput_Invalid(t *testing.T) {
+	t.Setenv("OUTPUT", "")
+
+	for name, args := range map[string][]string{
+		"file path":      {"--output", "/tmp/kubeconfig"},
+		"bad reference":  {"--output", "gcp-sm://p/kubeconfig"},
+		"pinned version": {"--output", "gcp-sm://projects/p/secrets/kubeconfig/versions/2"},
+		"azure version":  {"--output", "azkv://myvault/kubeconfig/0123abcd"},
+		"with --config":  {"--output", "gcp-sm://projects/p/secrets/kubeconfig", "--config", "/tmp/kubeconfig"},
+	} {
+		_, err := parseOutput(newOutputTestCmd(args...))
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/policy"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// loadPolicy reads the --policy-config file, or returns nil when no policy is configured
+func loadPolicy(cmd *cobra.Command) (*policy.Policy, error) {
+	path := config.GetConfig(cmd, "policy-config", "POLICY_CONFIG")
+	if path == "" {
+		return nil, nil
+	}
+	return policy.Load(path)
+}
+
+// parseMaxTokenAge reads --max-token-age, which is 0 when tokens may get arbitrarily old
+func parseMaxTokenAge(cmd *cobra.Command) (time.Duration, error) {
+	value := config.GetConfig(cmd, "max-token-age", "MAX_TOKEN_AGE")
+	if value == "" {
+		return 0, nil
+	}
+	maxAge, err := policy.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if maxAge <= 0 {
+		return 0, fmt.Errorf("maximum token age must be positive, got %s", value)
+	}
+	return maxAge, nil
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMaxTokenAge(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "90d", want: 90 * 24 * time.Hour},
+		{value: "12h", want: 12 * time.Hour},
+		{value: "0d", wantErr: true},
+		{value: "ninety days", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cmd := NewRootCmd()
+			require.NoError(t, cmd.Flags().Set("max-token-age", tt.value))
+			got, err := parseMaxTokenAge(cmd)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
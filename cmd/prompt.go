@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"rancher-kubeconfig-updater/internal/terminal"
+	"strings"
+)
+
+// stdinIsTerminal reports whether the user can be asked questions on stdin
+func stdinIsTerminal() bool {
+	return terminal.IsTerminal(os.Stdin)
+}
+
+// promptYesNo asks a yes/no question on the terminal; anything but "y" or "yes" means no
+func promptYesNo(question string) bool {
+	fmt.Print(i18n.T(i18n.PromptYesNo, question))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// promptSelection lists the new clusters auto-create would add on the terminal and returns the
+// ones the user picks; an invalid answer is asked again, and no answer adds none of them
+func promptSelection(names []string) []string {
+	fmt.Println(i18n.T(i18n.SelectNewClusters, len(names)))
+	for i, name := range names {
+		fmt.Printf("  %d) %s\n", i+1, name)
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print(i18n.T(i18n.PromptSelection))
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			return nil
+		}
+		indexes, perr := parseSelection(answer, len(names))
+		if perr != nil {
+			fmt.Println(i18n.T(i18n.SelectionInvalid, perr))
+			if err != nil {
+				return nil
+			}
+			continue
+		}
+		selected := make([]string, len(indexes))
+		for i, index := range indexes {
+			selected[i] = names[index]
+		}
+		return selected
+	}
+}
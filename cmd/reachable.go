@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"rancher-kubeconfig-updater/internal/config"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// exitUnreachable is the exit code of runs skipped because a --require-reachable address could
+// not be reached (EX_TEMPFAIL, "try again later")
+const exitUnreachable = 75
+
+// reachableTimeout bounds each --require-reachable probe
+const reachableTimeout = 3 * time.Second
+
+// requiredAddresses returns the host:port addresses of --require-reachable
+func requiredAddresses(cmd *cobra.Command) ([]string, error) {
+	var addrs []string
+	for _, addr := range strings.Split(config.GetConfig(cmd, "require-reachable", "REQUIRE_REACHABLE"), ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("invalid address %q, expected host:port: %w", addr, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// firstUnreachable opens a TCP connection to each address and returns the first that can't
+// be connected to within reachableTimeout, with the reason ("" and nil if all can)
+func firstUnreachable(ctx context.Context, addrs []string) (string, error) {
+	dialer := net.Dialer{Timeout: reachableTimeout}
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return addr, err
+		}
+		_ = conn.Close()
+	}
+	return "", nil
+}
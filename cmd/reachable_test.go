@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// closedAddress returns an address nothing listens on: a port right after its listener closed
+func closedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+	return addr
+}
+
+func TestRequiredAddresses(t *testing.T) {
+	cmd := NewRootCmd()
+	addrs, err := requiredAddresses(cmd)
+	require.NoError(t, err)
+	assert.Empty(t, addrs)
+
+	require.NoError(t, cmd.Flags().Set("require-reachable", "rancher.example.com:443, 10.0.0.1:22,"))
+	addrs, err = requiredAddresses(cmd)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rancher.example.com:443", "10.0.0.1:22"}, addrs)
+
+	require.NoError(t, cmd.Flags().Set("require-reachable", "rancher.example.com"))
+	_, err = requiredAddresses(cmd)
+	assert.ErrorContains(t, err, "expected host:port")
+}
+
+func TestFirstUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	open := listener.Addr().String()
+	closed := closedAddress(t)
+
+	addr, err := firstUnreachable(context.Background(), []string{open})
+	assert.NoError(t, err)
+	assert.Empty(t, addr)
+
+	addr, err = firstUnreachable(context.Background(), []string{open, closed})
+	assert.Error(t, err)
+	assert.Equal(t, closed, addr)
+
+	addr, err = firstUnreachable(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, addr)
+}
+
+func TestRun_RequireReachableSkipsRun(t *testing.T) {
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--require-reachable", closedAddress(t), "--config", t.TempDir() + "/config"})
+
+	err := cmd.Execute()
+	var exitErr *ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, exitUnreachable, exitErr.Code)
+}
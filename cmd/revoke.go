@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/policy"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// recentTokenUse is how long after its last use a replaced token is kept at least, since
+// whatever still used it after the replacement would break if it were revoked
+const recentTokenUse = 24 * time.Hour
+
+// parseRevokeReplacedAfter reads --revoke-replaced-after. enabled is false when replaced
+// tokens are not revoked but left to expire.
+func parseRevokeReplacedAfter(cmd *cobra.Command) (grace time.Duration, enabled bool, err error) {
+	value := config.GetConfig(cmd, "revoke-replaced-after", "REVOKE_REPLACED_AFTER")
+	if value == "" {
+		return 0, false, nil
+	}
+	grace, err = policy.ParseDuration(value)
+	if err != nil {
+		return 0, false, err
+	}
+	if grace < 0 {
+		return 0, false, fmt.Errorf("grace period must not be negative, got %s", value)
+	}
+	return grace, true, nil
+}
+
+// revokeRetiredTokens revokes the tokens replaced by earlier runs against client's server
+// whose grace period has passed. Tokens still used by an entry of kubecfg are kept, and so
+// are tokens Rancher saw in use after they were replaced, within the grace period or
+// recentTokenUse, whichever is longer: something other than the kubeconfig, such as a
+// forgotten automation sharing a copy of it, still depends on them. Tokens are judged as of
+// the client's time (see --as-of). Failures are logged and retried on the next run.
+func revokeRetiredTokens(client *rancher.Client, kubecfg *api.Config, opts clusterOptions, zapLogger *zap.Logger) {
+	if !opts.RevokeReplaced || opts.State == nil {
+		return
+	}
+	inUse := make(map[string]bool)
+	for _, authInfo := range kubecfg.AuthInfos {
+		if authInfo == nil {
+			continue
+		}
+		if name, err := rancher.TokenName(authInfo.Token); err == nil {
+			inUse[name] = true
+		}
+	}
+
+	now := client.Now()
+	for _, retired := range opts.State.Due(opts.RancherURL, opts.GracePeriod, now) {
+		logger := zapLogger.With(zap.String("tokenName", retired.Name), zap.Time("replacedAt", retired.RetiredAt))
+		switch {
+		case inUse[retired.Name]:
+			logger.Warn("Replaced token is used by a kubeconfig entry again, not revoking it")
+			opts.State.Forget(opts.RancherURL, retired.Name)
+		case usedSinceRetired(client, retired.Name, retired.RetiredAt, opts.GracePeriod, now, logger):
+			// Kept in the state, so the token is revoked once nothing has used it for a while
+		case opts.DryRun:
+			logger.Info("[DRY-RUN] Would revoke replaced token")
+		default:
+			if err := client.RevokeToken(retired.Name); err != nil {
+				logger.Warn("Failed to revoke replaced token, retrying on the next run", zap.Error(err))
+				continue
+			}
+			logger.Info("Revoked replaced token after its grace period")
+			opts.State.Forget(opts.RancherURL, retired.Name)
+		}
+	}
+}
+
+// usedSinceRetired reports whether Rancher saw the named token in use after retiredAt, recently
+// enough before now that revoking it would likely break whatever used it. Tokens whose last use
+// Rancher doesn't record, or can't be looked up, are not considered in use.
+func usedSinceRetired(client *rancher.Client, tokenName string, retiredAt time.Time, grace time.Duration, now time.Time, logger *zap.Logger) bool {
+	lastUsed, err := client.GetTokenLastUsed(tokenName)
+	if err != nil {
+		logger.Warn("Failed to look up when the replaced token was last used, revoking it anyway", zap.Error(err))
+		return false
+	}
+	if lastUsed.IsZero() || !lastUsed.After(retiredAt) || now.Sub(lastUsed) >= max(grace, recentTokenUse) {
+		return false
+	}
+	logger.Warn("Replaced token was used after it was replaced, likely by something other than this kubeconfig; not revoking it yet",
+		zap.Time("lastUsedAt", lastUsed))
+	return true
+}
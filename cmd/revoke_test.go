@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/state"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestParseRevokeReplacedAfter(t *testing.T) {
+	tests := []struct {
+		value       string
+		want        time.Duration
+		wantEnabled bool
+		wantErr     bool
+	}{
+		{value: "", wantEnabled: false},
+		{value: "0", want: 0, wantEnabled: true},
+		{value: "1h", want: time.Hour, wantEnabled: true},
+		{value: "1d", want: 24 * time.Hour, wantEnabled: true},
+		{value: "-1h", wantErr: true},
+		{value: "later", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("REVOKE_REPLACED_AFTER", "")
+			cmd := NewRootCmd()
+			require.NoError(t, cmd.Flags().Set("revoke-replaced-after", tt.value))
+			got, enabled, err := parseRevokeReplacedAfter(cmd)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantEnabled, enabled)
+		})
+	}
+}
+
+func TestRevokeRetiredTokens(t *testing.T) {
+	var mu sync.Mutex
+	var revoked []string
+	longAgo := time.Now().Add(-2 * time.Hour)
+	lastUsed := map[string]time.Time{
+		"/v3/tokens/kubeconfig-u-shared":    time.Now().Add(-10 * time.Minute),
+		"/v3/tokens/kubeconfig-u-abandoned": longAgo.Add(-time.Hour),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if used, ok := lastUsed[r.URL.Path]; ok && r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"lastUsedAt": "` + used.Format(time.RFC3339) + `"}`))
+			return
+		}
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mu.Lock()
+		revoked = append(revoked, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/v3/tokens/kubeconfig-u-broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	client := rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+	st.Retire(server.URL, "kubeconfig-u-due", longAgo)
+	st.Retire(server.URL, "kubeconfig-u-shared", longAgo)
+	st.Retire(server.URL, "kubeconfig-u-abandoned", longAgo)
+	st.Retire(server.URL, "kubeconfig-u-broken", longAgo)
+	st.Retire(server.URL, "kubeconfig-u-restored", longAgo)
+	st.Retire(server.URL, "kubeconfig-u-recent", time.Now())
+	st.Retire("https://other.example.com", "kubeconfig-u-elsewhere", longAgo)
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-restored:secret"}
+	opts := clusterOptions{Options: pipeline.Options{RancherURL: server.URL, State: st, RevokeReplaced: true, GracePeriod: time.Hour}}
+
+	// Dry runs only log
+	opts.DryRun = true
+	revokeRetiredTokens(client, kubecfg, opts, zap.NewNop())
+	assert.Empty(t, revoked)
+
+	opts.DryRun = false
+	revokeRetiredTokens(client, kubecfg, opts, zap.NewNop())
+	assert.ElementsMatch(t, []string{"/v3/tokens/kubeconfig-u-due", "/v3/tokens/kubeconfig-u-broken", "/v3/tokens/kubeconfig-u-abandoned"}, revoked,
+		"a token last used before it was replaced is revoked, one used since is not")
+
+	var left []string
+	for _, retired := range st.Retired {
+		left = append(left, retired.Name)
+	}
+	assert.ElementsMatch(t, []string{"kubeconfig-u-broken", "kubeconfig-u-shared", "kubeconfig-u-recent", "kubeconfig-u-elsewhere"}, left,
+		"failed revocations and tokens used since their replacement are retried, tokens in use are forgotten")
+}
+
+func TestRevokeRetiredTokens_AsOf(t *testing.T) {
+	var revoked []string
+	retiredAt := time.Now().Add(-2 * time.Hour)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"lastUsedAt": "` + time.Now().Add(-10*time.Minute).Format(time.RFC3339) + `"}`))
+			return
+		}
+		revoked = append(revoked, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+	st.Retire(server.URL, "kubeconfig-u-shared", retiredAt)
+	opts := clusterOptions{Options: pipeline.Options{RancherURL: server.URL, State: st, RevokeReplaced: true, GracePeriod: time.Hour}}
+
+	client := rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+	revokeRetiredTokens(client, api.NewConfig(), opts, zap.NewNop())
+	assert.Empty(t, revoked, "the token was used recently")
+
+	// Two days later, the last use is long enough ago
+	asOf := rancher.FixedClock(time.Now().Add(48 * time.Hour))
+	client = rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false, rancher.WithClock(asOf))
+	revokeRetiredTokens(client, api.NewConfig(), opts, zap.NewNop())
+	assert.Equal(t, []string{"/v3/tokens/kubeconfig-u-shared"}, revoked)
+}
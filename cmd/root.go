@@ -3,73 +3,283 @@ package cmd
 
 import (
 	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/appdir"
+	"rancher-kubeconfig-updater/internal/clusterlist"
 	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/eventstream"
+	"rancher-kubeconfig-updater/internal/history"
+	"rancher-kubeconfig-updater/internal/i18n"
 	"rancher-kubeconfig-updater/internal/kubeconfig"
 	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/metrics"
+	"rancher-kubeconfig-updater/internal/notify"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/plan"
 	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"rancher-kubeconfig-updater/internal/state"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"k8s.io/client-go/tools/clientcmd/api"
 )
 
 var (
-	autoCreate            bool
-	authTypeFlag          string
-	userFlag              string
-	passwordFlag          string
-	clusterFlag           string
-	insecureSkipTLSVerify bool
-	configPath            string
-	thresholdDays         int
-	forceRefresh          bool
-	dryRun                bool
-	withDirectly          bool
+	autoCreate     bool
+	clusterFlag    string
+	configPath     string
+	thresholdDays  int
+	forceRefresh   bool
+	dryRun         bool
+	withDirectly   bool
+	execCredential bool
 )
 
 func NewRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "rancher-kubeconfig-updater",
 		Short: "Update kubeconfig tokens for Rancher-managed Kubernetes clusters",
-		Run:   run,
+		RunE:  run,
+		// Runs for every subcommand too, none of them defines its own
+		PersistentPreRunE: applyGlobalFlags,
 	}
 
+	rootCmd.PersistentFlags().String("lang", "", "Language of prompts and reports: 'en' or 'zh-TW' (default: from LANG)")
+	rootCmd.PersistentFlags().String("state-dir", "", "Directory for the state file, run history, stored secrets and credential cache socket, for machines without a home directory (default: <user cache dir>/rancher-kubeconfig-updater)")
+	rootCmd.PersistentFlags().Bool("read-only", false, "Refuse every file write (kubeconfig, backups, state, history, cache), for audits from restricted environments; implies --dry-run")
+	addConfigFileFlags(rootCmd)
+	addEnvFileFlag(rootCmd)
+	addSharedHostFlag(rootCmd)
+	addDaemonFlags(rootCmd)
+	addEventFlags(rootCmd)
+	addTrayFlag(rootCmd)
 	rootCmd.Flags().BoolVarP(&autoCreate, "auto-create", "a", false, "Automatically create kubeconfig entries for clusters not found in the config")
-	rootCmd.Flags().StringVar(&authTypeFlag, "auth-type", "", "Authentication type: 'local' or 'ldap' (default: from RANCHER_AUTH_TYPE env or 'local')")
-	rootCmd.Flags().StringVarP(&userFlag, "user", "u", "", "Rancher Username")
-	rootCmd.Flags().StringVarP(&passwordFlag, "password", "p", "", "Rancher Password")
-	// Set NoOptDefVal for password to allow interactive prompt when flag is present without value
-	rootCmd.Flags().Lookup("password").NoOptDefVal = "-"
+	rootCmd.Flags().BoolP("yes", "y", false, "Add every new cluster --auto-create finds without asking; on a terminal, the new clusters are otherwise listed to pick from")
+	rootCmd.Flags().String("auto-create-only", "", "Comma-separated glob patterns, e.g. 'prod-*,c-m-abc12', limiting --auto-create to clusters whose name or ID matches; other missing clusters are skipped (implies --auto-create)")
+	addRancherFlags(rootCmd)
 	rootCmd.Flags().StringVar(&clusterFlag, "cluster", "", "Comma-separated list of cluster names or IDs to update")
-	rootCmd.Flags().BoolVar(&insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Skip TLS certificate verification (insecure, use only for development/testing)")
+	rootCmd.Flags().String("cluster-source", "", "Where the clusters and their kubeconfigs come from: 'v3' (Rancher's v3 API), 'steve' (Rancher's v1 API used by the dashboard) or 'file:PATH' (a static cluster manifest, e.g. on air-gapped machines) (default \"v3\")")
+	rootCmd.Flags().String("static-clusters", "", "YAML file with clusters outside Rancher (server, CA and a command printing the token) whose entries are maintained alongside the Rancher ones")
+	rootCmd.Flags().String("textfile-dir", "", "After every run, write rancher_kubeconfig_updater.prom with the token expiry of every context and the run's outcome to this directory, e.g. node_exporter's --collector.textfile.directory")
+	rootCmd.Flags().String("golden-kubeconfig", "", "Team-maintained kubeconfig whose clusters and contexts are merged with this run's tokens: an https:// URL, s3://bucket/key, git+URL//path?ref=branch or a local file")
+	rootCmd.Flags().String("cluster-list", "", "CSV or YAML file listing the clusters to create or refresh entries for, each with an optional context name and namespace")
+	rootCmd.Flags().String("canary", "", "Name or ID of a low-risk cluster to refresh first; the others are only updated if its new token works (its token is replaced on every run)")
+	rootCmd.Flags().String("require-reachable", "", "Comma-separated host:port addresses, e.g. rancher.example.com:443, that must accept a connection; otherwise the run is skipped with exit code 75 (daemon mode: the update is skipped)")
+	rootCmd.Flags().Duration("wait-for-server", 0, "If Rancher can't be reached, e.g. right after wake-from-sleep before the VPN is up, keep retrying with backoff for up to this long, e.g. 10m")
+	rootCmd.Flags().String("checkpoint", "", "Record finished clusters in this file and save progress along the way, so an interrupted run resumes where it stopped")
+	rootCmd.Flags().Int("checkpoint-every", defaultCheckpointEvery, "With --checkpoint, save the kubeconfig after this many refreshed clusters")
+	rootCmd.Flags().Int("concurrency", defaultConcurrency, "Number of clusters per Rancher server whose tokens are fetched at the same time; 1 processes them one after another")
 	rootCmd.Flags().StringVarP(&configPath, "config", "c", "", "Path to kubeconfig file (default: ~/.kube/config)")
 	rootCmd.Flags().IntVar(&thresholdDays, "threshold-days", 30, "Expiration threshold in days")
-	rootCmd.Flags().BoolVar(&forceRefresh, "force-refresh", false, "Bypass expiration checks and force regeneration")
+	rootCmd.Flags().String("max-token-age", "", "Also replace tokens created longer ago than this, e.g. 90d, even if they have a long or no TTL (default: no limit)")
+	rootCmd.Flags().String("token-scope", "auto", "Scope of kubeconfig tokens: 'cluster' (valid for one cluster), 'global' (valid for all of the user's clusters) or 'auto' (as Rancher generates them)")
+	rootCmd.Flags().String("revoke-replaced-after", "", "Revoke replaced tokens on a later run once this grace period has passed, e.g. 1h or 1d, so processes still using them keep working meanwhile; 0 revokes them on the next run (default: replaced tokens stay valid until they expire)")
+	rootCmd.Flags().Bool("renew-tokens", false, "Extend the TTL of expiring tokens instead of replacing them, so their names stay the same (falls back to a new token where Rancher doesn't allow it)")
+	rootCmd.Flags().BoolVar(&forceRefresh, "force-refresh", false, "Bypass expiration checks and maintenance windows and force regeneration")
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview changes without modifying kubeconfig")
+	rootCmd.Flags().String("as-of", "", "Preview which tokens would be refreshed on a future date, e.g. 2025-12-01, as a dry run deciding as if it were that date")
+	rootCmd.Flags().Bool("explain", false, "Print each cluster's decision chain: existing token, expiry, threshold comparison and API calls")
 	rootCmd.Flags().BoolVar(&withDirectly, "with-directly", false, "Include Downstream Directly contexts for direct cluster access")
+	rootCmd.Flags().String("state-file", "", "Path to the state file tracking managed entries (default: <user cache dir>/rancher-kubeconfig-updater/state.json)")
+	rootCmd.Flags().Bool("force-overwrite", false, "Overwrite kubeconfig entries that were modified outside this tool without asking")
+	rootCmd.Flags().String("output", "", "Keep the kubeconfig in a secret manager instead of a file: gcp-sm://projects/PROJECT/secrets/SECRET or azkv://VAULT/SECRET")
+	addManifestFlags(rootCmd)
+	addGatewayFlag(rootCmd)
+	rootCmd.Flags().String("notify-config", "", "YAML file with notification sinks (Slack, PagerDuty, email, webhook) and rules routing rotations, failures and expiry warnings to them")
+	rootCmd.Flags().String("notify", "", "Set to 'desktop' to show a native desktop notification summarizing rotations, failures and expiring tokens after each run")
+	rootCmd.Flags().String("policy-config", "", "YAML file with rules overriding the rotation decision per cluster, e.g. never rotate frozen clusters or rotate tokens older than 60 days")
+	rootCmd.Flags().String("context-dir", "", "After updating, also write one kubeconfig per Rancher context to this directory (for Lens sync folders and k9s)")
+	rootCmd.Flags().String("plan-output", "", "Write the planned (with --dry-run) or applied changes as JSON to this file ('-' for stdout)")
+	rootCmd.Flags().Bool("include-local", true, "Include Rancher's 'local' management cluster (use --include-local=false to skip it)")
+	addSaveFlags(rootCmd)
+	rootCmd.Flags().BoolVar(&execCredential, "exec-credential", false, "Configure kubeconfig entries to fetch tokens via the 'credential' exec plugin instead of embedding them")
+
+	rootCmd.AddCommand(NewCredentialCmd())
+	rootCmd.AddCommand(NewRunCmd())
+	rootCmd.AddCommand(NewExecCmd())
+	rootCmd.AddCommand(NewAuditCmd())
+	rootCmd.AddCommand(NewAdoptCmd())
+	rootCmd.AddCommand(NewTFOutputCmd())
+	rootCmd.AddCommand(NewExportCmd())
+	rootCmd.AddCommand(NewStatusCmd())
+	rootCmd.AddCommand(NewListCmd())
+	rootCmd.AddCommand(NewSnapshotCmd())
+	rootCmd.AddCommand(NewSupportBundleCmd())
+	rootCmd.AddCommand(NewLastRunCmd())
+	rootCmd.AddCommand(NewHistoryCmd())
+	rootCmd.AddCommand(NewWhyCmd())
 
 	return rootCmd
 }
 
-func run(cmd *cobra.Command, args []string) {
+// applyGlobalFlags applies the persistent flags, which every command shares
+func applyGlobalFlags(cmd *cobra.Command, args []string) error {
+	// The .env files may set any of the settings below, so they are loaded first
+	if err := loadEnvFiles(cmd); err != nil {
+		return err
+	}
+	if err := applyLanguage(cmd, args); err != nil {
+		return err
+	}
+	if err := applyConfigFile(cmd); err != nil {
+		return err
+	}
+	appdir.Set(config.GetConfig(cmd, "state-dir", "STATE_DIR"))
+	readonly.Set(config.GetBool(cmd, "read-only", "READ_ONLY"))
+	return applySharedHost(cmd)
+}
+
+// applyLanguage selects the language of console output from --lang or the locale
+func applyLanguage(cmd *cobra.Command, args []string) error {
+	flagValue, _ := cmd.Flags().GetString("lang")
+	lang, err := i18n.Detect(flagValue)
+	if err != nil {
+		return err
+	}
+	i18n.SetLanguage(lang)
+	return nil
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	jitter := config.GetDuration(cmd, "jitter", "JITTER")
+	required, err := requiredAddresses(cmd)
+	if err != nil {
+		zapLogger := logger.NewLogger()
+		zapLogger.Error("Invalid --require-reachable", zap.Error(err))
+		_ = zapLogger.Sync()
+		return nil
+	}
+	sched, err := parseSchedule(cmd)
+	if err != nil {
+		zapLogger := logger.NewLogger()
+		zapLogger.Error("Invalid daemon schedule", zap.Error(err))
+		_ = zapLogger.Sync()
+		return nil
+	}
+	if trayEnabled(cmd) {
+		runTrayMode(cmd, args, sched)
+		return nil
+	}
+	if sched != nil {
+		runDaemon(cmd, args, sched, jitter, required)
+		return nil
+	}
+	if config.GetConfig(cmd, "listen", "LISTEN_ADDRESS") != "" {
+		zapLogger := logger.NewLogger()
+		zapLogger.Error("--listen only works in daemon mode; set --interval or --schedule too")
+		_ = zapLogger.Sync()
+		return nil
+	}
+	// Runs started by cron or a systemd timer on many machines would all start at the same time
+	if jitter > 0 {
+		zapLogger := logger.NewLogger()
+		waited := waitJitter(commandContext(cmd), jitter, zapLogger)
+		_ = zapLogger.Sync()
+		if !waited {
+			return nil
+		}
+	}
+	// Scheduled runs off the VPN end quietly instead of failing at the login
+	if addr, err := firstUnreachable(commandContext(cmd), required); err != nil {
+		zapLogger := logger.NewLogger()
+		zapLogger.Info("Skipping run, required address is unreachable", zap.String("address", addr), zap.Error(err))
+		_ = zapLogger.Sync()
+		cmd.SilenceUsage, cmd.SilenceErrors = true, true
+		return &ExitError{Code: exitUnreachable}
+	}
+	update(cmd, args, nil)
+	return nil
+}
+
+// update refreshes the kubeconfig once. The Rancher API requests are recorded in apiMetrics,
+// if it is not nil.
+func update(cmd *cobra.Command, args []string, apiMetrics *metrics.Registry) {
 	var err error
 
-	// Initialize logger with pipe-delimited format
+	// Initialize logger with pipe-delimited format; an event stream on stdout moves it to stderr
 	zapLogger := logger.NewLogger()
+	eventsOut, eventsOnStdout, eventsErr := openEventStream(cmd)
+	if eventsOnStdout {
+		zapLogger = logger.NewLoggerWithWriter(os.Stderr, zapcore.InfoLevel)
+	}
 	defer func() {
 		_ = zapLogger.Sync()
 	}()
+	if eventsErr != nil {
+		zapLogger.Error("Invalid event stream", zap.Error(eventsErr))
+		return
+	}
 
 	// Get configuration with priority: Flag > Env > Default
-	rancherURL := os.Getenv("RANCHER_URL")
-	rancherUsername := config.GetConfig(cmd, "user", "RANCHER_USERNAME")
-	rancherAuthType := config.GetConfig(cmd, "auth-type", "RANCHER_AUTH_TYPE")
-	insecureSkipTLSVerify := config.GetBool(cmd, "insecure-skip-tls-verify", "RANCHER_INSECURE_SKIP_TLS_VERIFY")
 	thresholdDays := config.GetInt(cmd, "threshold-days", "TOKEN_THRESHOLD_DAYS")
 	forceRefresh := config.GetBool(cmd, "force-refresh", "FORCE_REFRESH")
 	dryRun := config.GetBool(cmd, "dry-run", "DRY_RUN")
+
+	// A preview as of another date decides as if it were that date and never changes anything
+	asOf, err := parseAsOf(cmd)
+	if err != nil {
+		zapLogger.Error("Invalid --as-of date", zap.Error(err))
+		return
+	}
+	if !asOf.IsZero() {
+		dryRun = true
+	}
+	// Nothing a run changes could be saved, so no token is replaced either
+	if readonly.Enabled() {
+		zapLogger.Info("Read-only mode enabled - running as a dry run")
+		dryRun = true
+	}
+
+	// Every run is recorded for last-run and history, also those that fail before doing anything.
+	// The plan records the clusters of the run, --plan-output only decides whether it is written.
+	origin := pipeline.NewOrigin()
+	record := history.NewRecorder(origin.RunID, time.Now(), dryRun)
+	runPlan := plan.New(dryRun)
+	expiries := newExpiryCollector(cmd)
+	var stream *eventstream.Stream
+	if eventsOut != nil {
+		stream = eventstream.New(eventsOut, origin.RunID)
+	}
+	defer func() {
+		run := record.Finish(runPlan, time.Now())
+		stream.Emit(eventstream.Event{Type: eventstream.TypeFinished, Outcome: run.Outcome})
+		saveRun(cmd, run, zapLogger)
+		writeTextfile(cmd, run, expiries, zapLogger)
+	}()
+	zapLogger = recordErrors(zapLogger, record)
 	withDirectly := config.GetBool(cmd, "with-directly", "WITH_DIRECTLY")
+	execCredential := config.GetBool(cmd, "exec-credential", "EXEC_CREDENTIAL")
+
+	saveOpts, err := saveOptions(cmd, zapLogger)
+	if err != nil {
+		zapLogger.Error("Invalid kubeconfig file settings", zap.Error(err))
+		return
+	}
+	saving, err := resolveSavePolicy(cmd)
+	if err != nil {
+		zapLogger.Error("Invalid save policy", zap.Error(err))
+		return
+	}
+	output, err := parseOutput(cmd)
+	if err != nil {
+		zapLogger.Error("Invalid output", zap.Error(err))
+		return
+	}
+	manifestExport, err := resolveManifestExport(cmd, output)
+	if err != nil {
+		zapLogger.Error("Invalid manifest settings", zap.Error(err))
+		return
+	}
+	if !dryRun && output == nil {
+		if err := checkRootWrite(cmd, configPath); err != nil {
+			zapLogger.Error("Refusing to modify kubeconfig", zap.Error(err), hintField(err))
+			return
+		}
+	}
 
 	// Log dry-run mode if enabled
 	if dryRun {
@@ -81,124 +291,208 @@ func run(cmd *cobra.Command, args []string) {
 		zapLogger.Info("Downstream Directly mode enabled - will include direct cluster contexts")
 	}
 
-	rancherPassword, err := config.GetPassword(cmd, "password", "RANCHER_PASSWORD")
+	// Resolve the plugin command before touching anything so exec-credential mode fails early
+	var execCommand string
+	if execCredential {
+		execCommand, err = os.Executable()
+		if err != nil {
+			zapLogger.Error("Failed to resolve executable path for exec-credential mode", zap.Error(err))
+			return
+		}
+		zapLogger.Info("Exec-credential mode enabled - kubeconfig entries will use the credential plugin")
+	}
+	gateways, err := loadGateways(cmd, execCredential)
+	if err != nil {
+		zapLogger.Error("Invalid gateway config", zap.Error(err))
+		return
+	}
+	notifyConfig, err := loadNotifyConfig(cmd)
+	if err != nil {
+		zapLogger.Error("Invalid notification config", zap.Error(err))
+		return
+	}
+	rotationPolicy, err := loadPolicy(cmd)
+	if err != nil {
+		zapLogger.Error("Invalid policy config", zap.Error(err))
+		return
+	}
+	maxTokenAge, err := parseMaxTokenAge(cmd)
+	if err != nil {
+		zapLogger.Error("Invalid maximum token age", zap.Error(err))
+		return
+	}
+	autoCreateOnly, err := parseAutoCreateOnly(cmd)
+	if err != nil {
+		zapLogger.Error("Invalid --auto-create-only", zap.Error(err))
+		return
+	}
+	clusterList, err := loadClusterList(cmd)
+	if err != nil {
+		zapLogger.Error("Invalid cluster list", zap.Error(err))
+		return
+	}
+	staticClusters, err := loadStaticClusters(cmd)
+	if err != nil {
+		zapLogger.Error("Invalid static clusters", zap.Error(err))
+		return
+	}
+	goldenCfg, goldenSource, err := loadGolden(cmd)
+	if err != nil {
+		zapLogger.Error("Failed to load golden kubeconfig", zap.Error(err))
+		return
+	}
+	tokenScope, err := parseTokenScope(cmd)
 	if err != nil {
-		zapLogger.Error("Failed to read password", zap.Error(err))
+		zapLogger.Error("Invalid token scope", zap.Error(err))
+		return
+	}
+	gracePeriod, revokeReplaced, err := parseRevokeReplacedAfter(cmd)
+	if err != nil {
+		zapLogger.Error("Invalid grace period for replaced tokens", zap.Error(err))
+		return
+	}
+	concurrency := config.GetInt(cmd, "concurrency", "CONCURRENCY")
+	if concurrency < 1 {
+		zapLogger.Error("Invalid concurrency, at least one cluster must be processed at a time", zap.Int("concurrency", concurrency))
 		return
 	}
 
 	// Use the configPath from the flag if provided, otherwise use empty string for default
 	// Empty string will automatically resolve to ~/.kube/config on Unix/macOS and %USERPROFILE%\.kube\config on Windows
-	kubecfg, err := kubeconfig.LoadKubeconfig(configPath)
+	var kubecfg *api.Config
+	if output != nil {
+		kubecfg, err = output.load(commandContext(cmd))
+	} else {
+		kubecfg, err = kubeconfig.LoadKubeconfig(configPath)
+	}
 	if err != nil {
-		zapLogger.Error("Failed to load kubeconfig file", zap.Error(err))
+		zapLogger.Error("Failed to load kubeconfig file", zap.Error(err), hintField(err))
 		return
 	}
+	// Other tools may change the file while clusters are processed; this is the common ancestor for merging
+	baseKubecfg := kubecfg.DeepCopy()
+
+	// Anchors are expanded on load, so the file can only be written back in expanded form.
+	// A kubeconfig kept in a secret manager is only ever written by this tool.
+	if output == nil {
+		if anchored, err := kubeconfig.UsesYAMLAnchors(configPath); err != nil {
+			zapLogger.Warn("Failed to check kubeconfig for YAML anchors", zap.Error(err))
+		} else if anchored && !dryRun {
+			zapLogger.Warn("Kubeconfig uses YAML anchors or aliases; they will be expanded into plain entries when the file is saved (the backup keeps the original)")
+		}
+	}
 
 	// Check if this is a new config (no users means it's newly created)
-	if len(kubecfg.AuthInfos) == 0 && len(kubecfg.Clusters) == 0 && len(kubecfg.Contexts) == 0 {
+	if output == nil && len(kubecfg.AuthInfos) == 0 && len(kubecfg.Clusters) == 0 && len(kubecfg.Contexts) == 0 {
 		zapLogger.Info("Creating new kubeconfig file at default location")
 	}
 
-	// Determine auth type
-	authType := rancher.AuthTypeLocal
-	if rancherAuthType == "ldap" {
-		authType = rancher.AuthTypeLDAP
-	} else if rancherAuthType == "local" {
-		authType = rancher.AuthTypeLocal
-	} else if rancherAuthType != "" {
-		zapLogger.Error("Invalid auth-type value. Must be 'local' or 'ldap'")
-		return
+	// Shared tokens are checked only once, but regenerating one entry leaves the others on the old token
+	for _, users := range kubeconfig.FindSharedTokens(kubecfg) {
+		zapLogger.Warn("Multiple kubeconfig entries share the same Rancher token; revoking it would break all of them",
+			zap.String("users", strings.Join(users, ", ")))
 	}
 
-	client, err := rancher.NewClient(rancherURL, rancherUsername, rancherPassword, authType, zapLogger, insecureSkipTLSVerify)
+	settings, err := resolveRancherSettings(cmd)
 	if err != nil {
-		zapLogger.Error("Failed to authenticate with Rancher", zap.Error(err))
+		zapLogger.Error("Failed to create Rancher client", zap.Error(err))
 		return
 	}
-
-	clusters, err := client.ListClusters()
-	if err != nil {
-		zapLogger.Error("Failed to retrieve cluster list from Rancher", zap.Error(err))
-		return
+	settings.apiMetrics = apiMetrics
+	if !asOf.IsZero() {
+		settings.clock = rancher.FixedClock(asOf)
 	}
-
-	// Filter clusters if --cluster flag is specified
-	if clusterFlag != "" {
-		clusters = filterClusters(clusters, clusterFlag, zapLogger)
+	// Several servers log in with the same password, which is read only once
+	credentials := newCredentialSource(cmd, settings)
+	defer credentials.clear()
+	for _, serverSettings := range settings.perServer() {
+		record.AddServer(serverSettings.url)
 	}
 
-	// Track dry-run statistics
-	var clustersToUpdate, clustersToSkip int
-
-	for _, v := range clusters {
-		// Get current token from kubeconfig if it exists
-		var currentToken string
-		if authInfo, exists := kubecfg.AuthInfos[v.Name]; exists {
-			currentToken = authInfo.Token
-		}
-
-		// Determine if token regeneration is needed
-		decision := client.DetermineTokenRegeneration(currentToken, forceRefresh, thresholdDays, v.Name)
+	opts := clusterOptions{
+		Options: pipeline.Options{
+			ThresholdDays:  thresholdDays,
+			ForceRefresh:   forceRefresh,
+			DryRun:         dryRun,
+			AutoCreate:     autoCreate || clusterList != nil || autoCreateOnly != nil,
+			AutoCreateOnly: autoCreateOnly,
+			WithDirectly:   withDirectly,
+			ExecCommand:    execCommand,
+			Gateways:       gateways,
+			Policy:         rotationPolicy,
+			MaxTokenAge:    maxTokenAge,
+			TokenScope:     tokenScope,
+			RenewTokens:    config.GetBool(cmd, "renew-tokens", "RENEW_TOKENS"),
+			RevokeReplaced: revokeReplaced,
+			GracePeriod:    gracePeriod,
+			Origin:         origin,
+			Plan:           runPlan,
+			Stream:         stream,
+			Hint:           Hint,
+		},
+		clusterList: clusterList,
+		stagger:     config.GetDuration(cmd, "stagger", "STAGGER"),
+		concurrency: concurrency,
+		history:     record,
+		expiries:    expiries,
+	}
+	if notifyConfig != nil {
+		opts.Events = notify.NewRecorder()
+		defer sendNotifications(cmd, notifyConfig, opts.Events, zapLogger)
+	}
 
-		// Log decision and skip if regeneration not needed
-		logTokenDecision(zapLogger, decision, v.Name, dryRun)
+	planOutput, _ := cmd.Flags().GetString("plan-output")
 
-		if !decision.ShouldRegenerate {
-			clustersToSkip++
-			continue
+	// Without state, manual edits can't be detected, so the run continues as before
+	opts.State, opts.KubeconfigPath = loadState(cmd, configPath, zapLogger)
+	if output != nil {
+		opts.KubeconfigPath = output.ref
+	}
+	record.SetKubeconfig(opts.KubeconfigPath)
+	opts.ForceOverwrite = config.GetBool(cmd, "force-overwrite", "FORCE_OVERWRITE")
+	if stdinIsTerminal() {
+		opts.Confirm = promptYesNo
+		// Nothing is added in a dry run, and the updates of a daemon or the tray can't wait for an answer
+		if sched, _ := parseSchedule(cmd); !dryRun && sched == nil && !trayEnabled(cmd) && !config.GetBool(cmd, "yes", "ASSUME_YES") {
+			opts.selectNew = promptSelection
 		}
+	}
 
-		clustersToUpdate++
-
-		// Skip actual token regeneration and kubeconfig update in dry-run mode
-		if dryRun {
-			continue
+	var result serverResult
+	var progress *progressSaver
+	if len(settings.servers) > 1 {
+		kubecfg, result, err = processServers(cmd, settings, credentials, kubecfg, opts, zapLogger)
+		if err != nil {
+			zapLogger.Error("Failed to process Rancher servers", zap.Error(err))
+			return
 		}
-
-		// Get full kubeconfig from Rancher (includes Downstream Directly contexts if available)
-		clusterKubeconfig, err := client.GetClusterKubeconfig(v.ID)
+	} else {
+		// Clusters finished by an interrupted run are skipped, progress is saved every few refreshed clusters
+		cp, err := openCheckpoint(cmd, output, settings.url, zapLogger)
 		if err != nil {
-			zapLogger.Error("Failed to get kubeconfig for cluster",
-				zap.String("cluster", v.Name),
-				zap.Error(err))
-			continue
+			zapLogger.Error("Failed to open checkpoint", zap.Error(err))
+			return
 		}
-
-		// Check if we should use the new merge approach or legacy approach
-		if withDirectly || autoCreate {
-			// Use MergeKubeconfig for new approach (supports Downstream Directly)
-			kubeconfig.MergeKubeconfig(kubecfg, clusterKubeconfig, v.Name, withDirectly)
-			if withDirectly {
-				// Count direct contexts for logging
-				directCount := countDirectContexts(clusterKubeconfig, v.Name)
-				if directCount > 0 {
-					zapLogger.Info("Successfully updated kubeconfig with direct contexts",
-						zap.String("cluster", v.Name),
-						zap.Int("directContexts", directCount))
-				} else {
-					zapLogger.Info("Successfully updated kubeconfig token for cluster: " + v.Name)
-				}
-			} else {
-				zapLogger.Info("Successfully updated kubeconfig token for cluster: " + v.Name)
-			}
-		} else {
-			// Legacy approach: deterministically extract token from CurrentContext chain
-			token, ok := kubeconfig.ExtractTokenFromKubeconfig(clusterKubeconfig)
-			if !ok {
-				zapLogger.Error("Failed to extract token from kubeconfig",
-					zap.String("cluster", v.Name),
-					zap.String("reason", "empty or invalid CurrentContext/AuthInfo chain"))
-				continue
-			}
-			err = kubeconfig.UpdateTokenByName(kubecfg, v.ID, v.Name, token, rancherURL, autoCreate, zapLogger)
-			if err != nil {
-				// Error is already logged in UpdateTokenByName
-				continue
-			}
-			zapLogger.Info("Successfully updated kubeconfig token for cluster: " + v.Name)
+		progress = &progressSaver{cp: cp, every: checkpointEvery(cmd), base: baseKubecfg, saveOpts: saveOpts}
+		result = processServer(cmd, settings, credentials, kubecfg, opts, progress, cmd.OutOrStdout(), zapLogger)
+		if result.err != nil {
+			// Error is already logged in processServer
+			return
 		}
+		baseKubecfg = progress.base
+	}
+	// Clusters outside Rancher are maintained in the same kubeconfig
+	if staticClusters != nil {
+		static := processStaticClusters(commandContext(cmd), kubecfg, staticClusters, opts, zapLogger)
+		result.updated += static.updated
+		result.skipped += static.skipped
+		result.failed += static.failed
 	}
+	// The golden kubeconfig is merged last, so its contexts find the tokens of this run
+	if goldenCfg != nil {
+		applyGolden(kubecfg, goldenCfg, goldenSource, opts, zapLogger)
+	}
+	clustersToUpdate, clustersToSkip := result.updated, result.skipped
 
 	// Skip saving in dry-run mode and show summary
 	if dryRun {
@@ -206,69 +500,156 @@ func run(cmd *cobra.Command, args []string) {
 			zap.Int("clustersToUpdate", clustersToUpdate),
 			zap.Int("clustersToSkip", clustersToSkip))
 		zapLogger.Info("[DRY-RUN] No changes were made to kubeconfig")
+		writePlan(opts.Plan, planOutput, zapLogger)
+		if !asOf.IsZero() {
+			if err := printAsOf(cmd.OutOrStdout(), asOf, opts.Plan); err != nil {
+				zapLogger.Error("Failed to print preview", zap.Error(err))
+			}
+		}
+		return
+	}
+
+	// The tokens generated for the successful clusters stay valid in Rancher, they are just not written
+	if !saving.allowsSave(result.failed) {
+		zapLogger.Error("Some clusters failed, leaving the kubeconfig untouched (--save-policy all-or-nothing)",
+			zap.Int("clustersFailed", result.failed),
+			zap.Int("clustersNotSaved", clustersToUpdate))
+		return
+	}
+
+	if output != nil {
+		if err := output.save(commandContext(cmd), kubecfg); err != nil {
+			zapLogger.Error("Failed to save kubeconfig to the secret manager", zap.Error(err))
+			opts.Events.Add(notify.Event{Type: notify.EventFailed, Server: settings.url, Message: "failed to save kubeconfig: " + err.Error()})
+			return
+		}
+		record.Saved()
+		stream.Emit(eventstream.Event{Type: eventstream.TypeSaved, Path: output.ref})
+		if opts.State != nil {
+			if err := opts.State.Save(); err != nil {
+				zapLogger.Warn("Failed to save state file", zap.Error(err))
+			}
+		}
+		zapLogger.Info("All cluster tokens have been updated successfully", zap.String("output", output.ref))
+		writeManifest(manifestExport, kubecfg, zapLogger)
+		writeContextDir(cmd, kubecfg, zapLogger)
+		writePlan(opts.Plan, planOutput, zapLogger)
 		return
 	}
 
-	err = kubeconfig.SaveKubeconfig(kubecfg, configPath, zapLogger)
+	// The kubeconfig and the state describing it are written together or not at all.
+	// The checkpoint is kept while clusters failed, so the next run only retries those.
+	kubecfg, err = commitKubeconfig(baseKubecfg, kubecfg, opts.State, progress.checkpoint(), saveOpts, zapLogger)
 	if err != nil {
-		zapLogger.Error("Failed to save kubeconfig file", zap.Error(err))
+		zapLogger.Error("Failed to save kubeconfig", zap.Error(err))
+		opts.Events.Add(notify.Event{Type: notify.EventFailed, Server: settings.url, Message: "failed to save kubeconfig: " + err.Error()})
 		return
 	}
+	record.Saved()
+	stream.Emit(eventstream.Event{Type: eventstream.TypeSaved, Path: opts.KubeconfigPath})
+	if result.failed == 0 {
+		progress.finish(zapLogger)
+	}
 
 	zapLogger.Info("All cluster tokens have been updated successfully")
+	writeManifest(manifestExport, kubecfg, zapLogger)
+	writeContextDir(cmd, kubecfg, zapLogger)
+	writePlan(opts.Plan, planOutput, zapLogger)
 }
 
-// logTokenDecision logs the token regeneration decision with consistent formatting
-func logTokenDecision(logger *zap.Logger, decision rancher.TokenRegenerationDecision, clusterName string, dryRun bool) {
-	if !decision.ShouldRegenerate {
-		// Log skip decisions
-		if dryRun {
-			logger.Info("[DRY-RUN] Would skip token regeneration",
-				zap.String("cluster", clusterName),
-				zap.String("reason", string(decision.Reason)),
-				zap.Float64("daysUntilExpiration", decision.DaysUntilExpiry))
-		} else {
-			switch decision.Reason {
-			case rancher.ReasonNeverExpires:
-				logger.Info("Token never expires, skipping regeneration",
-					zap.String("cluster", clusterName))
-			case rancher.ReasonStillValid:
-				logger.Info("Token is still valid, skipping regeneration",
-					zap.String("cluster", clusterName),
-					zap.String("expiresAt", decision.ExpiresAt.Format("2006-01-02 15:04:05")),
-					zap.Int("daysUntilExpiration", int(decision.DaysUntilExpiry)))
-			}
+// loadState loads the state file and resolves the path of the kubeconfig at path, which the
+// state is keyed by. Failures are logged and return a nil state, which disables modification detection.
+func loadState(cmd *cobra.Command, path string, zapLogger *zap.Logger) (*state.State, string) {
+	kubeconfigPath, err := kubeconfig.ResolvePath(path)
+	if err != nil {
+		zapLogger.Warn("Failed to resolve kubeconfig path, manual edits will not be detected", zap.Error(err), hintField(err))
+		return nil, ""
+	}
+	if abs, err := filepath.Abs(kubeconfigPath); err == nil {
+		kubeconfigPath = abs
+	}
+
+	statePath := config.GetConfig(cmd, "state-file", "STATE_FILE")
+	if statePath == "" {
+		if statePath, err = state.DefaultPath(); err != nil {
+			zapLogger.Warn("Failed to locate state file, manual edits will not be detected", zap.Error(err), hintField(err))
+			return nil, ""
 		}
+	}
+
+	st, err := state.Load(statePath)
+	if err != nil {
+		zapLogger.Warn("Failed to load state file, manual edits will not be detected", zap.Error(err))
+		return nil, ""
+	}
+	return st, kubeconfigPath
+}
+
+// writeManifest writes the --manifest export; it does nothing when no manifest was requested
+func writeManifest(m *manifestExport, kubecfg *api.Config, zapLogger *zap.Logger) {
+	if m == nil {
 		return
 	}
+	if err := m.write(kubecfg); err != nil {
+		zapLogger.Error("Failed to write kubeconfig manifest", zap.Error(err))
+	}
+}
 
-	// Log regeneration decisions
-	if dryRun {
-		logger.Info("[DRY-RUN] Would regenerate token",
-			zap.String("cluster", clusterName),
-			zap.String("reason", string(decision.Reason)),
-			zap.Float64("daysUntilExpiration", decision.DaysUntilExpiry))
-	} else {
-		switch decision.Reason {
-		case rancher.ReasonForceRefreshEnabled:
-			logger.Info("Force refresh enabled, regenerating token",
-				zap.String("cluster", clusterName))
-		case rancher.ReasonNoExistingToken:
-			logger.Info("No existing token, generating new token",
-				zap.String("cluster", clusterName))
-		case rancher.ReasonExpiresSoon:
-			logger.Info("Token expires soon, regenerating",
-				zap.String("cluster", clusterName),
-				zap.String("expiresAt", decision.ExpiresAt.Format("2006-01-02 15:04:05")),
-				zap.Int("daysUntilExpiration", int(decision.DaysUntilExpiry)))
-		case rancher.ReasonNeverExpiresButRefreshRequired:
-			logger.Info("Regenerating token (never expires but refresh required)",
-				zap.String("cluster", clusterName))
-		case rancher.ReasonExpirationCheckFailed:
-			logger.Info("Regenerating token due to expiration check failure",
-				zap.String("cluster", clusterName))
+// writeContextDir writes the per-context kubeconfigs for --context-dir; it does nothing when no directory was given
+func writeContextDir(cmd *cobra.Command, kubecfg *api.Config, zapLogger *zap.Logger) {
+	dir := config.GetConfig(cmd, "context-dir", "CONTEXT_DIR")
+	if dir == "" {
+		return
+	}
+	if err := writeContextFiles(kubecfg, dir); err != nil {
+		zapLogger.Error("Failed to write per-context kubeconfigs", zap.String("dir", dir), zap.Error(err))
+	}
+}
+
+// writePlan writes the recorded plan for --plan-output; it does nothing when no plan was requested
+func writePlan(p *plan.Plan, path string, zapLogger *zap.Logger) {
+	if p == nil || path == "" {
+		return
+	}
+	if err := p.WriteFile(path); err != nil {
+		zapLogger.Error("Failed to write plan", zap.Error(err))
+	}
+}
+
+// clusterOptions holds the per-run settings: how a single cluster is processed, and how the
+// clusters of a server are run
+type clusterOptions struct {
+	pipeline.Options
+	// selectNew asks which new clusters auto-create adds; it returns the chosen names (nil when not interactive)
+	selectNew func(names []string) []string
+	// history records the failed clusters of the run (nil in tests)
+	history *history.Recorder
+	// expiries collects the token expiry of every server for --textfile-dir (nil when not requested)
+	expiries *expiryCollector
+	// stagger is the longest random pause before each cluster and each additional server (0 for none)
+	stagger time.Duration
+	// concurrency is how many clusters of a server are processed at the same time (0 or 1 for one after another)
+	concurrency int
+	// clusterList selects the clusters to create or refresh entries for (nil for all clusters)
+	clusterList *clusterlist.List
+	// contextNames qualifies cluster names with their server in a run against several servers (nil for a single server)
+	contextNames *contextNames
+}
+
+// localClusterID is the ID Rancher gives its own management cluster
+const localClusterID = "local"
+
+// excludeLocalCluster removes Rancher's management cluster from clusters
+func excludeLocalCluster(clusters rancher.Clusters, logger *zap.Logger) rancher.Clusters {
+	filtered := make(rancher.Clusters, 0, len(clusters))
+	for _, cluster := range clusters {
+		if cluster.ID == localClusterID {
+			logger.Info("Skipping Rancher management cluster", zap.String("cluster", cluster.Name))
+			continue
 		}
+		filtered = append(filtered, cluster)
 	}
+	return filtered
 }
 
 // filterClusters filters clusters based on comma-separated cluster names or IDs
@@ -347,16 +728,3 @@ func filterClusters(clusters rancher.Clusters, clusterFilter string, logger *zap
 
 	return filteredClusters
 }
-
-// countDirectContexts counts the number of Downstream Directly contexts in a kubeconfig
-// Direct contexts are identified by having a name that starts with "{clusterName}-"
-func countDirectContexts(cfg *api.Config, clusterName string) int {
-	count := 0
-	prefix := clusterName + "-"
-	for ctxName := range cfg.Contexts {
-		if strings.HasPrefix(ctxName, prefix) {
-			count++
-		}
-	}
-	return count
-}
@@ -1,10 +1,17 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/appdir"
+	"rancher-kubeconfig-updater/internal/i18n"
 	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"rancher-kubeconfig-updater/internal/state"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
 )
@@ -567,3 +574,92 @@ func TestNewRootCmd_WithDirectlyFlagInitialization(t *testing.T) {
 	// After parsing, the global withDirectly variable should be set
 	assert.True(t, withDirectly)
 }
+
+// TestIncludeLocalFlag_FlagRegistered tests that the --include-local flag defaults to the previous behavior
+func TestIncludeLocalFlag_FlagRegistered(t *testing.T) {
+	cmd := NewRootCmd()
+
+	includeLocalFlag := cmd.Flags().Lookup("include-local")
+	assert.NotNil(t, includeLocalFlag, "include-local flag should be registered")
+	assert.Equal(t, "true", includeLocalFlag.DefValue, "include-local flag should default to true")
+}
+
+// TestExcludeLocalCluster tests that only the management cluster is removed
+func TestExcludeLocalCluster(t *testing.T) {
+	clusters := rancher.Clusters{
+		{ID: "local", Name: "local"},
+		{ID: "c-m-12345", Name: "production"},
+		{ID: "c-m-67890", Name: "local-dev"},
+	}
+
+	filtered := excludeLocalCluster(clusters, zap.NewNop())
+
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, "production", filtered[0].Name)
+	assert.Equal(t, "local-dev", filtered[1].Name)
+}
+
+func TestApplyLanguage(t *testing.T) {
+	t.Cleanup(func() { i18n.SetLanguage(i18n.English) })
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "zh_TW.UTF-8")
+
+	rootCmd := NewRootCmd()
+	require.NoError(t, applyLanguage(rootCmd, nil))
+	assert.Equal(t, i18n.TraditionalChinese, i18n.Current())
+
+	require.NoError(t, rootCmd.ParseFlags([]string{"--lang", "en"}))
+	require.NoError(t, applyLanguage(rootCmd, nil))
+	assert.Equal(t, i18n.English, i18n.Current())
+
+	require.NoError(t, rootCmd.ParseFlags([]string{"--lang", "fr"}))
+	assert.Error(t, applyLanguage(rootCmd, nil))
+}
+
+func TestApplyGlobalFlags_StateDir(t *testing.T) {
+	t.Cleanup(func() { appdir.Set("") })
+	t.Setenv("STATE_DIR", "")
+	dir := t.TempDir()
+
+	rootCmd := NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--state-dir", dir}))
+	require.NoError(t, applyGlobalFlags(rootCmd, nil))
+	statePath, err := state.DefaultPath()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "state.json"), statePath, "the state file is kept in --state-dir")
+
+	envDir := t.TempDir()
+	t.Setenv("STATE_DIR", envDir)
+	require.NoError(t, applyGlobalFlags(NewRootCmd(), nil))
+	statePath, err = state.DefaultPath()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(envDir, "state.json"), statePath)
+}
+
+func TestUpdate_ReadOnly(t *testing.T) {
+	t.Cleanup(func() {
+		appdir.Set("")
+		readonly.Set(false)
+	})
+	var logins int32
+	server := newFleetServer(t, &logins, "me", rancher.Cluster{ID: "c-prod", Name: "prod"})
+
+	dir := t.TempDir()
+	stateDir := t.TempDir()
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("READ_ONLY", "")
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--server", server.URL, "--user", "admin", "-c", filepath.Join(dir, "config"), "--auto-create",
+		"--state-dir", stateDir, "--read-only"})
+	require.NoError(t, cmd.Execute())
+
+	assert.True(t, readonly.Enabled())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "no kubeconfig or backup is written")
+	entries, err = os.ReadDir(stateDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "no state or run history is written")
+}
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// NewRunCmd creates the command that runs another command against a temporary kubeconfig.
+func NewRunCmd() *cobra.Command {
+	runCmd := &cobra.Command{
+		Use:   "run [flags] -- command [args...]",
+		Short: "Run a command with a temporary kubeconfig for Rancher clusters",
+		Long: "Writes a temporary kubeconfig for the selected clusters, runs the command with\n" +
+			"KUBECONFIG pointing at it, and removes the file afterwards. The tokens created\n" +
+			"for the run are revoked once the command exits, so no credentials are left\n" +
+			"behind (useful for CI jobs). With --ephemeral, they are also short-lived, so\n" +
+			"they expire even if revoking them fails.",
+		Args:          cobra.MinimumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          runRun,
+	}
+
+	// Everything after the first positional argument belongs to the wrapped command
+	runCmd.Flags().SetInterspersed(false)
+
+	runCmd.Flags().Bool("ephemeral", false, "Create the tokens of this run with a short TTL, so they expire even if revoking them fails")
+	runCmd.Flags().Duration("ttl", time.Hour, "TTL of tokens created with --ephemeral")
+	runCmd.Flags().String("cluster", "", "Comma-separated list of cluster names or IDs to include")
+	runCmd.Flags().Bool("include-local", true, "Include Rancher's 'local' management cluster (use --include-local=false to skip it)")
+	addRancherFlags(runCmd)
+
+	return runCmd
+}
+
+func runRun(cmd *cobra.Command, args []string) error {
+	zapLogger := logger.NewLogger()
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	ephemeral := config.GetBool(cmd, "ephemeral", "EPHEMERAL")
+	ttl, _ := cmd.Flags().GetDuration("ttl")
+	clusterFilter, _ := cmd.Flags().GetString("cluster")
+
+	client, _, err := newRancherClient(cmd, zapLogger)
+	if err != nil {
+		zapLogger.Error("Failed to create Rancher client", zap.Error(err))
+		return &ExitError{Code: 1}
+	}
+
+	clusters, err := client.ListClusters()
+	if err != nil {
+		zapLogger.Error("Failed to retrieve cluster list from Rancher", zap.Error(err))
+		return &ExitError{Code: 1}
+	}
+	if !config.GetBool(cmd, "include-local", "INCLUDE_LOCAL") {
+		clusters = excludeLocalCluster(clusters, zapLogger)
+	}
+	if clusterFilter != "" {
+		clusters = filterClusters(clusters, clusterFilter, zapLogger)
+	}
+
+	// Revoke every token created for this run, whatever the outcome of the command
+	var createdTokens []string
+	defer func() {
+		for _, tokenName := range createdTokens {
+			if err := client.RevokeToken(tokenName); err != nil {
+				zapLogger.Error("Failed to revoke token created for the run", zap.String("tokenName", tokenName), zap.Error(err))
+				continue
+			}
+			zapLogger.Info("Revoked token created for the run", zap.String("tokenName", tokenName))
+		}
+	}()
+
+	origin := pipeline.NewOrigin()
+	tempCfg := api.NewConfig()
+	for _, v := range clusters {
+		if ephemeral {
+			clusterKubeconfig, token, err := ephemeralKubeconfig(client, v, ttl, origin, zapLogger)
+			if err != nil {
+				zapLogger.Error("Failed to create ephemeral token", zap.String("cluster", v.Name), zap.Error(err))
+				return &ExitError{Code: 1}
+			}
+			if tokenName, err := rancher.TokenName(token); err == nil {
+				createdTokens = append(createdTokens, tokenName)
+			}
+			kubeconfig.MergeKubeconfig(tempCfg, clusterKubeconfig, v.Name, false)
+			continue
+		}
+
+		clusterKubeconfig, err := client.GetClusterKubeconfig(v.ID)
+		if err != nil {
+			zapLogger.Error("Failed to get kubeconfig for cluster", zap.String("cluster", v.Name), zap.Error(err))
+			return &ExitError{Code: 1}
+		}
+		// Rancher generated a token for the kubeconfig, which only this run uses
+		if token, ok := kubeconfig.ExtractTokenFromKubeconfig(clusterKubeconfig); ok {
+			if tokenName, err := rancher.TokenName(token); err == nil {
+				createdTokens = append(createdTokens, tokenName)
+			}
+		}
+		kubeconfig.MergeKubeconfig(tempCfg, clusterKubeconfig, v.Name, false)
+	}
+
+	// A single cluster becomes the current context so commands work without --context
+	if len(clusters) == 1 {
+		tempCfg.CurrentContext = clusters[0].Name
+	}
+
+	kubeconfigPath, cleanup, err := writeTempKubeconfig(tempCfg)
+	if err != nil {
+		zapLogger.Error("Failed to write temporary kubeconfig", zap.Error(err))
+		return &ExitError{Code: 1}
+	}
+	defer cleanup()
+
+	code, err := runChild(commandContext(cmd), args, []string{"KUBECONFIG=" + kubeconfigPath})
+	if err != nil {
+		zapLogger.Error("Failed to run command", zap.String("command", args[0]), zap.Error(err))
+		return &ExitError{Code: 127}
+	}
+	if code != 0 {
+		return &ExitError{Code: code}
+	}
+	return nil
+}
+
+// ephemeralKubeconfig returns the kubeconfig Rancher generates for the cluster with its token
+// replaced by a short-lived one, so the cluster entry keeps Rancher's CA and TLS settings.
+// The generated token is revoked right away; the returned token is the ephemeral one.
+func ephemeralKubeconfig(client *rancher.Client, v rancher.Cluster, ttl time.Duration, origin pipeline.Origin, zapLogger *zap.Logger) (*api.Config, string, error) {
+	clusterKubeconfig, err := client.GetClusterKubeconfig(v.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get kubeconfig: %w", err)
+	}
+	if generated, ok := kubeconfig.ExtractTokenFromKubeconfig(clusterKubeconfig); ok {
+		defer func() {
+			tokenName, err := rancher.TokenName(generated)
+			if err == nil {
+				err = client.RevokeToken(tokenName)
+			}
+			if err != nil {
+				zapLogger.Warn("Failed to revoke generated token", zap.String("cluster", v.Name), zap.Error(err))
+			}
+		}()
+	}
+
+	token, err := client.CreateToken(v.ID, ttl, origin.Description("ephemeral token"), origin.Labels())
+	if err != nil {
+		return nil, "", err
+	}
+	// The ephemeral token also replaces exec auth, which Rancher generates instead of a token on some servers
+	for _, authInfo := range clusterKubeconfig.AuthInfos {
+		if authInfo != nil {
+			authInfo.Token, authInfo.Exec = token, nil
+		}
+	}
+	return clusterKubeconfig, token, nil
+}
+
+// writeTempKubeconfig writes cfg to a new private temporary file.
+// The returned cleanup function removes the file.
+func writeTempKubeconfig(cfg *api.Config) (string, func(), error) {
+	if err := readonly.Check(os.TempDir()); err != nil {
+		return "", func() {}, err
+	}
+	f, err := os.CreateTemp("", "rancher-kubeconfig-*.yaml")
+	if err != nil {
+		return "", func() {}, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	path := f.Name()
+	_ = f.Close()
+
+	cleanup := func() {
+		_ = os.Remove(path)
+	}
+
+	if err := clientcmd.WriteToFile(*cfg, path); err != nil {
+		cleanup()
+		return "", func() {}, fmt.Errorf("failed to write kubeconfig file: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		cleanup()
+		return "", func() {}, fmt.Errorf("failed to set file permissions: %w", err)
+	}
+
+	return path, cleanup, nil
+}
+
+// runChild runs args as a child process with extraEnv appended to the current environment.
+// It returns the child's exit code; an error is only returned if the child could not be started.
+func runChild(ctx context.Context, args []string, extraEnv []string) (int, error) {
+	child := exec.Command(args[0], args[1:]...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	child.Env = append(os.Environ(), extraEnv...)
+
+	if err := child.Start(); err != nil {
+		return 0, err
+	}
+
+	// Keep running while the child handles interrupts so cleanup still happens;
+	// the signal is forwarded in case it did not come from the terminal
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	done := make(chan error, 1)
+	go func() { done <- child.Wait() }()
+
+	ctxDone := ctx.Done()
+	for {
+		select {
+		case sig := <-signals:
+			_ = child.Process.Signal(sig)
+		case <-ctxDone:
+			_ = child.Process.Kill()
+			ctxDone = nil
+		case err := <-done:
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				if code := exitErr.ExitCode(); code >= 0 {
+					return code, nil
+				}
+				// Terminated by a signal
+				return 1, nil
+			}
+			if err != nil {
+				return 0, err
+			}
+			return 0, nil
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestRunCmd_FlagsRegistered(t *testing.T) {
+	cmd := NewRunCmd()
+
+	ephemeralFlag := cmd.Flags().Lookup("ephemeral")
+	require.NotNil(t, ephemeralFlag)
+	assert.Equal(t, "false", ephemeralFlag.DefValue)
+
+	ttlFlag := cmd.Flags().Lookup("ttl")
+	require.NotNil(t, ttlFlag)
+	assert.Equal(t, "1h0m0s", ttlFlag.DefValue)
+
+	assert.NotNil(t, cmd.Flags().Lookup("cluster"))
+}
+
+func TestRunCmd_ArgumentsAfterCommandAreNotParsed(t *testing.T) {
+	cmd := NewRunCmd()
+
+	err := cmd.ParseFlags([]string{"--ephemeral", "make", "deploy", "--ttl", "5m"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"make", "deploy", "--ttl", "5m"}, cmd.Flags().Args())
+	ttl, _ := cmd.Flags().GetDuration("ttl")
+	assert.Equal(t, "1h0m0s", ttl.String(), "flags after the command belong to the child")
+}
+
+func TestWriteTempKubeconfig(t *testing.T) {
+	cfg := api.NewConfig()
+	cfg.Clusters["prod"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-m-1"}
+	cfg.AuthInfos["prod"] = &api.AuthInfo{Token: "token-abc:secret"}
+	cfg.Contexts["prod"] = &api.Context{Cluster: "prod", AuthInfo: "prod"}
+	cfg.CurrentContext = "prod"
+
+	path, cleanup, err := writeTempKubeconfig(cfg)
+	require.NoError(t, err)
+
+	loaded, err := clientcmd.LoadFromFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "token-abc:secret", loaded.AuthInfos["prod"].Token)
+	assert.Equal(t, "prod", loaded.CurrentContext)
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	cleanup()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunChild_PropagatesExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	code, err := runChild(context.Background(), []string{"sh", "-c", "exit 3"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, code)
+
+	code, err = runChild(context.Background(), []string{"sh", "-c", `test "$KUBECONFIG" = /tmp/kc`}, []string{"KUBECONFIG=/tmp/kc"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, code)
+}
+
+func TestRunChild_CommandNotFound(t *testing.T) {
+	_, err := runChild(context.Background(), []string{"definitely-not-a-real-command-xyz"}, nil)
+	assert.Error(t, err)
+}
+
+func TestExitError(t *testing.T) {
+	err := &ExitError{Code: 42}
+	assert.Equal(t, "exit status 42", err.Error())
+}
+
+func TestRunRun_RevokesGeneratedTokens(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses the true command")
+	}
+	var logins int32
+	fleet := newFleetServer(t, &logins, "admin", rancher.Cluster{ID: "c-1", Name: "prod"})
+	var revoked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			revoked = append(revoked, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		fleet.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	cmd := NewRunCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", server.URL, "--user", "admin", "true"}))
+	require.NoError(t, runRun(cmd, cmd.Flags().Args()))
+
+	// Without --ephemeral, the token Rancher generated for the kubeconfig is revoked too
+	assert.Equal(t, []string{"/v3/tokens/kubeconfig-u-admin"}, revoked)
+}
+
+func TestEphemeralKubeconfig_KeepsClusterEntry(t *testing.T) {
+	var revoked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v3-public/localProviders/local":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "session-token"}`))
+		case r.URL.Query().Get("action") == "generateKubeconfig":
+			cfg := api.NewConfig()
+			cfg.Clusters["prod"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-1", CertificateAuthorityData: []byte("rancher-ca")}
+			cfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-abc:generated"}
+			cfg.Contexts["prod"] = &api.Context{Cluster: "prod", AuthInfo: "prod"}
+			cfg.CurrentContext = "prod"
+			data, _ := clientcmd.Write(*cfg)
+			_ = json.NewEncoder(w).Encode(map[string]string{"config": string(data)})
+		case r.Method == http.MethodPost && r.URL.Path == "/v3/tokens":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "token-eph:secret"}`))
+		case r.Method == http.MethodDelete:
+			revoked = append(revoked, strings.TrimPrefix(r.URL.Path, "/v3/tokens/"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	cmd := NewRunCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", server.URL, "--user", "admin"}))
+	client, _, err := newRancherClient(cmd, zap.NewNop())
+	require.NoError(t, err)
+
+	cfg, token, err := ephemeralKubeconfig(client, rancher.Cluster{ID: "c-1", Name: "prod"}, time.Hour, pipeline.NewOrigin(), zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "token-eph:secret", token)
+	assert.Equal(t, []byte("rancher-ca"), cfg.Clusters["prod"].CertificateAuthorityData)
+	assert.Equal(t, "token-eph:secret", cfg.AuthInfos["prod"].Token)
+	assert.Equal(t, []string{"kubeconfig-u-abc"}, revoked, "the generated token is revoked right away")
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/privilege"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// addSaveFlags registers the flags that control how the kubeconfig file is written
+func addSaveFlags(cmd *cobra.Command) {
+	cmd.Flags().String("file-mode", "", "Permissions of the written kubeconfig, e.g. 0640 to let the group read it (default: 0600)")
+	cmd.Flags().String("chown", "", "Owner of the written kubeconfig as user:group (requires privileges, not supported on Windows)")
+	cmd.Flags().String("write-strategy", "rename", "How the kubeconfig is replaced: 'rename' (atomic, falls back to copy if the filesystem refuses) or 'copy' (in place, for NFS and synced folders)")
+	cmd.Flags().Bool("no-fsync", false, "Don't sync the written files to disk (faster, but a power loss right after a run can corrupt the kubeconfig)")
+	cmd.Flags().String("save-policy", string(savePolicyBestEffort), "Whether the kubeconfig is saved when some clusters failed: 'best-effort' saves the successful updates, 'all-or-nothing' leaves the file untouched")
+	cmd.Flags().Bool("allow-root", false, "Allow running as root (or elevated on Windows) against a kubeconfig that belongs to another user")
+}
+
+// savePolicy decides whether a run in which some clusters failed saves the kubeconfig
+type savePolicy string
+
+const (
+	// savePolicyBestEffort saves the clusters that were updated successfully
+	savePolicyBestEffort savePolicy = "best-effort"
+	// savePolicyAllOrNothing only saves when every cluster was processed
+	savePolicyAllOrNothing savePolicy = "all-or-nothing"
+)
+
+// parseSavePolicy parses a save policy name; an empty string selects best-effort.
+func parseSavePolicy(s string) (savePolicy, error) {
+	switch savePolicy(s) {
+	case "", savePolicyBestEffort:
+		return savePolicyBestEffort, nil
+	case savePolicyAllOrNothing:
+		return savePolicyAllOrNothing, nil
+	default:
+		return "", fmt.Errorf("invalid save policy %q. Must be 'best-effort' or 'all-or-nothing'", s)
+	}
+}
+
+// allowsSave reports whether the kubeconfig may be saved when the given number of clusters failed
+func (p savePolicy) allowsSave(failed int) bool {
+	return failed == 0 || p != savePolicyAllOrNothing
+}
+
+// resolveSavePolicy reads --save-policy. All-or-nothing can't be combined with --checkpoint,
+// which saves the kubeconfig along the way.
+func resolveSavePolicy(cmd *cobra.Command) (savePolicy, error) {
+	policy, err := parseSavePolicy(config.GetConfig(cmd, "save-policy", "SAVE_POLICY"))
+	if err != nil {
+		return "", err
+	}
+	if policy == savePolicyAllOrNothing && config.GetConfig(cmd, "checkpoint", "CHECKPOINT") != "" {
+		return "", fmt.Errorf("--save-policy %s can't be combined with --checkpoint, which saves progress along the way", policy)
+	}
+	return policy, nil
+}
+
+// saveOptions resolves the file mode, owner, write strategy and sync settings into kubeconfig save options
+func saveOptions(cmd *cobra.Command, zapLogger *zap.Logger) ([]kubeconfig.SaveOption, error) {
+	var opts []kubeconfig.SaveOption
+	sharedHost := config.GetBool(cmd, "shared-host", "SHARED_HOST")
+
+	if value := config.GetConfig(cmd, "file-mode", "FILE_MODE"); value != "" {
+		mode, err := kubeconfig.ParseFileMode(value)
+		if err != nil {
+			return nil, err
+		}
+		if sharedHost && mode&0077 != 0 {
+			return nil, fmt.Errorf("--file-mode %s lets other users read the tokens, which --shared-host forbids", value)
+		}
+		if mode&0007 != 0 {
+			zapLogger.Warn("Kubeconfig file mode lets every user on this machine access the tokens", zap.String("mode", value))
+		}
+		opts = append(opts, kubeconfig.WithFileMode(mode))
+	} else if sharedHost {
+		// Tighten a kubeconfig that was created readable for others
+		opts = append(opts, kubeconfig.WithFileMode(0600))
+	}
+
+	strategy, err := kubeconfig.ParseWriteStrategy(config.GetConfig(cmd, "write-strategy", "WRITE_STRATEGY"))
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, kubeconfig.WithWriteStrategy(strategy))
+
+	if config.GetBool(cmd, "no-fsync", "NO_FSYNC") {
+		opts = append(opts, kubeconfig.WithoutSync())
+	}
+
+	if value := config.GetConfig(cmd, "chown", "CHOWN"); value != "" {
+		if sharedHost {
+			return nil, fmt.Errorf("--chown hands the tokens to another user, which --shared-host forbids")
+		}
+		owner, err := kubeconfig.ParseOwner(value)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kubeconfig.WithOwner(owner))
+	}
+
+	return opts, nil
+}
+
+// checkRootWrite refuses to write the kubeconfig at path as root when it belongs to another
+// user, which typically happens with `sudo` and leaves root-owned files in the user's ~/.kube.
+// With --shared-host a kubeconfig of another user is refused for everyone, --allow-root or not.
+func checkRootWrite(cmd *cobra.Command, path string) error {
+	sharedHost := config.GetBool(cmd, "shared-host", "SHARED_HOST")
+	allowRoot := config.GetBool(cmd, "allow-root", "ALLOW_ROOT")
+	if allowRoot && !sharedHost {
+		return nil
+	}
+	targetPath, err := kubeconfig.ResolvePath(path)
+	if err != nil {
+		return err
+	}
+	if sharedHost {
+		if err := privilege.CheckOwner(targetPath); err != nil {
+			return err
+		}
+	}
+	if allowRoot {
+		return nil
+	}
+	return privilege.CheckWrite(targetPath)
+}
+
+// mergeExternalChanges merges changes made to the kubeconfig file since base was loaded
+// into kubecfg, so saving doesn't discard entries written by kubectl or other tools meanwhile
+func mergeExternalChanges(base, kubecfg *api.Config, path string, zapLogger *zap.Logger) (*api.Config, error) {
+	merged, conflicts, err := kubeconfig.MergeExternalChanges(base, kubecfg, path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range conflicts {
+		zapLogger.Warn("Kubeconfig entry was also changed by another program during the run, keeping this run's version",
+			zap.String("entry", entry))
+	}
+	return merged, nil
+}
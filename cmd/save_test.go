@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSavePolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    savePolicy
+		wantErr bool
+	}{
+		{value: "", want: savePolicyBestEffort},
+		{value: "best-effort", want: savePolicyBestEffort},
+		{value: "all-or-nothing", want: savePolicyAllOrNothing},
+		{value: "some", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSavePolicy(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSavePolicy_AllowsSave(t *testing.T) {
+	assert.True(t, savePolicyBestEffort.allowsSave(0))
+	assert.True(t, savePolicyBestEffort.allowsSave(2))
+	assert.True(t, savePolicyAllOrNothing.allowsSave(0))
+	assert.False(t, savePolicyAllOrNothing.allowsSave(1))
+}
+
+func TestResolveSavePolicy_RejectsCheckpoint(t *testing.T) {
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.Flags().Set("save-policy", "all-or-nothing"))
+	require.NoError(t, cmd.Flags().Set("checkpoint", "/tmp/checkpoint.json"))
+
+	_, err := resolveSavePolicy(cmd)
+	assert.ErrorContains(t, err, "--checkpoint")
+}
+
+func TestSaveOptions_SharedHost(t *testing.T) {
+	t.Setenv("SHARED_HOST", "")
+	t.Setenv("FILE_MODE", "")
+	t.Setenv("CHOWN", "")
+
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--shared-host", "--file-mode", "0640"}))
+	_, err := saveOptions(cmd, zap.NewNop())
+	assert.ErrorContains(t, err, "lets other users read the tokens")
+
+	cmd = NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--shared-host", "--chown", "alice:alice"}))
+	_, err = saveOptions(cmd, zap.NewNop())
+	assert.ErrorContains(t, err, "--chown hands the tokens to another user")
+
+	cmd = NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--shared-host", "--file-mode", "0600"}))
+	_, err = saveOptions(cmd, zap.NewNop())
+	assert.NoError(t, err)
+}
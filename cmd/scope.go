@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/rancher"
+
+	"github.com/spf13/cobra"
+)
+
+// parseTokenScope reads --token-scope, which is empty when tokens keep the scope Rancher generates them with
+func parseTokenScope(cmd *cobra.Command) (rancher.TokenScope, error) {
+	switch value := config.GetConfig(cmd, "token-scope", "TOKEN_SCOPE"); value {
+	case "", "auto":
+		return "", nil
+	case string(rancher.TokenScopeCluster), string(rancher.TokenScopeGlobal):
+		return rancher.TokenScope(value), nil
+	default:
+		return "", fmt.Errorf("invalid token scope %q. Must be 'auto', 'cluster' or 'global'", value)
+	}
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTokenScope(t *testing.T) {
+	for value, want := range map[string]rancher.TokenScope{
+		"":        "",
+		"auto":    "",
+		"cluster": rancher.TokenScopeCluster,
+		"global":  rancher.TokenScopeGlobal,
+	} {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("token-scope", "auto", "")
+		if value != "" {
+			require.NoError(t, cmd.Flags().Set("token-scope", value))
+		}
+		scope, err := parseTokenScope(cmd)
+		require.NoError(t, err)
+		assert.Equal(t, want, scope, value)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("token-scope", "auto", "")
+	require.NoError(t, cmd.Flags().Set("token-scope", "project"))
+	_, err := parseTokenScope(cmd)
+	assert.ErrorContains(t, err, "invalid token scope")
+}
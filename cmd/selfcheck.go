@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/metrics"
+	"rancher-kubeconfig-updater/internal/notify"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/status"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// selfCheck verifies, without changing anything, that the token of every kubeconfig entry
+// could still be refreshed: that each Rancher server accepts the login, that the entry's
+// cluster still exists, and that the user may still generate kubeconfigs for it. Problems
+// are logged and sent as unrefreshable events, so they are found before the tokens expire.
+// The requests are recorded in apiMetrics, if it is not nil.
+func selfCheck(cmd *cobra.Command, apiMetrics *metrics.Registry, zapLogger *zap.Logger) {
+	var events *notify.Recorder
+	notifyConfig, err := loadNotifyConfig(cmd)
+	if err != nil {
+		zapLogger.Error("Invalid notification config", zap.Error(err))
+	} else if notifyConfig != nil {
+		events = notify.NewRecorder()
+		defer sendNotifications(cmd, notifyConfig, events, zapLogger)
+	}
+	report := func(e notify.Event) {
+		e.Type = notify.EventUnrefreshable
+		zapLogger.Warn("Self-check: token cannot be refreshed",
+			zap.String("server", e.Server), zap.String("cluster", e.Cluster), zap.String("problem", e.Message))
+		events.Add(e)
+	}
+
+	output, err := parseOutput(cmd)
+	if err != nil {
+		zapLogger.Error("Self-check failed", zap.Error(err))
+		return
+	}
+	var kubecfg *api.Config
+	if output != nil {
+		kubecfg, err = output.load(commandContext(cmd))
+	} else {
+		kubecfg, err = kubeconfig.LoadKubeconfig(configPath)
+	}
+	if err != nil {
+		zapLogger.Error("Self-check failed to load the kubeconfig", zap.Error(err))
+		return
+	}
+
+	settings, err := resolveRancherSettings(cmd)
+	if err != nil {
+		zapLogger.Error("Self-check failed", zap.Error(err))
+		return
+	}
+	settings.apiMetrics = apiMetrics
+	credentials := newCredentialSource(cmd, settings)
+	defer credentials.clear()
+	sources, clearSources := credentialsPerServer(cmd, settings, credentials)
+	defer clearSources()
+
+	problems := 0
+	for i, serverSettings := range settings.perServer() {
+		client, rancherURL, err := connectRancher(serverSettings, sources[i], zapLogger)
+		if err != nil {
+			report(notify.Event{Server: serverSettings.url, Message: "failed to log in: " + err.Error()})
+			problems++
+			continue
+		}
+		clusters, err := client.ListClusters()
+		if err != nil {
+			report(notify.Event{Server: rancherURL, Message: "failed to list clusters: " + err.Error()})
+			problems++
+			continue
+		}
+		for _, e := range checkRefreshable(status.Collect(kubecfg, rancherURL, client), clusters, rancherURL) {
+			report(e)
+			problems++
+		}
+	}
+	zapLogger.Info("Self-check finished", zap.Int("problems", problems))
+}
+
+// checkRefreshable returns an event for every entry whose token could not be refreshed from
+// the given clusters of the server at rancherURL
+func checkRefreshable(entries []status.Entry, clusters rancher.Clusters, rancherURL string) []notify.Event {
+	byID := make(map[string]rancher.Cluster, len(clusters))
+	for _, c := range clusters {
+		byID[c.ID] = c
+	}
+
+	var events []notify.Event
+	for _, entry := range entries {
+		if entry.ClusterID == "" {
+			// Entries whose cluster can't be told apart are left to the update itself
+			continue
+		}
+		var problem string
+		if cluster, ok := byID[entry.ClusterID]; !ok {
+			problem = "the cluster no longer exists in Rancher or the user lost access to it"
+		} else if !cluster.CanGenerateKubeconfig() {
+			problem = "the user is no longer allowed to generate kubeconfigs for the cluster"
+		} else {
+			continue
+		}
+		if !entry.ExpiresAt.IsZero() {
+			problem += fmt.Sprintf("; the current token expires %s", entry.ExpiresAt.UTC().Format(time.RFC3339))
+		}
+		events = append(events, notify.Event{
+			Cluster:   entry.Context,
+			ClusterID: entry.ClusterID,
+			Server:    rancherURL,
+			Message:   problem,
+			ExpiresAt: entry.ExpiresAt,
+		})
+	}
+	return events
+}
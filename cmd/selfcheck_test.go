@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/status"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckRefreshable(t *testing.T) {
+	expires := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	entries := []status.Entry{
+		{Context: "prod", ClusterID: "c-prod"},
+		{Context: "legacy", ClusterID: "c-legacy"},
+		{Context: "gone", ClusterID: "c-gone", ExpiresAt: expires},
+		{Context: "revoked", ClusterID: "c-revoked"},
+		{Context: "proxied"},
+	}
+	clusters := rancher.Clusters{
+		{ID: "c-prod", Name: "prod", Actions: map[string]string{"generateKubeconfig": "https://rancher.example.com/v3/clusters/c-prod?action=generateKubeconfig"}},
+		// Servers that don't list actions are assumed to allow generating kubeconfigs
+		{ID: "c-legacy", Name: "legacy"},
+		{ID: "c-revoked", Name: "revoked", Actions: map[string]string{}},
+	}
+
+	events := checkRefreshable(entries, clusters, "https://rancher.example.com")
+	require.Len(t, events, 2)
+
+	assert.Equal(t, "gone", events[0].Cluster)
+	assert.Contains(t, events[0].Message, "no longer exists")
+	assert.Contains(t, events[0].Message, "expires 2026-03-01T00:00:00Z")
+	assert.Equal(t, expires, events[0].ExpiresAt)
+
+	assert.Equal(t, "revoked", events[1].Cluster)
+	assert.Contains(t, events[1].Message, "no longer allowed")
+	assert.Equal(t, "https://rancher.example.com", events[1].Server)
+}
+
+func TestDaemonFlags_SelfCheckInterval(t *testing.T) {
+	cmd := NewRootCmd()
+	flag := cmd.Flags().Lookup("self-check-interval")
+	require.NotNil(t, flag)
+	assert.Equal(t, "0s", flag.DefValue)
+}
@@ -0,0 +1,432 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"iter"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/eventstream"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/notify"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"slices"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// defaultConcurrency is how many clusters of a server are processed at the same time without --concurrency
+const defaultConcurrency = 5
+
+// serverResult summarizes the run against one Rancher server
+type serverResult struct {
+	url string
+	// updated and skipped count the clusters whose entries were (or would be) updated or left alone
+	updated, skipped int
+	// failed counts the clusters that could not be processed
+	failed int
+	// err is set when the server could not be processed at all
+	err error
+}
+
+// processServer logs in to settings.url and processes its clusters into kubecfg. Explanations
+// are written to out. Failures of single clusters are logged and counted; the result's error
+// is set when logging in, listing the clusters or saving progress failed. Errors are logged
+// before being returned.
+func processServer(cmd *cobra.Command, settings rancherSettings, credentials *credentialSource, kubecfg *api.Config, opts clusterOptions, progress *progressSaver, out io.Writer, zapLogger *zap.Logger) serverResult {
+	result := serverResult{url: settings.url}
+
+	// With --wait-for-server, a server that can't be reached yet is retried until the deadline
+	deadline := serverDeadline(cmd)
+	var client *rancher.Client
+	var rancherURL string
+	err := waitForServer(commandContext(cmd), deadline, settings.url, zapLogger, func() error {
+		var err error
+		client, rancherURL, err = connectRancher(settings, credentials, zapLogger)
+		return err
+	})
+	if err != nil {
+		opts.Stream.Emit(eventstream.Event{Type: eventstream.TypeLogin, Server: settings.url, Error: err.Error()})
+		zapLogger.Error("Failed to create Rancher client", zap.Error(err), hintField(err))
+		opts.Events.Add(notify.Event{Type: notify.EventFailed, Server: settings.url, Message: "failed to log in: " + err.Error()})
+		result.err = err
+		return result
+	}
+	opts.RancherURL = rancherURL
+	opts.Stream.Emit(eventstream.Event{Type: eventstream.TypeLogin, Server: rancherURL})
+	// Tokens replaced by earlier runs are revoked once their grace period has passed
+	revokeRetiredTokens(client, kubecfg, opts, zapLogger)
+
+	source, err := newClusterSource(settings.clusterSource, client)
+	if err != nil {
+		zapLogger.Error("Failed to load cluster source", zap.Error(err))
+		opts.Events.Add(notify.Event{Type: notify.EventFailed, Server: settings.url, Message: err.Error()})
+		result.err = err
+		return result
+	}
+	opts.Source = source
+
+	// The canary is refreshed first; the others only if its new token works
+	canary := config.GetConfig(cmd, "canary", "CANARY")
+
+	var clusters rancher.Clusters
+	var feed *clusterFeed
+	stream := streamingSource(source, settings, canary, opts, progress)
+	err = waitForServer(commandContext(cmd), deadline, settings.url, zapLogger, func() error {
+		if stream != nil {
+			feed = startClusterFeed(stream)
+			return feed.ready()
+		}
+		var err error
+		clusters, err = source.ListClusters()
+		return err
+	})
+	if err != nil {
+		zapLogger.Error("Failed to retrieve cluster list from Rancher", zap.Error(err), hintField(err))
+		opts.Events.Add(notify.Event{Type: notify.EventFailed, Server: settings.url, Message: "failed to list clusters: " + err.Error()})
+		result.err = err
+		return result
+	}
+
+	if !settings.includeLocal && feed == nil {
+		clusters = excludeLocalCluster(clusters, zapLogger)
+	}
+
+	// Filter clusters if --cluster or the profile names any
+	if settings.clusters != "" {
+		clusters = filterClusters(clusters, settings.clusters, zapLogger)
+	}
+
+	// A cluster list selects the clusters and the names and namespaces of their entries
+	var namespaces map[string]string
+	if opts.clusterList != nil {
+		clusters, namespaces = selectListedClusters(clusters, opts.clusterList, opts, zapLogger)
+	}
+	clusters, namespaces = opts.contextNames.qualify(settings.url, clusters, namespaces, zapLogger)
+
+	if canary != "" {
+		if clusters, err = canaryFirst(clusters, canary); err != nil {
+			zapLogger.Error("Canary cluster not found, no cluster is updated", zap.Error(err))
+			opts.Events.Add(notify.Event{Type: notify.EventFailed, Server: settings.url, Message: err.Error()})
+			result.err = err
+			return result
+		}
+	}
+
+	// New clusters are only added once the user picked them
+	opts.Declined = declinedClusters(kubecfg, clusters, opts, zapLogger)
+
+	// With --explain every API call is attributed to the cluster being processed
+	explain := config.GetBool(cmd, "explain", "EXPLAIN")
+	var current *pipeline.Explanation
+	if explain {
+		client.ObserveRequests(func(method, path string, status int) {
+			current.APICall(method, path, status)
+		})
+	}
+
+	// finish records the outcome of cluster v, which was processed into kubecfg, and saves
+	// progress. It returns false when the run must stop.
+	finish := func(v rancher.Cluster, regenerate bool, err error) bool {
+		_ = current.Write(out)
+		recordResult(v, regenerate, err, opts)
+		if err != nil {
+			// Error is already logged by the pipeline
+			result.failed++
+			return true
+		}
+		if regenerate {
+			result.updated++
+			if namespace := namespaces[v.Name]; namespace != "" && !opts.DryRun {
+				setContextNamespace(kubecfg, v.Name, namespace)
+			}
+			if opts.State != nil && !opts.DryRun {
+				if sum, ok := kubeconfig.EntryChecksum(kubecfg, v.Name); ok {
+					opts.State.SetChecksum(opts.KubeconfigPath, v.Name, sum)
+				}
+			}
+		} else {
+			result.skipped++
+		}
+
+		if opts.DryRun {
+			return true
+		}
+		if err := progress.done(kubecfg, v.ID, regenerate, opts.State, zapLogger); err != nil {
+			zapLogger.Error("Failed to save progress", zap.Error(err))
+			result.err = err
+			return false
+		}
+		return true
+	}
+
+	var pending rancher.Clusters
+	for _, v := range clusters {
+		if progress.isDone(v.ID) {
+			zapLogger.Info("Skipping cluster already refreshed in this cycle", zap.String("cluster", v.Name))
+			opts.Plan.Skip(v.Name, skipReasonCheckpoint)
+			result.skipped++
+			continue
+		}
+		pending = append(pending, v)
+	}
+
+	started := false
+	if canary != "" && len(pending) > 0 && pending[0].ID == clusters[0].ID {
+		v := pending[0]
+		pending = pending[1:]
+		started = true
+		if explain {
+			current = pipeline.NewExplanation(v)
+			opts.Explain = current
+		}
+		opts.Stream.Emit(eventstream.Event{Type: eventstream.TypeClusterStart, Server: opts.RancherURL, Cluster: v.Name, ClusterID: v.ID})
+		// The canary's token is replaced on every run, so the rotation itself is tested
+		canaryOpts := opts
+		canaryOpts.ForceRefresh = true
+		processed := pipeline.Process(commandContext(cmd), client, kubecfg, v, canaryOpts.Options, clusterLogger(zapLogger, v, opts))
+		regenerate, err := processed.Updated, processed.Err
+		if err == nil && regenerate && !opts.DryRun && opts.ExecCommand == "" {
+			if err = verifyCanary(commandContext(cmd), kubecfg, v); err != nil {
+				zapLogger.Error("Canary token check failed", zap.String("cluster", v.Name), zap.Error(err))
+			} else {
+				zapLogger.Info("Canary token works, updating the remaining clusters", zap.String("cluster", v.Name))
+			}
+		}
+		if err == nil && !regenerate && !opts.DryRun {
+			zapLogger.Warn("Canary cluster was not refreshed, its token could not be checked", zap.String("cluster", v.Name))
+		}
+		if !finish(v, regenerate, err) {
+			return result
+		}
+		if err != nil {
+			result.err = fmt.Errorf("canary cluster %s failed, the remaining %d clusters were not updated: %w", v.Name, len(clusters)-1, err)
+			zapLogger.Error("Canary cluster failed, aborting the run", zap.String("cluster", v.Name), zap.Int("clustersNotUpdated", len(clusters)-1))
+			opts.Events.Add(notify.Event{Type: notify.EventFailed, Server: settings.url, Message: result.err.Error()})
+			return result
+		}
+	}
+
+	queue := slices.Values(pending)
+	few := len(pending) < 2
+	if feed != nil {
+		defer feed.stop()
+		queue = feed.clusters()
+		if !settings.includeLocal {
+			queue = withoutLocalCluster(queue, zapLogger)
+		}
+		queue = opts.contextNames.qualifyEach(settings.url, queue)
+		few = false
+	}
+
+	// Explanations attribute the client's API calls to one cluster at a time
+	if explain || opts.concurrency <= 1 || few {
+		for v := range queue {
+			// Spread the clusters' API calls instead of sending them in one burst
+			if started {
+				_ = sleepContext(commandContext(cmd), randomDelay(opts.stagger))
+			}
+			started = true
+			if explain {
+				current = pipeline.NewExplanation(v)
+				opts.Explain = current
+			}
+			opts.Stream.Emit(eventstream.Event{Type: eventstream.TypeClusterStart, Server: opts.RancherURL, Cluster: v.Name, ClusterID: v.ID})
+			processed := pipeline.Process(commandContext(cmd), client, kubecfg, v, opts.Options, clusterLogger(zapLogger, v, opts))
+			if !finish(v, processed.Updated, processed.Err) {
+				return result
+			}
+		}
+	} else if !processConcurrently(cmd, client, kubecfg, queue, started, opts, finish, zapLogger) {
+		return result
+	}
+	if feed != nil {
+		// A list that broke off leaves the clusters after the break unprocessed
+		if err := feed.wait(); err != nil {
+			zapLogger.Error("Cluster list from Rancher broke off", zap.Error(err), hintField(err))
+			opts.Events.Add(notify.Event{Type: notify.EventFailed, Server: settings.url, Message: "failed to list clusters: " + err.Error()})
+			result.err = err
+			return result
+		}
+	}
+	opts.expiries.collect(kubecfg, rancherURL, client)
+	return result
+}
+
+// clusterLogger returns the logger for processing cluster v, which attaches the cluster's name,
+// ID and the run ID to every line, so output of clusters processed in parallel stays attributable
+func clusterLogger(zapLogger *zap.Logger, v rancher.Cluster, opts clusterOptions) *zap.Logger {
+	fields := []zap.Field{zap.String("cluster", v.Name), zap.String("clusterID", v.ID)}
+	if opts.Origin.RunID != "" {
+		fields = append(fields, zap.String("runID", opts.Origin.RunID))
+	}
+	return zapLogger.With(fields...)
+}
+
+// processConcurrently processes clusters with up to opts.concurrency of them at a time, each on
+// its own copy of kubecfg, so a slow cluster doesn't hold up the others. As each cluster
+// finishes, its changes are merged into kubecfg and finish is called, one cluster at a time;
+// finish returning false keeps further clusters from starting. With a stagger, each cluster
+// waits a random pause before it starts, except the first of the run unless started is set.
+// Reports whether every call of finish returned true.
+func processConcurrently(cmd *cobra.Command, client *rancher.Client, kubecfg *api.Config, clusters iter.Seq[rancher.Cluster], started bool, opts clusterOptions, finish func(rancher.Cluster, bool, error) bool, zapLogger *zap.Logger) bool {
+	// Prompts from clusters processed at the same time must not interleave
+	if confirm := opts.Confirm; confirm != nil {
+		var prompts sync.Mutex
+		opts.Confirm = func(question string) bool {
+			prompts.Lock()
+			defer prompts.Unlock()
+			return confirm(question)
+		}
+	}
+
+	// Every copy starts from the same kubeconfig, the common ancestor when merging them back
+	base := kubecfg.DeepCopy()
+	var mu sync.Mutex
+	stopped := false
+	type job struct {
+		i int
+		v rancher.Cluster
+	}
+	queue := make(chan job)
+	var wg sync.WaitGroup
+	for range opts.concurrency {
+		wg.Go(func() {
+			for j := range queue {
+				i, v := j.i, j.v
+				mu.Lock()
+				stop := stopped
+				mu.Unlock()
+				if stop {
+					continue
+				}
+				if started || i > 0 {
+					_ = sleepContext(commandContext(cmd), randomDelay(opts.stagger))
+				}
+				work := base.DeepCopy()
+				opts.Stream.Emit(eventstream.Event{Type: eventstream.TypeClusterStart, Server: opts.RancherURL, Cluster: v.Name, ClusterID: v.ID})
+				processed := pipeline.Process(commandContext(cmd), client, work, v, opts.Options, clusterLogger(zapLogger, v, opts))
+
+				mu.Lock()
+				merged, conflicts := kubeconfig.ThreeWayMerge(base, kubecfg, work)
+				*kubecfg = *merged
+				for _, entry := range conflicts {
+					zapLogger.Warn("Kubeconfig entry was also written for another cluster, keeping the version written first",
+						zap.String("entry", entry), zap.String("cluster", v.Name))
+				}
+				if !stopped && !finish(v, processed.Updated, processed.Err) {
+					stopped = true
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	i := 0
+	for v := range clusters {
+		queue <- job{i, v}
+		i++
+	}
+	close(queue)
+	wg.Wait()
+	return !stopped
+}
+
+// processServers processes the Rancher servers in settings concurrently, each with its own
+// client, profile settings and copy of kubecfg, so a slow or unreachable server neither delays nor fails
+// the others. With a stagger, each server after the first starts after a random pause. The
+// copies are merged into the returned kubeconfig in the order the servers were given. Cluster
+// names are qualified with the server's host (see contextNames); should an entry still be
+// written for more than one server, the first server's version is kept.
+// Every server's outcome is logged, and the returned result adds them up. An error is only
+// returned when no server could be processed.
+func processServers(cmd *cobra.Command, settings rancherSettings, credentials *credentialSource, kubecfg *api.Config, opts clusterOptions, zapLogger *zap.Logger) (*api.Config, serverResult, error) {
+	if config.GetConfig(cmd, "checkpoint", "CHECKPOINT") != "" {
+		return nil, serverResult{}, fmt.Errorf("--checkpoint works with a single Rancher server, but --server/RANCHER_URL lists %d", len(settings.servers))
+	}
+	if config.GetConfig(cmd, "canary", "CANARY") != "" {
+		return nil, serverResult{}, fmt.Errorf("--canary works with a single Rancher server, but --server/RANCHER_URL lists %d", len(settings.servers))
+	}
+
+	// Prompts from different servers must not interleave
+	var prompts sync.Mutex
+	if confirm := opts.Confirm; confirm != nil {
+		opts.Confirm = func(question string) bool {
+			prompts.Lock()
+			defer prompts.Unlock()
+			return confirm(question)
+		}
+	}
+	if selectNew := opts.selectNew; selectNew != nil {
+		opts.selectNew = func(names []string) []string {
+			prompts.Lock()
+			defer prompts.Unlock()
+			return selectNew(names)
+		}
+	}
+
+	all := settings.perServer()
+	urls := make([]string, len(all))
+	for i, serverSettings := range all {
+		urls[i] = serverSettings.url
+	}
+	opts.contextNames = newContextNames(urls)
+	sources, clearSources := credentialsPerServer(cmd, settings, credentials)
+	defer clearSources()
+	results := make([]serverResult, len(all))
+	copies := make([]*api.Config, len(all))
+	explanations := make([]bytes.Buffer, len(all))
+	var wg sync.WaitGroup
+	for i, serverSettings := range all {
+		serverLogger := zapLogger.With(zap.String("server", serverSettings.url))
+		if serverSettings.profile != "" {
+			serverLogger = serverLogger.With(zap.String("profile", serverSettings.profile))
+		}
+		copies[i] = kubecfg.DeepCopy()
+		wg.Go(func() {
+			if i > 0 {
+				_ = sleepContext(commandContext(cmd), randomDelay(opts.stagger))
+			}
+			results[i] = processServer(cmd, serverSettings, sources[i], copies[i], opts, nil, &explanations[i], serverLogger)
+		})
+	}
+	wg.Wait()
+
+	merged := kubecfg
+	var total serverResult
+	succeeded := 0
+	for i, result := range results {
+		_, _ = explanations[i].WriteTo(cmd.OutOrStdout())
+		total.updated += result.updated
+		total.skipped += result.skipped
+		total.failed += result.failed
+
+		if result.err != nil {
+			zapLogger.Error("Rancher server could not be processed", zap.String("server", result.url), zap.Error(result.err))
+			continue
+		}
+		succeeded++
+		zapLogger.Info("Rancher server processed",
+			zap.String("server", result.url),
+			zap.Int("clustersUpdated", result.updated),
+			zap.Int("clustersSkipped", result.skipped),
+			zap.Int("clustersFailed", result.failed))
+
+		var conflicts []string
+		merged, conflicts = kubeconfig.ThreeWayMerge(kubecfg, merged, copies[i])
+		for _, entry := range conflicts {
+			zapLogger.Warn("Kubeconfig entry was written for more than one Rancher server, keeping the first server's version",
+				zap.String("entry", entry), zap.String("server", result.url))
+		}
+	}
+
+	if succeeded == 0 {
+		return nil, total, fmt.Errorf("none of the %d Rancher servers could be processed", len(all))
+	}
+	// A server that could not be processed at all is retried as a whole next time
+	total.failed += len(all) - succeeded
+	return merged, total, nil
+}
@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// newFleetServer returns a Rancher stub with the given clusters that accepts any login.
+// Its tokens are named kubeconfig-u-<user>.
+func newFleetServer(t *testing.T, logins *int32, user string, clusters ...rancher.Cluster) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v3-public/localProviders/local":
+			atomic.AddInt32(logins, 1)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "session-token"}`))
+		case r.URL.Path == "/v3/clusters":
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": clusters})
+		case r.URL.Query().Get("action") == "generateKubeconfig":
+			id := strings.TrimPrefix(r.URL.Path, "/v3/clusters/")
+			for _, c := range clusters {
+				if c.ID == id {
+					_ = json.NewEncoder(w).Encode(map[string]string{"config": generatedKubeconfig(c.Name, c.ID, "kubeconfig-u-"+user+":secret")})
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProcessServers(t *testing.T) {
+	var logins int32
+	east := newFleetServer(t, &logins, "east", rancher.Cluster{ID: "c-east", Name: "east"}, rancher.Cluster{ID: "local", Name: "local"})
+	west := newFleetServer(t, &logins, "west", rancher.Cluster{ID: "c-west", Name: "west"}, rancher.Cluster{ID: "local", Name: "local"})
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", east.URL + "," + down.URL + "," + west.URL, "--user", "admin"}))
+	settings, err := resolveRancherSettings(cmd)
+	require.NoError(t, err)
+	require.Len(t, settings.servers, 3)
+
+	kubecfg := api.NewConfig()
+	opts := clusterOptions{Options: pipeline.Options{AutoCreate: true, ThresholdDays: 30}}
+	merged, total, err := processServers(cmd, settings, newCredentialSource(cmd, settings), kubecfg, opts, zap.NewNop())
+	require.NoError(t, err, "an unreachable server does not fail the others")
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&logins))
+	assert.Equal(t, 4, total.updated)
+	assert.Equal(t, 1, total.failed, "the unreachable server counts as failed")
+	// Every name is qualified with its server, also those only one server uses
+	eastHost, westHost := strings.TrimPrefix(east.URL, "http://"), strings.TrimPrefix(west.URL, "http://")
+	assert.Equal(t, "kubeconfig-u-east:secret", merged.AuthInfos["east@"+eastHost].Token)
+	assert.Equal(t, "kubeconfig-u-west:secret", merged.AuthInfos["west@"+westHost].Token)
+	assert.NotContains(t, merged.Contexts, "local")
+	assert.Equal(t, "kubeconfig-u-east:secret", merged.AuthInfos["local@"+eastHost].Token)
+	assert.Equal(t, "kubeconfig-u-west:secret", merged.AuthInfos["local@"+westHost].Token)
+	assert.Contains(t, merged.Contexts, "local@"+westHost)
+	assert.Empty(t, kubecfg.AuthInfos, "servers work on copies")
+}
+
+func TestProcessServer_Concurrency(t *testing.T) {
+	var clusters []rancher.Cluster
+	for i := range 8 {
+		clusters = append(clusters, rancher.Cluster{ID: fmt.Sprintf("c-%d", i), Name: fmt.Sprintf("cluster-%d", i)})
+	}
+	var logins int32
+	server := newFleetServer(t, &logins, "admin", clusters...)
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", server.URL, "--user", "admin"}))
+	settings, err := resolveRancherSettings(cmd)
+	require.NoError(t, err)
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["other"] = &api.AuthInfo{Token: "unrelated"}
+	opts := clusterOptions{Options: pipeline.Options{AutoCreate: true, ThresholdDays: 30}, concurrency: 3}
+	result := processServer(cmd, settings, newCredentialSource(cmd, settings), kubecfg, opts, nil, io.Discard, zap.NewNop())
+	require.NoError(t, result.err)
+
+	assert.Equal(t, 8, result.updated)
+	for _, c := range clusters {
+		assert.Equal(t, "kubeconfig-u-admin:secret", kubecfg.AuthInfos[c.Name].Token, "every cluster's copy is merged: %s", c.Name)
+		assert.Contains(t, kubecfg.Contexts, c.Name)
+	}
+	assert.Equal(t, "unrelated", kubecfg.AuthInfos["other"].Token)
+}
+
+func TestProcessServers_Profiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell command")
+	}
+	var logins int32
+	east := newFleetServer(t, &logins, "east", rancher.Cluster{ID: "c-east", Name: "east"}, rancher.Cluster{ID: "c-east-2", Name: "east-2"})
+	west := newFleetServer(t, &logins, "west", rancher.Cluster{ID: "c-west", Name: "west"}, rancher.Cluster{ID: "local", Name: "local"})
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+profiles:
+  - name: east
+    server: `+east.URL+`
+    credential-command: echo east-secret
+    clusters: [east]
+  - name: west
+    server: `+west.URL+`
+    include-local: false
+`), 0o600))
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("PROFILES_CONFIG", "")
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--profiles-config", path, "--user", "admin"}))
+	settings, err := resolveRancherSettings(cmd)
+	require.NoError(t, err)
+
+	merged, total, err := processServers(cmd, settings, newCredentialSource(cmd, settings), api.NewConfig(), clusterOptions{Options: pipeline.Options{AutoCreate: true, ThresholdDays: 30}}, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&logins))
+	assert.Equal(t, 2, total.updated)
+	eastHost, westHost := strings.TrimPrefix(east.URL, "http://"), strings.TrimPrefix(west.URL, "http://")
+	assert.Contains(t, merged.AuthInfos, "east@"+eastHost)
+	assert.NotContains(t, merged.AuthInfos, "east-2@"+eastHost, "the east profile only updates its clusters")
+	assert.Contains(t, merged.AuthInfos, "west@"+westHost)
+	assert.NotContains(t, merged.AuthInfos, "local@"+westHost, "the west profile skips the local cluster")
+}
+
+func TestProcessServers_AllUnreachable(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", down.URL + "/a," + down.URL + "/b", "--user", "admin"}))
+	settings, err := resolveRancherSettings(cmd)
+	require.NoError(t, err)
+
+	_, _, err = processServers(cmd, settings, newCredentialSource(cmd, settings), api.NewConfig(), clusterOptions{}, zap.NewNop())
+	assert.ErrorContains(t, err, "none of the 2 Rancher servers")
+}
+
+func TestProcessServers_RejectsCheckpoint(t *testing.T) {
+	t.Setenv("CHECKPOINT", "")
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--checkpoint", "cp.json"}))
+	settings := rancherSettings{servers: []string{"https://a.example.com", "https://b.example.com"}}
+
+	_, _, err := processServers(cmd, settings, nil, api.NewConfig(), clusterOptions{}, zap.NewNop())
+	assert.ErrorContains(t, err, "--checkpoint works with a single Rancher server")
+}
+
+func TestClusterLogger(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	v := rancher.Cluster{ID: "c-m-1", Name: "prod"}
+
+	clusterLogger(zap.New(core), v, clusterOptions{Options: pipeline.Options{Origin: pipeline.Origin{RunID: "0123456789ab"}}}).Info("Token regenerated")
+	clusterLogger(zap.New(core), v, clusterOptions{}).Info("Token regenerated")
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	assert.Equal(t, map[string]any{"cluster": "prod", "clusterID": "c-m-1", "runID": "0123456789ab"}, entries[0].ContextMap())
+	assert.Equal(t, map[string]any{"cluster": "prod", "clusterID": "c-m-1"}, entries[1].ContextMap())
+}
+
+func TestParseServerURLs(t *testing.T) {
+	servers, err := parseServerURLs(" https://a.example.com, https://b.example.com ,,https://a.example.com,https://A.example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, servers)
+
+	_, err = parseServerURLs("https://a.example.com,ftp://b.example.com")
+	assert.ErrorContains(t, err, "ftp://b.example.com")
+
+	_, err = parseServerURLs(" , ")
+	assert.ErrorContains(t, err, "rancher URL is required")
+}
+
+func TestNewRancherClient_SingleServerOnly(t *testing.T) {
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	_, _, err := newRancherClient(newClientTestCmd("--server", "https://a.example.com,https://b.example.com", "--user", "admin"), zap.NewNop())
+	assert.ErrorContains(t, err, "works with a single Rancher server")
+}
+
+func TestProcessServers_QualifiesExistingEntries(t *testing.T) {
+	var logins int32
+	east := newFleetServer(t, &logins, "east", rancher.Cluster{ID: "local", Name: "local"})
+	west := newFleetServer(t, &logins, "west", rancher.Cluster{ID: "local", Name: "local"})
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+
+	// The entry of a run against east alone is renamed once west joins
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", east.URL, "--user", "admin"}))
+	settings, err := resolveRancherSettings(cmd)
+	require.NoError(t, err)
+	kubecfg := api.NewConfig()
+	opts := clusterOptions{Options: pipeline.Options{AutoCreate: true, ThresholdDays: 30}}
+	require.NoError(t, processServer(cmd, settings, newCredentialSource(cmd, settings), kubecfg, opts, nil, io.Discard, zap.NewNop()).err)
+	require.Contains(t, kubecfg.Contexts, "local")
+
+	cmd = NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", east.URL, "--server", west.URL, "--user", "admin"}))
+	settings, err = resolveRancherSettings(cmd)
+	require.NoError(t, err)
+	require.Len(t, settings.servers, 2, "--server may be repeated")
+
+	// A server given twice is processed once, under the same names
+	cmd = NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", east.URL, "--server", west.URL, "--server", east.URL + "/", "--user", "admin"}))
+	settings, err = resolveRancherSettings(cmd)
+	require.NoError(t, err)
+	require.Equal(t, []string{east.URL, west.URL}, settings.servers)
+	merged, _, err := processServers(cmd, settings, newCredentialSource(cmd, settings), kubecfg, opts, zap.NewNop())
+	require.NoError(t, err)
+
+	assert.NotContains(t, merged.Contexts, "local")
+	assert.Contains(t, merged.Contexts, "local@"+strings.TrimPrefix(east.URL, "http://"))
+	assert.Contains(t, merged.Contexts, "local@"+strings.TrimPrefix(west.URL, "http://"))
+}
+
+// generatedKubeconfig returns a kubeconfig like the one Rancher generates for a cluster
+func generatedKubeconfig(name, clusterID, token string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://rancher.example.com/k8s/clusters/%[2]s
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s
+current-context: %[1]s
+users:
+- name: %[1]s
+  user:
+    token: %[3]s
+`, name, clusterID, token)
+}
+
+// tokenKubeconfig is the generated kubeconfig of the "prod" cluster
+var tokenKubeconfig = generatedKubeconfig("prod", "c-prod", "kubeconfig-u-new:newsecret")
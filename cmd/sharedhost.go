@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"errors"
+	"rancher-kubeconfig-updater/internal/appdir"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/privilege"
+	"rancher-kubeconfig-updater/internal/readonly"
+
+	"github.com/spf13/cobra"
+)
+
+// addSharedHostFlag registers the flag for machines several users log in to
+func addSharedHostFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool("shared-host", false, "Keep users of a shared machine such as a jump host apart: state, history and secrets per OS user (and secrets per Rancher server), private permissions, and no kubeconfigs of other users")
+}
+
+// applySharedHost keeps the tool's files of every OS user apart with --shared-host, creating
+// the current user's directory or checking that it is private
+func applySharedHost(cmd *cobra.Command) error {
+	on := config.GetBool(cmd, "shared-host", "SHARED_HOST")
+	appdir.SetShared(on)
+	if !on {
+		return nil
+	}
+	dir, err := appdir.Dir()
+	if errors.Is(err, appdir.ErrNoDir) {
+		// Commands that need the directory report this themselves
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if readonly.Enabled() {
+		return privilege.CheckOwner(dir)
+	}
+	return privilege.SecureDir(dir)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/appdir"
+	"rancher-kubeconfig-updater/internal/privilege"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyGlobalFlags_SharedHost(t *testing.T) {
+	t.Cleanup(func() {
+		appdir.Set("")
+		appdir.SetShared(false)
+	})
+	t.Setenv("STATE_DIR", "")
+	t.Setenv("SHARED_HOST", "")
+	base := t.TempDir()
+
+	rootCmd := NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--state-dir", base, "--shared-host"}))
+	require.NoError(t, applyGlobalFlags(rootCmd, nil))
+	dir, err := appdir.Dir()
+	require.NoError(t, err)
+	assert.Equal(t, base, filepath.Dir(dir), "every user gets a directory below the shared one")
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	require.NoError(t, applyGlobalFlags(NewRootCmd(), nil))
+	assert.False(t, appdir.Shared(), "the mode ends with the flag")
+}
+
+func TestCheckRootWrite_SharedHost(t *testing.T) {
+	if !privilege.IsElevated() {
+		t.Skip("requires root to create a file owned by another user")
+	}
+	t.Setenv("SHARED_HOST", "")
+	t.Setenv("ALLOW_ROOT", "")
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte("apiVersion: v1\nkind: Config\n"), 0600))
+	require.NoError(t, os.Chown(path, 65534, 65534))
+
+	// --allow-root permits it, unless the machine is shared
+	rootCmd := NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--allow-root"}))
+	require.NoError(t, checkRootWrite(rootCmd, path))
+
+	rootCmd = NewRootCmd()
+	require.NoError(t, rootCmd.ParseFlags([]string{"--allow-root", "--shared-host"}))
+	assert.ErrorContains(t, checkRootWrite(rootCmd, path), "belongs to another user")
+}
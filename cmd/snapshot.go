@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"rancher-kubeconfig-updater/internal/snapshot"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// NewSnapshotCmd creates the command that archives the kubeconfigs of all clusters for break-glass use.
+func NewSnapshotCmd() *cobra.Command {
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Archive the kubeconfigs of all Rancher clusters for break-glass storage",
+		Long: "Fetches the kubeconfig of every Rancher cluster and writes them, with a manifest\n" +
+			"listing the clusters, their contexts and any cluster that could not be fetched, to a\n" +
+			"timestamped tar.gz archive. With --passphrase the archive is encrypted (AES-256-GCM).\n" +
+			"Keep the archive somewhere safe: it holds working tokens for every cluster.\n" +
+			"Use 'snapshot restore' to turn it back into kubeconfig files.\n" +
+			"The local kubeconfig is neither read nor modified.",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          runSnapshot,
+	}
+
+	snapshotCmd.Flags().String("out", "", "Archive to write (default: rancher-snapshot-<UTC timestamp>.tar.gz in the current directory)")
+	addPassphraseFlag(snapshotCmd)
+	snapshotCmd.Flags().Bool("include-local", true, "Include Rancher's 'local' management cluster (use --include-local=false to skip it)")
+	addRancherFlags(snapshotCmd)
+
+	snapshotCmd.AddCommand(newSnapshotRestoreCmd())
+	return snapshotCmd
+}
+
+func newSnapshotRestoreCmd() *cobra.Command {
+	restoreCmd := &cobra.Command{
+		Use:   "restore ARCHIVE",
+		Short: "Write the kubeconfigs of a snapshot to files",
+		Long: "Writes the kubeconfigs stored in a snapshot archive: one file per cluster into --dir,\n" +
+			"and/or all clusters merged into the kubeconfig file --merged, replacing entries with\n" +
+			"the same names. Rancher is not contacted.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE:         runSnapshotRestore,
+	}
+
+	restoreCmd.Flags().String("dir", "", "Directory to write one kubeconfig per cluster to")
+	restoreCmd.Flags().String("merged", "", "Kubeconfig file to merge all clusters into (created if missing)")
+	restoreCmd.Flags().String("state-file", "", "Path to the state file tracking managed entries (default: <user cache dir>/rancher-kubeconfig-updater/state.json)")
+	addPassphraseFlag(restoreCmd)
+	addSaveFlags(restoreCmd)
+
+	return restoreCmd
+}
+
+// addPassphraseFlag adds --passphrase, which prompts for the passphrase when given without a value
+func addPassphraseFlag(cmd *cobra.Command) {
+	cmd.Flags().String("passphrase", "", "Passphrase encrypting the snapshot (can also be set via SNAPSHOT_PASSPHRASE env var); use --passphrase without a value to be prompted")
+	cmd.Flags().Lookup("passphrase").NoOptDefVal = "-"
+}
+
+func runSnapshot(cmd *cobra.Command, args []string) error {
+	zapLogger := logger.NewLogger()
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	passphrase, err := config.GetSecret(cmd, "passphrase", "SNAPSHOT_PASSPHRASE", i18n.T(i18n.PromptPassphrase))
+	if err != nil {
+		zapLogger.Error("Failed to read passphrase", zap.Error(err))
+		return &ExitError{Code: 1}
+	}
+	defer clear(passphrase)
+
+	now := time.Now()
+	out, _ := cmd.Flags().GetString("out")
+	if out == "" {
+		out = "rancher-snapshot-" + now.UTC().Format("20060102T150405Z") + ".tar.gz"
+	}
+
+	client, rancherURL, err := newRancherClient(cmd, zapLogger)
+	if err != nil {
+		zapLogger.Error("Failed to create Rancher client", zap.Error(err))
+		return &ExitError{Code: 1}
+	}
+	clusters, err := client.ListClusters()
+	if err != nil {
+		zapLogger.Error("Failed to retrieve cluster list from Rancher", zap.Error(err))
+		return &ExitError{Code: 1}
+	}
+	if !config.GetBool(cmd, "include-local", "INCLUDE_LOCAL") {
+		clusters = excludeLocalCluster(clusters, zapLogger)
+	}
+
+	snap := snapshot.New(rancherURL, now)
+	for _, v := range clusters {
+		clusterKubeconfig, err := client.GetClusterKubeconfig(v.ID)
+		if err == nil {
+			var data []byte
+			if data, err = clientcmd.Write(*clusterKubeconfig); err == nil {
+				snap.Add(v.Name, v.ID, slices.Sorted(maps.Keys(clusterKubeconfig.Contexts)), data)
+				continue
+			}
+		}
+		zapLogger.Error("Failed to get kubeconfig for cluster", zap.String("cluster", v.Name), zap.Error(err))
+		snap.AddFailure(v.Name, v.ID, err)
+	}
+
+	if err := writeSnapshot(snap, out, passphrase); err != nil {
+		zapLogger.Error("Failed to write snapshot", zap.String("path", out), zap.Error(err))
+		return &ExitError{Code: 1}
+	}
+	zapLogger.Info("Snapshot written",
+		zap.String("path", out),
+		zap.Int("clusters", len(snap.Manifest.Clusters)),
+		zap.Int("failed", len(snap.Manifest.Failed)),
+		zap.Bool("encrypted", len(passphrase) > 0))
+
+	// The archive is still worth keeping, but it is not the complete set that was asked for
+	if len(snap.Manifest.Failed) > 0 {
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+// writeSnapshot atomically writes snap to the file out, readable only by the owner
+func writeSnapshot(snap *snapshot.Snapshot, out string, passphrase []byte) error {
+	var buf bytes.Buffer
+	if err := snap.Write(&buf, passphrase); err != nil {
+		return err
+	}
+	tx := kubeconfig.NewTransaction()
+	tx.Stage(out, buf.Bytes(), 0600)
+	return tx.Commit()
+}
+
+func runSnapshotRestore(cmd *cobra.Command, args []string) error {
+	zapLogger := logger.NewLogger()
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	dir, _ := cmd.Flags().GetString("dir")
+	merged, _ := cmd.Flags().GetString("merged")
+	if dir == "" && merged == "" {
+		return fmt.Errorf("nothing to restore to: set --dir and/or --merged")
+	}
+
+	passphrase, err := config.GetSecret(cmd, "passphrase", "SNAPSHOT_PASSPHRASE", i18n.T(i18n.PromptPassphrase))
+	if err != nil {
+		return err
+	}
+	defer clear(passphrase)
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	snap, err := snapshot.Read(f, passphrase)
+	if err != nil {
+		return err
+	}
+
+	configs := make([]*api.Config, len(snap.Manifest.Clusters))
+	for i, c := range snap.Manifest.Clusters {
+		if configs[i], err = clientcmd.Load(snap.Files[c.File]); err != nil {
+			return fmt.Errorf("invalid kubeconfig of cluster %s in snapshot: %w", c.Name, err)
+		}
+	}
+
+	// Per-cluster files and the merged kubeconfig are replaced together
+	tx := kubeconfig.NewTransaction()
+	if dir != "" {
+		if err := readonly.Check(dir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		for _, c := range snap.Manifest.Clusters {
+			tx.Stage(filepath.Join(dir, path.Base(c.File)), snap.Files[c.File], 0600)
+		}
+	}
+	if merged != "" {
+		saveOpts, err := saveOptions(cmd, zapLogger)
+		if err != nil {
+			return err
+		}
+		if err := checkRootWrite(cmd, merged); err != nil {
+			return err
+		}
+		target, err := kubeconfig.LoadKubeconfig(merged)
+		if err != nil {
+			return err
+		}
+		// The restored entries are recorded as unmodified, so the next run refreshes them
+		st, stateKey := loadState(cmd, merged, zapLogger)
+		for i, c := range snap.Manifest.Clusters {
+			kubeconfig.MergeKubeconfig(target, configs[i], c.Name, true)
+			if sum, ok := kubeconfig.EntryChecksum(target, c.Name); ok && st != nil {
+				st.SetChecksum(stateKey, c.Name, sum)
+			}
+		}
+		if _, err := tx.StageKubeconfig(target, merged, zapLogger, saveOpts...); err != nil {
+			return err
+		}
+		if st != nil {
+			if err := st.Stage(tx); err != nil {
+				zapLogger.Warn("Failed to save state file", zap.Error(err))
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), i18n.T(i18n.SnapshotRestored,
+		len(snap.Manifest.Clusters), snap.Manifest.Server, snap.Manifest.CreatedAt.Format(time.RFC3339)))
+	if err == nil && len(snap.Manifest.Failed) > 0 {
+		names := make([]string, len(snap.Manifest.Failed))
+		for i, failure := range snap.Manifest.Failed {
+			names[i] = failure.Name
+		}
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), i18n.T(i18n.SnapshotMissing, names))
+	}
+	return err
+}
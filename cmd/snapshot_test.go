@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/snapshot"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestSnapshotCmd_FlagsRegistered(t *testing.T) {
+	cmd := NewSnapshotCmd()
+
+	assert.NotNil(t, cmd.Flags().Lookup("out"))
+	assert.Equal(t, "-", cmd.Flags().Lookup("passphrase").NoOptDefVal)
+	assert.NotNil(t, cmd.Flags().Lookup("server"))
+
+	restore, _, err := cmd.Find([]string{"restore"})
+	require.NoError(t, err)
+	assert.NotNil(t, restore.Flags().Lookup("dir"))
+	assert.NotNil(t, restore.Flags().Lookup("merged"))
+}
+
+// writeTestSnapshot writes an encrypted snapshot of two clusters and returns its path
+func writeTestSnapshot(t *testing.T) string {
+	t.Helper()
+	snap := snapshot.New("https://rancher.example.com", time.Now())
+	snap.Add("prod", "c-prod", []string{"prod"}, []byte(tokenKubeconfig))
+	snap.Add("staging", "c-staging", []string{"staging"},
+		[]byte(generatedKubeconfig("staging", "c-staging", "kubeconfig-u-staging:secret")))
+
+	path := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+	require.NoError(t, writeSnapshot(snap, path, []byte("secret")))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	if os.PathSeparator == '/' {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	return path
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	archive := writeTestSnapshot(t)
+	dir := filepath.Join(t.TempDir(), "clusters")
+	merged := filepath.Join(t.TempDir(), "config")
+	t.Setenv("STATE_FILE", filepath.Join(t.TempDir(), "state.json"))
+
+	cmd := NewSnapshotCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"restore", archive, "--dir", dir, "--merged", merged, "--passphrase=secret", "--file-mode", "0640"})
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "Restored 2 clusters")
+
+	prod, err := clientcmd.LoadFromFile(filepath.Join(dir, "prod.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "kubeconfig-u-new:newsecret", prod.AuthInfos["prod"].Token)
+
+	cfg, err := clientcmd.LoadFromFile(merged)
+	require.NoError(t, err)
+	assert.Contains(t, cfg.Contexts, "prod")
+	assert.Contains(t, cfg.Contexts, "staging")
+	if os.PathSeparator == '/' {
+		info, err := os.Stat(merged)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0640), info.Mode().Perm(), "the merged kubeconfig is saved with the save flags")
+	}
+}
+
+func TestSnapshotRestore_Errors(t *testing.T) {
+	archive := writeTestSnapshot(t)
+
+	for name, args := range map[string][]string{
+		"no target":      {"restore", archive},
+		"no passphrase":  {"restore", archive, "--dir", t.TempDir()},
+		"bad passphrase": {"restore", archive, "--dir", t.TempDir(), "--passphrase=wrong"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("SNAPSHOT_PASSPHRASE", "")
+			cmd := NewSnapshotCmd()
+			cmd.SetOut(&bytes.Buffer{})
+			cmd.SetErr(&bytes.Buffer{})
+			cmd.SetArgs(args)
+			assert.Error(t, cmd.Execute())
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/clusterfile"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"strings"
+)
+
+// Values of --cluster-source
+const (
+	clusterSourceV3    = "v3"
+	clusterSourceSteve = "steve"
+	// clusterSourceFile prefixes the path of a static cluster manifest, e.g. file:clusters.yaml
+	clusterSourceFile = "file:"
+)
+
+// parseClusterSource validates the cluster-source setting; empty selects Rancher's v3 API
+func parseClusterSource(value string) (string, error) {
+	switch {
+	case value == "":
+		return clusterSourceV3, nil
+	case value == clusterSourceV3, value == clusterSourceSteve:
+		return value, nil
+	case strings.HasPrefix(value, clusterSourceFile) && len(value) > len(clusterSourceFile):
+		return value, nil
+	default:
+		return "", fmt.Errorf("invalid cluster-source value %q. Must be 'v3', 'steve' or 'file:PATH'", value)
+	}
+}
+
+// newClusterSource returns the source a validated cluster-source setting selects. Only the
+// clusters and their kubeconfigs come from it; tokens are still checked against client's Rancher.
+func newClusterSource(value string, client *rancher.Client) (rancher.ClusterSource, error) {
+	switch {
+	case value == clusterSourceSteve:
+		return rancher.NewSteveSource(client), nil
+	case strings.HasPrefix(value, clusterSourceFile):
+		manifest, err := clusterfile.Load(strings.TrimPrefix(value, clusterSourceFile))
+		if err != nil {
+			return nil, err
+		}
+		return manifest, nil
+	default:
+		return client, nil
+	}
+}
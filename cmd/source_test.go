@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClusterSource(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", clusterSourceV3, false},
+		{"v3", clusterSourceV3, false},
+		{"steve", clusterSourceSteve, false},
+		{"file:clusters.yaml", "file:clusters.yaml", false},
+		{"file:", "", true},
+		{"v1", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseClusterSource(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, tt.value)
+			continue
+		}
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func TestUpdate_ClusterSourceFile(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "me", rancher.Cluster{ID: "c-dev", Name: "dev"})
+
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "prod.yaml"), []byte(generatedKubeconfig("prod", "c-prod", "kubeconfig-u-me:exported")), 0600))
+	manifestPath := filepath.Join(dir, "clusters.yaml")
+	require.NoError(t, os.WriteFile(manifestPath, []byte("clusters:\n- id: c-prod\n  name: prod\n  kubeconfig: prod.yaml\n"), 0600))
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("CLUSTER_SOURCE", "")
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--server", server.URL, "--user", "admin", "-c", kubeconfigPath, "--auto-create",
+		"--state-file", filepath.Join(dir, "state.json"), "--cluster-source", "file:" + manifestPath})
+	require.NoError(t, cmd.Execute())
+
+	saved, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	require.NoError(t, err)
+	require.Contains(t, saved.AuthInfos, "prod")
+	assert.Equal(t, "kubeconfig-u-me:exported", saved.AuthInfos["prod"].Token, "the exported kubeconfig is merged")
+	assert.NotContains(t, saved.Contexts, "dev", "clusters Rancher lists are not used")
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/credprovider"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/staticcluster"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Plan reasons of static clusters
+const (
+	// reasonTokenCommand is the reason of entries refreshed from a static cluster's token command
+	reasonTokenCommand = "token_command"
+	// skipReasonUpToDate is the reason of static entries the token command didn't change
+	skipReasonUpToDate = "up_to_date"
+	// skipReasonNameTaken is the reason of static clusters whose name is used by another entry
+	skipReasonNameTaken = "name_taken"
+)
+
+// loadStaticClusters reads the --static-clusters file, or returns nil when none is given
+func loadStaticClusters(cmd *cobra.Command) (*staticcluster.Config, error) {
+	path := config.GetConfig(cmd, "static-clusters", "STATIC_CLUSTERS")
+	if path == "" {
+		return nil, nil
+	}
+	return staticcluster.Load(path)
+}
+
+// processStaticClusters writes the entries of the static clusters into kubecfg, each with the
+// token its command prints. Entries the tool didn't create are never replaced, so a static
+// cluster can't take over a Rancher cluster's entry or one written by hand. The result counts
+// the entries like processServer counts clusters; failures are logged.
+func processStaticClusters(ctx context.Context, kubecfg *api.Config, static *staticcluster.Config, opts clusterOptions, zapLogger *zap.Logger) serverResult {
+	var result serverResult
+	// Static entries belong to no Rancher server
+	opts.RancherURL = ""
+	for _, c := range static.Clusters {
+		v := rancher.Cluster{Name: c.Name}
+		logger := zapLogger.With(zap.String("cluster", c.Name))
+		updated, err := processStaticCluster(ctx, kubecfg, c, opts, logger)
+		recordResult(v, updated, err, opts)
+		switch {
+		case err != nil:
+			logger.Error("Failed to update static cluster", zap.Error(err))
+			result.failed++
+		case updated:
+			result.updated++
+		default:
+			result.skipped++
+		}
+	}
+	return result
+}
+
+// processStaticCluster refreshes the entry of one static cluster and reports whether it was
+// (or in dry-run mode would be) changed
+func processStaticCluster(ctx context.Context, kubecfg *api.Config, c staticcluster.Cluster, opts clusterOptions, zapLogger *zap.Logger) (bool, error) {
+	_, exists := kubecfg.AuthInfos[c.Name]
+	if _, ok := kubecfg.Contexts[c.Name]; ok {
+		exists = true
+	}
+	if exists {
+		md, managed := kubeconfig.GetMetadata(kubecfg, c.Name)
+		if !managed || md.RancherURL != "" {
+			zapLogger.Warn("Kubeconfig entry of static cluster belongs to a Rancher cluster or was not created by this tool, skipping it")
+			opts.Plan.Skip(c.Name, skipReasonNameTaken)
+			return false, nil
+		}
+		if !pipeline.AllowOverwrite(kubecfg, c.Name, opts.Options, zapLogger) {
+			opts.Plan.Skip(c.Name, pipeline.SkipReasonModified)
+			return false, nil
+		}
+	}
+
+	// The token command may have side effects such as issuing a new lease
+	if opts.DryRun {
+		zapLogger.Info("[DRY-RUN] Would refresh static cluster from its token command")
+		if exists {
+			opts.Plan.UpdateToken(c.Name, "", "", "", reasonTokenCommand)
+		} else {
+			opts.Plan.AddContext(c.Name, "")
+		}
+		return true, nil
+	}
+
+	token, err := fetchStaticToken(ctx, c)
+	if err != nil {
+		return false, err
+	}
+	entry := c.Kubeconfig(token)
+	current, _ := kubeconfig.EntryChecksum(kubecfg, c.Name)
+	if wanted, _ := kubeconfig.EntryChecksum(entry, c.Name); exists && wanted == current {
+		zapLogger.Debug("Static cluster is up to date")
+		opts.Plan.Skip(c.Name, skipReasonUpToDate)
+		return false, nil
+	}
+
+	kubeconfig.MergeKubeconfig(kubecfg, entry, c.Name, false)
+	if err := kubeconfig.SetMetadata(kubecfg, c.Name, kubeconfig.NewMetadata("", "", time.Now())); err != nil {
+		return false, err
+	}
+	if opts.State != nil {
+		if sum, ok := kubeconfig.EntryChecksum(kubecfg, c.Name); ok {
+			opts.State.SetChecksum(opts.KubeconfigPath, c.Name, sum)
+		}
+	}
+	if exists {
+		opts.Plan.UpdateToken(c.Name, "", "", "", reasonTokenCommand)
+	} else {
+		opts.Plan.AddContext(c.Name, "")
+	}
+	zapLogger.Info("Updated kubeconfig entry of static cluster")
+	return true, nil
+}
+
+// fetchStaticToken runs the token command of c and returns the token it printed
+func fetchStaticToken(ctx context.Context, c staticcluster.Cluster) (string, error) {
+	out, err := credprovider.NewCommand(c.TokenCommand).Fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("token command of static cluster %s failed: %w", c.Name, err)
+	}
+	defer clear(out)
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", errors.New("token command of static cluster " + c.Name + " printed no token")
+	}
+	return token, nil
+}
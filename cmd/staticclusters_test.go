@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/pipeline"
+	"rancher-kubeconfig-updater/internal/plan"
+	"rancher-kubeconfig-updater/internal/staticcluster"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestProcessStaticClusters(t *testing.T) {
+	kubecfg := api.NewConfig()
+	addEntry(kubecfg, "manual", "https://manual.example.com")
+	addEntry(kubecfg, "prod", "https://rancher.example.com/k8s/clusters/c-prod")
+	require.NoError(t, kubeconfig.SetMetadata(kubecfg, "prod", kubeconfig.NewMetadata("https://rancher.example.com", "c-prod", time.Now())))
+	static := &staticcluster.Config{Clusters: []staticcluster.Cluster{
+		{Name: "homelab", Server: "https://10.0.0.5:6443", Namespace: "apps", TokenCommand: "echo homelab-token"},
+		{Name: "manual", Server: "https://10.0.0.6:6443", TokenCommand: "echo manual-token"},
+		{Name: "prod", Server: "https://10.0.0.7:6443", TokenCommand: "echo prod-token"},
+		{Name: "broken", Server: "https://10.0.0.8:6443", TokenCommand: "exit 3"},
+	}}
+	opts := clusterOptions{Options: pipeline.Options{Plan: plan.New(false)}}
+
+	result := processStaticClusters(context.Background(), kubecfg, static, opts, zap.NewNop())
+
+	assert.Equal(t, 1, result.updated)
+	assert.Equal(t, 2, result.skipped, "entries the tool didn't create for a static cluster are left alone")
+	assert.Equal(t, 1, result.failed)
+	assert.Equal(t, "homelab-token", kubecfg.AuthInfos["homelab"].Token)
+	assert.Equal(t, "https://10.0.0.5:6443", kubecfg.Clusters["homelab"].Server)
+	assert.Equal(t, "apps", kubecfg.Contexts["homelab"].Namespace)
+	assert.True(t, kubeconfig.IsManaged(kubecfg, "homelab"))
+	assert.Equal(t, "https://manual.example.com", kubecfg.Clusters["manual"].Server)
+	assert.Equal(t, "https://rancher.example.com/k8s/clusters/c-prod", kubecfg.Clusters["prod"].Server)
+	assert.Equal(t, []plan.Skip{{Context: "manual", Reason: skipReasonNameTaken}, {Context: "prod", Reason: skipReasonNameTaken}}, opts.Plan.Skipped)
+	assert.Equal(t, []plan.ContextEntry{{Context: "homelab"}}, opts.Plan.AddedContexts)
+
+	// Unchanged tokens leave the entry as it is
+	second := plan.New(false)
+	opts.Plan = second
+	result = processStaticClusters(context.Background(), kubecfg, &staticcluster.Config{Clusters: static.Clusters[:1]}, opts, zap.NewNop())
+	assert.Equal(t, 0, result.updated)
+	assert.Equal(t, []plan.Skip{{Context: "homelab", Reason: skipReasonUpToDate}}, second.Skipped)
+}
+
+func TestUpdate_StaticClusters(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "me")
+
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "config")
+	staticPath := filepath.Join(dir, "static.yaml")
+	require.NoError(t, os.WriteFile(staticPath, []byte("clusters:\n- name: homelab\n  server: https://10.0.0.5:6443\n  token-command: echo homelab-token\n"), 0600))
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("STATIC_CLUSTERS", "")
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--server", server.URL, "--user", "admin", "-c", kubeconfigPath,
+		"--state-file", filepath.Join(dir, "state.json"), "--static-clusters", staticPath})
+	require.NoError(t, cmd.Execute())
+
+	saved, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	require.NoError(t, err)
+	require.Contains(t, saved.AuthInfos, "homelab")
+	assert.Equal(t, "homelab-token", saved.AuthInfos["homelab"].Token)
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/status"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// statusFormats lists the output formats of the status command
+var statusFormats = []string{"text", "json", "ics", "html", "markdown"}
+
+// NewStatusCmd creates the read-only command that reports when the kubeconfig's Rancher tokens expire.
+func NewStatusCmd() *cobra.Command {
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show when the Rancher tokens in the kubeconfig expire",
+		Long: "Looks up the expiry of the token of every kubeconfig entry that belongs to the\n" +
+			"Rancher server, soonest first.\n" +
+			"Formats:\n" +
+			"  text      An aligned table (default)\n" +
+			"  json      A JSON document\n" +
+			"  ics       An iCalendar feed with one event per token expiry, for on-call calendars\n" +
+			"  html      A self-contained page with a sortable table, to share or attach to emails\n" +
+			"  markdown  A Markdown table, for wikis\n" +
+			"Owners are read from a label of each Rancher cluster (--owner-label), next to its\n" +
+			"description, Kubernetes version, provider and node count. With --version-skew, clusters\n" +
+			"whose version is outside the range kubectl supports are flagged.\n" +
+			"The kubeconfig is never modified.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runStatus,
+	}
+
+	statusCmd.Flags().StringP("config", "c", "", "Path to kubeconfig file (default: ~/.kube/config)")
+	statusCmd.Flags().String("format", "text", "Output format: 'text', 'json', 'ics', 'html' or 'markdown'")
+	statusCmd.Flags().Int("remind-days", 7, "With --format ics, add a reminder this many days before each expiry (0 for none)")
+	statusCmd.Flags().String("owner-label", defaultOwnerLabel, "Label of the Rancher clusters naming their owner")
+	statusCmd.Flags().Bool("version-skew", false, "Warn about clusters whose Kubernetes version is more than --max-version-skew minor versions away from the local kubectl's")
+	statusCmd.Flags().Int("max-version-skew", 1, "With --version-skew, the number of minor versions a cluster may be older or newer than kubectl")
+	statusCmd.Flags().String("kubectl-version", "", "With --version-skew, the kubectl version to compare with, e.g. v1.30.2 (default: from 'kubectl version --client')")
+	addRancherFlags(statusCmd)
+
+	return statusCmd
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the report, so logs go to stderr
+	zapLogger := logger.NewLoggerWithWriter(os.Stderr, zapcore.WarnLevel)
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	format, _ := cmd.Flags().GetString("format")
+	if !slices.Contains(statusFormats, format) {
+		return fmt.Errorf("invalid format %q. Must be 'text', 'json', 'ics', 'html' or 'markdown'", format)
+	}
+	remindDays, _ := cmd.Flags().GetInt("remind-days")
+	if remindDays < 0 {
+		return fmt.Errorf("invalid remind-days %d. Must not be negative", remindDays)
+	}
+	maxSkew, _ := cmd.Flags().GetInt("max-version-skew")
+	if maxSkew < 0 {
+		return fmt.Errorf("invalid max-version-skew %d. Must not be negative", maxSkew)
+	}
+
+	kubeconfigPath, _ := cmd.Flags().GetString("config")
+	kubecfg, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig file: %w", err)
+	}
+
+	client, rancherURL, err := newRancherClient(cmd, zapLogger)
+	if err != nil {
+		return err
+	}
+
+	entries := status.Collect(kubecfg, rancherURL, client)
+	// Owners and cluster details are a nicety; the expiry report is still useful without them
+	if clusters, err := client.ListClusters(); err != nil {
+		zapLogger.Warn("Failed to retrieve cluster list from Rancher, owners and cluster details are not shown", zap.Error(err))
+	} else {
+		ownerLabel, _ := cmd.Flags().GetString("owner-label")
+		status.SetOwners(entries, clusters, ownerLabel)
+		status.SetDetails(entries, clusters)
+		if checkSkew, _ := cmd.Flags().GetBool("version-skew"); checkSkew {
+			checkVersionSkew(cmd, entries, maxSkew, zapLogger)
+		}
+	}
+
+	now := time.Now()
+	switch format {
+	case "html":
+		return status.WriteHTML(cmd.OutOrStdout(), entries, rancherURL, now)
+	case "markdown":
+		return status.WriteMarkdown(cmd.OutOrStdout(), entries, rancherURL, now)
+	case "json":
+		return writeStatusJSON(cmd.OutOrStdout(), entries, rancherURL)
+	case "ics":
+		return status.WriteICS(cmd.OutOrStdout(), entries, rancherURL, remindDays, now)
+	default:
+		return writeStatusText(cmd.OutOrStdout(), entries, now)
+	}
+}
+
+// writeStatusText prints the entries as an aligned table
+func writeStatusText(w io.Writer, entries []status.Entry, now time.Time) error {
+	if len(entries) == 0 {
+		_, err := fmt.Fprintln(w, "No Rancher entries found in the kubeconfig for this server")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "CONTEXT\tCLUSTER\tVERSION\tPROVIDER\tNODES\tEXPIRES\tDAYS LEFT\tLAST ROTATED\tDESCRIPTION")
+	for _, e := range entries {
+		expires, daysLeft := "unknown: "+e.Error, "-"
+		switch {
+		case e.NeverExpires:
+			expires = "never"
+		case !e.ExpiresAt.IsZero():
+			expires = e.ExpiresAt.Format(time.RFC3339)
+			days, _ := e.DaysLeft(now)
+			daysLeft = strconv.Itoa(days)
+		}
+		lastRotated := "-"
+		if !e.LastRotated.IsZero() {
+			lastRotated = e.LastRotated.Format(time.RFC3339)
+		}
+		nodes := "-"
+		if e.NodeCount > 0 {
+			nodes = strconv.Itoa(e.NodeCount)
+		}
+		version := orDash(e.KubernetesVersion)
+		if e.VersionWarning != "" {
+			version += " (!)"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Context, e.ClusterID,
+			version, orDash(e.Provider), nodes, expires, daysLeft, lastRotated, orDash(e.Description))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if warnings := status.VersionWarnings(entries); len(warnings) > 0 {
+		_, _ = fmt.Fprintln(w, "\nVersion skew:")
+		for _, warning := range warnings {
+			_, _ = fmt.Fprintln(w, "  "+warning)
+		}
+	}
+	return nil
+}
+
+// checkVersionSkew flags the entries whose cluster version is too far from the local kubectl's.
+// Without a kubectl version the report is still useful, so failures are only logged.
+func checkVersionSkew(cmd *cobra.Command, entries []status.Entry, maxSkew int, zapLogger *zap.Logger) {
+	version, _ := cmd.Flags().GetString("kubectl-version")
+	if version == "" {
+		var err error
+		if version, err = kubectlClientVersion(commandContext(cmd)); err != nil {
+			zapLogger.Warn("Failed to get the kubectl version, version skew is not checked", zap.Error(err))
+			return
+		}
+	}
+	if err := status.CheckVersionSkew(entries, version, maxSkew); err != nil {
+		zapLogger.Warn("Version skew is not checked", zap.Error(err))
+	}
+}
+
+// kubectlClientVersion returns the version of the kubectl on the PATH, e.g. "v1.30.2"
+func kubectlClientVersion(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "kubectl", "version", "--client", "-o", "json").Output()
+	if err != nil {
+		return "", fmt.Errorf("kubectl version failed: %w", err)
+	}
+	var version struct {
+		ClientVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"clientVersion"`
+	}
+	if err := json.Unmarshal(out, &version); err != nil {
+		return "", fmt.Errorf("failed to parse kubectl version: %w", err)
+	}
+	if version.ClientVersion.GitVersion == "" {
+		return "", errors.New("kubectl reported no client version")
+	}
+	return version.ClientVersion.GitVersion, nil
+}
+
+// writeStatusJSON prints the entries as a JSON document
+func writeStatusJSON(w io.Writer, entries []status.Entry, rancherURL string) error {
+	if entries == nil {
+		entries = []status.Entry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		RancherURL string         `json:"rancherUrl"`
+		Entries    []status.Entry `json:"entries"`
+	}{rancherURL, entries})
+}
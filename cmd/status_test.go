@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"rancher-kubeconfig-updater/internal/status"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusCmd_FlagsRegistered(t *testing.T) {
+	cmd := NewStatusCmd()
+
+	assert.NotNil(t, cmd.Flags().Lookup("config"))
+	assert.Equal(t, "text", cmd.Flags().Lookup("format").DefValue)
+	assert.Equal(t, "7", cmd.Flags().Lookup("remind-days").DefValue)
+	assert.Equal(t, "false", cmd.Flags().Lookup("version-skew").DefValue)
+	assert.Equal(t, "1", cmd.Flags().Lookup("max-version-skew").DefValue)
+	assert.Equal(t, "owner", cmd.Flags().Lookup("owner-label").DefValue)
+	assert.NotNil(t, cmd.Flags().Lookup("server"))
+}
+
+func TestStatusCmd_InvalidFormat(t *testing.T) {
+	cmd := NewStatusCmd()
+	cmd.SetArgs([]string{"--format", "csv"})
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid format "csv"`)
+}
+
+func TestWriteStatusText(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	err := writeStatusText(&buf, []status.Entry{
+		{Context: "prod", ClusterID: "c-m-prod", ExpiresAt: now.Add(72 * time.Hour), LastRotated: now.Add(-24 * time.Hour),
+			Description: "Payments EU", KubernetesVersion: "v1.30.4+rke2r1", Provider: "rke2", NodeCount: 5},
+		{Context: "dev", ClusterID: "c-m-dev", NeverExpires: true},
+		{Context: "old", ClusterID: "c-m-old", Error: "token not found in Rancher",
+			KubernetesVersion: "v1.24.17", VersionWarning: "Kubernetes v1.24.17 is 6 minor versions older than kubectl v1.30.2 (supported: 1)"},
+	}, now)
+	require.NoError(t, err)
+
+	output := buf.String()
+	assert.Contains(t, output, "DAYS LEFT")
+	assert.Regexp(t, `prod\s+c-m-prod\s+v1\.30\.4\+rke2r1\s+rke2\s+5\s+2026-03-04T12:00:00Z\s+3\s+2026-02-28T12:00:00Z\s+Payments EU\n`, output)
+	assert.Regexp(t, `dev\s+c-m-dev\s+-\s+-\s+-\s+never\s+-\s+-\s+-\n`, output)
+	assert.Contains(t, output, "unknown: token not found in Rancher")
+	assert.Regexp(t, `old\s+c-m-old\s+v1\.24\.17 \(!\)`, output)
+	assert.True(t, strings.HasSuffix(output, "\nVersion skew:\n  old: Kubernetes v1.24.17 is 6 minor versions older than kubectl v1.30.2 (supported: 1)\n"))
+
+	buf.Reset()
+	require.NoError(t, writeStatusText(&buf, nil, now))
+	assert.Contains(t, buf.String(), "No Rancher entries")
+}
+
+func TestWriteStatusJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeStatusJSON(&buf, nil, "https://rancher.example.com"))
+
+	var decoded struct {
+		RancherURL string         `json:"rancherUrl"`
+		Entries    []status.Entry `json:"entries"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "https://rancher.example.com", decoded.RancherURL)
+	assert.NotNil(t, decoded.Entries)
+	assert.Empty(t, decoded.Entries)
+}
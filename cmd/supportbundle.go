@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/status"
+	"rancher-kubeconfig-updater/internal/supportbundle"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// supportBundleErrors is the number of Rancher error responses a support bundle keeps
+const supportBundleErrors = 50
+
+// NewSupportBundleCmd creates the command that collects diagnostic data for bug reports.
+func NewSupportBundleCmd() *cobra.Command {
+	bundleCmd := &cobra.Command{
+		Use:   "support-bundle",
+		Short: "Collect diagnostic data without secrets into an archive to attach to bug reports",
+		Long: "Logs in to Rancher and looks up the token of every kubeconfig entry, like status, and\n" +
+			"writes what it finds to a tar.gz archive:\n" +
+			"  versions.json     Versions of this tool, Go, the platform and each Rancher server\n" +
+			"  config.json       Effective settings from flags and environment variables\n" +
+			"  kubeconfig.yaml   The kubeconfig's structure, without tokens, keys or certificates\n" +
+			"  diagnostics.log   Debug log of the checks\n" +
+			"  api-errors.json   Error responses from Rancher, up to the last 50\n" +
+			"  logs/             The files given with --log-file\n" +
+			"Secrets are removed from every file; review the archive before sharing it anyway.\n" +
+			"Neither the kubeconfig nor Rancher is modified.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runSupportBundle,
+	}
+
+	bundleCmd.Flags().String("out", "", "Archive to write (default: rancher-support-bundle-<UTC timestamp>.tar.gz in the current directory)")
+	bundleCmd.Flags().StringP("config", "c", "", "Path to kubeconfig file (default: ~/.kube/config)")
+	bundleCmd.Flags().StringSlice("log-file", nil, "Log file of earlier runs to include with secrets removed, e.g. the output of a cron job (repeatable)")
+	addRancherFlags(bundleCmd)
+
+	return bundleCmd
+}
+
+func runSupportBundle(cmd *cobra.Command, args []string) error {
+	zapLogger := logger.NewLogger()
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	now := time.Now()
+	out, _ := cmd.Flags().GetString("out")
+	if out == "" {
+		out = "rancher-support-bundle-" + now.UTC().Format("20060102T150405Z") + ".tar.gz"
+	}
+	bundle := supportbundle.New(now)
+
+	var diagnostics bytes.Buffer
+	diagLogger := logger.NewLoggerWithWriter(&diagnostics, zapcore.DebugLevel)
+	apiErrors := rancher.NewErrorLog(supportBundleErrors)
+
+	zapLogger.Info("Collecting diagnostic data")
+	versions := toolVersions()
+	collectDiagnostics(cmd, bundle, &versions, apiErrors, diagLogger)
+	_ = diagLogger.Sync()
+
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"versions.json", versions},
+		{"config.json", effectiveConfig(cmd)},
+		{"api-errors.json", redactAPIErrors(apiErrors.Errors())},
+	}
+	for _, f := range files {
+		if err := bundle.AddJSON(f.name, f.v); err != nil {
+			return err
+		}
+	}
+	bundle.Add("diagnostics.log", []byte(redactLines(diagnostics.String())))
+
+	logFiles, _ := cmd.Flags().GetStringSlice("log-file")
+	for _, path := range logFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			zapLogger.Warn("Failed to read log file, leaving it out", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		bundle.Add("logs/"+filepath.Base(path), []byte(redactLines(string(data))))
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf); err != nil {
+		return err
+	}
+	tx := kubeconfig.NewTransaction()
+	tx.Stage(out, buf.Bytes(), 0600)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write support bundle: %w", err)
+	}
+	zapLogger.Info("Support bundle written, review it before attaching it to a bug report",
+		zap.String("path", out), zap.Strings("files", bundle.Names()))
+	return nil
+}
+
+// collectDiagnostics adds the redacted kubeconfig to bundle and logs the checks against every
+// Rancher server to diagLogger, recording Rancher's error responses in apiErrors. Failures are
+// logged, not returned: they are what the bundle is for.
+func collectDiagnostics(cmd *cobra.Command, bundle *supportbundle.Bundle, versions *bundleVersions, apiErrors *rancher.ErrorLog, diagLogger *zap.Logger) {
+	kubeconfigPath, _ := cmd.Flags().GetString("config")
+	kubecfg, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	if err != nil {
+		diagLogger.Error("Failed to load kubeconfig file", zap.Error(err))
+	} else {
+		diagLogger.Info("Loaded kubeconfig",
+			zap.Int("contexts", len(kubecfg.Contexts)), zap.Int("clusters", len(kubecfg.Clusters)), zap.Int("users", len(kubecfg.AuthInfos)))
+		if data, err := clientcmd.Write(*supportbundle.RedactKubeconfig(kubecfg, rancher.TokenName)); err != nil {
+			diagLogger.Error("Failed to encode kubeconfig structure", zap.Error(err))
+		} else {
+			bundle.Add("kubeconfig.yaml", data)
+		}
+	}
+
+	settings, err := resolveRancherSettings(cmd)
+	if err != nil {
+		diagLogger.Error("Invalid Rancher settings", zap.Error(err))
+		return
+	}
+	settings.apiErrors = apiErrors
+	credentials := newCredentialSource(cmd, settings)
+	defer credentials.clear()
+	sources, clearSources := credentialsPerServer(cmd, settings, credentials)
+	defer clearSources()
+
+	for i, serverSettings := range settings.perServer() {
+		serverLogger := diagLogger.With(zap.String("server", serverSettings.url))
+		client, rancherURL, err := connectRancher(serverSettings, sources[i], serverLogger)
+		if err != nil {
+			serverLogger.Error("Failed to log in", zap.Error(err))
+			continue
+		}
+		serverLogger.Info("Logged in", zap.String("authType", string(serverSettings.authType)))
+
+		if version, err := client.ServerVersion(); err != nil {
+			serverLogger.Warn("Failed to get Rancher version", zap.Error(err))
+		} else {
+			versions.Rancher[rancherURL] = version
+		}
+		clusters, err := client.ListClusters()
+		if err != nil {
+			serverLogger.Error("Failed to list clusters", zap.Error(err))
+		} else {
+			serverLogger.Info("Listed clusters", zap.Int("clusters", len(clusters)))
+		}
+		if kubecfg == nil {
+			continue
+		}
+		for _, entry := range status.Collect(kubecfg, rancherURL, client) {
+			fields := []zap.Field{zap.String("context", entry.Context), zap.String("clusterId", entry.ClusterID), zap.String("tokenName", entry.TokenName)}
+			switch {
+			case entry.Error != "":
+				serverLogger.Warn("Failed to look up token", append(fields, zap.String("error", entry.Error))...)
+			case entry.NeverExpires:
+				serverLogger.Info("Token never expires", fields...)
+			default:
+				serverLogger.Info("Token expiry", append(fields, zap.Time("expiresAt", entry.ExpiresAt))...)
+			}
+		}
+	}
+}
+
+// bundleVersions is versions.json of a support bundle
+type bundleVersions struct {
+	Tool     string `json:"tool"`
+	Revision string `json:"revision,omitempty"`
+	Go       string `json:"go"`
+	Platform string `json:"platform"`
+	// Rancher maps each server URL to its version
+	Rancher map[string]string `json:"rancher"`
+}
+
+// toolVersions returns the versions of this binary; Rancher versions are added as servers answer
+func toolVersions() bundleVersions {
+	v := bundleVersions{
+		Tool:     "unknown",
+		Go:       runtime.Version(),
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+		Rancher:  make(map[string]string),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		v.Tool = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				v.Revision = setting.Value
+			}
+		}
+	}
+	return v
+}
+
+// bundleConfig is config.json of a support bundle
+type bundleConfig struct {
+	// Flags are the flags given to support-bundle
+	Flags map[string]string `json:"flags"`
+	// Environment holds the environment variables this tool reads, and proxy settings
+	Environment map[string]string `json:"environment"`
+}
+
+// extraEnvKeys are environment variables read by this tool whose names don't follow a flag name
+var extraEnvKeys = []string{"LISTEN_ADDRESS", "SNAPSHOT_PASSPHRASE", "TOKEN_THRESHOLD_DAYS", "KUBECONFIG", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"}
+
+// effectiveConfig returns the flags of cmd and the relevant environment with secrets removed.
+// The environment variables are those named after any flag of the command tree, with or
+// without a RANCHER_ prefix, and extraEnvKeys.
+func effectiveConfig(cmd *cobra.Command) bundleConfig {
+	cfg := bundleConfig{Flags: make(map[string]string), Environment: make(map[string]string)}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		cfg.Flags[f.Name] = redactSetting(f.Name, f.Value.String())
+	})
+
+	keys := slices.Clone(extraEnvKeys)
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		addKey := func(f *pflag.Flag) {
+			key := strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+			keys = append(keys, key, "RANCHER_"+key)
+		}
+		c.Flags().VisitAll(addKey)
+		c.PersistentFlags().VisitAll(addKey)
+		for _, sub := range c.Commands() {
+			walk(sub)
+		}
+	}
+	walk(cmd.Root())
+	for _, key := range keys {
+		for _, name := range []string{key, strings.ToLower(key)} {
+			if value, ok := os.LookupEnv(name); ok {
+				cfg.Environment[name] = redactSetting(name, value)
+			}
+		}
+	}
+	return cfg
+}
+
+// redactSetting returns value with secrets removed: values of password, passphrase, secret,
+// token and key settings entirely, the password of URLs (e.g. proxies), and Rancher tokens
+func redactSetting(name, value string) string {
+	upper := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	for _, marker := range []string{"PASSWORD", "PASSPHRASE", "SECRET"} {
+		if strings.Contains(upper, marker) {
+			return "[REDACTED]"
+		}
+	}
+	if strings.HasSuffix(upper, "_TOKEN") || strings.HasSuffix(upper, "_KEY") {
+		return "[REDACTED]"
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+			value = u.String()
+		}
+	}
+	return logger.Redact(value)
+}
+
+// redactAPIErrors removes Rancher tokens from the error response bodies
+func redactAPIErrors(errors []rancher.APIError) []rancher.APIError {
+	for i := range errors {
+		errors[i].Body = logger.Redact(errors[i].Body)
+	}
+	if errors == nil {
+		errors = []rancher.APIError{}
+	}
+	return errors
+}
+
+// redactLines removes Rancher tokens and bearer credentials from every line of text
+func redactLines(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = logger.Redact(line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/history"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"rancher-kubeconfig-updater/internal/status"
+	"rancher-kubeconfig-updater/internal/textfile"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// expiryCollector gathers the token expiry of every server's contexts for --textfile-dir.
+// It is safe for concurrent use and on a nil *expiryCollector, which collects nothing.
+type expiryCollector struct {
+	mu       sync.Mutex
+	expiries []textfile.Expiry
+}
+
+// newExpiryCollector returns a collector when --textfile-dir is given, or nil
+func newExpiryCollector(cmd *cobra.Command) *expiryCollector {
+	if config.GetConfig(cmd, "textfile-dir", "TEXTFILE_DIR") == "" {
+		return nil
+	}
+	return &expiryCollector{}
+}
+
+// collect looks up the token expiry of the contexts of kubecfg that belong to rancherURL.
+// Tokens checked during the run are cached by the client, so mostly new tokens cost a request.
+func (c *expiryCollector) collect(kubecfg *api.Config, rancherURL string, client *rancher.Client) {
+	if c == nil {
+		return
+	}
+	entries := status.Collect(kubecfg, rancherURL, client)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range entries {
+		c.expiries = append(c.expiries, textfile.Expiry{Server: rancherURL, Entry: e})
+	}
+}
+
+// writeTextfile writes the .prom file of run to --textfile-dir. Failures are only logged, the
+// monitoring file must never fail a run.
+func writeTextfile(cmd *cobra.Command, run history.Run, expiries *expiryCollector, zapLogger *zap.Logger) {
+	dir := config.GetConfig(cmd, "textfile-dir", "TEXTFILE_DIR")
+	if dir == "" || expiries == nil {
+		return
+	}
+	path := filepath.Join(dir, textfile.FileName)
+	if err := readonly.Check(path); err != nil {
+		zapLogger.Debug("Read-only mode, textfile is not written", zap.String("path", path))
+		return
+	}
+
+	expiries.mu.Lock()
+	var b bytes.Buffer
+	err := textfile.Write(&b, run, expiries.expiries)
+	expiries.mu.Unlock()
+	if err != nil {
+		zapLogger.Warn("Failed to write textfile", zap.Error(err))
+		return
+	}
+	// node_exporter only reads *.prom files, so it never sees the temporary file
+	tx := kubeconfig.NewTransaction()
+	tx.Stage(path, b.Bytes(), 0644)
+	if err := tx.Commit(); err != nil {
+		zapLogger.Warn("Failed to write textfile", zap.String("path", path), zap.Error(err))
+		return
+	}
+	zapLogger.Debug("Wrote textfile for node_exporter", zap.String("path", path))
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/textfile"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate_TextfileDir(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "me", rancher.Cluster{ID: "c-prod", Name: "prod"})
+
+	dir := t.TempDir()
+	textfileDir := filepath.Join(dir, "textfile")
+	require.NoError(t, os.Mkdir(textfileDir, 0755))
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	t.Setenv("TEXTFILE_DIR", "")
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--server", server.URL, "--user", "admin", "-c", filepath.Join(dir, "config"), "--auto-create",
+		"--state-file", filepath.Join(dir, "state.json"), "--textfile-dir", textfileDir})
+	require.NoError(t, cmd.Execute())
+
+	data, err := os.ReadFile(filepath.Join(textfileDir, textfile.FileName))
+	require.NoError(t, err)
+	text := string(data)
+	assert.Contains(t, text, "rancher_kubeconfig_updater_last_run_success 1\n")
+	assert.Contains(t, text, `rancher_kubeconfig_updater_last_run_clusters{result="created"} 1`+"\n")
+
+	entries, err := os.ReadDir(textfileDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file is left behind")
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// NewTFOutputCmd creates the Terraform/OpenTofu external data source command.
+func NewTFOutputCmd() *cobra.Command {
+	tfOutputCmd := &cobra.Command{
+		Use:   "tf-output",
+		Short: "Print fresh cluster credentials for a Terraform external data source",
+		Long: "Implements the Terraform/OpenTofu external data source protocol: reads the query\n" +
+			"object from stdin, refreshes the tokens in the kubeconfig when needed, and prints\n" +
+			"a JSON object keyed by cluster name. Each value is a JSON string holding the\n" +
+			"cluster's server URL and token, to be read with jsondecode().\n" +
+			"Query keys are flag names with '_' instead of '-', e.g. {\"cluster\": \"prod\", \"threshold_days\": \"7\"}.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runTFOutput,
+	}
+
+	tfOutputCmd.Flags().String("cluster", "", "Comma-separated list of cluster names or IDs to include (default: all)")
+	tfOutputCmd.Flags().StringP("config", "c", "", "Path to kubeconfig file (default: ~/.kube/config)")
+	tfOutputCmd.Flags().Int("threshold-days", 30, "Expiration threshold in days")
+	tfOutputCmd.Flags().Bool("force-refresh", false, "Bypass expiration checks and force regeneration")
+	tfOutputCmd.Flags().Bool("include-local", true, "Include Rancher's 'local' management cluster (use --include-local=false to skip it)")
+	tfOutputCmd.Flags().String("state-file", "", "Path to the state file tracking managed entries (default: <user cache dir>/rancher-kubeconfig-updater/state.json)")
+	addGatewayFlag(tfOutputCmd)
+	addRancherFlags(tfOutputCmd)
+	addSaveFlags(tfOutputCmd)
+
+	return tfOutputCmd
+}
+
+// tfCluster is the credential of one cluster in the tf-output result
+type tfCluster struct {
+	Server                   string `json:"server"`
+	Token                    string `json:"token"`
+	CertificateAuthorityData string `json:"certificate_authority_data,omitempty"`
+}
+
+func runTFOutput(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the result object, so logs go to stderr where Terraform shows them on failure
+	zapLogger := logger.NewLoggerWithWriter(os.Stderr, zapcore.WarnLevel)
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+
+	// Terraform always sends a query object; an interactive run has none
+	if !stdinIsTerminal() {
+		if err := applyTFQuery(cmd, cmd.InOrStdin()); err != nil {
+			return err
+		}
+	}
+
+	kubeconfigPath, _ := cmd.Flags().GetString("config")
+	clusterFilter, _ := cmd.Flags().GetString("cluster")
+	includeLocal, _ := cmd.Flags().GetBool("include-local")
+	clusters, kubecfg, err := ensureFreshClusters(cmd, kubeconfigPath, func(all rancher.Clusters) (rancher.Clusters, error) {
+		if !includeLocal {
+			all = excludeLocalCluster(all, zapLogger)
+		}
+		if clusterFilter != "" {
+			all = filterClusters(all, clusterFilter, zapLogger)
+		}
+		return all, nil
+	}, zapLogger)
+	if err != nil {
+		return err
+	}
+
+	result, err := tfResult(kubecfg, clusters)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(cmd.OutOrStdout()).Encode(result)
+}
+
+// applyTFQuery sets the flags named by the keys of the Terraform query object read from r.
+// The protocol only allows string values, which are parsed like flag values.
+func applyTFQuery(cmd *cobra.Command, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read query: %w", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	var query map[string]string
+	if err := json.Unmarshal(data, &query); err != nil {
+		return fmt.Errorf("query must be a JSON object with string values: %w", err)
+	}
+	for key, value := range query {
+		name := strings.ReplaceAll(key, "_", "-")
+		if cmd.Flags().Lookup(name) == nil {
+			return fmt.Errorf("unknown query key %q", key)
+		}
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("invalid query value for %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// tfResult builds the result object: cluster name to a JSON-encoded tfCluster, because the
+// protocol only allows string values
+func tfResult(kubecfg *api.Config, clusters rancher.Clusters) (map[string]string, error) {
+	result := make(map[string]string, len(clusters))
+	for _, c := range clusters {
+		ctx, ok := kubecfg.Contexts[c.Name]
+		if !ok {
+			return nil, fmt.Errorf("context %s not found in kubeconfig", c.Name)
+		}
+		cluster, ok := kubecfg.Clusters[ctx.Cluster]
+		if !ok {
+			return nil, fmt.Errorf("cluster %s of context %s not found in kubeconfig", ctx.Cluster, c.Name)
+		}
+		authInfo, ok := kubecfg.AuthInfos[ctx.AuthInfo]
+		if !ok || authInfo.Token == "" {
+			return nil, fmt.Errorf("context %s has no token; tf-output needs generated tokens (kubeconfig-generate-token enabled on the server)", c.Name)
+		}
+
+		entry := tfCluster{Server: cluster.Server, Token: authInfo.Token}
+		if len(cluster.CertificateAuthorityData) > 0 {
+			entry.CertificateAuthorityData = base64.StdEncoding.EncodeToString(cluster.CertificateAuthorityData)
+		}
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		result[c.Name] = string(encoded)
+	}
+	return result, nil
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"encoding/json"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestApplyTFQuery(t *testing.T) {
+	cmd := NewTFOutputCmd()
+	require.NoError(t, applyTFQuery(cmd, strings.NewReader(`{"cluster": "prod,staging", "threshold_days": "7", "include_local": "false"}`)))
+
+	cluster, _ := cmd.Flags().GetString("cluster")
+	assert.Equal(t, "prod,staging", cluster)
+	threshold, _ := cmd.Flags().GetInt("threshold-days")
+	assert.Equal(t, 7, threshold)
+	includeLocal, _ := cmd.Flags().GetBool("include-local")
+	assert.False(t, includeLocal)
+
+	// Terraform always sends an object, but an empty stdin is tolerated
+	assert.NoError(t, applyTFQuery(NewTFOutputCmd(), strings.NewReader("")))
+}
+
+func TestApplyTFQuery_Invalid(t *testing.T) {
+	for name, query := range map[string]string{
+		"unknown key":      `{"colour": "blue"}`,
+		"non-string value": `{"threshold_days": 7}`,
+		"invalid value":    `{"threshold_days": "soon"}`,
+		"not an object":    `["prod"]`,
+	} {
+		err := applyTFQuery(NewTFOutputCmd(), strings.NewReader(query))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestTFResult(t *testing.T) {
+	kubecfg := api.NewConfig()
+	kubecfg.Clusters["prod"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-prod", CertificateAuthorityData: []byte("ca")}
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-abc:secret"}
+	kubecfg.Contexts["prod"] = &api.Context{Cluster: "prod", AuthInfo: "prod"}
+
+	result, err := tfResult(kubecfg, rancher.Clusters{{ID: "c-prod", Name: "prod"}})
+	require.NoError(t, err)
+	require.Contains(t, result, "prod")
+
+	var entry tfCluster
+	require.NoError(t, json.Unmarshal([]byte(result["prod"]), &entry))
+	assert.Equal(t, tfCluster{
+		Server:                   "https://rancher.example.com/k8s/clusters/c-prod",
+		Token:                    "kubeconfig-u-abc:secret",
+		CertificateAuthorityData: "Y2E=",
+	}, entry)
+}
+
+func TestTFResult_NoToken(t *testing.T) {
+	kubecfg := api.NewConfig()
+	kubecfg.Clusters["prod"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-prod"}
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Exec: &api.ExecConfig{Command: "rancher"}}
+	kubecfg.Contexts["prod"] = &api.Context{Cluster: "prod", AuthInfo: "prod"}
+
+	_, err := tfResult(kubecfg, rancher.Clusters{{ID: "c-prod", Name: "prod"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no token")
+
+	_, err = tfResult(kubecfg, rancher.Clusters{{ID: "c-gone", Name: "gone"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"rancher-kubeconfig-updater/internal/history"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"rancher-kubeconfig-updater/internal/schedule"
+	"rancher-kubeconfig-updater/internal/status"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// defaultTrayInterval is how often the tray mode updates without --interval or --schedule
+const defaultTrayInterval = time.Hour
+
+// trayUI is the tray or menu bar icon the tray mode reports to
+type trayUI interface {
+	// SetStatus shows title next to the icon and tooltip when hovering it
+	SetStatus(title, tooltip string)
+	// Notify shows a desktop notification
+	Notify(title, message string)
+}
+
+// runTray updates the kubeconfig at the times of sched and whenever refresh receives, until ctx
+// ends. After every update the days until the earliest token expiry are shown on ui, and a
+// failed update is surfaced as a desktop notification.
+func runTray(ctx context.Context, cmd *cobra.Command, args []string, sched schedule.Schedule, ui trayUI, refresh <-chan struct{}, zapLogger *zap.Logger) {
+	var notified string
+	for {
+		ui.SetStatus("…", i18n.T(i18n.TrayRefreshing))
+		update(cmd, args, nil)
+
+		entries, err := collectStatus(cmd, nil, zapLogger)
+		if err != nil {
+			zapLogger.Warn("Failed to collect token expiry data", zap.Error(err))
+			ui.SetStatus("?", i18n.T(i18n.TrayStatusFailed, err))
+		} else {
+			ui.SetStatus(traySummary(entries, time.Now()))
+		}
+		runs, err := loadHistory(cmd)
+		if err != nil {
+			zapLogger.Warn("Failed to read run history", zap.Error(err))
+		} else if len(runs) > 0 && runs[len(runs)-1].ID != notified {
+			last := runs[len(runs)-1]
+			notified = last.ID
+			if message, failed := runFailure(last); failed {
+				ui.Notify(i18n.T(i18n.TrayRefreshFailed), message)
+			}
+		}
+
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			zapLogger.Error("Schedule has no further update times, only manual refreshes are left", zap.Stringer("schedule", sched))
+		}
+		if !waitTray(ctx, next, refresh, zapLogger) {
+			return
+		}
+	}
+}
+
+// waitTray waits until next, or only for a refresh if next is zero. It returns false if ctx ended.
+func waitTray(ctx context.Context, next time.Time, refresh <-chan struct{}, zapLogger *zap.Logger) bool {
+	var timer <-chan time.Time
+	if !next.IsZero() {
+		t := time.NewTimer(time.Until(next))
+		defer t.Stop()
+		timer = t.C
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-refresh:
+		zapLogger.Info("Refresh requested from the tray")
+	case <-timer:
+	}
+	return true
+}
+
+// traySummary returns the tray title, the days until the earliest token expiry, and a tooltip
+// naming the context it belongs to
+func traySummary(entries []status.Entry, now time.Time) (title, tooltip string) {
+	var earliest *status.Entry
+	unknown := 0
+	for i, e := range entries {
+		switch {
+		case e.Error != "":
+			unknown++
+		case !e.ExpiresAt.IsZero() && (earliest == nil || e.ExpiresAt.Before(earliest.ExpiresAt)):
+			earliest = &entries[i]
+		}
+	}
+	var notes []string
+	if unknown > 0 {
+		notes = append(notes, i18n.T(i18n.TrayUnknownCount, unknown))
+	}
+	switch {
+	case earliest != nil:
+		days, _ := earliest.DaysLeft(now)
+		title = fmt.Sprintf("%dd", days)
+		tooltip = i18n.T(i18n.TrayEarliest, earliest.Context, days, earliest.ExpiresAt.Format(time.RFC3339))
+		if !earliest.ExpiresAt.After(now) {
+			title = i18n.T(i18n.TrayExpiredTitle)
+			tooltip = i18n.T(i18n.TrayExpired, earliest.Context, earliest.ExpiresAt.Format(time.RFC3339))
+		}
+	case unknown > 0:
+		return "?", i18n.T(i18n.TrayAllUnknown, unknown)
+	case len(entries) == 0:
+		return "-", i18n.T(i18n.TrayNoEntries)
+	default:
+		return "∞", i18n.T(i18n.TrayNeverExpires)
+	}
+	if len(notes) > 0 {
+		tooltip += "; " + strings.Join(notes, ", ")
+	}
+	return title, tooltip
+}
+
+// runFailure describes what failed in run, and reports whether anything did
+func runFailure(run history.Run) (string, bool) {
+	if run.Outcome == history.OutcomeSucceeded {
+		return "", false
+	}
+	var failed []string
+	for _, c := range run.Clusters {
+		if c.Result == history.ResultFailed {
+			failed = append(failed, c.Cluster)
+		}
+	}
+	switch {
+	case len(failed) > 0:
+		return i18n.T(i18n.TrayClustersFailed, len(failed), strings.Join(failed, ", ")), true
+	case len(run.Errors) > 0:
+		return run.Errors[0], true
+	default:
+		return i18n.T(i18n.TrayRunOutcome, run.Outcome), true
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !tray
+
+package cmd
+
+import (
+	"rancher-kubeconfig-updater/internal/schedule"
+
+	"github.com/spf13/cobra"
+)
+
+// addTrayFlag does nothing; --tray needs a build with the tray tag
+func addTrayFlag(cmd *cobra.Command) {}
+
+// trayEnabled reports false, builds without the tray tag have no tray mode
+func trayEnabled(cmd *cobra.Command) bool {
+	return false
+}
+
+// runTrayMode is never called without the tray tag
+func runTrayMode(cmd *cobra.Command, args []string, sched schedule.Schedule) {}
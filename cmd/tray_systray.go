@@ -0,0 +1,126 @@
+//go:build tray
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/signal"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/desktopnotify"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/schedule"
+	"runtime"
+	"syscall"
+
+	"fyne.io/systray"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// addTrayFlag adds --tray, which builds with the tray tag have
+func addTrayFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("tray", false, "Keep running as a tray/menu bar icon showing the days until the earliest token expiry, with a refresh action and desktop notifications on failures (updates every hour unless --interval or --schedule is given)")
+}
+
+// trayEnabled reports whether --tray was given
+func trayEnabled(cmd *cobra.Command) bool {
+	return config.GetBool(cmd, "tray", "TRAY")
+}
+
+// runTrayMode shows the tray icon and updates the kubeconfig at the times of sched, or every
+// hour when sched is nil, until the user quits from the menu or the process is interrupted
+func runTrayMode(cmd *cobra.Command, args []string, sched schedule.Schedule) {
+	zapLogger := logger.NewLogger()
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+	if sched == nil {
+		sched = schedule.Every(defaultTrayInterval)
+	}
+
+	ctx, stop := signal.NotifyContext(commandContext(cmd), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	zapLogger.Info("Tray mode enabled", zap.Stringer("schedule", sched))
+	systray.Run(func() {
+		systray.SetIcon(trayIcon())
+		systray.SetTooltip("rancher-kubeconfig-updater")
+		refreshItem := systray.AddMenuItem(i18n.T(i18n.TrayRefresh), i18n.T(i18n.TrayRefreshHint))
+		systray.AddSeparator()
+		quitItem := systray.AddMenuItem(i18n.T(i18n.TrayQuit), i18n.T(i18n.TrayQuitHint))
+
+		// A refresh requested during an update runs once it has finished
+		refresh := make(chan struct{}, 1)
+		go func() {
+			for {
+				select {
+				case <-refreshItem.ClickedCh:
+					select {
+					case refresh <- struct{}{}:
+					default:
+					}
+				case <-quitItem.ClickedCh:
+					stop()
+				case <-ctx.Done():
+					systray.Quit()
+					return
+				}
+			}
+		}()
+		go runTray(ctx, cmd, args, sched, systrayUI{ctx: ctx, zapLogger: zapLogger}, refresh, zapLogger)
+	}, stop)
+	zapLogger.Info("Tray mode stopped")
+}
+
+// systrayUI shows the tray mode's status on the system tray icon
+type systrayUI struct {
+	ctx       context.Context
+	zapLogger *zap.Logger
+}
+
+func (u systrayUI) SetStatus(title, tooltip string) {
+	systray.SetTitle(title)
+	systray.SetTooltip(tooltip)
+}
+
+func (u systrayUI) Notify(title, message string) {
+	if err := desktopnotify.Send(u.ctx, title, message); err != nil {
+		u.zapLogger.Warn("Failed to show desktop notification", zap.Error(err))
+	}
+}
+
+// trayIcon draws the tray icon, a filled circle, as PNG or, on Windows, as ICO
+func trayIcon() []byte {
+	const size = 32
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	fill := color.NRGBA{R: 0x24, G: 0x53, B: 0xff, A: 0xff}
+	for y := range size {
+		for x := range size {
+			dx, dy := x-size/2, y-size/2
+			if dx*dx+dy*dy < (size/2-1)*(size/2-1) {
+				img.Set(x, y, fill)
+			}
+		}
+	}
+	var b bytes.Buffer
+	_ = png.Encode(&b, img)
+	if runtime.GOOS != "windows" {
+		return b.Bytes()
+	}
+
+	// An ICO file with a single PNG image: header, directory entry, image
+	var ico bytes.Buffer
+	_ = binary.Write(&ico, binary.LittleEndian, []uint16{0, 1, 1})
+	ico.Write([]byte{size, size, 0, 0})
+	_ = binary.Write(&ico, binary.LittleEndian, []uint16{1, 32})
+	_ = binary.Write(&ico, binary.LittleEndian, []uint32{uint32(b.Len()), 22})
+	ico.Write(b.Bytes())
+	return ico.Bytes()
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/history"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/schedule"
+	"rancher-kubeconfig-updater/internal/status"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTraySummary(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	title, tooltip := traySummary([]status.Entry{
+		{Context: "dev", NeverExpires: true},
+		{Context: "prod", ExpiresAt: now.Add(12 * 24 * time.Hour)},
+		{Context: "edge", ExpiresAt: now.Add(3*24*time.Hour + time.Hour)},
+		{Context: "old", Error: "token not found in Rancher"},
+	}, now)
+	assert.Equal(t, "3d", title)
+	assert.Equal(t, "Earliest Rancher token expiry: edge in 3 days (2026-03-04T13:00:00Z); expiry unknown for 1 contexts", tooltip)
+
+	title, tooltip = traySummary([]status.Entry{{Context: "prod", ExpiresAt: now.Add(-time.Hour)}}, now)
+	assert.Equal(t, "expired", title)
+	assert.Contains(t, tooltip, "The Rancher token of prod expired")
+
+	title, _ = traySummary([]status.Entry{{Context: "dev", NeverExpires: true}}, now)
+	assert.Equal(t, "∞", title)
+	title, _ = traySummary([]status.Entry{{Context: "old", Error: "revoked"}}, now)
+	assert.Equal(t, "?", title)
+	title, _ = traySummary(nil, now)
+	assert.Equal(t, "-", title)
+}
+
+func TestRunFailure(t *testing.T) {
+	_, failed := runFailure(history.Run{Outcome: history.OutcomeSucceeded})
+	assert.False(t, failed)
+
+	message, failed := runFailure(history.Run{Outcome: history.OutcomePartial, Clusters: []history.Cluster{
+		{Cluster: "prod", Result: history.ResultUpdated},
+		{Cluster: "edge", Result: history.ResultFailed},
+	}})
+	assert.True(t, failed)
+	assert.Equal(t, "1 clusters failed: edge", message)
+
+	message, _ = runFailure(history.Run{Outcome: history.OutcomeFailed, Errors: []string{"Failed to create Rancher client"}})
+	assert.Equal(t, "Failed to create Rancher client", message)
+}
+
+// fakeTray records what the tray mode shows and stops it after the first update
+type fakeTray struct {
+	statuses []string
+	notes    []string
+	stop     context.CancelFunc
+}
+
+func (f *fakeTray) SetStatus(title, tooltip string) {
+	f.statuses = append(f.statuses, title)
+	if title != "…" {
+		f.stop()
+	}
+}
+
+func (f *fakeTray) Notify(title, message string) {
+	f.notes = append(f.notes, title+": "+message)
+}
+
+func TestRunTray(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "me", rancher.Cluster{ID: "c-prod", Name: "prod"})
+	dir := t.TempDir()
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	cmd := NewRootCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--server", server.URL, "--user", "admin",
+		"-c", filepath.Join(dir, "config"), "--state-file", filepath.Join(dir, "state.json"), "-a"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ui := &fakeTray{stop: cancel}
+	runTray(ctx, cmd, nil, schedule.Every(time.Hour), ui, nil, zap.NewNop())
+
+	require.Len(t, ui.statuses, 2, "the status is shown while updating and after it")
+	assert.Equal(t, "…", ui.statuses[0])
+	assert.Empty(t, ui.notes, "a successful update is not notified")
+
+	// A failed update is notified
+	server.Close()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	ui = &fakeTray{stop: cancel}
+	runTray(ctx, cmd, nil, schedule.Every(time.Hour), ui, nil, zap.NewNop())
+	require.Len(t, ui.notes, 1)
+	assert.Contains(t, ui.notes[0], "Rancher token refresh failed")
+}
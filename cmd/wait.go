@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"rancher-kubeconfig-updater/internal/config"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// firstWaitRetry is the delay before the first retry of an unreachable server; later delays
+// double up to maxWaitRetry. Variables so tests can shorten them.
+var (
+	firstWaitRetry = 2 * time.Second
+	maxWaitRetry   = time.Minute
+)
+
+// serverDeadline returns until when --wait-for-server retries a server that can't be reached
+// (the zero time if it is not set, so failures are not retried)
+func serverDeadline(cmd *cobra.Command) time.Time {
+	wait := config.GetDuration(cmd, "wait-for-server", "WAIT_FOR_SERVER")
+	if wait <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(wait)
+}
+
+// isConnectionError tells whether err means the server could not be reached at all, e.g.
+// because the network or the VPN is not up yet, as opposed to the server answering with an error
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// waitForServer calls attempt until it succeeds, fails with an error other than a connection
+// error, or deadline passes. Retries back off from firstWaitRetry up to maxWaitRetry. With a
+// zero deadline attempt is called once. Returns the last error of attempt.
+func waitForServer(ctx context.Context, deadline time.Time, url string, zapLogger *zap.Logger, attempt func() error) error {
+	delay := firstWaitRetry
+	for {
+		err := attempt()
+		if err == nil || !isConnectionError(err) {
+			return err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return err
+		}
+		wait := min(delay, remaining)
+		zapLogger.Warn("Rancher server unreachable, retrying",
+			zap.String("server", url), zap.Duration("retryIn", wait), zap.Duration("giveUpIn", remaining.Round(time.Second)), zap.Error(err))
+		if sleepContext(ctx, wait) != nil {
+			return err
+		}
+		delay = min(2*delay, maxWaitRetry)
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	_, refused := http.Get("http://" + closedAddress(t))
+	require.Error(t, refused)
+
+	assert.True(t, isConnectionError(fmt.Errorf("failed to authenticate with Rancher: %w", refused)))
+	assert.True(t, isConnectionError(&net.DNSError{Err: "no such host", Name: "rancher.example.com", IsNotFound: true}))
+	assert.False(t, isConnectionError(errors.New("login failed with status 401: unauthorized")))
+	assert.False(t, isConnectionError(nil))
+}
+
+func TestWaitForServer(t *testing.T) {
+	firstWaitRetry, maxWaitRetry = time.Millisecond, 2*time.Millisecond
+	defer func() { firstWaitRetry, maxWaitRetry = 2*time.Second, time.Minute }()
+	unreachable := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	t.Run("retries until the server answers", func(t *testing.T) {
+		attempts := 0
+		err := waitForServer(context.Background(), time.Now().Add(time.Minute), "https://rancher.example.com", zap.NewNop(), func() error {
+			attempts++
+			if attempts < 3 {
+				return unreachable
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		attempts := 0
+		err := waitForServer(context.Background(), time.Now().Add(time.Minute), "https://rancher.example.com", zap.NewNop(), func() error {
+			attempts++
+			return errors.New("login failed with status 401")
+		})
+		assert.EqualError(t, err, "login failed with status 401")
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("tries once without a deadline", func(t *testing.T) {
+		attempts := 0
+		err := waitForServer(context.Background(), time.Time{}, "https://rancher.example.com", zap.NewNop(), func() error {
+			attempts++
+			return unreachable
+		})
+		assert.ErrorIs(t, err, unreachable)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("gives up at the deadline", func(t *testing.T) {
+		attempts := 0
+		err := waitForServer(context.Background(), time.Now().Add(20*time.Millisecond), "https://rancher.example.com", zap.NewNop(), func() error {
+			attempts++
+			return unreachable
+		})
+		assert.ErrorIs(t, err, unreachable)
+		assert.Greater(t, attempts, 1)
+	})
+
+	t.Run("stops when canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		attempts := 0
+		err := waitForServer(ctx, time.Now().Add(time.Minute), "https://rancher.example.com", zap.NewNop(), func() error {
+			attempts++
+			return unreachable
+		})
+		assert.ErrorIs(t, err, unreachable)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestServerDeadline(t *testing.T) {
+	cmd := NewRootCmd()
+	assert.True(t, serverDeadline(cmd).IsZero())
+
+	require.NoError(t, cmd.Flags().Set("wait-for-server", "10m"))
+	deadline := serverDeadline(cmd)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), deadline, time.Second)
+}
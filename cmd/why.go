@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"rancher-kubeconfig-updater/internal/config"
+	"rancher-kubeconfig-updater/internal/history"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/logger"
+	"rancher-kubeconfig-updater/internal/pipeline"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewWhyCmd creates the command that explains the rotation decision for one cluster.
+func NewWhyCmd() *cobra.Command {
+	whyCmd := &cobra.Command{
+		Use:   "why CLUSTER",
+		Short: "Explain why a cluster's token is kept or replaced",
+		Long: "Explains the decision for one cluster, given by name or ID: what the latest recorded run\n" +
+			"did to it, then the decision a run would make now, evaluated like --dry-run --explain:\n" +
+			"the existing token, its expiry and the threshold math, the policy rule that applies and\n" +
+			"every Rancher API call made to decide. No token is created and the kubeconfig is never\n" +
+			"modified. With --from-history only the recorded runs are read, without logging in.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE:         runWhy,
+	}
+
+	whyCmd.Flags().StringP("config", "c", "", "Path to kubeconfig file (default: ~/.kube/config)")
+	whyCmd.Flags().Int("threshold-days", 30, "Expiration threshold in days")
+	whyCmd.Flags().String("policy-config", "", "YAML file with rules overriding the rotation decision per cluster")
+	whyCmd.Flags().String("max-token-age", "", "Replace tokens created longer ago than this, e.g. 60d")
+	whyCmd.Flags().String("token-scope", "", "Scope of kubeconfig tokens: 'cluster', 'global' or 'auto' (default \"auto\")")
+	whyCmd.Flags().String("state-file", "", "Path to the state file; the history is kept next to it (default: in the user cache directory)")
+	whyCmd.Flags().Bool("from-history", false, "Only show what the recorded runs did to the cluster, without contacting Rancher")
+	addRancherFlags(whyCmd)
+
+	return whyCmd
+}
+
+func runWhy(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the explanation, so logs go to stderr
+	zapLogger := logger.NewLoggerWithWriter(os.Stderr, zapcore.WarnLevel)
+	defer func() {
+		_ = zapLogger.Sync()
+	}()
+	cluster := args[0]
+	out := cmd.OutOrStdout()
+
+	runs, err := loadHistory(cmd)
+	if err != nil {
+		// The history only adds context, the decision can still be evaluated
+		zapLogger.Warn("Failed to read run history", zap.Error(err))
+	}
+	if err := writeLastDecision(out, runs, cluster); err != nil {
+		return err
+	}
+	if fromHistory, _ := cmd.Flags().GetBool("from-history"); fromHistory {
+		return nil
+	}
+
+	opts, err := whyOptions(cmd)
+	if err != nil {
+		return err
+	}
+	kubeconfigPath, _ := cmd.Flags().GetString("config")
+	kubecfg, err := kubeconfig.LoadKubeconfig(kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig file: %w", err)
+	}
+	opts.State, opts.KubeconfigPath = loadState(cmd, kubeconfigPath, zapLogger)
+
+	client, rancherURL, err := newRancherClient(cmd, zapLogger)
+	if err != nil {
+		return err
+	}
+	opts.RancherURL = rancherURL
+	clusters, err := client.ListClusters()
+	if err != nil {
+		return fmt.Errorf("failed to list clusters: %w", err)
+	}
+	v, err := findCluster(clusters, cluster)
+	if err != nil {
+		return err
+	}
+
+	// Only the calls made to decide are explained, not the login and the cluster list
+	opts.Explain = pipeline.NewExplanation(*v)
+	client.ObserveRequests(opts.Explain.APICall)
+	result := pipeline.Process(commandContext(cmd), client, kubecfg, *v, opts, zapLogger)
+	regenerate, err := result.Updated, result.Err
+	if _, werr := fmt.Fprintln(out, "\nNow:"); werr != nil {
+		return werr
+	}
+	if werr := opts.Explain.Write(out); werr != nil {
+		return werr
+	}
+	if err != nil {
+		return err
+	}
+	verdict := "the token would be kept"
+	if regenerate {
+		verdict = "the token would be replaced"
+	}
+	_, err = fmt.Fprintf(out, "Result: %s\n", verdict)
+	return err
+}
+
+// whyOptions returns the settings a run with the flags of why would decide with, in dry-run mode
+func whyOptions(cmd *cobra.Command) (pipeline.Options, error) {
+	rotationPolicy, err := loadPolicy(cmd)
+	if err != nil {
+		return pipeline.Options{}, fmt.Errorf("invalid policy config: %w", err)
+	}
+	maxTokenAge, err := parseMaxTokenAge(cmd)
+	if err != nil {
+		return pipeline.Options{}, fmt.Errorf("invalid maximum token age: %w", err)
+	}
+	tokenScope, err := parseTokenScope(cmd)
+	if err != nil {
+		return pipeline.Options{}, err
+	}
+	return pipeline.Options{
+		ThresholdDays: config.GetInt(cmd, "threshold-days", "TOKEN_THRESHOLD_DAYS"),
+		DryRun:        true,
+		Policy:        rotationPolicy,
+		MaxTokenAge:   maxTokenAge,
+		TokenScope:    tokenScope,
+		Hint:          Hint,
+	}, nil
+}
+
+// writeLastDecision prints what the latest run with a result for cluster did to it
+func writeLastDecision(w io.Writer, runs []history.Run, cluster string) error {
+	for i := len(runs) - 1; i >= 0; i-- {
+		results := clusterResults(runs[i], cluster)
+		if len(results) == 0 {
+			continue
+		}
+		run := runs[i]
+		if _, err := fmt.Fprintf(w, "Last recorded run %s at %s: %s\n", run.ID, runTime(run), runOutcome(run)); err != nil {
+			return err
+		}
+		for _, c := range results {
+			line := "  " + c.Cluster + ": " + c.Result
+			if reason := clusterReason(c); reason != "" {
+				line += " (" + reason + ")"
+			}
+			if token := tokenChange(c); token != "" {
+				line += ", token " + token
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "No recorded run has a result for cluster %s\n", cluster)
+	return err
+}
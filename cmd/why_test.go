@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/history"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhy(t *testing.T) {
+	var logins int32
+	server := newFleetServer(t, &logins, "east", rancher.Cluster{ID: "c-east", Name: "east"})
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	kubeconfigPath := filepath.Join(dir, "config")
+
+	t.Setenv("RANCHER_PASSWORD", "secret")
+	t.Setenv("CHECKPOINT", "")
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--server", server.URL, "--user", "admin", "--auto-create", "-c", kubeconfigPath, "--state-file", statePath})
+	require.NoError(t, cmd.Execute())
+
+	var out bytes.Buffer
+	cmd = NewRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"why", "c-east", "--server", server.URL, "--user", "admin", "-c", kubeconfigPath, "--state-file", statePath})
+	require.NoError(t, cmd.Execute())
+	text := out.String()
+
+	assert.Contains(t, text, "  east: created (new_context)\n")
+	assert.Contains(t, text, "Explain east (c-east):\n  existing token: kubeconfig-u-east\n")
+	// The stub doesn't know the token, so its expiry can't be looked up
+	assert.Contains(t, text, "api: GET /v3/tokens/kubeconfig-u-east -> 404")
+	assert.Contains(t, text, "decision: regenerate (expiration_check_failed)")
+	assert.Contains(t, text, "Result: the token would be replaced\n")
+	assert.NotContains(t, text, "secret")
+}
+
+func TestWhy_FromHistory(t *testing.T) {
+	statePath := writeHistory(t, history.Run{ID: "run-1", StartedAt: time.Now(), Outcome: history.OutcomeSucceeded,
+		Clusters: []history.Cluster{{Cluster: "prod", ClusterID: "c-prod", Result: history.ResultSkipped, Reason: "still_valid"}}})
+
+	var out bytes.Buffer
+	cmd := NewRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"why", "prod", "--from-history", "--state-file", statePath})
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "Last recorded run run-1 at ")
+	assert.Contains(t, out.String(), "  prod: skipped (still_valid)\n")
+	assert.NotContains(t, out.String(), "Now:")
+
+	out.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"why", "dev", "--from-history", "--state-file", statePath})
+	require.NoError(t, cmd.Execute())
+	assert.Equal(t, "No recorded run has a result for cluster dev\n", out.String())
+}
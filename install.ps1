@@ -98,7 +98,7 @@ function Install-RancherKubeconfigUpdater {
     # Architecture detection.
     # Keep the allowlist in sync with the build matrix in
     # .github/workflows/release-please.yml - release artefacts only exist for
-    # windows-amd64 (in addition to linux-amd64 and darwin-arm64 covered by install.sh).
+    # windows-amd64 (in addition to linux-amd64, linux-arm64 and darwin-arm64 covered by install.sh).
     $rawArch = if ($env:_ARCH_OVERRIDE) {
         $env:_ARCH_OVERRIDE
     } elseif ($env:PROCESSOR_ARCHITEW6432) {
@@ -8,7 +8,7 @@
 #   VERSION       Release tag (default: latest)
 #   INSTALL_DIR   Target directory (default: $HOME/.local/bin)
 #
-# Supported platforms: linux-amd64, darwin-arm64.
+# Supported platforms: linux-amd64, linux-arm64, darwin-arm64.
 # Other platforms must build from source — see the README.
 #
 # Internal test hooks (intentionally undocumented for end users):
@@ -72,7 +72,7 @@ platform="${os}-${arch}"
 # .github/workflows/release-please.yml — release artefacts only exist for
 # these platforms.
 case "${platform}" in
-    linux-amd64|darwin-arm64) ;;
+    linux-amd64|linux-arm64|darwin-arm64) ;;
     *)
         err "platform ${platform} is not in the prebuilt release matrix. See ${BUILD_FROM_SOURCE_URL} to build from source."
         exit 1
@@ -0,0 +1,67 @@
+// Package appdir locates the directory the tool keeps its own files in: the state file, the
+// run history, stored secrets and the credential cache socket. On machines several users
+// share, every OS user gets a directory of their own.
+package appdir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrNoDir is returned when no directory can be derived for the tool's files, typically in
+// containers without a home directory or cache directory for the user.
+var ErrNoDir = errors.New("no directory for the tool's files")
+
+var override atomic.Value
+
+var shared atomic.Bool
+
+// Set makes Dir return dir instead of the default. An empty dir restores the default.
+func Set(dir string) {
+	override.Store(dir)
+}
+
+// SetShared makes Dir return a directory of the current OS user below the usual one, so users
+// of a shared --state-dir never see each other's files.
+func SetShared(on bool) {
+	shared.Store(on)
+}
+
+// Shared reports whether SetShared is in effect.
+func Shared() bool {
+	return shared.Load()
+}
+
+// Dir returns the directory given to Set, or rancher-kubeconfig-updater in the user cache dir.
+// With SetShared it is the user-<name> directory below that.
+func Dir() (string, error) {
+	dir, ok := override.Load().(string)
+	if !ok || dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("%w: failed to get user cache dir: %v", ErrNoDir, err)
+		}
+		dir = filepath.Join(cacheDir, "rancher-kubeconfig-updater")
+	}
+	if shared.Load() {
+		dir = filepath.Join(dir, "user-"+userName())
+	}
+	return dir, nil
+}
+
+// userName returns the name of the current OS user for use in a path, or the user ID where
+// the user database has no entry for it, as in many containers
+func userName() string {
+	u, err := user.Current()
+	if err != nil || u.Username == "" {
+		return strconv.Itoa(os.Getuid())
+	}
+	// Windows names include the domain, e.g. CORP\alice
+	return strings.NewReplacer(`\`, "_", "/", "_").Replace(u.Username)
+}
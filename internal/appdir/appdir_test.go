@@ -0,0 +1,59 @@
+package appdir
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDir(t *testing.T) {
+	t.Cleanup(func() { Set("") })
+
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	t.Setenv("HOME", cacheDir)
+	t.Setenv("LocalAppData", cacheDir)
+	dir, err := Dir()
+	require.NoError(t, err)
+	assert.Equal(t, "rancher-kubeconfig-updater", filepath.Base(dir))
+
+	Set("/var/lib/updater")
+	dir, err = Dir()
+	require.NoError(t, err)
+	assert.Equal(t, "/var/lib/updater", dir)
+}
+
+func TestDir_NoHome(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the user cache dir is derived from HOME and XDG_CACHE_HOME on Linux")
+	}
+	t.Cleanup(func() { Set("") })
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("HOME", "")
+
+	_, err := Dir()
+	assert.ErrorIs(t, err, ErrNoDir)
+
+	Set("/state")
+	dir, err := Dir()
+	require.NoError(t, err)
+	assert.Equal(t, "/state", dir)
+}
+
+func TestDir_Shared(t *testing.T) {
+	t.Cleanup(func() {
+		Set("")
+		SetShared(false)
+	})
+
+	Set("/srv/rancher-kubeconfig-updater")
+	SetShared(true)
+	dir, err := Dir()
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/rancher-kubeconfig-updater", filepath.Dir(dir))
+	assert.Equal(t, "user-"+userName(), filepath.Base(dir))
+	assert.NotContains(t, userName(), `\`)
+}
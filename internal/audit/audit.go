@@ -0,0 +1,244 @@
+// Package audit compares a local kubeconfig with the clusters and tokens known to Rancher.
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Severity ranks how serious a finding is.
+type Severity string
+
+const (
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+// Rank orders severities from least (1) to most (3) serious; unknown severities rank 0.
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityLow:
+		return 1
+	case SeverityMedium:
+		return 2
+	case SeverityHigh:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// ParseSeverity converts a string into a Severity.
+func ParseSeverity(value string) (Severity, error) {
+	s := Severity(strings.ToLower(value))
+	if s.Rank() == 0 {
+		return "", fmt.Errorf("invalid severity %q. Must be 'low', 'medium' or 'high'", value)
+	}
+	return s, nil
+}
+
+// Finding codes
+const (
+	CodeDeletedCluster = "deleted_cluster"
+	CodeServerMismatch = "server_mismatch"
+	CodeUnknownToken   = "unknown_token"
+	CodeForeignToken   = "foreign_token"
+	CodeExpiredToken   = "expired_token"
+	CodeMalformedToken = "malformed_token"
+	CodeGlobalToken    = "global_token"
+)
+
+// Finding is a single difference between the kubeconfig and Rancher.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Context  string   `json:"context"`
+	Message  string   `json:"message"`
+	// Scope is the scope of the context's token, if Rancher knows the token
+	Scope rancher.TokenScope `json:"scope,omitempty"`
+}
+
+// Rancher is the subset of the Rancher client used by the audit.
+type Rancher interface {
+	ListClusters() (rancher.Clusters, error)
+	GetTokenInfo(token string) (*rancher.TokenInfo, error)
+	CurrentUserID() (string, error)
+}
+
+// Run audits every context in kubecfg that belongs to the Rancher server at rancherURL.
+// It never modifies kubecfg. Findings are sorted by severity (most serious first) and context name.
+func Run(kubecfg *api.Config, rancherURL string, r Rancher, now time.Time) ([]Finding, error) {
+	clusters, err := r.ListClusters()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve cluster list from Rancher: %w", err)
+	}
+	userID, err := r.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	clustersByID := make(map[string]rancher.Cluster, len(clusters))
+	clustersByName := make(map[string]rancher.Cluster, len(clusters))
+	for _, c := range clusters {
+		clustersByID[c.ID] = c
+		clustersByName[c.Name] = c
+	}
+
+	a := &auditor{
+		rancher:    r,
+		userID:     userID,
+		now:        now,
+		tokenInfos: make(map[string]tokenResult),
+	}
+	proxyPrefix := strings.TrimSuffix(rancherURL, "/") + "/k8s/clusters/"
+
+	contextNames := make([]string, 0, len(kubecfg.Contexts))
+	for name := range kubecfg.Contexts {
+		contextNames = append(contextNames, name)
+	}
+	sort.Strings(contextNames)
+
+	var findings []Finding
+	for _, name := range contextNames {
+		ctx := kubecfg.Contexts[name]
+		if ctx == nil {
+			continue
+		}
+		var server string
+		if cluster, ok := kubecfg.Clusters[ctx.Cluster]; ok && cluster != nil {
+			server = cluster.Server
+		}
+
+		rancherCluster, byName := clustersByName[name]
+		if clusterID, ok := strings.CutPrefix(server, proxyPrefix); ok {
+			clusterID, _, _ = strings.Cut(clusterID, "/")
+			if _, exists := clustersByID[clusterID]; !exists {
+				findings = append(findings, Finding{
+					Severity: SeverityMedium,
+					Code:     CodeDeletedCluster,
+					Context:  name,
+					Message:  fmt.Sprintf("cluster %s no longer exists in Rancher", clusterID),
+				})
+			}
+		} else if byName && !sameHost(server, rancherURL) {
+			findings = append(findings, Finding{
+				Severity: SeverityMedium,
+				Code:     CodeServerMismatch,
+				Context:  name,
+				Message:  fmt.Sprintf("server %s does not match Rancher cluster %s (expected %s%s)", server, rancherCluster.ID, proxyPrefix, rancherCluster.ID),
+			})
+		} else if !byName {
+			// Not a Rancher entry
+			continue
+		}
+
+		if authInfo, ok := kubecfg.AuthInfos[ctx.AuthInfo]; ok && authInfo != nil && authInfo.Token != "" {
+			if f, ok := a.checkToken(name, authInfo.Token); ok {
+				findings = append(findings, f)
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity.Rank() > findings[j].Severity.Rank()
+	})
+	return findings, nil
+}
+
+// tokenResult caches a token lookup, so tokens shared by several contexts are queried once
+type tokenResult struct {
+	info *rancher.TokenInfo
+	err  error
+}
+
+type auditor struct {
+	rancher    Rancher
+	userID     string
+	now        time.Time
+	tokenInfos map[string]tokenResult
+}
+
+// checkToken returns a finding for the token used by a context, if there is one
+func (a *auditor) checkToken(contextName, token string) (Finding, bool) {
+	tokenName, err := rancher.TokenName(token)
+	if err != nil {
+		return Finding{
+			Severity: SeverityLow,
+			Code:     CodeMalformedToken,
+			Context:  contextName,
+			Message:  "token is not in Rancher's <token-name>:<secret> format",
+		}, true
+	}
+
+	result, cached := a.tokenInfos[tokenName]
+	if !cached {
+		result.info, result.err = a.rancher.GetTokenInfo(token)
+		a.tokenInfos[tokenName] = result
+	}
+
+	switch {
+	case errors.Is(result.err, rancher.ErrTokenNotFound):
+		return Finding{
+			Severity: SeverityHigh,
+			Code:     CodeUnknownToken,
+			Context:  contextName,
+			Message:  fmt.Sprintf("token %s is not known to Rancher (revoked or issued by another server)", tokenName),
+		}, true
+	case result.err != nil:
+		// Lookup failures are not drift; the audit reports only what it could verify
+		return Finding{}, false
+	case result.info.UserID != "" && result.info.UserID != a.userID:
+		return Finding{
+			Severity: SeverityHigh,
+			Code:     CodeForeignToken,
+			Context:  contextName,
+			Message:  fmt.Sprintf("token %s belongs to user %s, not the audited user %s", tokenName, result.info.UserID, a.userID),
+			Scope:    result.info.Scope(),
+		}, true
+	case result.info.Expired || isPast(result.info.ExpiresAt, a.now):
+		return Finding{
+			Severity: SeverityMedium,
+			Code:     CodeExpiredToken,
+			Context:  contextName,
+			Message:  fmt.Sprintf("token %s has expired", tokenName),
+			Scope:    result.info.Scope(),
+		}, true
+	case result.info.Scope() == rancher.TokenScopeGlobal:
+		// A leaked global token opens every cluster of the user, not just this one
+		return Finding{
+			Severity: SeverityLow,
+			Code:     CodeGlobalToken,
+			Context:  contextName,
+			Message:  fmt.Sprintf("token %s is not scoped to a cluster and works on every cluster of the user", tokenName),
+			Scope:    rancher.TokenScopeGlobal,
+		}, true
+	}
+	return Finding{}, false
+}
+
+// isPast reports whether an RFC3339 timestamp lies before now; empty or invalid timestamps are not past
+func isPast(timestamp string, now time.Time) bool {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	return err == nil && t.Before(now)
+}
+
+// sameHost reports whether server points at the same host as rancherURL
+func sameHost(server, rancherURL string) bool {
+	s, err := url.Parse(server)
+	if err != nil {
+		return false
+	}
+	r, err := url.Parse(rancherURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(s.Host, r.Host)
+}
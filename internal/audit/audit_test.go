@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const testRancherURL = "https://rancher.example.com"
+
+// fakeRancher serves fixed clusters and tokens keyed by token name
+type fakeRancher struct {
+	clusters    rancher.Clusters
+	tokens      map[string]*rancher.TokenInfo
+	tokenLookup int
+}
+
+func (f *fakeRancher) ListClusters() (rancher.Clusters, error) {
+	return f.clusters, nil
+}
+
+func (f *fakeRancher) GetTokenInfo(token string) (*rancher.TokenInfo, error) {
+	f.tokenLookup++
+	name, err := rancher.TokenName(token)
+	if err != nil {
+		return nil, err
+	}
+	info, ok := f.tokens[name]
+	if !ok {
+		return nil, fmt.Errorf("lookup: %w", rancher.ErrTokenNotFound)
+	}
+	return info, nil
+}
+
+func (f *fakeRancher) CurrentUserID() (string, error) {
+	return "u-me", nil
+}
+
+// addEntry adds a cluster, context and user with the same name
+func addEntry(cfg *api.Config, name, server, token string) {
+	cfg.Clusters[name] = &api.Cluster{Server: server}
+	cfg.Contexts[name] = &api.Context{Cluster: name, AuthInfo: name}
+	cfg.AuthInfos[name] = &api.AuthInfo{Token: token}
+}
+
+func TestRun_Findings(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := &fakeRancher{
+		clusters: rancher.Clusters{
+			{ID: "c-prod", Name: "prod"},
+			{ID: "c-stage", Name: "stage"},
+			{ID: "c-dev", Name: "dev"},
+			{ID: "c-qa", Name: "qa"},
+			{ID: "c-ok", Name: "ok"},
+		},
+		tokens: map[string]*rancher.TokenInfo{
+			"kubeconfig-u-me1":    {UserID: "u-me", ClusterID: "c-ok", ExpiresAt: "2027-01-01T00:00:00Z", TTL: 1},
+			"kubeconfig-u-other":  {UserID: "u-other"},
+			"kubeconfig-u-expire": {UserID: "u-me", ClusterID: "c-qa", ExpiresAt: "2025-06-01T00:00:00Z", TTL: 1},
+		},
+	}
+
+	cfg := api.NewConfig()
+	addEntry(cfg, "ok", testRancherURL+"/k8s/clusters/c-ok", "kubeconfig-u-me1:secret")
+	addEntry(cfg, "gone", testRancherURL+"/k8s/clusters/c-deleted", "kubeconfig-u-me1:secret")
+	addEntry(cfg, "prod", "https://old-rancher.example.com/k8s/clusters/c-prod", "kubeconfig-u-me1:secret")
+	addEntry(cfg, "stage", testRancherURL+"/k8s/clusters/c-stage", "kubeconfig-u-revoked:secret")
+	addEntry(cfg, "dev", testRancherURL+"/k8s/clusters/c-dev", "kubeconfig-u-other:secret")
+	addEntry(cfg, "qa", testRancherURL+"/k8s/clusters/c-qa", "kubeconfig-u-expire:secret")
+	addEntry(cfg, "unrelated", "https://k8s.example.org", "something-else")
+
+	findings, err := Run(cfg, testRancherURL, fake, now)
+	require.NoError(t, err)
+
+	codes := make(map[string]Finding)
+	for _, f := range findings {
+		codes[f.Context+"/"+f.Code] = f
+	}
+	assert.Len(t, findings, 5)
+	assert.Contains(t, codes, "gone/"+CodeDeletedCluster)
+	assert.Contains(t, codes, "prod/"+CodeServerMismatch)
+	assert.Contains(t, codes, "stage/"+CodeUnknownToken)
+	assert.Contains(t, codes, "dev/"+CodeForeignToken)
+	assert.Contains(t, codes, "qa/"+CodeExpiredToken)
+
+	assert.Equal(t, rancher.TokenScopeGlobal, codes["dev/"+CodeForeignToken].Scope)
+	assert.Equal(t, rancher.TokenScopeCluster, codes["qa/"+CodeExpiredToken].Scope)
+
+	// Most serious first
+	assert.Equal(t, SeverityHigh, findings[0].Severity)
+	assert.Equal(t, SeverityMedium, findings[len(findings)-1].Severity)
+
+	// The token shared by three contexts is looked up once
+	assert.Equal(t, 4, fake.tokenLookup)
+}
+
+func TestRun_DoesNotModifyKubeconfig(t *testing.T) {
+	fake := &fakeRancher{}
+	cfg := api.NewConfig()
+	addEntry(cfg, "gone", testRancherURL+"/k8s/clusters/c-deleted", "kubeconfig-u-revoked:secret")
+	before := cfg.DeepCopy()
+
+	_, err := Run(cfg, testRancherURL, fake, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, before, cfg)
+}
+
+func TestRun_GlobalToken(t *testing.T) {
+	fake := &fakeRancher{
+		clusters: rancher.Clusters{{ID: "c-prod", Name: "prod"}},
+		tokens:   map[string]*rancher.TokenInfo{"kubeconfig-u-global": {UserID: "u-me"}},
+	}
+	cfg := api.NewConfig()
+	addEntry(cfg, "prod", testRancherURL+"/k8s/clusters/c-prod", "kubeconfig-u-global:secret")
+
+	findings, err := Run(cfg, testRancherURL, fake, time.Now())
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	assert.Equal(t, CodeGlobalToken, findings[0].Code)
+	assert.Equal(t, SeverityLow, findings[0].Severity)
+	assert.Equal(t, rancher.TokenScopeGlobal, findings[0].Scope)
+}
+
+func TestRun_MalformedToken(t *testing.T) {
+	fake := &fakeRancher{clusters: rancher.Clusters{{ID: "c-prod", Name: "prod"}}}
+	cfg := api.NewConfig()
+	addEntry(cfg, "prod", testRancherURL+"/k8s/clusters/c-prod", "not-a-rancher-token")
+
+	findings, err := Run(cfg, testRancherURL, fake, time.Now())
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	assert.Equal(t, CodeMalformedToken, findings[0].Code)
+	assert.Equal(t, SeverityLow, findings[0].Severity)
+}
+
+func TestParseSeverity(t *testing.T) {
+	s, err := ParseSeverity("HIGH")
+	assert.NoError(t, err)
+	assert.Equal(t, SeverityHigh, s)
+
+	_, err = ParseSeverity("critical")
+	assert.Error(t, err)
+}
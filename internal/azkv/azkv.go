@@ -0,0 +1,174 @@
+// Package azkv reads and writes secrets in Azure Key Vault through its REST API,
+// authenticating with workload identity or client credentials.
+package azkv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Scheme is the URI scheme of secret references.
+const Scheme = "azkv://"
+
+// apiVersion is the Key Vault REST API version used for all requests
+const apiVersion = "7.4"
+
+// requestTimeout limits each request to Key Vault and Microsoft Entra ID
+const requestTimeout = 30 * time.Second
+
+// ErrNotFound is returned when the secret or version does not exist.
+var ErrNotFound = errors.New("secret not found")
+
+// Ref identifies a secret version.
+type Ref struct {
+	// VaultURL is the vault's base URL, e.g. https://myvault.vault.azure.net
+	VaultURL string
+	Name     string
+	// Version is a version ID, empty for the current version
+	Version string
+}
+
+// ParseRef parses azkv://VAULT/SECRET[/VERSION]. VAULT is a vault name in the Azure public
+// cloud or the full host name of a vault in another cloud (e.g. myvault.vault.azure.cn).
+func ParseRef(reference string) (Ref, error) {
+	invalid := fmt.Errorf("invalid Key Vault reference %q: expected %sVAULT/SECRET[/VERSION]", reference, Scheme)
+
+	rest, ok := strings.CutPrefix(reference, Scheme)
+	if !ok {
+		return Ref{}, invalid
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return Ref{}, invalid
+	}
+	for _, part := range parts {
+		if part == "" {
+			return Ref{}, invalid
+		}
+	}
+
+	host := parts[0]
+	if !strings.Contains(host, ".") {
+		host += ".vault.azure.net"
+	}
+	ref := Ref{VaultURL: "https://" + host, Name: parts[1]}
+	if len(parts) == 3 {
+		ref.Version = parts[2]
+	}
+	return ref, nil
+}
+
+// String returns the reference in azkv:// form.
+func (r Ref) String() string {
+	host := strings.TrimPrefix(r.VaultURL, "https://")
+	s := Scheme + strings.TrimSuffix(host, ".vault.azure.net") + "/" + r.Name
+	if r.Version != "" {
+		s += "/" + r.Version
+	}
+	return s
+}
+
+// scope returns the OAuth scope of the vault's cloud, e.g. https://vault.azure.net/.default
+func (r Ref) scope() string {
+	host := r.VaultURL
+	if u, err := url.Parse(r.VaultURL); err == nil {
+		host = u.Hostname()
+	}
+	if _, suffix, ok := strings.Cut(host, "."); ok && strings.HasPrefix(suffix, "vault.") {
+		return "https://" + suffix + "/.default"
+	}
+	return "https://vault.azure.net/.default"
+}
+
+// Client talks to the Key Vault API.
+type Client struct {
+	httpClient *http.Client
+	token      func(ctx context.Context, scope string) (string, error)
+}
+
+// NewClient creates a client that authenticates with the Azure credentials in the
+// environment (see accessToken).
+func NewClient() *Client {
+	return &Client{httpClient: &http.Client{Timeout: requestTimeout}, token: accessToken}
+}
+
+// secretBundle is the part of a Key Vault secret the client uses
+type secretBundle struct {
+	Value       string `json:"value"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// Get returns the value of the referenced secret version.
+func (c *Client) Get(ctx context.Context, ref Ref) ([]byte, error) {
+	path := "/secrets/" + url.PathEscape(ref.Name)
+	if ref.Version != "" {
+		path += "/" + url.PathEscape(ref.Version)
+	}
+
+	var bundle secretBundle
+	if err := c.do(ctx, ref, http.MethodGet, path, nil, &bundle); err != nil {
+		return nil, err
+	}
+	return []byte(bundle.Value), nil
+}
+
+// Set stores value as the new current version of the referenced secret, creating the
+// secret if it doesn't exist.
+func (c *Client) Set(ctx context.Context, ref Ref, value []byte, contentType string) error {
+	body, err := json.Marshal(secretBundle{Value: string(value), ContentType: contentType})
+	if err != nil {
+		return err
+	}
+	defer clear(body)
+	return c.do(ctx, ref, http.MethodPut, "/secrets/"+url.PathEscape(ref.Name), body, nil)
+}
+
+// do sends an authenticated request and decodes the JSON response into out (if not nil)
+func (c *Client) do(ctx context.Context, ref Ref, method, path string, body []byte, out any) error {
+	token, err := c.token(ctx, ref.scope())
+	if err != nil {
+		return fmt.Errorf("failed to get Azure access token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, ref.VaultURL+path+"?api-version="+apiVersion, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("key vault request failed: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read key vault response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("key vault returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	case out == nil:
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode key vault response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package azkv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRef(t *testing.T) {
+	ref, err := ParseRef("azkv://myvault/rancher-password")
+	require.NoError(t, err)
+	assert.Equal(t, Ref{VaultURL: "https://myvault.vault.azure.net", Name: "rancher-password"}, ref)
+	assert.Equal(t, "azkv://myvault/rancher-password", ref.String())
+	assert.Equal(t, "https://vault.azure.net/.default", ref.scope())
+
+	ref, err = ParseRef("azkv://myvault.vault.azure.cn/rancher-password/0123abcd")
+	require.NoError(t, err)
+	assert.Equal(t, "https://myvault.vault.azure.cn", ref.VaultURL)
+	assert.Equal(t, "0123abcd", ref.Version)
+	assert.Equal(t, "azkv://myvault.vault.azure.cn/rancher-password/0123abcd", ref.String())
+	assert.Equal(t, "https://vault.azure.cn/.default", ref.scope())
+
+	for _, bad := range []string{"myvault/secret", "azkv://myvault", "azkv://myvault//v1", "azkv://a/b/c/d"} {
+		_, err := ParseRef(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// newKeyVaultStub returns a client and the URL of an in-memory Key Vault holding the given secrets
+func newKeyVaultStub(t *testing.T, secrets map[string]string) (*Client, string) {
+	t.Helper()
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" || r.URL.Query().Get("api-version") != apiVersion {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		name := strings.TrimPrefix(r.URL.Path, "/secrets/")
+		switch r.Method {
+		case http.MethodPut:
+			var bundle secretBundle
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&bundle))
+			secrets[name] = bundle.Value
+			_ = json.NewEncoder(w).Encode(bundle)
+		case http.MethodGet:
+			value, ok := secrets[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error": {"code": "SecretNotFound"}}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(secretBundle{Value: value})
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := &Client{
+		httpClient: server.Client(),
+		token: func(context.Context, string) (string, error) {
+			return "test-token", nil
+		},
+	}
+	return client, server.URL
+}
+
+func TestClient_SetAndGet(t *testing.T) {
+	client, vaultURL := newKeyVaultStub(t, map[string]string{})
+	ref := Ref{VaultURL: vaultURL, Name: "kubeconfig"}
+
+	_, err := client.Get(context.Background(), ref)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	require.NoError(t, client.Set(context.Background(), ref, []byte("apiVersion: v1"), "application/yaml"))
+	value, err := client.Get(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, "apiVersion: v1", string(value))
+
+	ref.Version = "0123abcd"
+	client, vaultURL = newKeyVaultStub(t, map[string]string{"kubeconfig/0123abcd": "pinned"})
+	ref.VaultURL = vaultURL
+	value, err = client.Get(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, "pinned", string(value))
+}
+
+func TestNewClient_Timeout(t *testing.T) {
+	assert.Equal(t, requestTimeout, NewClient().httpClient.Timeout)
+}
+
+// newTokenStub returns an Entra ID token endpoint stub that checks the request with check
+func newTokenStub(t *testing.T, check func(r *http.Request) bool) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.URL.Path != "/tenant-1/oauth2/v2.0/token" || r.PostForm.Get("client_id") != "client-1" ||
+			r.PostForm.Get("scope") != "https://vault.azure.net/.default" || !check(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error_description": "rejected"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token": "entra-token"}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("AZURE_AUTHORITY_HOST", server.URL)
+	t.Setenv("AZURE_TENANT_ID", "tenant-1")
+	t.Setenv("AZURE_CLIENT_ID", "client-1")
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+}
+
+func TestAccessToken_ClientSecret(t *testing.T) {
+	newTokenStub(t, func(r *http.Request) bool {
+		return r.PostForm.Get("client_secret") == "s3cret"
+	})
+	t.Setenv("AZURE_CLIENT_SECRET", "s3cret")
+
+	token, err := accessToken(context.Background(), "https://vault.azure.net/.default")
+	require.NoError(t, err)
+	assert.Equal(t, "entra-token", token)
+
+	t.Setenv("AZURE_CLIENT_SECRET", "wrong")
+	_, err = accessToken(context.Background(), "https://vault.azure.net/.default")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected")
+}
+
+func TestAccessToken_WorkloadIdentity(t *testing.T) {
+	newTokenStub(t, func(r *http.Request) bool {
+		return r.PostForm.Get("client_assertion") == "federated-jwt" &&
+			r.PostForm.Get("client_assertion_type") == "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	})
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("federated-jwt\n"), 0o600))
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFile)
+
+	token, err := accessToken(context.Background(), "https://vault.azure.net/.default")
+	require.NoError(t, err)
+	assert.Equal(t, "entra-token", token)
+}
+
+func TestAccessToken_NoCredentials(t *testing.T) {
+	newTokenStub(t, func(*http.Request) bool { return true })
+
+	_, err := accessToken(context.Background(), "https://vault.azure.net/.default")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "AZURE_FEDERATED_TOKEN_FILE")
+}
@@ -0,0 +1,80 @@
+package azkv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// accessToken gets an OAuth access token for scope from Microsoft Entra ID with the
+// credentials in the standard Azure environment variables:
+//   - workload identity (AKS, GitHub Actions): AZURE_FEDERATED_TOKEN_FILE
+//   - client credentials of a service principal: AZURE_CLIENT_SECRET
+//
+// Both need AZURE_TENANT_ID and AZURE_CLIENT_ID. AZURE_AUTHORITY_HOST selects another cloud.
+func accessToken(ctx context.Context, scope string) (string, error) {
+	tenantID, clientID := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID")
+	if tenantID == "" || clientID == "" {
+		return "", errors.New("AZURE_TENANT_ID and AZURE_CLIENT_ID must be set")
+	}
+
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+		"client_id":  {clientID},
+		"scope":      {scope},
+	}
+	switch {
+	case os.Getenv("AZURE_FEDERATED_TOKEN_FILE") != "":
+		assertion, err := os.ReadFile(os.Getenv("AZURE_FEDERATED_TOKEN_FILE"))
+		if err != nil {
+			return "", fmt.Errorf("failed to read federated token: %w", err)
+		}
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", strings.TrimSpace(string(assertion)))
+	case os.Getenv("AZURE_CLIENT_SECRET") != "":
+		form.Set("client_secret", os.Getenv("AZURE_CLIENT_SECRET"))
+	default:
+		return "", errors.New("set AZURE_FEDERATED_TOKEN_FILE for workload identity or AZURE_CLIENT_SECRET for client credentials")
+	}
+
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = "https://login.microsoftonline.com/"
+	}
+	tokenURL := strings.TrimSuffix(authority, "/") + "/" + url.PathEscape(tenantID) + "/oauth2/v2.0/token"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: requestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request returned status %d: %s", resp.StatusCode, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("empty token")
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,111 @@
+// Package checkpoint records which clusters a run has already refreshed, so a run
+// over a large fleet that is interrupted can resume where it stopped.
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"strings"
+	"time"
+)
+
+// MaxAge is how long a checkpoint stays valid. An older checkpoint belongs to an earlier
+// refresh cycle, so its clusters are processed again instead of being skipped.
+const MaxAge = 24 * time.Hour
+
+// Checkpoint lists the clusters refreshed in the current cycle of one kubeconfig and Rancher server.
+type Checkpoint struct {
+	path string
+
+	Kubeconfig string    `json:"kubeconfig"`
+	RancherURL string    `json:"rancherUrl"`
+	Started    time.Time `json:"started"`
+	// Done maps the IDs of finished clusters to when they were finished
+	Done map[string]time.Time `json:"done"`
+}
+
+// Load reads the checkpoint at path. It returns a fresh checkpoint, and resumed false, when
+// the file is missing, older than MaxAge or was written for another kubeconfig or Rancher server.
+func Load(path, kubeconfigPath, rancherURL string, now time.Time) (cp *Checkpoint, resumed bool, err error) {
+	rancherURL = strings.TrimSuffix(rancherURL, "/")
+	fresh := &Checkpoint{
+		path:       path,
+		Kubeconfig: kubeconfigPath,
+		RancherURL: rancherURL,
+		Started:    now.UTC(),
+		Done:       make(map[string]time.Time),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fresh, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+
+	var saved Checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, false, fmt.Errorf("failed to parse checkpoint file %s: %w", path, err)
+	}
+	if saved.Kubeconfig != kubeconfigPath || saved.RancherURL != rancherURL || now.Sub(saved.Started) > MaxAge {
+		return fresh, false, nil
+	}
+	saved.path = path
+	if saved.Done == nil {
+		saved.Done = make(map[string]time.Time)
+	}
+	return &saved, true, nil
+}
+
+// IsDone reports whether the cluster was already finished in this cycle.
+// A nil *Checkpoint has finished nothing.
+func (c *Checkpoint) IsDone(clusterID string) bool {
+	if c == nil {
+		return false
+	}
+	_, ok := c.Done[clusterID]
+	return ok
+}
+
+// MarkDone records that the cluster was finished. It only reaches the file with the next Stage.
+func (c *Checkpoint) MarkDone(clusterID string, now time.Time) {
+	c.Done[clusterID] = now.UTC()
+}
+
+// Stager collects file writes that are committed together.
+type Stager interface {
+	Stage(path string, data []byte, perm os.FileMode)
+}
+
+// Stage adds the checkpoint file to a set of writes committed together, so a cluster is
+// only recorded as done once the kubeconfig holding its new token is on disk.
+func (c *Checkpoint) Stage(tx Stager) error {
+	if err := readonly.Check(c.path); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	tx.Stage(c.path, data, 0600)
+	return nil
+}
+
+// Remove deletes the checkpoint file once the cycle is complete.
+func (c *Checkpoint) Remove() error {
+	if err := readonly.Check(c.path); err != nil {
+		return err
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writer stages files by writing them right away
+type writer struct{ t *testing.T }
+
+func (w writer) Stage(path string, data []byte, perm os.FileMode) {
+	require.NoError(w.t, os.WriteFile(path, data, perm))
+}
+
+var start = time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+
+// saved writes a checkpoint with the given clusters done and returns its path
+func saved(t *testing.T, clusterIDs ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "nested", "checkpoint.json")
+	cp, resumed, err := Load(path, "/home/me/.kube/config", "https://rancher.example.com/", start)
+	require.NoError(t, err)
+	require.False(t, resumed)
+	for _, id := range clusterIDs {
+		cp.MarkDone(id, start.Add(time.Minute))
+	}
+	require.NoError(t, cp.Stage(writer{t}))
+	return path
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	cp, resumed, err := Load(filepath.Join(t.TempDir(), "checkpoint.json"), "/k", "https://r", start)
+	require.NoError(t, err)
+	assert.False(t, resumed)
+	assert.False(t, cp.IsDone("c-1"))
+	assert.Equal(t, start, cp.Started)
+}
+
+func TestLoad_Resume(t *testing.T) {
+	path := saved(t, "c-1", "c-2")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	if filepath.Separator == '/' {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	cp, resumed, err := Load(path, "/home/me/.kube/config", "https://rancher.example.com", start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, resumed)
+	assert.True(t, cp.IsDone("c-1"))
+	assert.True(t, cp.IsDone("c-2"))
+	assert.False(t, cp.IsDone("c-3"))
+	assert.Equal(t, start, cp.Started, "a resumed cycle keeps its start time")
+}
+
+func TestLoad_NewCycle(t *testing.T) {
+	path := saved(t, "c-1")
+
+	tests := map[string]struct {
+		kubeconfig, rancherURL string
+		now                    time.Time
+	}{
+		"other kubeconfig": {"/tmp/other", "https://rancher.example.com", start},
+		"other Rancher":    {"/home/me/.kube/config", "https://rancher2.example.com", start},
+		"expired":          {"/home/me/.kube/config", "https://rancher.example.com", start.Add(MaxAge + time.Minute)},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cp, resumed, err := Load(path, tt.kubeconfig, tt.rancherURL, tt.now)
+			require.NoError(t, err)
+			assert.False(t, resumed)
+			assert.False(t, cp.IsDone("c-1"))
+		})
+	}
+}
+
+func TestLoad_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+
+	_, _, err := Load(path, "/k", "https://r", start)
+	assert.ErrorContains(t, err, "failed to parse checkpoint file")
+}
+
+func TestRemove(t *testing.T) {
+	path := saved(t, "c-1")
+	cp, _, err := Load(path, "/home/me/.kube/config", "https://rancher.example.com", start)
+	require.NoError(t, err)
+
+	require.NoError(t, cp.Remove())
+	assert.NoFileExists(t, path)
+	assert.NoError(t, cp.Remove(), "removing twice is fine")
+}
+
+func TestNilCheckpoint(t *testing.T) {
+	var cp *Checkpoint
+	assert.False(t, cp.IsDone("c-1"))
+}
@@ -0,0 +1,136 @@
+// Package clusterfile is a cluster source for machines that can't list clusters in Rancher.
+//
+// A static manifest names every cluster with its Rancher ID and the kubeconfig file exported
+// for it, e.g. carried into an air-gapped network. The updater then merges these kubeconfigs
+// like the ones it generates, so entries are still created, renamed and rotated as usual.
+package clusterfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Cluster is one cluster of the manifest.
+type Cluster struct {
+	// ID is the Rancher ID of the cluster, e.g. c-m-12345
+	ID string `yaml:"id"`
+	// Name is the cluster's name, which its entries are named after (default: the ID)
+	Name   string            `yaml:"name,omitempty"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Kubeconfig is the kubeconfig file of the cluster, relative to the manifest
+	Kubeconfig string `yaml:"kubeconfig"`
+}
+
+// Manifest is the ordered list of clusters. It is a rancher.ClusterSource.
+type Manifest struct {
+	Clusters []Cluster `yaml:"clusters"`
+	// dir is the directory kubeconfig paths are relative to
+	dir string
+}
+
+var _ rancher.ClusterSource = (*Manifest)(nil)
+
+// Load reads and validates the manifest at path.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster manifest: %w", err)
+	}
+	m, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster manifest %s: %w", path, err)
+	}
+	m.dir = filepath.Dir(path)
+	return m, nil
+}
+
+// Parse decodes and validates a manifest of the form
+//
+//	clusters:
+//	- id: c-m-12345
+//	  name: prod
+//	  kubeconfig: exports/prod.yaml
+//
+// Relative kubeconfig paths are resolved against the working directory.
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *Manifest) validate() error {
+	if len(m.Clusters) == 0 {
+		return errors.New("no clusters listed")
+	}
+	var problems []string
+	ids := make(map[string]bool)
+	for i, c := range m.Clusters {
+		switch {
+		case c.ID == "":
+			problems = append(problems, fmt.Sprintf("cluster %d: id is required", i+1))
+		case ids[c.ID]:
+			problems = append(problems, fmt.Sprintf("cluster %d: id %q is used twice", i+1, c.ID))
+		}
+		ids[c.ID] = true
+		if c.Kubeconfig == "" {
+			problems = append(problems, fmt.Sprintf("cluster %d: kubeconfig is required", i+1))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ListClusters returns the clusters of the manifest in its order.
+func (m *Manifest) ListClusters() (rancher.Clusters, error) {
+	clusters := make(rancher.Clusters, 0, len(m.Clusters))
+	for _, c := range m.Clusters {
+		name := c.Name
+		if name == "" {
+			name = c.ID
+		}
+		clusters = append(clusters, rancher.Cluster{ID: c.ID, Name: name, Labels: c.Labels})
+	}
+	return clusters, nil
+}
+
+// GetClusterKubeconfig reads the kubeconfig file of the cluster. Its current context is the
+// cluster's entry, as in the kubeconfigs Rancher generates.
+func (m *Manifest) GetClusterKubeconfig(clusterID string) (*api.Config, error) {
+	for _, c := range m.Clusters {
+		if c.ID != clusterID {
+			continue
+		}
+		path := c.Kubeconfig
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(m.dir, path)
+		}
+		cfg, err := clientcmd.LoadFromFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kubeconfig of cluster %s: %w", clusterID, err)
+		}
+		if cfg.CurrentContext == "" {
+			return nil, fmt.Errorf("kubeconfig %s of cluster %s has no current-context", path, clusterID)
+		}
+		return cfg, nil
+	}
+	return nil, fmt.Errorf("cluster %s is not in the cluster manifest", clusterID)
+}
@@ -0,0 +1,86 @@
+package clusterfile
+
+import (
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const prodKubeconfig = `apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: https://rancher.example.com/k8s/clusters/c-m-1
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: prod
+users:
+- name: prod
+  user:
+    token: kubeconfig-u-1:secret
+`
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "exports"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "exports", "prod.yaml"), []byte(prodKubeconfig), 0600))
+	path := filepath.Join(dir, "clusters.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+clusters:
+- id: c-m-1
+  name: prod
+  labels:
+    env: prod
+  kubeconfig: exports/prod.yaml
+- id: c-m-2
+  kubeconfig: exports/missing.yaml
+`), 0600))
+
+	m, err := Load(path)
+	require.NoError(t, err)
+
+	clusters, err := m.ListClusters()
+	require.NoError(t, err)
+	assert.Equal(t, rancher.Clusters{
+		{ID: "c-m-1", Name: "prod", Labels: map[string]string{"env": "prod"}},
+		{ID: "c-m-2", Name: "c-m-2"},
+	}, clusters)
+
+	cfg, err := m.GetClusterKubeconfig("c-m-1")
+	require.NoError(t, err, "kubeconfig paths are relative to the manifest")
+	assert.Equal(t, "kubeconfig-u-1:secret", cfg.AuthInfos["prod"].Token)
+
+	_, err = m.GetClusterKubeconfig("c-m-2")
+	assert.ErrorContains(t, err, "failed to read kubeconfig of cluster c-m-2")
+	_, err = m.GetClusterKubeconfig("c-m-3")
+	assert.ErrorContains(t, err, "not in the cluster manifest")
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"empty", "", "no clusters listed"},
+		{"unknown key", "clusters:\n- id: c-m-1\n  kubeconfig: a.yaml\n  token: x\n", "field token not found"},
+		{"missing id", "clusters:\n- name: prod\n  kubeconfig: a.yaml\n", "cluster 1: id is required"},
+		{"missing kubeconfig", "clusters:\n- id: c-m-1\n", "cluster 1: kubeconfig is required"},
+		{"duplicate id", "clusters:\n- id: c-m-1\n  kubeconfig: a.yaml\n- id: c-m-1\n  kubeconfig: b.yaml\n", `cluster 2: id "c-m-1" is used twice`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
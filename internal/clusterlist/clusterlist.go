@@ -0,0 +1,159 @@
+// Package clusterlist reads curated lists of the clusters to put into a kubeconfig.
+//
+// A list names each cluster by its Rancher name or ID, optionally with the context name its
+// entry gets and the namespace the context defaults to. Platform teams can hand such a list
+// to developers instead of having them pick from every cluster they can see in Rancher.
+package clusterlist
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Entry is one listed cluster.
+type Entry struct {
+	// Cluster is the Rancher name or ID of the cluster, matched case-insensitively
+	Cluster string `yaml:"cluster"`
+	// Context is the name of the kubeconfig entry (default: the cluster's name in Rancher)
+	Context string `yaml:"context,omitempty"`
+	// Namespace is the default namespace of the context (default: none)
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// List is the ordered list of clusters.
+type List struct {
+	Clusters []Entry `yaml:"clusters"`
+}
+
+// namespacePattern matches valid Kubernetes namespace names (RFC 1123 labels)
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// Load reads and validates the list at path. Files ending in .csv are read as CSV, all
+// others as YAML.
+func Load(path string) (*List, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster list: %w", err)
+	}
+	var list *List
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		list, err = ParseCSV(data)
+	} else {
+		list, err = ParseYAML(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster list %s: %w", path, err)
+	}
+	return list, nil
+}
+
+// ParseYAML decodes and validates a list of the form
+//
+//	clusters:
+//	- cluster: prod
+//	  context: acme-prod
+//	  namespace: payments
+func ParseYAML(data []byte) (*List, error) {
+	var list List
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&list); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := list.validate(); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ParseCSV decodes and validates a list with one cluster per line: cluster, then the optional
+// context and namespace. A first line starting with "cluster" is taken as the header, and
+// lines starting with # are ignored.
+func ParseCSV(data []byte) (*List, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var list List
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "cluster") {
+			continue
+		}
+		if len(record) > 3 {
+			return nil, fmt.Errorf("row %d: expected at most 3 fields (cluster, context, namespace), got %d", i+1, len(record))
+		}
+		var e Entry
+		fields := []*string{&e.Cluster, &e.Context, &e.Namespace}
+		for j, value := range record {
+			*fields[j] = strings.TrimSpace(value)
+		}
+		list.Clusters = append(list.Clusters, e)
+	}
+	if err := list.validate(); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (l *List) validate() error {
+	if len(l.Clusters) == 0 {
+		return errors.New("no clusters listed")
+	}
+
+	var problems []string
+	contexts := make(map[string]bool)
+	for i, e := range l.Clusters {
+		if err := e.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("entry %d: %v", i+1, err))
+			continue
+		}
+		if e.Context == "" {
+			continue
+		}
+		if contexts[e.Context] {
+			problems = append(problems, fmt.Sprintf("entry %d: context %q is used twice", i+1, e.Context))
+		}
+		contexts[e.Context] = true
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (e Entry) validate() error {
+	if e.Cluster == "" {
+		return errors.New("cluster is required")
+	}
+	if e.Namespace != "" && !namespacePattern.MatchString(e.Namespace) {
+		return fmt.Errorf("invalid namespace %q", e.Namespace)
+	}
+	return nil
+}
+
+// Matches reports whether the entry lists the Rancher cluster with the given name and ID.
+func (e Entry) Matches(name, id string) bool {
+	return strings.EqualFold(e.Cluster, name) || strings.EqualFold(e.Cluster, id)
+}
+
+// ContextName returns the name of the entry's kubeconfig context for a cluster named name in Rancher.
+func (e Entry) ContextName(name string) string {
+	if e.Context != "" {
+		return e.Context
+	}
+	return name
+}
@@ -0,0 +1,91 @@
+package clusterlist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseYAML(t *testing.T) {
+	list, err := ParseYAML([]byte(`
+clusters:
+- cluster: prod
+  context: acme-prod
+  namespace: payments
+- cluster: c-m-12345
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{
+		{Cluster: "prod", Context: "acme-prod", Namespace: "payments"},
+		{Cluster: "c-m-12345"},
+	}, list.Clusters)
+}
+
+func TestParseCSV(t *testing.T) {
+	list, err := ParseCSV([]byte("cluster,context,namespace\n" +
+		"# handed out by the platform team\n" +
+		"prod, acme-prod, payments\n" +
+		"c-m-12345\n" +
+		"staging,,web\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{
+		{Cluster: "prod", Context: "acme-prod", Namespace: "payments"},
+		{Cluster: "c-m-12345"},
+		{Cluster: "staging", Namespace: "web"},
+	}, list.Clusters)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		parse   func([]byte) (*List, error)
+		data    string
+		wantErr string
+	}{
+		{"empty", ParseYAML, "", "no clusters listed"},
+		{"unknown key", ParseYAML, "clusters:\n- cluster: prod\n  ns: web\n", "field ns not found"},
+		{"missing cluster", ParseYAML, "clusters:\n- context: prod\n", "entry 1: cluster is required"},
+		{"invalid namespace", ParseYAML, "clusters:\n- cluster: prod\n  namespace: Web_App\n", `entry 1: invalid namespace "Web_App"`},
+		{"duplicate context", ParseYAML, "clusters:\n- cluster: a\n  context: dev\n- cluster: b\n  context: dev\n", `entry 2: context "dev" is used twice`},
+		{"too many fields", ParseCSV, "prod,acme-prod,payments,extra\n", "row 1: expected at most 3 fields"},
+		{"header only", ParseCSV, "cluster,context,namespace\n", "no clusters listed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parse([]byte(tt.data))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestLoad_ByExtension(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "clusters.CSV")
+	require.NoError(t, os.WriteFile(csvPath, []byte("prod,acme-prod\n"), 0600))
+	list, err := Load(csvPath)
+	require.NoError(t, err)
+	assert.Equal(t, "acme-prod", list.Clusters[0].Context)
+
+	yamlPath := filepath.Join(dir, "clusters.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte("clusters:\n- cluster: prod\n"), 0600))
+	list, err = Load(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, "prod", list.Clusters[0].Cluster)
+
+	_, err = Load(filepath.Join(dir, "missing.yaml"))
+	assert.ErrorContains(t, err, "failed to read cluster list")
+}
+
+func TestEntry_Matches(t *testing.T) {
+	e := Entry{Cluster: "Prod"}
+	assert.True(t, e.Matches("prod", "c-1"))
+	assert.True(t, Entry{Cluster: "C-1"}.Matches("prod", "c-1"))
+	assert.False(t, e.Matches("staging", "c-2"))
+
+	assert.Equal(t, "prod", e.ContextName("prod"))
+	assert.Equal(t, "acme-prod", Entry{Cluster: "prod", Context: "acme-prod"}.ContextName("prod"))
+}
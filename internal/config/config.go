@@ -4,11 +4,12 @@ package config
 import (
 	"fmt"
 	"os"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"rancher-kubeconfig-updater/internal/terminal"
 	"strconv"
-	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
 )
 
 // GetConfig returns the value of a flag if it was set, otherwise returns the value of the environment variable.
@@ -22,24 +23,34 @@ func GetConfig(cmd *cobra.Command, flagName, envKey string) string {
 
 // GetPassword returns the password from the flag or environment variable.
 // If the flag is set to "-", it prompts the user for the password securely.
-func GetPassword(cmd *cobra.Command, flagName, envKey string) (string, error) {
+// The password is returned as a byte slice so callers can wipe it after use,
+// and a password given on the command line is scrubbed from the flag value so
+// it does not show up in later flag dumps.
+func GetPassword(cmd *cobra.Command, flagName, envKey string) ([]byte, error) {
+	return GetSecret(cmd, flagName, envKey, i18n.T(i18n.PromptPassword))
+}
+
+// GetSecret is GetPassword for other secrets, showing prompt when the flag is set to "-".
+func GetSecret(cmd *cobra.Command, flagName, envKey, prompt string) ([]byte, error) {
 	if cmd.Flags().Changed(flagName) {
 		val, _ := cmd.Flags().GetString(flagName)
 		if val == "-" {
-			fmt.Print("Enter Rancher Password: ")
-			bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+			fmt.Print(prompt)
+			bytePassword, err := terminal.ReadPassword(os.Stdin)
 			fmt.Println() // Newline after input
 			if err != nil {
-				return "", err
+				return nil, err
 			}
-			return string(bytePassword), nil
+			return bytePassword, nil
 		}
-		return val, nil
+		_ = cmd.Flags().Set(flagName, "")
+		return []byte(val), nil
 	}
-	return os.Getenv(envKey), nil
+	return []byte(os.Getenv(envKey)), nil
 }
 
 // GetBool returns the value of a boolean flag if it was set, otherwise returns the value from the environment variable.
+// If neither flag nor environment variable is set, returns the default value specified in the flag definition.
 func GetBool(cmd *cobra.Command, flagName, envKey string) bool {
 	if cmd.Flags().Changed(flagName) {
 		val, _ := cmd.Flags().GetBool(flagName)
@@ -48,7 +59,9 @@ func GetBool(cmd *cobra.Command, flagName, envKey string) bool {
 	// Check environment variable (case-insensitive)
 	envVal := os.Getenv(envKey)
 	if envVal == "" {
-		return false
+		// Return flag's default value
+		val, _ := cmd.Flags().GetBool(flagName)
+		return val
 	}
 	boolVal, err := strconv.ParseBool(envVal)
 	if err != nil {
@@ -79,3 +92,49 @@ func GetInt(cmd *cobra.Command, flagName, envKey string) int {
 	}
 	return intVal
 }
+
+// GetFloat returns the value of a float flag if it was set, otherwise returns the value from the environment variable.
+// If neither flag nor environment variable is set, returns the default value specified in the flag definition.
+func GetFloat(cmd *cobra.Command, flagName, envKey string) float64 {
+	if cmd.Flags().Changed(flagName) {
+		val, _ := cmd.Flags().GetFloat64(flagName)
+		return val
+	}
+	// Check environment variable
+	envVal := os.Getenv(envKey)
+	if envVal == "" {
+		// Return flag's default value
+		val, _ := cmd.Flags().GetFloat64(flagName)
+		return val
+	}
+	floatVal, err := strconv.ParseFloat(envVal, 64)
+	if err != nil {
+		// Return flag's default value on parse error
+		val, _ := cmd.Flags().GetFloat64(flagName)
+		return val
+	}
+	return floatVal
+}
+
+// GetDuration returns the value of a duration flag if it was set, otherwise returns the value from the environment variable.
+// If neither flag nor environment variable is set, returns the default value specified in the flag definition.
+func GetDuration(cmd *cobra.Command, flagName, envKey string) time.Duration {
+	if cmd.Flags().Changed(flagName) {
+		val, _ := cmd.Flags().GetDuration(flagName)
+		return val
+	}
+	// Check environment variable
+	envVal := os.Getenv(envKey)
+	if envVal == "" {
+		// Return flag's default value
+		val, _ := cmd.Flags().GetDuration(flagName)
+		return val
+	}
+	durationVal, err := time.ParseDuration(envVal)
+	if err != nil {
+		// Return flag's default value on parse error
+		val, _ := cmd.Flags().GetDuration(flagName)
+		return val
+	}
+	return durationVal
+}
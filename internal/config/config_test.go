@@ -3,6 +3,7 @@ package config
 import (
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
@@ -267,3 +268,98 @@ func TestGetInt_FlagOverridesEnv(t *testing.T) {
 	assert.Equal(t, 25, result)
 }
 
+
+// TestGetPassword_FlagValueScrubbed tests that a password given on the command line is removed from the flag value
+func TestGetPassword_FlagValueScrubbed(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("password", "", "password flag")
+	t.Setenv("TEST_PASSWORD", "")
+
+	err := cmd.Flags().Set("password", "s3cret")
+	assert.NoError(t, err)
+
+	password, err := GetPassword(cmd, "password", "TEST_PASSWORD")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("s3cret"), password)
+
+	flagValue, _ := cmd.Flags().GetString("password")
+	assert.Empty(t, flagValue)
+}
+
+// TestGetPassword_EnvVar tests reading the password from the environment variable
+func TestGetPassword_EnvVar(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("password", "", "password flag")
+	t.Setenv("TEST_PASSWORD", "from-env")
+
+	password, err := GetPassword(cmd, "password", "TEST_PASSWORD")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("from-env"), password)
+}
+
+// TestGetBool_FlagDefault tests that the flag's default value is used when neither flag nor env is set
+func TestGetBool_FlagDefault(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("test-flag", true, "test flag")
+
+	t.Setenv("TEST_ENV", "")
+	assert.True(t, GetBool(cmd, "test-flag", "TEST_ENV"))
+
+	t.Setenv("TEST_ENV", "false")
+	assert.False(t, GetBool(cmd, "test-flag", "TEST_ENV"))
+}
+
+// TestGetFloat tests the flag, environment variable and default priority of float settings
+func TestGetFloat(t *testing.T) {
+	tests := []struct {
+		name     string
+		flag     string
+		envValue string
+		expected float64
+	}{
+		{name: "Default", expected: 2.5},
+		{name: "EnvVar", envValue: "0.5", expected: 0.5},
+		{name: "EnvVarInvalid", envValue: "fast", expected: 2.5},
+		{name: "FlagOverridesEnv", flag: "10", envValue: "0.5", expected: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().Float64("test-flag", 2.5, "test flag")
+			t.Setenv("TEST_ENV", tt.envValue)
+			if tt.flag != "" {
+				assert.NoError(t, cmd.Flags().Set("test-flag", tt.flag))
+			}
+
+			assert.Equal(t, tt.expected, GetFloat(cmd, "test-flag", "TEST_ENV"))
+		})
+	}
+}
+
+func TestGetDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		flag     string
+		envValue string
+		expected time.Duration
+	}{
+		{name: "Default", expected: time.Hour},
+		{name: "EnvVar", envValue: "90m", expected: 90 * time.Minute},
+		{name: "EnvVarInvalid", envValue: "hourly", expected: time.Hour},
+		{name: "FlagOverridesEnv", flag: "6h", envValue: "90m", expected: 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().Duration("test-flag", time.Hour, "test flag")
+			t.Setenv("TEST_ENV", tt.envValue)
+			if tt.flag != "" {
+				assert.NoError(t, cmd.Flags().Set("test-flag", tt.flag))
+			}
+
+			assert.Equal(t, tt.expected, GetDuration(cmd, "test-flag", "TEST_ENV"))
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Setting is the value a config file gives a flag.
+type Setting struct {
+	Flag string
+	// Env is the environment variable that overrides the setting (empty if there is none)
+	Env   string
+	Value string
+}
+
+// Apply sets the flags of cmd to the settings, except flags given on the command line or
+// through their environment variable, so both still override the config file. Settings for
+// flags cmd does not have are skipped.
+func Apply(cmd *cobra.Command, settings []Setting) error {
+	for _, s := range settings {
+		if cmd.Flags().Lookup(s.Flag) == nil || cmd.Flags().Changed(s.Flag) {
+			continue
+		}
+		if s.Env != "" && os.Getenv(s.Env) != "" {
+			continue
+		}
+		if err := cmd.Flags().Set(s.Flag, s.Value); err != nil {
+			return fmt.Errorf("invalid %s in config file: %w", s.Flag, err)
+		}
+	}
+	return nil
+}
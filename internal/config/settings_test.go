@@ -0,0 +1,35 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestApply tests that flags and environment variables take precedence over the settings
+func TestApply(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("server", "", "")
+	cmd.Flags().String("user", "", "")
+	cmd.Flags().Int("threshold-days", 30, "")
+	require.NoError(t, cmd.ParseFlags([]string{"--user", "flag-user"}))
+	t.Setenv("TOKEN_THRESHOLD_DAYS", "10")
+	t.Setenv("RANCHER_URL", "")
+
+	require.NoError(t, Apply(cmd, []Setting{
+		{Flag: "server", Env: "RANCHER_URL", Value: "https://rancher.example.com"},
+		{Flag: "user", Env: "RANCHER_USERNAME", Value: "file-user"},
+		{Flag: "threshold-days", Env: "TOKEN_THRESHOLD_DAYS", Value: "7"},
+		{Flag: "unknown", Value: "skipped"},
+	}))
+	assert.Equal(t, "https://rancher.example.com", GetConfig(cmd, "server", "RANCHER_URL"))
+	assert.Equal(t, "flag-user", GetConfig(cmd, "user", "RANCHER_USERNAME"))
+	assert.Equal(t, 10, GetInt(cmd, "threshold-days", "TOKEN_THRESHOLD_DAYS"))
+
+	cmd = &cobra.Command{}
+	cmd.Flags().Int("threshold-days", 30, "")
+	t.Setenv("TOKEN_THRESHOLD_DAYS", "")
+	assert.ErrorContains(t, Apply(cmd, []Setting{{Flag: "threshold-days", Value: "soon"}}), "invalid threshold-days in config file")
+}
@@ -0,0 +1,132 @@
+// Package credcache provides a local token cache for the kubectl exec-credential plugin.
+// A single long-running cache server holds cluster tokens in memory so that many
+// concurrent kubectl invocations share one Rancher login and one generateKubeconfig call.
+package credcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Credential is a cluster token together with its expiration time.
+// A zero ExpiresAt means the token never expires.
+type Credential struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+// FetchFunc retrieves a fresh credential for the given cluster name or ID.
+type FetchFunc func(ctx context.Context, cluster string) (Credential, error)
+
+// entry is a cached credential with refresh bookkeeping
+type entry struct {
+	cred       Credential
+	refreshing bool
+}
+
+// call tracks an in-flight synchronous fetch so concurrent callers can share it
+type call struct {
+	done chan struct{}
+	cred Credential
+	err  error
+}
+
+// Cache stores credentials per cluster and refreshes them before they expire.
+type Cache struct {
+	fetch         FetchFunc
+	refreshBefore time.Duration
+	now           func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*entry
+	inflight map[string]*call
+}
+
+// NewCache creates a Cache that uses fetch to obtain credentials.
+// Cached credentials expiring within refreshBefore are still served, but a
+// background refresh is started so the next caller receives a fresh token.
+func NewCache(fetch FetchFunc, refreshBefore time.Duration) *Cache {
+	return &Cache{
+		fetch:         fetch,
+		refreshBefore: refreshBefore,
+		now:           time.Now,
+		entries:       make(map[string]*entry),
+		inflight:      make(map[string]*call),
+	}
+}
+
+// Get returns the credential for a cluster, fetching it when it is missing or expired.
+func (c *Cache) Get(ctx context.Context, cluster string) (Credential, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[cluster]; ok {
+		now := c.now()
+		if e.cred.ExpiresAt.IsZero() || now.Before(e.cred.ExpiresAt) {
+			// Still usable; refresh in the background when close to expiry
+			if !e.cred.ExpiresAt.IsZero() && !now.Before(e.cred.ExpiresAt.Add(-c.refreshBefore)) && !e.refreshing {
+				e.refreshing = true
+				go c.refresh(cluster)
+			}
+			cred := e.cred
+			c.mu.Unlock()
+			return cred, nil
+		}
+		// Expired entries are dropped and fetched synchronously below
+		delete(c.entries, cluster)
+	}
+	c.mu.Unlock()
+
+	return c.load(ctx, cluster)
+}
+
+// load fetches a credential synchronously, sharing the result with concurrent callers
+func (c *Cache) load(ctx context.Context, cluster string) (Credential, error) {
+	c.mu.Lock()
+	if inflight, ok := c.inflight[cluster]; ok {
+		c.mu.Unlock()
+		select {
+		case <-inflight.done:
+			return inflight.cred, inflight.err
+		case <-ctx.Done():
+			return Credential{}, ctx.Err()
+		}
+	}
+
+	cl := &call{done: make(chan struct{})}
+	c.inflight[cluster] = cl
+	c.mu.Unlock()
+
+	// The fetch is detached from the caller's context so a cancelled kubectl
+	// invocation does not abort the fetch other callers are waiting on
+	cl.cred, cl.err = c.fetch(context.WithoutCancel(ctx), cluster)
+
+	c.mu.Lock()
+	delete(c.inflight, cluster)
+	if cl.err == nil {
+		c.entries[cluster] = &entry{cred: cl.cred}
+	}
+	c.mu.Unlock()
+	close(cl.done)
+
+	if cl.err != nil {
+		return Credential{}, fmt.Errorf("failed to fetch credential for cluster %s: %w", cluster, cl.err)
+	}
+	return cl.cred, nil
+}
+
+// refresh replaces a cached credential in the background
+func (c *Cache) refresh(cluster string) {
+	cred, err := c.fetch(context.Background(), cluster)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[cluster]
+	if !ok {
+		return
+	}
+	e.refreshing = false
+	if err == nil {
+		e.cred = cred
+	}
+}
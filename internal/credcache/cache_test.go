@@ -0,0 +1,222 @@
+package credcache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_Get_CachesCredential(t *testing.T) {
+	var calls int32
+	cache := NewCache(func(ctx context.Context, cluster string) (Credential, error) {
+		atomic.AddInt32(&calls, 1)
+		return Credential{Token: "token-" + cluster, ExpiresAt: time.Now().Add(24 * time.Hour)}, nil
+	}, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		cred, err := cache.Get(context.Background(), "prod")
+		require.NoError(t, err)
+		assert.Equal(t, "token-prod", cred.Token)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestCache_Get_ConcurrentCallersShareFetch(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	cache := NewCache(func(ctx context.Context, cluster string) (Credential, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return Credential{Token: "shared"}, nil
+	}, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cred, err := cache.Get(context.Background(), "prod")
+			assert.NoError(t, err)
+			assert.Equal(t, "shared", cred.Token)
+		}()
+	}
+
+	// Give goroutines time to queue up on the in-flight fetch
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestCache_Get_RefreshesInBackground(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	refreshed := make(chan struct{})
+	var calls int32
+	cache := NewCache(func(ctx context.Context, cluster string) (Credential, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 2 {
+			defer close(refreshed)
+			return Credential{Token: "new", ExpiresAt: now.Add(48 * time.Hour)}, nil
+		}
+		return Credential{Token: "old", ExpiresAt: now.Add(30 * time.Minute)}, nil
+	}, time.Hour)
+	cache.now = func() time.Time { return now }
+
+	// First call fetches; second call is within the refresh window and serves the cached token
+	cred, err := cache.Get(context.Background(), "prod")
+	require.NoError(t, err)
+	assert.Equal(t, "old", cred.Token)
+
+	cred, err = cache.Get(context.Background(), "prod")
+	require.NoError(t, err)
+	assert.Equal(t, "old", cred.Token)
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("background refresh did not run")
+	}
+
+	assert.Eventually(t, func() bool {
+		cred, err := cache.Get(context.Background(), "prod")
+		return err == nil && cred.Token == "new"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCache_Get_ExpiredIsRefetched(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var calls int32
+	cache := NewCache(func(ctx context.Context, cluster string) (Credential, error) {
+		atomic.AddInt32(&calls, 1)
+		return Credential{Token: "t", ExpiresAt: now.Add(time.Minute)}, nil
+	}, 0)
+	cache.now = func() time.Time { return now }
+
+	_, err := cache.Get(context.Background(), "prod")
+	require.NoError(t, err)
+
+	now = now.Add(2 * time.Minute)
+	_, err = cache.Get(context.Background(), "prod")
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestCache_Get_FetchErrorNotCached(t *testing.T) {
+	var calls int32
+	cache := NewCache(func(ctx context.Context, cluster string) (Credential, error) {
+		atomic.AddInt32(&calls, 1)
+		return Credential{}, errors.New("rancher unavailable")
+	}, time.Hour)
+
+	_, err := cache.Get(context.Background(), "prod")
+	assert.ErrorContains(t, err, "rancher unavailable")
+	_, err = cache.Get(context.Background(), "prod")
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestServeAndLookup(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "cache.sock")
+	listener, err := Listen(socketPath)
+	require.NoError(t, err)
+
+	cache := NewCache(func(ctx context.Context, cluster string) (Credential, error) {
+		if cluster == "missing" {
+			return Credential{}, errors.New("cluster not found")
+		}
+		return Credential{Token: "token-" + cluster}, nil
+	}, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, listener, cache) }()
+
+	lookupCtx, lookupCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer lookupCancel()
+
+	cred, err := Lookup(lookupCtx, socketPath, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, "token-prod", cred.Token)
+	assert.True(t, cred.ExpiresAt.IsZero())
+
+	_, err = Lookup(lookupCtx, socketPath, "missing")
+	assert.ErrorContains(t, err, "cluster not found")
+
+	// A second server on the same socket must be refused
+	_, err = Listen(socketPath)
+	assert.ErrorContains(t, err, "already running")
+
+	cancel()
+	assert.NoError(t, <-done)
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err), "the socket is removed on shutdown")
+}
+
+func TestListen_SocketPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions")
+	}
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "cache.sock")
+	listener, err := Listen(socketPath)
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	info, err := os.Stat(socketPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the private directory the socket was created in is removed")
+}
+
+func TestHandleConn_Deadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer func() {
+		_ = client.Close()
+	}()
+	cache := NewCache(func(ctx context.Context, cluster string) (Credential, error) {
+		return Credential{}, nil
+	}, time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		handleConn(context.Background(), &shortDeadlineConn{Conn: server}, cache)
+		close(done)
+	}()
+
+	// The client never sends a request, so the server gives up at the deadline
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection without a request is not closed")
+	}
+}
+
+// shortDeadlineConn shortens the deadlines set on it, so tests don't wait for ioTimeout
+type shortDeadlineConn struct {
+	net.Conn
+}
+
+func (c *shortDeadlineConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetDeadline(t.Add(-ioTimeout + 50*time.Millisecond))
+}
+
+func TestLookup_NoServer(t *testing.T) {
+	_, err := Lookup(context.Background(), filepath.Join(t.TempDir(), "none.sock"), "prod")
+	assert.ErrorContains(t, err, "failed to connect to credential cache")
+}
@@ -0,0 +1,178 @@
+package credcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/appdir"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"time"
+)
+
+// request is a single line-delimited JSON request sent to the cache server
+type request struct {
+	Cluster string `json:"cluster"`
+}
+
+// response is a single line-delimited JSON response returned by the cache server
+type response struct {
+	Credential
+	Error string `json:"error,omitempty"`
+}
+
+// ioTimeout limits how long the server waits for a client to send its request or read the
+// response, so a client that stops talking does not hold a connection forever
+const ioTimeout = 10 * time.Second
+
+// DefaultSocketPath returns the default unix socket path of the cache server.
+// The RANCHER_CREDENTIAL_CACHE_SOCKET environment variable overrides it.
+func DefaultSocketPath() (string, error) {
+	if path := os.Getenv("RANCHER_CREDENTIAL_CACHE_SOCKET"); path != "" {
+		return path, nil
+	}
+	dir, err := appdir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "credcache.sock"), nil
+}
+
+// Listen creates the unix socket at path, removing a stale socket left by a previous server.
+// The socket is only accessible by the current user.
+func Listen(path string) (net.Listener, error) {
+	if err := readonly.Check(path); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	// A socket that nobody answers on is left over from a crashed server
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("credential cache server already running on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	// The socket is created in a private directory and only moved into place once its
+	// permissions are set, so other users can't connect in between
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".credcache-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	tmpPath := filepath.Join(dir, "credcache.sock")
+
+	listener, err := net.Listen("unix", tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(tmpPath, 0600); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return &socketListener{Listener: listener, path: path}, nil
+}
+
+// socketListener removes the socket from the path it was moved to when closed, like a
+// listener created at that path does
+type socketListener struct {
+	net.Listener
+	path string
+}
+
+func (l *socketListener) Close() error {
+	_ = os.Remove(l.path)
+	return l.Listener.Close()
+}
+
+// Serve answers credential requests on listener until ctx is cancelled.
+func Serve(ctx context.Context, listener net.Listener, cache *Cache) error {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+		go handleConn(ctx, conn, cache)
+	}
+}
+
+// handleConn serves a single request on conn
+func handleConn(ctx context.Context, conn net.Conn, cache *Cache) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_ = conn.SetDeadline(time.Now().Add(ioTimeout))
+	var req request
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		_ = json.NewEncoder(conn).Encode(response{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	var resp response
+	cred, err := cache.Get(ctx, req.Cluster)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Credential = cred
+	}
+	// Fetching the credential may have taken longer than the client is given
+	_ = conn.SetDeadline(time.Now().Add(ioTimeout))
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+// Lookup asks the cache server listening on socketPath for a cluster credential.
+// It returns an error if the server is not reachable, so callers can fall back
+// to fetching the credential themselves.
+func Lookup(ctx context.Context, socketPath, cluster string) (Credential, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return Credential{}, fmt.Errorf("failed to connect to credential cache: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(conn).Encode(request{Cluster: cluster}); err != nil {
+		return Credential{}, fmt.Errorf("failed to send credential request: %w", err)
+	}
+
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return Credential{}, fmt.Errorf("failed to read credential response: %w", err)
+	}
+	if resp.Error != "" {
+		return Credential{}, errors.New(resp.Error)
+	}
+	return resp.Credential, nil
+}
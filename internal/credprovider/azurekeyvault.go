@@ -0,0 +1,32 @@
+package credprovider
+
+import (
+	"context"
+
+	"rancher-kubeconfig-updater/internal/azkv"
+)
+
+// AzureKeyVault reads a secret from Azure Key Vault, by reference azkv://VAULT/SECRET[/VERSION].
+type AzureKeyVault struct {
+	ref    azkv.Ref
+	client *azkv.Client
+}
+
+// NewAzureKeyVault creates a provider for a Key Vault reference.
+func NewAzureKeyVault(reference string) (*AzureKeyVault, error) {
+	ref, err := azkv.ParseRef(reference)
+	if err != nil {
+		return nil, err
+	}
+	return &AzureKeyVault{ref: ref, client: azkv.NewClient()}, nil
+}
+
+// Name implements Provider.
+func (p *AzureKeyVault) Name() string {
+	return "Key Vault " + p.ref.String()
+}
+
+// Fetch implements Provider.
+func (p *AzureKeyVault) Fetch(ctx context.Context) ([]byte, error) {
+	return p.client.Get(ctx, p.ref)
+}
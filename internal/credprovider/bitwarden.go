@@ -0,0 +1,204 @@
+package credprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"rancher-kubeconfig-updater/internal/secretstore"
+)
+
+// bitwardenSessionKey is the secret store key of the cached bw session
+const bitwardenSessionKey = "bitwarden-session"
+
+// sessionStore caches the bw session key between runs (implemented by secretstore.Store)
+type sessionStore interface {
+	Save(key string, secret []byte) error
+	Load(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// Bitwarden reads a secret from Bitwarden or Vaultwarden with the bw CLI, by reference
+// bw://item or bw://item/field. The item is a name or ID; field is password (the default),
+// username, totp, notes or the name of a custom field.
+//
+// When bw is not logged in, it logs in with the API key in BW_CLIENTID and BW_CLIENTSECRET.
+// The vault is unlocked with BW_PASSWORD or an interactive prompt, and the session key is
+// cached in the secret store so later runs don't unlock again. BW_SESSION overrides the cache.
+type Bitwarden struct {
+	Reference string
+
+	item, field string
+
+	// sessions caches the session key (nil disables caching)
+	sessions sessionStore
+}
+
+// NewBitwarden creates a provider for a Bitwarden secret reference.
+func NewBitwarden(reference string) (*Bitwarden, error) {
+	rest, ok := strings.CutPrefix(reference, "bw://")
+	item, field, _ := strings.Cut(rest, "/")
+	if !ok || item == "" || strings.Contains(field, "/") {
+		return nil, fmt.Errorf("invalid Bitwarden reference %q: expected bw://item or bw://item/field", reference)
+	}
+	if field == "" {
+		field = "password"
+	}
+
+	p := &Bitwarden{Reference: reference, item: item, field: field}
+	if dir, err := secretstore.DefaultDir(); err == nil {
+		p.sessions = secretstore.New(dir)
+	}
+	return p, nil
+}
+
+// Name implements Provider.
+func (p *Bitwarden) Name() string {
+	return "Bitwarden " + p.Reference
+}
+
+// Fetch implements Provider.
+func (p *Bitwarden) Fetch(ctx context.Context) ([]byte, error) {
+	if session := os.Getenv("BW_SESSION"); session != "" {
+		return p.get(ctx, session)
+	}
+
+	if p.sessions != nil {
+		if session, err := p.sessions.Load(bitwardenSessionKey); err == nil {
+			secret, err := p.get(ctx, string(session))
+			if err == nil {
+				return secret, nil
+			}
+			// The cached session has expired or the vault was locked; unlock again below
+			_ = p.sessions.Delete(bitwardenSessionKey)
+		}
+	}
+
+	session, err := p.unlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.sessions != nil {
+		// Caching is an optimization, the secret is still returned if it fails
+		_ = p.sessions.Save(bitwardenSessionKey, []byte(session))
+	}
+	return p.get(ctx, session)
+}
+
+// unlock logs in with the API key if needed and unlocks the vault, returning the session key
+func (p *Bitwarden) unlock(ctx context.Context) (string, error) {
+	out, err := runBW(ctx, false, nil, "status")
+	if err != nil {
+		return "", err
+	}
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(out, &status); err != nil {
+		return "", fmt.Errorf("failed to decode bw status: %w", err)
+	}
+
+	if status.Status == "unauthenticated" {
+		if os.Getenv("BW_CLIENTID") == "" || os.Getenv("BW_CLIENTSECRET") == "" {
+			return "", errors.New("bw is not logged in: run bw login or set BW_CLIENTID and BW_CLIENTSECRET")
+		}
+		if _, err := runBW(ctx, false, nil, "login", "--apikey"); err != nil {
+			return "", err
+		}
+	}
+
+	args := []string{"unlock", "--raw"}
+	if os.Getenv("BW_PASSWORD") != "" {
+		args = append(args, "--passwordenv", "BW_PASSWORD")
+	}
+	out, err = runBW(ctx, true, nil, args...)
+	if err != nil {
+		return "", err
+	}
+	session := strings.TrimSpace(string(out))
+	if session == "" {
+		return "", errors.New("bw unlock returned no session key")
+	}
+	return session, nil
+}
+
+// bitwardenItem is the part of a bw item that holds its values
+type bitwardenItem struct {
+	Notes string `json:"notes"`
+	Login *struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		TOTP     string `json:"totp"`
+	} `json:"login"`
+	Fields []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"fields"`
+}
+
+// get reads the referenced field of the item using session. The session is passed in the
+// environment, since other local users can read the command line of a running bw.
+func (p *Bitwarden) get(ctx context.Context, session string) ([]byte, error) {
+	out, err := runBW(ctx, false, []string{"BW_SESSION=" + session}, "get", "item", p.item, "--nointeraction")
+	if err != nil {
+		return nil, err
+	}
+	defer clear(out)
+
+	var item bitwardenItem
+	if err := json.Unmarshal(out, &item); err != nil {
+		return nil, fmt.Errorf("failed to decode bw item: %w", err)
+	}
+
+	var value string
+	switch {
+	case p.field == "notes":
+		value = item.Notes
+	case item.Login != nil && p.field == "password":
+		value = item.Login.Password
+	case item.Login != nil && p.field == "username":
+		value = item.Login.Username
+	case item.Login != nil && p.field == "totp":
+		value = item.Login.TOTP
+	default:
+		for _, f := range item.Fields {
+			if f.Name == p.field {
+				value = f.Value
+				break
+			}
+		}
+	}
+	if value == "" {
+		return nil, fmt.Errorf("field %s not found in item %s", p.field, p.item)
+	}
+	return []byte(value), nil
+}
+
+// runBW runs the bw CLI with env added to the environment and returns its output. Interactive
+// runs get the terminal so bw can prompt.
+func runBW(ctx context.Context, interactive bool, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "bw", args...)
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if interactive {
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		clear(stdout.Bytes())
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("bw %s failed: %w: %s", args[0], err, msg)
+		}
+		return nil, fmt.Errorf("bw %s failed: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
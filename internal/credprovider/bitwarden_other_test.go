@@ -0,0 +1,109 @@
+//go:build !windows
+
+package credprovider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBW is a bw CLI stub that logs in with an API key, unlocks with BW_PASSWORD and
+// only serves items for the session it issued. Every call is appended to the calls file.
+const fakeBW = `#!/bin/sh
+dir=$(dirname "$0")
+echo "$1" >> "$dir/calls"
+case "$1" in
+status)
+	if [ -f "$dir/logged-in" ]; then echo '{"status":"locked"}'; else echo '{"status":"unauthenticated"}'; fi ;;
+login)
+	touch "$dir/logged-in" ;;
+unlock)
+	printf 'session-%s\n' "$BW_PASSWORD" ;;
+get)
+	# The session must come from the environment, never the command line
+	[ "$#" -eq 4 ] && [ "$BW_SESSION" = "session-hunter2" ] || { echo "Vault is locked." >&2; exit 1; }
+	echo '{"login":{"username":"admin","password":"s3cret"},"fields":[{"name":"api-token","value":"token-abc12:apisecret"}]}' ;;
+esac
+`
+
+// installFakeBW puts fakeBW first in PATH and returns a function reporting the bw calls so far
+func installFakeBW(t *testing.T) func() []string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bw"), []byte(fakeBW), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("BW_SESSION", "")
+	t.Setenv("BW_PASSWORD", "hunter2")
+	t.Setenv("BW_CLIENTID", "user.client")
+	t.Setenv("BW_CLIENTSECRET", "client-secret")
+	return func() []string {
+		data, _ := os.ReadFile(filepath.Join(dir, "calls"))
+		return strings.Fields(string(data))
+	}
+}
+
+func TestBitwarden_FetchCachesSession(t *testing.T) {
+	calls := installFakeBW(t)
+	sessions := memorySessions{}
+
+	p, err := NewBitwarden("bw://rancher")
+	require.NoError(t, err)
+	p.sessions = sessions
+	secret, err := Fetch(context.Background(), p)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", string(secret))
+	assert.Equal(t, []string{"status", "login", "unlock", "get"}, calls())
+	assert.Equal(t, "session-hunter2", string(sessions[bitwardenSessionKey]))
+
+	// The next run reuses the cached session
+	p, err = NewBitwarden("bw://rancher/api-token")
+	require.NoError(t, err)
+	p.sessions = sessions
+	secret, err = Fetch(context.Background(), p)
+	require.NoError(t, err)
+	assert.Equal(t, "token-abc12:apisecret", string(secret))
+	assert.Equal(t, []string{"status", "login", "unlock", "get", "get"}, calls())
+}
+
+func TestBitwarden_FetchReplacesExpiredSession(t *testing.T) {
+	calls := installFakeBW(t)
+	sessions := memorySessions{bitwardenSessionKey: []byte("expired")}
+
+	p, err := NewBitwarden("bw://rancher/username")
+	require.NoError(t, err)
+	p.sessions = sessions
+	secret, err := Fetch(context.Background(), p)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", string(secret))
+	assert.Equal(t, []string{"get", "status", "login", "unlock", "get"}, calls())
+	assert.Equal(t, "session-hunter2", string(sessions[bitwardenSessionKey]))
+}
+
+func TestBitwarden_FetchNotLoggedIn(t *testing.T) {
+	installFakeBW(t)
+	t.Setenv("BW_CLIENTID", "")
+
+	p, err := NewBitwarden("bw://rancher")
+	require.NoError(t, err)
+	p.sessions = nil
+	_, err = Fetch(context.Background(), p)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "BW_CLIENTID")
+}
+
+func TestBitwarden_FetchMissingField(t *testing.T) {
+	installFakeBW(t)
+	t.Setenv("BW_SESSION", "session-hunter2")
+
+	p, err := NewBitwarden("bw://rancher/notes")
+	require.NoError(t, err)
+	_, err = Fetch(context.Background(), p)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field notes not found")
+}
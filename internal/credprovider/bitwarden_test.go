@@ -0,0 +1,51 @@
+package credprovider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBitwarden(t *testing.T) {
+	p, err := NewBitwarden("bw://rancher")
+	require.NoError(t, err)
+	assert.Equal(t, "password", p.field, "password is the default field")
+
+	p, err = NewBitwarden("bw://rancher/api-token")
+	require.NoError(t, err)
+	assert.Equal(t, "rancher", p.item)
+	assert.Equal(t, "api-token", p.field)
+
+	for _, ref := range []string{"bw://", "bw:///password", "bw://a/b/c", "rancher"} {
+		_, err := NewBitwarden(ref)
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestFromReference_Bitwarden(t *testing.T) {
+	p, err := FromReference("bw://rancher")
+	require.NoError(t, err)
+	assert.Equal(t, "Bitwarden bw://rancher", p.Name())
+}
+
+// memorySessions is an in-memory sessionStore
+type memorySessions map[string][]byte
+
+func (m memorySessions) Save(key string, secret []byte) error {
+	m[key] = secret
+	return nil
+}
+
+func (m memorySessions) Load(key string) ([]byte, error) {
+	secret, ok := m[key]
+	if !ok {
+		return nil, assert.AnError
+	}
+	return secret, nil
+}
+
+func (m memorySessions) Delete(key string) error {
+	delete(m, key)
+	return nil
+}
@@ -0,0 +1,40 @@
+package credprovider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+)
+
+// Command runs a shell command and uses its standard output as the secret,
+// e.g. "op read op://vault/rancher/password" or "pass show rancher".
+type Command struct {
+	Line string
+}
+
+// NewCommand creates a provider for the command line.
+func NewCommand(line string) *Command {
+	return &Command{Line: line}
+}
+
+// Name implements Provider.
+func (c *Command) Name() string {
+	return fmt.Sprintf("credential command %q", c.Line)
+}
+
+// Fetch implements Provider. The command runs through the shell (cmd.exe on Windows) with
+// the terminal attached to stdin and stderr, so it can ask for a master password or unlock.
+func (c *Command) Fetch(ctx context.Context) ([]byte, error) {
+	cmd := shellCommand(ctx, c.Line)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		clear(stdout.Bytes())
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
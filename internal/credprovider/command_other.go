@@ -0,0 +1,13 @@
+//go:build !windows
+
+package credprovider
+
+import (
+	"context"
+	"os/exec"
+)
+
+// shellCommand returns a command that runs line through sh
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package credprovider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommand_Fetch(t *testing.T) {
+	secret, err := Fetch(context.Background(), NewCommand(`printf '%s\n' "my secret"`))
+	require.NoError(t, err)
+	assert.Equal(t, "my secret", string(secret))
+}
+
+func TestCommand_FetchFailure(t *testing.T) {
+	_, err := Fetch(context.Background(), NewCommand("echo partial; exit 3"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exit status 3")
+}
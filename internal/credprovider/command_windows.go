@@ -0,0 +1,17 @@
+//go:build windows
+
+package credprovider
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand returns a command that runs line through cmd.exe.
+// cmd.exe parses quotes itself, so the line is passed through without Go's argument escaping.
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd.exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd.exe /S /C "` + line + `"`}
+	return cmd
+}
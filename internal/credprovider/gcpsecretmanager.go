@@ -0,0 +1,33 @@
+package credprovider
+
+import (
+	"context"
+
+	"rancher-kubeconfig-updater/internal/gcpsm"
+)
+
+// GCPSecretManager reads a secret version from Google Secret Manager, by reference
+// gcp-sm://projects/PROJECT/secrets/SECRET[/versions/VERSION].
+type GCPSecretManager struct {
+	ref    gcpsm.Ref
+	client *gcpsm.Client
+}
+
+// NewGCPSecretManager creates a provider for a Secret Manager reference.
+func NewGCPSecretManager(reference string) (*GCPSecretManager, error) {
+	ref, err := gcpsm.ParseRef(reference)
+	if err != nil {
+		return nil, err
+	}
+	return &GCPSecretManager{ref: ref, client: gcpsm.NewClient()}, nil
+}
+
+// Name implements Provider.
+func (p *GCPSecretManager) Name() string {
+	return "Secret Manager " + p.ref.String()
+}
+
+// Fetch implements Provider.
+func (p *GCPSecretManager) Fetch(ctx context.Context) ([]byte, error) {
+	return p.client.Access(ctx, p.ref)
+}
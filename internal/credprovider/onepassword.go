@@ -0,0 +1,185 @@
+package credprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// connectTimeout limits each request to the 1Password Connect server
+const connectTimeout = 30 * time.Second
+
+// OnePassword reads a secret from 1Password by secret reference (op://vault/item/field or
+// op://vault/item/section/field). With OP_CONNECT_HOST and OP_CONNECT_TOKEN set, the
+// 1Password Connect server is queried; otherwise the op CLI is used, which signs in with
+// OP_SERVICE_ACCOUNT_TOKEN when set or through the desktop app.
+type OnePassword struct {
+	Reference string
+
+	vault, item, section, field string
+
+	connectHost  string
+	connectToken string
+	httpClient   *http.Client
+}
+
+// NewOnePassword creates a provider for a 1Password secret reference.
+func NewOnePassword(reference string) (*OnePassword, error) {
+	parts := strings.Split(strings.TrimPrefix(reference, "op://"), "/")
+	if !strings.HasPrefix(reference, "op://") || (len(parts) != 3 && len(parts) != 4) || slices.Contains(parts, "") {
+		return nil, fmt.Errorf("invalid 1Password reference %q: expected op://vault/item/field or op://vault/item/section/field", reference)
+	}
+
+	p := &OnePassword{
+		Reference:    reference,
+		vault:        parts[0],
+		item:         parts[1],
+		field:        parts[len(parts)-1],
+		connectHost:  strings.TrimSuffix(os.Getenv("OP_CONNECT_HOST"), "/"),
+		connectToken: os.Getenv("OP_CONNECT_TOKEN"),
+		httpClient:   &http.Client{Timeout: connectTimeout},
+	}
+	if len(parts) == 4 {
+		p.section = parts[2]
+	}
+	return p, nil
+}
+
+// Name implements Provider.
+func (p *OnePassword) Name() string {
+	return "1Password " + p.Reference
+}
+
+// Fetch implements Provider.
+func (p *OnePassword) Fetch(ctx context.Context) ([]byte, error) {
+	if p.connectHost != "" && p.connectToken != "" {
+		return p.fetchConnect(ctx)
+	}
+	return p.fetchCLI(ctx)
+}
+
+// fetchCLI reads the secret with `op read`
+func (p *OnePassword) fetchCLI(ctx context.Context) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "op", "read", "--no-newline", p.Reference)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		clear(stdout.Bytes())
+		return nil, fmt.Errorf("op read failed: %w", err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// connectItem is the part of a 1Password Connect item that holds its values
+type connectItem struct {
+	Sections []struct {
+		ID    string `json:"id"`
+		Label string `json:"label"`
+	} `json:"sections"`
+	Fields []struct {
+		ID      string `json:"id"`
+		Label   string `json:"label"`
+		Value   string `json:"value"`
+		Section *struct {
+			ID string `json:"id"`
+		} `json:"section"`
+	} `json:"fields"`
+}
+
+// fetchConnect reads the secret from a 1Password Connect server
+func (p *OnePassword) fetchConnect(ctx context.Context) ([]byte, error) {
+	vaultID, err := p.connectLookup(ctx, "/v1/vaults", "name", p.vault)
+	if err != nil {
+		return nil, fmt.Errorf("vault %s: %w", p.vault, err)
+	}
+	itemID, err := p.connectLookup(ctx, "/v1/vaults/"+url.PathEscape(vaultID)+"/items", "title", p.item)
+	if err != nil {
+		return nil, fmt.Errorf("item %s: %w", p.item, err)
+	}
+
+	var item connectItem
+	if err := p.connectGet(ctx, "/v1/vaults/"+url.PathEscape(vaultID)+"/items/"+url.PathEscape(itemID), &item); err != nil {
+		return nil, fmt.Errorf("item %s: %w", p.item, err)
+	}
+
+	sectionID := ""
+	if p.section != "" {
+		for _, s := range item.Sections {
+			if s.Label == p.section || s.ID == p.section {
+				sectionID = s.ID
+			}
+		}
+		if sectionID == "" {
+			return nil, fmt.Errorf("section %s not found in item %s", p.section, p.item)
+		}
+	}
+	for _, f := range item.Fields {
+		if f.Label != p.field && f.ID != p.field {
+			continue
+		}
+		if sectionID != "" && (f.Section == nil || f.Section.ID != sectionID) {
+			continue
+		}
+		return []byte(f.Value), nil
+	}
+	return nil, fmt.Errorf("field %s not found in item %s", p.field, p.item)
+}
+
+// connectLookup resolves a vault or item name to its ID; names that match nothing are used as IDs
+func (p *OnePassword) connectLookup(ctx context.Context, path, attribute, name string) (string, error) {
+	var results []struct {
+		ID string `json:"id"`
+	}
+	filter := url.Values{"filter": {fmt.Sprintf("%s eq %q", attribute, name)}}
+	if err := p.connectGet(ctx, path+"?"+filter.Encode(), &results); err != nil {
+		return "", err
+	}
+	switch len(results) {
+	case 0:
+		return name, nil
+	case 1:
+		return results[0].ID, nil
+	default:
+		return "", fmt.Errorf("%d matches, use the ID instead of the name", len(results))
+	}
+}
+
+// connectGet sends an authenticated GET request to the Connect server and decodes the JSON response
+func (p *OnePassword) connectGet(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.connectHost+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.connectToken)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("1Password Connect request failed: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read 1Password Connect response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("1Password Connect returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode 1Password Connect response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+
+package credprovider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnePassword_FetchCLI(t *testing.T) {
+	// A fake op CLI that echoes the reference it was asked to read
+	dir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1 $2\" = \"read --no-newline\" ] || exit 1\nprintf 'secret for %s' \"$3\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "op"), []byte(script), 0o755))
+	t.Setenv("PATH", dir)
+	t.Setenv("OP_CONNECT_HOST", "")
+	t.Setenv("OP_CONNECT_TOKEN", "")
+
+	p, err := NewOnePassword("op://Private/Rancher/password")
+	require.NoError(t, err)
+	secret, err := Fetch(context.Background(), p)
+	require.NoError(t, err)
+	assert.Equal(t, "secret for op://Private/Rancher/password", string(secret))
+}
@@ -0,0 +1,105 @@
+package credprovider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOnePassword_InvalidReference(t *testing.T) {
+	for _, ref := range []string{"op://vault/item", "op://vault//field", "vault/item/field", "op://a/b/c/d/e"} {
+		_, err := NewOnePassword(ref)
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestFromReference(t *testing.T) {
+	p, err := FromReference("op://Private/Rancher/password")
+	require.NoError(t, err)
+	assert.Equal(t, "1Password op://Private/Rancher/password", p.Name())
+
+	_, err = FromReference("vault://secret/rancher")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported")
+
+	_, err = FromReference("op://Private")
+	require.Error(t, err)
+}
+
+// newConnectStub returns a 1Password Connect stub with one vault holding one item
+func newConnectStub(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer connect-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/vaults":
+			if r.URL.Query().Get("filter") == `name eq "Private"` {
+				_, _ = w.Write([]byte(`[{"id": "v1"}]`))
+				return
+			}
+			_, _ = w.Write([]byte(`[]`))
+		case "/v1/vaults/v1/items":
+			if r.URL.Query().Get("filter") == `title eq "Rancher"` {
+				_, _ = w.Write([]byte(`[{"id": "i1"}]`))
+				return
+			}
+			_, _ = w.Write([]byte(`[]`))
+		case "/v1/vaults/v1/items/i1":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"sections": []map[string]string{{"id": "s1", "label": "prod"}},
+				"fields": []map[string]any{
+					{"id": "password", "label": "password", "value": "top-level"},
+					{"id": "f2", "label": "password", "value": "in-section", "section": map[string]string{"id": "s1"}},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOnePassword_FetchConnect(t *testing.T) {
+	server := newConnectStub(t)
+	t.Setenv("OP_CONNECT_HOST", server.URL)
+	t.Setenv("OP_CONNECT_TOKEN", "connect-token")
+
+	p, err := NewOnePassword("op://Private/Rancher/password")
+	require.NoError(t, err)
+	secret, err := Fetch(context.Background(), p)
+	require.NoError(t, err)
+	assert.Equal(t, "top-level", string(secret))
+
+	p, err = NewOnePassword("op://Private/Rancher/prod/password")
+	require.NoError(t, err)
+	secret, err = Fetch(context.Background(), p)
+	require.NoError(t, err)
+	assert.Equal(t, "in-section", string(secret))
+
+	p, err = NewOnePassword("op://Private/Rancher/token")
+	require.NoError(t, err)
+	_, err = Fetch(context.Background(), p)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field token not found")
+}
+
+func TestOnePassword_FetchConnectUnauthorized(t *testing.T) {
+	server := newConnectStub(t)
+	t.Setenv("OP_CONNECT_HOST", server.URL)
+	t.Setenv("OP_CONNECT_TOKEN", "wrong")
+
+	p, err := NewOnePassword("op://Private/Rancher/password")
+	require.NoError(t, err)
+	_, err = Fetch(context.Background(), p)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 401")
+}
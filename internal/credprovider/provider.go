@@ -0,0 +1,94 @@
+// Package credprovider obtains the Rancher password or API token from external secret
+// managers at runtime, so it doesn't have to live in environment variables or dotfiles.
+package credprovider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Kind tells how a secret is used to authenticate with Rancher.
+type Kind string
+
+const (
+	// KindPassword is a password for the username/password login
+	KindPassword Kind = "password"
+	// KindToken is a Rancher API token ("token-xxxxx:secret") used without logging in
+	KindToken Kind = "token"
+)
+
+// Provider retrieves the Rancher secret from a secret manager.
+type Provider interface {
+	// Fetch returns the secret. Callers wipe it after use.
+	Fetch(ctx context.Context) ([]byte, error)
+	// Name identifies the provider in error messages.
+	Name() string
+}
+
+// apiTokenPattern matches Rancher API tokens
+var apiTokenPattern = regexp.MustCompile(`^token-[a-z0-9]+:[A-Za-z0-9]+$`)
+
+// Classify reports whether secret is a Rancher API token or a password.
+func Classify(secret []byte) Kind {
+	if apiTokenPattern.Match(secret) {
+		return KindToken
+	}
+	return KindPassword
+}
+
+// ErrEmptySecret is returned when a provider produced no secret.
+var ErrEmptySecret = errors.New("empty secret")
+
+// Fetch retrieves the secret from p, trimming the trailing newline most CLIs print.
+func Fetch(ctx context.Context, p Provider) ([]byte, error) {
+	secret, err := p.Fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Rancher credential from %s: %w", p.Name(), err)
+	}
+	trimmed := bytes.TrimRight(secret, "\r\n")
+	if len(trimmed) == 0 {
+		clear(secret)
+		return nil, fmt.Errorf("failed to get Rancher credential from %s: %w", p.Name(), ErrEmptySecret)
+	}
+	return trimmed, nil
+}
+
+// FromReference creates the provider for a secret reference such as op://vault/item/field.
+func FromReference(reference string) (Provider, error) {
+	scheme, _, ok := strings.Cut(reference, "://")
+	if !ok {
+		return nil, fmt.Errorf("invalid secret reference %q: expected a URI such as op://vault/item/field", reference)
+	}
+	switch scheme {
+	case "op":
+		p, err := NewOnePassword(reference)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case "bw":
+		p, err := NewBitwarden(reference)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case "gcp-sm":
+		p, err := NewGCPSecretManager(reference)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case "azkv":
+		p, err := NewAzureKeyVault(reference)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unsupported secret reference %q: supported schemes are op://, bw://, gcp-sm:// and azkv://", reference)
+	}
+}
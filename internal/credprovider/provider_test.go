@@ -0,0 +1,59 @@
+package credprovider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticProvider returns a fixed secret or error
+type staticProvider struct {
+	secret []byte
+	err    error
+}
+
+func (s staticProvider) Fetch(context.Context) ([]byte, error) { return s.secret, s.err }
+func (s staticProvider) Name() string                          { return "static" }
+
+func TestClassify(t *testing.T) {
+	assert.Equal(t, KindToken, Classify([]byte("token-abc12:s3cr3tValue")))
+	assert.Equal(t, KindPassword, Classify([]byte("hunter2")))
+	assert.Equal(t, KindPassword, Classify([]byte("token-abc12:has spaces")))
+	assert.Equal(t, KindPassword, Classify([]byte("kubeconfig-u-abc:secret")))
+}
+
+func TestFetch_TrimsTrailingNewline(t *testing.T) {
+	secret, err := Fetch(context.Background(), staticProvider{secret: []byte("p@ss word \r\n")})
+	require.NoError(t, err)
+	assert.Equal(t, "p@ss word ", string(secret))
+}
+
+func TestFetch_Errors(t *testing.T) {
+	_, err := Fetch(context.Background(), staticProvider{secret: []byte("\n")})
+	assert.ErrorIs(t, err, ErrEmptySecret)
+
+	_, err = Fetch(context.Background(), staticProvider{err: errors.New("vault locked")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "from static: vault locked")
+}
+
+func TestFromReference_GCPSecretManager(t *testing.T) {
+	p, err := FromReference("gcp-sm://projects/my-proj/secrets/rancher-password")
+	require.NoError(t, err)
+	assert.Equal(t, "Secret Manager gcp-sm://projects/my-proj/secrets/rancher-password", p.Name())
+
+	_, err = FromReference("gcp-sm://my-proj/rancher-password")
+	assert.Error(t, err)
+}
+
+func TestFromReference_AzureKeyVault(t *testing.T) {
+	p, err := FromReference("azkv://myvault/rancher-password")
+	require.NoError(t, err)
+	assert.Equal(t, "Key Vault azkv://myvault/rancher-password", p.Name())
+
+	_, err = FromReference("azkv://myvault")
+	assert.Error(t, err)
+}
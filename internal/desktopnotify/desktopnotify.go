@@ -0,0 +1,59 @@
+// Package desktopnotify shows desktop notifications with the notifier the operating system
+// ships: notify-send on Linux and BSD, osascript on macOS and a PowerShell toast on Windows.
+package desktopnotify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// appName is the application the notifications are shown for
+const appName = "rancher-kubeconfig-updater"
+
+// windowsToast shows a toast with the title and message passed in the environment, so neither
+// needs quoting. Toasts need a registered application ID, so PowerShell's is borrowed.
+const windowsToast = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode($env:NOTIFY_TITLE)) > $null
+$text.Item(1).AppendChild($template.CreateTextNode($env:NOTIFY_MESSAGE)) > $null
+$appID = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($appID).Show([Windows.UI.Notifications.ToastNotification]::new($template))`
+
+// Send shows a notification with title and message.
+func Send(ctx context.Context, title, message string) error {
+	cmd := command(ctx, runtime.GOOS, title, message)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s failed: %w: %s", cmd.Args[0], err, msg)
+		}
+		return fmt.Errorf("%s failed: %w", cmd.Args[0], err)
+	}
+	return nil
+}
+
+// command returns the command showing the notification on goos
+func command(ctx context.Context, goos, title, message string) *exec.Cmd {
+	switch goos {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+		return exec.CommandContext(ctx, "osascript", "-e", script)
+	case "windows":
+		cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToast)
+		cmd.Env = append(os.Environ(), "NOTIFY_TITLE="+title, "NOTIFY_MESSAGE="+message)
+		return cmd
+	default:
+		// A message starting with a dash, e.g. a cluster named like an option, is not an option
+		return exec.CommandContext(ctx, "notify-send", "--app-name="+appName, "--", title, message)
+	}
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
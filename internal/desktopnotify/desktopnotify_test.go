@@ -0,0 +1,26 @@
+package desktopnotify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand(t *testing.T) {
+	ctx := context.Background()
+
+	linux := command(ctx, "linux", "Token refresh failed", "prod: login failed")
+	assert.Equal(t, []string{"notify-send", "--app-name=rancher-kubeconfig-updater", "--", "Token refresh failed", "prod: login failed"}, linux.Args)
+
+	dashed := command(ctx, "linux", "Token refresh failed", "--urgency=critical")
+	assert.Equal(t, []string{"notify-send", "--app-name=rancher-kubeconfig-updater", "--", "Token refresh failed", "--urgency=critical"}, dashed.Args)
+
+	darwin := command(ctx, "darwin", `Say "hi"`, `C:\path`)
+	assert.Equal(t, []string{"osascript", "-e", `display notification "C:\\path" with title "Say \"hi\""`}, darwin.Args)
+
+	windows := command(ctx, "windows", "Token refresh failed", "prod: login failed")
+	assert.Equal(t, "powershell", windows.Args[0])
+	assert.Contains(t, windows.Env, "NOTIFY_TITLE=Token refresh failed")
+	assert.Contains(t, windows.Env, "NOTIFY_MESSAGE=prod: login failed")
+}
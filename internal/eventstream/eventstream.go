@@ -0,0 +1,70 @@
+// Package eventstream streams the lifecycle of a run as newline-delimited JSON, one event per
+// step, so wrappers and GUIs can show live progress without parsing logs.
+package eventstream
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event types, in the order a run emits them
+const (
+	TypeLogin          = "login"
+	TypeClusterStart   = "cluster-start"
+	TypeDecision       = "decision"
+	TypeTokenGenerated = "token-generated"
+	TypeSaved          = "saved"
+	TypeFinished       = "finished"
+)
+
+// Event is one step of a run. Tokens are only ever identified by their name.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	RunID     string    `json:"runId,omitempty"`
+	Server    string    `json:"server,omitempty"`
+	Cluster   string    `json:"cluster,omitempty"`
+	ClusterID string    `json:"clusterId,omitempty"`
+	// Regenerate is the decision of a decision event: whether the token is replaced
+	Regenerate *bool  `json:"regenerate,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	TokenName  string `json:"tokenName,omitempty"`
+	// Path is where a saved event wrote the kubeconfig
+	Path string `json:"path,omitempty"`
+	// Outcome is the outcome of a finished run
+	Outcome string `json:"outcome,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Stream writes events as NDJSON. It is safe for concurrent use and on a nil *Stream, which
+// discards every event.
+type Stream struct {
+	mu    sync.Mutex
+	w     io.Writer
+	runID string
+	now   func() time.Time
+}
+
+// New returns a stream writing the events of the run runID to w.
+func New(w io.Writer, runID string) *Stream {
+	return &Stream{w: w, runID: runID, now: time.Now}
+}
+
+// Emit writes e, stamped with the current time and the run ID. Write errors are ignored: a
+// reader that went away must not fail the run.
+func (s *Stream) Emit(e Event) {
+	if s == nil {
+		return
+	}
+	e.Time = s.now().UTC()
+	e.RunID = s.runID
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = s.w.Write(append(line, '\n'))
+}
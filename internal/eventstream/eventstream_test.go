@@ -0,0 +1,44 @@
+package eventstream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream_Emit(t *testing.T) {
+	var b bytes.Buffer
+	s := New(&b, "run-1")
+	s.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600)) }
+
+	regenerate := true
+	s.Emit(Event{Type: TypeClusterStart, Cluster: "prod", ClusterID: "c-prod"})
+	s.Emit(Event{Type: TypeDecision, Cluster: "prod", Regenerate: &regenerate, Reason: "expiring_soon"})
+
+	output := b.String()
+	assert.NotContains(t, output, `"path"`, "empty fields are left out")
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	var events []Event
+	for scanner.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+	require.Len(t, events, 2)
+	assert.Equal(t, TypeClusterStart, events[0].Type)
+	assert.Equal(t, "run-1", events[0].RunID)
+	assert.Equal(t, time.Date(2026, 3, 1, 11, 0, 0, 0, time.UTC), events[0].Time)
+	assert.Nil(t, events[0].Regenerate)
+	require.NotNil(t, events[1].Regenerate)
+	assert.True(t, *events[1].Regenerate)
+
+	// A nil stream discards events
+	var nilStream *Stream
+	nilStream.Emit(Event{Type: TypeSaved})
+}
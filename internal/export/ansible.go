@@ -0,0 +1,50 @@
+package export
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// AnsibleGroup is the inventory group all Rancher clusters belong to.
+const AnsibleGroup = "rancher_clusters"
+
+// AnsibleHostVars returns the variables of a cluster's inventory host. The cluster is
+// managed from the control node, so the host uses the local connection.
+func AnsibleHostVars(c Cluster, kubeconfigPath string) map[string]string {
+	return map[string]string{
+		"ansible_connection": "local",
+		"kubeconfig":         kubeconfigPath,
+		"kube_context":       c.Context,
+		"rancher_cluster_id": c.ClusterID,
+		"rancher_server":     c.Server,
+	}
+}
+
+// ansibleGroupName matches characters not allowed in Ansible group names
+var ansibleGroupName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// AnsibleInventory returns a JSON inventory in the format of Ansible's dynamic inventory
+// scripts (`--list`). Every cluster is a host in AnsibleGroup and in a group of its own
+// named cluster_<name>, so playbooks can target one cluster or all of them.
+func AnsibleInventory(clusters []Cluster, kubeconfigPath string) ([]byte, error) {
+	type group struct {
+		Hosts    []string `json:"hosts,omitempty"`
+		Children []string `json:"children,omitempty"`
+	}
+
+	hostVars := make(map[string]map[string]string, len(clusters))
+	inventory := map[string]any{}
+	all := group{Children: []string{AnsibleGroup}}
+	var rancher group
+	for _, c := range clusters {
+		hostVars[c.Context] = AnsibleHostVars(c, kubeconfigPath)
+		rancher.Hosts = append(rancher.Hosts, c.Context)
+		inventory["cluster_"+ansibleGroupName.ReplaceAllString(strings.ToLower(c.Context), "_")] = group{Hosts: []string{c.Context}}
+	}
+	inventory["all"] = all
+	inventory[AnsibleGroup] = rancher
+	inventory["_meta"] = map[string]any{"hostvars": hostVars}
+
+	return json.MarshalIndent(inventory, "", "  ")
+}
@@ -0,0 +1,41 @@
+package export
+
+import (
+	"fmt"
+	"regexp"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ContextFile is a standalone kubeconfig for one cluster context.
+type ContextFile struct {
+	// Name is the file name, derived from the context name
+	Name   string
+	Config *api.Config
+}
+
+// unsafeFileName matches characters that are replaced in context file names
+var unsafeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// ContextFiles splits the given clusters out of kubecfg into one kubeconfig per context,
+// each with that context as its current context. GUI tools such as Lens (kubeconfig sync
+// folders) and k9s pick these up as separate clusters.
+func ContextFiles(kubecfg *api.Config, clusters []Cluster) ([]ContextFile, error) {
+	files := make([]ContextFile, 0, len(clusters))
+	names := make(map[string]string, len(clusters))
+	for _, c := range clusters {
+		name := unsafeFileName.ReplaceAllString(c.Context, "_") + ".yaml"
+		if other, taken := names[name]; taken {
+			return nil, fmt.Errorf("contexts %s and %s map to the same file name %s", other, c.Context, name)
+		}
+		names[name] = c.Context
+
+		cfg := kubecfg.DeepCopy()
+		cfg.CurrentContext = c.Context
+		if err := api.MinifyConfig(cfg); err != nil {
+			return nil, fmt.Errorf("failed to extract context %s: %w", c.Context, err)
+		}
+		files = append(files, ContextFile{Name: name, Config: cfg})
+	}
+	return files, nil
+}
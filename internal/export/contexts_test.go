@@ -0,0 +1,44 @@
+package export
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestContextFiles(t *testing.T) {
+	kubecfg := newTestKubeconfig(t)
+	files, err := ContextFiles(kubecfg, Clusters(kubecfg))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	assert.Equal(t, "Edge-1.yaml", files[0].Name)
+	prod := files[1]
+	assert.Equal(t, "prod.yaml", prod.Name)
+	assert.Equal(t, "prod", prod.Config.CurrentContext)
+	assert.Len(t, prod.Config.Contexts, 1)
+	assert.Len(t, prod.Config.Clusters, 1)
+	assert.Len(t, prod.Config.AuthInfos, 1)
+
+	// The source kubeconfig is not reduced
+	assert.Len(t, kubecfg.Contexts, 3)
+}
+
+func TestContextFiles_SanitizesNames(t *testing.T) {
+	kubecfg := api.NewConfig()
+	for _, name := range []string{"team/a", "team:a"} {
+		kubecfg.Clusters[name] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-" + name}
+		kubecfg.AuthInfos[name] = &api.AuthInfo{Token: "token"}
+		kubecfg.Contexts[name] = &api.Context{Cluster: name, AuthInfo: name}
+	}
+
+	files, err := ContextFiles(kubecfg, []Cluster{{Context: "team/a"}})
+	require.NoError(t, err)
+	assert.Equal(t, "team_a.yaml", files[0].Name)
+
+	_, err = ContextFiles(kubecfg, []Cluster{{Context: "team/a"}, {Context: "team:a"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "same file name")
+}
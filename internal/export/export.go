@@ -0,0 +1,63 @@
+// Package export describes the Rancher clusters in a kubeconfig for other tools,
+// such as an Ansible inventory.
+package export
+
+import (
+	"sort"
+	"strings"
+
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Cluster is a Rancher cluster entry of a kubeconfig.
+type Cluster struct {
+	// Context is the name of the kubeconfig context, which is also the Rancher cluster name
+	Context   string
+	ClusterID string
+	Server    string
+}
+
+// Clusters returns the Rancher cluster entries of kubecfg sorted by context name: contexts
+// annotated by this tool, and contexts whose server is a Rancher cluster proxy URL
+// (https://RANCHER/k8s/clusters/ID). Other contexts are left out.
+func Clusters(kubecfg *api.Config) []Cluster {
+	names := make([]string, 0, len(kubecfg.Contexts))
+	for name := range kubecfg.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var clusters []Cluster
+	for _, name := range names {
+		ctx := kubecfg.Contexts[name]
+		if ctx == nil {
+			continue
+		}
+		var server string
+		if cluster, ok := kubecfg.Clusters[ctx.Cluster]; ok && cluster != nil {
+			server = cluster.Server
+		}
+
+		clusterID := proxyClusterID(server)
+		if md, ok := kubeconfig.GetMetadata(kubecfg, name); ok {
+			clusterID = md.ClusterID
+		}
+		if clusterID == "" {
+			continue
+		}
+		clusters = append(clusters, Cluster{Context: name, ClusterID: clusterID, Server: server})
+	}
+	return clusters
+}
+
+// proxyClusterID returns the cluster ID of a Rancher cluster proxy URL, or "" for other URLs
+func proxyClusterID(server string) string {
+	_, rest, ok := strings.Cut(server, "/k8s/clusters/")
+	if !ok {
+		return ""
+	}
+	clusterID, _, _ := strings.Cut(rest, "/")
+	return clusterID
+}
@@ -0,0 +1,76 @@
+package export
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// newTestKubeconfig returns a kubeconfig with a proxied Rancher cluster, an annotated
+// direct cluster and a cluster that has nothing to do with Rancher
+func newTestKubeconfig(t *testing.T) *api.Config {
+	t.Helper()
+	kubecfg := api.NewConfig()
+	add := func(name, server string) {
+		kubecfg.Clusters[name] = &api.Cluster{Server: server}
+		kubecfg.AuthInfos[name] = &api.AuthInfo{Token: "token"}
+		kubecfg.Contexts[name] = &api.Context{Cluster: name, AuthInfo: name}
+	}
+	add("prod", "https://rancher.example.com/k8s/clusters/c-m-prod")
+	add("Edge-1", "https://10.0.0.5:6443")
+	add("kind", "https://127.0.0.1:6443")
+	require.NoError(t, kubeconfig.SetMetadata(kubecfg, "Edge-1", kubeconfig.NewMetadata("https://rancher.example.com", "c-m-edge", time.Now())))
+	return kubecfg
+}
+
+func TestClusters(t *testing.T) {
+	clusters := Clusters(newTestKubeconfig(t))
+	assert.Equal(t, []Cluster{
+		{Context: "Edge-1", ClusterID: "c-m-edge", Server: "https://10.0.0.5:6443"},
+		{Context: "prod", ClusterID: "c-m-prod", Server: "https://rancher.example.com/k8s/clusters/c-m-prod"},
+	}, clusters)
+}
+
+func TestAnsibleInventory(t *testing.T) {
+	out, err := AnsibleInventory(Clusters(newTestKubeconfig(t)), "/home/me/.kube/config")
+	require.NoError(t, err)
+
+	var inventory struct {
+		All struct {
+			Children []string `json:"children"`
+		} `json:"all"`
+		Rancher struct {
+			Hosts []string `json:"hosts"`
+		} `json:"rancher_clusters"`
+		Edge struct {
+			Hosts []string `json:"hosts"`
+		} `json:"cluster_edge_1"`
+		Meta struct {
+			HostVars map[string]map[string]string `json:"hostvars"`
+		} `json:"_meta"`
+	}
+	require.NoError(t, json.Unmarshal(out, &inventory))
+
+	assert.Equal(t, []string{AnsibleGroup}, inventory.All.Children)
+	assert.Equal(t, []string{"Edge-1", "prod"}, inventory.Rancher.Hosts)
+	assert.Equal(t, []string{"Edge-1"}, inventory.Edge.Hosts)
+	assert.Equal(t, map[string]string{
+		"ansible_connection": "local",
+		"kubeconfig":         "/home/me/.kube/config",
+		"kube_context":       "prod",
+		"rancher_cluster_id": "c-m-prod",
+		"rancher_server":     "https://rancher.example.com/k8s/clusters/c-m-prod",
+	}, inventory.Meta.HostVars["prod"])
+}
+
+func TestAnsibleInventory_Empty(t *testing.T) {
+	out, err := AnsibleInventory(nil, "/home/me/.kube/config")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"_meta": {"hostvars": {}}, "all": {"children": ["rancher_clusters"]}, "rancher_clusters": {}}`, string(out))
+}
@@ -0,0 +1,186 @@
+// Package federation logs a CI job in to Rancher with the OIDC token its platform issues to
+// it, such as the ID tokens of GitHub Actions and GitLab CI, so pipelines need no stored
+// Rancher secret.
+//
+// A Source fetches the job's token, and an Exchanger turns it into an ID token Rancher's
+// generic OIDC provider accepts: unchanged when Rancher trusts the CI platform directly, or
+// through token exchange at an identity provider that trusts it.
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"rancher-kubeconfig-updater/internal/oidc"
+	"strings"
+	"time"
+)
+
+// GitLabVariable is the variable the gitlab source reads; it has to be declared under
+// id_tokens in .gitlab-ci.yml
+const GitLabVariable = "GITLAB_OIDC_TOKEN"
+
+// requestTimeout limits the request for a GitHub Actions token
+const requestTimeout = 30 * time.Second
+
+// Source fetches the OIDC token of the CI job.
+type Source interface {
+	// Token returns a token for audience. Sources whose audience is fixed by the CI
+	// configuration ignore it.
+	Token(ctx context.Context, audience string) (string, error)
+	String() string
+}
+
+// Exchanger turns the CI token into an ID token Rancher accepts.
+type Exchanger interface {
+	Exchange(ctx context.Context, ciToken string) (string, error)
+}
+
+// ParseSource parses a source: "github-actions", "gitlab", "env:NAME" for the variable NAME
+// or "file:PATH" for a token file such as a projected Kubernetes service account token.
+func ParseSource(value string) (Source, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case value == "github-actions":
+		return githubActions{client: &http.Client{Timeout: requestTimeout}}, nil
+	case value == "gitlab":
+		return envSource{name: GitLabVariable, hint: "declare it under id_tokens in .gitlab-ci.yml"}, nil
+	case strings.HasPrefix(value, "env:") && len(value) > len("env:"):
+		return envSource{name: strings.TrimPrefix(value, "env:")}, nil
+	case strings.HasPrefix(value, "file:") && len(value) > len("file:"):
+		return fileSource{path: strings.TrimPrefix(value, "file:")}, nil
+	default:
+		return nil, fmt.Errorf("invalid federated token source %q: must be 'github-actions', 'gitlab', 'env:NAME' or 'file:PATH'", value)
+	}
+}
+
+// githubActions requests a token from the GitHub Actions OIDC provider, which needs the
+// id-token: write permission in the workflow
+type githubActions struct {
+	client *http.Client
+}
+
+func (g githubActions) Token(ctx context.Context, audience string) (string, error) {
+	requestURL, requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if requestURL == "" || requestToken == "" {
+		return "", errors.New("ACTIONS_ID_TOKEN_REQUEST_URL is not set: is this a GitHub Actions job with the id-token: write permission?")
+	}
+	if audience != "" {
+		sep := "?"
+		if strings.Contains(requestURL, "?") {
+			sep = "&"
+		}
+		requestURL += sep + url.Values{"audience": {audience}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request a GitHub Actions ID token: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to request a GitHub Actions ID token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to request a GitHub Actions ID token: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var answer struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(body, &answer); err != nil || answer.Value == "" {
+		return "", errors.New("GitHub Actions returned no ID token")
+	}
+	return answer.Value, nil
+}
+
+func (g githubActions) String() string {
+	return "github-actions"
+}
+
+// envSource reads the token from an environment variable, where CI systems such as GitLab
+// put the ID tokens declared for the job
+type envSource struct {
+	name string
+	// hint tells how to make the CI system set the variable (empty for none)
+	hint string
+}
+
+func (e envSource) Token(context.Context, string) (string, error) {
+	token := strings.TrimSpace(os.Getenv(e.name))
+	if token == "" {
+		if e.hint != "" {
+			return "", fmt.Errorf("%s is not set: %s", e.name, e.hint)
+		}
+		return "", fmt.Errorf("%s is not set", e.name)
+	}
+	return token, nil
+}
+
+func (e envSource) String() string {
+	return "env:" + e.name
+}
+
+// fileSource reads the token from a file, which is read again on every login because such
+// files are rotated in place
+type fileSource struct {
+	path string
+}
+
+func (f fileSource) Token(context.Context, string) (string, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the federated token: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("federated token file %s is empty", f.path)
+	}
+	return token, nil
+}
+
+func (f fileSource) String() string {
+	return "file:" + f.path
+}
+
+// Direct passes the CI token on unchanged, for a Rancher whose OIDC provider trusts the CI
+// platform as its issuer.
+type Direct struct{}
+
+func (Direct) Exchange(_ context.Context, ciToken string) (string, error) {
+	return ciToken, nil
+}
+
+// TokenExchange exchanges the CI token at an identity provider that trusts the CI platform
+// and is in turn trusted by Rancher.
+type TokenExchange struct {
+	Config oidc.Config
+}
+
+func (t TokenExchange) Exchange(ctx context.Context, ciToken string) (string, error) {
+	tokens, err := oidc.ExchangeToken(ctx, t.Config, ciToken)
+	if err != nil {
+		return "", fmt.Errorf("%s refused the CI token: %w", t.Config.Issuer, err)
+	}
+	return tokens.IDToken, nil
+}
+
+// Login fetches the CI token for audience from src and returns the ID token exchanger makes
+// of it.
+func Login(ctx context.Context, src Source, audience string, exchanger Exchanger) (string, error) {
+	ciToken, err := src.Token(ctx, audience)
+	if err != nil {
+		return "", err
+	}
+	return exchanger.Exchange(ctx, ciToken)
+}
@@ -0,0 +1,88 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseSource tests the accepted sources and the error for others
+func TestParseSource(t *testing.T) {
+	for _, value := range []string{"github-actions", "gitlab", "env:CI_JOB_JWT", "file:/var/run/token"} {
+		src, err := ParseSource(value)
+		require.NoError(t, err, value)
+		assert.NotEmpty(t, src.String())
+	}
+	for _, value := range []string{"", "gitlab-ci", "env:", "file:"} {
+		_, err := ParseSource(value)
+		assert.ErrorContains(t, err, "invalid federated token source", value)
+	}
+}
+
+// TestGitHubActions tests requesting a token for the audience with the job's request token
+func TestGitHubActions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer request-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "2.0", r.URL.Query().Get("api-version"))
+		assert.Equal(t, "rancher", r.URL.Query().Get("audience"))
+		_ = json.NewEncoder(w).Encode(map[string]string{"value": "github-token"})
+	}))
+	defer server.Close()
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", server.URL+"/token?api-version=2.0")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "request-token")
+
+	src, err := ParseSource("github-actions")
+	require.NoError(t, err)
+	token, err := src.Token(context.Background(), "rancher")
+	require.NoError(t, err)
+	assert.Equal(t, "github-token", token)
+}
+
+// TestGitHubActions_NoPermission tests the error outside a job allowed to request tokens
+func TestGitHubActions_NoPermission(t *testing.T) {
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", "")
+	src, err := ParseSource("github-actions")
+	require.NoError(t, err)
+	_, err = src.Token(context.Background(), "rancher")
+	assert.ErrorContains(t, err, "id-token: write")
+}
+
+// TestEnvAndFileSources tests reading the token from a variable and a file
+func TestEnvAndFileSources(t *testing.T) {
+	t.Setenv(GitLabVariable, "gitlab-token\n")
+	src, err := ParseSource("gitlab")
+	require.NoError(t, err)
+	token, err := src.Token(context.Background(), "ignored")
+	require.NoError(t, err)
+	assert.Equal(t, "gitlab-token", token)
+
+	t.Setenv(GitLabVariable, "")
+	_, err = src.Token(context.Background(), "")
+	assert.ErrorContains(t, err, "id_tokens")
+
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("file-token\n"), 0600))
+	src, err = ParseSource("file:" + path)
+	require.NoError(t, err)
+	token, err = src.Token(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, "file-token", token)
+}
+
+// TestLogin tests fetching the CI token and handing it to the exchanger
+func TestLogin(t *testing.T) {
+	t.Setenv("CI_TOKEN", "ci-token")
+	src, err := ParseSource("env:CI_TOKEN")
+	require.NoError(t, err)
+
+	idToken, err := Login(context.Background(), src, "rancher", Direct{})
+	require.NoError(t, err)
+	assert.Equal(t, "ci-token", idToken)
+}
@@ -0,0 +1,203 @@
+// Package gateway routes kubeconfig entries through an identity-aware proxy such as Teleport.
+//
+// Some clusters are only reachable through a proxy that authenticates the user itself,
+// typically with an exec plugin that provides a client certificate. The generated entry
+// then points at the proxy instead of Rancher, keeps Rancher's path for the cluster and
+// still carries the Rancher token, which the proxy passes on to Rancher.
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// execAPIVersion is used when a gateway does not name the ExecCredential version
+const execAPIVersion = "client.authentication.k8s.io/v1"
+
+// Gateway describes how to reach one cluster through a proxy.
+type Gateway struct {
+	// Server is the proxy address; Rancher's /k8s/clusters/<id> path is appended to it
+	Server string `yaml:"server"`
+	// TLSServerName overrides the name used to verify the proxy's certificate
+	TLSServerName string `yaml:"tls-server-name,omitempty"`
+	// CertificateAuthority is a file with the CA that signed the proxy's certificate
+	CertificateAuthority string `yaml:"certificate-authority,omitempty"`
+	// Exec is the plugin that authenticates with the proxy (nil if the proxy needs none)
+	Exec *Exec `yaml:"exec,omitempty"`
+}
+
+// Exec is the exec plugin a proxy requires, e.g. "tsh kube credentials".
+type Exec struct {
+	Command    string            `yaml:"command"`
+	Args       []string          `yaml:"args,omitempty"`
+	Env        map[string]string `yaml:"env,omitempty"`
+	APIVersion string            `yaml:"api-version,omitempty"`
+}
+
+// Config maps cluster names or IDs to the gateway used to reach them.
+type Config struct {
+	Clusters map[string]Gateway `yaml:"clusters"`
+}
+
+// Load reads and validates the gateway configuration at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gateway config: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gateway config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes a gateway configuration. Unknown keys are rejected so a typo
+// does not silently send a cluster around the proxy.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	var problems []string
+	for _, name := range cfg.names() {
+		if err := cfg.Clusters[name].validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("cluster %s: %v", name, err))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return &cfg, nil
+}
+
+func (g Gateway) validate() error {
+	u, err := url.Parse(g.Server)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("server %q must be an https:// URL", g.Server)
+	}
+	if g.Exec != nil && g.Exec.Command == "" {
+		return errors.New("exec needs a command")
+	}
+	return nil
+}
+
+// names returns the configured cluster keys in sorted order
+func (c *Config) names() []string {
+	names := make([]string, 0, len(c.Clusters))
+	for name := range c.Clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// For returns the gateway of the cluster with the given name or ID (case-insensitive).
+// A nil *Config has no gateways.
+func (c *Config) For(name, id string) (Gateway, bool) {
+	if c == nil {
+		return Gateway{}, false
+	}
+	for _, key := range c.names() {
+		if strings.EqualFold(key, name) || strings.EqualFold(key, id) {
+			return c.Clusters[key], true
+		}
+	}
+	return Gateway{}, false
+}
+
+// HasExec reports whether any gateway uses an exec plugin.
+func (c *Config) HasExec() bool {
+	if c == nil {
+		return false
+	}
+	for _, g := range c.Clusters {
+		if g.Exec != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply points the entry named name at the gateway. The cluster's server becomes the
+// proxy address followed by Rancher's path for clusterID (including any path prefix of
+// rancherURL), and the gateway's exec plugin is added next to the Rancher token.
+// Applying the same gateway again leaves the entry unchanged.
+func (g Gateway) Apply(c *api.Config, name, rancherURL, clusterID string) error {
+	ctx, ok := c.Contexts[name]
+	if !ok || ctx == nil {
+		return fmt.Errorf("context %s not found in kubeconfig", name)
+	}
+	cluster, ok := c.Clusters[ctx.Cluster]
+	if !ok || cluster == nil {
+		return fmt.Errorf("cluster %s of context %s not found in kubeconfig", ctx.Cluster, name)
+	}
+
+	server, err := g.server(rancherURL, clusterID)
+	if err != nil {
+		return err
+	}
+
+	if g.Exec != nil {
+		authInfo, ok := c.AuthInfos[ctx.AuthInfo]
+		if !ok || authInfo == nil || authInfo.Token == "" {
+			return fmt.Errorf("user %s of context %s has no Rancher token to pass through the gateway", ctx.AuthInfo, name)
+		}
+		authInfo.Exec = g.Exec.config()
+	}
+
+	cluster.Server = server
+	if g.TLSServerName != "" {
+		cluster.TLSServerName = g.TLSServerName
+	}
+	if g.CertificateAuthority != "" {
+		cluster.CertificateAuthority = g.CertificateAuthority
+		cluster.CertificateAuthorityData = nil
+	}
+	return nil
+}
+
+// server returns the proxied address of the cluster
+func (g Gateway) server(rancherURL, clusterID string) (string, error) {
+	u, err := url.Parse(rancherURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid Rancher URL %q: %w", rancherURL, err)
+	}
+	return strings.TrimSuffix(g.Server, "/") + strings.TrimSuffix(u.Path, "/") + "/k8s/clusters/" + clusterID, nil
+}
+
+// config converts the plugin into its kubeconfig form
+func (e *Exec) config() *api.ExecConfig {
+	apiVersion := e.APIVersion
+	if apiVersion == "" {
+		apiVersion = execAPIVersion
+	}
+	cfg := &api.ExecConfig{
+		APIVersion: apiVersion,
+		Command:    e.Command,
+		Args:       append([]string(nil), e.Args...),
+		// Proxy plugins like tsh may need to open a browser for SSO
+		InteractiveMode: api.IfAvailableExecInteractiveMode,
+	}
+	names := make([]string, 0, len(e.Env))
+	for name := range e.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cfg.Env = append(cfg.Env, api.ExecEnvVar{Name: name, Value: e.Env[name]})
+	}
+	return cfg
+}
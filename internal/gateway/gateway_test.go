@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const teleportConfig = `clusters:
+  prod:
+    server: https://teleport.example.com:3026/
+    tls-server-name: kube-teleport-proxy-alpn.teleport.example.com
+    exec:
+      command: tsh
+      args: [kube, credentials, --kube-cluster=prod, --teleport-cluster=example.com]
+      env:
+        TELEPORT_HOME: /home/me/.tsh
+        TELEPORT_PROXY: teleport.example.com:443
+  c-stage:
+    server: https://iap.example.com
+    certificate-authority: /etc/iap/ca.pem
+`
+
+// newEntry returns a kubeconfig with one entry as Rancher generates it
+func newEntry(name, clusterID string) *api.Config {
+	c := api.NewConfig()
+	c.Clusters[name] = &api.Cluster{
+		Server:                   "https://rancher.example.com/k8s/clusters/" + clusterID,
+		CertificateAuthorityData: []byte("rancher-ca"),
+	}
+	c.Contexts[name] = &api.Context{Cluster: name, AuthInfo: name}
+	c.AuthInfos[name] = &api.AuthInfo{Token: "kubeconfig-u-abc:secret"}
+	return c
+}
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(teleportConfig))
+	require.NoError(t, err)
+
+	gw, ok := cfg.For("PROD", "c-prod")
+	require.True(t, ok, "names match case-insensitively")
+	assert.Equal(t, "tsh", gw.Exec.Command)
+
+	gw, ok = cfg.For("stage", "c-stage")
+	require.True(t, ok, "clusters can be keyed by ID")
+	assert.Nil(t, gw.Exec)
+
+	_, ok = cfg.For("dev", "c-dev")
+	assert.False(t, ok)
+	assert.True(t, cfg.HasExec())
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		want  string
+	}{
+		"unknown key":    {"clusters:\n  prod:\n    server: https://p.example.com\n    sever: x\n", "field sever not found"},
+		"plain http":     {"clusters:\n  prod:\n    server: http://p.example.com\n", "must be an https:// URL"},
+		"missing server": {"clusters:\n  prod:\n    tls-server-name: p\n", "must be an https:// URL"},
+		"exec command":   {"clusters:\n  prod:\n    server: https://p.example.com\n    exec:\n      args: [x]\n", "exec needs a command"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.input))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateways.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(""), 0o600))
+
+	cfg, err := Load(path)
+	require.NoError(t, err, "an empty file configures no gateways")
+	assert.False(t, cfg.HasExec())
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestNilConfig(t *testing.T) {
+	var cfg *Config
+	_, ok := cfg.For("prod", "c-prod")
+	assert.False(t, ok)
+	assert.False(t, cfg.HasExec())
+}
+
+func TestApply(t *testing.T) {
+	cfg, err := Parse([]byte(teleportConfig))
+	require.NoError(t, err)
+	gw, _ := cfg.For("prod", "c-prod")
+
+	c := newEntry("prod", "c-prod")
+	require.NoError(t, gw.Apply(c, "prod", "https://rancher.example.com/", "c-prod"))
+
+	cluster := c.Clusters["prod"]
+	assert.Equal(t, "https://teleport.example.com:3026/k8s/clusters/c-prod", cluster.Server)
+	assert.Equal(t, "kube-teleport-proxy-alpn.teleport.example.com", cluster.TLSServerName)
+	assert.Equal(t, []byte("rancher-ca"), cluster.CertificateAuthorityData, "no CA configured keeps Rancher's")
+
+	authInfo := c.AuthInfos["prod"]
+	assert.Equal(t, "kubeconfig-u-abc:secret", authInfo.Token, "the Rancher token is passed through")
+	require.NotNil(t, authInfo.Exec)
+	assert.Equal(t, "client.authentication.k8s.io/v1", authInfo.Exec.APIVersion)
+	assert.Equal(t, []string{"kube", "credentials", "--kube-cluster=prod", "--teleport-cluster=example.com"}, authInfo.Exec.Args)
+	assert.Equal(t, []api.ExecEnvVar{
+		{Name: "TELEPORT_HOME", Value: "/home/me/.tsh"},
+		{Name: "TELEPORT_PROXY", Value: "teleport.example.com:443"},
+	}, authInfo.Exec.Env)
+	assert.Equal(t, api.IfAvailableExecInteractiveMode, authInfo.Exec.InteractiveMode)
+
+	before := c.DeepCopy()
+	require.NoError(t, gw.Apply(c, "prod", "https://rancher.example.com/", "c-prod"))
+	assert.Equal(t, before, c, "applying twice changes nothing")
+}
+
+func TestApply_RancherPathPrefix(t *testing.T) {
+	cfg, err := Parse([]byte(teleportConfig))
+	require.NoError(t, err)
+	gw, _ := cfg.For("stage", "c-stage")
+
+	c := newEntry("stage", "c-stage")
+	require.NoError(t, gw.Apply(c, "stage", "https://example.com/rancher", "c-stage"))
+
+	cluster := c.Clusters["stage"]
+	assert.Equal(t, "https://iap.example.com/rancher/k8s/clusters/c-stage", cluster.Server)
+	assert.Equal(t, "/etc/iap/ca.pem", cluster.CertificateAuthority)
+	assert.Nil(t, cluster.CertificateAuthorityData, "the proxy's CA replaces Rancher's")
+	assert.Nil(t, c.AuthInfos["stage"].Exec)
+}
+
+func TestApply_Errors(t *testing.T) {
+	cfg, err := Parse([]byte(teleportConfig))
+	require.NoError(t, err)
+	gw, _ := cfg.For("prod", "c-prod")
+
+	err = gw.Apply(api.NewConfig(), "prod", "https://rancher.example.com", "c-prod")
+	assert.ErrorContains(t, err, "context prod not found")
+
+	c := newEntry("prod", "c-prod")
+	c.AuthInfos["prod"] = &api.AuthInfo{Exec: &api.ExecConfig{Command: "rancher"}}
+	err = gw.Apply(c, "prod", "https://rancher.example.com", "c-prod")
+	assert.ErrorContains(t, err, "no Rancher token")
+	assert.Equal(t, "https://rancher.example.com/k8s/clusters/c-prod", c.Clusters["prod"].Server, "a failed apply leaves the entry alone")
+}
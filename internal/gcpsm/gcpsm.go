@@ -0,0 +1,178 @@
+// Package gcpsm reads and writes secrets in Google Secret Manager through its REST API,
+// so the updater can run in Cloud Run jobs without local credentials or kubeconfig files.
+package gcpsm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scheme is the URI scheme of secret references.
+const Scheme = "gcp-sm://"
+
+// requestTimeout limits each request to Secret Manager
+const requestTimeout = 30 * time.Second
+
+// ErrNotFound is returned when the secret or version does not exist.
+var ErrNotFound = errors.New("secret not found")
+
+// Ref identifies a secret version.
+type Ref struct {
+	Project string
+	Secret  string
+	// Version is a version number or "latest"
+	Version string
+}
+
+// ParseRef parses gcp-sm://projects/PROJECT/secrets/SECRET[/versions/VERSION].
+// Without a version the latest one is used.
+func ParseRef(reference string) (Ref, error) {
+	invalid := fmt.Errorf("invalid Secret Manager reference %q: expected %sprojects/PROJECT/secrets/SECRET[/versions/VERSION]", reference, Scheme)
+
+	rest, ok := strings.CutPrefix(reference, Scheme)
+	if !ok {
+		return Ref{}, invalid
+	}
+	parts := strings.Split(rest, "/")
+	if (len(parts) != 4 && len(parts) != 6) || parts[0] != "projects" || parts[2] != "secrets" {
+		return Ref{}, invalid
+	}
+	ref := Ref{Project: parts[1], Secret: parts[3], Version: "latest"}
+	if len(parts) == 6 {
+		if parts[4] != "versions" {
+			return Ref{}, invalid
+		}
+		ref.Version = parts[5]
+	}
+	if ref.Project == "" || ref.Secret == "" || ref.Version == "" {
+		return Ref{}, invalid
+	}
+	return ref, nil
+}
+
+// String returns the reference in gcp-sm:// form.
+func (r Ref) String() string {
+	s := Scheme + r.secretName()
+	if r.Version != "latest" {
+		s += "/versions/" + r.Version
+	}
+	return s
+}
+
+// secretName returns the resource name of the secret
+func (r Ref) secretName() string {
+	return "projects/" + r.Project + "/secrets/" + r.Secret
+}
+
+// Client talks to the Secret Manager API.
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+	token      func(ctx context.Context) (string, error)
+}
+
+// NewClient creates a client that authenticates with the ambient Google credentials
+// (see tokenSource).
+func NewClient() *Client {
+	return &Client{
+		endpoint:   "https://secretmanager.googleapis.com",
+		httpClient: &http.Client{Timeout: requestTimeout},
+		token:      (&tokenSource{}).token,
+	}
+}
+
+// payload is the data of a secret version
+type payload struct {
+	Data       string `json:"data"`
+	DataCrc32c string `json:"dataCrc32c,omitempty"`
+}
+
+// castagnoli is the CRC32C table Secret Manager uses for payload checksums
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Access returns the data of the referenced secret version.
+func (c *Client) Access(ctx context.Context, ref Ref) ([]byte, error) {
+	var resp struct {
+		Payload payload `json:"payload"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/"+ref.secretName()+"/versions/"+ref.Version+":access", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret payload: %w", err)
+	}
+	if resp.Payload.DataCrc32c != "" {
+		if want, err := strconv.ParseUint(resp.Payload.DataCrc32c, 10, 32); err == nil && crc32.Checksum(data, castagnoli) != uint32(want) {
+			clear(data)
+			return nil, errors.New("secret payload failed its checksum, it was corrupted in transit")
+		}
+	}
+	return data, nil
+}
+
+// AddVersion stores data as the new latest version of the referenced secret.
+// The secret itself must already exist.
+func (c *Client) AddVersion(ctx context.Context, ref Ref, data []byte) error {
+	body, err := json.Marshal(map[string]payload{"payload": {
+		Data:       base64.StdEncoding.EncodeToString(data),
+		DataCrc32c: strconv.FormatUint(uint64(crc32.Checksum(data, castagnoli)), 10),
+	}})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "/v1/"+ref.secretName()+":addVersion", body, nil)
+}
+
+// do sends an authenticated request and decodes the JSON response into out (if not nil)
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out any) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get Google access token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("secret manager request failed: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read secret manager response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("secret manager returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	case out == nil:
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode secret manager response: %w", err)
+	}
+	return nil
+}
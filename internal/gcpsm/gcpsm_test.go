@@ -0,0 +1,176 @@
+package gcpsm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRef(t *testing.T) {
+	ref, err := ParseRef("gcp-sm://projects/my-proj/secrets/rancher")
+	require.NoError(t, err)
+	assert.Equal(t, Ref{Project: "my-proj", Secret: "rancher", Version: "latest"}, ref)
+	assert.Equal(t, "gcp-sm://projects/my-proj/secrets/rancher", ref.String())
+
+	ref, err = ParseRef("gcp-sm://projects/my-proj/secrets/rancher/versions/3")
+	require.NoError(t, err)
+	assert.Equal(t, "3", ref.Version)
+	assert.Equal(t, "gcp-sm://projects/my-proj/secrets/rancher/versions/3", ref.String())
+
+	for _, bad := range []string{
+		"projects/my-proj/secrets/rancher",
+		"gcp-sm://my-proj/rancher",
+		"gcp-sm://projects//secrets/rancher",
+		"gcp-sm://projects/my-proj/secrets/rancher/versions/",
+		"gcp-sm://projects/my-proj/secrets/rancher/aliases/3",
+	} {
+		_, err := ParseRef(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// newSecretManagerStub returns a client for an in-memory Secret Manager holding the given secrets
+func newSecretManagerStub(t *testing.T, secrets map[string][][]byte) *Client {
+	t.Helper()
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/"), ":")
+		switch action {
+		case "addVersion":
+			versions, ok := secrets[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var req struct {
+				Payload payload `json:"payload"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			data, err := base64.StdEncoding.DecodeString(req.Payload.Data)
+			require.NoError(t, err)
+			assert.Equal(t, strconv.FormatUint(uint64(crc32.Checksum(data, castagnoli)), 10), req.Payload.DataCrc32c)
+			secrets[name] = append(versions, data)
+			_, _ = w.Write([]byte(`{}`))
+		case "access":
+			secret, _, _ := strings.Cut(name, "/versions/")
+			versions := secrets[secret]
+			if len(versions) == 0 || !strings.HasSuffix(name, "/versions/latest") {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			data := versions[len(versions)-1]
+			_ = json.NewEncoder(w).Encode(map[string]payload{"payload": {
+				Data:       base64.StdEncoding.EncodeToString(data),
+				DataCrc32c: strconv.FormatUint(uint64(crc32.Checksum(data, castagnoli)), 10),
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return &Client{
+		endpoint:   server.URL,
+		httpClient: server.Client(),
+		token: func(context.Context) (string, error) {
+			return "test-token", nil
+		},
+	}
+}
+
+func TestClient_AddVersionAndAccess(t *testing.T) {
+	client := newSecretManagerStub(t, map[string][][]byte{"projects/p/secrets/kubeconfig": nil})
+	ref := Ref{Project: "p", Secret: "kubeconfig", Version: "latest"}
+
+	_, err := client.Access(context.Background(), ref)
+	assert.True(t, errors.Is(err, ErrNotFound), "a secret without versions has nothing to access")
+
+	require.NoError(t, client.AddVersion(context.Background(), ref, []byte("v1")))
+	require.NoError(t, client.AddVersion(context.Background(), ref, []byte("v2")))
+	data, err := client.Access(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+}
+
+func TestClient_AddVersionMissingSecret(t *testing.T) {
+	client := newSecretManagerStub(t, map[string][][]byte{})
+	err := client.AddVersion(context.Background(), Ref{Project: "p", Secret: "missing", Version: "latest"}, []byte("data"))
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestNewClient_Timeout(t *testing.T) {
+	assert.Equal(t, requestTimeout, NewClient().httpClient.Timeout)
+}
+
+func TestTokenSource_FromEnv(t *testing.T) {
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "env-token")
+	token, err := (&tokenSource{}).token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "env-token", token)
+}
+
+func TestTokenSource_FromMetadataServer(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token": "metadata-token", "expires_in": 3599}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+
+	source := &tokenSource{}
+	for range 2 {
+		token, err := source.token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "metadata-token", token)
+	}
+	assert.Equal(t, 1, requests, "the token is cached until shortly before it expires")
+
+	source.expiresAt = time.Now().Add(30 * time.Second)
+	_, err := source.token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestTokenSource_MetadataServerProbedOnce(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+	t.Setenv("PATH", t.TempDir())
+
+	source := &tokenSource{}
+	for range 2 {
+		_, err := source.token(context.Background())
+		assert.ErrorContains(t, err, "gcloud auth login")
+	}
+	assert.Equal(t, 1, requests, "a metadata server that failed is not asked again")
+}
@@ -0,0 +1,116 @@
+package gcpsm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metadataTimeout bounds the metadata server probe, which hangs outside Google Cloud
+const metadataTimeout = 2 * time.Second
+
+// tokenRefreshMargin is how long before it expires a cached token is replaced
+const tokenRefreshMargin = time.Minute
+
+// tokenSource returns OAuth access tokens for the Secret Manager API, see token. Tokens of the
+// metadata server are cached until shortly before they expire, and a metadata server that
+// couldn't be reached is not asked again.
+type tokenSource struct {
+	mu sync.Mutex
+	// cached is the metadata server's token, valid until expiresAt
+	cached    string
+	expiresAt time.Time
+	// noMetadata is set once the metadata server failed before it ever answered, e.g. outside Google Cloud
+	noMetadata bool
+}
+
+// token returns an access token from the first of:
+//   - GOOGLE_OAUTH_ACCESS_TOKEN
+//   - the metadata server of the Cloud Run job or VM (GCE_METADATA_HOST overrides its address)
+//   - gcloud auth print-access-token, for developer machines; gcloud caches its tokens itself
+func (s *tokenSource) token(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	// Locked while asking the metadata server, which answers within metadataTimeout, so
+	// concurrent requests wait for its token instead of asking as well
+	s.mu.Lock()
+	if s.cached != "" && time.Until(s.expiresAt) > tokenRefreshMargin {
+		token := s.cached
+		s.mu.Unlock()
+		return token, nil
+	}
+	metadataErr := errors.New("unreachable on an earlier request")
+	if !s.noMetadata {
+		var token string
+		var expiresIn time.Duration
+		if token, expiresIn, metadataErr = metadataToken(ctx); metadataErr == nil {
+			s.cached, s.expiresAt = token, time.Now().Add(expiresIn)
+			s.mu.Unlock()
+			return token, nil
+		}
+		// Outside Google Cloud the probe fails every time; a server that answered before is asked again
+		s.noMetadata = s.cached == ""
+	}
+	s.mu.Unlock()
+
+	out, err := exec.CommandContext(ctx, "gcloud", "auth", "print-access-token").Output()
+	if err != nil {
+		return "", errors.Join(
+			fmt.Errorf("metadata server: %w", metadataErr),
+			fmt.Errorf("gcloud: %w", err),
+			errors.New("set GOOGLE_OAUTH_ACCESS_TOKEN, run on Google Cloud, or log in with gcloud auth login"),
+		)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// metadataToken gets the token of the attached service account from the metadata server,
+// together with how long it is valid
+func metadataToken(ctx context.Context) (string, time.Duration, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = "169.254.169.254"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	client := &http.Client{Timeout: metadataTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", 0, fmt.Errorf("failed to decode token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", 0, errors.New("empty token")
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
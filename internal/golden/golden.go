@@ -0,0 +1,172 @@
+// Package golden fetches a team-maintained "golden" kubeconfig.
+//
+// The golden kubeconfig describes which clusters and contexts everybody should have. It is
+// published centrally, over HTTP, in S3 or in a Git repository, while every user keeps
+// their own tokens.
+package golden
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Prefixes of the supported sources; anything else is a local file
+const (
+	s3Scheme  = "s3://"
+	gitPrefix = "git+"
+)
+
+// maxSize limits the size of a golden kubeconfig, which a misconfigured URL must not exceed
+const maxSize = 10 << 20
+
+// requestTimeout limits the download of a golden kubeconfig, over HTTP as well as with the aws and git CLIs
+const requestTimeout = 30 * time.Second
+
+// Fetch reads and parses the golden kubeconfig at source, which is one of
+//
+//	https://example.com/kubeconfig.yaml       fetched with a GET request
+//	s3://bucket/path/kubeconfig.yaml          downloaded with the aws CLI and its credentials
+//	git+https://example.com/repo.git//path/kubeconfig.yaml?ref=main
+//	                                          read from a shallow clone made with the git CLI
+//	/path/to/kubeconfig.yaml                  a local file, e.g. a mounted ConfigMap
+func Fetch(ctx context.Context, source string) (*api.Config, error) {
+	var data []byte
+	var err error
+	switch {
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		data, err = fetchHTTP(ctx, source)
+	case strings.HasPrefix(source, s3Scheme):
+		data, err = fetchS3(ctx, source)
+	case strings.HasPrefix(source, gitPrefix):
+		data, err = fetchGit(ctx, strings.TrimPrefix(source, gitPrefix))
+	default:
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch golden kubeconfig %s: %w", source, err)
+	}
+	cfg, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid golden kubeconfig %s: %w", source, err)
+	}
+	return cfg, nil
+}
+
+// fetchHTTP downloads the kubeconfig with a GET request
+func fetchHTTP(ctx context.Context, source string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxSize)
+	}
+	return data, nil
+}
+
+// fetchS3 downloads the object with `aws s3 cp`, which finds the credentials like any other
+// AWS tool (environment, profile, instance role)
+func fetchS3(ctx context.Context, source string) ([]byte, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(source, s3Scheme), "/")
+	if bucket == "" || key == "" {
+		return nil, errors.New("expected s3://bucket/key")
+	}
+	return run(ctx, "aws", "s3", "cp", "--quiet", source, "-")
+}
+
+// fetchGit reads the file from a shallow clone of the repository. source is the repository
+// URL, then // and the file's path in the repository, and an optional ?ref=branch-or-tag.
+func fetchGit(ctx context.Context, source string) ([]byte, error) {
+	source, ref, _ := strings.Cut(source, "?ref=")
+	repo, path, ok := cutPath(source)
+	if !ok {
+		return nil, errors.New("expected git+URL//path/to/kubeconfig, e.g. git+https://example.com/repo.git//kubeconfig.yaml")
+	}
+
+	if err := readonly.Check(os.TempDir()); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "golden-kubeconfig-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	if _, err := run(ctx, "git", append(args, "--", repo, dir)...); err != nil {
+		return nil, err
+	}
+	// The path must stay inside the clone
+	file := filepath.Join(dir, filepath.FromSlash(path))
+	if rel, err := filepath.Rel(dir, file); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("path %q is outside the repository", path)
+	}
+	return os.ReadFile(file)
+}
+
+// cutPath splits a repository URL with a // separated path, skipping the // of the scheme
+func cutPath(source string) (repo, path string, ok bool) {
+	start := 0
+	if i := strings.Index(source, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	i := strings.Index(source[start:], "//")
+	if i < 0 {
+		return "", "", false
+	}
+	repo, path = source[:start+i], source[start+i+2:]
+	if _, err := url.Parse(repo); err != nil || repo == "" || path == "" {
+		return "", "", false
+	}
+	return repo, path, true
+}
+
+// run runs a CLI and returns its standard output; its error output is part of the error
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	// git must fail instead of waiting for credentials on a terminal nobody is watching
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s failed: %w: %s", name, err, msg)
+		}
+		return nil, fmt.Errorf("%s failed: %w", name, err)
+	}
+	return stdout.Bytes(), nil
+}
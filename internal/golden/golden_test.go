@@ -0,0 +1,151 @@
+package golden
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const goldenYAML = `apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://rancher.example.com/k8s/clusters/c-prod
+contexts:
+- name: eu-prod
+  context:
+    cluster: prod
+    user: golden-user
+    namespace: apps
+users:
+- name: golden-user
+  user:
+    token: must-not-be-used
+`
+
+func TestFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/kubeconfig.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(goldenYAML))
+	}))
+	defer server.Close()
+
+	cfg, err := Fetch(context.Background(), server.URL+"/kubeconfig.yaml")
+	require.NoError(t, err)
+	assert.Contains(t, cfg.Contexts, "eu-prod")
+
+	_, err = Fetch(context.Background(), server.URL+"/missing.yaml")
+	assert.ErrorContains(t, err, "status 404")
+
+	path := filepath.Join(t.TempDir(), "golden.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(goldenYAML), 0600))
+	cfg, err = Fetch(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, "apps", cfg.Contexts["eu-prod"].Namespace)
+
+	_, err = Fetch(context.Background(), "s3://bucket-only")
+	assert.ErrorContains(t, err, "expected s3://bucket/key")
+	_, err = Fetch(context.Background(), "git+https://example.com/repo.git")
+	assert.ErrorContains(t, err, "expected git+URL//path")
+}
+
+func TestCutPath(t *testing.T) {
+	repo, path, ok := cutPath("https://example.com/team/repo.git//clusters/kubeconfig.yaml")
+	require.True(t, ok)
+	assert.Equal(t, "https://example.com/team/repo.git", repo)
+	assert.Equal(t, "clusters/kubeconfig.yaml", path)
+
+	_, _, ok = cutPath("https://example.com/team/repo.git")
+	assert.False(t, ok)
+}
+
+// newLocal returns a kubeconfig with the Rancher entry "prod" holding this user's token
+func newLocal(t *testing.T) *api.Config {
+	t.Helper()
+	local := api.NewConfig()
+	local.Clusters["prod"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-prod"}
+	local.Contexts["prod"] = &api.Context{Cluster: "prod", AuthInfo: "prod"}
+	local.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-me:secret"}
+	require.NoError(t, kubeconfig.SetMetadata(local, "prod", kubeconfig.NewMetadata("https://rancher.example.com", "c-prod", time.Now())))
+	return local
+}
+
+func TestMerge(t *testing.T) {
+	local := newLocal(t)
+	local.Clusters["manual"] = &api.Cluster{Server: "https://manual.example.com"}
+	local.Contexts["manual"] = &api.Context{Cluster: "manual", AuthInfo: "prod"}
+	golden := api.NewConfig()
+	golden.Clusters["prod"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-prod"}
+	golden.Clusters["dev"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-dev"}
+	golden.Clusters["manual"] = &api.Cluster{Server: "https://other.example.com"}
+	golden.Contexts["eu-prod"] = &api.Context{Cluster: "prod", AuthInfo: "golden-user", Namespace: "apps"}
+	golden.Contexts["dev"] = &api.Context{Cluster: "dev", AuthInfo: "dev"}
+	golden.Contexts["manual"] = &api.Context{Cluster: "manual", AuthInfo: "prod"}
+	golden.Contexts["broken"] = &api.Context{Cluster: "gone", AuthInfo: "prod"}
+	golden.AuthInfos["golden-user"] = &api.AuthInfo{Token: "must-not-be-used"}
+
+	diff := Merge(local, golden, "https://example.com/kubeconfig.yaml")
+
+	assert.Equal(t, []string{"eu-prod"}, diff.Added)
+	assert.Empty(t, diff.Updated)
+	assert.Equal(t, []Skip{
+		{Context: "broken", Reason: SkipMissingCluster},
+		{Context: "dev", Reason: SkipNoCredentials},
+		{Context: "manual", Reason: SkipNameTaken},
+	}, diff.Skipped)
+	assert.Equal(t, "prod", local.Contexts["eu-prod"].AuthInfo, "the golden context uses the local token of its server")
+	assert.Equal(t, "apps", local.Contexts["eu-prod"].Namespace)
+	assert.NotContains(t, local.AuthInfos, "golden-user")
+	assert.Equal(t, "https://manual.example.com", local.Clusters["manual"].Server)
+	assert.True(t, kubeconfig.IsManaged(local, "prod"), "the Rancher metadata of a shared cluster is kept")
+
+	// Merging again changes nothing
+	diff = Merge(local, golden, "https://example.com/kubeconfig.yaml")
+	assert.False(t, diff.Changed())
+
+	// Renamed contexts replace the old ones, Rancher entries stay
+	delete(golden.Contexts, "eu-prod")
+	golden.Contexts["prod-eu"] = &api.Context{Cluster: "prod", AuthInfo: "golden-user"}
+	golden.Contexts["prod"] = &api.Context{Cluster: "prod", AuthInfo: "prod", Namespace: "default"}
+	diff = Merge(local, golden, "https://example.com/kubeconfig.yaml")
+	assert.Equal(t, []string{"prod-eu"}, diff.Added)
+	assert.Equal(t, []string{"prod"}, diff.Updated)
+	assert.Equal(t, []string{"eu-prod"}, diff.Removed)
+	assert.NotContains(t, local.Contexts, "eu-prod")
+	assert.Equal(t, "default", local.Contexts["prod"].Namespace)
+
+	// Once golden drops it, the Rancher context loses only the marker
+	delete(golden.Contexts, "prod")
+	diff = Merge(local, golden, "https://example.com/kubeconfig.yaml")
+	assert.Empty(t, diff.Removed)
+	require.Contains(t, local.Contexts, "prod")
+	assert.NotContains(t, local.Contexts["prod"].Extensions, ExtensionName)
+}
+
+func TestMerge_KeepsUnmanagedEntries(t *testing.T) {
+	local := newLocal(t)
+	// A golden context copied by hand keeps the marker, but not the tool's managedBy
+	local.Clusters["copied"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-prod",
+		Extensions: map[string]runtime.Object{ExtensionName: &runtime.Unknown{Raw: []byte(`{"source": "old"}`)}}}
+	local.Contexts["copied"] = &api.Context{Cluster: "copied", AuthInfo: "prod",
+		Extensions: map[string]runtime.Object{ExtensionName: &runtime.Unknown{Raw: []byte(`{"source": "old"}`)}}}
+
+	diff := Merge(local, api.NewConfig(), "https://example.com/kubeconfig.yaml")
+	assert.Empty(t, diff.Removed)
+	assert.Contains(t, local.Contexts, "copied")
+	assert.Contains(t, local.Clusters, "copied")
+}
@@ -0,0 +1,231 @@
+package golden
+
+import (
+	"encoding/json"
+	"maps"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"reflect"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ExtensionName is the name of the extension that marks the clusters and contexts written
+// from the golden kubeconfig, so they are removed again once the golden kubeconfig drops them
+const ExtensionName = "rancher-kubeconfig-updater-golden"
+
+// Reasons of golden contexts that are not merged
+const (
+	// SkipNoCredentials is the reason of contexts whose cluster has no local user with a token
+	SkipNoCredentials = "no_local_credentials"
+	// SkipNameTaken is the reason of contexts whose name is used by an entry the tool didn't create
+	SkipNameTaken = "name_taken"
+	// SkipMissingCluster is the reason of contexts referring to a cluster the golden kubeconfig lacks
+	SkipMissingCluster = "missing_cluster"
+)
+
+// Skip describes a golden context that was not merged.
+type Skip struct {
+	Context string
+	Reason  string
+}
+
+// Diff lists the contexts a merge added, changed and removed.
+type Diff struct {
+	Added   []string
+	Updated []string
+	Removed []string
+	Skipped []Skip
+}
+
+// Changed reports whether the merge changed the kubeconfig.
+func (d Diff) Changed() bool {
+	return len(d.Added)+len(d.Updated)+len(d.Removed) > 0
+}
+
+// marker is stored in the ExtensionName extension. Its managedBy lets the entry be removed
+// again, see kubeconfig.HasManagedBy.
+type marker struct {
+	ManagedBy string `json:"managedBy"`
+	Source    string `json:"source"`
+}
+
+// Merge writes the clusters and contexts of golden into local. Users and their tokens are
+// never taken from golden: each context uses the local user of an entry with the same server,
+// or the local user the golden context names. Entries the tool didn't create are never
+// replaced, and contexts merged from an earlier golden kubeconfig that golden no longer has
+// are removed along with their clusters. source is recorded in the merged entries.
+func Merge(local, golden *api.Config, source string) Diff {
+	var diff Diff
+	if local.Clusters == nil {
+		local.Clusters = make(map[string]*api.Cluster)
+	}
+	if local.Contexts == nil {
+		local.Contexts = make(map[string]*api.Context)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(golden.Contexts)) {
+		gctx := golden.Contexts[name]
+		gcluster, ok := golden.Clusters[gctx.Cluster]
+		if !ok || gcluster == nil {
+			diff.Skipped = append(diff.Skipped, Skip{Context: name, Reason: SkipMissingCluster})
+			continue
+		}
+		if !owned(local, name, local.Contexts[name] != nil, contextExtensions(local, name)) ||
+			!owned(local, gctx.Cluster, local.Clusters[gctx.Cluster] != nil, clusterExtensions(local, gctx.Cluster)) {
+			diff.Skipped = append(diff.Skipped, Skip{Context: name, Reason: SkipNameTaken})
+			continue
+		}
+		user, ok := localUser(local, name, gctx.AuthInfo, gcluster.Server)
+		if !ok {
+			diff.Skipped = append(diff.Skipped, Skip{Context: name, Reason: SkipNoCredentials})
+			continue
+		}
+
+		cluster := gcluster.DeepCopy()
+		cluster.Extensions = withMarker(clusterExtensions(local, gctx.Cluster), source)
+		ctx := &api.Context{
+			Cluster:    gctx.Cluster,
+			AuthInfo:   user,
+			Namespace:  gctx.Namespace,
+			Extensions: withMarker(contextExtensions(local, name), source),
+		}
+
+		existing, exists := local.Contexts[name]
+		changed := !exists || !sameCluster(local.Clusters[gctx.Cluster], cluster) || !sameContext(existing, ctx)
+		local.Clusters[gctx.Cluster] = cluster
+		local.Contexts[name] = ctx
+		switch {
+		case !exists:
+			diff.Added = append(diff.Added, name)
+		case changed:
+			diff.Updated = append(diff.Updated, name)
+		}
+	}
+
+	// Contexts and clusters from an earlier golden kubeconfig that it no longer has
+	for _, name := range slices.Sorted(maps.Keys(local.Contexts)) {
+		if _, ok := golden.Contexts[name]; ok || !hasMarker(local.Contexts[name].Extensions) {
+			continue
+		}
+		if kubeconfig.IsManaged(local, name) {
+			// A Rancher entry stays, it is just no longer maintained from golden
+			delete(local.Contexts[name].Extensions, ExtensionName)
+			continue
+		}
+		if kubeconfig.RemoveContext(local, name) {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	for name, cluster := range local.Clusters {
+		if cluster == nil || !hasMarker(cluster.Extensions) || referenced(local, name) {
+			continue
+		}
+		if _, ok := golden.Clusters[name]; ok || kubeconfig.IsManaged(local, name) {
+			continue
+		}
+		kubeconfig.RemoveCluster(local, name)
+	}
+	return diff
+}
+
+// owned reports whether an entry may be written from golden: it doesn't exist yet, or it was
+// created by the tool or by an earlier merge
+func owned(local *api.Config, name string, exists bool, extensions map[string]runtime.Object) bool {
+	return !exists || hasMarker(extensions) || kubeconfig.IsManaged(local, name)
+}
+
+// localUser finds the local user for a golden context: the user of the local context with the
+// same name or another one with the same server, or else the user the golden context names
+func localUser(local *api.Config, name, goldenUser, server string) (string, bool) {
+	hasToken := func(user string) bool {
+		info, ok := local.AuthInfos[user]
+		return ok && info != nil && (info.Token != "" || info.Exec != nil || info.TokenFile != "")
+	}
+	server = strings.TrimSuffix(server, "/")
+	sameServer := func(ctxName string) (string, bool) {
+		ctx := local.Contexts[ctxName]
+		if ctx == nil || !hasToken(ctx.AuthInfo) {
+			return "", false
+		}
+		cluster := local.Clusters[ctx.Cluster]
+		return ctx.AuthInfo, cluster != nil && strings.TrimSuffix(cluster.Server, "/") == server
+	}
+
+	if user, ok := sameServer(name); ok {
+		return user, true
+	}
+	for _, ctxName := range slices.Sorted(maps.Keys(local.Contexts)) {
+		if user, ok := sameServer(ctxName); ok {
+			return user, true
+		}
+	}
+	if hasToken(goldenUser) {
+		return goldenUser, true
+	}
+	return "", false
+}
+
+// referenced reports whether a context of c uses the cluster named name
+func referenced(c *api.Config, name string) bool {
+	for _, ctx := range c.Contexts {
+		if ctx != nil && ctx.Cluster == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sameCluster compares two clusters, ignoring their extensions
+func sameCluster(a, b *api.Cluster) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	a, b = a.DeepCopy(), b.DeepCopy()
+	a.Extensions, b.Extensions = nil, nil
+	a.LocationOfOrigin, b.LocationOfOrigin = "", ""
+	return reflect.DeepEqual(a, b)
+}
+
+// sameContext compares two contexts, ignoring their extensions
+func sameContext(a, b *api.Context) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cluster == b.Cluster && a.AuthInfo == b.AuthInfo && a.Namespace == b.Namespace
+}
+
+// contextExtensions returns the extensions of the local context named name, if any
+func contextExtensions(c *api.Config, name string) map[string]runtime.Object {
+	if ctx := c.Contexts[name]; ctx != nil {
+		return ctx.Extensions
+	}
+	return nil
+}
+
+// clusterExtensions returns the extensions of the local cluster named name, if any
+func clusterExtensions(c *api.Config, name string) map[string]runtime.Object {
+	if cluster := c.Clusters[name]; cluster != nil {
+		return cluster.Extensions
+	}
+	return nil
+}
+
+// withMarker returns a copy of extensions with the golden marker for source
+func withMarker(extensions map[string]runtime.Object, source string) map[string]runtime.Object {
+	merged := maps.Clone(extensions)
+	if merged == nil {
+		merged = make(map[string]runtime.Object)
+	}
+	raw, _ := json.Marshal(marker{ManagedBy: kubeconfig.ExtensionName, Source: source})
+	merged[ExtensionName] = &runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}
+	return merged
+}
+
+// hasMarker reports whether extensions carry the golden marker
+func hasMarker(extensions map[string]runtime.Object) bool {
+	_, ok := extensions[ExtensionName]
+	return ok
+}
@@ -0,0 +1,181 @@
+// Package grafana serves token expiry data to Grafana dashboards, both in the protocol of
+// the SimpleJSON (JSON API) datasource and as a plain JSON document for the Infinity datasource.
+package grafana
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"rancher-kubeconfig-updater/internal/status"
+)
+
+// MetricDaysToExpiry is the metric offered to the SimpleJSON datasource
+const MetricDaysToExpiry = "days_to_expiry"
+
+// Source returns the latest token statuses and when they were collected.
+type Source func() (entries []status.Entry, collected time.Time)
+
+// Handler serves the datasource endpoints:
+//
+//	GET  /             connection test of the SimpleJSON datasource
+//	POST /search       the available metrics
+//	POST /query        days to expiry per cluster, as time series or a table
+//	POST /annotations  no annotations
+//	GET  /expiry       all clusters as a JSON array, for the Infinity datasource
+type Handler struct {
+	mux    *http.ServeMux
+	source Source
+	now    func() time.Time
+}
+
+// NewHandler returns a handler serving the statuses returned by source.
+func NewHandler(source Source) *Handler {
+	h := &Handler{mux: http.NewServeMux(), source: source, now: time.Now}
+	h.mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h.mux.HandleFunc("POST /search", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []string{MetricDaysToExpiry})
+	})
+	h.mux.HandleFunc("POST /query", h.query)
+	h.mux.HandleFunc("POST /annotations", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []any{})
+	})
+	h.mux.HandleFunc("GET /expiry", h.expiry)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// row is one cluster of the /expiry document
+type row struct {
+	Context   string `json:"cluster"`
+	ClusterID string `json:"clusterId"`
+	Owner     string `json:"owner,omitempty"`
+	// ExpiresAt and DaysToExpiry are null for tokens that never expire or whose expiry is unknown
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	DaysToExpiry *float64   `json:"daysToExpiry"`
+	NeverExpires bool       `json:"neverExpires"`
+	LastRotated  *time.Time `json:"lastRotated"`
+	Error        string     `json:"error,omitempty"`
+	Collected    time.Time  `json:"collected"`
+}
+
+func (h *Handler) rows() []row {
+	entries, collected := h.source()
+	now := h.now()
+	rows := make([]row, 0, len(entries))
+	for _, e := range entries {
+		r := row{
+			Context:      e.Context,
+			ClusterID:    e.ClusterID,
+			Owner:        e.Owner,
+			NeverExpires: e.NeverExpires,
+			Error:        e.Error,
+			Collected:    collected.UTC(),
+		}
+		if !e.ExpiresAt.IsZero() {
+			expiresAt := e.ExpiresAt.UTC()
+			days := daysBetween(now, expiresAt)
+			r.ExpiresAt, r.DaysToExpiry = &expiresAt, &days
+		}
+		if !e.LastRotated.IsZero() {
+			lastRotated := e.LastRotated.UTC()
+			r.LastRotated = &lastRotated
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+func (h *Handler) expiry(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.rows())
+}
+
+// queryRequest is the part of a SimpleJSON query the handler uses
+type queryRequest struct {
+	Targets []struct {
+		Target string `json:"target"`
+		Type   string `json:"type"`
+	} `json:"targets"`
+}
+
+type timeSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type column struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type table struct {
+	Type    string   `json:"type"`
+	Columns []column `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+// query answers every days_to_expiry target with one series per cluster holding the current
+// days to expiry, or with a table of all clusters when the panel asks for one. Tokens that
+// never expire or whose expiry is unknown have no series.
+func (h *Handler) query(w http.ResponseWriter, r *http.Request) {
+	var req queryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows := h.rows()
+	timestamp := float64(h.now().UnixMilli())
+	results := []any{}
+	for _, target := range req.Targets {
+		if target.Target != MetricDaysToExpiry {
+			continue
+		}
+		if target.Type == "table" {
+			t := table{
+				Type: "table",
+				Columns: []column{
+					{"Cluster", "string"}, {"Cluster ID", "string"}, {"Owner", "string"},
+					{"Expires", "time"}, {"Days to expiry", "number"}, {"Last rotated", "time"},
+				},
+				Rows: [][]any{},
+			}
+			for _, r := range rows {
+				t.Rows = append(t.Rows, []any{r.Context, r.ClusterID, r.Owner, millis(r.ExpiresAt), r.DaysToExpiry, millis(r.LastRotated)})
+			}
+			results = append(results, t)
+			continue
+		}
+		for _, r := range rows {
+			if r.DaysToExpiry != nil {
+				results = append(results, timeSeries{Target: r.Context, Datapoints: [][2]float64{{*r.DaysToExpiry, timestamp}}})
+			}
+		}
+	}
+	writeJSON(w, results)
+}
+
+// daysBetween returns the days from now until t, rounded to hundredths
+func daysBetween(now, t time.Time) float64 {
+	days := t.Sub(now).Hours() / 24
+	return math.Round(days*100) / 100
+}
+
+// millis returns t as Unix milliseconds, the time format of SimpleJSON tables, or nil
+func millis(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixMilli()
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,101 @@
+package grafana
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"rancher-kubeconfig-updater/internal/status"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	now       = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	collected = now.Add(-time.Hour)
+)
+
+func newTestHandler() *Handler {
+	h := NewHandler(func() ([]status.Entry, time.Time) {
+		return []status.Entry{
+			{Context: "prod", ClusterID: "c-m-prod", Owner: "platform", ExpiresAt: now.Add(36 * time.Hour), LastRotated: now.Add(-24 * time.Hour)},
+			{Context: "dev", ClusterID: "c-m-dev", NeverExpires: true},
+			{Context: "old", ClusterID: "c-m-old", Error: "token not found in Rancher"},
+		}, collected
+	})
+	h.now = func() time.Time { return now }
+	return h
+}
+
+func serve(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+func TestHandler_Health(t *testing.T) {
+	assert.Equal(t, http.StatusOK, serve(t, newTestHandler(), http.MethodGet, "/", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(t, newTestHandler(), http.MethodGet, "/unknown", "").Code)
+}
+
+func TestHandler_Search(t *testing.T) {
+	rec := serve(t, newTestHandler(), http.MethodPost, "/search", `{"target":""}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `["days_to_expiry"]`, rec.Body.String())
+}
+
+func TestHandler_QueryTimeSeries(t *testing.T) {
+	rec := serve(t, newTestHandler(), http.MethodPost, "/query",
+		`{"range":{"from":"2026-02-28T12:00:00Z","to":"2026-03-01T12:00:00Z"},"targets":[{"target":"days_to_expiry","type":"timeserie"},{"target":"other"}]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"target":"prod","datapoints":[[1.5,1772366400000]]}]`, rec.Body.String())
+}
+
+func TestHandler_QueryTable(t *testing.T) {
+	rec := serve(t, newTestHandler(), http.MethodPost, "/query", `{"targets":[{"target":"days_to_expiry","type":"table"}]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var tables []struct {
+		Type    string  `json:"type"`
+		Columns []any   `json:"columns"`
+		Rows    [][]any `json:"rows"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tables))
+	require.Len(t, tables, 1)
+	assert.Equal(t, "table", tables[0].Type)
+	assert.Len(t, tables[0].Columns, 6)
+	require.Len(t, tables[0].Rows, 3)
+	assert.Equal(t, []any{"prod", "c-m-prod", "platform", float64(now.Add(36 * time.Hour).UnixMilli()), 1.5, float64(now.Add(-24 * time.Hour).UnixMilli())}, tables[0].Rows[0])
+	assert.Equal(t, []any{"dev", "c-m-dev", "", nil, nil, nil}, tables[0].Rows[1])
+}
+
+func TestHandler_QueryInvalid(t *testing.T) {
+	assert.Equal(t, http.StatusBadRequest, serve(t, newTestHandler(), http.MethodPost, "/query", "{").Code)
+}
+
+func TestHandler_Annotations(t *testing.T) {
+	rec := serve(t, newTestHandler(), http.MethodPost, "/annotations", `{}`)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+}
+
+func TestHandler_Expiry(t *testing.T) {
+	rec := serve(t, newTestHandler(), http.MethodGet, "/expiry", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `[
+		{"cluster":"prod","clusterId":"c-m-prod","owner":"platform","expiresAt":"2026-03-03T00:00:00Z","daysToExpiry":1.5,"neverExpires":false,"lastRotated":"2026-02-28T12:00:00Z","collected":"2026-03-01T11:00:00Z"},
+		{"cluster":"dev","clusterId":"c-m-dev","expiresAt":null,"daysToExpiry":null,"neverExpires":true,"lastRotated":null,"collected":"2026-03-01T11:00:00Z"},
+		{"cluster":"old","clusterId":"c-m-old","expiresAt":null,"daysToExpiry":null,"neverExpires":false,"lastRotated":null,"error":"token not found in Rancher","collected":"2026-03-01T11:00:00Z"}
+	]`, rec.Body.String())
+}
+
+func TestHandler_ExpiryBeforeFirstCollection(t *testing.T) {
+	h := NewHandler(func() ([]status.Entry, time.Time) { return nil, time.Time{} })
+	rec := serve(t, h, http.MethodGet, "/expiry", "")
+	assert.JSONEq(t, `[]`, rec.Body.String())
+}
@@ -0,0 +1,223 @@
+// Package history keeps a report of each run next to the state file, so past outcomes can be
+// looked up without digging through logs.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/plan"
+	"sync"
+	"time"
+)
+
+// FileName is the name of the history file in the state directory
+const FileName = "history.jsonl"
+
+// Keep is the number of runs the history file keeps; older runs are dropped
+const Keep = 200
+
+// Outcomes of a run
+const (
+	OutcomeSucceeded = "succeeded"
+	// OutcomePartial means errors occurred but some clusters were processed and saved
+	OutcomePartial = "partial"
+	OutcomeFailed  = "failed"
+)
+
+// Results of a cluster in a run
+const (
+	ResultUpdated = "updated"
+	ResultCreated = "created"
+	ResultPruned  = "pruned"
+	ResultSkipped = "skipped"
+	ResultFailed  = "failed"
+)
+
+// Run is the report of one run
+type Run struct {
+	ID         string    `json:"id"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	DryRun     bool      `json:"dryRun,omitempty"`
+	Kubeconfig string    `json:"kubeconfig,omitempty"`
+	Servers    []string  `json:"servers,omitempty"`
+	Outcome    string    `json:"outcome"`
+	// Saved is set when the kubeconfig was written
+	Saved    bool      `json:"saved"`
+	Clusters []Cluster `json:"clusters"`
+	// Errors are the errors logged during the run, also those not tied to a cluster
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Cluster is the result of one cluster in a run. Token names are recorded, never the secrets.
+type Cluster struct {
+	Cluster      string `json:"cluster"`
+	ClusterID    string `json:"clusterId,omitempty"`
+	Result       string `json:"result"`
+	Reason       string `json:"reason,omitempty"`
+	OldTokenName string `json:"oldTokenName,omitempty"`
+	NewTokenName string `json:"newTokenName,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Recorder collects the report of a run while it happens. All methods are safe for concurrent
+// use and on a nil *Recorder, which records nothing.
+type Recorder struct {
+	mu  sync.Mutex
+	run Run
+}
+
+// NewRecorder starts the report of the run id.
+func NewRecorder(id string, startedAt time.Time, dryRun bool) *Recorder {
+	return &Recorder{run: Run{ID: id, StartedAt: startedAt, DryRun: dryRun}}
+}
+
+// SetKubeconfig records where the run writes the kubeconfig.
+func (r *Recorder) SetKubeconfig(ref string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Kubeconfig = ref
+}
+
+// AddServer records a Rancher server the run works with.
+func (r *Recorder) AddServer(url string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Servers = append(r.run.Servers, url)
+}
+
+// Fail records a cluster that could not be processed.
+func (r *Recorder) Fail(cluster, clusterID string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Clusters = append(r.run.Clusters, Cluster{Cluster: cluster, ClusterID: clusterID, Result: ResultFailed, Error: err.Error()})
+}
+
+// Error records an error logged during the run.
+func (r *Recorder) Error(message string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Errors = append(r.run.Errors, message)
+}
+
+// Saved records that the kubeconfig was written.
+func (r *Recorder) Saved() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Saved = true
+}
+
+// Finish returns the report with the clusters of p, which recorded the changes and skipped
+// clusters of the run, and the outcome. p must no longer change.
+func (r *Recorder) Finish(p *plan.Plan, finishedAt time.Time) Run {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run := r.run
+	run.FinishedAt = finishedAt
+	run.Clusters = append(clustersOf(p), run.Clusters...)
+
+	processed := 0
+	for _, c := range run.Clusters {
+		if c.Result != ResultFailed {
+			processed++
+		}
+	}
+	switch {
+	case len(run.Errors) == 0 && processed == len(run.Clusters):
+		run.Outcome = OutcomeSucceeded
+	case processed > 0 && (run.Saved || run.DryRun):
+		run.Outcome = OutcomePartial
+	default:
+		run.Outcome = OutcomeFailed
+	}
+	return run
+}
+
+// clustersOf returns the clusters recorded in p. p must no longer change.
+func clustersOf(p *plan.Plan) []Cluster {
+	clusters := []Cluster{}
+	if p == nil {
+		return clusters
+	}
+	for _, c := range p.UpdatedTokens {
+		clusters = append(clusters, Cluster{Cluster: c.Context, ClusterID: c.ClusterID, Result: ResultUpdated, Reason: c.Reason,
+			OldTokenName: c.OldTokenName, NewTokenName: c.NewTokenName})
+	}
+	for _, c := range p.AddedContexts {
+		clusters = append(clusters, Cluster{Cluster: c.Context, ClusterID: c.ClusterID, Result: ResultCreated, Reason: "new_context"})
+	}
+	for _, c := range p.PrunedEntries {
+		clusters = append(clusters, Cluster{Cluster: c.Context, ClusterID: c.ClusterID, Result: ResultPruned})
+	}
+	for _, s := range p.Skipped {
+		clusters = append(clusters, Cluster{Cluster: s.Context, Result: ResultSkipped, Reason: s.Reason})
+	}
+	return clusters
+}
+
+// PathFor returns the history file in the directory of the state file statePath.
+func PathFor(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), FileName)
+}
+
+// Load reads the runs of the history file at path, oldest first. A missing file has no runs.
+func Load(path string) ([]Run, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+	var runs []Run
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, fmt.Errorf("failed to parse history file %s line %d: %w", path, line, err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
+
+// Encode returns runs as the content of a history file, keeping only the last Keep runs.
+func Encode(runs []Run) ([]byte, error) {
+	if len(runs) > Keep {
+		runs = runs[len(runs)-Keep:]
+	}
+	var buf bytes.Buffer
+	for _, run := range runs {
+		line, err := json.Marshal(run)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode run %s: %w", run.ID, err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
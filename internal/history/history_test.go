@@ -0,0 +1,119 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/plan"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_Finish(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	r := NewRecorder("0123456789ab", start, false)
+	r.SetKubeconfig("/home/dev/.kube/config")
+	r.AddServer("https://rancher.example.com")
+	p := plan.New(false)
+	p.UpdateToken("prod", "c-prod", "kubeconfig-u-old:secret", "kubeconfig-u-new:secret", "expiring_soon")
+	p.Skip("staging", "token_valid")
+	r.Fail("dev", "c-dev", errors.New("403 Forbidden"))
+	r.Saved()
+
+	run := r.Finish(p, start.Add(time.Minute))
+	assert.Equal(t, "0123456789ab", run.ID)
+	assert.Equal(t, start.Add(time.Minute), run.FinishedAt)
+	assert.Equal(t, "/home/dev/.kube/config", run.Kubeconfig)
+	assert.Equal(t, []string{"https://rancher.example.com"}, run.Servers)
+	assert.Equal(t, OutcomePartial, run.Outcome)
+	assert.Equal(t, []Cluster{
+		{Cluster: "prod", ClusterID: "c-prod", Result: ResultUpdated, Reason: "expiring_soon", OldTokenName: "kubeconfig-u-old", NewTokenName: "kubeconfig-u-new"},
+		{Cluster: "staging", Result: ResultSkipped, Reason: "token_valid"},
+		{Cluster: "dev", ClusterID: "c-dev", Result: ResultFailed, Error: "403 Forbidden"},
+	}, run.Clusters)
+}
+
+func TestRecorder_Outcome(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(r *Recorder, p *plan.Plan)
+		dryRun bool
+		want   string
+	}{
+		{"nothing to do", func(r *Recorder, p *plan.Plan) { r.Saved() }, false, OutcomeSucceeded},
+		{"all updated", func(r *Recorder, p *plan.Plan) {
+			p.AddContext("prod", "c-prod")
+			r.Saved()
+		}, false, OutcomeSucceeded},
+		{"login failed", func(r *Recorder, p *plan.Plan) { r.Error("Failed to log in: 401 Unauthorized") }, false, OutcomeFailed},
+		{"some failed and saved", func(r *Recorder, p *plan.Plan) {
+			p.Skip("prod", "token_valid")
+			r.Fail("dev", "c-dev", errors.New("timeout"))
+			r.Saved()
+		}, false, OutcomePartial},
+		{"some failed, nothing saved", func(r *Recorder, p *plan.Plan) {
+			p.Skip("prod", "token_valid")
+			r.Fail("dev", "c-dev", errors.New("timeout"))
+		}, false, OutcomeFailed},
+		{"some failed in a dry run", func(r *Recorder, p *plan.Plan) {
+			p.Skip("prod", "token_valid")
+			r.Fail("dev", "c-dev", errors.New("timeout"))
+		}, true, OutcomePartial},
+		{"all failed", func(r *Recorder, p *plan.Plan) {
+			r.Fail("dev", "c-dev", errors.New("timeout"))
+			r.Saved()
+		}, false, OutcomeFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRecorder("run", time.Now(), tt.dryRun)
+			p := plan.New(tt.dryRun)
+			tt.record(r, p)
+			assert.Equal(t, tt.want, r.Finish(p, time.Now()).Outcome)
+		})
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var r *Recorder
+	assert.NotPanics(t, func() {
+		r.SetKubeconfig("config")
+		r.AddServer("https://rancher.example.com")
+		r.Fail("dev", "c-dev", errors.New("timeout"))
+		r.Error("failed")
+		r.Saved()
+	})
+}
+
+func TestLoadEncode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	runs, err := Load(path)
+	require.NoError(t, err, "a missing history has no runs")
+	assert.Empty(t, runs)
+
+	for i := 0; i < Keep+5; i++ {
+		runs = append(runs, Run{ID: fmt.Sprint(i), Outcome: OutcomeSucceeded, Clusters: []Cluster{}})
+	}
+	data, err := Encode(runs)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, loaded, Keep, "only the last runs are kept")
+	assert.Equal(t, "5", loaded[0].ID)
+	assert.Equal(t, fmt.Sprint(Keep+4), loaded[Keep-1].ID)
+
+	require.NoError(t, os.WriteFile(path, []byte("{\"id\":\"1\"}\nnot json\n"), 0600))
+	_, err = Load(path)
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestPathFor(t *testing.T) {
+	assert.Equal(t, filepath.Join("cache", "rancher-kubeconfig-updater", FileName),
+		PathFor(filepath.Join("cache", "rancher-kubeconfig-updater", "state.json")))
+}
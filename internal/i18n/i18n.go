@@ -0,0 +1,212 @@
+// Package i18n translates user-facing console output such as prompts and reports.
+// Structured logs are not translated, so they stay searchable and machine-readable.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Language identifies a supported output language.
+type Language string
+
+const (
+	English            Language = "en"
+	TraditionalChinese Language = "zh-TW"
+)
+
+// Key identifies a translatable message.
+type Key string
+
+const (
+	PromptPassword     Key = "prompt.password"
+	PromptYesNo        Key = "prompt.yes_no"
+	PromptBrowserLogin Key = "prompt.browser_login"
+	PromptOIDCLogin    Key = "prompt.oidc_login"
+	PromptRemoteLogin  Key = "prompt.remote_login"
+	PromptDeviceCode   Key = "prompt.device_code"
+	PromptPassphrase   Key = "prompt.passphrase"
+	ConfirmOverwrite   Key = "confirm.overwrite"
+	SelectNewClusters  Key = "select.new_clusters"
+	PromptSelection    Key = "prompt.selection"
+	SelectionInvalid   Key = "select.invalid"
+	AuditNoFindings    Key = "audit.no_findings"
+	AuditSummary       Key = "audit.summary"
+	SnapshotRestored   Key = "snapshot.restored"
+	SnapshotMissing    Key = "snapshot.missing"
+	ListEmpty          Key = "list.empty"
+	ListHeader         Key = "list.header"
+	ListYes            Key = "list.yes"
+	ListNo             Key = "list.no"
+	ListUnknown        Key = "list.unknown"
+	ListNever          Key = "list.never"
+	TrayRefresh        Key = "tray.refresh"
+	TrayRefreshHint    Key = "tray.refresh_hint"
+	TrayQuit           Key = "tray.quit"
+	TrayQuitHint       Key = "tray.quit_hint"
+	TrayRefreshing     Key = "tray.refreshing"
+	TrayStatusFailed   Key = "tray.status_failed"
+	TrayEarliest       Key = "tray.earliest"
+	TrayExpired        Key = "tray.expired"
+	TrayExpiredTitle   Key = "tray.expired_title"
+	TrayUnknownCount   Key = "tray.unknown_count"
+	TrayAllUnknown     Key = "tray.all_unknown"
+	TrayNoEntries      Key = "tray.no_entries"
+	TrayNeverExpires   Key = "tray.never_expires"
+	TrayRefreshFailed  Key = "tray.refresh_failed"
+	TrayClustersFailed Key = "tray.clusters_failed"
+	TrayRunOutcome     Key = "tray.run_outcome"
+)
+
+// catalog holds the messages per language; English must contain every key
+var catalog = map[Language]map[Key]string{
+	English: {
+		PromptPassword:     "Enter Rancher Password: ",
+		PromptYesNo:        "%s [y/N]: ",
+		PromptBrowserLogin: "Log in to Rancher in your browser to continue. If it did not open, visit:\n  %s\n",
+		PromptOIDCLogin:    "Log in with your identity provider in your browser to continue. If it did not open, visit:\n  %s\n",
+		PromptRemoteLogin:  "Open this address in a browser on any device and log in to Rancher to continue:\n  %s\n",
+		PromptDeviceCode:   "On a device with a browser, open %s and enter the code %s to continue.\n",
+		PromptPassphrase:   "Enter snapshot passphrase: ",
+		ConfirmOverwrite:   "Kubeconfig entry %q was modified since the last run. Overwrite it?",
+		SelectNewClusters:  "Found %d clusters without a kubeconfig entry:",
+		PromptSelection:    "Add which clusters? Numbers such as 1,3-5, 'all' or 'none' [none]: ",
+		SelectionInvalid:   "Invalid selection: %v",
+		AuditNoFindings:    "No findings: kubeconfig matches Rancher",
+		AuditSummary:       "%d findings (high: %d, medium: %d, low: %d)",
+		SnapshotRestored:   "Restored %d clusters from the snapshot of %s taken at %s",
+		SnapshotMissing:    "Not in the snapshot: %v",
+		ListEmpty:          "No clusters found in Rancher",
+		ListHeader:         "CLUSTER\tID\tVERSION\tPROVIDER\tNODES\tIN KUBECONFIG\tCONTEXT\tEXPIRES\tDAYS LEFT\tDESCRIPTION",
+		ListYes:            "yes",
+		ListNo:             "no",
+		ListUnknown:        "unknown",
+		ListNever:          "never",
+		TrayRefresh:        "Refresh now",
+		TrayRefreshHint:    "Refresh the Rancher tokens now",
+		TrayQuit:           "Quit",
+		TrayQuitHint:       "Stop refreshing the Rancher tokens",
+		TrayRefreshing:     "Refreshing Rancher tokens",
+		TrayStatusFailed:   "Rancher token expiry unknown: %v",
+		TrayEarliest:       "Earliest Rancher token expiry: %s in %d days (%s)",
+		TrayExpired:        "The Rancher token of %s expired at %s",
+		TrayExpiredTitle:   "expired",
+		TrayUnknownCount:   "expiry unknown for %d contexts",
+		TrayAllUnknown:     "Rancher token expiry unknown for %d contexts",
+		TrayNoEntries:      "No Rancher entries found in the kubeconfig",
+		TrayNeverExpires:   "No Rancher token expires",
+		TrayRefreshFailed:  "Rancher token refresh failed",
+		TrayClustersFailed: "%d clusters failed: %s",
+		TrayRunOutcome:     "The run %s",
+	},
+	TraditionalChinese: {
+		PromptPassword:     "請輸入 Rancher 密碼：",
+		PromptYesNo:        "%s [y/N]：",
+		PromptBrowserLogin: "請在瀏覽器中登入 Rancher 以繼續。若瀏覽器沒有自動開啟，請前往：\n  %s\n",
+		PromptOIDCLogin:    "請在瀏覽器中登入身分提供者以繼續。若瀏覽器沒有自動開啟，請前往：\n  %s\n",
+		PromptRemoteLogin:  "請在任一裝置的瀏覽器中開啟此網址並登入 Rancher 以繼續：\n  %s\n",
+		PromptDeviceCode:   "請在有瀏覽器的裝置上開啟 %s 並輸入代碼 %s 以繼續。\n",
+		PromptPassphrase:   "請輸入快照密語：",
+		ConfirmOverwrite:   "Kubeconfig 項目 %q 在上次執行後已被修改，是否覆寫？",
+		SelectNewClusters:  "找到 %d 個沒有 kubeconfig 項目的叢集：",
+		PromptSelection:    "要新增哪些叢集？輸入編號（例如 1,3-5）、'all' 或 'none' [none]：",
+		SelectionInvalid:   "選擇無效：%v",
+		AuditNoFindings:    "沒有發現問題：kubeconfig 與 Rancher 一致",
+		AuditSummary:       "共 %d 項發現（高：%d，中：%d，低：%d）",
+		SnapshotRestored:   "已從 %[2]s 於 %[3]s 建立的快照還原 %[1]d 個叢集",
+		SnapshotMissing:    "不在快照中：%v",
+		ListEmpty:          "在 Rancher 中找不到任何叢集",
+		ListHeader:         "叢集\tID\t版本\t供應商\t節點\t在 KUBECONFIG 中\tCONTEXT\t到期時間\t剩餘天數\t說明",
+		ListYes:            "是",
+		ListNo:             "否",
+		ListUnknown:        "未知",
+		ListNever:          "永不",
+		TrayRefresh:        "立即更新",
+		TrayRefreshHint:    "立即更新 Rancher 權杖",
+		TrayQuit:           "結束",
+		TrayQuitHint:       "停止更新 Rancher 權杖",
+		TrayRefreshing:     "正在更新 Rancher 權杖",
+		TrayStatusFailed:   "無法得知 Rancher 權杖的到期時間：%v",
+		TrayEarliest:       "最早到期的 Rancher 權杖：%s，%d 天後（%s）",
+		TrayExpired:        "%s 的 Rancher 權杖已於 %s 到期",
+		TrayExpiredTitle:   "已過期",
+		TrayUnknownCount:   "%d 個 context 的到期時間未知",
+		TrayAllUnknown:     "%d 個 context 的 Rancher 權杖到期時間未知",
+		TrayNoEntries:      "kubeconfig 中沒有 Rancher 項目",
+		TrayNeverExpires:   "沒有會到期的 Rancher 權杖",
+		TrayRefreshFailed:  "Rancher 權杖更新失敗",
+		TrayClustersFailed: "%d 個叢集失敗：%s",
+		TrayRunOutcome:     "執行結果：%s",
+	},
+}
+
+var current atomic.Value
+
+// SetLanguage selects the language used by T.
+func SetLanguage(lang Language) {
+	current.Store(lang)
+}
+
+// Current returns the selected language, English unless SetLanguage was called.
+func Current() Language {
+	if lang, ok := current.Load().(Language); ok {
+		return lang
+	}
+	return English
+}
+
+// T returns the message for key in the selected language, formatted with args.
+// Messages missing from a translation fall back to English.
+func T(key Key, args ...any) string {
+	msg, ok := catalog[Current()][key]
+	if !ok {
+		msg = catalog[English][key]
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// ParseLanguage parses an explicitly requested language such as "en", "zh-TW" or "zh_TW".
+func ParseLanguage(value string) (Language, error) {
+	lang, ok := matchLocale(value)
+	if !ok {
+		return "", fmt.Errorf("unsupported language %q. Must be 'en' or 'zh-TW'", value)
+	}
+	return lang, nil
+}
+
+// Detect returns the language for flagValue or, if it is empty, for the locale in
+// LC_ALL, LC_MESSAGES or LANG (in that order). Unsupported locales select English.
+func Detect(flagValue string) (Language, error) {
+	if flagValue != "" {
+		return ParseLanguage(flagValue)
+	}
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(env); value != "" {
+			lang, _ := matchLocale(value)
+			return lang, nil
+		}
+	}
+	return English, nil
+}
+
+// matchLocale maps a locale such as "zh_TW.UTF-8" to a supported language.
+// Traditional Chinese locales (Taiwan, Hong Kong, Macau, zh-Hant) select zh-TW.
+func matchLocale(value string) (Language, bool) {
+	locale, _, _ := strings.Cut(value, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+
+	switch {
+	case locale == "en" || strings.HasPrefix(locale, "en-"), locale == "c", locale == "posix":
+		return English, true
+	case locale == "zh-tw", locale == "zh-hk", locale == "zh-mo", strings.HasPrefix(locale, "zh-hant"):
+		return TraditionalChinese, true
+	default:
+		return English, false
+	}
+}
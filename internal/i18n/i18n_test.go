@@ -0,0 +1,86 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalog_TranslationsHaveEnglishKeys(t *testing.T) {
+	for lang, messages := range catalog {
+		for key := range messages {
+			assert.Contains(t, catalog[English], key, "%s message %s has no English source", lang, key)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	t.Cleanup(func() { SetLanguage(English) })
+
+	SetLanguage(English)
+	assert.Equal(t, `Kubeconfig entry "prod" was modified since the last run. Overwrite it?`, T(ConfirmOverwrite, "prod"))
+
+	SetLanguage(TraditionalChinese)
+	assert.Equal(t, "請輸入 Rancher 密碼：", T(PromptPassword))
+	assert.Equal(t, "共 3 項發現（高：1，中：1，低：1）", T(AuditSummary, 3, 1, 1, 1))
+	assert.Equal(t, "已從 https://rancher.example.com 於 2026-01-02T03:04:05Z 建立的快照還原 2 個叢集",
+		T(SnapshotRestored, 2, "https://rancher.example.com", "2026-01-02T03:04:05Z"))
+}
+
+func TestCatalog_TranslationsKeepListColumns(t *testing.T) {
+	for lang, messages := range catalog {
+		if header, ok := messages[ListHeader]; ok {
+			assert.Equal(t, strings.Count(catalog[English][ListHeader], "\t"), strings.Count(header, "\t"), "%s list header", lang)
+		}
+	}
+}
+
+func TestT_FallsBackToEnglish(t *testing.T) {
+	catalog["xx"] = map[Key]string{}
+	t.Cleanup(func() {
+		delete(catalog, "xx")
+		SetLanguage(English)
+	})
+
+	SetLanguage("xx")
+	assert.Equal(t, "Enter Rancher Password: ", T(PromptPassword))
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		flag    string
+		lcAll   string
+		lang    string
+		want    Language
+		wantErr bool
+	}{
+		{name: "flag wins", flag: "zh-TW", lang: "en_US.UTF-8", want: TraditionalChinese},
+		{name: "flag with underscore", flag: "zh_tw", want: TraditionalChinese},
+		{name: "unsupported flag", flag: "fr", wantErr: true},
+		{name: "LANG zh_TW", lang: "zh_TW.UTF-8", want: TraditionalChinese},
+		{name: "LANG zh_HK", lang: "zh_HK.UTF-8", want: TraditionalChinese},
+		{name: "LANG zh-Hant", lang: "zh_Hant_TW", want: TraditionalChinese},
+		{name: "LC_ALL overrides LANG", lcAll: "en_US.UTF-8", lang: "zh_TW.UTF-8", want: English},
+		{name: "unsupported locale", lang: "de_DE.UTF-8", want: English},
+		{name: "no locale", want: English},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LC_ALL", tt.lcAll)
+			t.Setenv("LC_MESSAGES", "")
+			t.Setenv("LANG", tt.lang)
+
+			got, err := Detect(tt.flag)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package kubeconfig
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// CheckAccess sends a request with the credentials of the context name to its cluster, the
+// way kubectl would, and returns an error unless the cluster accepts them. It asks for the
+// server version, which every authenticated user may read, so a rejected request means the
+// credentials don't work.
+func CheckAccess(ctx context.Context, c *api.Config, name string) error {
+	if _, ok := c.Contexts[name]; !ok {
+		return fmt.Errorf("context %s not found", name)
+	}
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(*c, name, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("invalid kubeconfig entry %s: %w", name, err)
+	}
+	httpClient, err := rest.HTTPClientFor(restConfig)
+	if err != nil {
+		return fmt.Errorf("invalid kubeconfig entry %s: %w", name, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(restConfig.Host, "/")+"/version", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach cluster of %s: %w", name, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("cluster of %s rejected the credentials with status %d: %s", name, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package kubeconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UsesYAMLAnchors reports whether the kubeconfig file that path resolves to uses
+// YAML anchors, aliases or merge keys. Loading expands them into independent entries,
+// so the tool works with such files, but saving writes the expanded form.
+// A missing file reports false.
+func UsesYAMLAnchors(path string) (bool, error) {
+	targetPath, err := ResolvePath(path)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := os.ReadFile(targetPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read kubeconfig file: %w", err)
+	}
+	return hasYAMLAnchors(data), nil
+}
+
+// hasYAMLAnchors reports whether data contains an anchor or alias node.
+// Data that isn't valid YAML reports false; loading will report the error.
+func hasYAMLAnchors(data []byte) bool {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return false
+	}
+	return nodeHasAnchors(&root)
+}
+
+// nodeHasAnchors walks a YAML node tree looking for anchors and aliases
+func nodeHasAnchors(n *yaml.Node) bool {
+	if n.Anchor != "" || n.Kind == yaml.AliasNode {
+		return true
+	}
+	for _, child := range n.Content {
+		if nodeHasAnchors(child) {
+			return true
+		}
+	}
+	return false
+}
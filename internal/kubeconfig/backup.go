@@ -3,14 +3,16 @@ package kubeconfig
 import (
 	"fmt"
 	"os"
+	"rancher-kubeconfig-updater/internal/readonly"
 	"time"
 )
 
 // createBackup creates a backup of the file at the given path.
 // The backup filename includes a microsecond-precision timestamp to ensure uniqueness.
 // If the file doesn't exist or backup fails, it logs a warning but doesn't stop the operation.
+// The backup gets the permissions perm, like the kubeconfig written after it.
 // Returns the backup file path and any error that occurred.
-func createBackup(path string) (string, error) {
+func createBackup(path string, perm os.FileMode) (string, error) {
 	// Check if file exists
 	info, err := os.Stat(path)
 	if os.IsNotExist(err) {
@@ -33,10 +35,16 @@ func createBackup(path string) (string, error) {
 	backupPath := fmt.Sprintf("%s.backup.%s", path,
 		time.Now().Format("20060102-150405.000000"))
 
-	// Write backup with platform-appropriate permissions
-	if err := os.WriteFile(backupPath, data, getSecureFileMode()); err != nil {
+	if err := readonly.Check(backupPath); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(backupPath, data, perm); err != nil {
 		return "", fmt.Errorf("failed to write backup file: %w", err)
 	}
+	// Set permissions explicitly, umask may have removed some
+	if err := os.Chmod(backupPath, perm); err != nil {
+		return "", fmt.Errorf("failed to set backup file permissions: %w", err)
+	}
 
 	return backupPath, nil
 }
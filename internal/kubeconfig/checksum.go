@@ -0,0 +1,72 @@
+package kubeconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// entrySnapshot holds the parts of a cluster/context/user entry that define how it connects.
+// Extensions and origin information are left out so metadata changes don't count as edits.
+type entrySnapshot struct {
+	Server                   string                  `json:"server,omitempty"`
+	TLSServerName            string                  `json:"tlsServerName,omitempty"`
+	InsecureSkipTLSVerify    bool                    `json:"insecureSkipTLSVerify,omitempty"`
+	CertificateAuthority     string                  `json:"certificateAuthority,omitempty"`
+	CertificateAuthorityData []byte                  `json:"certificateAuthorityData,omitempty"`
+	ProxyURL                 string                  `json:"proxyURL,omitempty"`
+	ContextCluster           string                  `json:"contextCluster,omitempty"`
+	ContextUser              string                  `json:"contextUser,omitempty"`
+	Namespace                string                  `json:"namespace,omitempty"`
+	Token                    string                  `json:"token,omitempty"`
+	TokenFile                string                  `json:"tokenFile,omitempty"`
+	Username                 string                  `json:"username,omitempty"`
+	ClientCertificateData    []byte                  `json:"clientCertificateData,omitempty"`
+	Exec                     *api.ExecConfig         `json:"exec,omitempty"`
+	AuthProvider             *api.AuthProviderConfig `json:"authProvider,omitempty"`
+}
+
+// EntryChecksum returns a checksum of the cluster, context and user entries named name.
+// It changes whenever one of those entries is edited, so callers can detect changes made
+// outside the tool. Returns false if none of the entries exist.
+func EntryChecksum(c *api.Config, name string) (string, bool) {
+	var snap entrySnapshot
+	found := false
+
+	if cluster, ok := c.Clusters[name]; ok && cluster != nil {
+		found = true
+		snap.Server = cluster.Server
+		snap.TLSServerName = cluster.TLSServerName
+		snap.InsecureSkipTLSVerify = cluster.InsecureSkipTLSVerify
+		snap.CertificateAuthority = cluster.CertificateAuthority
+		snap.CertificateAuthorityData = cluster.CertificateAuthorityData
+		snap.ProxyURL = cluster.ProxyURL
+	}
+	if ctx, ok := c.Contexts[name]; ok && ctx != nil {
+		found = true
+		snap.ContextCluster = ctx.Cluster
+		snap.ContextUser = ctx.AuthInfo
+		snap.Namespace = ctx.Namespace
+	}
+	if authInfo, ok := c.AuthInfos[name]; ok && authInfo != nil {
+		found = true
+		snap.Token = authInfo.Token
+		snap.TokenFile = authInfo.TokenFile
+		snap.Username = authInfo.Username
+		snap.ClientCertificateData = authInfo.ClientCertificateData
+		snap.Exec = authInfo.Exec
+		snap.AuthProvider = authInfo.AuthProvider
+	}
+	if !found {
+		return "", false
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), true
+}
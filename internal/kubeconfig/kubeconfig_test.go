@@ -1,13 +1,20 @@
 package kubeconfig
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"rancher-kubeconfig-updater/internal/readonly"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 )
 
@@ -74,6 +81,32 @@ func TestGetDefaultKubeconfigPath(t *testing.T) {
 	}
 }
 
+// TestResolvePath_NoHomeDir tests that a default path without a home directory fails
+// instead of silently resolving to .kube/config in the working directory
+func TestResolvePath_NoHomeDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the home directory comes from USERPROFILE on Windows")
+	}
+	t.Setenv("HOME", "")
+	t.Setenv("KUBECONFIG", "")
+
+	if _, err := ResolvePath(""); !errors.Is(err, ErrNoHomeDir) {
+		t.Errorf("Expected ErrNoHomeDir, got %v", err)
+	}
+	if _, err := ResolvePath("~/config"); !errors.Is(err, ErrNoHomeDir) {
+		t.Errorf("Expected ErrNoHomeDir for a path under ~, got %v", err)
+	}
+
+	explicit := filepath.Join(t.TempDir(), "config")
+	if path, err := ResolvePath(explicit); err != nil || path != explicit {
+		t.Errorf("Expected explicit path %s to resolve, got %q (%v)", explicit, path, err)
+	}
+	t.Setenv("KUBECONFIG", explicit)
+	if path, err := ResolvePath(""); err != nil || path != explicit {
+		t.Errorf("Expected KUBECONFIG %s to be used, got %q (%v)", explicit, path, err)
+	}
+}
+
 // TestGetSecureFileMode tests the getSecureFileMode function
 func TestGetSecureFileMode(t *testing.T) {
 	mode := getSecureFileMode()
@@ -583,7 +616,7 @@ func TestCreateBackup_Success(t *testing.T) {
 	}
 
 	// Create backup
-	backupPath, err := createBackup(testFile)
+	backupPath, err := createBackup(testFile, getSecureFileMode())
 	if err != nil {
 		t.Fatalf("createBackup() error = %v", err)
 	}
@@ -626,7 +659,7 @@ func TestCreateBackup_FileNotExist(t *testing.T) {
 	nonExistentFile := filepath.Join(tmpDir, "does-not-exist")
 
 	// Should not return error for non-existent file
-	backupPath, err := createBackup(nonExistentFile)
+	backupPath, err := createBackup(nonExistentFile, getSecureFileMode())
 	if err != nil {
 		t.Errorf("createBackup() should not error for non-existent file, got: %v", err)
 	}
@@ -658,7 +691,7 @@ func TestCreateBackup_FilenameFormat(t *testing.T) {
 	}
 
 	// Create backup
-	backupPath, err := createBackup(testFile)
+	backupPath, err := createBackup(testFile, getSecureFileMode())
 	if err != nil {
 		t.Fatalf("createBackup() error = %v", err)
 	}
@@ -706,7 +739,7 @@ func TestCreateBackup_Directory(t *testing.T) {
 	}
 
 	// Should return error for directory
-	backupPath, err := createBackup(subDir)
+	backupPath, err := createBackup(subDir, getSecureFileMode())
 	if err == nil {
 		t.Error("createBackup() should return error for directory")
 	}
@@ -733,7 +766,7 @@ func TestCreateBackup_Permissions(t *testing.T) {
 	}
 
 	// Create backup
-	backupPath, err := createBackup(testFile)
+	backupPath, err := createBackup(testFile, getSecureFileMode())
 	if err != nil {
 		t.Fatalf("createBackup() error = %v", err)
 	}
@@ -1672,3 +1705,1005 @@ func TestExtractTokenFromKubeconfig(t *testing.T) {
 		})
 	}
 }
+
+// TestUpdateExecCredentialByName_ExistingUser tests switching an existing entry to the exec plugin
+func TestUpdateExecCredentialByName_ExistingUser(t *testing.T) {
+	config := createTestKubeconfig()
+	execConfig := NewExecCredentialConfig("/usr/local/bin/rancher-kubeconfig-updater", "c-test123")
+
+	err := UpdateExecCredentialByName(config, "c-test123", "test-cluster", "https://rancher.example.com", execConfig, false, createTestLogger())
+	if err != nil {
+		t.Fatalf("UpdateExecCredentialByName() error = %v", err)
+	}
+
+	authInfo := config.AuthInfos["test-cluster"]
+	if authInfo.Token != "" {
+		t.Errorf("Expected token to be removed, got %s", authInfo.Token)
+	}
+	if authInfo.Exec == nil {
+		t.Fatal("Expected exec config to be set")
+	}
+	if authInfo.Exec.Command != "/usr/local/bin/rancher-kubeconfig-updater" {
+		t.Errorf("Unexpected exec command: %s", authInfo.Exec.Command)
+	}
+	if strings.Join(authInfo.Exec.Args, " ") != "credential --cluster c-test123" {
+		t.Errorf("Unexpected exec args: %v", authInfo.Exec.Args)
+	}
+	if authInfo.Exec.InteractiveMode != api.NeverExecInteractiveMode {
+		t.Errorf("Expected interactive mode Never, got %s", authInfo.Exec.InteractiveMode)
+	}
+}
+
+// TestUpdateExecCredentialByName_AutoCreate tests creating a new entry with the exec plugin
+func TestUpdateExecCredentialByName_AutoCreate(t *testing.T) {
+	config := api.NewConfig()
+	execConfig := NewExecCredentialConfig("rancher-kubeconfig-updater", "c-newcluster")
+
+	err := UpdateExecCredentialByName(config, "c-newcluster", "new-cluster", "https://rancher.example.com/", execConfig, true, createTestLogger())
+	if err != nil {
+		t.Fatalf("UpdateExecCredentialByName() error = %v", err)
+	}
+
+	expectedServer := "https://rancher.example.com/k8s/clusters/c-newcluster"
+	if config.Clusters["new-cluster"].Server != expectedServer {
+		t.Errorf("Expected server %s, got %s", expectedServer, config.Clusters["new-cluster"].Server)
+	}
+	if config.AuthInfos["new-cluster"].Exec != execConfig {
+		t.Error("Expected exec config to be used for the new user")
+	}
+}
+
+// TestUpdateExecCredentialByName_AutoCreateFalse tests error when user doesn't exist
+func TestUpdateExecCredentialByName_AutoCreateFalse(t *testing.T) {
+	config := api.NewConfig()
+	execConfig := NewExecCredentialConfig("rancher-kubeconfig-updater", "c-test")
+
+	err := UpdateExecCredentialByName(config, "c-test", "nonexistent", "https://rancher.example.com", execConfig, false, createTestLogger())
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected 'not found' error, got: %v", err)
+	}
+}
+
+func TestFindSharedTokens(t *testing.T) {
+	config := api.NewConfig()
+	config.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-abc:shared"}
+	config.AuthInfos["staging"] = &api.AuthInfo{Token: "kubeconfig-u-abc:shared"}
+	config.AuthInfos["dev"] = &api.AuthInfo{Token: "kubeconfig-u-def:unique"}
+	config.AuthInfos["exec-user"] = &api.AuthInfo{}
+	config.AuthInfos["exec-user-2"] = &api.AuthInfo{}
+
+	groups := FindSharedTokens(config)
+
+	if len(groups) != 1 {
+		t.Fatalf("Expected 1 shared token group, got %d: %v", len(groups), groups)
+	}
+	if len(groups[0]) != 2 || groups[0][0] != "prod" || groups[0][1] != "staging" {
+		t.Errorf("Expected group [prod staging], got %v", groups[0])
+	}
+}
+
+func TestFindSharedTokens_NoSharing(t *testing.T) {
+	config := createTestKubeconfig()
+
+	if groups := FindSharedTokens(config); len(groups) != 0 {
+		t.Errorf("Expected no shared tokens, got %v", groups)
+	}
+}
+
+func TestExtractExecFromKubeconfig(t *testing.T) {
+	config := api.NewConfig()
+	config.CurrentContext = "prod"
+	config.Contexts["prod"] = &api.Context{Cluster: "prod", AuthInfo: "prod"}
+	config.AuthInfos["prod"] = &api.AuthInfo{
+		Exec: &api.ExecConfig{
+			APIVersion: "client.authentication.k8s.io/v1beta1",
+			Command:    "rancher",
+			Args:       []string{"token", "--server=rancher.example.com", "--user=user-abc"},
+		},
+	}
+
+	execConfig, ok := ExtractExecFromKubeconfig(config)
+	if !ok {
+		t.Fatal("Expected exec config to be extracted")
+	}
+	if execConfig.Command != "rancher" {
+		t.Errorf("Expected command 'rancher', got '%s'", execConfig.Command)
+	}
+	if execConfig == config.AuthInfos["prod"].Exec {
+		t.Error("Expected a copy of the exec config, got the original")
+	}
+
+	if _, ok := ExtractTokenFromKubeconfig(config); ok {
+		t.Error("Expected no token in exec-only kubeconfig")
+	}
+}
+
+func TestExtractExecFromKubeconfig_TokenOnly(t *testing.T) {
+	config := createTestKubeconfig()
+	config.CurrentContext = "test-cluster"
+
+	if _, ok := ExtractExecFromKubeconfig(config); ok {
+		t.Error("Expected no exec config in token kubeconfig")
+	}
+}
+
+func TestEntryChecksum(t *testing.T) {
+	config := createTestKubeconfig()
+
+	original, ok := EntryChecksum(config, "test-cluster")
+	if !ok || original == "" {
+		t.Fatal("Expected checksum for existing entry")
+	}
+
+	again, _ := EntryChecksum(config.DeepCopy(), "test-cluster")
+	if again != original {
+		t.Error("Expected checksum to be stable for identical entries")
+	}
+
+	config.Contexts["test-cluster"].Namespace = "kube-system"
+	changed, _ := EntryChecksum(config, "test-cluster")
+	if changed == original {
+		t.Error("Expected checksum to change after editing the context")
+	}
+
+	if _, ok := EntryChecksum(config, "missing"); ok {
+		t.Error("Expected no checksum for missing entry")
+	}
+}
+
+func TestMetadata_RoundTripThroughFile(t *testing.T) {
+	config := createTestKubeconfig()
+	rotated := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := SetMetadata(config, "test-cluster", NewMetadata("https://rancher.example.com/", "c-test123", rotated)); err != nil {
+		t.Fatalf("SetMetadata failed: %v", err)
+	}
+
+	data, err := clientcmd.Write(*config)
+	if err != nil {
+		t.Fatalf("Failed to write kubeconfig: %v", err)
+	}
+	loaded, err := clientcmd.Load(data)
+	if err != nil {
+		t.Fatalf("Failed to load kubeconfig: %v", err)
+	}
+
+	md, ok := GetMetadata(loaded, "test-cluster")
+	if !ok {
+		t.Fatal("Expected metadata after round trip")
+	}
+	if md.ManagedBy != ExtensionName || md.RancherURL != "https://rancher.example.com" || md.ClusterID != "c-test123" {
+		t.Errorf("Unexpected metadata: %+v", md)
+	}
+	if !md.LastRotated.Equal(rotated) {
+		t.Errorf("Expected lastRotated %v, got %v", rotated, md.LastRotated)
+	}
+	if _, ok := loaded.Clusters["test-cluster"].Extensions[ExtensionName]; !ok {
+		t.Error("Expected metadata on the cluster entry too")
+	}
+}
+
+func TestMetadata_UnannotatedEntry(t *testing.T) {
+	config := createTestKubeconfig()
+
+	if IsManaged(config, "test-cluster") {
+		t.Error("Expected entry without extensions to be unmanaged")
+	}
+	if _, ok := FindManagedEntry(config, "https://rancher.example.com", "c-test123"); ok {
+		t.Error("Expected unannotated entry not to be found by cluster ID")
+	}
+}
+
+func TestRemoveContext_OnlyManagedEntries(t *testing.T) {
+	config := createTestKubeconfig()
+	config.Contexts["manual"] = &api.Context{Cluster: "test-cluster", AuthInfo: "test-cluster"}
+	_ = SetMetadata(config, "test-cluster", NewMetadata("https://rancher.example.com", "c-test123", time.Now()))
+
+	if RemoveContext(config, "manual") {
+		t.Error("Expected an unannotated context not to be removed")
+	}
+	if _, ok := config.Contexts["manual"]; !ok {
+		t.Error("Expected the unannotated context to survive")
+	}
+
+	if !RemoveContext(config, "test-cluster") {
+		t.Error("Expected the managed context to be removed")
+	}
+	if _, ok := config.Contexts["test-cluster"]; ok {
+		t.Error("Expected the managed context to be gone")
+	}
+	if config.CurrentContext != "" {
+		t.Errorf("Expected the current context to be cleared, got %q", config.CurrentContext)
+	}
+
+	delete(config.Clusters["test-cluster"].Extensions, ExtensionName)
+	if RemoveCluster(config, "test-cluster") {
+		t.Error("Expected a cluster without metadata not to be removed")
+	}
+}
+
+func TestRenameCluster(t *testing.T) {
+	source := createTestSourceKubeconfig()
+	if err := RenameCluster(source, "demo-cluster", "acme-demo"); err != nil {
+		t.Fatalf("RenameCluster failed: %v", err)
+	}
+
+	target := api.NewConfig()
+	MergeKubeconfig(target, source, "acme-demo", true)
+	for _, name := range []string{"acme-demo", "acme-demo-node01", "acme-demo-node02"} {
+		ctx := target.Contexts[name]
+		if ctx == nil {
+			t.Fatalf("Expected context %s to be merged", name)
+		}
+		if ctx.Cluster != name || ctx.AuthInfo != "acme-demo" {
+			t.Errorf("Expected context %s to reference cluster %s and user acme-demo, got %+v", name, name, ctx)
+		}
+	}
+	if target.AuthInfos["acme-demo"] == nil || target.AuthInfos["acme-demo"].Token != "kubeconfig-user:demo-token" {
+		t.Error("Expected the shared user to be renamed")
+	}
+	if source.CurrentContext != "acme-demo" {
+		t.Errorf("Expected current context to follow the rename, got %q", source.CurrentContext)
+	}
+}
+
+func TestFindManagedEntryAndRename(t *testing.T) {
+	config := createTestKubeconfig()
+	_ = SetMetadata(config, "test-cluster", NewMetadata("https://rancher.example.com", "c-test123", time.Now()))
+
+	name, ok := FindManagedEntry(config, "https://rancher.example.com/", "c-test123")
+	if !ok || name != "test-cluster" {
+		t.Fatalf("Expected to find test-cluster, got %q (%v)", name, ok)
+	}
+
+	if err := RenameEntry(config, "test-cluster", "renamed"); err != nil {
+		t.Fatalf("RenameEntry failed: %v", err)
+	}
+	if _, exists := config.Contexts["test-cluster"]; exists {
+		t.Error("Expected old context to be removed")
+	}
+	ctx := config.Contexts["renamed"]
+	if ctx == nil || ctx.Cluster != "renamed" || ctx.AuthInfo != "renamed" {
+		t.Errorf("Expected context to reference renamed entries, got %+v", ctx)
+	}
+	if config.AuthInfos["renamed"].Token != "test-token-123" {
+		t.Error("Expected token to move with the user entry")
+	}
+	if config.CurrentContext != "renamed" {
+		t.Errorf("Expected current context to follow the rename, got %q", config.CurrentContext)
+	}
+}
+
+func TestRenameEntry_TargetExists(t *testing.T) {
+	config := createTestKubeconfig()
+	config.Contexts["other"] = &api.Context{Cluster: "other", AuthInfo: "other"}
+
+	if err := RenameEntry(config, "test-cluster", "other"); err == nil {
+		t.Error("Expected error when the new name is already in use")
+	}
+}
+
+func TestTransaction_CommitWritesAll(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	if err := os.WriteFile(first, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := NewTransaction()
+	tx.Stage(first, []byte("new-first"), 0600)
+	tx.Stage(second, []byte("new-second"), 0600)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	for path, want := range map[string]string{first: "new-first", second: "new-second"} {
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != want {
+			t.Errorf("Expected %s to contain %q, got %q (%v)", path, want, got, err)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("Expected no leftover temporary files, got %d entries", len(entries))
+	}
+}
+
+func TestTransaction_FailedStagingWritesNothing(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	if err := os.WriteFile(first, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := NewTransaction()
+	tx.Stage(first, []byte("new"), 0600)
+	tx.Stage(filepath.Join(dir, "missing-dir", "second"), []byte("new"), 0600)
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Expected Commit to fail")
+	}
+
+	if got, _ := os.ReadFile(first); string(got) != "old" {
+		t.Errorf("Expected first file to be untouched, got %q", got)
+	}
+}
+
+func TestTransaction_ReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	if err := os.WriteFile(first, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	readonly.Set(true)
+	t.Cleanup(func() { readonly.Set(false) })
+
+	tx := NewTransaction()
+	tx.Stage(first, []byte("new"), 0600)
+	tx.Stage(filepath.Join(dir, "second"), []byte("new"), 0600)
+	if err := tx.Commit(); !errors.Is(err, readonly.ErrReadOnly) {
+		t.Fatalf("Expected ErrReadOnly, got %v", err)
+	}
+	if _, err := tx.StageKubeconfig(api.NewConfig(), first, nil); !errors.Is(err, readonly.ErrReadOnly) {
+		t.Errorf("Expected staging a kubeconfig to fail with ErrReadOnly, got %v", err)
+	}
+
+	if got, _ := os.ReadFile(first); string(got) != "old" {
+		t.Errorf("Expected first file to be untouched, got %q", got)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected no new files or backups, got %d entries", len(entries))
+	}
+}
+
+func TestTransaction_RollsBackReplacedTargets(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	created := filepath.Join(dir, "created")
+	blocked := filepath.Join(dir, "blocked")
+	if err := os.WriteFile(first, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A non-empty directory cannot be replaced by a file, so the last rename fails
+	if err := os.MkdirAll(filepath.Join(blocked, "child"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := NewTransaction()
+	tx.Stage(first, []byte("new"), 0600)
+	tx.Stage(created, []byte("new"), 0600)
+	tx.Stage(blocked, []byte("new"), 0600)
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Expected Commit to fail")
+	}
+
+	if got, _ := os.ReadFile(first); string(got) != "old" {
+		t.Errorf("Expected first file to be rolled back, got %q", got)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Error("Expected file created by the transaction to be removed")
+	}
+}
+
+func TestSaveKubeconfig_KeepsSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Symlinks require privileges on Windows")
+	}
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real-config")
+	link := filepath.Join(dir, "config")
+	if err := os.WriteFile(target, []byte(createTestKubeconfigContent()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SaveKubeconfig(createTestKubeconfig(), link, createTestLogger()); err != nil {
+		t.Fatalf("SaveKubeconfig failed: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected kubeconfig symlink to be preserved")
+	}
+}
+
+func TestExpandPercentEnv(t *testing.T) {
+	env := map[string]string{"USERPROFILE": `C:\Users\alice`, "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`%USERPROFILE%\.kube\config`, `C:\Users\alice\.kube\config`},
+		{`%userprofile%\.kube\config`, `%userprofile%\.kube\config`},
+		{`%UNKNOWN%\config`, `%UNKNOWN%\config`},
+		{`100%\%USERPROFILE%`, `100%\C:\Users\alice`},
+		{`%EMPTY%config`, `config`},
+		{`%%config`, `%%config`},
+		{`no variables`, `no variables`},
+		{`trailing %`, `trailing %`},
+	}
+
+	for _, tt := range tests {
+		if got := expandPercentEnv(tt.input, lookup); got != tt.want {
+			t.Errorf("expandPercentEnv(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestWindowsLongPath(t *testing.T) {
+	long := strings.Repeat("a", windowsMaxPath)
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"short path", `C:\Users\alice\.kube\config`, `C:\Users\alice\.kube\config`},
+		{"long drive path", `C:\` + long, `\\?\C:\` + long},
+		{"long drive path with slashes", `C:/dir/` + long, `\\?\C:\dir\` + long},
+		{"long UNC path", `\\server\share\` + long, `\\?\UNC\server\share\` + long},
+		{"already prefixed", `\\?\C:\` + long, `\\?\C:\` + long},
+		{"long relative path", `dir\` + long, `dir\` + long},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := windowsLongPath(tt.input); got != tt.want {
+				t.Errorf("windowsLongPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// anchoredKubeconfig shares cluster and user settings between entries with YAML anchors,
+// an alias and a merge key
+const anchoredKubeconfig = `apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: prod
+  cluster: &rancher
+    server: https://rancher.example.com/k8s/clusters/c-prod
+    insecure-skip-tls-verify: true
+- name: staging
+  cluster:
+    <<: *rancher
+    server: https://rancher.example.com/k8s/clusters/c-staging
+users:
+- name: prod
+  user: &user
+    token: token-abc:secret
+- name: staging
+  user: *user
+contexts:
+- name: prod
+  context: {cluster: prod, user: prod}
+- name: staging
+  context: {cluster: staging, user: staging}
+`
+
+func writeAnchoredKubeconfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(anchoredKubeconfig), 0600); err != nil {
+		t.Fatalf("Failed to write kubeconfig: %v", err)
+	}
+	return path
+}
+
+func TestLoadKubeconfig_YAMLAnchors(t *testing.T) {
+	config, err := LoadKubeconfig(writeAnchoredKubeconfig(t))
+	if err != nil {
+		t.Fatalf("LoadKubeconfig() error = %v", err)
+	}
+
+	if len(config.Clusters) != 2 || len(config.AuthInfos) != 2 || len(config.Contexts) != 2 {
+		t.Fatalf("expected 2 clusters, users and contexts, got %d, %d, %d",
+			len(config.Clusters), len(config.AuthInfos), len(config.Contexts))
+	}
+
+	staging := config.Clusters["staging"]
+	if staging.Server != "https://rancher.example.com/k8s/clusters/c-staging" {
+		t.Errorf("merge key should not override explicit server, got %s", staging.Server)
+	}
+	if !staging.InsecureSkipTLSVerify {
+		t.Error("merge key should inherit insecure-skip-tls-verify")
+	}
+	if config.AuthInfos["staging"].Token != "token-abc:secret" {
+		t.Errorf("alias should resolve to anchored token, got %s", config.AuthInfos["staging"].Token)
+	}
+}
+
+func TestLoadKubeconfig_YAMLAliasEntriesAreIndependent(t *testing.T) {
+	config, err := LoadKubeconfig(writeAnchoredKubeconfig(t))
+	if err != nil {
+		t.Fatalf("LoadKubeconfig() error = %v", err)
+	}
+
+	if err := UpdateTokenByName(config, "c-prod", "prod", "token-new:secret", "", false, createTestLogger()); err != nil {
+		t.Fatalf("UpdateTokenByName() error = %v", err)
+	}
+
+	if config.AuthInfos["staging"].Token != "token-abc:secret" {
+		t.Errorf("updating prod must not change the aliased staging user, got %s", config.AuthInfos["staging"].Token)
+	}
+}
+
+func TestSaveKubeconfig_YAMLAnchorsRoundTrip(t *testing.T) {
+	path := writeAnchoredKubeconfig(t)
+	config, err := LoadKubeconfig(path)
+	if err != nil {
+		t.Fatalf("LoadKubeconfig() error = %v", err)
+	}
+	config.AuthInfos["prod"].Token = "token-new:secret"
+
+	if err := SaveKubeconfig(config, path, createTestLogger()); err != nil {
+		t.Fatalf("SaveKubeconfig() error = %v", err)
+	}
+
+	reloaded, err := LoadKubeconfig(path)
+	if err != nil {
+		t.Fatalf("saved kubeconfig is not loadable: %v", err)
+	}
+	if reloaded.AuthInfos["prod"].Token != "token-new:secret" {
+		t.Errorf("prod token = %s, want token-new:secret", reloaded.AuthInfos["prod"].Token)
+	}
+	if reloaded.AuthInfos["staging"].Token != "token-abc:secret" {
+		t.Errorf("staging token = %s, want token-abc:secret", reloaded.AuthInfos["staging"].Token)
+	}
+	if !reloaded.Clusters["staging"].InsecureSkipTLSVerify {
+		t.Error("merged cluster settings should be written out explicitly")
+	}
+
+	anchored, err := UsesYAMLAnchors(path)
+	if err != nil {
+		t.Fatalf("UsesYAMLAnchors() error = %v", err)
+	}
+	if anchored {
+		t.Error("saved kubeconfig should contain expanded entries")
+	}
+}
+
+func TestUsesYAMLAnchors(t *testing.T) {
+	anchored, err := UsesYAMLAnchors(writeAnchoredKubeconfig(t))
+	if err != nil {
+		t.Fatalf("UsesYAMLAnchors() error = %v", err)
+	}
+	if !anchored {
+		t.Error("expected anchors to be detected")
+	}
+
+	plain := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(plain, []byte(createTestKubeconfigContent()), 0600); err != nil {
+		t.Fatalf("Failed to write kubeconfig: %v", err)
+	}
+	if anchored, _ := UsesYAMLAnchors(plain); anchored {
+		t.Error("plain kubeconfig should not report anchors")
+	}
+
+	if anchored, err := UsesYAMLAnchors(filepath.Join(t.TempDir(), "missing")); err != nil || anchored {
+		t.Errorf("missing file: got (%v, %v), want (false, nil)", anchored, err)
+	}
+}
+
+func TestSaveKubeconfig_WithFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Permission tests not applicable on Windows")
+	}
+
+	path := filepath.Join(t.TempDir(), "shared", "config")
+	if err := SaveKubeconfig(createTestKubeconfig(), path, nil, WithFileMode(0640)); err != nil {
+		t.Fatalf("SaveKubeconfig() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat kubeconfig: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0640 {
+		t.Errorf("Expected file mode 640, got %o", mode)
+	}
+
+	dirInfo, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("Failed to stat directory: %v", err)
+	}
+	if mode := dirInfo.Mode().Perm(); mode != 0750 {
+		t.Errorf("Expected directory mode 750, got %o", mode)
+	}
+
+	// A later save without the option restores the default
+	if err := SaveKubeconfig(createTestKubeconfig(), path, nil); err != nil {
+		t.Fatalf("SaveKubeconfig() error = %v", err)
+	}
+	info, _ = os.Stat(path)
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("Expected file mode 600, got %o", mode)
+	}
+}
+
+func TestSaveKubeconfig_BackupFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Permission tests not applicable on Windows")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := SaveKubeconfig(createTestKubeconfig(), path, nil); err != nil {
+		t.Fatalf("SaveKubeconfig() error = %v", err)
+	}
+	for _, mode := range []os.FileMode{0640, 0600} {
+		if err := SaveKubeconfig(createTestKubeconfig(), path, nil, WithFileMode(mode)); err != nil {
+			t.Fatalf("SaveKubeconfig() error = %v", err)
+		}
+		backups, _ := filepath.Glob(path + ".backup.*")
+		if len(backups) == 0 {
+			t.Fatal("Expected a backup")
+		}
+		// The newest backup sorts last
+		info, err := os.Stat(backups[len(backups)-1])
+		if err != nil {
+			t.Fatalf("Failed to stat backup: %v", err)
+		}
+		if got := info.Mode().Perm(); got != mode {
+			t.Errorf("Expected backup mode %o, got %o", mode, got)
+		}
+	}
+}
+
+func TestSaveKubeconfig_WithOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Ownership not applicable on Windows")
+	}
+
+	// Changing to the current owner works without privileges
+	path := filepath.Join(t.TempDir(), "config")
+	owner := Owner{UID: os.Getuid(), GID: os.Getgid()}
+	if err := SaveKubeconfig(createTestKubeconfig(), path, nil, WithOwner(owner)); err != nil {
+		t.Fatalf("SaveKubeconfig() error = %v", err)
+	}
+	if err := SaveKubeconfig(createTestKubeconfig(), path, nil, WithOwner(owner)); err != nil {
+		t.Fatalf("SaveKubeconfig() with backup error = %v", err)
+	}
+
+	if os.Getuid() == 0 {
+		return
+	}
+
+	// Giving the file away requires privileges and must leave the kubeconfig untouched
+	config := createTestKubeconfig()
+	config.AuthInfos["test-cluster"].Token = "changed"
+	err := SaveKubeconfig(config, path, nil, WithOwner(Owner{UID: 0, GID: -1}))
+	if err == nil {
+		t.Fatal("SaveKubeconfig() expected error when changing owner without privileges")
+	}
+	loaded, err := LoadKubeconfig(path)
+	if err != nil {
+		t.Fatalf("LoadKubeconfig() error = %v", err)
+	}
+	if loaded.AuthInfos["test-cluster"].Token != "test-token-123" {
+		t.Error("kubeconfig must not change when the owner cannot be set")
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{"0600", 0600, false},
+		{"0640", 0640, false},
+		{"640", 0640, false},
+		{"0400", 0, true},
+		{"0000", 0, true},
+		{"1777", 0, true},
+		{"rw-r-----", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFileMode(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFileMode(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseFileMode(%q) = %o, want %o", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		if _, err := ParseOwner("1000:1000"); err == nil {
+			t.Error("ParseOwner() expected error on Windows")
+		}
+		return
+	}
+
+	tests := []struct {
+		input   string
+		want    Owner
+		wantErr bool
+	}{
+		{"1000:1001", Owner{UID: 1000, GID: 1001}, false},
+		{"1000", Owner{UID: 1000, GID: -1}, false},
+		{":1001", Owner{UID: -1, GID: 1001}, false},
+		{"root:0", Owner{UID: 0, GID: 0}, false},
+		{":", Owner{}, true},
+		{"no-such-user-xyz:0", Owner{}, true},
+		{"0:no-such-group-xyz", Owner{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseOwner(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseOwner(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseOwner(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestTransaction_RenameFailureFallsBackToCopy(t *testing.T) {
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrPermission}
+	}
+	defer func() { rename = os.Rename }()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := NewTransaction()
+	tx.Stage(path, []byte("new"), 0600)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	if got, _ := os.ReadFile(path); string(got) != "new" {
+		t.Errorf("Expected file to be written in place, got %q", got)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected temporary files to be removed, found %d entries", len(entries))
+	}
+}
+
+func TestSaveKubeconfig_CopyStrategy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := SaveKubeconfig(createTestKubeconfig(), path, nil); err != nil {
+		t.Fatalf("SaveKubeconfig() error = %v", err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := createTestKubeconfig()
+	config.AuthInfos["test-cluster"].Token = "copied-token"
+	if err := SaveKubeconfig(config, path, nil, WithWriteStrategy(WriteStrategyCopy)); err != nil {
+		t.Fatalf("SaveKubeconfig() error = %v", err)
+	}
+
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("Expected the copy strategy to overwrite the existing file in place")
+	}
+	loaded, err := LoadKubeconfig(path)
+	if err != nil {
+		t.Fatalf("LoadKubeconfig() error = %v", err)
+	}
+	if loaded.AuthInfos["test-cluster"].Token != "copied-token" {
+		t.Errorf("Expected updated token, got %s", loaded.AuthInfos["test-cluster"].Token)
+	}
+}
+
+func TestParseWriteStrategy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    WriteStrategy
+		wantErr bool
+	}{
+		{"", WriteStrategyRename, false},
+		{"rename", WriteStrategyRename, false},
+		{"copy", WriteStrategyCopy, false},
+		{"move", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseWriteStrategy(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseWriteStrategy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseWriteStrategy(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSaveKubeconfig_WithoutSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	for _, strategy := range []WriteStrategy{WriteStrategyRename, WriteStrategyCopy} {
+		if err := SaveKubeconfig(createTestKubeconfig(), path, nil, WithoutSync(), WithWriteStrategy(strategy)); err != nil {
+			t.Fatalf("SaveKubeconfig() with %s strategy error = %v", strategy, err)
+		}
+		loaded, err := LoadKubeconfig(path)
+		if err != nil {
+			t.Fatalf("LoadKubeconfig() error = %v", err)
+		}
+		if loaded.AuthInfos["test-cluster"].Token != "test-token-123" {
+			t.Errorf("Saved content doesn't match original with %s strategy", strategy)
+		}
+	}
+}
+
+func TestSyncDir(t *testing.T) {
+	if err := syncDir(t.TempDir()); err != nil {
+		t.Errorf("syncDir() error = %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		if err := syncDir(filepath.Join(t.TempDir(), "missing")); err == nil {
+			t.Error("syncDir() expected error for a missing directory")
+		}
+	}
+}
+
+func TestThreeWayMerge(t *testing.T) {
+	base := createTestKubeconfig()
+	base.AuthInfos["shared"] = &api.AuthInfo{Token: "shared-token"}
+	base.AuthInfos["removed-by-us"] = &api.AuthInfo{Token: "old"}
+	base.AuthInfos["removed-by-them"] = &api.AuthInfo{Token: "old"}
+
+	ours := base.DeepCopy()
+	ours.AuthInfos["test-cluster"].Token = "our-token"
+	ours.AuthInfos["shared"].Token = "our-shared-token"
+	ours.AuthInfos["ours-only"] = &api.AuthInfo{Token: "new"}
+	delete(ours.AuthInfos, "removed-by-us")
+
+	theirs := base.DeepCopy()
+	theirs.AuthInfos["shared"].Token = "their-shared-token"
+	theirs.AuthInfos["theirs-only"] = &api.AuthInfo{Token: "kubectl"}
+	theirs.Clusters["test-cluster"].CertificateAuthorityData = []byte("ca")
+	theirs.CurrentContext = "theirs-only"
+	delete(theirs.AuthInfos, "removed-by-them")
+
+	merged, conflicts := ThreeWayMerge(base, ours, theirs)
+
+	want := map[string]string{
+		"test-cluster": "our-token",
+		"shared":       "our-shared-token",
+		"ours-only":    "new",
+		"theirs-only":  "kubectl",
+	}
+	if len(merged.AuthInfos) != len(want) {
+		t.Errorf("Expected %d users, got %d", len(want), len(merged.AuthInfos))
+	}
+	for name, token := range want {
+		if user, ok := merged.AuthInfos[name]; !ok || user.Token != token {
+			t.Errorf("user %s: expected token %q, got %+v", name, token, user)
+		}
+	}
+	if string(merged.Clusters["test-cluster"].CertificateAuthorityData) != "ca" {
+		t.Error("Expected cluster change made on disk to be kept")
+	}
+	if merged.CurrentContext != "theirs-only" {
+		t.Errorf("Expected current context changed on disk to be kept, got %s", merged.CurrentContext)
+	}
+	if len(conflicts) != 1 || conflicts[0] != "user shared" {
+		t.Errorf("Expected conflict on user shared, got %v", conflicts)
+	}
+}
+
+func TestThreeWayMerge_RemovedEntryModifiedOnDisk(t *testing.T) {
+	base := createTestKubeconfig()
+	ours := base.DeepCopy()
+	delete(ours.Contexts, "test-cluster")
+	theirs := base.DeepCopy()
+	theirs.Contexts["test-cluster"].Namespace = "kube-system"
+
+	merged, conflicts := ThreeWayMerge(base, ours, theirs)
+
+	if ctx, ok := merged.Contexts["test-cluster"]; !ok || ctx.Namespace != "kube-system" {
+		t.Error("Expected context modified on disk to be kept")
+	}
+	if len(conflicts) != 1 || conflicts[0] != "context test-cluster" {
+		t.Errorf("Expected conflict on context test-cluster, got %v", conflicts)
+	}
+}
+
+func TestMergeExternalChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := SaveKubeconfig(createTestKubeconfig(), path, nil); err != nil {
+		t.Fatalf("SaveKubeconfig() error = %v", err)
+	}
+	base, err := LoadKubeconfig(path)
+	if err != nil {
+		t.Fatalf("LoadKubeconfig() error = %v", err)
+	}
+	ours := base.DeepCopy()
+	ours.AuthInfos["test-cluster"].Token = "rotated"
+
+	// Unchanged file: our config is used as is
+	merged, conflicts, err := MergeExternalChanges(base, ours, path)
+	if err != nil {
+		t.Fatalf("MergeExternalChanges() error = %v", err)
+	}
+	if merged != ours || len(conflicts) != 0 {
+		t.Error("Expected our config to be returned unchanged when the file did not change")
+	}
+
+	// kubectl adds a context while the run is in progress
+	external := base.DeepCopy()
+	external.Clusters["kind"] = &api.Cluster{Server: "https://127.0.0.1:6443"}
+	external.AuthInfos["kind"] = &api.AuthInfo{Token: "kind-token"}
+	external.Contexts["kind"] = &api.Context{Cluster: "kind", AuthInfo: "kind"}
+	if err := SaveKubeconfig(external, path, nil); err != nil {
+		t.Fatalf("SaveKubeconfig() error = %v", err)
+	}
+
+	merged, conflicts, err = MergeExternalChanges(base, ours, path)
+	if err != nil {
+		t.Fatalf("MergeExternalChanges() error = %v", err)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %v", conflicts)
+	}
+	if _, ok := merged.Contexts["kind"]; !ok {
+		t.Error("Expected context added by another tool to be kept")
+	}
+	if merged.AuthInfos["test-cluster"].Token != "rotated" {
+		t.Errorf("Expected rotated token, got %s", merged.AuthInfos["test-cluster"].Token)
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/k8s/clusters/c-prod/version" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer kubeconfig-u-abc:valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"Unauthorized"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"gitVersion":"v1.31.0"}`))
+	}))
+	defer server.Close()
+
+	cfg := api.NewConfig()
+	cfg.Clusters["prod"] = &api.Cluster{Server: server.URL + "/k8s/clusters/c-prod", InsecureSkipTLSVerify: true}
+	cfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-abc:valid"}
+	cfg.Contexts["prod"] = &api.Context{Cluster: "prod", AuthInfo: "prod"}
+
+	if err := CheckAccess(context.Background(), cfg, "prod"); err != nil {
+		t.Errorf("CheckAccess() error = %v", err)
+	}
+
+	cfg.AuthInfos["prod"].Token = "kubeconfig-u-abc:revoked"
+	err := CheckAccess(context.Background(), cfg, "prod")
+	if err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("CheckAccess() error = %v, want a 401 error", err)
+	}
+
+	if err := CheckAccess(context.Background(), cfg, "missing"); err == nil {
+		t.Error("CheckAccess() expected an error for a missing context")
+	}
+}
@@ -2,10 +2,12 @@
 package kubeconfig
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"go.uber.org/zap"
@@ -30,20 +32,11 @@ func LoadKubeconfig(path string) (*api.Config, error) {
 	// Note: The behavior for multiple non-existent files in KUBECONFIG may differ slightly from
 	// kubectl's PathOptions, but this edge case is rare and the common cases (single file,
 	// multiple files with at least one existing) behave identically.
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-
-	// If an explicit path is provided, use it; otherwise, use client-go's default logic
-	if path != "" {
-		expandedPath, err := expandPath(path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to expand path %q: %w", path, err)
-		}
-		loadingRules.ExplicitPath = expandedPath
+	targetPath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get the actual file path we'll use (respects KUBECONFIG, precedence, etc.)
-	targetPath := loadingRules.GetDefaultFilename()
-
 	// Check if file exists
 	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
 		// If file doesn't exist, return a new empty kubeconfig structure
@@ -68,35 +61,31 @@ func UpdateTokenByName(c *api.Config, clusterID, clusterName, token, rancherURL
 
 	// If auto-create is enabled, create new cluster, context, and user entries
 	if autoCreate {
-		// Initialize maps if nil
-		if c.Clusters == nil {
-			c.Clusters = make(map[string]*api.Cluster)
-		}
-		if c.Contexts == nil {
-			c.Contexts = make(map[string]*api.Context)
-		}
-		if c.AuthInfos == nil {
-			c.AuthInfos = make(map[string]*api.AuthInfo)
-		}
-
-		// Create new cluster entry with correct server URL using cluster ID
-		// Remove trailing slash from rancherURL to avoid double slashes
-		cleanURL := strings.TrimSuffix(rancherURL, "/")
-		c.Clusters[clusterName] = &api.Cluster{
-			Server: cleanURL + "/k8s/clusters/" + clusterID,
-		}
+		createEntry(c, clusterID, clusterName, rancherURL, &api.AuthInfo{
+			Token: token,
+		})
+		logger.Info("Created new kubeconfig entry for cluster: " + clusterName)
+		return nil
+	}
 
-		// Create new context entry
-		c.Contexts[clusterName] = &api.Context{
-			Cluster:  clusterName,
-			AuthInfo: clusterName,
-		}
+	logger.Warn("Cluster not found in kubeconfig, skipping: " + clusterName)
+	return fmt.Errorf("user %s not found in kubeconfig", clusterName)
+}
 
-		// Create new user entry
-		c.AuthInfos[clusterName] = &api.AuthInfo{
-			Token: token,
-		}
+// UpdateExecCredentialByName configures the user entry of a cluster to obtain its token
+// from an exec-credential plugin instead of embedding a static token.
+// Any token previously stored in the entry is removed.
+func UpdateExecCredentialByName(c *api.Config, clusterID, clusterName, rancherURL string, execConfig *api.ExecConfig, autoCreate bool, logger *zap.Logger) error {
+	if authInfo, exists := c.AuthInfos[clusterName]; exists {
+		authInfo.Token = ""
+		authInfo.Exec = execConfig
+		return nil
+	}
 
+	if autoCreate {
+		createEntry(c, clusterID, clusterName, rancherURL, &api.AuthInfo{
+			Exec: execConfig,
+		})
 		logger.Info("Created new kubeconfig entry for cluster: " + clusterName)
 		return nil
 	}
@@ -105,6 +94,47 @@ func UpdateTokenByName(c *api.Config, clusterID, clusterName, token, rancherURL
 	return fmt.Errorf("user %s not found in kubeconfig", clusterName)
 }
 
+// createEntry creates the cluster, context, and user entries for a Rancher cluster
+func createEntry(c *api.Config, clusterID, clusterName, rancherURL string, authInfo *api.AuthInfo) {
+	// Initialize maps if nil
+	if c.Clusters == nil {
+		c.Clusters = make(map[string]*api.Cluster)
+	}
+	if c.Contexts == nil {
+		c.Contexts = make(map[string]*api.Context)
+	}
+	if c.AuthInfos == nil {
+		c.AuthInfos = make(map[string]*api.AuthInfo)
+	}
+
+	// Create new cluster entry with correct server URL using cluster ID
+	// Remove trailing slash from rancherURL to avoid double slashes
+	cleanURL := strings.TrimSuffix(rancherURL, "/")
+	c.Clusters[clusterName] = &api.Cluster{
+		Server: cleanURL + "/k8s/clusters/" + clusterID,
+	}
+
+	// Create new context entry
+	c.Contexts[clusterName] = &api.Context{
+		Cluster:  clusterName,
+		AuthInfo: clusterName,
+	}
+
+	// Create new user entry
+	c.AuthInfos[clusterName] = authInfo
+}
+
+// NewExecCredentialConfig returns the exec configuration that makes kubectl call
+// this tool's credential command for the given cluster.
+func NewExecCredentialConfig(command, clusterID string) *api.ExecConfig {
+	return &api.ExecConfig{
+		APIVersion:      "client.authentication.k8s.io/v1",
+		Command:         command,
+		Args:            []string{"credential", "--cluster", clusterID},
+		InteractiveMode: api.NeverExecInteractiveMode,
+	}
+}
+
 // MergeKubeconfig merges source kubeconfig into target for a specific cluster.
 // When withDirectly is true, includes all contexts (proxy + Downstream Directly).
 // When withDirectly is false, only includes the primary proxy context.
@@ -149,39 +179,112 @@ func MergeKubeconfig(target, source *api.Config, clusterName string, withDirectl
 	}
 }
 
+// RenameCluster renames the entries of a kubeconfig generated by Rancher for a cluster from
+// oldName to newName, so MergeKubeconfig can merge them under newName. The Downstream
+// Directly contexts named "{oldName}-{node}" are renamed to "{newName}-{node}".
+func RenameCluster(c *api.Config, oldName, newName string) error {
+	if oldName == newName {
+		return nil
+	}
+	directPrefix := oldName + "-"
+	var direct []string
+	for name := range c.Contexts {
+		if strings.HasPrefix(name, directPrefix) {
+			direct = append(direct, name)
+		}
+	}
+	sort.Strings(direct)
+
+	if err := RenameEntry(c, oldName, newName); err != nil {
+		return err
+	}
+	for _, name := range direct {
+		if err := RenameEntry(c, name, newName+"-"+strings.TrimPrefix(name, directPrefix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ExtractTokenFromKubeconfig extracts the token from a kubeconfig using CurrentContext chain.
 // This ensures deterministic behavior by following: CurrentContext -> Context -> AuthInfo -> Token
 // Returns the token and true if successfully extracted, or empty string and false otherwise.
 func ExtractTokenFromKubeconfig(kubeconfig *api.Config) (string, bool) {
-	if kubeconfig == nil {
+	authInfo, ok := currentAuthInfo(kubeconfig)
+	if !ok || authInfo.Token == "" {
 		return "", false
 	}
 
+	return authInfo.Token, true
+}
+
+// ExtractExecFromKubeconfig extracts the exec auth configuration from a kubeconfig using
+// the same CurrentContext chain as ExtractTokenFromKubeconfig.
+// Rancher generates such kubeconfigs instead of embedding a token when the server
+// setting kubeconfig-generate-token is false (authorized cluster endpoint / rancher CLI login).
+// Returns the exec config and true if present, or nil and false otherwise.
+func ExtractExecFromKubeconfig(kubeconfig *api.Config) (*api.ExecConfig, bool) {
+	authInfo, ok := currentAuthInfo(kubeconfig)
+	if !ok || authInfo.Exec == nil {
+		return nil, false
+	}
+
+	return authInfo.Exec.DeepCopy(), true
+}
+
+// currentAuthInfo follows CurrentContext -> Context -> AuthInfo and returns the AuthInfo
+func currentAuthInfo(kubeconfig *api.Config) (*api.AuthInfo, bool) {
+	if kubeconfig == nil {
+		return nil, false
+	}
+
 	// Use CurrentContext chain for deterministic extraction
 	currentContextName := kubeconfig.CurrentContext
 	if currentContextName == "" {
-		return "", false
+		return nil, false
 	}
 
 	ctx, ok := kubeconfig.Contexts[currentContextName]
 	if !ok || ctx == nil {
-		return "", false
+		return nil, false
 	}
 
 	if ctx.AuthInfo == "" {
-		return "", false
+		return nil, false
 	}
 
 	authInfo, ok := kubeconfig.AuthInfos[ctx.AuthInfo]
 	if !ok || authInfo == nil {
-		return "", false
+		return nil, false
 	}
 
-	if authInfo.Token == "" {
-		return "", false
+	return authInfo, true
+}
+
+// FindSharedTokens returns groups of user (AuthInfo) names that use the same token.
+// Only tokens used by more than one user are reported. Names within a group and
+// the groups themselves are sorted so the result is deterministic.
+func FindSharedTokens(c *api.Config) [][]string {
+	usersByToken := make(map[string][]string)
+	for name, authInfo := range c.AuthInfos {
+		if authInfo == nil || authInfo.Token == "" {
+			continue
+		}
+		usersByToken[authInfo.Token] = append(usersByToken[authInfo.Token], name)
 	}
 
-	return authInfo.Token, true
+	var groups [][]string
+	for _, users := range usersByToken {
+		if len(users) < 2 {
+			continue
+		}
+		sort.Strings(users)
+		groups = append(groups, users)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i][0] < groups[j][0]
+	})
+	return groups
 }
 
 // SaveKubeconfig saves a kubeconfig file using the following precedence order:
@@ -193,56 +296,48 @@ func ExtractTokenFromKubeconfig(kubeconfig *api.Config) (string, bool) {
 //   - If any file exists: writes to the first existing file
 //   - If no files exist: writes to the first file in the list
 //
-// The file is saved with secure permissions (0600 on Unix systems) and a backup
-// is created if the file already exists.
+// The file is saved with secure permissions (0600 on Unix systems) unless opts
+// say otherwise, and a backup is created if the file already exists.
 //
 // This implementation uses client-go's ClientConfigLoadingRules to ensure
 // compatibility with kubectl and other Kubernetes tools.
-func SaveKubeconfig(c *api.Config, path string, logger *zap.Logger) error {
+func SaveKubeconfig(c *api.Config, path string, logger *zap.Logger, opts ...SaveOption) error {
+	// The file is replaced atomically, so readers never see a partially written kubeconfig
+	tx := NewTransaction()
+	if _, err := tx.StageKubeconfig(c, path, logger, opts...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ErrNoHomeDir is returned when the kubeconfig path depends on a home directory the user
+// doesn't have, e.g. in scratch or distroless containers without a passwd entry.
+var ErrNoHomeDir = errors.New("no home directory to locate the kubeconfig in")
+
+// ResolvePath returns the kubeconfig file LoadKubeconfig and SaveKubeconfig use for path.
+// An empty path resolves through client-go's loading rules (KUBECONFIG, then ~/.kube/config).
+func ResolvePath(path string) (string, error) {
+	// Without a home directory client-go falls back to .kube/config in the working directory
+	if path == "" && os.Getenv(clientcmd.RecommendedConfigPathEnvVar) == "" {
+		if _, err := os.UserHomeDir(); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrNoHomeDir, err)
+		}
+	}
+
 	// Use client-go's loading rules to respect KUBECONFIG and handle all edge cases
-	// This follows kubectl behavior exactly for write operations
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 
 	// If an explicit path is provided, use it; otherwise, use client-go's default logic
 	if path != "" {
 		expandedPath, err := expandPath(path)
 		if err != nil {
-			return fmt.Errorf("failed to expand path %q: %w", path, err)
+			return "", fmt.Errorf("failed to expand path %q: %w", path, err)
 		}
 		loadingRules.ExplicitPath = expandedPath
 	}
 
 	// Get the actual file path we'll use (respects KUBECONFIG, precedence, etc.)
-	targetPath := loadingRules.GetDefaultFilename()
-
-	// 2. Ensure directory exists with platform-appropriate permissions
-	dir := filepath.Dir(targetPath)
-	if err := os.MkdirAll(dir, getSecureDirMode()); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
-	}
-
-	// 3. Create backup if file exists (fail if backup fails)
-	backupPath, err := createBackup(targetPath)
-	if err != nil {
-		return fmt.Errorf("failed to create backup: %w", err)
-	}
-
-	// Log backup path if a backup was created
-	if backupPath != "" && logger != nil {
-		logger.Info("Created backup of kubeconfig file: " + backupPath)
-	}
-
-	// 4. Write kubeconfig using client-go
-	if err := clientcmd.WriteToFile(*c, targetPath); err != nil {
-		return fmt.Errorf("failed to write kubeconfig file: %w", err)
-	}
-
-	// 5. Set secure file permissions (client-go might not set them correctly on all platforms)
-	if err := os.Chmod(targetPath, getSecureFileMode()); err != nil {
-		return fmt.Errorf("failed to set file permissions: %w", err)
-	}
-
-	return nil
+	return loadingRules.GetDefaultFilename(), nil
 }
 
 // getSecureFileMode returns the appropriate file mode for secure kubeconfig files
@@ -267,7 +362,7 @@ func getSecureDirMode() os.FileMode {
 func GetDefaultKubeconfigPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: %v", ErrNoHomeDir, err)
 	}
 	return filepath.Join(homeDir, ".kube", "config"), nil
 }
@@ -279,11 +374,14 @@ func expandPath(path string) (string, error) {
 		return GetDefaultKubeconfigPath()
 	}
 
+	// Expand %USERPROFILE% style variables (Windows only)
+	path = expandPlatformEnv(path)
+
 	// Handle ~ prefix (Unix-style)
 	if strings.HasPrefix(path, "~") {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
-			return "", fmt.Errorf("failed to get user home dir: %w", err)
+			return "", fmt.Errorf("%w: %v", ErrNoHomeDir, err)
 		}
 
 		if path == "~" {
@@ -302,9 +400,9 @@ func expandPath(path string) (string, error) {
 		// then convert to OS-specific separators
 		remainingPath = strings.ReplaceAll(remainingPath, "\\", "/")
 		remainingPath = filepath.FromSlash(remainingPath)
-		return filepath.Join(homeDir, remainingPath), nil
+		return platformLongPath(filepath.Join(homeDir, remainingPath)), nil
 	}
 
 	// Clean path (normalize separators)
-	return filepath.Clean(path), nil
+	return platformLongPath(filepath.Clean(path)), nil
 }
@@ -0,0 +1,91 @@
+package kubeconfig
+
+import (
+	"reflect"
+	"sort"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// MergeExternalChanges re-reads the kubeconfig at path and merges it with ours, so entries
+// that kubectl or other tools changed while the run was in progress aren't overwritten.
+// base is the kubeconfig as it was loaded at the start of the run. See ThreeWayMerge.
+func MergeExternalChanges(base, ours *api.Config, path string) (*api.Config, []string, error) {
+	theirs, err := LoadKubeconfig(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, conflicts := ThreeWayMerge(base, ours, theirs)
+	return merged, conflicts, nil
+}
+
+// ThreeWayMerge combines the changes ours and theirs made to base. An entry changed on only
+// one side takes that side's version. When both sides changed the same entry differently,
+// ours wins, except that an entry we removed but they modified is kept. The conflicting
+// entries are returned as "cluster NAME", "user NAME" or "context NAME".
+func ThreeWayMerge(base, ours, theirs *api.Config) (*api.Config, []string) {
+	if reflect.DeepEqual(base, theirs) {
+		return ours, nil
+	}
+
+	var conflicts []string
+	merged := theirs.DeepCopy()
+	merged.Clusters = mergeEntries(base.Clusters, ours.Clusters, theirs.Clusters, "cluster", &conflicts)
+	merged.AuthInfos = mergeEntries(base.AuthInfos, ours.AuthInfos, theirs.AuthInfos, "user", &conflicts)
+	merged.Contexts = mergeEntries(base.Contexts, ours.Contexts, theirs.Contexts, "context", &conflicts)
+	if ours.CurrentContext != base.CurrentContext {
+		merged.CurrentContext = ours.CurrentContext
+	}
+	if !reflect.DeepEqual(ours.Preferences, base.Preferences) {
+		merged.Preferences = ours.Preferences
+	}
+	if !reflect.DeepEqual(ours.Extensions, base.Extensions) {
+		merged.Extensions = ours.Extensions
+	}
+	return merged, conflicts
+}
+
+// mergeEntries three-way merges one of the named entry maps of a kubeconfig
+func mergeEntries[T any](base, ours, theirs map[string]T, kind string, conflicts *[]string) map[string]T {
+	names := make(map[string]bool)
+	for _, m := range []map[string]T{base, ours, theirs} {
+		for name := range m {
+			names[name] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	merged := make(map[string]T, len(sorted))
+	for _, name := range sorted {
+		baseEntry, inBase := base[name]
+		ourEntry, inOurs := ours[name]
+		theirEntry, inTheirs := theirs[name]
+
+		oursChanged := inOurs != inBase || (inOurs && !reflect.DeepEqual(ourEntry, baseEntry))
+		theirsChanged := inTheirs != inBase || (inTheirs && !reflect.DeepEqual(theirEntry, baseEntry))
+		sameChange := inOurs == inTheirs && (!inOurs || reflect.DeepEqual(ourEntry, theirEntry))
+
+		switch {
+		case !oursChanged:
+			if inTheirs {
+				merged[name] = theirEntry
+			}
+		case !theirsChanged || sameChange:
+			if inOurs {
+				merged[name] = ourEntry
+			}
+		case !inOurs:
+			// We removed an entry they modified; keep their version rather than lose it
+			*conflicts = append(*conflicts, kind+" "+name)
+			merged[name] = theirEntry
+		default:
+			*conflicts = append(*conflicts, kind+" "+name)
+			merged[name] = ourEntry
+		}
+	}
+	return merged
+}
@@ -0,0 +1,199 @@
+package kubeconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ExtensionName is the name of the extension that marks entries managed by this tool.
+const ExtensionName = "rancher-kubeconfig-updater"
+
+// Metadata is stored in the extensions of the clusters and contexts this tool creates.
+// Entries without it were not created by the tool and are never renamed or pruned.
+type Metadata struct {
+	ManagedBy   string    `json:"managedBy"`
+	RancherURL  string    `json:"rancherUrl"`
+	ClusterID   string    `json:"clusterId"`
+	LastRotated time.Time `json:"lastRotated,omitzero"`
+}
+
+// NewMetadata returns the metadata for an entry of the given Rancher cluster.
+func NewMetadata(rancherURL, clusterID string, lastRotated time.Time) Metadata {
+	return Metadata{
+		ManagedBy:   ExtensionName,
+		RancherURL:  strings.TrimSuffix(rancherURL, "/"),
+		ClusterID:   clusterID,
+		LastRotated: lastRotated.UTC(),
+	}
+}
+
+// SetMetadata stores md in the extensions of the cluster and context named name.
+// Missing entries are left missing.
+func SetMetadata(c *api.Config, name string, md Metadata) error {
+	raw, err := json.Marshal(md)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	if cluster, ok := c.Clusters[name]; ok && cluster != nil {
+		if cluster.Extensions == nil {
+			cluster.Extensions = make(map[string]runtime.Object)
+		}
+		cluster.Extensions[ExtensionName] = &runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}
+	}
+	if ctx, ok := c.Contexts[name]; ok && ctx != nil {
+		if ctx.Extensions == nil {
+			ctx.Extensions = make(map[string]runtime.Object)
+		}
+		ctx.Extensions[ExtensionName] = &runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}
+	}
+	return nil
+}
+
+// GetMetadata returns the metadata of the entry named name, read from its context
+// or, if the context has none, its cluster. Returns false for unannotated entries.
+func GetMetadata(c *api.Config, name string) (Metadata, bool) {
+	if ctx, ok := c.Contexts[name]; ok && ctx != nil {
+		if md, ok := decodeMetadata(ctx.Extensions); ok {
+			return md, true
+		}
+	}
+	if cluster, ok := c.Clusters[name]; ok && cluster != nil {
+		if md, ok := decodeMetadata(cluster.Extensions); ok {
+			return md, true
+		}
+	}
+	return Metadata{}, false
+}
+
+// decodeMetadata extracts this tool's metadata from an extensions map
+func decodeMetadata(extensions map[string]runtime.Object) (Metadata, bool) {
+	obj, ok := extensions[ExtensionName]
+	if !ok {
+		return Metadata{}, false
+	}
+	unknown, ok := obj.(*runtime.Unknown)
+	if !ok {
+		return Metadata{}, false
+	}
+
+	var md Metadata
+	if err := json.Unmarshal(unknown.Raw, &md); err != nil || md.ManagedBy != ExtensionName {
+		return Metadata{}, false
+	}
+	return md, true
+}
+
+// IsManaged reports whether the entry named name carries this tool's metadata.
+func IsManaged(c *api.Config, name string) bool {
+	_, ok := GetMetadata(c, name)
+	return ok
+}
+
+// HasManagedBy reports whether extensions hold an extension written by this tool, one whose
+// managedBy is ExtensionName. Only entries carrying one are ever removed.
+func HasManagedBy(extensions map[string]runtime.Object) bool {
+	for _, obj := range extensions {
+		unknown, ok := obj.(*runtime.Unknown)
+		if !ok {
+			continue
+		}
+		var owner struct {
+			ManagedBy string `json:"managedBy"`
+		}
+		if err := json.Unmarshal(unknown.Raw, &owner); err == nil && owner.ManagedBy == ExtensionName {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveContext removes the context named name and clears the current context if it was this
+// one. A context without a managed-by extension is left alone. Returns whether it was removed.
+func RemoveContext(c *api.Config, name string) bool {
+	ctx, ok := c.Contexts[name]
+	if !ok || ctx == nil || !HasManagedBy(ctx.Extensions) {
+		return false
+	}
+	delete(c.Contexts, name)
+	if c.CurrentContext == name {
+		c.CurrentContext = ""
+	}
+	return true
+}
+
+// RemoveCluster removes the cluster named name. A cluster without a managed-by extension is
+// left alone. Returns whether it was removed.
+func RemoveCluster(c *api.Config, name string) bool {
+	cluster, ok := c.Clusters[name]
+	if !ok || cluster == nil || !HasManagedBy(cluster.Extensions) {
+		return false
+	}
+	delete(c.Clusters, name)
+	return true
+}
+
+// FindManagedEntry returns the name of the managed entry for a Rancher cluster,
+// identified by Rancher URL and cluster ID rather than by name.
+func FindManagedEntry(c *api.Config, rancherURL, clusterID string) (string, bool) {
+	rancherURL = strings.TrimSuffix(rancherURL, "/")
+
+	names := make([]string, 0, len(c.Contexts))
+	for name := range c.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if md, ok := GetMetadata(c, name); ok && md.RancherURL == rancherURL && md.ClusterID == clusterID {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// RenameEntry renames the cluster, context and user entries named oldName to newName,
+// updating references and the current context. It fails if newName is already in use.
+func RenameEntry(c *api.Config, oldName, newName string) error {
+	if _, exists := c.Contexts[newName]; exists {
+		return fmt.Errorf("context %s already exists", newName)
+	}
+	if _, exists := c.Clusters[newName]; exists {
+		return fmt.Errorf("cluster %s already exists", newName)
+	}
+	if _, exists := c.AuthInfos[newName]; exists {
+		return fmt.Errorf("user %s already exists", newName)
+	}
+
+	if cluster, ok := c.Clusters[oldName]; ok {
+		delete(c.Clusters, oldName)
+		c.Clusters[newName] = cluster
+	}
+	if authInfo, ok := c.AuthInfos[oldName]; ok {
+		delete(c.AuthInfos, oldName)
+		c.AuthInfos[newName] = authInfo
+	}
+	if ctx, ok := c.Contexts[oldName]; ok {
+		delete(c.Contexts, oldName)
+		c.Contexts[newName] = ctx
+	}
+
+	for _, ctx := range c.Contexts {
+		if ctx.Cluster == oldName {
+			ctx.Cluster = newName
+		}
+		if ctx.AuthInfo == oldName {
+			ctx.AuthInfo = newName
+		}
+	}
+	if c.CurrentContext == oldName {
+		c.CurrentContext = newName
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package kubeconfig
+
+import (
+	"strings"
+)
+
+// windowsMaxPath is the classic MAX_PATH limit of the Windows API
+const windowsMaxPath = 260
+
+// expandPercentEnv expands Windows-style %VAR% references using lookup.
+// Unknown variables and unmatched percent signs are left unchanged, like cmd.exe does.
+func expandPercentEnv(path string, lookup func(string) (string, bool)) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(path, '%')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(path[start+1:], '%')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+
+		name := path[start+1 : end]
+		if value, ok := lookup(name); ok && name != "" {
+			b.WriteString(path[:start])
+			b.WriteString(value)
+			path = path[end+1:]
+			continue
+		}
+		// Keep the first percent sign; the closing one may open the next reference
+		b.WriteString(path[:end])
+		path = path[end:]
+	}
+	b.WriteString(path)
+	return b.String()
+}
+
+// windowsLongPath adds the \\?\ prefix to absolute Windows paths that exceed MAX_PATH,
+// using the \\?\UNC\ form for network paths. Paths that are short, relative or
+// already prefixed are returned unchanged.
+func windowsLongPath(path string) string {
+	if len(path) < windowsMaxPath || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	if strings.HasPrefix(path, `\\`) {
+		return `\\?\UNC\` + path[2:]
+	}
+	if len(path) >= 3 && path[1] == ':' && (path[2] == '\\' || path[2] == '/') {
+		return `\\?\` + strings.ReplaceAll(path, "/", `\`)
+	}
+	return path
+}
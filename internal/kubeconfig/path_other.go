@@ -0,0 +1,13 @@
+//go:build !windows
+
+package kubeconfig
+
+// expandPlatformEnv is a no-op outside Windows; shells expand $VAR themselves
+func expandPlatformEnv(path string) string {
+	return path
+}
+
+// platformLongPath is a no-op outside Windows
+func platformLongPath(path string) string {
+	return path
+}
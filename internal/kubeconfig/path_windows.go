@@ -0,0 +1,13 @@
+package kubeconfig
+
+import "os"
+
+// expandPlatformEnv expands %USERPROFILE% style variables in user-supplied paths
+func expandPlatformEnv(path string) string {
+	return expandPercentEnv(path, os.LookupEnv)
+}
+
+// platformLongPath makes paths longer than MAX_PATH usable, including UNC paths
+func platformLongPath(path string) string {
+	return windowsLongPath(path)
+}
@@ -0,0 +1,55 @@
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandPath_UserProfile(t *testing.T) {
+	profile := t.TempDir()
+	t.Setenv("USERPROFILE", profile)
+
+	got, err := expandPath(`%USERPROFILE%\.kube\config`)
+	if err != nil {
+		t.Fatalf("expandPath() error = %v", err)
+	}
+	want := filepath.Join(profile, ".kube", "config")
+	if got != want {
+		t.Errorf("expandPath() = %q, want %q", got, want)
+	}
+}
+
+func TestExpandPath_UNC(t *testing.T) {
+	got, err := expandPath(`\\server\share\kube\config`)
+	if err != nil {
+		t.Fatalf("expandPath() error = %v", err)
+	}
+	if got != `\\server\share\kube\config` {
+		t.Errorf("expandPath() = %q, want UNC path unchanged", got)
+	}
+}
+
+func TestSaveAndLoadKubeconfig_LongPath(t *testing.T) {
+	dir := t.TempDir()
+	for len(dir) < windowsMaxPath {
+		dir = filepath.Join(dir, strings.Repeat("d", 50))
+	}
+	path := filepath.Join(dir, "config")
+
+	if err := SaveKubeconfig(createTestKubeconfig(), path, createTestLogger()); err != nil {
+		t.Fatalf("SaveKubeconfig() error = %v", err)
+	}
+	if _, err := os.Stat(windowsLongPath(path)); err != nil {
+		t.Fatalf("kubeconfig not written: %v", err)
+	}
+
+	loaded, err := LoadKubeconfig(path)
+	if err != nil {
+		t.Fatalf("LoadKubeconfig() error = %v", err)
+	}
+	if _, ok := loaded.Contexts["test-cluster"]; !ok {
+		t.Error("expected test-cluster context after round trip")
+	}
+}
@@ -0,0 +1,151 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// SaveOption customizes how SaveKubeconfig and Transaction.StageKubeconfig write the kubeconfig.
+type SaveOption func(*saveOptions)
+
+type saveOptions struct {
+	fileMode os.FileMode
+	owner    *Owner
+	strategy WriteStrategy
+	noSync   bool
+}
+
+// WithFileMode writes the kubeconfig and its backup with mode instead of the default 0600.
+// A directory created for it gets the matching search permissions (e.g. 0750 for 0640).
+func WithFileMode(mode os.FileMode) SaveOption {
+	return func(o *saveOptions) {
+		o.fileMode = mode
+	}
+}
+
+// WithOwner changes the owner of the written kubeconfig, its backup and a newly created
+// directory. Changing the owner usually requires root privileges.
+func WithOwner(owner Owner) SaveOption {
+	return func(o *saveOptions) {
+		o.owner = &owner
+	}
+}
+
+// WithoutSync skips syncing the written files and their directories to disk. Saving is
+// faster, but a power loss shortly after can leave an empty or truncated kubeconfig.
+// It applies to every file of the transaction the kubeconfig is staged in.
+func WithoutSync() SaveOption {
+	return func(o *saveOptions) {
+		o.noSync = true
+	}
+}
+
+func newSaveOptions(opts []SaveOption) saveOptions {
+	o := saveOptions{fileMode: getSecureFileMode(), strategy: WriteStrategyRename}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// dirMode returns the mode for a directory created for the kubeconfig: the owner always
+// has full access, and whoever may read the file may also search the directory.
+func (o saveOptions) dirMode() os.FileMode {
+	if runtime.GOOS == "windows" {
+		return getSecureDirMode()
+	}
+	mode := getSecureDirMode()
+	if o.fileMode&0040 != 0 {
+		mode |= 0050
+	}
+	if o.fileMode&0004 != 0 {
+		mode |= 0005
+	}
+	return mode
+}
+
+// chown applies the configured owner to path, if any
+func (o saveOptions) chown(path string) error {
+	if o.owner == nil {
+		return nil
+	}
+	return os.Chown(path, o.owner.UID, o.owner.GID)
+}
+
+// Owner identifies a file owner. -1 leaves the user or group unchanged.
+type Owner struct {
+	UID int
+	GID int
+}
+
+// ParseFileMode parses an octal permission string such as "0640".
+// The owner must keep read and write access, since the tool rewrites the file.
+func ParseFileMode(s string) (os.FileMode, error) {
+	value, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || value > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q: must be an octal permission such as 0600 or 0640", s)
+	}
+	mode := os.FileMode(value)
+	if mode&0600 != 0600 {
+		return 0, fmt.Errorf("invalid file mode %q: the owner needs read and write access", s)
+	}
+	return mode, nil
+}
+
+// ParseOwner parses "user:group", "user" or ":group". Users and groups may be names or
+// numeric IDs. Not supported on Windows, which has no numeric owners.
+func ParseOwner(s string) (Owner, error) {
+	if runtime.GOOS == "windows" {
+		return Owner{}, fmt.Errorf("changing the file owner is not supported on Windows")
+	}
+
+	userPart, groupPart, _ := strings.Cut(s, ":")
+	if userPart == "" && groupPart == "" {
+		return Owner{}, fmt.Errorf("invalid owner %q: expected user:group", s)
+	}
+
+	owner := Owner{UID: -1, GID: -1}
+	if userPart != "" {
+		uid, err := lookupID(userPart, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return Owner{}, fmt.Errorf("invalid owner %q: unknown user %s: %w", s, userPart, err)
+		}
+		owner.UID = uid
+	}
+	if groupPart != "" {
+		gid, err := lookupID(groupPart, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return Owner{}, fmt.Errorf("invalid owner %q: unknown group %s: %w", s, groupPart, err)
+		}
+		owner.GID = gid
+	}
+	return owner, nil
+}
+
+// lookupID returns name as a number, or resolves it with lookup if it isn't numeric
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil && id >= 0 {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
@@ -0,0 +1,318 @@
+package kubeconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"runtime"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Transaction writes several files with all-or-nothing semantics.
+// Writes are staged first; Commit writes every file to a temporary file next to its
+// target and only then renames them into place. If a rename fails, targets that were
+// already replaced are restored, so the outputs never diverge from each other.
+//
+// Temporary files are synced to disk before the rename and the directories after it,
+// so a power loss right after Commit can't leave an empty or truncated file.
+type Transaction struct {
+	writes []stagedWrite
+	// logger reports fallbacks from rename to copy (may be nil)
+	logger *zap.Logger
+	// noSync skips syncing files and directories to disk
+	noSync bool
+}
+
+type stagedWrite struct {
+	path string
+	data []byte
+	perm os.FileMode
+	// owner is applied to the written file (nil keeps the process owner)
+	owner    *Owner
+	strategy WriteStrategy
+}
+
+// committedWrite remembers what a target looked like before it was replaced
+type committedWrite struct {
+	path     string
+	original []byte
+	existed  bool
+	perm     os.FileMode
+	strategy WriteStrategy
+}
+
+// NewTransaction creates an empty transaction.
+func NewTransaction() *Transaction {
+	return &Transaction{}
+}
+
+// Stage adds a file write to the transaction. Nothing is written until Commit.
+// If path is a symlink, the file it points to is written and the link is kept.
+func (t *Transaction) Stage(path string, data []byte, perm os.FileMode) {
+	t.stage(stagedWrite{path: path, data: data, perm: perm, strategy: WriteStrategyRename})
+}
+
+func (t *Transaction) stage(w stagedWrite) {
+	if resolved, err := filepath.EvalSymlinks(w.path); err == nil {
+		w.path = resolved
+	}
+	t.writes = append(t.writes, w)
+}
+
+// StageKubeconfig stages c to be written to the kubeconfig file that path resolves to
+// (see SaveKubeconfig). The target directory and a backup of the current file are
+// created right away. Returns the resolved target path.
+func (t *Transaction) StageKubeconfig(c *api.Config, path string, logger *zap.Logger, opts ...SaveOption) (string, error) {
+	o := newSaveOptions(opts)
+
+	targetPath, err := ResolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	if err := readonly.Check(targetPath); err != nil {
+		return "", err
+	}
+
+	data, err := clientcmd.Write(*c)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+
+	// Ensure directory exists with platform-appropriate permissions
+	dir := filepath.Dir(targetPath)
+	_, statErr := os.Stat(dir)
+	if err := os.MkdirAll(dir, o.dirMode()); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if os.IsNotExist(statErr) {
+		if err := o.chown(dir); err != nil {
+			return "", fmt.Errorf("failed to change owner of directory: %w", err)
+		}
+	}
+
+	// Create backup if file exists (fail if backup fails)
+	backupPath, err := createBackup(targetPath, o.fileMode)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	if backupPath != "" {
+		if err := o.chown(backupPath); err != nil {
+			return "", fmt.Errorf("failed to change owner of backup: %w", err)
+		}
+	}
+
+	// Log backup path if a backup was created
+	if backupPath != "" && logger != nil {
+		logger.Info("Created backup of kubeconfig file: " + backupPath)
+	}
+
+	if logger != nil {
+		t.logger = logger
+	}
+	if o.noSync {
+		t.noSync = true
+	}
+	t.stage(stagedWrite{path: targetPath, data: data, perm: o.fileMode, owner: o.owner, strategy: o.strategy})
+	return targetPath, nil
+}
+
+// Commit writes all staged files. On error no target is left modified.
+func (t *Transaction) Commit() error {
+	for _, w := range t.writes {
+		if err := readonly.Check(w.path); err != nil {
+			return err
+		}
+	}
+
+	// Phase 1: write every file next to its target (the copy strategy writes in place later)
+	temps := make([]string, len(t.writes))
+	removeTemps := func() {
+		for _, tmp := range temps {
+			if tmp != "" {
+				_ = os.Remove(tmp)
+			}
+		}
+	}
+	for i, w := range t.writes {
+		if w.strategy == WriteStrategyCopy {
+			continue
+		}
+		tmp, err := writeTempFile(w.path, w.data, w.perm, !t.noSync)
+		if err != nil {
+			removeTemps()
+			return fmt.Errorf("failed to write %s: %w", w.path, err)
+		}
+		temps[i] = tmp
+		if w.owner != nil {
+			if err := os.Chown(tmp, w.owner.UID, w.owner.GID); err != nil {
+				removeTemps()
+				return fmt.Errorf("failed to change owner of %s: %w", w.path, err)
+			}
+		}
+	}
+
+	// Phase 2: move them into place, remembering the originals for rollback
+	committed := make([]committedWrite, 0, len(t.writes))
+	for i, w := range t.writes {
+		prev := committedWrite{path: w.path, perm: w.perm, strategy: w.strategy}
+		if data, err := os.ReadFile(w.path); err == nil {
+			prev.original, prev.existed = data, true
+			if info, err := os.Stat(w.path); err == nil {
+				prev.perm = info.Mode().Perm()
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			removeTemps()
+			rollbackErr := rollback(committed)
+			return errors.Join(fmt.Errorf("failed to read %s: %w", w.path, err), rollbackErr)
+		}
+
+		// A failed copy may leave the target partially written, so it is rolled back too
+		committed = append(committed, prev)
+		if err := t.replace(w, temps[i]); err != nil {
+			removeTemps()
+			rollbackErr := rollback(committed)
+			return errors.Join(fmt.Errorf("failed to replace %s: %w", w.path, err), rollbackErr)
+		}
+		temps[i] = ""
+	}
+
+	// The renames are only durable once the directories holding them are synced
+	if !t.noSync {
+		t.syncDirs()
+	}
+	return nil
+}
+
+// syncDirs syncs the directories of all written files. The files are already in place,
+// so failures are only reported: some filesystems don't support syncing directories.
+func (t *Transaction) syncDirs() {
+	synced := make(map[string]bool)
+	for _, w := range t.writes {
+		dir := filepath.Dir(w.path)
+		if synced[dir] {
+			continue
+		}
+		synced[dir] = true
+		if err := syncDir(dir); err != nil && t.logger != nil {
+			t.logger.Warn("Failed to sync directory to disk", zap.String("path", dir), zap.Error(err))
+		}
+	}
+}
+
+// replace moves the temporary file tmp over the target of w, or copies the data in place
+// with the copy strategy or when the rename fails
+func (t *Transaction) replace(w stagedWrite, tmp string) error {
+	if w.strategy == WriteStrategyCopy {
+		return copyInto(w.path, w.data, w.perm, w.owner, !t.noSync)
+	}
+
+	renameErr := rename(tmp, w.path)
+	if renameErr == nil {
+		return nil
+	}
+	_ = os.Remove(tmp)
+
+	if t.logger != nil {
+		t.logger.Warn("Atomic rename failed, writing file in place instead",
+			zap.String("path", w.path), zap.Error(renameErr))
+	}
+	if err := copyInto(w.path, w.data, w.perm, w.owner, !t.noSync); err != nil {
+		return errors.Join(renameErr, err)
+	}
+	return nil
+}
+
+// rollback restores already replaced targets in reverse order, always syncing them to disk
+func rollback(committed []committedWrite) error {
+	var errs []error
+	for i := len(committed) - 1; i >= 0; i-- {
+		c := committed[i]
+		if !c.existed {
+			if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("failed to roll back %s: %w", c.path, err))
+			}
+			continue
+		}
+		var err error
+		if c.strategy == WriteStrategyCopy {
+			err = copyInto(c.path, c.original, c.perm, nil, true)
+		} else if err = atomicWriteFile(c.path, c.original, c.perm); err != nil {
+			err = copyInto(c.path, c.original, c.perm, nil, true)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to roll back %s: %w", c.path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// atomicWriteFile durably replaces path with data so readers see either the old or the new content
+func atomicWriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := writeTempFile(path, data, perm, true)
+	if err != nil {
+		return err
+	}
+	if err := rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	// Best effort: the file is already in place
+	_ = syncDir(filepath.Dir(path))
+	return nil
+}
+
+// writeTempFile writes data to a new temporary file in the directory of path
+// and returns the temporary file's name. With sync the data is flushed to disk.
+func writeTempFile(path string, data []byte, perm os.FileMode, sync bool) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmp := f.Name()
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+			return "", fmt.Errorf("failed to sync: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	// Set permissions explicitly, CreateTemp always uses 0600 and umask may differ
+	if err := os.Chmod(tmp, perm); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// syncDir flushes a directory's entries, making renames in it durable.
+// Windows can't sync directories; its rename is durable once it returns.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return err
+	}
+	return d.Close()
+}
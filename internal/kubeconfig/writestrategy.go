@@ -0,0 +1,85 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// WriteStrategy selects how a staged file replaces its target.
+type WriteStrategy string
+
+const (
+	// WriteStrategyRename writes a temporary file and renames it over the target, so
+	// readers see either the old or the new content. If the rename fails, as it can on
+	// some NFS mounts and OneDrive/Dropbox synced folders, the file is copied in place.
+	WriteStrategyRename WriteStrategy = "rename"
+	// WriteStrategyCopy always overwrites the target in place, syncs it to disk and
+	// verifies the written content. The file keeps its identity, which sync clients
+	// handle better than a replaced file.
+	WriteStrategyCopy WriteStrategy = "copy"
+)
+
+// ParseWriteStrategy parses a write strategy name; an empty string selects rename.
+func ParseWriteStrategy(s string) (WriteStrategy, error) {
+	switch WriteStrategy(s) {
+	case "", WriteStrategyRename:
+		return WriteStrategyRename, nil
+	case WriteStrategyCopy:
+		return WriteStrategyCopy, nil
+	default:
+		return "", fmt.Errorf("invalid write strategy %q. Must be 'rename' or 'copy'", s)
+	}
+}
+
+// WithWriteStrategy selects how the kubeconfig replaces the existing file.
+func WithWriteStrategy(strategy WriteStrategy) SaveOption {
+	return func(o *saveOptions) {
+		o.strategy = strategy
+	}
+}
+
+// rename moves a temporary file into place; replaced in tests to simulate filesystems
+// that don't support it
+var rename = os.Rename
+
+// copyInto overwrites path in place with data, syncs it (unless sync is false) and reads
+// it back to verify it
+func copyInto(path string, data []byte, perm os.FileMode, owner *Owner, sync bool) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("failed to sync: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// OpenFile only applies perm to new files
+	if err := os.Chmod(path, perm); err != nil {
+		return err
+	}
+	if owner != nil {
+		if err := os.Chown(path, owner.UID, owner.GID); err != nil {
+			return err
+		}
+	}
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to verify: %w", err)
+	}
+	if !bytes.Equal(written, data) {
+		return fmt.Errorf("failed to verify: content differs after writing")
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package logger
+
+import (
+	"os"
+	"rancher-kubeconfig-updater/internal/terminal"
+)
+
+// enableColor reports whether colored output can be written to f
+func enableColor(f *os.File) bool {
+	return terminal.IsTerminal(f)
+}
@@ -0,0 +1,23 @@
+package logger
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableColor reports whether colored output can be written to f. On Windows the
+// console's virtual terminal processing is switched on so ANSI color codes render.
+func enableColor(f *os.File) bool {
+	handle := windows.Handle(f.Fd())
+
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		// Not a console (redirected to a file or pipe)
+		return false
+	}
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return true
+	}
+	return windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"go.uber.org/zap/zapcore"
+)
+
+// pipeCore is a zapcore.Core for the PipeEncoder. Fields attached with With are kept as
+// fields and handed to the encoder with every entry, so they are formatted like the entry's
+// own fields (key="value") instead of by the embedded console encoder. A core is never
+// modified after creation, so loggers derived with With can be used from several goroutines.
+type pipeCore struct {
+	zapcore.LevelEnabler
+	enc     *PipeEncoder
+	out     zapcore.WriteSyncer
+	context []zapcore.Field
+}
+
+// newPipeCore returns a core writing entries encoded by enc to out.
+func newPipeCore(enc *PipeEncoder, out zapcore.WriteSyncer, level zapcore.LevelEnabler) zapcore.Core {
+	return &pipeCore{LevelEnabler: level, enc: enc, out: out}
+}
+
+// With returns a core that adds fields to every entry, after those attached before.
+func (c *pipeCore) With(fields []zapcore.Field) zapcore.Core {
+	context := make([]zapcore.Field, 0, len(c.context)+len(fields))
+	context = append(context, c.context...)
+	context = append(context, fields...)
+	return &pipeCore{LevelEnabler: c.LevelEnabler, enc: c.enc, out: c.out, context: context}
+}
+
+// Check adds the core to ce if the entry's level is enabled.
+func (c *pipeCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+// Write encodes the entry with the attached fields first and writes it. An attached field
+// is left out when the entry has a field with the same key, so code logging a field
+// explicitly doesn't print it twice under a logger that already carries it.
+func (c *pipeCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	all := fields
+	if len(c.context) > 0 {
+		all = make([]zapcore.Field, 0, len(c.context)+len(fields))
+		for _, field := range c.context {
+			if !hasKey(fields, field.Key) {
+				all = append(all, field)
+			}
+		}
+		all = append(all, fields...)
+	}
+	buf, err := c.enc.EncodeEntry(entry, all)
+	if err != nil {
+		return err
+	}
+	_, err = c.out.Write(buf.Bytes())
+	buf.Free()
+	if err != nil {
+		return err
+	}
+	if entry.Level > zapcore.ErrorLevel {
+		// Flush before a panic or fatal exit, as zapcore's own core does
+		_ = c.out.Sync()
+	}
+	return nil
+}
+
+// Sync flushes the output.
+func (c *pipeCore) Sync() error {
+	return c.out.Sync()
+}
+
+// hasKey reports whether one of fields has the key
+func hasKey(fields []zapcore.Field, key string) bool {
+	for _, field := range fields {
+		if field.Key == key {
+			return true
+		}
+	}
+	return false
+}
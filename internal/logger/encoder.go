@@ -3,7 +3,9 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"math"
+	"os"
 	"strings"
 	"time"
 
@@ -14,15 +16,25 @@ import (
 
 // PipeEncoder is a custom zapcore.Encoder that outputs fields in pipe-delimited format.
 // Instead of JSON format like {"key": "value"}, it outputs: key="value" | key=123
+// Encoding an entry does not modify the encoder, so it is safe for concurrent use.
 type PipeEncoder struct {
 	zapcore.Encoder
 	pool      buffer.Pool
 	separator string
-	fields    []string
 }
 
 // NewPipeEncoder creates a new PipeEncoder with the specified separator.
 func NewPipeEncoder(separator string) *PipeEncoder {
+	return newPipeEncoder(separator, false)
+}
+
+// newPipeEncoder creates a PipeEncoder, optionally coloring the level with ANSI codes.
+func newPipeEncoder(separator string, color bool) *PipeEncoder {
+	levelEncoder := zapcore.CapitalLevelEncoder
+	if color {
+		levelEncoder = zapcore.CapitalColorLevelEncoder
+	}
+
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:          "time",
 		LevelKey:         "level",
@@ -32,7 +44,7 @@ func NewPipeEncoder(separator string) *PipeEncoder {
 		MessageKey:       "msg",
 		StacktraceKey:    "",
 		LineEnding:       zapcore.DefaultLineEnding,
-		EncodeLevel:      zapcore.CapitalLevelEncoder,
+		EncodeLevel:      levelEncoder,
 		EncodeTime:       zapcore.ISO8601TimeEncoder,
 		EncodeDuration:   zapcore.StringDurationEncoder,
 		EncodeCaller:     zapcore.ShortCallerEncoder,
@@ -43,7 +55,6 @@ func NewPipeEncoder(separator string) *PipeEncoder {
 		Encoder:   zapcore.NewConsoleEncoder(encoderConfig),
 		pool:      buffer.NewPool(),
 		separator: separator,
-		fields:    make([]string, 0),
 	}
 }
 
@@ -53,29 +64,30 @@ func (e *PipeEncoder) Clone() zapcore.Encoder {
 		Encoder:   e.Encoder.Clone(),
 		pool:      e.pool,
 		separator: e.separator,
-		fields:    append([]string{}, e.fields...),
 	}
 }
 
 // EncodeEntry encodes a log entry with pipe-delimited fields.
 func (e *PipeEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
-	// Create a clone to collect fields without modifying the original
-	clone := e.Clone().(*PipeEncoder)
-	clone.fields = make([]string, 0)
+	// Secrets must not reach the output, whatever the level
+	entry.Message = Redact(entry.Message)
 
-	// Process each field to collect formatted strings
+	// Format the fields into a slice of this call, so concurrent entries don't share state
+	formatted := make([]string, 0, len(fields))
 	for _, field := range fields {
-		clone.addField(field)
+		if f, ok := formatField(field); ok {
+			formatted = append(formatted, f)
+		}
 	}
 
 	// Encode the base entry (timestamp | LEVEL | message) without fields
-	buf, err := clone.Encoder.EncodeEntry(entry, nil)
+	buf, err := e.Encoder.EncodeEntry(entry, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	// If we have fields, append them in pipe-delimited format
-	if len(clone.fields) > 0 {
+	if len(formatted) > 0 {
 		// Remove the trailing newline to append fields
 		content := buf.String()
 		content = strings.TrimSuffix(content, "\n")
@@ -84,7 +96,7 @@ func (e *PipeEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (
 		newBuf := e.pool.Get()
 		newBuf.AppendString(content)
 
-		for _, f := range clone.fields {
+		for _, f := range formatted {
 			newBuf.AppendString(e.separator)
 			newBuf.AppendString(f)
 		}
@@ -97,70 +109,86 @@ func (e *PipeEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (
 	return buf, nil
 }
 
-// addField processes a single field and adds it to the fields slice.
-func (e *PipeEncoder) addField(field zapcore.Field) {
+// formatField formats a single field as key=value, or reports false for fields without a value.
+// Values of sensitive keys are replaced and string values are scrubbed of tokens.
+func formatField(field zapcore.Field) (string, bool) {
+	if isSensitiveKey(field.Key) {
+		return fmt.Sprintf("%s=%q", field.Key, redacted), true
+	}
+
 	switch field.Type {
 	case zapcore.StringType:
-		e.fields = append(e.fields, fmt.Sprintf("%s=%q", field.Key, field.String))
+		return fmt.Sprintf("%s=%q", field.Key, Redact(field.String)), true
 
 	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type:
-		e.fields = append(e.fields, fmt.Sprintf("%s=%d", field.Key, field.Integer))
+		return fmt.Sprintf("%s=%d", field.Key, field.Integer), true
 
 	case zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type:
-		e.fields = append(e.fields, fmt.Sprintf("%s=%d", field.Key, field.Integer))
+		return fmt.Sprintf("%s=%d", field.Key, field.Integer), true
 
 	case zapcore.Float64Type:
-		e.fields = append(e.fields, fmt.Sprintf("%s=%.2f", field.Key, math.Float64frombits(uint64(field.Integer))))
+		return fmt.Sprintf("%s=%.2f", field.Key, math.Float64frombits(uint64(field.Integer))), true
 
 	case zapcore.Float32Type:
-		e.fields = append(e.fields, fmt.Sprintf("%s=%.2f", field.Key, math.Float32frombits(uint32(field.Integer))))
+		return fmt.Sprintf("%s=%.2f", field.Key, math.Float32frombits(uint32(field.Integer))), true
 
 	case zapcore.BoolType:
 		val := "false"
 		if field.Integer == 1 {
 			val = "true"
 		}
-		e.fields = append(e.fields, fmt.Sprintf("%s=%s", field.Key, val))
+		return fmt.Sprintf("%s=%s", field.Key, val), true
 
 	case zapcore.TimeType:
 		t := time.Unix(0, field.Integer)
 		if field.Interface != nil {
 			t = t.In(field.Interface.(*time.Location))
 		}
-		e.fields = append(e.fields, fmt.Sprintf("%s=%q", field.Key, t.Format(time.RFC3339)))
+		return fmt.Sprintf("%s=%q", field.Key, t.Format(time.RFC3339)), true
 
 	case zapcore.DurationType:
 		d := time.Duration(field.Integer)
-		e.fields = append(e.fields, fmt.Sprintf("%s=%q", field.Key, d.String()))
+		return fmt.Sprintf("%s=%q", field.Key, d.String()), true
 
 	case zapcore.ErrorType:
 		if err, ok := field.Interface.(error); ok {
-			e.fields = append(e.fields, fmt.Sprintf("%s=%q", field.Key, err.Error()))
+			return fmt.Sprintf("%s=%q", field.Key, Redact(err.Error())), true
 		}
 
 	case zapcore.StringerType:
 		if stringer, ok := field.Interface.(fmt.Stringer); ok {
-			e.fields = append(e.fields, fmt.Sprintf("%s=%q", field.Key, stringer.String()))
+			return fmt.Sprintf("%s=%q", field.Key, Redact(stringer.String())), true
 		}
 
 	default:
 		// For complex types, use the default string representation
 		if field.Interface != nil {
-			e.fields = append(e.fields, fmt.Sprintf("%s=%q", field.Key, fmt.Sprintf("%v", field.Interface)))
+			return fmt.Sprintf("%s=%q", field.Key, Redact(fmt.Sprintf("%v", field.Interface))), true
 		}
 	}
+	return "", false
 }
 
 // NewPipeEncoderCore creates a zapcore.Core with the PipeEncoder.
+// Levels are colored when stdout is a terminal and NO_COLOR is not set.
 func NewPipeEncoderCore(level zapcore.Level) zapcore.Core {
-	encoder := NewPipeEncoder(" | ")
-	return zapcore.NewCore(
+	encoder := newPipeEncoder(" | ", useColor(os.Stdout))
+	return newPipeCore(
 		encoder,
 		zapcore.AddSync(zapcore.Lock(zapcore.AddSync(createStdoutSyncer()))),
 		level,
 	)
 }
 
+// useColor reports whether log output to f should be colored.
+// See https://no-color.org for the NO_COLOR convention.
+func useColor(f *os.File) bool {
+	if _, disabled := os.LookupEnv("NO_COLOR"); disabled {
+		return false
+	}
+	return enableColor(f)
+}
+
 // createStdoutSyncer creates a write syncer for stdout.
 func createStdoutSyncer() zapcore.WriteSyncer {
 	return zapcore.AddSync(&stdoutWriter{})
@@ -184,3 +212,11 @@ func NewLoggerWithLevel(level zapcore.Level) *zap.Logger {
 	core := NewPipeEncoderCore(level)
 	return zap.New(core)
 }
+
+// NewLoggerWithWriter creates a new zap.Logger with the PipeEncoder that writes to w.
+// This is used by commands whose stdout is reserved for machine-readable output.
+func NewLoggerWithWriter(w io.Writer, level zapcore.Level) *zap.Logger {
+	encoder := NewPipeEncoder(" | ")
+	core := newPipeCore(encoder, zapcore.Lock(zapcore.AddSync(w)), level)
+	return zap.New(core)
+}
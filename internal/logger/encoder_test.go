@@ -3,7 +3,9 @@ package logger
 import (
 	"bytes"
 	"errors"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -199,3 +201,130 @@ func TestNewLoggerWithLevel(t *testing.T) {
 	logger := NewLoggerWithLevel(zapcore.DebugLevel)
 	assert.NotNil(t, logger)
 }
+
+func TestNewLoggerWithWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithWriter(&buf, zapcore.InfoLevel)
+
+	logger.Debug("hidden")
+	logger.Info("visible", zap.String("cluster", "prod"))
+
+	output := buf.String()
+	assert.NotContains(t, output, "hidden")
+	assert.Contains(t, output, `visible | cluster="prod"`)
+}
+
+func TestPipeEncoder_NoSecretsAtAnyLevel(t *testing.T) {
+	const secret = "kt9xq2mwz8v4bd7c5lp"
+	const token = "token-abc12:" + secret
+	const kubeconfigToken = "kubeconfig-u-abc12:" + secret
+
+	levels := []zapcore.Level{zapcore.DebugLevel, zapcore.InfoLevel, zapcore.WarnLevel, zapcore.ErrorLevel}
+	for _, level := range levels {
+		t.Run(level.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := NewLoggerWithWriter(&buf, zapcore.DebugLevel)
+
+			logger.Check(level, "Login with "+token).Write(
+				zap.String("password", "hunter2"),
+				zap.ByteString("secret", []byte(secret)),
+				zap.String("token", token),
+				zap.String("kubeconfig", "token: "+kubeconfigToken),
+				zap.String("generated", kubeconfigToken),
+				zap.Error(errors.New("request failed: Authorization: Bearer "+secret)),
+				zap.Any("headers", map[string]string{"Authorization": "Bearer " + secret}),
+			)
+
+			output := buf.String()
+			assert.NotEmpty(t, output)
+			assert.NotContains(t, output, secret)
+			assert.NotContains(t, output, "hunter2")
+			assert.Contains(t, output, `password="[REDACTED]"`)
+			assert.Contains(t, output, "token-abc12:[REDACTED]")
+			assert.Contains(t, output, "kubeconfig-u-abc12:[REDACTED]")
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"rancher token", "token-x7k2p:abcdefghij", "token-x7k2p:[REDACTED]"},
+		{"kubeconfig token", "token: kubeconfig-u-x7k2p:abcdefghij", "token: kubeconfig-u-x7k2p:[REDACTED]"},
+		{"bearer header", "Authorization: Bearer abc.def", "Authorization: Bearer [REDACTED]"},
+		{"token name only", "token-x7k2p", "token-x7k2p"},
+		{"plain text", "cluster updated", "cluster updated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Redact(tt.input))
+		})
+	}
+}
+
+func TestUseColor_NoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	assert.False(t, useColor(os.Stdout))
+}
+
+func TestPipeEncoder_NoColorByDefault(t *testing.T) {
+	encoder := NewPipeEncoder(" | ")
+	entry := zapcore.Entry{Level: zapcore.WarnLevel, Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Message: "msg"}
+
+	buf, err := encoder.EncodeEntry(entry, nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), "\x1b[")
+}
+
+func TestPipeEncoder_Color(t *testing.T) {
+	encoder := newPipeEncoder(" | ", true)
+	entry := zapcore.Entry{Level: zapcore.WarnLevel, Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Message: "msg"}
+
+	buf, err := encoder.EncodeEntry(entry, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "\x1b[33mWARN\x1b[0m")
+}
+
+func TestNewLoggerWithWriter_WithFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithWriter(&buf, zapcore.InfoLevel).With(zap.String("cluster", "prod"), zap.String("clusterID", "c-m-1"))
+
+	logger.Info("Token regenerated", zap.Int("attempt", 2))
+	logger.Info("Skipping cluster", zap.String("cluster", "prod"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `Token regenerated | cluster="prod" | clusterID="c-m-1" | attempt=2`)
+	assert.NotContains(t, lines[0], `{"cluster"`)
+	assert.Equal(t, 1, strings.Count(lines[1], "cluster="), "an explicit field replaces the attached one")
+	assert.Contains(t, lines[1], `clusterID="c-m-1"`)
+}
+
+func TestNewLoggerWithWriter_Concurrent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithWriter(&buf, zapcore.InfoLevel)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		clusterLogger := logger.With(zap.Int("worker", i))
+		wg.Go(func() {
+			for range 50 {
+				clusterLogger.Info("Processing", zap.Int("cluster", i))
+			}
+		})
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 1000)
+	for _, line := range lines {
+		parts := strings.Split(line, " | ")
+		if assert.Len(t, parts, 5, line) {
+			// Each line carries the fields of its own worker
+			assert.Equal(t, strings.TrimPrefix(parts[3], "worker="), strings.TrimPrefix(parts[4], "cluster="), line)
+		}
+	}
+}
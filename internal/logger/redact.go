@@ -0,0 +1,38 @@
+package logger
+
+import (
+	"regexp"
+	"strings"
+)
+
+// redacted replaces secret values in log output.
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are field keys whose values are never logged.
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"secret":        true,
+	"authorization": true,
+	"bearertoken":   true,
+	"apikey":        true,
+}
+
+// rancherTokenPattern matches Rancher API tokens ("token-<name>:<secret>") and generated
+// kubeconfig tokens ("kubeconfig-u-<name>:<secret>"). The token name is kept so log lines
+// stay useful; only the secret part is removed.
+var rancherTokenPattern = regexp.MustCompile(`(token-[a-z0-9]+|kubeconfig-[a-z0-9-]+):[A-Za-z0-9]+`)
+
+// bearerPattern matches bearer credentials in headers or error messages.
+var bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)\S+`)
+
+// isSensitiveKey reports whether a field with this key must not be logged.
+func isSensitiveKey(key string) bool {
+	return sensitiveKeys[strings.ToLower(key)]
+}
+
+// Redact removes Rancher tokens and bearer credentials from s.
+func Redact(s string) string {
+	s = rancherTokenPattern.ReplaceAllString(s, "${1}:"+redacted)
+	return bearerPattern.ReplaceAllString(s, "${1}"+redacted)
+}
@@ -0,0 +1,192 @@
+// Package manifest renders Kubernetes manifests that carry a refreshed kubeconfig into a
+// cluster, so GitOps pipelines can commit them right after rotation: a plain Secret,
+// a Bitnami SealedSecret, or an External Secrets Operator ExternalSecret.
+package manifest
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format selects the kind of manifest.
+type Format string
+
+const (
+	// FormatSecret is a plain v1 Secret (the kubeconfig is only base64 encoded)
+	FormatSecret Format = "secret"
+	// FormatSealedSecret is a SealedSecret encrypted for a sealed-secrets controller
+	FormatSealedSecret Format = "sealed-secret"
+	// FormatExternalSecret is an ExternalSecret that pulls the kubeconfig from a secret manager
+	FormatExternalSecret Format = "external-secret"
+)
+
+// ParseFormat validates a manifest format name. An empty value selects FormatSecret.
+func ParseFormat(value string) (Format, error) {
+	switch f := Format(value); f {
+	case "":
+		return FormatSecret, nil
+	case FormatSecret, FormatSealedSecret, FormatExternalSecret:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid manifest format %q. Must be 'secret', 'sealed-secret' or 'external-secret'", value)
+	}
+}
+
+// DataKey is the key of the kubeconfig in the generated Secret.
+const DataKey = "config"
+
+// Target names the Secret the manifest produces in the cluster.
+type Target struct {
+	Namespace string
+	Name      string
+}
+
+// ParseTarget parses "namespace/name"; a bare name is placed in the default namespace.
+func ParseTarget(value string) (Target, error) {
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok {
+		namespace, name = "default", value
+	}
+	if namespace == "" || name == "" || strings.Contains(name, "/") {
+		return Target{}, fmt.Errorf("invalid secret %q: expected namespace/name", value)
+	}
+	return Target{Namespace: namespace, Name: name}, nil
+}
+
+// metadata is the object metadata of a manifest
+type metadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+func (t Target) metadata() metadata {
+	return metadata{Name: t.Name, Namespace: t.Namespace}
+}
+
+// Secret renders a v1 Secret holding kubeconfig.
+func Secret(target Target, kubeconfig []byte) ([]byte, error) {
+	return encode(struct {
+		APIVersion string            `yaml:"apiVersion"`
+		Kind       string            `yaml:"kind"`
+		Metadata   metadata          `yaml:"metadata"`
+		Type       string            `yaml:"type"`
+		Data       map[string]string `yaml:"data"`
+	}{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   target.metadata(),
+		Type:       "Opaque",
+		Data:       map[string]string{DataKey: base64.StdEncoding.EncodeToString(kubeconfig)},
+	})
+}
+
+// SealedSecret renders a SealedSecret holding kubeconfig, encrypted with the public key of
+// a sealed-secrets controller. It uses the strict scope: the controller only unseals it
+// under the target's namespace and name.
+func SealedSecret(target Target, kubeconfig []byte, key *rsa.PublicKey) ([]byte, error) {
+	sealed, err := seal(key, kubeconfig, []byte(target.Namespace+"/"+target.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal kubeconfig: %w", err)
+	}
+
+	type template struct {
+		Metadata metadata `yaml:"metadata"`
+		Type     string   `yaml:"type"`
+	}
+	type spec struct {
+		EncryptedData map[string]string `yaml:"encryptedData"`
+		Template      template          `yaml:"template"`
+	}
+	return encode(struct {
+		APIVersion string   `yaml:"apiVersion"`
+		Kind       string   `yaml:"kind"`
+		Metadata   metadata `yaml:"metadata"`
+		Spec       spec     `yaml:"spec"`
+	}{
+		APIVersion: "bitnami.com/v1alpha1",
+		Kind:       "SealedSecret",
+		Metadata:   target.metadata(),
+		Spec: spec{
+			EncryptedData: map[string]string{DataKey: base64.StdEncoding.EncodeToString(sealed)},
+			Template:      template{Metadata: target.metadata(), Type: "Opaque"},
+		},
+	})
+}
+
+// StoreRef names the SecretStore or ClusterSecretStore an ExternalSecret reads from.
+type StoreRef struct {
+	Kind string
+	Name string
+}
+
+// ParseStoreRef parses "name" (a SecretStore) or "ClusterSecretStore/name".
+func ParseStoreRef(value string) (StoreRef, error) {
+	kind, name, ok := strings.Cut(value, "/")
+	if !ok {
+		kind, name = "SecretStore", value
+	}
+	if (kind != "SecretStore" && kind != "ClusterSecretStore") || name == "" {
+		return StoreRef{}, fmt.Errorf("invalid secret store %q: expected NAME or ClusterSecretStore/NAME", value)
+	}
+	return StoreRef{Kind: kind, Name: name}, nil
+}
+
+// ExternalSecret renders an ExternalSecret that fills the target Secret with the kubeconfig
+// kept in the secret manager under remoteKey. It holds no credentials itself.
+func ExternalSecret(target Target, store StoreRef, remoteKey string) ([]byte, error) {
+	type remoteRef struct {
+		Key string `yaml:"key"`
+	}
+	type data struct {
+		SecretKey string    `yaml:"secretKey"`
+		RemoteRef remoteRef `yaml:"remoteRef"`
+	}
+	type storeRef struct {
+		Name string `yaml:"name"`
+		Kind string `yaml:"kind"`
+	}
+	type secretTarget struct {
+		Name string `yaml:"name"`
+	}
+	type spec struct {
+		RefreshInterval string       `yaml:"refreshInterval"`
+		SecretStoreRef  storeRef     `yaml:"secretStoreRef"`
+		Target          secretTarget `yaml:"target"`
+		Data            []data       `yaml:"data"`
+	}
+	return encode(struct {
+		APIVersion string   `yaml:"apiVersion"`
+		Kind       string   `yaml:"kind"`
+		Metadata   metadata `yaml:"metadata"`
+		Spec       spec     `yaml:"spec"`
+	}{
+		APIVersion: "external-secrets.io/v1",
+		Kind:       "ExternalSecret",
+		Metadata:   target.metadata(),
+		Spec: spec{
+			RefreshInterval: "1h",
+			SecretStoreRef:  storeRef{Name: store.Name, Kind: store.Kind},
+			Target:          secretTarget{Name: target.Name},
+			Data:            []data{{SecretKey: DataKey, RemoteRef: remoteRef{Key: remoteKey}}},
+		},
+	})
+}
+
+// encode marshals a manifest as YAML with two-space indentation
+func encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,159 @@
+package manifest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseTarget(t *testing.T) {
+	target, err := ParseTarget("ci/rancher-kubeconfig")
+	require.NoError(t, err)
+	assert.Equal(t, Target{Namespace: "ci", Name: "rancher-kubeconfig"}, target)
+
+	target, err = ParseTarget("rancher-kubeconfig")
+	require.NoError(t, err)
+	assert.Equal(t, "default", target.Namespace)
+
+	for _, bad := range []string{"", "ci/", "/name", "a/b/c"} {
+		_, err := ParseTarget(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestSecret(t *testing.T) {
+	out, err := Secret(Target{Namespace: "ci", Name: "kube"}, []byte("apiVersion: v1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: v1
+kind: Secret
+metadata:
+  name: kube
+  namespace: ci
+type: Opaque
+data:
+  config: YXBpVmVyc2lvbjogdjEK
+`, string(out))
+}
+
+func TestExternalSecret(t *testing.T) {
+	store, err := ParseStoreRef("ClusterSecretStore/gcp")
+	require.NoError(t, err)
+	out, err := ExternalSecret(Target{Namespace: "ci", Name: "kube"}, store, "rancher-kubeconfig")
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: external-secrets.io/v1
+kind: ExternalSecret
+metadata:
+  name: kube
+  namespace: ci
+spec:
+  refreshInterval: 1h
+  secretStoreRef:
+    name: gcp
+    kind: ClusterSecretStore
+  target:
+    name: kube
+  data:
+    - secretKey: config
+      remoteRef:
+        key: rancher-kubeconfig
+`, string(out))
+
+	store, err = ParseStoreRef("vault")
+	require.NoError(t, err)
+	assert.Equal(t, StoreRef{Kind: "SecretStore", Name: "vault"}, store)
+	_, err = ParseStoreRef("Store/vault")
+	assert.Error(t, err)
+}
+
+// newSealingCert returns a sealed-secrets style controller certificate and its private key
+func newSealingCert(t *testing.T) ([]byte, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sealed-secret"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), key
+}
+
+// unseal reverses seal like the sealed-secrets controller does
+func unseal(t *testing.T, key *rsa.PrivateKey, sealed, label []byte) []byte {
+	t.Helper()
+	keyLen := int(binary.BigEndian.Uint16(sealed))
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, sealed[2:2+keyLen], label)
+	require.NoError(t, err)
+	block, err := aes.NewCipher(sessionKey)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	plaintext, err := gcm.Open(nil, make([]byte, gcm.NonceSize()), sealed[2+keyLen:], nil)
+	require.NoError(t, err)
+	return plaintext
+}
+
+func TestSealedSecret(t *testing.T) {
+	certPEM, privateKey := newSealingCert(t)
+	key, err := ParseSealingKey(certPEM)
+	require.NoError(t, err)
+
+	out, err := SealedSecret(Target{Namespace: "ci", Name: "kube"}, []byte("apiVersion: v1\n"), key)
+	require.NoError(t, err)
+
+	var doc struct {
+		Kind string `yaml:"kind"`
+		Spec struct {
+			EncryptedData map[string]string `yaml:"encryptedData"`
+			Template      struct {
+				Metadata metadata `yaml:"metadata"`
+			} `yaml:"template"`
+		} `yaml:"spec"`
+	}
+	require.NoError(t, yaml.Unmarshal(out, &doc))
+	assert.Equal(t, "SealedSecret", doc.Kind)
+	assert.Equal(t, metadata{Name: "kube", Namespace: "ci"}, doc.Spec.Template.Metadata)
+	assert.NotContains(t, string(out), "apiVersion: v1\n", "the kubeconfig must not appear in clear text")
+
+	sealed, err := base64.StdEncoding.DecodeString(doc.Spec.EncryptedData[DataKey])
+	require.NoError(t, err)
+	assert.Equal(t, "apiVersion: v1\n", string(unseal(t, privateKey, sealed, []byte("ci/kube"))))
+
+	_, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, sealed[2:2+int(binary.BigEndian.Uint16(sealed))], []byte("other/kube"))
+	assert.Error(t, err, "strict scope binds the secret to its namespace and name")
+}
+
+func TestParseSealingKey_Invalid(t *testing.T) {
+	_, err := ParseSealingKey([]byte("not a certificate"))
+	assert.Error(t, err)
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, FormatSecret, format)
+
+	format, err = ParseFormat("sealed-secret")
+	require.NoError(t, err)
+	assert.Equal(t, FormatSealedSecret, format)
+
+	_, err = ParseFormat("configmap")
+	assert.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package manifest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ParseSealingKey reads the public key from a sealed-secrets controller certificate
+// in PEM form, as printed by `kubeseal --fetch-cert`.
+func ParseSealingKey(certPEM []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("certificate does not hold an RSA public key")
+	}
+	return key, nil
+}
+
+// seal encrypts plaintext the way kubeseal does: a random AES-256 session key encrypts the
+// data with GCM and is itself encrypted with RSA-OAEP, using label to bind it to the scope.
+// The result is the 2-byte length of the encrypted key, the encrypted key, and the ciphertext.
+func seal(key *rsa.PublicKey, plaintext, label []byte) ([]byte, error) {
+	sessionKey := make([]byte, 32)
+	if _, err := rand.Read(sessionKey); err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, sessionKey, label)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// The session key is used only once, so a zero nonce is safe (and what kubeseal expects)
+	out := binary.BigEndian.AppendUint16(nil, uint16(len(encryptedKey)))
+	out = append(out, encryptedKey...)
+	return gcm.Seal(out, make([]byte, gcm.NonceSize()), plaintext, nil), nil
+}
@@ -0,0 +1,125 @@
+// Package metrics records the latency and errors of the requests sent to Rancher and serves
+// them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the request duration histogram
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry collects request metrics per Rancher API endpoint. It is safe for concurrent use.
+type Registry struct {
+	buckets []float64
+
+	mu        sync.Mutex
+	endpoints map[string]*endpoint
+}
+
+// endpoint holds the metrics of one endpoint
+type endpoint struct {
+	// counts[i] is the number of requests that took at most buckets[i]
+	counts []uint64
+	sum    float64
+	total  uint64
+	// codes counts responses by status code, "0" for requests without a response
+	codes  map[string]uint64
+	errors uint64
+}
+
+// New returns an empty registry using DefaultBuckets.
+func New() *Registry {
+	return &Registry{buckets: DefaultBuckets, endpoints: make(map[string]*endpoint)}
+}
+
+// Observe records a request to endpoint that ended with status (0 if no response arrived)
+// after elapsed. Requests without a response and responses with status 400 and above are errors.
+func (r *Registry) Observe(endpointName string, status int, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.endpoints[endpointName]
+	if !ok {
+		e = &endpoint{counts: make([]uint64, len(r.buckets)), codes: make(map[string]uint64)}
+		r.endpoints[endpointName] = e
+	}
+	seconds := elapsed.Seconds()
+	for i, bound := range r.buckets {
+		if seconds <= bound {
+			e.counts[i]++
+		}
+	}
+	e.sum += seconds
+	e.total++
+	e.codes[strconv.Itoa(status)]++
+	if status == 0 || status >= 400 {
+		e.errors++
+	}
+}
+
+// WriteText writes the metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.endpoints))
+	for name := range r.endpoints {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	b.WriteString("# HELP rancher_api_request_duration_seconds Duration of Rancher API requests.\n")
+	b.WriteString("# TYPE rancher_api_request_duration_seconds histogram\n")
+	for _, name := range names {
+		e := r.endpoints[name]
+		for i, bound := range r.buckets {
+			fmt.Fprintf(&b, "rancher_api_request_duration_seconds_bucket{endpoint=%q,le=%q} %d\n", name, formatFloat(bound), e.counts[i])
+		}
+		fmt.Fprintf(&b, "rancher_api_request_duration_seconds_bucket{endpoint=%q,le=\"+Inf\"} %d\n", name, e.total)
+		fmt.Fprintf(&b, "rancher_api_request_duration_seconds_sum{endpoint=%q} %s\n", name, formatFloat(e.sum))
+		fmt.Fprintf(&b, "rancher_api_request_duration_seconds_count{endpoint=%q} %d\n", name, e.total)
+	}
+
+	b.WriteString("# HELP rancher_api_requests_total Rancher API requests by response status (0 if no response arrived).\n")
+	b.WriteString("# TYPE rancher_api_requests_total counter\n")
+	for _, name := range names {
+		e := r.endpoints[name]
+		codes := make([]string, 0, len(e.codes))
+		for code := range e.codes {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+		for _, code := range codes {
+			fmt.Fprintf(&b, "rancher_api_requests_total{endpoint=%q,code=%q} %d\n", name, code, e.codes[code])
+		}
+	}
+
+	b.WriteString("# HELP rancher_api_request_errors_total Rancher API requests that failed or got an error response.\n")
+	b.WriteString("# TYPE rancher_api_request_errors_total counter\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "rancher_api_request_errors_total{endpoint=%q} %d\n", name, r.endpoints[name].errors)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WriteText(w)
+}
+
+// formatFloat formats v the way Prometheus writes sample values and bucket bounds
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := New()
+	r.Observe("list_clusters", 200, 80*time.Millisecond)
+	r.Observe("list_clusters", 500, 3*time.Second)
+	r.Observe("login", 0, 40*time.Millisecond)
+
+	var b strings.Builder
+	require.NoError(t, r.WriteText(&b))
+	text := b.String()
+
+	assert.Contains(t, text, "# TYPE rancher_api_request_duration_seconds histogram\n")
+	assert.Contains(t, text, `rancher_api_request_duration_seconds_bucket{endpoint="list_clusters",le="0.05"} 0`+"\n")
+	assert.Contains(t, text, `rancher_api_request_duration_seconds_bucket{endpoint="list_clusters",le="0.1"} 1`+"\n")
+	assert.Contains(t, text, `rancher_api_request_duration_seconds_bucket{endpoint="list_clusters",le="5"} 2`+"\n")
+	assert.Contains(t, text, `rancher_api_request_duration_seconds_bucket{endpoint="list_clusters",le="+Inf"} 2`+"\n")
+	assert.Contains(t, text, `rancher_api_request_duration_seconds_sum{endpoint="list_clusters"} 3.08`+"\n")
+	assert.Contains(t, text, `rancher_api_request_duration_seconds_count{endpoint="list_clusters"} 2`+"\n")
+	assert.Contains(t, text, `rancher_api_requests_total{endpoint="list_clusters",code="200"} 1`+"\n")
+	assert.Contains(t, text, `rancher_api_requests_total{endpoint="list_clusters",code="500"} 1`+"\n")
+	assert.Contains(t, text, `rancher_api_requests_total{endpoint="login",code="0"} 1`+"\n")
+	assert.Contains(t, text, `rancher_api_request_errors_total{endpoint="list_clusters"} 1`+"\n")
+	assert.Contains(t, text, `rancher_api_request_errors_total{endpoint="login"} 1`+"\n")
+	// Endpoints are written in a stable order
+	assert.Less(t, strings.Index(text, `errors_total{endpoint="list_clusters"}`), strings.Index(text, `errors_total{endpoint="login"}`))
+}
+
+func TestRegistry_Empty(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, New().WriteText(&b))
+	assert.NotContains(t, b.String(), "endpoint=")
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := New()
+	r.Observe("token_info", 404, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rec.Body.String(), `rancher_api_request_errors_total{endpoint="token_info"} 1`)
+}
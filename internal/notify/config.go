@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the notification sinks and the rules routing events to them.
+type Config struct {
+	Sinks map[string]SinkConfig `yaml:"sinks"`
+	Rules []Rule                `yaml:"rules"`
+
+	// sinks are the senders built from Sinks
+	sinks map[string]Sink
+}
+
+// Rule routes the events it matches to the sinks named in Notify. Rules are evaluated in
+// order and every matching rule applies, until a matching rule with Stop set.
+type Rule struct {
+	// Events limits the rule to these event types (all types when empty)
+	Events []EventType `yaml:"events,omitempty"`
+	// Clusters limits the rule to clusters whose name or ID matches one of these glob patterns (all when empty)
+	Clusters []string `yaml:"clusters,omitempty"`
+	Notify   []string `yaml:"notify"`
+	Stop     bool     `yaml:"stop,omitempty"`
+}
+
+// Load reads and validates the notification configuration at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification config: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes and validates a notification configuration. ${VAR} references in sink
+// settings are replaced with environment variables, so secrets can stay out of the file.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	var problems []string
+	cfg.sinks = make(map[string]Sink, len(cfg.Sinks))
+	names := make([]string, 0, len(cfg.Sinks))
+	for name := range cfg.Sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sink, err := cfg.Sinks[name].expandEnv().build()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("sink %s: %v", name, err))
+			continue
+		}
+		cfg.sinks[name] = sink
+	}
+
+	for i, rule := range cfg.Rules {
+		if err := rule.validate(cfg.Sinks); err != nil {
+			problems = append(problems, fmt.Sprintf("rule %d: %v", i+1, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return &cfg, nil
+}
+
+func (r Rule) validate(sinks map[string]SinkConfig) error {
+	if len(r.Notify) == 0 {
+		return errors.New("notify needs at least one sink")
+	}
+	for _, name := range r.Notify {
+		if _, ok := sinks[name]; !ok {
+			return fmt.Errorf("unknown sink %q", name)
+		}
+	}
+	for _, t := range r.Events {
+		if !slices.Contains(eventTypes, t) {
+			return fmt.Errorf("unknown event %q: must be rotated, failed, expiring, unrefreshable or token-changed", t)
+		}
+	}
+	for _, pattern := range r.Clusters {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid cluster pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to e
+func (r Rule) matches(e Event) bool {
+	if len(r.Events) > 0 && !slices.Contains(r.Events, e.Type) {
+		return false
+	}
+	if len(r.Clusters) == 0 {
+		return true
+	}
+	for _, pattern := range r.Clusters {
+		if ok, _ := path.Match(pattern, e.Cluster); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, e.ClusterID); ok && e.ClusterID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// desktopSinkName names the sink added by WithDesktop, in error messages
+const desktopSinkName = "--notify desktop"
+
+// WithDesktop returns a copy of c that also shows rotations, failures and tokens about to
+// expire as desktop notifications, whatever c's rules route elsewhere. A nil c only notifies
+// the desktop.
+func (c *Config) WithDesktop() *Config {
+	withDesktop := &Config{Sinks: map[string]SinkConfig{}, sinks: map[string]Sink{}}
+	if c != nil {
+		maps.Copy(withDesktop.Sinks, c.Sinks)
+		maps.Copy(withDesktop.sinks, c.sinks)
+		withDesktop.Rules = slices.Clone(c.Rules)
+	}
+	withDesktop.Sinks[desktopSinkName] = SinkConfig{Type: SinkDesktop}
+	withDesktop.sinks[desktopSinkName], _ = SinkConfig{Type: SinkDesktop}.build()
+	// The rule goes first, so no stop rule of c keeps events from the desktop
+	rule := Rule{Events: []EventType{EventRotated, EventFailed, EventExpiring, EventUnrefreshable}, Notify: []string{desktopSinkName}}
+	withDesktop.Rules = append([]Rule{rule}, withDesktop.Rules...)
+	return withDesktop
+}
+
+// Route returns the names of the sinks that e is sent to, each at most once.
+// A nil *Config routes nothing.
+func (c *Config) Route(e Event) []string {
+	if c == nil {
+		return nil
+	}
+	var names []string
+	for _, rule := range c.Rules {
+		if !rule.matches(e) {
+			continue
+		}
+		for _, name := range rule.Notify {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		if rule.Stop {
+			break
+		}
+	}
+	return names
+}
@@ -0,0 +1,136 @@
+// Package notify routes the events of a run, such as rotated tokens and failed clusters,
+// to notification sinks like Slack, PagerDuty, email or a generic webhook. Routing rules
+// decide per event which sinks hear about it.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of an event.
+type EventType string
+
+const (
+	// EventRotated is a cluster whose token was replaced
+	EventRotated EventType = "rotated"
+	// EventFailed is a cluster that could not be processed
+	EventFailed EventType = "failed"
+	// EventExpiring is a token that expires within the threshold but was not replaced,
+	// e.g. because the entry was modified outside the tool or in dry-run mode
+	EventExpiring EventType = "expiring"
+	// EventUnrefreshable is a token the daemon's self-check found could not be refreshed,
+	// e.g. because the cluster was removed or the user lost access to it
+	EventUnrefreshable EventType = "unrefreshable"
+	// EventTokenChanged is a cluster whose kubeconfig entry now uses a token with another name,
+	// for automation that refers to tokens by name
+	EventTokenChanged EventType = "token-changed"
+)
+
+// eventTypes lists the valid event types
+var eventTypes = []EventType{EventRotated, EventFailed, EventExpiring, EventUnrefreshable, EventTokenChanged}
+
+// Event is something that happened to one cluster during a run.
+type Event struct {
+	Type      EventType `json:"type"`
+	Cluster   string    `json:"cluster"`
+	ClusterID string    `json:"clusterId,omitempty"`
+	Server    string    `json:"server,omitempty"`
+	Message   string    `json:"message"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	// OldTokenName and NewTokenName are set on token-changed events; token secrets are never included
+	OldTokenName string    `json:"oldTokenName,omitempty"`
+	NewTokenName string    `json:"newTokenName,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// String returns a one-line description of the event for chat and email messages.
+// Events of the whole run, such as a failed save, have no cluster and name the server instead.
+func (e Event) String() string {
+	subject := e.Cluster
+	if subject == "" {
+		subject = e.Server
+	}
+	return fmt.Sprintf("[%s] %s: %s", e.Type, subject, e.Message)
+}
+
+// Recorder collects the events of a run. All methods are safe for concurrent use and on
+// a nil *Recorder, which records nothing.
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewRecorder returns an empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Add records an event, setting its time if it has none.
+func (r *Recorder) Add(e Event) {
+	if r == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// Events returns the recorded events in the order they were added.
+func (r *Recorder) Events() []Event {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// Notify routes each event through the rules of cfg and sends every sink the events
+// routed to it in one message. A failing sink does not stop the others; their errors
+// are returned together.
+func Notify(ctx context.Context, cfg *Config, events []Event) error {
+	batches := make(map[string][]Event)
+	for _, e := range events {
+		for _, name := range cfg.Route(e) {
+			batches[name] = append(batches[name], e)
+		}
+	}
+
+	names := make([]string, 0, len(batches))
+	for name := range batches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := cfg.sinks[name].Send(ctx, batches[name]); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// summary returns a short headline for a batch of events
+func summary(events []Event) string {
+	counts := make(map[EventType]int)
+	for _, e := range events {
+		counts[e.Type]++
+	}
+	var parts []string
+	for _, t := range eventTypes {
+		if counts[t] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[t], t))
+		}
+	}
+	return "rancher-kubeconfig-updater: " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,263 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Setenv("TEST_ROUTING_KEY", "secret-key")
+	cfg, err := Parse([]byte(`
+sinks:
+  pagerduty:
+    type: pagerduty
+    routing-key: ${TEST_ROUTING_KEY}
+  slack-infra:
+    type: slack
+    url: https://hooks.slack.com/services/T/B/X
+    channel: "#infra"
+rules:
+  - events: [failed, unrefreshable]
+    notify: [pagerduty]
+  - events: [rotated]
+    clusters: ["prod-*"]
+    notify: [slack-infra]
+`))
+	require.NoError(t, err)
+	require.Len(t, cfg.Rules, 2)
+	pd, ok := cfg.sinks["pagerduty"].(*pagerDutySink)
+	require.True(t, ok)
+	assert.Equal(t, "secret-key", pd.routingKey)
+	assert.Equal(t, pagerDutyURL, pd.url)
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"unknown field", "sinks: {}\nroutes: []\n", "field routes not found"},
+		{"unknown sink type", "sinks:\n  x:\n    type: teams\n", `unknown type "teams"`},
+		{"slack without url", "sinks:\n  x:\n    type: slack\n", "sink x: url must be"},
+		{"pagerduty without key", "sinks:\n  x:\n    type: pagerduty\n", "routing-key is required"},
+		{"email without port", "sinks:\n  x:\n    type: email\n    smtp: mail\n    from: a@b\n    to: [c@d]\n", "smtp must be host:port"},
+		{"file without path", "sinks:\n  x:\n    type: file\n", "sink x: path is required"},
+		{"rule with unknown sink", "rules:\n  - notify: [nowhere]\n", `rule 1: unknown sink "nowhere"`},
+		{"rule with unknown event", "sinks:\n  x:\n    type: webhook\n    url: https://example.com\nrules:\n  - events: [deleted]\n    notify: [x]\n", `unknown event "deleted"`},
+		{"rule without sinks", "rules:\n  - events: [failed]\n", "notify needs at least one sink"},
+		{"bad pattern", "sinks:\n  x:\n    type: webhook\n    url: https://example.com\nrules:\n  - clusters: [\"[\"]\n    notify: [x]\n", "invalid cluster pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestParse_Empty(t *testing.T) {
+	cfg, err := Parse(nil)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Route(Event{Type: EventFailed, Cluster: "prod"}))
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("sinks:\n  x:\n    type: bogus\n"), 0600))
+	_, err := Load(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), path)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "failed to read notification config")
+}
+
+func TestRoute(t *testing.T) {
+	cfg := &Config{Rules: []Rule{
+		{Events: []EventType{EventFailed}, Clusters: []string{"prod-*"}, Notify: []string{"pagerduty"}, Stop: true},
+		{Events: []EventType{EventFailed, EventExpiring}, Notify: []string{"slack", "mail"}},
+		{Clusters: []string{"c-abc*"}, Notify: []string{"slack"}},
+	}}
+
+	assert.Equal(t, []string{"pagerduty"}, cfg.Route(Event{Type: EventFailed, Cluster: "prod-eu"}), "stop ends evaluation")
+	assert.Equal(t, []string{"slack", "mail"}, cfg.Route(Event{Type: EventFailed, Cluster: "dev"}))
+	assert.Equal(t, []string{"slack", "mail"}, cfg.Route(Event{Type: EventExpiring, Cluster: "dev", ClusterID: "c-abc12"}), "sinks are deduplicated")
+	assert.Equal(t, []string{"slack"}, cfg.Route(Event{Type: EventRotated, Cluster: "dev", ClusterID: "c-abc12"}), "pattern matches the cluster ID")
+	assert.Empty(t, cfg.Route(Event{Type: EventRotated, Cluster: "dev"}))
+
+	var none *Config
+	assert.Nil(t, none.Route(Event{Type: EventFailed}))
+}
+
+func TestRecorder(t *testing.T) {
+	var none *Recorder
+	none.Add(Event{Type: EventFailed})
+	assert.Nil(t, none.Events())
+
+	r := NewRecorder()
+	r.Add(Event{Type: EventRotated, Cluster: "a"})
+	r.Add(Event{Type: EventFailed, Cluster: "b"})
+	events := r.Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, "a", events[0].Cluster)
+	assert.False(t, events[0].Time.IsZero())
+}
+
+func TestNotify(t *testing.T) {
+	type request struct {
+		path string
+		body map[string]any
+	}
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, request{r.URL.Path, body})
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := Parse([]byte(`
+sinks:
+  slack:
+    type: slack
+    url: ` + server.URL + `/slack
+    channel: "#infra"
+  pagerduty:
+    type: pagerduty
+    url: ` + server.URL + `/pagerduty
+    routing-key: key
+  broken:
+    type: webhook
+    url: ` + server.URL + `/broken
+rules:
+  - notify: [slack]
+  - events: [failed]
+    notify: [pagerduty, broken]
+`))
+	require.NoError(t, err)
+
+	err = Notify(context.Background(), cfg, []Event{
+		{Type: EventRotated, Cluster: "dev", Message: "kubeconfig entry updated"},
+		{Type: EventFailed, Cluster: "prod", Server: "https://rancher.example.com", Message: "boom"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sink broken: status 500")
+
+	// Sinks are sent in name order: broken, pagerduty, slack
+	require.Len(t, requests, 3)
+	assert.Equal(t, "/broken", requests[0].path)
+	assert.Equal(t, "rancher-kubeconfig-updater: 1 failed", requests[0].body["summary"])
+
+	assert.Equal(t, "/pagerduty", requests[1].path)
+	assert.Equal(t, "key", requests[1].body["routing_key"])
+	assert.Equal(t, "rancher-kubeconfig-updater/failed/prod", requests[1].body["dedup_key"])
+	payload := requests[1].body["payload"].(map[string]any)
+	assert.Equal(t, "error", payload["severity"])
+	assert.Equal(t, "https://rancher.example.com", payload["source"])
+
+	assert.Equal(t, "/slack", requests[2].path)
+	assert.Equal(t, "#infra", requests[2].body["channel"])
+	text := requests[2].body["text"].(string)
+	assert.True(t, strings.HasPrefix(text, "rancher-kubeconfig-updater: 1 rotated, 1 failed\n"))
+	assert.Contains(t, text, "[failed] prod: boom")
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token-changes.jsonl")
+	cfg, err := Parse([]byte("sinks:\n  changes:\n    type: file\n    path: " + path + "\nrules:\n  - events: [token-changed]\n    notify: [changes]\n"))
+	require.NoError(t, err)
+
+	changed := Event{Type: EventTokenChanged, Cluster: "prod", ClusterID: "c-prod", OldTokenName: "kubeconfig-u-old", NewTokenName: "kubeconfig-u-new"}
+	require.NoError(t, Notify(context.Background(), cfg, []Event{changed, {Type: EventRotated, Cluster: "prod"}}))
+	require.NoError(t, Notify(context.Background(), cfg, []Event{changed}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2, "events are appended, only the routed ones")
+	var got Event
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+	assert.Equal(t, EventTokenChanged, got.Type)
+	assert.Equal(t, "kubeconfig-u-old", got.OldTokenName)
+	assert.Equal(t, "kubeconfig-u-new", got.NewTokenName)
+}
+
+func TestEmailSink(t *testing.T) {
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var gotMsg []byte
+	var gotAuth smtp.Auth
+	sink := &emailSink{
+		addr: "mail.example.com:587", from: "updater@example.com", to: []string{"oncall@example.com"},
+		username: "updater", password: "secret",
+		send: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			gotAddr, gotAuth, gotFrom, gotTo, gotMsg = addr, a, from, to, msg
+			return nil
+		},
+	}
+
+	expires := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	err := sink.Send(context.Background(), []Event{{Type: EventExpiring, Cluster: "prod", Message: "token expires soon", ExpiresAt: expires}})
+	require.NoError(t, err)
+
+	assert.Equal(t, "mail.example.com:587", gotAddr)
+	assert.NotNil(t, gotAuth)
+	assert.Equal(t, "updater@example.com", gotFrom)
+	assert.Equal(t, []string{"oncall@example.com"}, gotTo)
+	msg := string(gotMsg)
+	assert.Contains(t, msg, "Subject: rancher-kubeconfig-updater: 1 expiring\r\n")
+	assert.Contains(t, msg, "[expiring] prod: token expires soon (expires 2026-03-01T12:00:00Z)\r\n")
+}
+
+func TestEventString_RunEvent(t *testing.T) {
+	e := Event{Type: EventFailed, Server: "https://rancher.example.com", Message: "failed to save kubeconfig"}
+	assert.Equal(t, "[failed] https://rancher.example.com: failed to save kubeconfig", e.String())
+}
+
+func TestDesktopSink(t *testing.T) {
+	var gotTitle, gotMessage string
+	sink := &desktopSink{show: func(_ context.Context, title, message string) error {
+		gotTitle, gotMessage = title, message
+		return nil
+	}}
+
+	var events []Event
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		events = append(events, Event{Type: EventRotated, Cluster: name, Message: "kubeconfig entry updated"})
+	}
+	events[0].Type = EventFailed
+	require.NoError(t, sink.Send(context.Background(), events))
+	assert.Equal(t, "rancher-kubeconfig-updater: 5 rotated, 1 failed", gotTitle)
+	lines := strings.Split(gotMessage, "\n")
+	require.Len(t, lines, 5)
+	assert.Equal(t, "[failed] a: kubeconfig entry updated", lines[0])
+	assert.Equal(t, "and 2 more", lines[4])
+}
+
+func TestWithDesktop(t *testing.T) {
+	desktop := (*Config)(nil).WithDesktop()
+	assert.Equal(t, []string{desktopSinkName}, desktop.Route(Event{Type: EventExpiring}))
+	assert.Empty(t, desktop.Route(Event{Type: EventTokenChanged}))
+
+	cfg, err := Parse([]byte("sinks:\n  hook:\n    type: webhook\n    url: https://example.com/hook\nrules:\n  - notify: [hook]\n    stop: true\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{desktopSinkName, "hook"}, cfg.WithDesktop().Route(Event{Type: EventFailed}), "a stop rule does not hide events from the desktop")
+	assert.Equal(t, []string{"hook"}, cfg.Route(Event{Type: EventFailed}), "the config itself is not changed")
+
+	_, err = Parse([]byte("sinks:\n  me:\n    type: desktop\nrules:\n  - notify: [me]\n"))
+	require.NoError(t, err)
+}
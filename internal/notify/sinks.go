@@ -0,0 +1,311 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"rancher-kubeconfig-updater/internal/desktopnotify"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"strings"
+	"time"
+)
+
+// Sink types
+const (
+	SinkSlack     = "slack"
+	SinkPagerDuty = "pagerduty"
+	SinkEmail     = "email"
+	SinkWebhook   = "webhook"
+	SinkFile      = "file"
+	SinkDesktop   = "desktop"
+)
+
+// pagerDutyURL is the PagerDuty Events API v2 endpoint
+const pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// sendTimeout bounds each request to a sink, so an unreachable sink can't hang the run
+const sendTimeout = 10 * time.Second
+
+// Sink delivers a batch of events.
+type Sink interface {
+	Send(ctx context.Context, events []Event) error
+}
+
+// SinkConfig configures one sink. Which fields apply depends on Type.
+type SinkConfig struct {
+	// Type is slack, pagerduty, email, webhook, file or desktop
+	Type string `yaml:"type"`
+	// URL is the Slack incoming webhook or generic webhook URL, or overrides the PagerDuty endpoint
+	URL string `yaml:"url,omitempty"`
+	// Channel overrides the channel of a Slack webhook, e.g. "#infra"
+	Channel string `yaml:"channel,omitempty"`
+	// RoutingKey is the integration key of a PagerDuty service
+	RoutingKey string `yaml:"routing-key,omitempty"`
+	// SMTP is the host:port of the mail server
+	SMTP     string   `yaml:"smtp,omitempty"`
+	From     string   `yaml:"from,omitempty"`
+	To       []string `yaml:"to,omitempty"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	// Path is the file events are appended to as JSON lines
+	Path string `yaml:"path,omitempty"`
+}
+
+// expandEnv replaces ${VAR} references in the settings with environment variables
+func (s SinkConfig) expandEnv() SinkConfig {
+	s.URL = os.ExpandEnv(s.URL)
+	s.Channel = os.ExpandEnv(s.Channel)
+	s.RoutingKey = os.ExpandEnv(s.RoutingKey)
+	s.SMTP = os.ExpandEnv(s.SMTP)
+	s.From = os.ExpandEnv(s.From)
+	s.Username = os.ExpandEnv(s.Username)
+	s.Password = os.ExpandEnv(s.Password)
+	s.Path = os.ExpandEnv(s.Path)
+	to := make([]string, len(s.To))
+	for i, addr := range s.To {
+		to[i] = os.ExpandEnv(addr)
+	}
+	s.To = to
+	return s
+}
+
+// build validates the settings and returns the sink they describe
+func (s SinkConfig) build() (Sink, error) {
+	client := &http.Client{Timeout: sendTimeout}
+	switch s.Type {
+	case SinkSlack:
+		if err := checkURL(s.URL); err != nil {
+			return nil, err
+		}
+		return &slackSink{url: s.URL, channel: s.Channel, client: client}, nil
+	case SinkWebhook:
+		if err := checkURL(s.URL); err != nil {
+			return nil, err
+		}
+		return &webhookSink{url: s.URL, client: client}, nil
+	case SinkPagerDuty:
+		if s.RoutingKey == "" {
+			return nil, errors.New("routing-key is required")
+		}
+		endpoint := s.URL
+		if endpoint == "" {
+			endpoint = pagerDutyURL
+		} else if err := checkURL(endpoint); err != nil {
+			return nil, err
+		}
+		return &pagerDutySink{url: endpoint, routingKey: s.RoutingKey, client: client}, nil
+	case SinkEmail:
+		if _, _, err := net.SplitHostPort(s.SMTP); err != nil {
+			return nil, fmt.Errorf("smtp must be host:port: %w", err)
+		}
+		if s.From == "" || len(s.To) == 0 {
+			return nil, errors.New("from and to are required")
+		}
+		return &emailSink{addr: s.SMTP, from: s.From, to: s.To, username: s.Username, password: s.Password, send: smtp.SendMail}, nil
+	case SinkFile:
+		if s.Path == "" {
+			return nil, errors.New("path is required")
+		}
+		return &fileSink{path: s.Path}, nil
+	case SinkDesktop:
+		return &desktopSink{show: desktopnotify.Send}, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q: must be slack, pagerduty, email, webhook, file or desktop", s.Type)
+	}
+}
+
+// checkURL requires an http:// or https:// URL
+func checkURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http:// or https:// URL")
+	}
+	return nil
+}
+
+// postJSON sends body as JSON to url and fails on non-2xx responses
+func postJSON(ctx context.Context, client *http.Client, url string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// slackSink posts one message per batch to a Slack incoming webhook
+type slackSink struct {
+	url, channel string
+	client       *http.Client
+}
+
+func (s *slackSink) Send(ctx context.Context, events []Event) error {
+	lines := []string{summary(events)}
+	for _, e := range events {
+		lines = append(lines, "• "+e.String())
+	}
+	msg := map[string]string{"text": strings.Join(lines, "\n")}
+	if s.channel != "" {
+		msg["channel"] = s.channel
+	}
+	return postJSON(ctx, s.client, s.url, msg)
+}
+
+// webhookSink posts the batch as JSON to any URL
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Send(ctx context.Context, events []Event) error {
+	return postJSON(ctx, s.client, s.url, map[string]any{"summary": summary(events), "events": events})
+}
+
+// fileSink appends the events to a file, one JSON object per line, for local automation
+// such as jobs syncing tokens elsewhere
+type fileSink struct {
+	path string
+}
+
+func (s *fileSink) Send(_ context.Context, events []Event) (err error) {
+	if err := readonly.Check(s.path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	enc := json.NewEncoder(f)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pagerDutySink triggers one PagerDuty alert per event. The dedup key is per cluster and
+// event type, so a cluster failing on every run updates one incident instead of opening many.
+type pagerDutySink struct {
+	url, routingKey string
+	client          *http.Client
+}
+
+func (s *pagerDutySink) Send(ctx context.Context, events []Event) error {
+	var errs []error
+	for _, e := range events {
+		body := map[string]any{
+			"routing_key":  s.routingKey,
+			"event_action": "trigger",
+			"dedup_key":    fmt.Sprintf("rancher-kubeconfig-updater/%s/%s", e.Type, e.Cluster),
+			"payload": map[string]any{
+				"summary":        e.String(),
+				"source":         e.Server,
+				"severity":       pagerDutySeverity(e.Type),
+				"component":      e.Cluster,
+				"custom_details": e,
+			},
+		}
+		if err := postJSON(ctx, s.client, s.url, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pagerDutySeverity maps an event type to a PagerDuty severity
+func pagerDutySeverity(t EventType) string {
+	switch t {
+	case EventFailed, EventUnrefreshable:
+		return "error"
+	case EventExpiring:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// emailSink sends one mail per batch through an SMTP server
+type emailSink struct {
+	addr, from         string
+	to                 []string
+	username, password string
+	// send is smtp.SendMail, replaced in tests
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func (s *emailSink) Send(_ context.Context, events []Event) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		host, _, _ := net.SplitHostPort(s.addr)
+		auth = smtp.PlainAuth("", s.username, s.password, host)
+	}
+	return s.send(s.addr, auth, s.from, s.to, s.message(events))
+}
+
+// message formats the mail with headers
+func (s *emailSink) message(events []Event) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", summary(events))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	for _, e := range events {
+		b.WriteString(e.String())
+		if !e.ExpiresAt.IsZero() {
+			fmt.Fprintf(&b, " (expires %s)", e.ExpiresAt.Format(time.RFC3339))
+		}
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
+
+// desktopMaxLines is how many events a desktop notification lists before summing up the rest
+const desktopMaxLines = 4
+
+// desktopSink shows one native desktop notification per batch, for interactive users
+type desktopSink struct {
+	// show is desktopnotify.Send, replaced in tests
+	show func(ctx context.Context, title, message string) error
+}
+
+func (s *desktopSink) Send(ctx context.Context, events []Event) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	lines := make([]string, 0, desktopMaxLines+1)
+	for i, e := range events {
+		if i == desktopMaxLines {
+			lines = append(lines, fmt.Sprintf("and %d more", len(events)-i))
+			break
+		}
+		lines = append(lines, e.String())
+	}
+	return s.show(ctx, summary(events), strings.Join(lines, "\n"))
+}
@@ -0,0 +1,104 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultPollInterval is how often the token endpoint is polled when the provider sets no interval
+var defaultPollInterval = 5 * time.Second
+
+// DeviceCode is what the user needs to finish a device login on another device.
+type DeviceCode struct {
+	// UserCode is entered by the user on VerificationURI
+	UserCode string
+	// VerificationURI is the page the user opens on a device with a browser
+	VerificationURI string
+	// VerificationURIComplete already carries the code, if the provider supports it
+	VerificationURIComplete string
+}
+
+// deviceAuthorization is the provider's answer to a device authorization request
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURL         string `json:"verification_url"` // Google's name for verification_uri
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceLogin runs the device authorization grant (RFC 8628) for machines without a browser.
+// show is called with the code the user enters on another device; DeviceLogin then polls the
+// provider until the user has logged in, the code expires or ctx ends.
+func DeviceLogin(ctx context.Context, cfg Config, show func(DeviceCode)) (Tokens, error) {
+	client := cfg.httpClient()
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+
+	ep, err := discover(ctx, client, cfg.Issuer)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if ep.DeviceAuthorizationEndpoint == "" {
+		return Tokens{}, fmt.Errorf("OIDC provider %s does not support device logins", cfg.Issuer)
+	}
+
+	var auth deviceAuthorization
+	form := url.Values{"client_id": {cfg.ClientID}, "scope": {strings.Join(scopes, " ")}}
+	if err := postForm(ctx, client, ep.DeviceAuthorizationEndpoint, form, &auth); err != nil {
+		return Tokens{}, fmt.Errorf("failed to start device login: %w", err)
+	}
+	if auth.VerificationURI == "" {
+		auth.VerificationURI = auth.VerificationURL
+	}
+	show(DeviceCode{UserCode: auth.UserCode, VerificationURI: auth.VerificationURI, VerificationURIComplete: auth.VerificationURIComplete})
+
+	if auth.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(auth.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	form = url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {auth.DeviceCode},
+		"client_id":   {cfg.ClientID},
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return Tokens{}, fmt.Errorf("device login was not completed: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+
+		var tokens Tokens
+		err := postForm(ctx, client, ep.TokenEndpoint, form, &tokens)
+		var oauthErr *oauthError
+		switch {
+		case err == nil:
+			if tokens.IDToken == "" {
+				return Tokens{}, errors.New("the OIDC provider issued no ID token; is the openid scope allowed?")
+			}
+			return tokens, nil
+		case errors.As(err, &oauthErr) && oauthErr.Code == "authorization_pending":
+		case errors.As(err, &oauthErr) && oauthErr.Code == "slow_down":
+			interval += 5 * time.Second
+		case ctx.Err() != nil:
+			return Tokens{}, fmt.Errorf("device login was not completed: %w", ctx.Err())
+		default:
+			return Tokens{}, fmt.Errorf("device login failed: %w", err)
+		}
+	}
+}
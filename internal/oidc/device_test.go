@@ -0,0 +1,96 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDeviceProvider starts a fake OIDC provider whose user logs in after pending polls
+// answered with tokenError, or never if pending is negative
+func newDeviceProvider(t *testing.T, pending int32, tokenError string) *httptest.Server {
+	t.Helper()
+	defaultPollInterval = time.Millisecond
+	t.Cleanup(func() { defaultPollInterval = 5 * time.Second })
+
+	var server *httptest.Server
+	var polls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"token_endpoint":                server.URL + "/token",
+			"device_authorization_endpoint": server.URL + "/device",
+		})
+	})
+	mux.HandleFunc("POST /device", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "kubeconfig-updater", r.FormValue("client_id"))
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"device_code":      "device-code",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": server.URL + "/activate",
+			"expires_in":       600,
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:device_code", r.FormValue("grant_type"))
+		assert.Equal(t, "device-code", r.FormValue("device_code"))
+		if pending < 0 || polls.Add(1) <= pending {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": tokenError})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": "id-token"})
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestDeviceLogin tests polling until the user has entered the code on another device
+func TestDeviceLogin(t *testing.T) {
+	provider := newDeviceProvider(t, 2, "authorization_pending")
+
+	var shown DeviceCode
+	tokens, err := DeviceLogin(context.Background(), Config{Issuer: provider.URL, ClientID: "kubeconfig-updater"}, func(code DeviceCode) {
+		shown = code
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "id-token", tokens.IDToken)
+	assert.Equal(t, "ABCD-EFGH", shown.UserCode)
+	assert.Equal(t, provider.URL+"/activate", shown.VerificationURI)
+}
+
+// TestDeviceLogin_Denied tests the error when the user refuses the login
+func TestDeviceLogin_Denied(t *testing.T) {
+	provider := newDeviceProvider(t, -1, "access_denied")
+
+	_, err := DeviceLogin(context.Background(), Config{Issuer: provider.URL, ClientID: "kubeconfig-updater"}, func(DeviceCode) {})
+	assert.ErrorContains(t, err, "device login failed: access_denied")
+}
+
+// TestDeviceLogin_Timeout tests giving up when the user never enters the code
+func TestDeviceLogin_Timeout(t *testing.T) {
+	provider := newDeviceProvider(t, -1, "authorization_pending")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := DeviceLogin(ctx, Config{Issuer: provider.URL, ClientID: "kubeconfig-updater"}, func(DeviceCode) {})
+	assert.ErrorContains(t, err, "device login was not completed")
+}
+
+// TestDeviceLogin_Unsupported tests providers without a device authorization endpoint
+func TestDeviceLogin_Unsupported(t *testing.T) {
+	provider := newProvider(t)
+
+	_, err := DeviceLogin(context.Background(), Config{Issuer: provider.URL, ClientID: "kubeconfig-updater"}, func(DeviceCode) {
+		t.Fatal("no code must be shown")
+	})
+	assert.ErrorContains(t, err, "does not support device logins")
+}
@@ -0,0 +1,66 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newExchangeProvider starts a fake OIDC provider that exchanges "ci-token" with the answer
+func newExchangeProvider(t *testing.T, answer map[string]string) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"token_endpoint": server.URL + "/token"})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:token-exchange", r.FormValue("grant_type"))
+		assert.Equal(t, "kubeconfig-updater", r.FormValue("client_id"))
+		assert.Equal(t, tokenTypeIDToken, r.FormValue("requested_token_type"))
+		if r.FormValue("subject_token") != "ci-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "untrusted issuer"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(answer)
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestExchangeToken tests trading a CI token for an ID token
+func TestExchangeToken(t *testing.T) {
+	provider := newExchangeProvider(t, map[string]string{"id_token": "id-token"})
+
+	tokens, err := ExchangeToken(context.Background(), Config{Issuer: provider.URL, ClientID: "kubeconfig-updater"}, "ci-token")
+	require.NoError(t, err)
+	assert.Equal(t, "id-token", tokens.IDToken)
+}
+
+// TestExchangeToken_IssuedTokenType tests an ID token returned in access_token as RFC 8693 specifies
+func TestExchangeToken_IssuedTokenType(t *testing.T) {
+	provider := newExchangeProvider(t, map[string]string{"access_token": "id-token", "issued_token_type": tokenTypeIDToken})
+
+	tokens, err := ExchangeToken(context.Background(), Config{Issuer: provider.URL, ClientID: "kubeconfig-updater"}, "ci-token")
+	require.NoError(t, err)
+	assert.Equal(t, "id-token", tokens.IDToken)
+}
+
+// TestExchangeToken_Errors tests a refused exchange and an answer without an ID token
+func TestExchangeToken_Errors(t *testing.T) {
+	provider := newExchangeProvider(t, map[string]string{"access_token": "access-token"})
+	cfg := Config{Issuer: provider.URL, ClientID: "kubeconfig-updater"}
+
+	_, err := ExchangeToken(context.Background(), cfg, "other-token")
+	assert.ErrorContains(t, err, "invalid_grant: untrusted issuer")
+
+	_, err = ExchangeToken(context.Background(), cfg, "ci-token")
+	assert.ErrorContains(t, err, "issued no ID token")
+}
@@ -0,0 +1,264 @@
+// Package oidc logs a user in with an OpenID Connect provider from the command line.
+//
+// It runs the authorization code flow with PKCE (RFC 7636) in the user's browser and
+// receives the code on a loopback redirect (RFC 8252), so the client needs no secret.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultScopes are requested when Config names none
+var DefaultScopes = []string{"openid", "profile", "email"}
+
+// Config describes the OIDC client.
+type Config struct {
+	// Issuer is the provider's issuer URL, e.g. https://login.example.com/realms/corp
+	Issuer string
+	// ClientID is a public client that allows loopback redirects
+	ClientID string
+	// Scopes default to DefaultScopes
+	Scopes []string
+	// HTTPClient is used for discovery and the token exchange (a client with requestTimeout if nil)
+	HTTPClient *http.Client
+}
+
+// requestTimeout limits each request to the provider when Config has no HTTPClient
+const requestTimeout = 30 * time.Second
+
+// httpClient returns the client that sends the requests to the provider
+func (cfg Config) httpClient() *http.Client {
+	if cfg.HTTPClient != nil {
+		return cfg.HTTPClient
+	}
+	return &http.Client{Timeout: requestTimeout}
+}
+
+// Tokens are the tokens issued at the end of the login.
+type Tokens struct {
+	IDToken     string `json:"id_token"`
+	AccessToken string `json:"access_token"`
+}
+
+// endpoints are the parts of the provider's discovery document the login needs
+type endpoints struct {
+	AuthorizationEndpoint       string `json:"authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+// oauthError is an error response of the provider, such as authorization_pending
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oauthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// Login runs the authorization code flow with PKCE. open is called with the URL the user has
+// to visit; Login then waits for the provider to redirect the browser back until ctx ends.
+func Login(ctx context.Context, cfg Config, open func(authURL string)) (Tokens, error) {
+	client := cfg.httpClient()
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+
+	ep, err := discover(ctx, client, cfg.Issuer)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if ep.AuthorizationEndpoint == "" {
+		return Tokens{}, fmt.Errorf("OIDC provider %s does not publish an authorization endpoint", cfg.Issuer)
+	}
+
+	verifier, err := randomString(32)
+	if err != nil {
+		return Tokens{}, err
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return Tokens{}, fmt.Errorf("failed to listen for the login redirect: %w", err)
+	}
+	redirectURI := fmt.Sprintf("http://%s/callback", listener.Addr())
+
+	codes := make(chan string, 1)
+	failures := make(chan error, 1)
+	server := &http.Server{
+		Handler:           callbackHandler(state, codes, failures),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() { _ = server.Serve(listener) }()
+	defer func() { _ = server.Close() }()
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	open(ep.AuthorizationEndpoint + separator(ep.AuthorizationEndpoint) + query.Encode())
+
+	var code string
+	select {
+	case code = <-codes:
+	case err := <-failures:
+		return Tokens{}, err
+	case <-ctx.Done():
+		return Tokens{}, fmt.Errorf("OIDC login was not completed: %w", ctx.Err())
+	}
+
+	return exchange(ctx, client, ep.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {cfg.ClientID},
+		"code_verifier": {verifier},
+	})
+}
+
+// discover reads the provider's endpoints from its discovery document
+func discover(ctx context.Context, client *http.Client, issuer string) (endpoints, error) {
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return endpoints{}, fmt.Errorf("invalid issuer %q: %w", issuer, err)
+	}
+	var ep endpoints
+	if err := doJSON(client, req, &ep); err != nil {
+		return endpoints{}, fmt.Errorf("failed to discover OIDC provider %s: %w", issuer, err)
+	}
+	if ep.TokenEndpoint == "" {
+		return endpoints{}, fmt.Errorf("OIDC provider %s does not publish a token endpoint", issuer)
+	}
+	return ep, nil
+}
+
+// exchange redeems the authorization code at the token endpoint
+func exchange(ctx context.Context, client *http.Client, tokenEndpoint string, form url.Values) (Tokens, error) {
+	var tokens Tokens
+	if err := postForm(ctx, client, tokenEndpoint, form, &tokens); err != nil {
+		return Tokens{}, fmt.Errorf("failed to redeem the authorization code: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return Tokens{}, errors.New("the OIDC provider issued no ID token; is the openid scope allowed?")
+	}
+	return tokens, nil
+}
+
+// postForm posts form to endpoint and decodes a 200 response into v
+func postForm(ctx context.Context, client *http.Client, endpoint string, form url.Values, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doJSON(client, req, v)
+}
+
+// doJSON sends req and decodes a 200 response into v. OAuth error responses are returned
+// as *oauthError.
+func doJSON(client *http.Client, req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr oauthError
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Code != "" {
+			return &oauthErr
+		}
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
+
+// callbackHandler receives the provider's redirect and passes on the code or the error
+func callbackHandler(state string, codes chan<- string, failures chan<- error) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var err error
+		switch {
+		case query.Get("state") != state:
+			// Not the redirect of this login; keep waiting for the real one
+			http.Error(w, "unexpected login state", http.StatusBadRequest)
+			return
+		case query.Get("error") != "":
+			err = fmt.Errorf("OIDC provider refused the login: %s %s", query.Get("error"), query.Get("error_description"))
+		case query.Get("code") == "":
+			err = errors.New("OIDC provider returned no authorization code")
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err != nil {
+			_, _ = fmt.Fprintf(w, "<p>Login failed: %s</p>", html.EscapeString(err.Error()))
+			select {
+			case failures <- err:
+			default:
+			}
+			return
+		}
+		_, _ = io.WriteString(w, "<p>Logged in. You can close this window and return to the terminal.</p>")
+		select {
+		case codes <- query.Get("code"):
+		default:
+		}
+	})
+	return mux
+}
+
+// randomString returns n random bytes encoded for use in URLs
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// challenge derives the S256 code challenge from the verifier
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// separator returns the character that appends a query to endpoint
+func separator(endpoint string) string {
+	if strings.Contains(endpoint, "?") {
+		return "&"
+	}
+	return "?"
+}
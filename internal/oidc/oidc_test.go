@@ -0,0 +1,121 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newProvider starts a fake OIDC provider that issues "the-code" and checks the PKCE verifier
+func newProvider(t *testing.T) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	var codeChallenge string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+		})
+	})
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		assert.Equal(t, "S256", query.Get("code_challenge_method"))
+		codeChallenge = query.Get("code_challenge")
+		redirect, _ := url.Parse(query.Get("redirect_uri"))
+		redirect.RawQuery = url.Values{"code": {"the-code"}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "the-code", r.PostForm.Get("code"))
+		assert.Equal(t, "kubeconfig-updater", r.PostForm.Get("client_id"))
+		if challenge(r.PostForm.Get("code_verifier")) != codeChallenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": "id-token", "access_token": "access-token"})
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestLogin tests the authorization code flow with PKCE through a loopback redirect
+func TestConfig_HTTPClient(t *testing.T) {
+	assert.Equal(t, requestTimeout, Config{}.httpClient().Timeout)
+	client := &http.Client{}
+	assert.Same(t, client, Config{HTTPClient: client}.httpClient())
+}
+
+func TestLogin(t *testing.T) {
+	provider := newProvider(t)
+
+	// The "browser" follows the provider's redirect back to the loopback listener
+	open := func(authURL string) {
+		go func() {
+			resp, err := http.Get(authURL)
+			if assert.NoError(t, err) {
+				_ = resp.Body.Close()
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tokens, err := Login(ctx, Config{Issuer: provider.URL + "/", ClientID: "kubeconfig-updater"}, open)
+	require.NoError(t, err)
+	assert.Equal(t, "id-token", tokens.IDToken)
+	assert.Equal(t, "access-token", tokens.AccessToken)
+}
+
+// TestLogin_Refused tests the error when the provider redirects back with an error
+func TestLogin_Refused(t *testing.T) {
+	provider := newProvider(t)
+
+	open := func(authURL string) {
+		parsed, _ := url.Parse(authURL)
+		redirect, _ := url.Parse(parsed.Query().Get("redirect_uri"))
+		redirect.RawQuery = url.Values{"error": {"access_denied"}, "state": {parsed.Query().Get("state")}}.Encode()
+		go func() {
+			resp, err := http.Get(redirect.String())
+			if assert.NoError(t, err) {
+				_ = resp.Body.Close()
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := Login(ctx, Config{Issuer: provider.URL, ClientID: "kubeconfig-updater"}, open)
+	assert.ErrorContains(t, err, "access_denied")
+}
+
+// TestLogin_Timeout tests giving up when the user never finishes logging in
+func TestLogin_Timeout(t *testing.T) {
+	provider := newProvider(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := Login(ctx, Config{Issuer: provider.URL, ClientID: "kubeconfig-updater"}, func(string) {})
+	assert.ErrorContains(t, err, "OIDC login was not completed")
+}
+
+// TestLogin_NoDiscovery tests the error for an issuer without a discovery document
+func TestLogin_NoDiscovery(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := Login(context.Background(), Config{Issuer: server.URL, ClientID: "kubeconfig-updater"}, func(string) {
+		t.Fatal("the browser must not be opened")
+	})
+	assert.ErrorContains(t, err, "failed to discover OIDC provider")
+}
@@ -0,0 +1,33 @@
+package pipeline
+
+import (
+	"path"
+	"rancher-kubeconfig-updater/internal/rancher"
+)
+
+const (
+	// SkipReasonNotAutoCreated is the plan reason of missing clusters --auto-create-only doesn't match
+	SkipReasonNotAutoCreated = "not_auto_created"
+	// SkipReasonNotSelected is the plan reason of new clusters the user chose not to add
+	SkipReasonNotSelected = "not_selected"
+)
+
+// AutoCreates reports whether a missing entry of cluster v is created: auto-creation is enabled
+// and, with --auto-create-only, the cluster's name or ID matches one of its patterns
+func AutoCreates(v rancher.Cluster, opts Options) bool {
+	if !opts.AutoCreate {
+		return false
+	}
+	if opts.AutoCreateOnly == nil {
+		return true
+	}
+	for _, pattern := range opts.AutoCreateOnly {
+		if ok, _ := path.Match(pattern, v.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, v.ID); ok && v.ID != "" {
+			return true
+		}
+	}
+	return false
+}
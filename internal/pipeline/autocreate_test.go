@@ -0,0 +1,30 @@
+package pipeline
+
+import (
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestAutoCreates(t *testing.T) {
+	prod := rancher.Cluster{ID: "c-m-abc12", Name: "prod-eu"}
+	assert.False(t, AutoCreates(prod, Options{}))
+	assert.True(t, AutoCreates(prod, Options{AutoCreate: true}))
+	assert.True(t, AutoCreates(prod, Options{AutoCreate: true, AutoCreateOnly: []string{"prod-*"}}))
+	assert.True(t, AutoCreates(prod, Options{AutoCreate: true, AutoCreateOnly: []string{"dev", "c-m-abc12"}}))
+	assert.False(t, AutoCreates(prod, Options{AutoCreate: true, AutoCreateOnly: []string{"dev-*"}}))
+}
+
+func TestProcess_DeclinedIsSkipped(t *testing.T) {
+	kubecfg := api.NewConfig()
+	opts := Options{AutoCreate: true, Declined: map[string]bool{"c-sandbox": true}}
+
+	updated, err := process(nil, kubecfg, rancher.Cluster{ID: "c-sandbox", Name: "sandbox"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, updated)
+	assert.NotContains(t, kubecfg.AuthInfos, "sandbox")
+}
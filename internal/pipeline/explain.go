@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"time"
+)
+
+// Explanation collects the decision chain of one cluster for --explain.
+// All methods are safe on a nil *Explanation, which records nothing.
+type Explanation struct {
+	cluster rancher.Cluster
+	lines   []string
+}
+
+// NewExplanation returns an empty explanation of cluster.
+func NewExplanation(cluster rancher.Cluster) *Explanation {
+	return &Explanation{cluster: cluster}
+}
+
+// add records one step of the decision chain
+func (e *Explanation) add(format string, args ...any) {
+	if e == nil {
+		return
+	}
+	e.lines = append(e.lines, fmt.Sprintf(format, args...))
+}
+
+// APICall records a Rancher API request; it matches the rancher.Client request observer.
+func (e *Explanation) APICall(method, path string, status int) {
+	if status == 0 {
+		e.add("api: %s %s (no response)", method, path)
+		return
+	}
+	e.add("api: %s %s -> %d", method, path, status)
+}
+
+// existingToken records the token name of the current kubeconfig entry, never the secret
+func (e *Explanation) existingToken(currentToken string) {
+	if e == nil {
+		return
+	}
+	if name, err := rancher.TokenName(currentToken); err == nil {
+		e.add("existing token: %s", name)
+	} else if currentToken != "" {
+		e.add("existing token: present but not a Rancher token (%v)", err)
+	} else {
+		e.add("existing token: none")
+	}
+}
+
+// decision records how the regeneration decision was reached
+func (e *Explanation) decision(d rancher.TokenRegenerationDecision, thresholdDays int) {
+	if e == nil {
+		return
+	}
+
+	switch d.Reason {
+	case rancher.ReasonForceRefreshEnabled:
+		e.add("expiry: not checked, --force-refresh is set")
+	case rancher.ReasonNoExistingToken:
+		e.add("expiry: not checked, there is no token to check")
+	case rancher.ReasonExpirationCheckFailed:
+		e.add("expiry: lookup failed, regenerating to be safe")
+	case rancher.ReasonNeverExpires, rancher.ReasonNeverExpiresButRefreshRequired:
+		e.add("expiry: never (token has no TTL)")
+	case rancher.ReasonStillValid:
+		e.add("expiry: %s (%.1f days from now)", d.ExpiresAt.Format(time.RFC3339), d.DaysUntilExpiry)
+		e.add("threshold: %.1f days left > %d days threshold, token is kept", d.DaysUntilExpiry, thresholdDays)
+	case rancher.ReasonExpiresSoon:
+		e.add("expiry: %s (%.1f days from now)", d.ExpiresAt.Format(time.RFC3339), d.DaysUntilExpiry)
+		e.add("threshold: %.1f days left <= %d days threshold, token is replaced", d.DaysUntilExpiry, thresholdDays)
+	case rancher.ReasonPolicyAlways:
+		e.add("expiry: not checked, the policy rotates this cluster on every run")
+	case rancher.ReasonTokenTooOld:
+		e.add("age: created %s (%.1f days ago), older than the maximum token age", d.CreatedAt.Format(time.RFC3339), time.Since(d.CreatedAt).Hours()/24)
+	case rancher.ReasonWrongTokenScope:
+		e.add("scope: the token does not have the scope requested with --token-scope")
+	}
+
+	if d.ShouldRegenerate {
+		e.add("decision: regenerate (%s)", d.Reason)
+	} else {
+		e.add("decision: keep (%s)", d.Reason)
+	}
+}
+
+// Write prints the collected decision chain.
+func (e *Explanation) Write(w io.Writer) error {
+	if e == nil {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "Explain %s (%s):\n", e.cluster.Name, e.cluster.ID); err != nil {
+		return err
+	}
+	for _, line := range e.lines {
+		if _, err := fmt.Fprintf(w, "  %s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
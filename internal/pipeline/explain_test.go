@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"bytes"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestExplanation_Decision(t *testing.T) {
+	e := NewExplanation(rancher.Cluster{ID: "c-prod", Name: "prod"})
+	e.existingToken("kubeconfig-u-abc:secret")
+	e.decision(rancher.TokenRegenerationDecision{
+		ShouldRegenerate: true,
+		Reason:           rancher.ReasonExpiresSoon,
+		ExpiresAt:        time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+		DaysUntilExpiry:  12.5,
+	}, 30)
+
+	var buf bytes.Buffer
+	require.NoError(t, e.Write(&buf))
+	assert.Equal(t, "Explain prod (c-prod):\n"+
+		"  existing token: kubeconfig-u-abc\n"+
+		"  expiry: 2026-11-01T00:00:00Z (12.5 days from now)\n"+
+		"  threshold: 12.5 days left <= 30 days threshold, token is replaced\n"+
+		"  decision: regenerate (expires_soon)\n", buf.String())
+	assert.NotContains(t, buf.String(), "secret")
+}
+
+func TestExplanation_Nil(t *testing.T) {
+	var e *Explanation
+	e.add("ignored")
+	e.APICall("GET", "/v3/clusters", 200)
+	e.existingToken("")
+	e.decision(rancher.TokenRegenerationDecision{}, 30)
+
+	var buf bytes.Buffer
+	require.NoError(t, e.Write(&buf))
+	assert.Empty(t, buf.String())
+}
+
+func TestProcess_ExplainRecordsAPICalls(t *testing.T) {
+	client := newRancherStub(t, map[string]string{"c-prod": generatedKubeconfig("prod", "c-prod", "kubeconfig-u-new:secret")})
+	e := NewExplanation(rancher.Cluster{ID: "c-prod", Name: "prod"})
+	client.ObserveRequests(e.APICall)
+
+	kubecfg := api.NewConfig()
+	opts := Options{RancherURL: "https://rancher.example.com", AutoCreate: true, Explain: e}
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, updated)
+
+	assert.Equal(t, []string{
+		"existing token: none",
+		"expiry: not checked, there is no token to check",
+		"decision: regenerate (no_existing_token)",
+		"api: POST /v3/clusters/c-prod?action=generateKubeconfig -> 200",
+		"new token: kubeconfig-u-new",
+	}, e.lines)
+}
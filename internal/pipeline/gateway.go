@@ -0,0 +1,25 @@
+package pipeline
+
+import (
+	"rancher-kubeconfig-updater/internal/rancher"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// applyGateway routes the entry of cluster v through its gateway, if it has one
+func applyGateway(kubecfg *api.Config, v rancher.Cluster, opts Options, zapLogger *zap.Logger) error {
+	gw, ok := opts.Gateways.For(v.Name, v.ID)
+	if !ok {
+		return nil
+	}
+	if err := gw.Apply(kubecfg, v.Name, opts.RancherURL, v.ID); err != nil {
+		zapLogger.Error("Failed to route cluster through its gateway",
+			zap.String("cluster", v.Name),
+			zap.Error(err))
+		return err
+	}
+	opts.Explain.add("routed through gateway %s", gw.Server)
+	zapLogger.Debug("Routed cluster through its gateway", zap.String("cluster", v.Name), zap.String("gateway", gw.Server))
+	return nil
+}
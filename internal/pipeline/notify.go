@@ -0,0 +1,41 @@
+package pipeline
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/notify"
+	"rancher-kubeconfig-updater/internal/rancher"
+)
+
+// recordExpiring records a token that expires within the threshold but is not replaced
+func recordExpiring(v rancher.Cluster, decision rancher.TokenRegenerationDecision, why string, opts Options) {
+	if decision.Reason != rancher.ReasonExpiresSoon {
+		return
+	}
+	opts.Events.Add(notify.Event{
+		Type:      notify.EventExpiring,
+		Cluster:   v.Name,
+		ClusterID: v.ID,
+		Server:    opts.RancherURL,
+		Message:   fmt.Sprintf("token expires in %.1f days and was not replaced: %s", decision.DaysUntilExpiry, why),
+		ExpiresAt: decision.ExpiresAt,
+	})
+}
+
+// recordTokenChange records that the entry of cluster v replaced its token by one with another
+// name, so automation referring to the old name can follow
+func recordTokenChange(v rancher.Cluster, oldToken, newToken string, opts Options) {
+	oldName, oldErr := rancher.TokenName(oldToken)
+	newName, newErr := rancher.TokenName(newToken)
+	if oldErr != nil || newErr != nil || oldName == newName {
+		return
+	}
+	opts.Events.Add(notify.Event{
+		Type:         notify.EventTokenChanged,
+		Cluster:      v.Name,
+		ClusterID:    v.ID,
+		Server:       opts.RancherURL,
+		Message:      fmt.Sprintf("token %s replaced by %s", oldName, newName),
+		OldTokenName: oldName,
+		NewTokenName: newName,
+	})
+}
@@ -0,0 +1,45 @@
+package pipeline
+
+import (
+	"rancher-kubeconfig-updater/internal/notify"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordExpiring(t *testing.T) {
+	events := notify.NewRecorder()
+	opts := Options{Events: events}
+	cluster := rancher.Cluster{ID: "c-prod", Name: "prod"}
+	expires := time.Now().Add(48 * time.Hour)
+
+	recordExpiring(cluster, rancher.TokenRegenerationDecision{Reason: rancher.ReasonStillValid}, "dry run", opts)
+	recordExpiring(cluster, rancher.TokenRegenerationDecision{Reason: rancher.ReasonExpiresSoon, ExpiresAt: expires, DaysUntilExpiry: 2}, "dry run", opts)
+
+	got := events.Events()
+	require.Len(t, got, 1)
+	assert.Equal(t, notify.EventExpiring, got[0].Type)
+	assert.Equal(t, expires, got[0].ExpiresAt)
+	assert.Equal(t, "token expires in 2.0 days and was not replaced: dry run", got[0].Message)
+}
+
+func TestRecordTokenChange(t *testing.T) {
+	events := notify.NewRecorder()
+	opts := Options{RancherURL: "https://rancher.example.com", Events: events}
+	cluster := rancher.Cluster{ID: "c-prod", Name: "prod"}
+
+	recordTokenChange(cluster, "kubeconfig-u-old:secret", "kubeconfig-u-new:other", opts)
+	recordTokenChange(cluster, "kubeconfig-u-same:secret", "kubeconfig-u-same:secret", opts)
+	recordTokenChange(cluster, "", "kubeconfig-u-new:other", opts)
+
+	got := events.Events()
+	require.Len(t, got, 1)
+	assert.Equal(t, notify.EventTokenChanged, got[0].Type)
+	assert.Equal(t, "kubeconfig-u-old", got[0].OldTokenName)
+	assert.Equal(t, "kubeconfig-u-new", got[0].NewTokenName)
+	assert.Equal(t, "token kubeconfig-u-old replaced by kubeconfig-u-new", got[0].Message)
+	assert.NotContains(t, got[0].Message, "secret")
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Labels set on the tokens this tool gets from Rancher
+const (
+	labelManagedBy = "app.kubernetes.io/managed-by"
+	labelHost      = "rancher-kubeconfig-updater/host"
+	labelRunID     = "rancher-kubeconfig-updater/run-id"
+)
+
+// Origin identifies a run on the tokens it gets from Rancher, so Rancher admins
+// cleaning up tokens can tell the updater's tokens from ones created in the UI.
+type Origin struct {
+	RunID string
+	Host  string
+}
+
+// NewOrigin returns the origin of this run with a new random run ID.
+func NewOrigin() Origin {
+	id := make([]byte, 6)
+	_, _ = rand.Read(id)
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return Origin{RunID: hex.EncodeToString(id), Host: host}
+}
+
+// Description returns the token description for the given purpose, e.g. "kubeconfig token".
+func (o Origin) Description(purpose string) string {
+	return fmt.Sprintf("rancher-kubeconfig-updater %s on %s (run %s)", purpose, o.Host, o.RunID)
+}
+
+// Labels returns the token labels naming the tool, the host and the run.
+func (o Origin) Labels() map[string]string {
+	return map[string]string{
+		labelManagedBy: "rancher-kubeconfig-updater",
+		labelHost:      labelValue(o.Host),
+		labelRunID:     o.RunID,
+	}
+}
+
+// labelValue turns s into a valid Kubernetes label value: at most 63 characters of
+// letters, digits, '-', '_' and '.', starting and ending with a letter or digit
+func labelValue(s string) string {
+	value := []byte(s)
+	for i, c := range value {
+		if !isAlphanumeric(c) && c != '-' && c != '_' && c != '.' {
+			value[i] = '-'
+		}
+	}
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.TrimFunc(string(value), func(r rune) bool {
+		return r < 128 && !isAlphanumeric(byte(r))
+	})
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// annotateToken describes the run on a token Rancher generated for a kubeconfig. It is best
+// effort: Rancher versions that don't allow changing tokens keep them as generated.
+func annotateToken(client *rancher.Client, token string, v rancher.Cluster, opts Options, zapLogger *zap.Logger) {
+	if opts.Origin.RunID == "" {
+		return
+	}
+	tokenName, err := rancher.TokenName(token)
+	if err != nil {
+		return
+	}
+	err = client.AnnotateToken(tokenName, opts.Origin.Description("kubeconfig token"), opts.Origin.Labels())
+	switch {
+	case errors.Is(err, rancher.ErrTokenUpdateUnsupported):
+		zapLogger.Debug("Rancher does not allow labeling tokens, leaving the token as generated", zap.String("cluster", v.Name))
+	case err != nil:
+		zapLogger.Warn("Failed to label token", zap.String("cluster", v.Name), zap.String("tokenName", tokenName), zap.Error(err))
+	}
+}
@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestLabelValue(t *testing.T) {
+	assert.Equal(t, "laptop.local", labelValue("laptop.local"))
+	assert.Equal(t, "DESKTOP-42", labelValue("DESKTOP-42"))
+	assert.Equal(t, "my-host-name", labelValue("my host/name"))
+	assert.Equal(t, "host", labelValue("-host_"))
+	assert.Len(t, labelValue(strings.Repeat("a", 100)), 63)
+	assert.Equal(t, "", labelValue("日本"))
+}
+
+func TestNewTokenOrigin(t *testing.T) {
+	a, b := NewOrigin(), NewOrigin()
+	assert.Len(t, a.RunID, 12)
+	assert.NotEqual(t, a.RunID, b.RunID)
+
+	origin := Origin{RunID: "0123456789ab", Host: "build agent"}
+	assert.Equal(t, "rancher-kubeconfig-updater kubeconfig token on build agent (run 0123456789ab)", origin.Description("kubeconfig token"))
+	assert.Equal(t, map[string]string{
+		labelManagedBy: "rancher-kubeconfig-updater",
+		labelHost:      "build-agent",
+		labelRunID:     "0123456789ab",
+	}, origin.Labels())
+}
+
+func TestProcess_LabelsGeneratedToken(t *testing.T) {
+	var mu sync.Mutex
+	var annotated map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Query().Get("action") == "generateKubeconfig":
+			_ = json.NewEncoder(w).Encode(map[string]string{"config": generatedKubeconfig("prod", "c-prod", "kubeconfig-u-new:secret")})
+		case r.Method == http.MethodGet && r.URL.Path == "/v3/tokens/kubeconfig-u-new":
+			_, _ = w.Write([]byte(`{"name": "kubeconfig-u-new", "labels": {"authn.management.cattle.io/kind": "kubeconfig"}}`))
+		case r.Method == http.MethodPut && r.URL.Path == "/v3/tokens/kubeconfig-u-new":
+			mu.Lock()
+			defer mu.Unlock()
+			_ = json.NewDecoder(r.Body).Decode(&annotated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:secret"}
+	opts := Options{RancherURL: server.URL, ForceRefresh: true, Origin: Origin{RunID: "0123456789ab", Host: "laptop"}}
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+
+	require.NoError(t, err)
+	assert.True(t, updated)
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotNil(t, annotated)
+	assert.Equal(t, "rancher-kubeconfig-updater kubeconfig token on laptop (run 0123456789ab)", annotated["description"])
+	assert.Equal(t, map[string]any{
+		"authn.management.cattle.io/kind": "kubeconfig",
+		labelManagedBy:                    "rancher-kubeconfig-updater",
+		labelHost:                         "laptop",
+		labelRunID:                        "0123456789ab",
+	}, annotated["labels"])
+}
@@ -0,0 +1,561 @@
+// Package pipeline processes a single Rancher cluster: it decides whether the token of the
+// cluster's kubeconfig entry needs replacing, generates a new kubeconfig in Rancher and merges
+// it into the kubeconfig. Running the clusters of a server, saving the kubeconfig and
+// reporting on the run is left to the caller.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rancher-kubeconfig-updater/internal/eventstream"
+	"rancher-kubeconfig-updater/internal/gateway"
+	"rancher-kubeconfig-updater/internal/i18n"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/notify"
+	"rancher-kubeconfig-updater/internal/plan"
+	"rancher-kubeconfig-updater/internal/policy"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/state"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ReasonNewContext is the result reason of clusters that got a new kubeconfig entry
+const ReasonNewContext = "new_context"
+
+// Options configures how a cluster is processed. The zero value checks the token's expiry
+// against a threshold of 0 days and only updates existing entries.
+type Options struct {
+	// RancherURL is the server the client is connected to; it is recorded in managed entries
+	RancherURL string
+	// ThresholdDays replaces tokens expiring within this many days
+	ThresholdDays int
+	// ForceRefresh replaces the token regardless of its expiry
+	ForceRefresh bool
+	// DryRun decides without requesting new tokens or changing the kubeconfig
+	DryRun bool
+	// AutoCreate adds entries for clusters missing from the kubeconfig
+	AutoCreate bool
+	// AutoCreateOnly limits AutoCreate to clusters matching one of these glob patterns (nil for all)
+	AutoCreateOnly []string
+	// Declined holds the IDs of new clusters the user chose not to add
+	Declined map[string]bool
+	// WithDirectly also merges the cluster's direct (authorized endpoint) contexts
+	WithDirectly bool
+	// ExecCommand is the plugin command used in exec-credential mode (empty otherwise)
+	ExecCommand string
+	// Plan records the changes, for --plan-output and the run history (nil for none)
+	Plan *plan.Plan
+	// Stream reports the decisions and new tokens for --events (nil when not requested)
+	Stream *eventstream.Stream
+	// State holds the checksums of entries written by earlier runs (nil disables the check)
+	State *state.State
+	// KubeconfigPath is the resolved kubeconfig file, used as the state key
+	KubeconfigPath string
+	// ForceOverwrite replaces entries modified outside the tool without asking
+	ForceOverwrite bool
+	// Confirm asks whether a modified entry may be overwritten (nil when not interactive)
+	Confirm func(question string) bool
+	// Explain collects the decision chain for --explain (nil when not requested)
+	Explain *Explanation
+	// Gateways routes clusters through identity-aware proxies (nil when not configured)
+	Gateways *gateway.Config
+	// Events collects token changes and expiry warnings for notifications (nil when not configured)
+	Events *notify.Recorder
+	// Policy overrides the rotation decision per cluster (nil when not configured)
+	Policy *policy.Policy
+	// MaxTokenAge replaces tokens created longer ago than this (0 for no limit)
+	MaxTokenAge time.Duration
+	// Origin labels the tokens generated in this run (tokens stay unlabeled when the run ID is empty)
+	Origin Origin
+	// TokenScope is the scope new tokens must have (empty to keep the scope Rancher generates them with)
+	TokenScope rancher.TokenScope
+	// RenewTokens extends the TTL of expiring tokens instead of replacing them, where Rancher allows it
+	RenewTokens bool
+	// RevokeReplaced records replaced tokens in State, so a later run revokes them once
+	// GracePeriod has passed
+	RevokeReplaced bool
+	GracePeriod    time.Duration
+	// Source generates the kubeconfigs of the clusters (nil for the client, Rancher's v3 API)
+	Source rancher.ClusterSource
+	// Hint tells what to change to fix a failure, for the log (nil for no hints)
+	Hint func(err error) string
+}
+
+// Result is the outcome of processing a cluster.
+type Result struct {
+	// Cluster and ClusterID identify the processed cluster
+	Cluster   string
+	ClusterID string
+	// Updated is set when the entry was updated or created, or would be in dry-run mode
+	Updated bool
+	// Reason says why the cluster was updated or skipped, with the reasons of --plan-output,
+	// e.g. expires_soon, policy_never or new_context
+	Reason string
+	// Err is set when the cluster could not be processed
+	Err error
+}
+
+// Process runs the pipeline of a single cluster: it decides whether the token needs replacing,
+// generates a new kubeconfig in Rancher and merges it into kubecfg. kubecfg is not saved, so
+// callers can process several clusters, also concurrently on copies, and save once. Requests
+// to Rancher are sent with ctx, and nothing is done when ctx has already ended. Errors are
+// logged and returned in the result.
+func Process(ctx context.Context, client *rancher.Client, kubecfg *api.Config, cluster rancher.Cluster, opts Options, logger *zap.Logger) Result {
+	result := Result{Cluster: cluster.Name, ClusterID: cluster.ID}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+	client = client.WithContext(ctx)
+	if source, ok := opts.Source.(*rancher.SteveSource); ok {
+		opts.Source = source.WithContext(ctx)
+	}
+
+	// A plan of its own tells why the cluster was updated or skipped
+	recorded := plan.New(opts.DryRun)
+	runPlan := opts.Plan
+	opts.Plan = recorded
+	result.Updated, result.Err = process(client, kubecfg, cluster, opts, logger)
+	runPlan.Merge(recorded)
+	result.Reason = planReason(recorded)
+	return result
+}
+
+// planReason returns the reason of the single cluster recorded in p
+func planReason(p *plan.Plan) string {
+	switch {
+	case len(p.UpdatedTokens) > 0:
+		return p.UpdatedTokens[0].Reason
+	case len(p.AddedContexts) > 0:
+		return ReasonNewContext
+	case len(p.Skipped) > 0:
+		return p.Skipped[0].Reason
+	}
+	return ""
+}
+
+// hintField returns a log field with the hint for err, or a field that logs nothing
+func (o Options) hintField(err error) zap.Field {
+	if o.Hint == nil {
+		return zap.Skip()
+	}
+	if h := o.Hint(err); h != "" {
+		return zap.String("hint", h)
+	}
+	return zap.Skip()
+}
+
+// process decides whether the token of a single cluster needs regeneration and,
+// unless in dry-run mode, fetches a new kubeconfig from Rancher and merges it into kubecfg.
+// Returns whether the cluster was (or in dry-run mode would be) updated.
+// Errors are logged before being returned.
+func process(client *rancher.Client, kubecfg *api.Config, v rancher.Cluster, opts Options, zapLogger *zap.Logger) (updated bool, err error) {
+	reconcileRename(kubecfg, v, opts, zapLogger)
+
+	// Missing clusters --auto-create-only doesn't match or the user declined are skipped before a token is generated
+	if opts.AutoCreate && (!AutoCreates(v, opts) || opts.Declined[v.ID]) {
+		opts.AutoCreate = false
+		if _, exists := kubecfg.AuthInfos[v.Name]; !exists && !opts.WithDirectly {
+			if opts.Declined[v.ID] {
+				zapLogger.Info("Cluster is not in the kubeconfig and was not selected to be added, skipping", zap.String("cluster", v.Name))
+				opts.Explain.add("skipped: not in the kubeconfig and not selected to be added")
+				opts.Plan.Skip(v.Name, SkipReasonNotSelected)
+				return false, nil
+			}
+			zapLogger.Info("Cluster is not in the kubeconfig and does not match --auto-create-only, skipping", zap.String("cluster", v.Name))
+			opts.Explain.add("skipped: not in the kubeconfig and not matched by --auto-create-only")
+			opts.Plan.Skip(v.Name, SkipReasonNotAutoCreated)
+			return false, nil
+		}
+	}
+
+	// Entries the tool creates are annotated; entries it already manages get a new rotation time.
+	// Entries created by someone else are never annotated.
+	_, existed := kubecfg.AuthInfos[v.Name]
+	managed := kubeconfig.IsManaged(kubecfg, v.Name)
+	defer func() {
+		if updated && err == nil && !opts.DryRun && (!existed || managed) {
+			_ = kubeconfig.SetMetadata(kubecfg, v.Name, kubeconfig.NewMetadata(opts.RancherURL, v.ID, time.Now()))
+		}
+	}()
+	// Rancher hands out entries pointing at itself, so a gateway is applied again after every write
+	defer func() {
+		if updated && err == nil && !opts.DryRun {
+			err = applyGateway(kubecfg, v, opts, zapLogger)
+		}
+	}()
+
+	// In exec-credential mode tokens are fetched by kubectl on demand, so only the entry is maintained
+	if opts.ExecCommand != "" {
+		opts.Explain.add("exec-credential mode: tokens are fetched by kubectl on demand, expiry is not checked")
+		if _, exists := kubecfg.AuthInfos[v.Name]; exists && !AllowOverwrite(kubecfg, v.Name, opts, zapLogger) {
+			opts.Plan.Skip(v.Name, SkipReasonModified)
+			return false, nil
+		}
+		if opts.DryRun {
+			zapLogger.Info("[DRY-RUN] Would configure exec-credential plugin", zap.String("cluster", v.Name))
+			return true, nil
+		}
+		execConfig := kubeconfig.NewExecCredentialConfig(opts.ExecCommand, v.ID)
+		if err := kubeconfig.UpdateExecCredentialByName(kubecfg, v.ID, v.Name, opts.RancherURL, execConfig, opts.AutoCreate, zapLogger); err != nil {
+			// Error is already logged in UpdateExecCredentialByName
+			return false, err
+		}
+		zapLogger.Info("Configured exec-credential plugin for cluster: " + v.Name)
+		return true, nil
+	}
+
+	// Get current token from kubeconfig if it exists
+	var currentToken string
+	authInfo, exists := kubecfg.AuthInfos[v.Name]
+	if exists {
+		currentToken = authInfo.Token
+	}
+	willCreate := !exists && (opts.AutoCreate || opts.WithDirectly)
+
+	// A policy rule may forbid rotating this cluster at all
+	rule, ruleNumber := opts.Policy.For(v.Name, v.ID, v.Labels)
+	if ruleNumber > 0 {
+		opts.Explain.add("policy: rule %d applies (rotate %s)", ruleNumber, rule.Rotate)
+	}
+	if rule.Rotate == policy.RotateNever {
+		zapLogger.Info("Policy forbids rotating the token, skipping cluster", zap.String("cluster", v.Name), zap.Int("rule", ruleNumber))
+		opts.Explain.add("skipped: the policy never rotates this cluster")
+		opts.Plan.Skip(v.Name, SkipReasonPolicy)
+		return false, nil
+	}
+
+	// Determine if token regeneration is needed
+	opts.Explain.existingToken(currentToken)
+	decision, threshold := decideRotation(client, currentToken, v, rule, opts, zapLogger)
+
+	// Log decision and skip if regeneration not needed
+	logTokenDecision(zapLogger, decision, v.Name, opts.DryRun)
+	opts.Stream.Emit(eventstream.Event{Type: eventstream.TypeDecision, Server: opts.RancherURL, Cluster: v.Name, ClusterID: v.ID,
+		Regenerate: &decision.ShouldRegenerate, Reason: string(decision.Reason)})
+	opts.Explain.decision(decision, threshold)
+
+	if !decision.ShouldRegenerate {
+		// A token is only kept if it is the user's own token for this cluster
+		if err := client.CheckTokenOwner(currentToken, v.ID); errors.Is(err, rancher.ErrForeignToken) {
+			zapLogger.Warn("Skipping cluster whose kubeconfig token is not the user's token for it; use --force-refresh to replace it",
+				zap.String("cluster", v.Name), zap.Error(err))
+			opts.Explain.add("skipped: %v", err)
+			opts.Plan.Skip(v.Name, SkipReasonForeignToken)
+			return false, nil
+		} else if err != nil {
+			zapLogger.Debug("Failed to verify token owner", zap.String("cluster", v.Name), zap.Error(err))
+		}
+		opts.Plan.Skip(v.Name, string(decision.Reason))
+		return false, nil
+	}
+
+	// Existing tokens are only replaced within the maintenance windows of the policy rule
+	if currentToken != "" && outsideWindow(rule, ruleNumber, v, client.Now(), opts, zapLogger) {
+		opts.Plan.Skip(v.Name, SkipReasonWindow)
+		recordExpiring(v, decision, "outside the maintenance window", opts)
+		return false, nil
+	}
+
+	if exists && !AllowOverwrite(kubecfg, v.Name, opts, zapLogger) {
+		opts.Explain.add("skipped: entry was modified outside this tool")
+		opts.Plan.Skip(v.Name, SkipReasonModified)
+		recordExpiring(v, decision, "entry was modified outside this tool", opts)
+		return false, nil
+	}
+
+	// With --renew-tokens an expiring token keeps its name and gets a longer TTL
+	if exists && !opts.DryRun && renewToken(client, currentToken, v, decision, opts, zapLogger) {
+		opts.Plan.UpdateToken(v.Name, v.ID, currentToken, currentToken, ReasonRenewed)
+		return true, nil
+	}
+
+	// Skip actual token regeneration and kubeconfig update in dry-run mode
+	if opts.DryRun {
+		opts.Explain.add("dry run: no new token requested, kubeconfig unchanged")
+		recordExpiring(v, decision, "dry run", opts)
+		switch {
+		case willCreate:
+			zapLogger.Info("[DRY-RUN] Would create kubeconfig entry", zap.String("cluster", v.Name))
+			opts.Plan.AddContext(v.Name, v.ID)
+		case exists:
+			opts.Plan.UpdateToken(v.Name, v.ID, currentToken, "", string(decision.Reason))
+		default:
+			// A real run would fail to find the entry, so the cluster is not counted as updated
+			zapLogger.Warn("[DRY-RUN] Cluster not found in kubeconfig, would not be updated; use --auto-create to add it", zap.String("cluster", v.Name))
+			opts.Plan.Skip(v.Name, SkipReasonNotInKubeconfig)
+			return false, nil
+		}
+		return true, nil
+	}
+
+	// Get full kubeconfig from Rancher (includes Downstream Directly contexts if available)
+	var source rancher.ClusterSource = client
+	if opts.Source != nil {
+		source = opts.Source
+	}
+	clusterKubeconfig, err := source.GetClusterKubeconfig(v.ID)
+	if err != nil {
+		zapLogger.Error("Failed to get kubeconfig for cluster",
+			zap.String("cluster", v.Name),
+			zap.Error(err), opts.hintField(err))
+		return false, err
+	}
+
+	// Rancher names the entries after the cluster, but a cluster list may name them differently
+	if primary := clusterKubeconfig.CurrentContext; primary != "" && primary != v.Name {
+		if err := kubeconfig.RenameCluster(clusterKubeconfig, primary, v.Name); err != nil {
+			zapLogger.Error("Failed to rename generated kubeconfig entries", zap.String("cluster", v.Name), zap.Error(err))
+			return false, err
+		}
+	}
+
+	// With kubeconfig-generate-token=false Rancher returns an exec (rancher CLI) login instead of a token
+	newToken, hasToken := kubeconfig.ExtractTokenFromKubeconfig(clusterKubeconfig)
+	if !hasToken {
+		if execConfig, ok := kubeconfig.ExtractExecFromKubeconfig(clusterKubeconfig); ok {
+			return useRancherExecAuth(kubecfg, clusterKubeconfig, v, execConfig, opts, zapLogger)
+		}
+	}
+
+	if hasToken {
+		if newToken, err = scopeToken(client, clusterKubeconfig, newToken, v, opts, zapLogger); err != nil {
+			return false, err
+		}
+	}
+
+	// A static cluster manifest hands out the same token until its export is replaced
+	if hasToken && exists && newToken == currentToken {
+		zapLogger.Warn("Cluster source returned the token already in the kubeconfig; replace the exported kubeconfig before the token expires",
+			zap.String("cluster", v.Name))
+	}
+
+	if name, err := rancher.TokenName(newToken); hasToken && err == nil {
+		opts.Explain.add("new token: %s", name)
+		opts.Stream.Emit(eventstream.Event{Type: eventstream.TypeTokenGenerated, Server: opts.RancherURL, Cluster: v.Name, ClusterID: v.ID, TokenName: name})
+		annotateToken(client, newToken, v, opts, zapLogger)
+	}
+
+	// Recorded once the entry has been written below
+	if hasToken && willCreate {
+		defer opts.Plan.AddContext(v.Name, v.ID)
+	} else if hasToken && exists {
+		defer opts.Plan.UpdateToken(v.Name, v.ID, currentToken, newToken, string(decision.Reason))
+		defer func() {
+			if updated && err == nil {
+				recordTokenChange(v, currentToken, newToken, opts)
+				retireToken(client, currentToken, newToken, v, opts, zapLogger)
+			}
+		}()
+	}
+
+	// Check if we should use the new merge approach or legacy approach
+	if opts.WithDirectly || opts.AutoCreate {
+		// Use MergeKubeconfig for new approach (supports Downstream Directly)
+		kubeconfig.MergeKubeconfig(kubecfg, clusterKubeconfig, v.Name, opts.WithDirectly)
+		if opts.WithDirectly {
+			// Count direct contexts for logging
+			directCount := countDirectContexts(clusterKubeconfig, v.Name)
+			if directCount > 0 {
+				zapLogger.Info("Successfully updated kubeconfig with direct contexts",
+					zap.String("cluster", v.Name),
+					zap.Int("directContexts", directCount))
+			} else {
+				zapLogger.Info("Successfully updated kubeconfig token for cluster: " + v.Name)
+			}
+		} else {
+			zapLogger.Info("Successfully updated kubeconfig token for cluster: " + v.Name)
+		}
+		return true, nil
+	}
+
+	// Legacy approach: deterministically extract token from CurrentContext chain
+	token, ok := kubeconfig.ExtractTokenFromKubeconfig(clusterKubeconfig)
+	if !ok {
+		zapLogger.Error("Failed to extract token from kubeconfig",
+			zap.String("cluster", v.Name),
+			zap.String("reason", "empty or invalid CurrentContext/AuthInfo chain"))
+		return false, fmt.Errorf("failed to extract token from kubeconfig for cluster %s", v.Name)
+	}
+	if err := kubeconfig.UpdateTokenByName(kubecfg, v.ID, v.Name, token, opts.RancherURL, opts.AutoCreate, zapLogger); err != nil {
+		// Error is already logged in UpdateTokenByName
+		return false, err
+	}
+	zapLogger.Info("Successfully updated kubeconfig token for cluster: " + v.Name)
+	return true, nil
+}
+
+// reconcileRename renames the managed entry of a cluster that was renamed in Rancher.
+// Entries are matched by the Rancher URL and cluster ID in their metadata, so only
+// entries created by this tool are ever renamed.
+func reconcileRename(kubecfg *api.Config, v rancher.Cluster, opts Options, zapLogger *zap.Logger) {
+	if _, exists := kubecfg.Contexts[v.Name]; exists {
+		return
+	}
+	oldName, found := kubeconfig.FindManagedEntry(kubecfg, opts.RancherURL, v.ID)
+	if !found {
+		return
+	}
+
+	before, _ := kubeconfig.EntryChecksum(kubecfg, oldName)
+
+	// Dry-run renames only the in-memory copy, which is never saved
+	if err := kubeconfig.RenameEntry(kubecfg, oldName, v.Name); err != nil {
+		zapLogger.Warn("Failed to rename kubeconfig entry for renamed cluster",
+			zap.String("from", oldName), zap.String("to", v.Name), zap.Error(err))
+		return
+	}
+
+	// The rename itself is not a manual edit, so carry an unmodified entry's state over
+	if opts.State != nil {
+		if recorded, ok := opts.State.Checksum(opts.KubeconfigPath, oldName); ok {
+			if recorded == before {
+				recorded, _ = kubeconfig.EntryChecksum(kubecfg, v.Name)
+			}
+			opts.State.SetChecksum(opts.KubeconfigPath, v.Name, recorded)
+		}
+	}
+	zapLogger.Info("Renamed kubeconfig entry to match renamed Rancher cluster",
+		zap.String("from", oldName), zap.String("to", v.Name), zap.Bool("dryRun", opts.DryRun))
+}
+
+// SkipReasonNotInKubeconfig is the plan skip reason for clusters without an entry a dry run would not create
+const SkipReasonNotInKubeconfig = "not_in_kubeconfig"
+
+// SkipReasonModified is the plan skip reason for entries changed outside the tool
+const SkipReasonModified = "modified_outside_tool"
+
+// SkipReasonForeignToken is the plan skip reason for entries holding another user's token or a token for another cluster
+const SkipReasonForeignToken = "foreign_token"
+
+// AllowOverwrite reports whether the entry named name may be replaced. Entries whose
+// checksum differs from the one recorded after the last run were changed by something
+// else; they are only replaced with --force-overwrite or after confirmation.
+func AllowOverwrite(kubecfg *api.Config, name string, opts Options, zapLogger *zap.Logger) bool {
+	if opts.State == nil {
+		return true
+	}
+	recorded, ok := opts.State.Checksum(opts.KubeconfigPath, name)
+	if !ok {
+		return true
+	}
+	if current, _ := kubeconfig.EntryChecksum(kubecfg, name); current == recorded {
+		return true
+	}
+
+	switch {
+	case opts.ForceOverwrite:
+		zapLogger.Warn("Overwriting kubeconfig entry modified outside this tool (--force-overwrite)", zap.String("cluster", name))
+		return true
+	case opts.DryRun:
+		zapLogger.Warn("[DRY-RUN] Kubeconfig entry was modified outside this tool; overwriting it will require confirmation or --force-overwrite",
+			zap.String("cluster", name))
+		return true
+	case opts.Confirm != nil && opts.Confirm(i18n.T(i18n.ConfirmOverwrite, name)):
+		return true
+	default:
+		zapLogger.Warn("Skipping kubeconfig entry modified outside this tool; use --force-overwrite to replace it",
+			zap.String("cluster", name))
+		return false
+	}
+}
+
+// useRancherExecAuth stores the exec auth configuration Rancher returned for a cluster
+// whose kubeconfig has no embedded token (server setting kubeconfig-generate-token=false).
+func useRancherExecAuth(kubecfg, clusterKubeconfig *api.Config, v rancher.Cluster, execConfig *api.ExecConfig, opts Options, zapLogger *zap.Logger) (bool, error) {
+	zapLogger.Warn("Rancher did not embed a token in the generated kubeconfig (kubeconfig-generate-token is disabled on the server); "+
+		"using the exec authentication it returned instead, so kubectl will log in through the Rancher CLI",
+		zap.String("cluster", v.Name),
+		zap.String("command", execConfig.Command))
+
+	if opts.WithDirectly || opts.AutoCreate {
+		kubeconfig.MergeKubeconfig(kubecfg, clusterKubeconfig, v.Name, opts.WithDirectly)
+	} else if err := kubeconfig.UpdateExecCredentialByName(kubecfg, v.ID, v.Name, opts.RancherURL, execConfig, opts.AutoCreate, zapLogger); err != nil {
+		// Error is already logged in UpdateExecCredentialByName
+		return false, err
+	}
+
+	zapLogger.Info("Successfully updated kubeconfig exec authentication for cluster: " + v.Name)
+	return true, nil
+}
+
+// logTokenDecision logs the token regeneration decision with consistent formatting
+func logTokenDecision(logger *zap.Logger, decision rancher.TokenRegenerationDecision, clusterName string, dryRun bool) {
+	if !decision.ShouldRegenerate {
+		// Log skip decisions
+		if dryRun {
+			logger.Info("[DRY-RUN] Would skip token regeneration",
+				zap.String("cluster", clusterName),
+				zap.String("reason", string(decision.Reason)),
+				zap.Float64("daysUntilExpiration", decision.DaysUntilExpiry))
+		} else {
+			switch decision.Reason {
+			case rancher.ReasonNeverExpires:
+				logger.Info("Token never expires, skipping regeneration",
+					zap.String("cluster", clusterName))
+			case rancher.ReasonStillValid:
+				logger.Info("Token is still valid, skipping regeneration",
+					zap.String("cluster", clusterName),
+					zap.String("expiresAt", decision.ExpiresAt.Format("2006-01-02 15:04:05")),
+					zap.Int("daysUntilExpiration", int(decision.DaysUntilExpiry)))
+			}
+		}
+		return
+	}
+
+	// Log regeneration decisions
+	if dryRun {
+		logger.Info("[DRY-RUN] Would regenerate token",
+			zap.String("cluster", clusterName),
+			zap.String("reason", string(decision.Reason)),
+			zap.Float64("daysUntilExpiration", decision.DaysUntilExpiry))
+	} else {
+		switch decision.Reason {
+		case rancher.ReasonForceRefreshEnabled:
+			logger.Info("Force refresh enabled, regenerating token",
+				zap.String("cluster", clusterName))
+		case rancher.ReasonNoExistingToken:
+			logger.Info("No existing token, generating new token",
+				zap.String("cluster", clusterName))
+		case rancher.ReasonExpiresSoon:
+			logger.Info("Token expires soon, regenerating",
+				zap.String("cluster", clusterName),
+				zap.String("expiresAt", decision.ExpiresAt.Format("2006-01-02 15:04:05")),
+				zap.Int("daysUntilExpiration", int(decision.DaysUntilExpiry)))
+		case rancher.ReasonNeverExpiresButRefreshRequired:
+			logger.Info("Regenerating token (never expires but refresh required)",
+				zap.String("cluster", clusterName))
+		case rancher.ReasonExpirationCheckFailed:
+			logger.Info("Regenerating token due to expiration check failure",
+				zap.String("cluster", clusterName))
+		case rancher.ReasonPolicyAlways:
+			logger.Info("Policy rotates this cluster on every run, regenerating token",
+				zap.String("cluster", clusterName))
+		case rancher.ReasonTokenTooOld:
+			logger.Info("Token is older than the maximum token age, regenerating",
+				zap.String("cluster", clusterName),
+				zap.String("createdAt", decision.CreatedAt.Format("2006-01-02 15:04:05")))
+		case rancher.ReasonWrongTokenScope:
+			logger.Info("Token does not have the requested scope, regenerating",
+				zap.String("cluster", clusterName))
+		}
+	}
+}
+
+// countDirectContexts counts the number of Downstream Directly contexts in a kubeconfig
+// Direct contexts are identified by having a name that starts with "{clusterName}-"
+func countDirectContexts(cfg *api.Config, clusterName string) int {
+	count := 0
+	prefix := clusterName + "-"
+	for ctxName := range cfg.Contexts {
+		if strings.HasPrefix(ctxName, prefix) {
+			count++
+		}
+	}
+	return count
+}
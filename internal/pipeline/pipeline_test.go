@@ -0,0 +1,452 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/gateway"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/plan"
+	"rancher-kubeconfig-updater/internal/policy"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/state"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// newRancherStub returns a client for a Rancher stub that serves the given generated kubeconfigs by cluster ID
+func newRancherStub(t *testing.T, kubeconfigs map[string]string) *rancher.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("action") != "generateKubeconfig" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		clusterID := strings.TrimPrefix(r.URL.Path, "/v3/clusters/")
+		config, ok := kubeconfigs[clusterID]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"config": config})
+	}))
+	t.Cleanup(server.Close)
+	return rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+}
+
+// execOnlyKubeconfig is what Rancher generates when kubeconfig-generate-token is false
+const execOnlyKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://rancher.example.com/k8s/clusters/c-prod
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: prod
+current-context: prod
+users:
+- name: prod
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: rancher
+      args:
+      - token
+      - --server=rancher.example.com
+      - --user=user-abc
+`
+
+func TestProcess_FallsBackToExecWhenServerEmbedsNoToken(t *testing.T) {
+	client := newRancherStub(t, map[string]string{"c-prod": execOnlyKubeconfig})
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:secret"}
+
+	opts := Options{RancherURL: "https://rancher.example.com", ForceRefresh: true}
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+
+	require.NoError(t, err)
+	assert.True(t, updated)
+	authInfo := kubecfg.AuthInfos["prod"]
+	assert.Empty(t, authInfo.Token, "stale token should not be kept")
+	require.NotNil(t, authInfo.Exec)
+	assert.Equal(t, "rancher", authInfo.Exec.Command)
+}
+
+// generatedKubeconfig returns a kubeconfig like the one Rancher generates for a cluster
+func generatedKubeconfig(name, clusterID, token string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://rancher.example.com/k8s/clusters/%[2]s
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s
+current-context: %[1]s
+users:
+- name: %[1]s
+  user:
+    token: %[3]s
+`, name, clusterID, token)
+}
+
+// tokenKubeconfig is the generated kubeconfig of the "prod" cluster
+var tokenKubeconfig = generatedKubeconfig("prod", "c-prod", "kubeconfig-u-new:newsecret")
+
+func TestProcess_RecordsPlan(t *testing.T) {
+	client := newRancherStub(t, map[string]string{
+		"c-prod":  tokenKubeconfig,
+		"c-added": generatedKubeconfig("added", "c-added", "kubeconfig-u-added:secret"),
+	})
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:oldsecret"}
+
+	p := plan.New(false)
+	opts := Options{RancherURL: "https://rancher.example.com", ForceRefresh: true, Plan: p}
+	_, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+
+	opts.AutoCreate = true
+	_, err = process(client, kubecfg, rancher.Cluster{ID: "c-added", Name: "added"}, opts, zap.NewNop())
+	require.NoError(t, err)
+
+	require.Len(t, p.UpdatedTokens, 1)
+	assert.Equal(t, "kubeconfig-u-old", p.UpdatedTokens[0].OldTokenName)
+	assert.Equal(t, "kubeconfig-u-new", p.UpdatedTokens[0].NewTokenName)
+	assert.Equal(t, []plan.ContextEntry{{Context: "added", ClusterID: "c-added"}}, p.AddedContexts)
+}
+
+func TestProcess_DryRunPlan(t *testing.T) {
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:oldsecret"}
+
+	p := plan.New(true)
+	opts := Options{ForceRefresh: true, DryRun: true, Plan: p}
+	_, err := process(nil, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	updated, err := process(nil, kubecfg, rancher.Cluster{ID: "c-gone", Name: "missing"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, updated, "a missing entry without --auto-create is not counted as an update")
+
+	require.Len(t, p.UpdatedTokens, 1)
+	assert.Equal(t, "kubeconfig-u-old", p.UpdatedTokens[0].OldTokenName)
+	assert.Empty(t, p.UpdatedTokens[0].NewTokenName)
+	assert.Equal(t, []plan.Skip{{Context: "missing", Reason: SkipReasonNotInKubeconfig}}, p.Skipped)
+}
+
+func TestAllowOverwrite(t *testing.T) {
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:oldsecret"}
+
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+	opts := Options{State: st, KubeconfigPath: "/kube/config"}
+
+	// Never written by the tool
+	assert.True(t, AllowOverwrite(kubecfg, "prod", opts, zap.NewNop()))
+
+	sum, _ := kubeconfig.EntryChecksum(kubecfg, "prod")
+	st.SetChecksum("/kube/config", "prod", sum)
+	assert.True(t, AllowOverwrite(kubecfg, "prod", opts, zap.NewNop()), "unchanged entry")
+
+	kubecfg.AuthInfos["prod"].Token = "hand-edited"
+	assert.False(t, AllowOverwrite(kubecfg, "prod", opts, zap.NewNop()), "modified entry without confirmation")
+
+	asked := ""
+	opts.Confirm = func(question string) bool {
+		asked = question
+		return true
+	}
+	assert.True(t, AllowOverwrite(kubecfg, "prod", opts, zap.NewNop()))
+	assert.Contains(t, asked, `"prod"`)
+
+	opts.Confirm = nil
+	opts.ForceOverwrite = true
+	assert.True(t, AllowOverwrite(kubecfg, "prod", opts, zap.NewNop()))
+}
+
+func TestProcess_SkipsModifiedEntry(t *testing.T) {
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "hand-edited"}
+
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+	st.SetChecksum("/kube/config", "prod", "recorded-before-edit")
+
+	p := plan.New(false)
+	opts := Options{ForceRefresh: true, State: st, KubeconfigPath: "/kube/config", Plan: p}
+	updated, err := process(nil, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+
+	require.NoError(t, err)
+	assert.False(t, updated)
+	assert.Equal(t, "hand-edited", kubecfg.AuthInfos["prod"].Token)
+	assert.Equal(t, []plan.Skip{{Context: "prod", Reason: SkipReasonModified}}, p.Skipped)
+}
+
+func TestProcess_AnnotatesCreatedEntriesOnly(t *testing.T) {
+	client := newRancherStub(t, map[string]string{"c-prod": tokenKubeconfig})
+
+	kubecfg := api.NewConfig()
+	kubecfg.Clusters["prod"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-prod"}
+	kubecfg.Contexts["prod"] = &api.Context{Cluster: "prod", AuthInfo: "prod"}
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:oldsecret"}
+
+	opts := Options{RancherURL: "https://rancher.example.com", ForceRefresh: true}
+	_, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, kubeconfig.IsManaged(kubecfg, "prod"), "pre-existing entry must not be annotated")
+
+	opts.AutoCreate = true
+	_, err = process(client, kubecfg, rancher.Cluster{ID: "c-new", Name: "new"}, opts, zap.NewNop())
+	require.Error(t, err, "stub has no kubeconfig for c-new")
+
+	client = newRancherStub(t, map[string]string{"c-new": generatedKubeconfig("new", "c-new", "kubeconfig-u-new:newsecret")})
+	_, err = process(client, kubecfg, rancher.Cluster{ID: "c-new", Name: "new"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	md, ok := kubeconfig.GetMetadata(kubecfg, "new")
+	require.True(t, ok, "created entry must be annotated")
+	assert.Equal(t, "c-new", md.ClusterID)
+	assert.False(t, md.LastRotated.IsZero())
+}
+
+func TestProcess_ReconcilesRenamedCluster(t *testing.T) {
+	client := newRancherStub(t, map[string]string{"c-prod": tokenKubeconfig})
+
+	kubecfg := api.NewConfig()
+	kubecfg.Clusters["old-name"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-prod"}
+	kubecfg.Contexts["old-name"] = &api.Context{Cluster: "old-name", AuthInfo: "old-name"}
+	kubecfg.AuthInfos["old-name"] = &api.AuthInfo{Token: "kubeconfig-u-old:oldsecret"}
+	require.NoError(t, kubeconfig.SetMetadata(kubecfg, "old-name", kubeconfig.NewMetadata("https://rancher.example.com", "c-prod", time.Now())))
+
+	opts := Options{RancherURL: "https://rancher.example.com", ForceRefresh: true}
+	_, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+
+	assert.NotContains(t, kubecfg.Contexts, "old-name")
+	assert.Contains(t, kubecfg.Contexts, "prod")
+	assert.Equal(t, "kubeconfig-u-new:newsecret", kubecfg.AuthInfos["prod"].Token)
+	assert.True(t, kubeconfig.IsManaged(kubecfg, "prod"))
+}
+
+func TestProcess_AppliesGateway(t *testing.T) {
+	client := newRancherStub(t, map[string]string{"c-prod": tokenKubeconfig})
+	gateways, err := gateway.Parse([]byte("clusters:\n  prod:\n    server: https://teleport.example.com:3026\n    exec:\n      command: tsh\n"))
+	require.NoError(t, err)
+
+	kubecfg := api.NewConfig()
+	opts := Options{RancherURL: "https://rancher.example.com", AutoCreate: true, Gateways: gateways}
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+
+	require.NoError(t, err)
+	assert.True(t, updated)
+	assert.Equal(t, "https://teleport.example.com:3026/k8s/clusters/c-prod", kubecfg.Clusters["prod"].Server)
+	assert.Equal(t, "kubeconfig-u-new:newsecret", kubecfg.AuthInfos["prod"].Token)
+	require.NotNil(t, kubecfg.AuthInfos["prod"].Exec)
+	assert.Equal(t, "tsh", kubecfg.AuthInfos["prod"].Exec.Command)
+	assert.True(t, kubeconfig.IsManaged(kubecfg, "prod"))
+
+	// Clusters without a gateway keep Rancher's address
+	opts.Gateways = nil
+	opts.ForceRefresh = true
+	_, err = process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "https://rancher.example.com/k8s/clusters/c-prod", kubecfg.Clusters["prod"].Server)
+}
+
+func TestProcess_SkipsForeignToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/users":
+			_, _ = w.Write([]byte(`{"data": [{"id": "u-me"}]}`))
+		case "/v3/tokens/kubeconfig-u-colleague":
+			_, _ = w.Write([]byte(`{"name": "kubeconfig-u-colleague", "userId": "u-colleague", "ttl": 0}`))
+		case "/v3/tokens/kubeconfig-u-mine":
+			_, _ = w.Write([]byte(`{"name": "kubeconfig-u-mine", "userId": "u-me", "ttl": 0}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-colleague:secret"}
+	kubecfg.AuthInfos["dev"] = &api.AuthInfo{Token: "kubeconfig-u-mine:secret"}
+
+	p := plan.New(false)
+	opts := Options{RancherURL: server.URL, ThresholdDays: 30, Plan: p}
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, updated)
+	updated, err = process(client, kubecfg, rancher.Cluster{ID: "c-dev", Name: "dev"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, updated)
+
+	assert.Equal(t, "kubeconfig-u-colleague:secret", kubecfg.AuthInfos["prod"].Token)
+	assert.Equal(t, []plan.Skip{
+		{Context: "prod", Reason: SkipReasonForeignToken},
+		{Context: "dev", Reason: string(rancher.ReasonNeverExpires)},
+	}, p.Skipped)
+}
+
+func TestProcess(t *testing.T) {
+	client := newRancherStub(t, map[string]string{
+		"c-prod":  tokenKubeconfig,
+		"c-added": generatedKubeconfig("added", "c-added", "kubeconfig-u-added:secret"),
+	})
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:oldsecret"}
+	opts := Options{RancherURL: "https://rancher.example.com", ForceRefresh: true, AutoCreate: true}
+
+	result := Process(context.Background(), client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, result.Err)
+	assert.Equal(t, Result{Cluster: "prod", ClusterID: "c-prod", Updated: true, Reason: string(rancher.ReasonForceRefreshEnabled)}, result)
+	assert.Equal(t, "kubeconfig-u-new:newsecret", kubecfg.AuthInfos["prod"].Token)
+
+	result = Process(context.Background(), client, kubecfg, rancher.Cluster{ID: "c-added", Name: "added"}, opts, zap.NewNop())
+	require.NoError(t, result.Err)
+	assert.True(t, result.Updated)
+	assert.Equal(t, ReasonNewContext, result.Reason)
+}
+
+func TestProcess_Skip(t *testing.T) {
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:oldsecret"}
+	p, err := policy.Parse([]byte("rules:\n  - rotate: never\n"))
+	require.NoError(t, err)
+
+	result := Process(context.Background(), nil, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, Options{Policy: p}, zap.NewNop())
+	require.NoError(t, result.Err)
+	assert.False(t, result.Updated)
+	assert.Equal(t, SkipReasonPolicy, result.Reason)
+}
+
+func TestProcess_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	kubecfg := api.NewConfig()
+	result := Process(ctx, nil, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, Options{ForceRefresh: true, AutoCreate: true}, zap.NewNop())
+	assert.True(t, errors.Is(result.Err, context.Canceled))
+	assert.False(t, result.Updated)
+	assert.Empty(t, kubecfg.AuthInfos)
+
+	// Ending ctx also ends a request that is under way
+	ctx, cancel = context.WithCancel(context.Background())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	client := rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+	result = Process(ctx, client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, Options{ForceRefresh: true, AutoCreate: true}, zap.NewNop())
+	assert.ErrorIs(t, result.Err, context.Canceled)
+	assert.Empty(t, kubecfg.AuthInfos)
+}
+
+// TestCountDirectContexts tests the countDirectContexts helper function
+func TestCountDirectContexts(t *testing.T) {
+	tests := []struct {
+		name        string
+		contexts    map[string]*api.Context
+		clusterName string
+		expected    int
+	}{
+		{
+			name: "no direct contexts",
+			contexts: map[string]*api.Context{
+				"demo-cluster": {},
+			},
+			clusterName: "demo-cluster",
+			expected:    0,
+		},
+		{
+			name: "with direct contexts",
+			contexts: map[string]*api.Context{
+				"demo-cluster":        {},
+				"demo-cluster-node01": {},
+				"demo-cluster-node02": {},
+				"demo-cluster-node03": {},
+			},
+			clusterName: "demo-cluster",
+			expected:    3,
+		},
+		{
+			name: "mixed clusters",
+			contexts: map[string]*api.Context{
+				"prod":         {},
+				"prod-node01":  {},
+				"staging":      {},
+				"staging-fqdn": {},
+			},
+			clusterName: "prod",
+			expected:    1,
+		},
+		{
+			name: "no matching direct contexts",
+			contexts: map[string]*api.Context{
+				"demo-cluster": {},
+				"other-node01": {},
+				"another-fqdn": {},
+			},
+			clusterName: "demo-cluster",
+			expected:    0,
+		},
+		{
+			name: "pattern edge case - similar prefix",
+			contexts: map[string]*api.Context{
+				"prod":       {},
+				"prod-node":  {},
+				"production": {}, // Should NOT match
+			},
+			clusterName: "prod",
+			expected:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &api.Config{
+				Contexts: tt.contexts,
+			}
+			result := countDirectContexts(cfg, tt.clusterName)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+// TestCountDirectContexts_NilConfig tests handling of nil contexts map
+func TestCountDirectContexts_NilConfig(t *testing.T) {
+	cfg := &api.Config{
+		Contexts: nil,
+	}
+	result := countDirectContexts(cfg, "demo")
+	assert.Equal(t, 0, result)
+}
+
+// TestCountDirectContexts_EmptyConfig tests handling of empty contexts map
+func TestCountDirectContexts_EmptyConfig(t *testing.T) {
+	cfg := &api.Config{
+		Contexts: make(map[string]*api.Context),
+	}
+	result := countDirectContexts(cfg, "demo")
+	assert.Equal(t, 0, result)
+}
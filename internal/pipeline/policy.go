@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"rancher-kubeconfig-updater/internal/policy"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SkipReasonPolicy is the plan reason for clusters whose policy rule forbids rotating the token
+const SkipReasonPolicy = "policy_never"
+
+// SkipReasonWindow is the plan reason for clusters whose token is not rotated outside the
+// maintenance windows of their policy rule
+const SkipReasonWindow = "outside_window"
+
+// decideRotation applies the policy rule of cluster v around DetermineTokenRegeneration.
+// A rule rotating always replaces the token without looking it up, a threshold in the rule
+// replaces --threshold-days, and a token kept by expiry is still replaced once it is older
+// than the rule's maximum age, or --max-token-age if the rule has none, or when it lacks the
+// scope requested with --token-scope. Rules rotating never are handled by the caller.
+func decideRotation(client *rancher.Client, currentToken string, v rancher.Cluster, rule policy.Rule, opts Options, zapLogger *zap.Logger) (rancher.TokenRegenerationDecision, int) {
+	threshold := opts.ThresholdDays
+	if rule.ThresholdDays != nil {
+		threshold = *rule.ThresholdDays
+	}
+
+	if rule.Rotate == policy.RotateAlways && !opts.ForceRefresh {
+		return rancher.TokenRegenerationDecision{ShouldRegenerate: true, Reason: rancher.ReasonPolicyAlways}, threshold
+	}
+
+	maxAge := opts.MaxTokenAge
+	if rule.MaxAge > 0 {
+		maxAge = time.Duration(rule.MaxAge)
+	}
+
+	decision := client.DetermineTokenRegeneration(currentToken, opts.ForceRefresh, threshold, v.Name)
+	if !decision.ShouldRegenerate && maxAge > 0 {
+		decision = applyMaxAge(client, decision, currentToken, maxAge, v.Name, zapLogger)
+	}
+	if !decision.ShouldRegenerate && opts.TokenScope != "" {
+		decision = applyTokenScope(client, decision, currentToken, opts.TokenScope, v.Name, zapLogger)
+	}
+	return decision, threshold
+}
+
+// outsideWindow reports whether the rotation of cluster v's token has to wait because none of
+// the maintenance windows of its policy rule is open at now. --force-refresh rotates anyway.
+func outsideWindow(rule policy.Rule, ruleNumber int, v rancher.Cluster, now time.Time, opts Options, zapLogger *zap.Logger) bool {
+	if opts.ForceRefresh {
+		return false
+	}
+	open, next := rule.InWindow(now)
+	if open {
+		return false
+	}
+	nextField := zap.Skip()
+	if !next.IsZero() {
+		nextField = zap.Time("nextWindow", next)
+	}
+	zapLogger.Info("Outside the maintenance window, not rotating the token; use --force-refresh to rotate anyway",
+		zap.String("cluster", v.Name), zap.Int("rule", ruleNumber), nextField)
+	if next.IsZero() {
+		opts.Explain.add("skipped: outside the maintenance windows of policy rule %d", ruleNumber)
+	} else {
+		opts.Explain.add("skipped: outside the maintenance windows of policy rule %d, next opens %s", ruleNumber, next.Format(time.RFC3339))
+	}
+	return true
+}
+
+// applyMaxAge replaces a decision to keep the token when the token was created more than
+// maxAge ago. If the creation time can't be looked up the decision stands.
+func applyMaxAge(client *rancher.Client, decision rancher.TokenRegenerationDecision, currentToken string, maxAge time.Duration, clusterName string, zapLogger *zap.Logger) rancher.TokenRegenerationDecision {
+	created, err := client.GetTokenCreated(currentToken)
+	if err != nil {
+		zapLogger.Debug("Failed to check token age", zap.String("cluster", clusterName), zap.Error(err))
+		return decision
+	}
+	decision.CreatedAt = created
+	if client.Now().Sub(created) > maxAge {
+		decision.ShouldRegenerate = true
+		decision.Reason = rancher.ReasonTokenTooOld
+	}
+	return decision
+}
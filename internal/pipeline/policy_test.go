@@ -0,0 +1,147 @@
+package pipeline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"rancher-kubeconfig-updater/internal/plan"
+	"rancher-kubeconfig-updater/internal/policy"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestProcess_Policy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/users":
+			_, _ = w.Write([]byte(`{"data": [{"id": "u-me"}]}`))
+		case "/v3/tokens/kubeconfig-u-old":
+			_, _ = w.Write([]byte(`{"userId": "u-me", "ttl": 0, "created": "2020-01-01T00:00:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+
+	rules, err := policy.Parse([]byte(`
+rules:
+  - labels: {frozen: "true"}
+    rotate: never
+  - clusters: ["dev-*"]
+    rotate: always
+  - max-age: 60d
+`))
+	require.NoError(t, err)
+
+	kubecfg := api.NewConfig()
+	for _, name := range []string{"frozen", "dev-1", "prod"} {
+		kubecfg.AuthInfos[name] = &api.AuthInfo{Token: "kubeconfig-u-old:secret"}
+	}
+
+	p := plan.New(true)
+	opts := Options{RancherURL: server.URL, ThresholdDays: 30, ForceRefresh: true, DryRun: true, Plan: p, Policy: rules}
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-frozen", Name: "frozen", Labels: map[string]string{"frozen": "true"}}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, updated, "frozen clusters are kept even with --force-refresh")
+
+	opts.ForceRefresh = false
+	updated, err = process(client, kubecfg, rancher.Cluster{ID: "c-dev", Name: "dev-1"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, updated)
+	updated, err = process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, updated, "a never-expiring token older than max-age is replaced")
+
+	assert.Equal(t, []plan.Skip{{Context: "frozen", Reason: SkipReasonPolicy}}, p.Skipped)
+	require.Len(t, p.UpdatedTokens, 2)
+	assert.Equal(t, string(rancher.ReasonPolicyAlways), p.UpdatedTokens[0].Reason)
+	assert.Equal(t, string(rancher.ReasonTokenTooOld), p.UpdatedTokens[1].Reason)
+}
+
+func TestProcess_MaintenanceWindow(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+	client := rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+
+	// The window of prod only opens for a minute on February 29, the one of dev is always open
+	rules, err := policy.Parse([]byte(`
+rules:
+  - clusters: ["prod"]
+    rotate: always
+    windows: [{start: "0 0 29 2 *", duration: 1m}]
+  - clusters: ["dev"]
+    rotate: always
+    windows: [{start: "* * * * *", duration: 1m}]
+`))
+	require.NoError(t, err)
+
+	kubecfg := api.NewConfig()
+	for _, name := range []string{"prod", "dev"} {
+		kubecfg.AuthInfos[name] = &api.AuthInfo{Token: "kubeconfig-u-old:secret"}
+	}
+
+	p := plan.New(true)
+	opts := Options{RancherURL: server.URL, ThresholdDays: 30, DryRun: true, Plan: p, Policy: rules}
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, updated, "the token is kept outside the window")
+	updated, err = process(client, kubecfg, rancher.Cluster{ID: "c-dev", Name: "dev"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, updated)
+	assert.Equal(t, []plan.Skip{{Context: "prod", Reason: SkipReasonWindow}}, p.Skipped)
+
+	// New entries don't wait for the window
+	opts.AutoCreate = true
+	updated, err = process(client, api.NewConfig(), rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, updated, "a new entry is created outside the window")
+
+	opts.ForceRefresh = true
+	updated, err = process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, updated, "--force-refresh rotates outside the window")
+}
+
+func TestProcess_MaxTokenAge(t *testing.T) {
+	created := time.Now().Add(-100 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	recent := time.Now().Add(-10 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/users":
+			_, _ = w.Write([]byte(`{"data": [{"id": "u-me"}]}`))
+		case "/v3/tokens/kubeconfig-u-old":
+			_, _ = w.Write([]byte(`{"userId": "u-me", "ttl": 0, "created": "` + created + `"}`))
+		case "/v3/tokens/kubeconfig-u-new":
+			_, _ = w.Write([]byte(`{"userId": "u-me", "ttl": 0, "created": "` + recent + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["old"] = &api.AuthInfo{Token: "kubeconfig-u-old:secret"}
+	kubecfg.AuthInfos["new"] = &api.AuthInfo{Token: "kubeconfig-u-new:secret"}
+
+	p := plan.New(true)
+	opts := Options{RancherURL: server.URL, ThresholdDays: 30, DryRun: true, Plan: p, MaxTokenAge: 90 * 24 * time.Hour}
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-old", Name: "old"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, updated)
+	updated, err = process(client, kubecfg, rancher.Cluster{ID: "c-new", Name: "new"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, updated)
+
+	require.Len(t, p.UpdatedTokens, 1)
+	assert.Equal(t, string(rancher.ReasonTokenTooOld), p.UpdatedTokens[0].Reason)
+	assert.Equal(t, []plan.Skip{{Context: "new", Reason: string(rancher.ReasonNeverExpires)}}, p.Skipped)
+}
@@ -0,0 +1,36 @@
+package pipeline
+
+import (
+	"rancher-kubeconfig-updater/internal/rancher"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ReasonRenewed is the plan reason of tokens whose TTL was extended instead of replacing them
+const ReasonRenewed = "renewed"
+
+// renewToken extends the TTL of the current token of cluster v with --renew-tokens, so systems
+// that pinned the token name keep working. Only tokens replaced because they expire soon are
+// renewed; tokens that expired, are too old or have the wrong scope still need a new token.
+// Returns whether the token was renewed; otherwise the caller generates a new one.
+func renewToken(client *rancher.Client, currentToken string, v rancher.Cluster, decision rancher.TokenRegenerationDecision, opts Options, zapLogger *zap.Logger) bool {
+	if !opts.RenewTokens || decision.Reason != rancher.ReasonExpiresSoon || decision.DaysUntilExpiry <= 0 {
+		return false
+	}
+	if opts.TokenScope != "" {
+		if scope, err := client.GetTokenScope(currentToken); err != nil || scope != opts.TokenScope {
+			return false
+		}
+	}
+
+	expiresAt, err := client.RenewToken(currentToken)
+	if err != nil {
+		zapLogger.Warn("Failed to renew token, generating a new one", zap.String("cluster", v.Name), zap.Error(err))
+		opts.Explain.add("renewal failed: %v", err)
+		return false
+	}
+	zapLogger.Info("Renewed token instead of replacing it", zap.String("cluster", v.Name), zap.Time("expiresAt", expiresAt))
+	opts.Explain.add("renewed: the token keeps its name and now expires %s", expiresAt.Format(time.RFC3339))
+	return true
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"rancher-kubeconfig-updater/internal/notify"
+	"rancher-kubeconfig-updater/internal/plan"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// newRenewServer returns a Rancher stub with a token expiring in 5 days that extends its
+// expiry when its TTL is changed, if renewable is set. generated counts generated kubeconfigs.
+func newRenewServer(t *testing.T, renewable bool, generated *atomic.Int32) *httptest.Server {
+	created := time.Now().Add(-25 * 24 * time.Hour).UTC()
+	var ttl atomic.Int64
+	ttl.Store(int64(30 * 24 * time.Hour / time.Millisecond))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v3/users":
+			_, _ = w.Write([]byte(`{"data": [{"id": "u-me"}]}`))
+		case r.URL.Path == "/v3/tokens/kubeconfig-u-old" && r.Method == http.MethodPut:
+			var body map[string]int64
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if renewable {
+				ttl.Store(body["ttl"])
+			}
+			_, _ = w.Write([]byte(`{}`))
+		case r.URL.Path == "/v3/tokens/kubeconfig-u-old":
+			expiresAt := created.Add(time.Duration(ttl.Load()) * time.Millisecond)
+			_, _ = fmt.Fprintf(w, `{"userId": "u-me", "created": %q, "expiresAt": %q, "ttl": %d}`,
+				created.Format(time.RFC3339), expiresAt.Format(time.RFC3339), ttl.Load())
+		case r.URL.Query().Get("action") == "generateKubeconfig":
+			generated.Add(1)
+			_ = json.NewEncoder(w).Encode(map[string]string{"config": generatedKubeconfig("prod", "c-prod", "kubeconfig-u-new:secret")})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProcess_RenewToken(t *testing.T) {
+	var generated atomic.Int32
+	server := newRenewServer(t, true, &generated)
+	client := rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:secret"}
+	p := plan.New(false)
+	opts := Options{RancherURL: server.URL, ThresholdDays: 10, RenewTokens: true, Plan: p}
+
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, updated)
+	assert.Equal(t, "kubeconfig-u-old:secret", kubecfg.AuthInfos["prod"].Token, "the token keeps its name")
+	assert.Zero(t, generated.Load())
+	require.Len(t, p.UpdatedTokens, 1)
+	assert.Equal(t, ReasonRenewed, p.UpdatedTokens[0].Reason)
+	assert.Equal(t, "kubeconfig-u-old", p.UpdatedTokens[0].NewTokenName)
+
+	// The renewed token no longer expires within the threshold
+	updated, err = process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, updated)
+}
+
+func TestProcess_RenewTokenFallsBack(t *testing.T) {
+	var generated atomic.Int32
+	server := newRenewServer(t, false, &generated)
+	client := rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:secret"}
+	events := notify.NewRecorder()
+	opts := Options{RancherURL: server.URL, ThresholdDays: 10, RenewTokens: true, AutoCreate: true, Events: events}
+
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, updated)
+	assert.Equal(t, "kubeconfig-u-new:secret", kubecfg.AuthInfos["prod"].Token, "Rancher kept the expiry, so a new token is generated")
+	assert.EqualValues(t, 1, generated.Load())
+
+	var changes []notify.Event
+	for _, e := range events.Events() {
+		if e.Type == notify.EventTokenChanged {
+			changes = append(changes, e)
+		}
+	}
+	require.Len(t, changes, 1, "the new token name is published")
+	assert.Equal(t, "kubeconfig-u-old", changes[0].OldTokenName)
+	assert.Equal(t, "kubeconfig-u-new", changes[0].NewTokenName)
+}
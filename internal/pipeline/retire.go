@@ -0,0 +1,29 @@
+package pipeline
+
+import (
+	"rancher-kubeconfig-updater/internal/rancher"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// retireToken records the token that the entry of cluster v used before it got newToken, so a
+// later run revokes it once the grace period has passed. Processes still holding the old token
+// keep working until then. Only the user's own tokens are retired: a token taken over from
+// someone else's kubeconfig, or shared with other entries, is not ours to revoke.
+func retireToken(client *rancher.Client, currentToken, newToken string, v rancher.Cluster, opts Options, zapLogger *zap.Logger) {
+	if !opts.RevokeReplaced || opts.State == nil {
+		return
+	}
+	oldName, oldErr := rancher.TokenName(currentToken)
+	newName, newErr := rancher.TokenName(newToken)
+	if oldErr != nil || newErr != nil || oldName == newName {
+		return
+	}
+	if err := client.CheckTokenOwner(currentToken, v.ID); err != nil {
+		zapLogger.Debug("Not revoking replaced token", zap.String("cluster", v.Name), zap.String("tokenName", oldName), zap.Error(err))
+		return
+	}
+	opts.State.Retire(opts.RancherURL, oldName, time.Now())
+	opts.Explain.add("old token %s is revoked by a run after %s", oldName, opts.GracePeriod)
+}
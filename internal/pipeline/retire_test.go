@@ -0,0 +1,36 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/state"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestProcess_RetiresReplacedToken(t *testing.T) {
+	var generated atomic.Int32
+	server := newRenewServer(t, false, &generated)
+	client := rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:secret"}
+	opts := Options{RancherURL: server.URL, ThresholdDays: 10, AutoCreate: true, State: st, RevokeReplaced: true, GracePeriod: time.Hour}
+
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	assert.Empty(t, st.Due(server.URL, time.Hour, time.Now()), "the old token is kept during the grace period")
+	due := st.Due(server.URL, time.Hour, time.Now().Add(time.Hour))
+	require.Len(t, due, 1)
+	assert.Equal(t, "kubeconfig-u-old", due[0].Name)
+}
@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// applyTokenScope replaces a decision to keep the token when the token does not have the
+// requested scope. If the scope can't be looked up the decision stands.
+func applyTokenScope(client *rancher.Client, decision rancher.TokenRegenerationDecision, currentToken string, scope rancher.TokenScope, clusterName string, zapLogger *zap.Logger) rancher.TokenRegenerationDecision {
+	current, err := client.GetTokenScope(currentToken)
+	if err != nil {
+		zapLogger.Debug("Failed to check token scope", zap.String("cluster", clusterName), zap.Error(err))
+		return decision
+	}
+	if current != scope {
+		decision.ShouldRegenerate = true
+		decision.Reason = rancher.ReasonWrongTokenScope
+	}
+	return decision
+}
+
+// scopeToken makes sure the token Rancher generated for cluster v has the scope requested with
+// --token-scope. A token with another scope is replaced in clusterKubeconfig by a new token of
+// the requested scope and the same TTL, and then revoked. Returns the token to use.
+func scopeToken(client *rancher.Client, clusterKubeconfig *api.Config, token string, v rancher.Cluster, opts Options, zapLogger *zap.Logger) (string, error) {
+	if opts.TokenScope == "" {
+		return token, nil
+	}
+	info, err := client.GetTokenInfo(token)
+	if err != nil {
+		return "", fmt.Errorf("failed to check scope of the generated token: %w", err)
+	}
+	if info.Scope() == opts.TokenScope {
+		return token, nil
+	}
+	generatedName, err := rancher.TokenName(token)
+	if err != nil {
+		return "", err
+	}
+
+	clusterID := ""
+	if opts.TokenScope == rancher.TokenScopeCluster {
+		clusterID = v.ID
+	}
+	// The new token is labeled like annotateToken labels generated tokens
+	var description string
+	var labels map[string]string
+	if opts.Origin.RunID != "" {
+		description, labels = opts.Origin.Description("kubeconfig token"), opts.Origin.Labels()
+	}
+	scoped, err := client.CreateToken(clusterID, time.Duration(info.TTL)*time.Millisecond, description, labels)
+	if err != nil {
+		zapLogger.Error("Rancher did not issue a token with the requested scope",
+			zap.String("cluster", v.Name), zap.String("scope", string(opts.TokenScope)), zap.Error(err))
+		if revokeErr := client.RevokeToken(generatedName); revokeErr != nil {
+			zapLogger.Warn("Failed to revoke generated token", zap.String("tokenName", generatedName), zap.Error(revokeErr))
+		}
+		return "", err
+	}
+
+	for _, authInfo := range clusterKubeconfig.AuthInfos {
+		if authInfo != nil && authInfo.Token == token {
+			authInfo.Token = scoped
+		}
+	}
+	if err := client.RevokeToken(generatedName); err != nil {
+		zapLogger.Warn("Failed to revoke generated token", zap.String("tokenName", generatedName), zap.Error(err))
+	}
+	zapLogger.Info("Replaced generated token with a token of the requested scope",
+		zap.String("cluster", v.Name), zap.String("scope", string(opts.TokenScope)), zap.String("generatedScope", string(info.Scope())))
+	opts.Explain.add("token scope: generated %s token replaced by a %s token", info.Scope(), opts.TokenScope)
+	return scoped, nil
+}
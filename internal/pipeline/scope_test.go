@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// scopeStub is a Rancher server whose generateKubeconfig action issues a global token and
+// which records the tokens created and revoked
+type scopeStub struct {
+	mu      sync.Mutex
+	created []map[string]any
+	revoked []string
+}
+
+func newScopeStub(t *testing.T) (*scopeStub, *rancher.Client) {
+	t.Helper()
+	stub := &scopeStub{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		switch {
+		case r.URL.Query().Get("action") == "generateKubeconfig":
+			_ = json.NewEncoder(w).Encode(map[string]string{"config": tokenKubeconfig})
+		case r.Method == http.MethodGet && r.URL.Path == "/v3/tokens/kubeconfig-u-new":
+			_, _ = w.Write([]byte(`{"name": "kubeconfig-u-new", "userId": "u-me", "ttl": 7776000000}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v3/tokens/kubeconfig-u-old":
+			_, _ = w.Write([]byte(`{"name": "kubeconfig-u-old", "userId": "u-me", "ttl": 0}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/v3/tokens":
+			body, _ := io.ReadAll(r.Body)
+			var request map[string]any
+			_ = json.Unmarshal(body, &request)
+			stub.created = append(stub.created, request)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "kubeconfig-u-scoped:secret"}`))
+		case r.Method == http.MethodDelete:
+			stub.revoked = append(stub.revoked, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return stub, rancher.NewClientWithToken(server.URL, "stub-token", zap.NewNop(), false)
+}
+
+func TestProcess_TokenScope(t *testing.T) {
+	stub, client := newScopeStub(t)
+
+	kubecfg := api.NewConfig()
+	kubecfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-old:oldsecret"}
+
+	// A never-expiring global token is kept unless cluster-scoped tokens are requested
+	opts := Options{RancherURL: "https://rancher.example.com", ThresholdDays: 30}
+	updated, err := process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, updated)
+
+	opts.TokenScope = rancher.TokenScopeCluster
+	updated, err = process(client, kubecfg, rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, updated)
+
+	assert.Equal(t, "kubeconfig-u-scoped:secret", kubecfg.AuthInfos["prod"].Token)
+	require.Len(t, stub.created, 1)
+	assert.Equal(t, "c-prod", stub.created[0]["clusterId"])
+	assert.InDelta(t, 7776000000, stub.created[0]["ttl"], 0, "the new token keeps the generated token's TTL")
+	assert.Equal(t, []string{"/v3/tokens/kubeconfig-u-new"}, stub.revoked)
+}
+
+func TestScopeToken_MatchingScopeIsKept(t *testing.T) {
+	stub, client := newScopeStub(t)
+
+	clusterKubeconfig := &api.Config{AuthInfos: map[string]*api.AuthInfo{"prod": {Token: "kubeconfig-u-new:newsecret"}}}
+	opts := Options{TokenScope: rancher.TokenScopeGlobal}
+	token, err := scopeToken(client, clusterKubeconfig, "kubeconfig-u-new:newsecret", rancher.Cluster{ID: "c-prod", Name: "prod"}, opts, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "kubeconfig-u-new:newsecret", token)
+	assert.Empty(t, stub.created)
+	assert.Empty(t, stub.revoked)
+}
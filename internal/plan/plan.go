@@ -0,0 +1,159 @@
+// Package plan records the kubeconfig changes of a run in a machine-readable form.
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"rancher-kubeconfig-updater/internal/rancher"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"sync"
+)
+
+// Plan lists the changes a run made or, in dry-run mode, would make.
+// All methods are safe on a nil *Plan, which records nothing.
+type Plan struct {
+	mu sync.Mutex
+
+	DryRun        bool           `json:"dryRun"`
+	AddedContexts []ContextEntry `json:"addedContexts"`
+	UpdatedTokens []TokenChange  `json:"updatedTokens"`
+	PrunedEntries []ContextEntry `json:"prunedEntries"`
+	Skipped       []Skip         `json:"skipped"`
+}
+
+// ContextEntry identifies a kubeconfig context and the Rancher cluster behind it.
+type ContextEntry struct {
+	Context   string `json:"context"`
+	ClusterID string `json:"clusterId,omitempty"`
+}
+
+// TokenChange describes a token that is replaced in an existing entry.
+// Token names are recorded, never the secrets. NewTokenName is empty in dry-run
+// mode because the new token is only issued when the change is applied.
+type TokenChange struct {
+	Context      string `json:"context"`
+	ClusterID    string `json:"clusterId"`
+	OldTokenName string `json:"oldTokenName,omitempty"`
+	NewTokenName string `json:"newTokenName,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+// Skip describes a cluster that is left unchanged.
+type Skip struct {
+	Context string `json:"context"`
+	Reason  string `json:"reason"`
+}
+
+// New creates an empty plan.
+func New(dryRun bool) *Plan {
+	return &Plan{
+		DryRun:        dryRun,
+		AddedContexts: []ContextEntry{},
+		UpdatedTokens: []TokenChange{},
+		PrunedEntries: []ContextEntry{},
+		Skipped:       []Skip{},
+	}
+}
+
+// AddContext records a context that is created.
+func (p *Plan) AddContext(context, clusterID string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.AddedContexts = append(p.AddedContexts, ContextEntry{Context: context, ClusterID: clusterID})
+}
+
+// UpdateToken records a token replacement. oldToken and newToken may be empty;
+// only their token names end up in the plan.
+func (p *Plan) UpdateToken(context, clusterID, oldToken, newToken, reason string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.UpdatedTokens = append(p.UpdatedTokens, TokenChange{
+		Context:      context,
+		ClusterID:    clusterID,
+		OldTokenName: tokenName(oldToken),
+		NewTokenName: tokenName(newToken),
+		Reason:       reason,
+	})
+}
+
+// Prune records an entry that is removed. Only entries the tool created are ever removed,
+// see kubeconfig.RemoveContext.
+func (p *Plan) Prune(context, clusterID string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.PrunedEntries = append(p.PrunedEntries, ContextEntry{Context: context, ClusterID: clusterID})
+}
+
+// Skip records a cluster that is left unchanged.
+func (p *Plan) Skip(context, reason string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Skipped = append(p.Skipped, Skip{Context: context, Reason: reason})
+}
+
+// Merge appends what other recorded to p, e.g. the plan of a single cluster to the plan of
+// the run.
+func (p *Plan) Merge(other *Plan) {
+	if p == nil || other == nil {
+		return
+	}
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.AddedContexts = append(p.AddedContexts, other.AddedContexts...)
+	p.UpdatedTokens = append(p.UpdatedTokens, other.UpdatedTokens...)
+	p.PrunedEntries = append(p.PrunedEntries, other.PrunedEntries...)
+	p.Skipped = append(p.Skipped, other.Skipped...)
+}
+
+// Write encodes the plan as indented JSON.
+func (p *Plan) Write(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// WriteFile writes the plan to path, or to stdout if path is "-".
+func (p *Plan) WriteFile(path string) error {
+	if path == "-" {
+		return p.Write(os.Stdout)
+	}
+	if err := readonly.Check(path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create plan file: %w", err)
+	}
+	if err := p.Write(f); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write plan file: %w", err)
+	}
+	return f.Close()
+}
+
+// tokenName returns the name part of a Rancher token, or "" if there is none
+func tokenName(token string) string {
+	name, err := rancher.TokenName(token)
+	if err != nil {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,69 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan_RecordsTokenNamesNotSecrets(t *testing.T) {
+	p := New(true)
+	p.AddContext("new", "c-new")
+	p.UpdateToken("prod", "c-prod", "kubeconfig-u-old:oldsecret", "kubeconfig-u-new:newsecret", "expires_soon")
+	p.Skip("stage", "still_valid")
+
+	var buf bytes.Buffer
+	require.NoError(t, p.Write(&buf))
+	output := buf.String()
+	assert.NotContains(t, output, "oldsecret")
+	assert.NotContains(t, output, "newsecret")
+
+	var decoded Plan
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.True(t, decoded.DryRun)
+	assert.Equal(t, []ContextEntry{{Context: "new", ClusterID: "c-new"}}, decoded.AddedContexts)
+	require.Len(t, decoded.UpdatedTokens, 1)
+	assert.Equal(t, "kubeconfig-u-old", decoded.UpdatedTokens[0].OldTokenName)
+	assert.Equal(t, "kubeconfig-u-new", decoded.UpdatedTokens[0].NewTokenName)
+	assert.Equal(t, []Skip{{Context: "stage", Reason: "still_valid"}}, decoded.Skipped)
+	assert.NotNil(t, decoded.PrunedEntries)
+}
+
+func TestPlan_NilIsNoOp(t *testing.T) {
+	var p *Plan
+	assert.NotPanics(t, func() {
+		p.AddContext("a", "c-a")
+		p.UpdateToken("a", "c-a", "", "", "force_refresh_enabled")
+		p.Prune("a", "c-a")
+		p.Skip("a", "still_valid")
+		p.Merge(New(false))
+	})
+}
+
+func TestPlan_Merge(t *testing.T) {
+	run := New(false)
+	run.Skip("stage", "still_valid")
+	cluster := New(false)
+	cluster.AddContext("new", "c-new")
+	cluster.Skip("dev", "policy_never")
+
+	run.Merge(cluster)
+	assert.Equal(t, []ContextEntry{{Context: "new", ClusterID: "c-new"}}, run.AddedContexts)
+	assert.Equal(t, []Skip{{Context: "stage", Reason: "still_valid"}, {Context: "dev", Reason: "policy_never"}}, run.Skipped)
+	assert.Empty(t, run.UpdatedTokens)
+}
+
+func TestPlan_WriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, New(false).WriteFile(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"dryRun": false`)
+	assert.Contains(t, string(data), `"addedContexts": []`)
+}
@@ -0,0 +1,193 @@
+// Package policy lets an organization override how the rotation of single clusters is decided.
+//
+// A policy is an ordered list of rules. The first rule matching a cluster decides for it: it
+// can forbid rotating the cluster's token, rotate it on every run, change the expiry threshold
+// or rotate tokens older than a maximum age, even if they have a long or no TTL at all. It
+// can also limit rotation to maintenance windows.
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rotate says when a rule rotates the tokens of its clusters.
+type Rotate string
+
+const (
+	// RotateAuto rotates by expiry and age, as without a policy
+	RotateAuto Rotate = "auto"
+	// RotateNever keeps the token, even with --force-refresh
+	RotateNever Rotate = "never"
+	// RotateAlways replaces the token on every run
+	RotateAlways Rotate = "always"
+)
+
+// Policy is the ordered list of rules.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule applies to the clusters matching all of its conditions. A rule without conditions
+// matches every cluster, which makes it a default at the end of the list.
+type Rule struct {
+	// Clusters limits the rule to clusters whose name or ID matches one of these glob patterns
+	Clusters []string `yaml:"clusters,omitempty"`
+	// Labels limits the rule to clusters carrying all of these Rancher labels
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Rotate is auto (the default), never or always
+	Rotate Rotate `yaml:"rotate,omitempty"`
+	// ThresholdDays overrides --threshold-days
+	ThresholdDays *int `yaml:"threshold-days,omitempty"`
+	// MaxAge rotates tokens created longer ago than this, e.g. "60d" or "1w"
+	MaxAge Duration `yaml:"max-age,omitempty"`
+	// Windows limits rotating existing tokens to these maintenance windows
+	Windows []Window `yaml:"windows,omitempty"`
+}
+
+// Duration is a time.Duration that also accepts days ("90d") and weeks ("2w").
+type Duration time.Duration
+
+// UnmarshalYAML parses the duration with ParseDuration.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// ParseDuration parses a Go duration such as "36h", or a number of days or weeks such as "90d" or "2w".
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		number, ok := strings.CutSuffix(s, suffix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n * float64(unit)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: use e.g. 90d, 2w or 36h", s)
+	}
+	return d, nil
+}
+
+// Load reads and validates the policy at path.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse decodes and validates a policy. Unknown keys are rejected so a typo does not
+// silently rotate a frozen cluster.
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	var problems []string
+	for i := range p.Rules {
+		if err := p.Rules[i].validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("rule %d: %v", i+1, err))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return &p, nil
+}
+
+// validate checks the rule and compiles its windows
+func (r *Rule) validate() error {
+	switch r.Rotate {
+	case "", RotateAuto, RotateNever, RotateAlways:
+	default:
+		return fmt.Errorf("unknown rotate %q: must be auto, never or always", r.Rotate)
+	}
+	for _, pattern := range r.Clusters {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid cluster pattern %q: %w", pattern, err)
+		}
+	}
+	if r.ThresholdDays != nil && *r.ThresholdDays < 0 {
+		return errors.New("threshold-days must not be negative")
+	}
+	if r.MaxAge < 0 {
+		return errors.New("max-age must not be negative")
+	}
+	for i := range r.Windows {
+		if err := r.Windows[i].compile(); err != nil {
+			return fmt.Errorf("window %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to the cluster
+func (r Rule) matches(name, id string, labels map[string]string) bool {
+	for key, value := range r.Labels {
+		if actual, ok := labels[key]; !ok || actual != value {
+			return false
+		}
+	}
+	if len(r.Clusters) == 0 {
+		return true
+	}
+	for _, pattern := range r.Clusters {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, id); ok && id != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// For returns the first rule matching the cluster and its 1-based number in the policy.
+// The number is 0 if no rule matches or the policy is nil; the returned rule then rotates
+// by expiry as without a policy.
+func (p *Policy) For(name, id string, labels map[string]string) (Rule, int) {
+	if p == nil {
+		return Rule{Rotate: RotateAuto}, 0
+	}
+	for i, rule := range p.Rules {
+		if rule.matches(name, id, labels) {
+			if rule.Rotate == "" {
+				rule.Rotate = RotateAuto
+			}
+			return rule, i + 1
+		}
+	}
+	return Rule{Rotate: RotateAuto}, 0
+}
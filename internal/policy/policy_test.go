@@ -0,0 +1,109 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(`
+rules:
+  - labels: {frozen: "true"}
+    rotate: never
+  - clusters: ["dev-*", "c-m-lab"]
+    max-age: 1w
+    threshold-days: 3
+  - max-age: 60d
+`))
+	require.NoError(t, err)
+	require.Len(t, p.Rules, 3)
+	assert.Equal(t, RotateNever, p.Rules[0].Rotate)
+	assert.Equal(t, Duration(7*24*time.Hour), p.Rules[1].MaxAge)
+	assert.Equal(t, 3, *p.Rules[1].ThresholdDays)
+	assert.Equal(t, Duration(60*24*time.Hour), p.Rules[2].MaxAge)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{name: "unknown key", yaml: "rules:\n  - rotaet: never\n", want: "rotaet"},
+		{name: "unknown rotate", yaml: "rules:\n  - rotate: sometimes\n", want: `rule 1: unknown rotate "sometimes"`},
+		{name: "bad pattern", yaml: "rules:\n  - clusters: [\"[\"]\n", want: "invalid cluster pattern"},
+		{name: "bad duration", yaml: "rules:\n  - max-age: soon\n", want: `invalid duration "soon"`},
+		{name: "negative threshold", yaml: "rules:\n  - threshold-days: -1\n", want: "threshold-days must not be negative"},
+		{name: "bad window start", yaml: "rules:\n  - windows: [{start: \"0 25 * * *\", duration: 1h}]\n", want: "rule 1: window 1: invalid start"},
+		{name: "window without duration", yaml: "rules:\n  - windows: [{start: \"0 22 * * *\"}]\n", want: "must be positive"},
+		{name: "bad window timezone", yaml: "rules:\n  - windows: [{start: \"0 22 * * *\", duration: 1h, timezone: Mars/Olympus}]\n", want: "invalid timezone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{in: "90d", want: 90 * 24 * time.Hour},
+		{in: "2w", want: 14 * 24 * time.Hour},
+		{in: "1.5d", want: 36 * time.Hour},
+		{in: "36h", want: 36 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+	_, err := ParseDuration("d")
+	assert.Error(t, err)
+}
+
+func TestFor(t *testing.T) {
+	p, err := Parse([]byte(`
+rules:
+  - labels: {frozen: "true"}
+    rotate: never
+  - clusters: ["dev-*"]
+    rotate: always
+  - clusters: ["c-m-*"]
+    max-age: 60d
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		cluster    string
+		id         string
+		labels     map[string]string
+		wantRule   int
+		wantRotate Rotate
+	}{
+		{name: "label", cluster: "dev-1", id: "c-m-1", labels: map[string]string{"frozen": "true"}, wantRule: 1, wantRotate: RotateNever},
+		{name: "first match wins", cluster: "dev-1", id: "c-m-1", wantRule: 2, wantRotate: RotateAlways},
+		{name: "by id", cluster: "prod", id: "c-m-2", wantRule: 3, wantRotate: RotateAuto},
+		{name: "label value differs", cluster: "prod", id: "c-x", labels: map[string]string{"frozen": "false"}, wantRule: 0, wantRotate: RotateAuto},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, number := p.For(tt.cluster, tt.id, tt.labels)
+			assert.Equal(t, tt.wantRule, number)
+			assert.Equal(t, tt.wantRotate, rule.Rotate)
+		})
+	}
+
+	var none *Policy
+	rule, number := none.For("prod", "c-1", nil)
+	assert.Equal(t, 0, number)
+	assert.Equal(t, RotateAuto, rule.Rotate)
+}
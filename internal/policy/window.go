@@ -0,0 +1,98 @@
+package policy
+
+import (
+	"fmt"
+	"rancher-kubeconfig-updater/internal/schedule"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	// Windows in a named timezone must work on machines without a zoneinfo database, e.g. Windows
+	_ "time/tzdata"
+)
+
+// maxWindowDuration bounds how long a maintenance window stays open
+const maxWindowDuration = 31 * 24 * time.Hour
+
+// Window is a maintenance window: it opens at the times of a cron expression and stays open
+// for Duration.
+type Window struct {
+	// Start is a cron expression of when the window opens, in the dialect of --schedule:
+	// minute, hour, day of month, month and day of week, e.g. "0 22 * * 2,4" for Tuesdays and
+	// Thursdays at 22:00, or a descriptor such as "@daily". A CRON_TZ=Europe/Berlin prefix
+	// chooses the timezone, like Timezone.
+	Start string `yaml:"start"`
+	// Duration is how long the window stays open, e.g. "4h"
+	Duration Duration `yaml:"duration"`
+	// Timezone of Start, e.g. "Europe/Berlin" (default: the local time of the machine)
+	Timezone string `yaml:"timezone,omitempty"`
+
+	schedule *cron.SpecSchedule
+}
+
+// compile parses Start and Timezone
+func (w *Window) compile() error {
+	spec := strings.TrimSpace(w.Start)
+	if w.Timezone != "" {
+		if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+			return fmt.Errorf("window %q sets its timezone twice, with a CRON_TZ= prefix and timezone", w.Start)
+		}
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", w.Timezone, err)
+		}
+		spec = "CRON_TZ=" + w.Timezone + " " + spec
+	}
+	s, err := schedule.ParseSpec(spec)
+	if err != nil {
+		return fmt.Errorf("invalid start %q: %w", w.Start, err)
+	}
+	// "@every" repeats relative to whenever it is asked, so it has no start time to open at
+	schedule, ok := s.(*cron.SpecSchedule)
+	if !ok {
+		return fmt.Errorf("invalid start %q: a window needs fixed start times, @every is not supported", w.Start)
+	}
+	if w.Duration <= 0 || time.Duration(w.Duration) > maxWindowDuration {
+		return fmt.Errorf("duration of window %q must be positive and at most 31d", w.Start)
+	}
+	w.schedule = schedule
+	return nil
+}
+
+// Open reports whether the window is open at now: whether it opened within Duration before now.
+func (w Window) Open(now time.Time) bool {
+	if w.schedule == nil {
+		return false
+	}
+	// Open if it opened after now-Duration, and not only after now
+	opened := w.schedule.Next(now.Add(-time.Duration(w.Duration)))
+	return !opened.IsZero() && !opened.After(now)
+}
+
+// Next returns when the window opens next after now, or the zero time if it never opens
+// again, e.g. on February 30th.
+func (w Window) Next(now time.Time) time.Time {
+	if w.schedule == nil {
+		return time.Time{}
+	}
+	return w.schedule.Next(now)
+}
+
+// InWindow reports whether tokens of the rule's clusters may be rotated at now: always for
+// rules without windows, otherwise while one of the windows is open. When no window is open
+// it also returns when the next one opens (the zero time if none opens again).
+func (r Rule) InWindow(now time.Time) (bool, time.Time) {
+	if len(r.Windows) == 0 {
+		return true, time.Time{}
+	}
+	var next time.Time
+	for _, w := range r.Windows {
+		if w.Open(now) {
+			return true, time.Time{}
+		}
+		if n := w.Next(now); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return false, next
+}
@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow_Open(t *testing.T) {
+	tests := []struct {
+		start string
+		at    string
+		open  bool
+	}{
+		{start: "0 22 * * *", at: "2026-03-03 22:00", open: true},
+		{start: "0 22 * * *", at: "2026-03-03 22:59", open: true},
+		{start: "0 22 * * *", at: "2026-03-03 23:00", open: false},
+		{start: "0 22 * * *", at: "2026-03-03 21:59", open: false},
+		{start: "*/15 8-18 * * 1-5", at: "2026-03-03 08:45", open: true},
+		{start: "*/15 8-18 * * 1-5", at: "2026-03-07 08:45", open: false},
+		{start: "0 2 * * 0", at: "2026-03-08 02:00", open: true},
+		{start: "30 1 1,15 * *", at: "2026-03-15 01:30", open: true},
+		{start: "0 0 * * SUN", at: "2026-03-08 00:30", open: true},
+		{start: "@daily", at: "2026-03-03 00:30", open: true},
+		{start: "@daily", at: "2026-03-03 01:00", open: false},
+		// Both days restricted: either matches, as in cron
+		{start: "0 0 13 * 5", at: "2026-03-06 00:00", open: true},
+		{start: "0 0 13 * 5", at: "2026-03-13 00:00", open: true},
+		{start: "0 0 13 * 5", at: "2026-03-12 00:00", open: false},
+	}
+	for _, tt := range tests {
+		w := Window{Start: tt.start, Duration: Duration(time.Hour), Timezone: "UTC"}
+		require.NoError(t, w.compile(), tt.start)
+		at, err := time.Parse("2006-01-02 15:04", tt.at)
+		require.NoError(t, err)
+		assert.Equal(t, tt.open, w.Open(at), "%s at %s", tt.start, tt.at)
+	}
+
+	// A CRON_TZ= prefix chooses the timezone, as in --schedule
+	w := Window{Start: "CRON_TZ=Asia/Tokyo 0 9 * * *", Duration: Duration(time.Hour)}
+	require.NoError(t, w.compile())
+	assert.True(t, w.Open(time.Date(2026, 3, 3, 0, 30, 0, 0, time.UTC)))
+
+	for _, start := range []string{"", "0 22 * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "0 2 * * 7", "@every 2h"} {
+		w := Window{Start: start, Duration: Duration(time.Hour)}
+		assert.Error(t, w.compile(), start)
+	}
+	w = Window{Start: "CRON_TZ=UTC 0 22 * * *", Duration: Duration(time.Hour), Timezone: "Europe/Berlin"}
+	assert.ErrorContains(t, w.compile(), "timezone twice")
+}
+
+func TestRule_InWindow(t *testing.T) {
+	p, err := Parse([]byte(`
+rules:
+  - clusters: ["prod-*"]
+    windows:
+      - start: "0 22 * * 2,4"
+        duration: 4h
+        timezone: Europe/Berlin
+  - max-age: 60d
+`))
+	require.NoError(t, err)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	rule, _ := p.For("prod-eu", "c-1", nil)
+
+	// Tuesday 2026-03-03 23:30 in Berlin is within the window opened at 22:00
+	open, next := rule.InWindow(time.Date(2026, 3, 3, 23, 30, 0, 0, berlin))
+	assert.True(t, open)
+	assert.True(t, next.IsZero())
+
+	// The window stays open past midnight until 02:00
+	open, _ = rule.InWindow(time.Date(2026, 3, 4, 1, 59, 0, 0, berlin).UTC())
+	assert.True(t, open)
+
+	open, next = rule.InWindow(time.Date(2026, 3, 4, 2, 0, 0, 0, berlin))
+	assert.False(t, open)
+	assert.True(t, time.Date(2026, 3, 5, 22, 0, 0, 0, berlin).Equal(next), "next window is Thursday, got %s", next)
+
+	// Rules without windows may always rotate
+	rule, _ = p.For("dev", "c-2", nil)
+	open, _ = rule.InWindow(time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC))
+	assert.True(t, open)
+}
@@ -0,0 +1,101 @@
+// Package privilege detects runs with elevated privileges that would write files
+// belonging to another user, such as `sudo` runs against a user's ~/.kube/config, and keeps
+// users apart on machines they share.
+package privilege
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CheckWrite returns an error if the process runs as root (elevated on Windows) and
+// path, or the nearest existing directory above it, belongs to another user.
+// Writing there would leave root-owned files the user can no longer manage.
+func CheckWrite(path string) error {
+	if !IsElevated() {
+		return nil
+	}
+
+	existing, err := nearestExisting(path)
+	if err != nil {
+		return err
+	}
+	foreign, err := ownedByOther(existing)
+	if err != nil {
+		return fmt.Errorf("failed to determine owner of %s: %w", existing, err)
+	}
+	if foreign {
+		return fmt.Errorf("refusing to write %s as root: it belongs to another user (run without sudo, or pass --allow-root)", path)
+	}
+	return nil
+}
+
+// CheckOwner returns an error if path exists and it, or the file a symbolic link at path
+// points to, belongs to another user. On machines several users share, refreshing another
+// user's kubeconfig would hand them this user's Rancher tokens. Files that do not exist yet
+// are created by the current user, so they pass.
+func CheckOwner(path string) error {
+	paths := []string{path}
+	if target, err := filepath.EvalSymlinks(path); err == nil && target != path {
+		paths = append(paths, target)
+	}
+	for _, p := range paths {
+		if _, err := os.Lstat(p); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		foreign, err := ownedByOther(p)
+		if err != nil {
+			return fmt.Errorf("failed to determine owner of %s: %w", p, err)
+		}
+		if foreign {
+			return fmt.Errorf("refusing to use %s: it belongs to another user", p)
+		}
+	}
+	return nil
+}
+
+// SecureDir creates dir, readable only by the current user, or checks an existing one: it
+// must not be a symbolic link and must belong to the current user, and access for other
+// users is removed.
+func SecureDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("refusing to use %s: it is a symbolic link", dir)
+	}
+	foreign, err := ownedByOther(dir)
+	if err != nil {
+		return fmt.Errorf("failed to determine owner of %s: %w", dir, err)
+	}
+	if foreign {
+		return fmt.Errorf("refusing to use %s: it belongs to another user", dir)
+	}
+	return restrict(dir, info)
+}
+
+// nearestExisting returns path if it exists, otherwise its closest existing parent
+func nearestExisting(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Lstat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", fmt.Errorf("no existing parent directory for %s", path)
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package privilege
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// IsElevated reports whether the process runs as root
+func IsElevated() bool {
+	return os.Geteuid() == 0
+}
+
+// ownedByOther reports whether path is owned by a user other than the effective user
+func ownedByOther(path string) (bool, error) {
+	return ownedByOtherThan(path, os.Geteuid())
+}
+
+func ownedByOtherThan(path string, uid int) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, fmt.Errorf("file owner not available")
+	}
+	return int(stat.Uid) != uid, nil
+}
+
+// restrict removes the access of the group and other users to dir
+func restrict(dir string, info os.FileInfo) error {
+	if info.Mode().Perm()&0077 == 0 {
+		return nil
+	}
+	if err := os.Chmod(dir, info.Mode().Perm()&0700); err != nil {
+		return fmt.Errorf("failed to restrict access to %s: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+//go:build !windows
+
+package privilege
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnedByOtherThan(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(file, []byte("x"), 0600))
+
+	foreign, err := ownedByOtherThan(file, os.Geteuid())
+	require.NoError(t, err)
+	assert.False(t, foreign)
+
+	foreign, err = ownedByOtherThan(file, os.Geteuid()+1)
+	require.NoError(t, err)
+	assert.True(t, foreign)
+}
+
+func TestCheckWrite_ForeignPath(t *testing.T) {
+	if !IsElevated() {
+		t.Skip("requires root to create a file owned by another user")
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.Chown(dir, 65534, 65534))
+
+	err := CheckWrite(filepath.Join(dir, "config"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--allow-root")
+}
+
+func TestCheckOwner_ForeignPath(t *testing.T) {
+	if !IsElevated() {
+		t.Skip("requires root to create a file owned by another user")
+	}
+
+	file := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(file, []byte("x"), 0600))
+	require.NoError(t, os.Chown(file, 65534, 65534))
+	assert.ErrorContains(t, CheckOwner(file), "belongs to another user")
+
+	// A link of the current user does not hide the owner of its target
+	link := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.Symlink(file, link))
+	assert.ErrorContains(t, CheckOwner(link), "belongs to another user")
+
+	dir := filepath.Join(t.TempDir(), "state")
+	require.NoError(t, os.Mkdir(dir, 0700))
+	require.NoError(t, os.Chown(dir, 65534, 65534))
+	assert.ErrorContains(t, SecureDir(dir), "belongs to another user")
+}
+
+func TestSecureDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	require.NoError(t, SecureDir(dir))
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	// Access for others is removed from an existing directory
+	require.NoError(t, os.Chmod(dir, 0755))
+	require.NoError(t, SecureDir(dir))
+	info, err = os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	link := filepath.Join(t.TempDir(), "link")
+	require.NoError(t, os.Symlink(dir, link))
+	assert.ErrorContains(t, SecureDir(link), "is a symbolic link")
+}
@@ -0,0 +1,37 @@
+package privilege
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNearestExisting(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(file, []byte("x"), 0600))
+
+	got, err := nearestExisting(file)
+	require.NoError(t, err)
+	assert.Equal(t, file, got)
+
+	got, err = nearestExisting(filepath.Join(dir, "missing", "nested", "config"))
+	require.NoError(t, err)
+	assert.Equal(t, dir, got)
+}
+
+func TestCheckWrite_OwnPath(t *testing.T) {
+	// Files created by the test belong to the current user, elevated or not
+	assert.NoError(t, CheckWrite(filepath.Join(t.TempDir(), ".kube", "config")))
+}
+
+func TestCheckOwner_OwnPath(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config")
+	assert.NoError(t, CheckOwner(file), "a file that does not exist yet is created by the current user")
+
+	require.NoError(t, os.WriteFile(file, []byte("x"), 0600))
+	assert.NoError(t, CheckOwner(file))
+}
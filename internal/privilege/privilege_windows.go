@@ -0,0 +1,47 @@
+//go:build windows
+
+package privilege
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// IsElevated reports whether the process runs with an elevated (administrator) token
+func IsElevated() bool {
+	return windows.GetCurrentProcessToken().IsElevated()
+}
+
+// ownedByOther reports whether path is owned by someone other than the current user.
+// Files created while elevated are owned by the Administrators group, which counts as
+// the current user's own.
+func ownedByOther(path string) (bool, error) {
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, windows.OWNER_SECURITY_INFORMATION)
+	if err != nil {
+		return false, err
+	}
+	owner, _, err := sd.Owner()
+	if err != nil {
+		return false, err
+	}
+
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return false, err
+	}
+	if owner.Equals(user.User.Sid) {
+		return false, nil
+	}
+
+	admins, err := windows.CreateWellKnownSid(windows.WinBuiltinAdministratorsSid)
+	if err != nil {
+		return false, err
+	}
+	return !owner.Equals(admins), nil
+}
+
+// restrict does nothing on Windows, where the user profile's ACLs already keep other users out
+func restrict(string, os.FileInfo) error {
+	return nil
+}
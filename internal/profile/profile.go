@@ -0,0 +1,224 @@
+// Package profile describes Rancher servers and how to log in to them, one named profile per
+// server or target environment.
+//
+// Each profile names one server with its own auth type, credentials, TLS settings and
+// cluster filters. Settings a profile leaves out fall back to the command line flags and
+// environment variables, so only what differs between servers has to be written down. The
+// same file either selects one profile for a run (--config-file and --profile) or updates
+// every profile's server in one run (--profiles-config).
+package profile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/config"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is one Rancher server and how to log in to it.
+type Profile struct {
+	// Name identifies the profile in logs and errors
+	Name string `yaml:"name"`
+	// Server is the Rancher URL
+	Server string `yaml:"server"`
+	// AuthType, AuthProviderName and User replace --auth-type, --auth-provider-name and --user
+	AuthType         string `yaml:"auth-type,omitempty"`
+	AuthProviderName string `yaml:"auth-provider-name,omitempty"`
+	User             string `yaml:"user,omitempty"`
+	// CredentialCommand and CredentialsFrom replace --credential-command and --credentials-from
+	CredentialCommand string `yaml:"credential-command,omitempty"`
+	CredentialsFrom   string `yaml:"credentials-from,omitempty"`
+	// Issuer and OIDCClientID replace --issuer and --oidc-client-id
+	Issuer       string `yaml:"issuer,omitempty"`
+	OIDCClientID string `yaml:"oidc-client-id,omitempty"`
+	// InsecureSkipTLSVerify replaces --insecure-skip-tls-verify
+	InsecureSkipTLSVerify *bool `yaml:"insecure-skip-tls-verify,omitempty"`
+	// Clusters limits the update to these cluster names or IDs, replacing --cluster
+	Clusters []string `yaml:"clusters,omitempty"`
+	// IncludeLocal replaces --include-local
+	IncludeLocal *bool `yaml:"include-local,omitempty"`
+	// ClusterSource replaces --cluster-source
+	ClusterSource string `yaml:"cluster-source,omitempty"`
+
+	// The settings below apply to the whole run, so they are only read for the profile
+	// selected with --profile.
+
+	// AutoCreateOnly replaces --auto-create-only
+	AutoCreateOnly []string `yaml:"auto-create-only,omitempty"`
+	// Kubeconfig replaces --config
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+	// ThresholdDays replaces --threshold-days and TOKEN_THRESHOLD_DAYS
+	ThresholdDays *int `yaml:"threshold-days,omitempty"`
+	// MaxTokenAge replaces --max-token-age
+	MaxTokenAge string `yaml:"max-token-age,omitempty"`
+}
+
+// Config is the ordered list of profiles.
+type Config struct {
+	// DefaultProfile is selected when --profile is not given (no profile if empty)
+	DefaultProfile string    `yaml:"default-profile,omitempty"`
+	Profiles       []Profile `yaml:"profiles"`
+}
+
+// DefaultPath returns the path of the file when none is given:
+// $XDG_CONFIG_HOME/rancher-kubeconfig-updater/config.yaml, or ~/.config/... without it. On
+// Windows it is kept in %AppData%.
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if runtime.GOOS == "windows" {
+		var err error
+		if dir, err = os.UserConfigDir(); err != nil {
+			return "", err
+		}
+	} else if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "rancher-kubeconfig-updater", "config.yaml"), nil
+}
+
+// Load reads and validates the profiles at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profiles %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes and validates the profiles. Unknown keys are rejected so a typo does not
+// silently log in to a server with another profile's credentials.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(cfg.Profiles) == 0 {
+		return nil, errors.New("no profiles defined")
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for i, p := range cfg.Profiles {
+		if err := p.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("profile %d: %v", i+1, err))
+			continue
+		}
+		if seen[p.Name] {
+			problems = append(problems, fmt.Sprintf("profile %d: name %q is used twice", i+1, p.Name))
+		}
+		seen[p.Name] = true
+	}
+	if cfg.DefaultProfile != "" && !seen[cfg.DefaultProfile] {
+		problems = append(problems, fmt.Sprintf("default-profile %q is not defined", cfg.DefaultProfile))
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return &cfg, nil
+}
+
+// Select returns the profile called name, or the default profile if name is empty. Without a
+// default profile an empty name selects none, and ok is false.
+func (c *Config) Select(name string) (p Profile, ok bool, err error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		return Profile{}, false, nil
+	}
+	names := make([]string, 0, len(c.Profiles))
+	for _, p := range c.Profiles {
+		if p.Name == name {
+			return p, true, nil
+		}
+		names = append(names, p.Name)
+	}
+	return Profile{}, false, fmt.Errorf("profile %q is not defined, known profiles: %s", name, strings.Join(names, ", "))
+}
+
+// RunSettings returns the keys of the settings the profile sets that apply to the whole run
+// rather than to its server.
+func (p Profile) RunSettings() []string {
+	var keys []string
+	if len(p.AutoCreateOnly) > 0 {
+		keys = append(keys, "auto-create-only")
+	}
+	if p.Kubeconfig != "" {
+		keys = append(keys, "kubeconfig")
+	}
+	if p.ThresholdDays != nil {
+		keys = append(keys, "threshold-days")
+	}
+	if p.MaxTokenAge != "" {
+		keys = append(keys, "max-token-age")
+	}
+	return keys
+}
+
+// Settings returns the flag values the profile sets.
+func (p Profile) Settings() []config.Setting {
+	var settings []config.Setting
+	add := func(flag, env, value string) {
+		if value != "" {
+			settings = append(settings, config.Setting{Flag: flag, Env: env, Value: value})
+		}
+	}
+	addBool := func(flag, env string, value *bool) {
+		if value != nil {
+			add(flag, env, strconv.FormatBool(*value))
+		}
+	}
+	add("server", "RANCHER_URL", p.Server)
+	add("auth-type", "RANCHER_AUTH_TYPE", p.AuthType)
+	add("auth-provider-name", "RANCHER_AUTH_PROVIDER_NAME", p.AuthProviderName)
+	add("user", "RANCHER_USERNAME", p.User)
+	add("credential-command", "RANCHER_CREDENTIAL_COMMAND", p.CredentialCommand)
+	add("credentials-from", "RANCHER_CREDENTIALS_FROM", p.CredentialsFrom)
+	add("issuer", "RANCHER_OIDC_ISSUER", p.Issuer)
+	add("oidc-client-id", "RANCHER_OIDC_CLIENT_ID", p.OIDCClientID)
+	addBool("insecure-skip-tls-verify", "RANCHER_INSECURE_SKIP_TLS_VERIFY", p.InsecureSkipTLSVerify)
+	add("cluster", "", strings.Join(p.Clusters, ","))
+	addBool("include-local", "INCLUDE_LOCAL", p.IncludeLocal)
+	add("cluster-source", "CLUSTER_SOURCE", p.ClusterSource)
+	add("auto-create-only", "AUTO_CREATE_ONLY", strings.Join(p.AutoCreateOnly, ","))
+	add("config", "", p.Kubeconfig)
+	if p.ThresholdDays != nil {
+		add("threshold-days", "TOKEN_THRESHOLD_DAYS", strconv.Itoa(*p.ThresholdDays))
+	}
+	add("max-token-age", "MAX_TOKEN_AGE", p.MaxTokenAge)
+	return settings
+}
+
+func (p Profile) validate() error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if p.Server == "" {
+		return errors.New("server is required")
+	}
+	if p.CredentialCommand != "" && p.CredentialsFrom != "" {
+		return errors.New("credential-command and credentials-from both provide the password: use only one of them")
+	}
+	if p.ThresholdDays != nil && *p.ThresholdDays < 0 {
+		return errors.New("threshold-days must not be negative")
+	}
+	return nil
+}
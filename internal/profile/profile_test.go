@@ -0,0 +1,97 @@
+package profile
+
+import (
+	"rancher-kubeconfig-updater/internal/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(`
+profiles:
+  - name: prod
+    server: https://rancher.prod.example.com
+    auth-type: ldap
+    user: alice
+    credentials-from: op://infra/rancher-prod/password
+    clusters: [prod-eu, prod-us]
+  - name: lab
+    server: https://rancher.lab.example.com
+    insecure-skip-tls-verify: true
+    include-local: false
+`))
+	require.NoError(t, err)
+	require.Len(t, cfg.Profiles, 2)
+	assert.Equal(t, "ldap", cfg.Profiles[0].AuthType)
+	assert.Equal(t, []string{"prod-eu", "prod-us"}, cfg.Profiles[0].Clusters)
+	assert.Nil(t, cfg.Profiles[0].InsecureSkipTLSVerify)
+	assert.True(t, *cfg.Profiles[1].InsecureSkipTLSVerify)
+	assert.False(t, *cfg.Profiles[1].IncludeLocal)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{name: "empty", yaml: "", want: "no profiles defined"},
+		{name: "unknown key", yaml: "profiles:\n  - name: a\n    sever: https://a\n", want: "sever"},
+		{name: "no name", yaml: "profiles:\n  - server: https://a\n", want: "profile 1: name is required"},
+		{name: "no server", yaml: "profiles:\n  - name: a\n", want: "profile 1: server is required"},
+		{name: "duplicate", yaml: "profiles:\n  - {name: a, server: https://a}\n  - {name: a, server: https://b}\n", want: `profile 2: name "a" is used twice`},
+		{name: "negative threshold", yaml: "profiles:\n  - {name: a, server: https://a, threshold-days: -1}\n", want: "threshold-days must not be negative"},
+		{name: "two credential sources", yaml: "profiles:\n  - {name: a, server: https://a, credential-command: x, credentials-from: op://v/i/f}\n", want: "use only one of them"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+// TestSelect tests selecting one profile and the flag values it sets
+func TestSelect(t *testing.T) {
+	cfg, err := Parse([]byte(`
+default-profile: prod
+profiles:
+  - name: prod
+    server: https://rancher.example.com
+    clusters: [a, b]
+    include-local: false
+    threshold-days: 0
+  - name: dev
+    server: https://rancher.dev.example.com
+`))
+	require.NoError(t, err)
+	p, ok, err := cfg.Select("")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []config.Setting{
+		{Flag: "server", Env: "RANCHER_URL", Value: "https://rancher.example.com"},
+		{Flag: "cluster", Value: "a,b"},
+		{Flag: "include-local", Env: "INCLUDE_LOCAL", Value: "false"},
+		{Flag: "threshold-days", Env: "TOKEN_THRESHOLD_DAYS", Value: "0"},
+	}, p.Settings())
+	assert.Equal(t, []string{"threshold-days"}, p.RunSettings())
+
+	p, _, err = cfg.Select("dev")
+	require.NoError(t, err)
+	assert.Equal(t, "https://rancher.dev.example.com", p.Server)
+	_, _, err = cfg.Select("staging")
+	assert.EqualError(t, err, `profile "staging" is not defined, known profiles: prod, dev`)
+
+	_, err = Parse([]byte("default-profile: staging\nprofiles:\n  - {name: a, server: https://a}\n"))
+	assert.ErrorContains(t, err, `default-profile "staging" is not defined`)
+
+	// Without a default profile none is selected
+	cfg, err = Parse([]byte("profiles:\n  - {name: a, server: https://a, user: admin}\n"))
+	require.NoError(t, err)
+	_, ok, err = cfg.Select("")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -2,9 +2,9 @@ package rancher
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 )
 
 type AuthType string
@@ -12,45 +12,94 @@ type AuthType string
 const (
 	AuthTypeLDAP  AuthType = "ldap"
 	AuthTypeLocal AuthType = "local"
+	// AuthTypeGitHub logs in with GitHub in the browser, see NewLoginRequest
+	AuthTypeGitHub AuthType = "github"
+	// AuthTypeGoogleOAuth logs in with a Google (Workspace) account in the browser
+	AuthTypeGoogleOAuth AuthType = "googleoauth"
+	// AuthTypeSAML logs in with a SAML provider such as ADFS, Okta, Ping, Keycloak or Shibboleth in the browser
+	AuthTypeSAML AuthType = "saml"
+	// AuthTypeOIDC logs in with any OpenID Connect provider through Rancher's genericoidc provider, see ExchangeIDToken
+	AuthTypeOIDC AuthType = "oidc"
 )
 
+// UsesBrowser reports whether logging in happens in Rancher's web UI instead of with a password.
+func (t AuthType) UsesBrowser() bool {
+	return t == AuthTypeGitHub || t == AuthTypeGoogleOAuth || t == AuthTypeSAML
+}
+
+// TakesPassword reports whether logging in takes a username and password, as every auth
+// type does except browser and OIDC logins.
+func (t AuthType) TakesPassword() bool {
+	return !t.UsesBrowser() && t != AuthTypeOIDC
+}
+
+// Names Rancher gives the providers it creates; admins can add more instances under other names
 const (
-	LDAPLoginURL  = "/v3-public/openLdapProviders/openldap?action=login"
-	LocalLoginURL = "/v3-public/localProviders/local?action=login"
+	DefaultLDAPProviderName  = "openldap"
+	DefaultLocalProviderName = "local"
+	DefaultOIDCProviderName  = "genericoidc"
 )
 
-// getRancherToken authenticates with Rancher and returns an API token
-// POST /v3-public/openLdapProviders/openldap?action=login or /v3-public/localProviders/local?action=login
-func getRancherToken(baseurl, username, password string, authType AuthType, httpClient HTTPClient) (string, error) {
-	type loginResponse struct {
-		Token string `json:"token"`
-	}
-
-	// Prepare login request body
-	body := map[string]string{
-		"username":     username,
-		"password":     password,
-		"responseType": "json",
-	}
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request body: %w", err)
+// WithAuthProviderName logs in through the provider instance with this name instead of
+// the default one of the auth type, e.g. "corp-ldap". An empty name keeps the default.
+func WithAuthProviderName(name string) ClientOption {
+	return func(c *Client) {
+		c.authProviderName = name
 	}
+}
 
-	// Select login URL based on auth type
-	var loginURL string
+// loginPath returns the login path of the named provider instance of authType.
+// An empty providerName selects Rancher's default instance.
+func loginPath(authType AuthType, providerName string) (string, error) {
+	var collection string
 	switch authType {
 	case AuthTypeLDAP:
-		loginURL = LDAPLoginURL
+		collection = "openLdapProviders"
+		if providerName == "" {
+			providerName = DefaultLDAPProviderName
+		}
 	case AuthTypeLocal:
-		loginURL = LocalLoginURL
+		collection = "localProviders"
+		if providerName == "" {
+			providerName = DefaultLocalProviderName
+		}
+	case AuthTypeOIDC:
+		collection = "genericOIDCProviders"
+		if providerName == "" {
+			providerName = DefaultOIDCProviderName
+		}
 	default:
+		if authType.UsesBrowser() {
+			return "", fmt.Errorf("%s logins happen in the browser and take no password", authType)
+		}
 		return "", fmt.Errorf("invalid auth type: %s", authType)
 	}
+	return fmt.Sprintf("/v3-public/%s/%s?action=login", collection, url.PathEscape(providerName)), nil
+}
 
-	url := fmt.Sprintf("%s%s", baseurl, loginURL)
+// getRancherToken authenticates with Rancher and returns an API token
+// POST /v3-public/openLdapProviders/<name>?action=login or /v3-public/localProviders/<name>?action=login
+// The request body holding the password is wiped once the request has been sent.
+func getRancherToken(baseurl, username string, password []byte, authType AuthType, providerName string, httpClient HTTPClient) (string, error) {
+	type loginResponse struct {
+		Token string `json:"token"`
+	}
+
+	if authType == AuthTypeOIDC {
+		return "", fmt.Errorf("%s logins exchange an ID token and take no password", authType)
+	}
+
+	// Prepare login request body
+	jsonBody := buildLoginBody(username, password)
+	defer clear(jsonBody)
+
+	// Select login URL based on auth type and provider instance
+	loginURL, err := loginPath(authType, providerName)
+	if err != nil {
+		return "", err
+	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequest("POST", baseurl+loginURL, bytes.NewReader(jsonBody))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -67,13 +116,38 @@ func getRancherToken(baseurl, username, password string, authType AuthType, http
 	}
 
 	var result loginResponse
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	if result.Token == "" {
-		return "", fmt.Errorf("token not found in response")
+	if err := decodeResponse(respBody, &result, "login", "token"); err != nil {
+		return "", fmt.Errorf("failed to parse login response: %w", err)
 	}
 
 	return result.Token, nil
 }
+
+// buildLoginBody builds the JSON login request body.
+// It is encoded by hand so the password is never copied into an immutable string.
+func buildLoginBody(username string, password []byte) []byte {
+	body := make([]byte, 0, 64+len(username)+2*len(password))
+	body = append(body, `{"username":`...)
+	body = appendJSONString(body, []byte(username))
+	body = append(body, `,"password":`...)
+	body = appendJSONString(body, password)
+	body = append(body, `,"responseType":"json"}`...)
+	return body
+}
+
+// appendJSONString appends s to dst as a quoted JSON string.
+func appendJSONString(dst, s []byte) []byte {
+	const hex = "0123456789abcdef"
+	dst = append(dst, '"')
+	for _, b := range s {
+		switch {
+		case b == '"' || b == '\\':
+			dst = append(dst, '\\', b)
+		case b < 0x20:
+			dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xf])
+		default:
+			dst = append(dst, b)
+		}
+	}
+	return append(dst, '"')
+}
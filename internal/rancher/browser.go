@@ -0,0 +1,128 @@
+package rancher
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// loginRequestCharacters are the characters of a login request ID, as used by the Rancher CLI
+const loginRequestCharacters = "abcdfghjklmnpqrstvwxz12456789"
+
+// LoginRequest is a pending login through Rancher's web UI. It serves providers whose login
+// only works in a browser, such as GitHub: the user logs in on URL, and Rancher hands the
+// resulting token to the waiting client, encrypted with a key only this process knows.
+type LoginRequest struct {
+	// URL is the page of Rancher's web UI the user logs in on
+	URL string
+
+	tokenURL   string
+	key        *rsa.PrivateKey
+	httpClient HTTPClient
+}
+
+// NewLoginRequest prepares a browser login on the Rancher server at baseurl.
+// Of the client options, only WithHTTPClient applies.
+func NewLoginRequest(baseurl string, insecureSkipVerify bool, opts ...ClientOption) (*LoginRequest, error) {
+	client := &Client{httpClient: &http.Client{Transport: createTransport(insecureSkipVerify)}}
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate login key: %w", err)
+	}
+	publicKey, err := json.Marshal(key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode login key: %w", err)
+	}
+
+	id := make([]byte, 32)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(loginRequestCharacters))))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate login request ID: %w", err)
+		}
+		id[i] = loginRequestCharacters[n.Int64()]
+	}
+
+	query := url.Values{
+		"requestId":    {string(id)},
+		"publicKey":    {base64.StdEncoding.EncodeToString(publicKey)},
+		"responseType": {"kubeconfig"},
+	}
+	return &LoginRequest{
+		URL:        fmt.Sprintf("%s/dashboard/auth/login?%s", baseurl, query.Encode()),
+		tokenURL:   fmt.Sprintf("%s/v3-public/authTokens/%s", baseurl, id),
+		key:        key,
+		httpClient: client.httpClient,
+	}, nil
+}
+
+// Wait polls Rancher every interval until the user has logged in, and returns the token.
+// It gives up when ctx ends. The token is removed from Rancher's public endpoint once read.
+// GET /v3-public/authTokens/<request-id>
+func (r *LoginRequest) Wait(ctx context.Context, interval time.Duration) (string, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		token, err := r.poll(ctx)
+		if err != nil || token != "" {
+			return token, err
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("browser login was not completed: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll returns the token, or an empty string while the user has not logged in yet
+func (r *LoginRequest) poll(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.tokenURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	body, respCode, err := doRequest(r.httpClient, req)
+	if err != nil {
+		// The server may be briefly unreachable while the user is logging in
+		return "", nil
+	}
+	if respCode == http.StatusNotFound {
+		return "", nil
+	}
+	if respCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get login token, status %d: %s", respCode, string(body))
+	}
+
+	var authToken struct {
+		Token string `json:"token"`
+	}
+	if err := decodeResponse(body, &authToken, "login token"); err != nil {
+		return "", fmt.Errorf("failed to parse login token: %w", err)
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(authToken.Token)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode login token: %w", err)
+	}
+	token, err := rsa.DecryptOAEP(sha256.New(), nil, r.key, encrypted, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt login token: %w", err)
+	}
+
+	// Rancher keeps the encrypted token until it is deleted; failing to delete it is harmless
+	if req, err := http.NewRequestWithContext(ctx, http.MethodDelete, r.tokenURL, nil); err == nil {
+		_, _, _ = doRequest(r.httpClient, req)
+	}
+	return string(token), nil
+}
@@ -0,0 +1,91 @@
+package rancher
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoginRequest_Wait tests picking up the token after the user logged in through the browser
+func TestLoginRequest_Wait(t *testing.T) {
+	var publicKey rsa.PublicKey
+	var polls, deletes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.URL.Path, "/v3-public/authTokens/"))
+		if r.Method == http.MethodDelete {
+			deletes.Add(1)
+			return
+		}
+		// The user logs in while the client is polling
+		if polls.Add(1) < 2 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &publicKey, []byte("kubeconfig-u-abc:secret"), nil)
+		assert.NoError(t, err)
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": base64.StdEncoding.EncodeToString(encrypted)})
+	}))
+	defer server.Close()
+
+	request, err := NewLoginRequest(server.URL, false, WithHTTPClient(server.Client()))
+	require.NoError(t, err)
+
+	// The web UI encrypts the token with the public key from the login URL
+	loginURL, err := url.Parse(request.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "/dashboard/auth/login", loginURL.Path)
+	assert.Equal(t, "kubeconfig", loginURL.Query().Get("responseType"))
+	assert.Len(t, loginURL.Query().Get("requestId"), 32)
+	keyJSON, err := base64.StdEncoding.DecodeString(loginURL.Query().Get("publicKey"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(keyJSON, &publicKey))
+
+	token, err := request.Wait(context.Background(), time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, "kubeconfig-u-abc:secret", token)
+	assert.Equal(t, int32(1), deletes.Load(), "the encrypted token is removed from Rancher")
+}
+
+// TestLoginRequest_WaitTimeout tests giving up when the user never logs in
+func TestLoginRequest_WaitTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	request, err := NewLoginRequest(server.URL, false, WithHTTPClient(server.Client()))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = request.Wait(ctx, time.Millisecond)
+	assert.ErrorContains(t, err, "browser login was not completed")
+}
+
+// TestGetRancherToken_BrowserAuthType tests that browser logins are not sent a password
+func TestGetRancherToken_BrowserAuthType(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			t.Fatal("Should not send HTTP request")
+			return nil, nil
+		},
+	}
+
+	for _, authType := range []AuthType{AuthTypeGitHub, AuthTypeGoogleOAuth, AuthTypeSAML} {
+		_, err := getRancherToken("https://rancher.example.com", "user", []byte("pass"), authType, "", mockClient)
+		assert.ErrorContains(t, err, "logins happen in the browser")
+	}
+}
@@ -2,11 +2,16 @@
 package rancher
 
 import (
+	"context"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 	"k8s.io/client-go/tools/clientcmd"
@@ -30,11 +35,85 @@ type Client struct {
 	httpClient HTTPClient
 	BaseURL    string
 	logger     *zap.Logger
+
+	// authProviderName selects a provider instance with a non-default name for logging in
+	authProviderName string
+
+	// clock is the time tokens are judged at (nil for the current time)
+	clock Clock
+
+	// ctx is the context requests are sent with (nil for context.Background), see WithContext
+	ctx context.Context
+
+	// clientState is shared with the copies WithContext makes
+	*clientState
+}
+
+// clientState holds what a client learns about Rancher while it is used
+type clientState struct {
+	// tokenInfos caches token lookups by token name, so entries sharing
+	// one token only cost a single API call per run
+	tokenInfosMu sync.Mutex
+	tokenInfos   map[string]*TokenInfo
+
+	// userID caches CurrentUserID for ownership checks
+	userIDMu sync.Mutex
+	userID   string
+
+	// serverVersion caches the Rancher version reported with unexpected responses, "" if
+	// looking it up failed
+	serverVersionMu       sync.Mutex
+	serverVersion         string
+	serverVersionLookedUp bool
+
+	// tokenUpdatesUnsupported is set once Rancher refused to change a token
+	tokenUpdatesUnsupported atomic.Bool
+	// tokenRenewalUnsupported is set once Rancher kept the expiry of a token whose TTL was extended
+	tokenRenewalUnsupported atomic.Bool
 }
 
 type Cluster struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Actions are the actions Rancher allows the user on the cluster, by name
+	Actions map[string]string `json:"actions,omitempty"`
+	// Description, Version, Provider, Driver and NodeCount describe the cluster for reports
+	Description string         `json:"description,omitempty"`
+	Version     ClusterVersion `json:"version,omitzero"`
+	Provider    string         `json:"provider,omitempty"`
+	Driver      string         `json:"driver,omitempty"`
+	NodeCount   int            `json:"nodeCount,omitempty"`
+}
+
+// ClusterVersion is the Kubernetes version a cluster runs
+type ClusterVersion struct {
+	GitVersion string `json:"gitVersion,omitempty"`
+}
+
+// KubernetesVersion returns the Kubernetes version the cluster runs, e.g. "v1.30.4+rke2r1",
+// or "" if Rancher doesn't know it yet
+func (c Cluster) KubernetesVersion() string {
+	return c.Version.GitVersion
+}
+
+// ProviderName returns the distribution or hosting provider of the cluster, e.g. "rke2" or
+// "eks". Rancher only reports the driver, e.g. "imported", when it can't tell the provider.
+func (c Cluster) ProviderName() string {
+	if c.Provider != "" {
+		return c.Provider
+	}
+	return c.Driver
+}
+
+// CanGenerateKubeconfig reports whether Rancher lets the user generate a kubeconfig for the
+// cluster. Responses without actions are assumed to allow it.
+func (c Cluster) CanGenerateKubeconfig() bool {
+	if c.Actions == nil {
+		return true
+	}
+	_, ok := c.Actions["generateKubeconfig"]
+	return ok
 }
 
 type Clusters []Cluster
@@ -49,13 +128,14 @@ func WithHTTPClient(client HTTPClient) ClientOption {
 	}
 }
 
-func NewClient(baseurl, username, password string, authType AuthType, logger *zap.Logger, insecureSkipVerify bool, opts ...ClientOption) (*Client, error) {
+func NewClient(baseurl, username string, password []byte, authType AuthType, logger *zap.Logger, insecureSkipVerify bool, opts ...ClientOption) (*Client, error) {
 	// Create HTTP client with TLS configuration
 	transport := createTransport(insecureSkipVerify)
 	client := &Client{
-		httpClient: &http.Client{Transport: transport},
-		BaseURL:    baseurl,
-		logger:     logger,
+		httpClient:  &http.Client{Transport: transport},
+		BaseURL:     baseurl,
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
 	// Log warning if TLS verification is disabled
@@ -74,7 +154,7 @@ func NewClient(baseurl, username, password string, authType AuthType, logger *za
 	}
 
 	// Obtain authentication token
-	token, err := getRancherToken(baseurl, username, password, authType, client.httpClient)
+	token, err := getRancherToken(baseurl, username, password, authType, client.authProviderName, client.httpClient)
 	if err != nil {
 		return nil, err
 	}
@@ -85,45 +165,272 @@ func NewClient(baseurl, username, password string, authType AuthType, logger *za
 	return client, nil
 }
 
-func (c *Client) ListClusters() (Clusters, error) {
-	var clusters Clusters
-	type getClustersResponse struct {
-		Data []Cluster `json:"data"`
+// NewClientWithToken creates a client that uses an existing Rancher API token instead of logging in.
+// The token is not validated; call VerifyToken to check it before use.
+func NewClientWithToken(baseurl, token string, logger *zap.Logger, insecureSkipVerify bool, opts ...ClientOption) *Client {
+	transport := createTransport(insecureSkipVerify)
+	client := &Client{
+		token:       token,
+		httpClient:  &http.Client{Transport: transport},
+		BaseURL:     baseurl,
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
-	url := fmt.Sprintf("%s/v3/clusters", c.BaseURL)
-	req, _ := http.NewRequest("GET", url, nil)
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client
+}
+
+// WithContext returns a copy of the client that sends its requests with ctx, so they are
+// canceled when ctx ends. The copy shares its caches with c. It returns nil on a nil *Client.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	if c == nil {
+		return nil
+	}
+	copied := *c
+	copied.ctx = ctx
+	return &copied
+}
+
+// context returns the context requests are sent with
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// ObserveRequests calls fn with the method, path (including the query) and response status
+// of every API request the client sends from now on. The status is 0 if no response arrived.
+func (c *Client) ObserveRequests(fn func(method, path string, status int)) {
+	c.TimeRequests(func(method, path string, status int, _ time.Duration) {
+		fn(method, path, status)
+	})
+}
+
+// TimeRequests is ObserveRequests that also reports how long each request took.
+func (c *Client) TimeRequests(fn func(method, path string, status int, elapsed time.Duration)) {
+	c.httpClient = &observedHTTPClient{next: c.httpClient, observe: fn}
+}
+
+// WithRequestTimer times every request of the client, including the login, with TimeRequests.
+// Options apply in order, so options given before it are timed and options after it are not.
+func WithRequestTimer(fn func(method, path string, status int, elapsed time.Duration)) ClientOption {
+	return func(c *Client) {
+		c.TimeRequests(fn)
+	}
+}
+
+// observedHTTPClient reports each request to observe after sending it
+type observedHTTPClient struct {
+	next    HTTPClient
+	observe func(method, path string, status int, elapsed time.Duration)
+}
+
+func (o *observedHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := o.next.Do(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	o.observe(req.Method, req.URL.RequestURI(), status, time.Since(start))
+	return resp, err
+}
+
+// Endpoint names the API operation of a request for metrics, e.g. "generate_kubeconfig".
+// Requests the client does not send are named "other".
+func Endpoint(method, path string) string {
+	path, query, _ := strings.Cut(path, "?")
+	// Rancher may be served below a path prefix
+	if i := strings.Index(path, "/v3"); i > 0 {
+		path = path[i:]
+	} else if i := strings.Index(path, steveClustersPath); i > 0 {
+		path = path[i:]
+	}
+	switch {
+	case path == steveClustersPath && method == http.MethodGet:
+		return "list_clusters"
+	case strings.HasPrefix(path, steveClustersPath+"/") && strings.Contains(query, "action=generateKubeconfig"):
+		return "generate_kubeconfig"
+	case strings.HasPrefix(path, "/v3-public/") && strings.Contains(query, "action=login"):
+		return "login"
+	case path == "/v3/clusters" && method == http.MethodGet:
+		return "list_clusters"
+	case strings.HasPrefix(path, "/v3/clusters/") && strings.Contains(query, "action=generateKubeconfig"):
+		return "generate_kubeconfig"
+	case path == "/v3/users":
+		return "current_user"
+	case path == "/v3/settings/server-version":
+		return "server_version"
+	case path == "/v3/tokens" && method == http.MethodPost:
+		return "create_token"
+	case strings.HasPrefix(path, "/v3/tokens/"):
+		switch method {
+		case http.MethodGet:
+			return "token_info"
+		case http.MethodPut:
+			return "update_token"
+		case http.MethodDelete:
+			return "revoke_token"
+		}
+	}
+	return "other"
+}
+
+// SessionToken returns the Rancher API token the client authenticates with.
+// It is used to cache the login session between runs.
+func (c *Client) SessionToken() string {
+	return c.token
+}
+
+// VerifyToken checks that the client's token is still accepted by Rancher.
+// GET /v3/users?me=true
+func (c *Client) VerifyToken() error {
+	url := fmt.Sprintf("%s/v3/users?me=true", c.BaseURL)
+	req, err := http.NewRequestWithContext(c.context(), "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
 	req.Header.Set("Authorization", "Bearer "+c.token)
 
 	body, respCode, err := doRequest(c.httpClient, req)
 	if err != nil {
-		return clusters, err
+		return err
 	}
+	if respCode != http.StatusOK {
+		return fmt.Errorf("token rejected with status %d: %s", respCode, string(body))
+	}
+	return nil
+}
+
+// cachedUserID returns CurrentUserID, querying Rancher only the first time
+func (c *Client) cachedUserID() (string, error) {
+	c.userIDMu.Lock()
+	defer c.userIDMu.Unlock()
+	if c.userID != "" {
+		return c.userID, nil
+	}
+	userID, err := c.CurrentUserID()
+	if err != nil {
+		return "", err
+	}
+	c.userID = userID
+	return userID, nil
+}
+
+// CurrentUserID returns the ID of the user the client is authenticated as.
+// GET /v3/users?me=true
+func (c *Client) CurrentUserID() (string, error) {
+	type getUsersResponse struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+
+	url := fmt.Sprintf("%s/v3/users?me=true", c.BaseURL)
+	req, err := http.NewRequestWithContext(c.context(), "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	body, respCode, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current user: %w", err)
+	}
+	if respCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get current user, status %d: %s", respCode, string(body))
+	}
+
+	var result getUsersResponse
+	if err := decodeResponse(body, &result, "users", "data.*.id"); err != nil {
+		return "", fmt.Errorf("failed to parse users response: %w", c.withServerVersion(err))
+	}
+	if len(result.Data) == 0 || result.Data[0].ID == "" {
+		return "", fmt.Errorf("current user not found in response")
+	}
+
+	return result.Data[0].ID, nil
+}
+
+// ServerVersion returns the version of Rancher, e.g. "v2.8.5".
+// GET /v3/settings/server-version
+func (c *Client) ServerVersion() (string, error) {
+	url := fmt.Sprintf("%s/v3/settings/server-version", c.BaseURL)
+	req, err := http.NewRequestWithContext(c.context(), "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
 
+	body, respCode, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get server version: %w", err)
+	}
 	if respCode != http.StatusOK {
-		return clusters, fmt.Errorf("failed to list clusters, status %d: %s", respCode, string(body))
+		return "", fmt.Errorf("failed to get server version, status %d: %s", respCode, string(body))
 	}
 
-	var result getClustersResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return clusters, fmt.Errorf("failed to parse response: %w", err)
+	var result struct {
+		Value string `json:"value"`
 	}
+	if err := decodeResponse(body, &result, "server version", "value"); err != nil {
+		return "", fmt.Errorf("failed to parse server version response: %w", err)
+	}
+	return result.Value, nil
+}
+
+// ListClusters returns the clusters the user can see.
+func (c *Client) ListClusters() (Clusters, error) {
+	var clusters Clusters
+	err := c.StreamClusters(func(v Cluster) error {
+		clusters = append(clusters, v)
+		return nil
+	})
+	return clusters, err
+}
 
-	clusters = append(clusters, result.Data...)
+// StreamClusters calls fn with each cluster the user can see as soon as it is decoded, so
+// the first clusters can be processed while the rest of a long list is still arriving, and the
+// response is never held in memory as a whole. An error of fn stops the listing and is returned.
+func (c *Client) StreamClusters(fn func(Cluster) error) error {
+	url := fmt.Sprintf("%s/v3/clusters", c.BaseURL)
+	req, _ := http.NewRequestWithContext(c.context(), "GET", url, nil)
+	req.Header.Set("Authorization", "Bearer "+c.token)
 
-	return clusters, nil
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		return fmt.Errorf("failed to list clusters, status %d: %s", resp.StatusCode, string(body))
+	}
+
+	err = streamList(resp.Body, "data", "clusters", []string{"id", "name"}, fn)
+	var schemaErr *SchemaError
+	if errors.As(err, &schemaErr) {
+		return fmt.Errorf("failed to parse clusters response: %w", c.withServerVersion(err))
+	}
+	return err
 }
 
 // GetClusterKubeconfig retrieves the full kubeconfig for a cluster from Rancher API.
 // The returned *api.Config includes the primary Rancher proxy context and any
 // Downstream Directly contexts if the cluster has them configured.
 func (c *Client) GetClusterKubeconfig(clusterID string) (*api.Config, error) {
-	type getClusterKubeconfigResponse struct {
-		Config string `json:"config"`
-	}
-
 	url := fmt.Sprintf("%s/v3/clusters/%s?action=generateKubeconfig", c.BaseURL, clusterID)
-	req, _ := http.NewRequest("POST", url, nil)
+	req, _ := http.NewRequestWithContext(c.context(), "POST", url, nil)
 	req.Header.Set("Authorization", "Bearer "+c.token)
 
 	body, respCode, err := doRequest(c.httpClient, req)
@@ -134,9 +441,16 @@ func (c *Client) GetClusterKubeconfig(clusterID string) (*api.Config, error) {
 		return nil, fmt.Errorf("failed to get kubeconfig, status %d: %s", respCode, string(body))
 	}
 
-	var result getClusterKubeconfigResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse kubeconfig response: %w", err)
+	return c.parseKubeconfigResponse(body)
+}
+
+// parseKubeconfigResponse parses the output of Rancher's generateKubeconfig action
+func (c *Client) parseKubeconfigResponse(body []byte) (*api.Config, error) {
+	var result struct {
+		Config string `json:"config"`
+	}
+	if err := decodeResponse(body, &result, "kubeconfig", "config"); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig response: %w", c.withServerVersion(err))
 	}
 
 	// Parse the kubeconfig YAML using client-go
@@ -0,0 +1,39 @@
+package rancher
+
+import "time"
+
+// Clock tells the time that rotation decisions are made at. Replacing it makes decisions
+// deterministic in tests, or previews them as of another date.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock of the current time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// FixedClock is a Clock that always returns the same time.
+type FixedClock time.Time
+
+// Now returns the fixed time.
+func (c FixedClock) Now() time.Time { return time.Time(c) }
+
+// WithClock makes the client decide about tokens as of the time of clock instead of the
+// current time. Requests to Rancher are not affected.
+func WithClock(clock Clock) ClientOption {
+	return func(c *Client) {
+		c.clock = clock
+	}
+}
+
+// Now returns the time the client decides about tokens at: the time of its clock, which is
+// the current time unless set with WithClock, or on a nil *Client.
+func (c *Client) Now() time.Time {
+	if c == nil || c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
@@ -0,0 +1,18 @@
+package rancher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestClient_Now(t *testing.T) {
+	client := NewClientWithToken("https://rancher.example.com", "token", zap.NewNop(), false)
+	assert.WithinDuration(t, time.Now(), client.Now(), time.Minute)
+
+	asOf := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	client = NewClientWithToken("https://rancher.example.com", "token", zap.NewNop(), false, WithClock(FixedClock(asOf)))
+	assert.Equal(t, asOf, client.Now())
+}
@@ -0,0 +1,86 @@
+package rancher
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxErrorBody bounds the part of an error response body an ErrorLog keeps
+const maxErrorBody = 8 << 10
+
+// APIError is a request Rancher answered with an error status
+type APIError struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+	// Body is the start of the response body, up to 8 KiB
+	Body string `json:"body"`
+}
+
+// ErrorLog keeps the most recent error responses of the clients it is attached to, for
+// troubleshooting. It is safe for concurrent use.
+type ErrorLog struct {
+	mu     sync.Mutex
+	limit  int
+	errors []APIError
+}
+
+// NewErrorLog returns a log keeping the last limit error responses.
+func NewErrorLog(limit int) *ErrorLog {
+	return &ErrorLog{limit: limit}
+}
+
+// Errors returns the kept error responses, oldest first.
+func (l *ErrorLog) Errors() []APIError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]APIError(nil), l.errors...)
+}
+
+func (l *ErrorLog) add(e APIError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, e)
+	if len(l.errors) > l.limit {
+		l.errors = l.errors[len(l.errors)-l.limit:]
+	}
+}
+
+// WithErrorLog records the error responses of every request of the client, including the
+// login, in log.
+func WithErrorLog(log *ErrorLog) ClientOption {
+	return func(c *Client) {
+		c.httpClient = &errorLoggingHTTPClient{next: c.httpClient, log: log}
+	}
+}
+
+// errorLoggingHTTPClient copies error responses into log; callers still read the whole body
+type errorLoggingHTTPClient struct {
+	next HTTPClient
+	log  *ErrorLog
+}
+
+func (e *errorLoggingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := e.next.Do(req)
+	if err != nil || resp.StatusCode < http.StatusBadRequest {
+		return resp, err
+	}
+	body, readErr := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if readErr != nil {
+		return nil, readErr
+	}
+	e.log.add(APIError{
+		Time:   time.Now(),
+		Method: req.Method,
+		Path:   req.URL.RequestURI(),
+		Status: resp.StatusCode,
+		Body:   string(body[:min(len(body), maxErrorBody)]),
+	})
+	return resp, nil
+}
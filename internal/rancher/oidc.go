@@ -0,0 +1,51 @@
+package rancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ExchangeIDToken logs in through Rancher's generic OIDC provider with an ID token the user
+// obtained from the provider's issuer, and returns the Rancher token. The ID token must be
+// issued to the client configured in the provider. Of the client options, WithHTTPClient
+// and WithAuthProviderName apply.
+// POST /v3-public/genericOIDCProviders/<name>?action=login
+func ExchangeIDToken(baseurl, idToken string, insecureSkipVerify bool, opts ...ClientOption) (string, error) {
+	client := &Client{httpClient: &http.Client{Transport: createTransport(insecureSkipVerify)}}
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	loginURL, err := loginPath(AuthTypeOIDC, client.authProviderName)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(map[string]string{"idToken": idToken, "responseType": "json"})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode login request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, baseurl+loginURL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	respBody, respCode, err := doRequest(client.httpClient, req)
+	if err != nil {
+		return "", err
+	}
+	if respCode != http.StatusCreated {
+		return "", fmt.Errorf("login failed with status %d: %s", respCode, string(respBody))
+	}
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := decodeResponse(respBody, &result, "login", "token"); err != nil {
+		return "", fmt.Errorf("failed to parse login response: %w", err)
+	}
+	return result.Token, nil
+}
@@ -0,0 +1,42 @@
+package rancher
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExchangeIDToken tests logging in through the generic OIDC provider with an ID token
+func TestExchangeIDToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v3-public/genericOIDCProviders/corp-sso", r.URL.Path)
+		assert.Equal(t, "login", r.URL.Query().Get("action"))
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "id-token", body["idToken"])
+		assert.Equal(t, "json", body["responseType"])
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "token-abc:secret"})
+	}))
+	defer server.Close()
+
+	token, err := ExchangeIDToken(server.URL, "id-token", false, WithHTTPClient(server.Client()), WithAuthProviderName("corp-sso"))
+	require.NoError(t, err)
+	assert.Equal(t, "token-abc:secret", token)
+}
+
+// TestExchangeIDToken_Rejected tests the error when Rancher does not accept the ID token
+func TestExchangeIDToken_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message":"invalid token"}`))
+	}))
+	defer server.Close()
+
+	_, err := ExchangeIDToken(server.URL, "id-token", false, WithHTTPClient(server.Client()))
+	assert.ErrorContains(t, err, "login failed with status 401")
+}
@@ -473,7 +473,7 @@ func TestMockRancherServer_LocalAuthentication(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"admin",
-		"password123",
+		[]byte("password123"),
 		AuthTypeLocal,
 		logger,
 		false,
@@ -504,7 +504,7 @@ func TestMockRancherServer_LDAPAuthentication(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"ldapuser",
-		"ldappass",
+		[]byte("ldappass"),
 		AuthTypeLDAP,
 		logger,
 		false,
@@ -560,7 +560,7 @@ func TestMockRancherServer_AuthenticationFailure(t *testing.T) {
 			_, err := NewClient(
 				mockServer.URL(),
 				tt.username,
-				tt.password,
+				[]byte(tt.password),
 				tt.authType,
 				logger,
 				false,
@@ -592,7 +592,7 @@ func TestMockRancherServer_ListClusters(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"admin",
-		"password",
+		[]byte("password"),
 		AuthTypeLocal,
 		logger,
 		false,
@@ -630,7 +630,7 @@ func TestMockRancherServer_GetClusterToken(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"admin",
-		"password",
+		[]byte("password"),
 		AuthTypeLocal,
 		logger,
 		false,
@@ -656,7 +656,7 @@ func TestMockRancherServer_GetClusterToken_NotFound(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"admin",
-		"password",
+		[]byte("password"),
 		AuthTypeLocal,
 		logger,
 		false,
@@ -684,7 +684,7 @@ func TestMockRancherServer_GetTokenExpiration(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"admin",
-		"password",
+		[]byte("password"),
 		AuthTypeLocal,
 		logger,
 		false,
@@ -711,7 +711,7 @@ func TestMockRancherServer_GetTokenExpiration_NeverExpires(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"admin",
-		"password",
+		[]byte("password"),
 		AuthTypeLocal,
 		logger,
 		false,
@@ -738,7 +738,7 @@ func TestMockRancherServer_GetTokenExpiration_NotFound(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"admin",
-		"password",
+		[]byte("password"),
 		AuthTypeLocal,
 		logger,
 		false,
@@ -772,7 +772,7 @@ func TestMockRancherServer_DetermineTokenRegeneration(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"admin",
-		"password",
+		[]byte("password"),
 		AuthTypeLocal,
 		logger,
 		false,
@@ -863,7 +863,7 @@ func TestMockRancherServer_FullWorkflow(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"admin",
-		"securepass",
+		[]byte("securepass"),
 		AuthTypeLocal,
 		logger,
 		false,
@@ -917,7 +917,7 @@ func TestMockRancherServer_ConcurrentAccess(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"admin",
-		"password",
+		[]byte("password"),
 		AuthTypeLocal,
 		logger,
 		false,
@@ -973,7 +973,7 @@ func TestMockRancherServer_DownstreamDirectly(t *testing.T) {
 	client, err := NewClient(
 		mockServer.URL(),
 		"admin",
-		"password",
+		[]byte("password"),
 		AuthTypeLocal,
 		logger,
 		false,
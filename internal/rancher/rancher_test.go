@@ -2,13 +2,17 @@ package rancher
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -26,8 +30,9 @@ func TestListClusters_Success(t *testing.T) {
 	// Prepare mock response
 	mockResponse := `{
 		"data": [
-			{"id": "c-m-12345", "name": "production"},
-			{"id": "c-m-67890", "name": "staging"}
+			{"id": "c-m-12345", "name": "production", "description": "Payments", "provider": "rke2", "driver": "rke2",
+			 "version": {"gitVersion": "v1.30.4+rke2r1", "major": "1", "minor": "30"}, "nodeCount": 5},
+			{"id": "c-m-67890", "name": "staging", "driver": "imported"}
 		]
 	}`
 
@@ -47,10 +52,11 @@ func TestListClusters_Success(t *testing.T) {
 	// Create test client
 	logger := zap.NewNop()
 	client := &Client{
-		token:      "test-token-123",
-		httpClient: mockClient,
-		BaseURL:    "https://rancher.example.com",
-		logger:     logger,
+		token:       "test-token-123",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
 	// Execute test
@@ -61,8 +67,14 @@ func TestListClusters_Success(t *testing.T) {
 	assert.Len(t, clusters, 2)
 	assert.Equal(t, "c-m-12345", clusters[0].ID)
 	assert.Equal(t, "production", clusters[0].Name)
+	assert.Equal(t, "Payments", clusters[0].Description)
+	assert.Equal(t, "v1.30.4+rke2r1", clusters[0].KubernetesVersion())
+	assert.Equal(t, "rke2", clusters[0].ProviderName())
+	assert.Equal(t, 5, clusters[0].NodeCount)
 	assert.Equal(t, "c-m-67890", clusters[1].ID)
 	assert.Equal(t, "staging", clusters[1].Name)
+	assert.Equal(t, "imported", clusters[1].ProviderName(), "the driver stands in for an unknown provider")
+	assert.Empty(t, clusters[1].KubernetesVersion())
 }
 
 // TestListClusters_APIError tests API error handling
@@ -78,10 +90,11 @@ func TestListClusters_APIError(t *testing.T) {
 
 	logger := zap.NewNop()
 	client := &Client{
-		token:      "invalid-token",
-		httpClient: mockClient,
-		BaseURL:    "https://rancher.example.com",
-		logger:     logger,
+		token:       "invalid-token",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
 	clusters, err := client.ListClusters()
@@ -113,7 +126,7 @@ func TestNewClient_WithHTTPTest(t *testing.T) {
 	client, err := NewClient(
 		server.URL,
 		"testuser",
-		"testpass",
+		[]byte("testpass"),
 		AuthTypeLocal,
 		logger,
 		false,                           // insecureSkipVerify
@@ -167,10 +180,11 @@ users:
 
 	logger := zap.NewNop()
 	client := &Client{
-		token:      "test-token",
-		httpClient: mockClient,
-		BaseURL:    "https://rancher.example.com",
-		logger:     logger,
+		token:       "test-token",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
 	token := client.GetClusterToken("c-m-12345")
@@ -235,10 +249,11 @@ users:
 
 	logger := zap.NewNop()
 	client := &Client{
-		token:      "test-token",
-		httpClient: mockClient,
-		BaseURL:    "https://rancher.example.com",
-		logger:     logger,
+		token:       "test-token",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
 	kubeconfig, err := client.GetClusterKubeconfig("c-m-demo")
@@ -285,10 +300,11 @@ func TestGetClusterKubeconfig_Error(t *testing.T) {
 
 	logger := zap.NewNop()
 	client := &Client{
-		token:      "test-token",
-		httpClient: mockClient,
-		BaseURL:    "https://rancher.example.com",
-		logger:     logger,
+		token:       "test-token",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
 	kubeconfig, err := client.GetClusterKubeconfig("non-existent")
@@ -313,8 +329,9 @@ func TestGetRancherToken_Local(t *testing.T) {
 	token, err := getRancherToken(
 		server.URL,
 		"localuser",
-		"localpass",
+		[]byte("localpass"),
 		AuthTypeLocal,
+		"",
 		server.Client(),
 	)
 
@@ -337,8 +354,9 @@ func TestGetRancherToken_LDAP(t *testing.T) {
 	token, err := getRancherToken(
 		server.URL,
 		"ldapuser",
-		"ldappass",
+		[]byte("ldappass"),
 		AuthTypeLDAP,
+		"",
 		server.Client(),
 	)
 
@@ -358,8 +376,9 @@ func TestGetRancherToken_InvalidAuthType(t *testing.T) {
 	token, err := getRancherToken(
 		"https://rancher.example.com",
 		"user",
-		"pass",
+		[]byte("pass"),
 		AuthType("invalid"),
+		"",
 		mockClient,
 	)
 
@@ -368,6 +387,52 @@ func TestGetRancherToken_InvalidAuthType(t *testing.T) {
 	assert.Empty(t, token)
 }
 
+// TestGetRancherToken_CustomProviderName tests logging in through a provider instance with a non-default name
+func TestGetRancherToken_CustomProviderName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v3-public/openLdapProviders/corp-ldap", r.URL.Path)
+		assert.Equal(t, "login", r.URL.Query().Get("action"))
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token": "corp-token"}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(
+		server.URL,
+		"ldapuser",
+		[]byte("ldappass"),
+		AuthTypeLDAP,
+		zap.NewNop(),
+		false,
+		WithHTTPClient(server.Client()),
+		WithAuthProviderName("corp-ldap"),
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "corp-token", client.token)
+}
+
+// TestLoginPath tests the login path of each auth type and provider name
+func TestLoginPath(t *testing.T) {
+	tests := []struct {
+		authType     AuthType
+		providerName string
+		want         string
+	}{
+		{authType: AuthTypeLocal, want: "/v3-public/localProviders/local?action=login"},
+		{authType: AuthTypeLDAP, want: "/v3-public/openLdapProviders/openldap?action=login"},
+		{authType: AuthTypeLDAP, providerName: "corp-ldap", want: "/v3-public/openLdapProviders/corp-ldap?action=login"},
+		{authType: AuthTypeLocal, providerName: "a/b", want: "/v3-public/localProviders/a%2Fb?action=login"},
+		{authType: AuthTypeOIDC, want: "/v3-public/genericOIDCProviders/genericoidc?action=login"},
+	}
+	for _, tt := range tests {
+		got, err := loginPath(tt.authType, tt.providerName)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
 // TestCreateTransport_InsecureSkipVerify tests transport TLS configuration
 func TestCreateTransport_InsecureSkipVerify(t *testing.T) {
 	tests := []struct {
@@ -412,7 +477,7 @@ func TestNewClient_InsecureSkipVerify(t *testing.T) {
 			client, err := NewClient(
 				server.URL,
 				"testuser",
-				"testpass",
+				[]byte("testpass"),
 				AuthTypeLocal,
 				logger,
 				tt.insecureSkipVerify,
@@ -425,3 +490,247 @@ func TestNewClient_InsecureSkipVerify(t *testing.T) {
 		})
 	}
 }
+
+// TestNewClientWithToken tests creating a client from an existing token without logging in
+func TestNewClientWithToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v3/users", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("me"))
+		if r.Header.Get("Authorization") != "Bearer session-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"data": [{"id": "u-abc"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithToken(server.URL, "session-token", zap.NewNop(), false, WithHTTPClient(server.Client()))
+	assert.Equal(t, "session-token", client.SessionToken())
+	assert.NoError(t, client.VerifyToken())
+
+	expired := NewClientWithToken(server.URL, "expired-token", zap.NewNop(), false, WithHTTPClient(server.Client()))
+	err := expired.VerifyToken()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "status 401")
+}
+
+// TestWithContext tests that a client's copy sends its requests with the context and shares the caches
+func TestWithContext(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"data": [{"id": "u-abc"}]}`))
+	}))
+	defer server.Close()
+	client := NewClientWithToken(server.URL, "session-token", zap.NewNop(), false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bound := client.WithContext(ctx)
+	userID, err := bound.cachedUserID()
+	require.NoError(t, err)
+	assert.Equal(t, "u-abc", userID)
+
+	// The user ID the copy looked up is known to the client
+	userID, err = client.cachedUserID()
+	require.NoError(t, err)
+	assert.Equal(t, "u-abc", userID)
+	assert.Equal(t, 1, requests)
+
+	cancel()
+	assert.ErrorIs(t, bound.VerifyToken(), context.Canceled)
+	assert.NoError(t, client.VerifyToken(), "the client itself is not canceled")
+}
+
+// TestBuildLoginBody tests that the hand-encoded login body is valid JSON with escaped values
+func TestBuildLoginBody(t *testing.T) {
+	password := []byte("p\"a\\s\ns")
+	body := buildLoginBody("user\"name", password)
+
+	var decoded map[string]string
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, "user\"name", decoded["username"])
+	assert.Equal(t, "p\"a\\s\ns", decoded["password"])
+	assert.Equal(t, "json", decoded["responseType"])
+}
+
+// TestObserveRequests tests that observed requests report method, path and status
+func TestObserveRequests(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(`{"data": [{"id": "u-1"}]}`)),
+			}, nil
+		},
+	}
+	client := &Client{
+		token:       "test-token",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      zap.NewNop(),
+		clientState: &clientState{},
+	}
+
+	var observed []string
+	client.ObserveRequests(func(method, path string, status int) {
+		observed = append(observed, fmt.Sprintf("%s %s %d", method, path, status))
+	})
+
+	assert.NoError(t, client.VerifyToken())
+	assert.Equal(t, []string{"GET /v3/users?me=true 200"}, observed)
+}
+
+// TestWithRequestTimer tests that timed requests, including the login, report their endpoint and duration
+func TestWithRequestTimer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v3-public/localProviders/local" {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "token-abc:secret"}`))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	var observed []string
+	client, err := NewClient(server.URL, "admin", []byte("password"), AuthTypeLocal, zap.NewNop(), false,
+		WithRequestTimer(func(method, path string, status int, elapsed time.Duration) {
+			assert.GreaterOrEqual(t, elapsed, time.Duration(0))
+			observed = append(observed, fmt.Sprintf("%s %d", Endpoint(method, path), status))
+		}))
+	require.NoError(t, err)
+
+	_, err = client.ListClusters()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"login 201", "list_clusters 403"}, observed)
+}
+
+// TestWithErrorLog tests that error responses are recorded while callers still read their body
+func TestWithErrorLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3-public/localProviders/local":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "token-abc:secret"}`))
+		case "/v3/settings/server-version":
+			_, _ = w.Write([]byte(`{"id": "server-version", "value": "v2.8.5"}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message": "clusters.management.cattle.io is forbidden"}`))
+		}
+	}))
+	defer server.Close()
+
+	log := NewErrorLog(1)
+	client, err := NewClient(server.URL, "admin", []byte("password"), AuthTypeLocal, zap.NewNop(), false, WithErrorLog(log))
+	require.NoError(t, err)
+
+	version, err := client.ServerVersion()
+	require.NoError(t, err)
+	assert.Equal(t, "v2.8.5", version)
+	assert.Empty(t, log.Errors())
+
+	_, err = client.ListClusters()
+	assert.ErrorContains(t, err, "is forbidden")
+	_, err = client.GetTokenInfo("token-abc:secret")
+	assert.Error(t, err)
+
+	// Only the last error is kept
+	errs := log.Errors()
+	require.Len(t, errs, 1)
+	assert.Equal(t, http.MethodGet, errs[0].Method)
+	assert.Equal(t, "/v3/tokens/token-abc", errs[0].Path)
+	assert.Equal(t, http.StatusForbidden, errs[0].Status)
+	assert.Contains(t, errs[0].Body, "is forbidden")
+}
+
+// TestEndpoint tests naming the API operation of requests
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodPost, "/v3-public/localProviders/local?action=login", "login"},
+		{http.MethodPost, "/v3-public/openLdapProviders/corp-ldap?action=login", "login"},
+		{http.MethodGet, "/v3/clusters", "list_clusters"},
+		{http.MethodPost, "/v3/clusters/c-m-1?action=generateKubeconfig", "generate_kubeconfig"},
+		{http.MethodGet, "/v3/users?me=true", "current_user"},
+		{http.MethodPost, "/v3/tokens", "create_token"},
+		{http.MethodGet, "/v3/tokens/kubeconfig-u-1", "token_info"},
+		{http.MethodPut, "/v3/tokens/kubeconfig-u-1", "update_token"},
+		{http.MethodDelete, "/v3/tokens/kubeconfig-u-1", "revoke_token"},
+		{http.MethodGet, "/rancher/v3/clusters", "list_clusters"},
+		{http.MethodGet, "/v3/settings/server-version", "server_version"},
+		{http.MethodGet, "/v1/management.cattle.io.clusters", "list_clusters"},
+		{http.MethodPost, "/rancher/v1/management.cattle.io.clusters/c-m-1?action=generateKubeconfig", "generate_kubeconfig"},
+		{http.MethodGet, "/v3/projects", "other"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Endpoint(tt.method, tt.path), "%s %s", tt.method, tt.path)
+	}
+}
+
+// TestLimitRate tests that rate-limited requests are spaced by the configured interval
+func TestLimitRate(t *testing.T) {
+	limiter := NewRateLimiter(4)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	limiter.now = func() time.Time { return now }
+
+	assert.Equal(t, time.Duration(0), limiter.reserve(), "the first request goes out right away")
+	assert.Equal(t, 250*time.Millisecond, limiter.reserve())
+	assert.Equal(t, 500*time.Millisecond, limiter.reserve())
+
+	// Idle time is not saved up for bursts
+	now = start.Add(10 * time.Second)
+	assert.Equal(t, time.Duration(0), limiter.reserve())
+	assert.Equal(t, 250*time.Millisecond, limiter.reserve())
+}
+
+// TestLimitRate_Disabled tests that a non-positive QPS leaves the client unlimited
+func TestLimitRate_Disabled(t *testing.T) {
+	mockClient := &MockHTTPClient{}
+	client := &Client{httpClient: mockClient, clientState: &clientState{}}
+	client.LimitRate(0)
+	assert.Same(t, mockClient, client.httpClient)
+
+	client.LimitRate(4)
+	limited, ok := client.httpClient.(*rateLimitedHTTPClient)
+	require.True(t, ok)
+	assert.Equal(t, 250*time.Millisecond, limited.limiter.interval)
+}
+
+// TestUseRateLimiter_Shared tests that clients sharing a limiter are limited together
+func TestUseRateLimiter_Shared(t *testing.T) {
+	limiter := NewRateLimiter(4)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	a := &Client{httpClient: &MockHTTPClient{}, clientState: &clientState{}}
+	b := &Client{httpClient: &MockHTTPClient{}, clientState: &clientState{}}
+	a.UseRateLimiter(limiter)
+	b.UseRateLimiter(limiter)
+
+	assert.Equal(t, time.Duration(0), a.httpClient.(*rateLimitedHTTPClient).limiter.reserve())
+	assert.Equal(t, 250*time.Millisecond, b.httpClient.(*rateLimitedHTTPClient).limiter.reserve(), "b waits for the slot a took")
+}
+
+// TestLimitRate_Canceled tests that a request waiting for its slot gives up when its context ends
+func TestLimitRate_Canceled(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			t.Fatal("request should not be sent")
+			return nil, nil
+		},
+	}
+	limiter := &rateLimitedHTTPClient{next: mockClient, limiter: NewRateLimiter(1)}
+	limiter.limiter.slot = time.Now().Add(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://rancher.example.com/v3/clusters", nil)
+	require.NoError(t, err)
+
+	_, err = limiter.Do(req)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,95 @@
+package rancher
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces API requests so that no more than a given number per second reach
+// Rancher. Clients sharing one limiter are limited together.
+type RateLimiter struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mu sync.Mutex
+	// slot is the earliest time the next request may be sent
+	slot time.Time
+}
+
+// NewRateLimiter returns a limiter of qps requests per second, or nil (no limit) for a qps
+// of zero or less.
+func NewRateLimiter(qps float64) *RateLimiter {
+	if qps <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		interval: time.Duration(float64(time.Second) / qps),
+		now:      time.Now,
+	}
+}
+
+// reserve claims the next free slot and returns how long to wait for it
+func (r *RateLimiter) reserve() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if r.slot.Before(now) {
+		r.slot = now
+	}
+	wait := r.slot.Sub(now)
+	r.slot = r.slot.Add(r.interval)
+	return wait
+}
+
+// LimitRate spaces the API requests the client sends from now on so that no more than
+// qps requests per second reach Rancher, e.g. to stay under an API gateway's quota.
+// Requests wait for their turn; a qps of zero or less disables the limit.
+func (c *Client) LimitRate(qps float64) {
+	c.UseRateLimiter(NewRateLimiter(qps))
+}
+
+// UseRateLimiter makes the API requests the client sends from now on wait for their turn
+// at limiter, which other clients may share. A nil limiter leaves the client unlimited.
+func (c *Client) UseRateLimiter(limiter *RateLimiter) {
+	if limiter == nil {
+		return
+	}
+	c.httpClient = &rateLimitedHTTPClient{next: c.httpClient, limiter: limiter}
+}
+
+// rateLimitedHTTPClient sends requests when the limiter gives them a slot
+type rateLimitedHTTPClient struct {
+	next    HTTPClient
+	limiter *RateLimiter
+}
+
+func (r *rateLimitedHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if wait := r.limiter.reserve(); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+	return r.next.Do(req)
+}
+
+// WithRateLimit limits the client to qps requests per second from the start, so the
+// login counts against the limit too (see LimitRate).
+func WithRateLimit(qps float64) ClientOption {
+	return func(c *Client) {
+		c.LimitRate(qps)
+	}
+}
+
+// WithRateLimiter limits the client with a limiter shared with other clients from the
+// start, so the requests of all of them count against one limit (see UseRateLimiter).
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(c *Client) {
+		c.UseRateLimiter(limiter)
+	}
+}
@@ -0,0 +1,345 @@
+package rancher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaError is a Rancher API response that doesn't have the shape this tool expects, e.g.
+// because a Rancher version renamed or retyped a field.
+type SchemaError struct {
+	// Response names the response, e.g. "clusters"
+	Response string
+	// Field is the JSON path of the offending field, e.g. "data[3].id", or "" for the whole body
+	Field string
+	// Problem says what is wrong with the field, e.g. "is missing"
+	Problem string
+	// ServerVersion is the version of Rancher that sent the response, if it is known
+	ServerVersion string
+}
+
+func (e *SchemaError) Error() string {
+	version := "Rancher " + e.ServerVersion
+	if e.ServerVersion == "" {
+		version = "Rancher (version unknown)"
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("unexpected %s response from %s: body %s", e.Response, version, e.Problem)
+	}
+	return fmt.Sprintf("unexpected %s response from %s: field %q %s", e.Response, version, e.Field, e.Problem)
+}
+
+// decodeResponse decodes the JSON body of the response named response into v, then checks
+// that every required field is present and not empty. A required field is a dotted JSON path,
+// where "*" stands for every element of an array, e.g. "data.*.id"; a null array has no
+// elements. A body that doesn't fit is reported as a *SchemaError naming the field. v must hold
+// its zero value.
+func decodeResponse(body []byte, v any, response string, required ...string) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return schemaErrorOf(err, response)
+	}
+	var raw any
+	decoded := false
+	for _, path := range required {
+		parts := strings.Split(path, ".")
+		if !lacks(reflect.ValueOf(v), parts) {
+			continue
+		}
+		// Only a body that seems to lack a field is decoded again, to tell which field and how
+		if !decoded {
+			if err := json.Unmarshal(body, &raw); err != nil {
+				return schemaErrorOf(err, response)
+			}
+			decoded = true
+		}
+		if field, problem := checkRequired(raw, parts, ""); problem != "" {
+			return &SchemaError{Response: response, Field: field, Problem: problem}
+		}
+	}
+	return nil
+}
+
+// lacks reports whether a field of path in the decoded value v may be missing or empty: it
+// holds its zero value, or its JSON name can't be followed in v's type. checkRequired tells
+// for sure.
+func lacks(v reflect.Value, path []string) bool {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		return v.IsZero()
+	}
+	switch {
+	case path[0] == "*" && v.Kind() == reflect.Slice && v.IsNil():
+		// A null array is fine, a missing one is not
+		return true
+	case path[0] == "*" && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array):
+		for i := range v.Len() {
+			if lacks(v.Index(i), path[1:]) {
+				return true
+			}
+		}
+		return false
+	case v.Kind() == reflect.Struct:
+		if field, ok := jsonField(v, path[0]); ok {
+			return lacks(field, path[1:])
+		}
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		item := v.MapIndex(reflect.ValueOf(path[0]).Convert(v.Type().Key()))
+		return !item.IsValid() || lacks(item, path[1:])
+	}
+	return true
+}
+
+// jsonField returns the field of the struct v that encoding/json decodes the key name into
+func jsonField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == name || tag == "" && strings.EqualFold(f.Name, name) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// streamList decodes the JSON object of the response named response from r and calls fn with
+// each element of its array under key, one at a time, as decodeResponse would decode it with
+// the required fields of an element. Other keys are skipped. Decoding stops at the first error,
+// which is a *SchemaError if the body doesn't fit, or the error of fn or of reading r.
+func streamList[T any](r io.Reader, key, response string, required []string, fn func(T) error) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{', response, ""); err != nil {
+		return err
+	}
+	found := false
+	for dec.More() {
+		name, err := dec.Token()
+		if err != nil {
+			return streamErrorOf(err, response)
+		}
+		if name != key {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return streamErrorOf(err, response)
+			}
+			continue
+		}
+		found = true
+		// A null list has no elements
+		if err := expectDelim(dec, '[', response, key); errors.Is(err, errNull) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for i := 0; dec.More(); i++ {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return streamErrorOf(err, response)
+			}
+			var v T
+			if err := decodeResponse(raw, &v, response, required...); err != nil {
+				return elementError(err, key, i)
+			}
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return streamErrorOf(err, response)
+		}
+	}
+	if !found {
+		return &SchemaError{Response: response, Field: key, Problem: "is missing"}
+	}
+	return nil
+}
+
+// errNull is returned by expectDelim for a JSON null
+var errNull = errors.New("null")
+
+// expectDelim reads the next token of dec, which must open the object or array delim, or be
+// null, which returns errNull. field is the path of the value, "" for the whole body.
+func expectDelim(dec *json.Decoder, delim json.Delim, response, field string) error {
+	token, err := dec.Token()
+	if err != nil {
+		return streamErrorOf(err, response)
+	}
+	if token == nil {
+		if field == "" {
+			return &SchemaError{Response: response, Problem: "is a JSON null, expected " + delimKind(delim)}
+		}
+		return errNull
+	}
+	if token != delim {
+		kind := jsonKind(token)
+		if d, ok := token.(json.Delim); ok {
+			kind = delimKind(d)
+		}
+		return &SchemaError{Response: response, Field: field, Problem: fmt.Sprintf("is a JSON %s, expected %s", kind, delimKind(delim))}
+	}
+	return nil
+}
+
+// delimKind names the JSON type a delimiter opens
+func delimKind(delim json.Delim) string {
+	if delim == '[' {
+		return "array"
+	}
+	return "object"
+}
+
+// streamErrorOf turns an error of a json.Decoder into a *SchemaError, unless reading the body
+// failed or it ended early
+func streamErrorOf(err error, response string) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("failed to read response: %w", io.ErrUnexpectedEOF)
+	}
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &typeErr) || errors.As(err, &syntaxErr) {
+		return schemaErrorOf(err, response)
+	}
+	return fmt.Errorf("failed to read response: %w", err)
+}
+
+// elementError places the field of a *SchemaError of element i of the array under key
+func elementError(err error, key string, i int) error {
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		return err
+	}
+	element := key + "[" + strconv.Itoa(i) + "]"
+	switch {
+	case schemaErr.Field == "":
+		schemaErr.Field = element
+	case strings.HasPrefix(schemaErr.Field, "["):
+		schemaErr.Field = element + schemaErr.Field
+	default:
+		schemaErr.Field = element + "." + schemaErr.Field
+	}
+	return err
+}
+
+// schemaErrorOf turns an error of encoding/json into a *SchemaError
+func schemaErrorOf(err error, response string) error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		return &SchemaError{Response: response, Field: fieldPath(typeErr.Field), Problem: fmt.Sprintf("is a JSON %s, expected %s", typeErr.Value, typeErr.Type)}
+	case errors.As(err, &syntaxErr):
+		return &SchemaError{Response: response, Problem: fmt.Sprintf("is not valid JSON at offset %d: %v", syntaxErr.Offset, err)}
+	default:
+		return &SchemaError{Response: response, Problem: err.Error()}
+	}
+}
+
+// fieldPath writes the array indexes of a path of encoding/json in brackets, e.g.
+// "data.0.nodeCount" as "data[0].nodeCount"
+func fieldPath(field string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(field, ".") {
+		switch _, err := strconv.Atoi(part); {
+		case err == nil:
+			b.WriteString("[" + part + "]")
+		case i > 0:
+			b.WriteString("." + part)
+		default:
+			b.WriteString(part)
+		}
+	}
+	return b.String()
+}
+
+// checkRequired returns the path and problem of the first field of path in v that is missing
+// or empty, or an empty problem if there is none
+func checkRequired(v any, path []string, at string) (field, problem string) {
+	if len(path) == 0 {
+		switch value := v.(type) {
+		case nil:
+			return at, "is null"
+		case string:
+			if value == "" {
+				return at, "is empty"
+			}
+		}
+		return "", ""
+	}
+	if path[0] == "*" {
+		items, ok := v.([]any)
+		if !ok && v != nil {
+			return at, fmt.Sprintf("is a JSON %s, expected array", jsonKind(v))
+		}
+		for i, item := range items {
+			if field, problem := checkRequired(item, path[1:], at+"["+strconv.Itoa(i)+"]"); problem != "" {
+				return field, problem
+			}
+		}
+		return "", ""
+	}
+	object, ok := v.(map[string]any)
+	if !ok {
+		return at, fmt.Sprintf("is a JSON %s, expected object", jsonKind(v))
+	}
+	next := path[0]
+	if at != "" {
+		next = at + "." + path[0]
+	}
+	value, ok := object[path[0]]
+	if !ok {
+		return next, "is missing"
+	}
+	return checkRequired(value, path[1:], next)
+}
+
+// jsonKind names the JSON type of a value decoded into an any, as encoding/json does
+func jsonKind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// withServerVersion adds the Rancher version to a *SchemaError in err, looking it up once per
+// client; a failed lookup is not repeated. Other errors are returned unchanged.
+func (c *Client) withServerVersion(err error) error {
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || schemaErr.ServerVersion != "" {
+		return err
+	}
+	c.serverVersionMu.Lock()
+	version, lookedUp := c.serverVersion, c.serverVersionLookedUp
+	c.serverVersionMu.Unlock()
+	if !lookedUp {
+		// Not locked while asking Rancher; concurrent errors may look the version up twice
+		version, _ = c.ServerVersion()
+		c.serverVersionMu.Lock()
+		c.serverVersion, c.serverVersionLookedUp = version, true
+		c.serverVersionMu.Unlock()
+	}
+	schemaErr.ServerVersion = version
+	return err
+}
@@ -0,0 +1,194 @@
+package rancher
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	type clusters struct {
+		Data []Cluster `json:"data"`
+	}
+	tests := []struct {
+		name    string
+		body    string
+		field   string
+		problem string
+	}{
+		{name: "valid", body: `{"data": [{"id": "c-1", "name": "prod"}]}`},
+		{name: "null list", body: `{"data": null}`},
+		{name: "wrong type", body: `{"data": [{"id": "c-1", "name": "prod", "nodeCount": "3"}]}`, field: "data[0].nodeCount", problem: "is a JSON string, expected int"},
+		{name: "missing field", body: `{"data": [{"id": "c-1", "name": "prod"}, {"id": "c-2"}]}`, field: "data[1].name", problem: "is missing"},
+		{name: "empty field", body: `{"data": [{"id": "", "name": "prod"}]}`, field: "data[0].id", problem: "is empty"},
+		{name: "missing list", body: `{"type": "collection"}`, field: "data", problem: "is missing"},
+		{name: "object instead of list", body: `{"data": {"id": "c-1"}}`, field: "data", problem: "is a JSON object, expected []rancher.Cluster"},
+		{name: "not JSON", body: `<html>Login</html>`, problem: "is not valid JSON at offset 1: invalid character '<' looking for beginning of value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result clusters
+			err := decodeResponse([]byte(tt.body), &result, "clusters", "data.*.id", "data.*.name")
+			if tt.problem == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var schemaErr *SchemaError
+			require.ErrorAs(t, err, &schemaErr)
+			assert.Equal(t, "clusters", schemaErr.Response)
+			assert.Equal(t, tt.field, schemaErr.Field)
+			assert.Equal(t, tt.problem, schemaErr.Problem)
+		})
+	}
+}
+
+func TestSchemaError_Error(t *testing.T) {
+	err := &SchemaError{Response: "clusters", Field: "data[1].name", Problem: "is missing", ServerVersion: "v2.9.1"}
+	assert.Equal(t, `unexpected clusters response from Rancher v2.9.1: field "data[1].name" is missing`, err.Error())
+
+	err = &SchemaError{Response: "login", Problem: "is not valid JSON at offset 1"}
+	assert.Equal(t, "unexpected login response from Rancher (version unknown): body is not valid JSON at offset 1", err.Error())
+}
+
+func TestListClusters_SchemaMismatch(t *testing.T) {
+	var versionRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/settings/server-version":
+			versionRequests++
+			_, _ = w.Write([]byte(`{"id": "server-version", "value": "v2.13.0"}`))
+		case "/v3/clusters":
+			_, _ = w.Write([]byte(`{"data": [{"id": "c-1", "name": "prod"}, {"id": "c-2", "displayName": "dev"}]}`))
+		}
+	}))
+	defer server.Close()
+	client := NewClientWithToken(server.URL, "test-token", zap.NewNop(), false)
+
+	_, err := client.ListClusters()
+	assert.EqualError(t, err, `failed to parse clusters response: unexpected clusters response from Rancher v2.13.0: field "data[1].name" is missing`)
+	var schemaErr *SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+	assert.Equal(t, "v2.13.0", schemaErr.ServerVersion)
+
+	// The version is looked up once per client
+	_, err = client.ListClusters()
+	assert.Error(t, err)
+	assert.Equal(t, 1, versionRequests)
+}
+
+func TestListClusters_SchemaMismatchVersionUnknown(t *testing.T) {
+	var versionRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/settings/server-version":
+			versionRequests++
+			w.WriteHeader(http.StatusForbidden)
+		case "/v3/clusters":
+			_, _ = w.Write([]byte(`{"data": [{"id": "", "name": "prod"}]}`))
+		}
+	}))
+	defer server.Close()
+	client := NewClientWithToken(server.URL, "test-token", zap.NewNop(), false)
+
+	_, err := client.ListClusters()
+	assert.EqualError(t, err, `failed to parse clusters response: unexpected clusters response from Rancher (version unknown): field "data[0].id" is empty`)
+
+	// A failed lookup is not repeated
+	_, err = client.ListClusters()
+	assert.Error(t, err)
+	assert.Equal(t, 1, versionRequests)
+}
+
+func TestLacks(t *testing.T) {
+	var nodes struct {
+		Data []struct {
+			ID    string `json:"id"`
+			Count int
+		} `json:"data"`
+		Labels map[string]string `json:"labels"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"data": [{"id": "n-1", "count": 2}], "labels": {"team": "ops"}}`), &nodes))
+	assert.False(t, lacks(reflect.ValueOf(&nodes), []string{"data", "*", "id"}))
+	assert.False(t, lacks(reflect.ValueOf(&nodes), []string{"data", "*", "count"}), "untagged fields match case-insensitively")
+	assert.False(t, lacks(reflect.ValueOf(&nodes), []string{"labels", "team"}))
+	assert.True(t, lacks(reflect.ValueOf(&nodes), []string{"labels", "owner"}))
+	assert.True(t, lacks(reflect.ValueOf(&nodes), []string{"data", "*", "name"}), "fields the type doesn't have are left to checkRequired")
+}
+
+func TestStreamList(t *testing.T) {
+	type item struct {
+		ID string `json:"id"`
+	}
+	tests := []struct {
+		name  string
+		body  string
+		ids   []string
+		error string
+	}{
+		{name: "other keys are skipped", body: `{"type": "collection", "links": {"self": "x"}, "data": [{"id": "a"}, {"id": "b"}], "pagination": {}}`, ids: []string{"a", "b"}},
+		{name: "null list", body: `{"data": null}`},
+		{name: "missing list", body: `{"type": "collection"}`, error: `unexpected clusters response from Rancher (version unknown): field "data" is missing`},
+		{name: "list of wrong type", body: `{"data": "none"}`, error: `unexpected clusters response from Rancher (version unknown): field "data" is a JSON string, expected array`},
+		{name: "body of wrong type", body: `[]`, error: `unexpected clusters response from Rancher (version unknown): body is a JSON array, expected object`},
+		{name: "invalid element", body: `{"data": [{"id": "a"}, {"id": ""}, {"id": "c"}]}`, ids: []string{"a"}, error: `unexpected clusters response from Rancher (version unknown): field "data[1].id" is empty`},
+		{name: "element of wrong type", body: `{"data": [{"id": 1}]}`, error: `unexpected clusters response from Rancher (version unknown): field "data[0].id" is a JSON number, expected string`},
+		{name: "truncated", body: `{"data": [{"id": "a"}, {"id": "b`, ids: []string{"a"}, error: "failed to read response: unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []string
+			err := streamList(strings.NewReader(tt.body), "data", "clusters", []string{"id"}, func(v item) error {
+				ids = append(ids, v.ID)
+				return nil
+			})
+			assert.Equal(t, tt.ids, ids)
+			if tt.error == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.error)
+			}
+		})
+	}
+}
+
+func TestStreamClusters_BeforeListEnds(t *testing.T) {
+	first := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data": [{"id": "c-1", "name": "prod"},`))
+		w.(http.Flusher).Flush()
+		// The rest of the list is only sent once the first cluster was handed out
+		<-first
+		_, _ = w.Write([]byte(`{"id": "c-2", "name": "dev"}]}`))
+	}))
+	defer server.Close()
+	client := NewClientWithToken(server.URL, "test-token", zap.NewNop(), false)
+
+	var names []string
+	err := client.StreamClusters(func(v Cluster) error {
+		if len(names) == 0 {
+			close(first)
+		}
+		names = append(names, v.Name)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prod", "dev"}, names)
+
+	// An error of fn stops the listing
+	stop := errors.New("stop")
+	calls := 0
+	err = client.StreamClusters(func(Cluster) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
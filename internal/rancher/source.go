@@ -0,0 +1,149 @@
+package rancher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ClusterSource is where the clusters of a run and their kubeconfigs come from. The Client
+// itself is the source reading Rancher's v3 API.
+type ClusterSource interface {
+	ListClusters() (Clusters, error)
+	GetClusterKubeconfig(clusterID string) (*api.Config, error)
+}
+
+// ClusterStreamer is a ClusterSource that hands out the clusters while the list is still
+// arriving, for lists of hundreds of clusters.
+type ClusterStreamer interface {
+	ClusterSource
+	StreamClusters(fn func(Cluster) error) error
+}
+
+var (
+	_ ClusterStreamer = (*Client)(nil)
+	_ ClusterStreamer = (*SteveSource)(nil)
+)
+
+// steveClustersPath is the Steve (v1) collection of Rancher's management clusters
+const steveClustersPath = "/v1/management.cattle.io.clusters"
+
+// SteveSource reads the clusters through Rancher's Steve API (/v1), for servers or proxies
+// that only expose the API the Rancher dashboard uses.
+type SteveSource struct {
+	client *Client
+}
+
+// NewSteveSource returns a source reading the clusters through c's Steve API.
+func NewSteveSource(c *Client) *SteveSource {
+	return &SteveSource{client: c}
+}
+
+// steveCluster is the part of a Steve management cluster object the updater uses
+type steveCluster struct {
+	ID       string `json:"id"`
+	Metadata struct {
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		DisplayName string `json:"displayName"`
+		Description string `json:"description"`
+	} `json:"spec"`
+	Status struct {
+		Version   ClusterVersion `json:"version"`
+		Provider  string         `json:"provider"`
+		Driver    string         `json:"driver"`
+		NodeCount int            `json:"nodeCount"`
+	} `json:"status"`
+	Actions map[string]string `json:"actions,omitempty"`
+}
+
+// WithContext returns a copy of the source that sends its requests with ctx, like
+// Client.WithContext.
+func (s *SteveSource) WithContext(ctx context.Context) *SteveSource {
+	return &SteveSource{client: s.client.WithContext(ctx)}
+}
+
+// ListClusters lists the clusters, following Steve's pagination. A cluster is named by its
+// display name, as in the v3 API.
+func (s *SteveSource) ListClusters() (Clusters, error) {
+	var clusters Clusters
+	err := s.StreamClusters(func(v Cluster) error {
+		clusters = append(clusters, v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clusters, nil
+}
+
+// StreamClusters calls fn with the clusters of each page as soon as the page has arrived,
+// like ListClusters. An error of fn stops the listing and is returned.
+func (s *SteveSource) StreamClusters(fn func(Cluster) error) error {
+	next := s.client.BaseURL + steveClustersPath
+	for next != "" {
+		var page struct {
+			Data       []steveCluster `json:"data"`
+			Pagination struct {
+				Next string `json:"next"`
+			} `json:"pagination"`
+		}
+		req, _ := http.NewRequestWithContext(s.client.context(), "GET", next, nil)
+		req.Header.Set("Authorization", "Bearer "+s.client.token)
+
+		body, respCode, err := doRequest(s.client.httpClient, req)
+		if err != nil {
+			return err
+		}
+		if respCode != http.StatusOK {
+			return fmt.Errorf("failed to list clusters, status %d: %s", respCode, string(body))
+		}
+		if err := decodeResponse(body, &page, "clusters", "data.*.id"); err != nil {
+			return fmt.Errorf("failed to parse clusters response: %w", s.client.withServerVersion(err))
+		}
+
+		for _, c := range page.Data {
+			name := c.Spec.DisplayName
+			if name == "" {
+				name = c.ID
+			}
+			err := fn(Cluster{
+				ID:          c.ID,
+				Name:        name,
+				Labels:      c.Metadata.Labels,
+				Actions:     c.Actions,
+				Description: c.Spec.Description,
+				Version:     c.Status.Version,
+				Provider:    c.Status.Provider,
+				Driver:      c.Status.Driver,
+				NodeCount:   c.Status.NodeCount,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		next = page.Pagination.Next
+	}
+	return nil
+}
+
+// GetClusterKubeconfig generates a kubeconfig for the cluster with the Steve API's
+// generateKubeconfig action, which returns the same kubeconfig as the v3 API.
+func (s *SteveSource) GetClusterKubeconfig(clusterID string) (*api.Config, error) {
+	endpoint := fmt.Sprintf("%s%s/%s?action=generateKubeconfig", s.client.BaseURL, steveClustersPath, url.PathEscape(clusterID))
+	req, _ := http.NewRequestWithContext(s.client.context(), "POST", endpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+s.client.token)
+
+	body, respCode, err := doRequest(s.client.httpClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubeconfig: %w", err)
+	}
+	if respCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get kubeconfig, status %d: %s", respCode, string(body))
+	}
+	return s.client.parseKubeconfigResponse(body)
+}
@@ -0,0 +1,67 @@
+package rancher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSteveSource_ListClusters(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/management.cattle.io.clusters", r.URL.Path)
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		if r.URL.Query().Get("continue") == "" {
+			_, _ = w.Write([]byte(`{"data": [
+				{"id": "local", "metadata": {"name": "local"}, "spec": {"displayName": "local"}},
+				{"id": "c-m-1", "metadata": {"name": "c-m-1", "labels": {"env": "prod"}}, "spec": {"displayName": "prod", "description": "Payments"},
+				 "status": {"provider": "eks", "driver": "EKS", "version": {"gitVersion": "v1.29.8-eks-a737599"}, "nodeCount": 3}}
+			], "pagination": {"next": "` + server.URL + `/v1/management.cattle.io.clusters?continue=abc"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": [{"id": "c-m-2", "metadata": {"name": "c-m-2"}, "spec": {}}]}`))
+	}))
+	defer server.Close()
+
+	source := NewSteveSource(NewClientWithToken(server.URL, "test-token", zap.NewNop(), false))
+	clusters, err := source.ListClusters()
+
+	require.NoError(t, err)
+	assert.Equal(t, Clusters{
+		{ID: "local", Name: "local"},
+		{ID: "c-m-1", Name: "prod", Labels: map[string]string{"env": "prod"}, Description: "Payments",
+			Version: ClusterVersion{GitVersion: "v1.29.8-eks-a737599"}, Provider: "eks", Driver: "EKS", NodeCount: 3},
+		{ID: "c-m-2", Name: "c-m-2"},
+	}, clusters, "every page is read and clusters without a display name are named by their ID")
+}
+
+func TestSteveSource_GetClusterKubeconfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/management.cattle.io.clusters/c-m-1", r.URL.Path)
+		assert.Equal(t, "generateKubeconfig", r.URL.Query().Get("action"))
+		_, _ = w.Write([]byte(`{"type": "generateKubeconfigOutput", "config": "apiVersion: v1\nkind: Config\ncurrent-context: prod\ncontexts:\n- name: prod\n  context:\n    cluster: prod\n    user: prod\nusers:\n- name: prod\n  user:\n    token: kubeconfig-u-1:secret\n"}`))
+	}))
+	defer server.Close()
+
+	source := NewSteveSource(NewClientWithToken(server.URL, "test-token", zap.NewNop(), false))
+	cfg, err := source.GetClusterKubeconfig("c-m-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "prod", cfg.CurrentContext)
+	assert.Equal(t, "kubeconfig-u-1:secret", cfg.AuthInfos["prod"].Token)
+}
+
+func TestSteveSource_ListClustersError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := NewSteveSource(NewClientWithToken(server.URL, "test-token", zap.NewNop(), false)).ListClusters()
+	assert.ErrorContains(t, err, "failed to list clusters, status 404")
+}
@@ -1,8 +1,11 @@
 package rancher
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"strings"
 	"time"
@@ -10,76 +13,462 @@ import (
 	"go.uber.org/zap"
 )
 
+// ErrTokenNotFound is returned when Rancher does not know a token
+var ErrTokenNotFound = errors.New("token not found in Rancher")
+
+// ErrForeignToken is returned for a token that belongs to another user or is scoped to another cluster
+var ErrForeignToken = errors.New("token belongs to another user or cluster")
+
+// ErrTokenUpdateUnsupported is returned when the Rancher server does not allow changing tokens
+var ErrTokenUpdateUnsupported = errors.New("rancher does not allow updating tokens")
+
+// ErrTokenRenewalUnsupported is returned when the Rancher server accepts a longer TTL for a
+// token but keeps its expiry
+var ErrTokenRenewalUnsupported = errors.New("rancher does not allow extending the TTL of tokens")
+
 // TokenInfo represents the token information returned by Rancher API
 type TokenInfo struct {
+	Name      string `json:"name"`
+	UserID    string `json:"userId"`
+	ClusterID string `json:"clusterId"`
 	ExpiresAt string `json:"expiresAt"`
 	TTL       int64  `json:"ttl"`
 	Expired   bool   `json:"expired"`
 	Created   string `json:"created"`
 	Enabled   bool   `json:"enabled"`
+	// LastUsedAt is when the token last authenticated a request; Rancher before v2.8 doesn't record it
+	LastUsedAt string `json:"lastUsedAt,omitempty"`
+	// Labels are the token's labels, including the ones Rancher sets itself
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// TokenScope tells which clusters a token is valid for.
+type TokenScope string
+
+const (
+	// TokenScopeCluster tokens are valid for a single downstream cluster
+	TokenScopeCluster TokenScope = "cluster"
+	// TokenScopeGlobal tokens are valid for every cluster the user can access, and for Rancher's API
+	TokenScopeGlobal TokenScope = "global"
+)
+
+// Scope returns the scope of the token.
+func (t *TokenInfo) Scope() TokenScope {
+	if t.ClusterID != "" {
+		return TokenScopeCluster
+	}
+	return TokenScopeGlobal
 }
 
 // GetTokenExpiration queries Rancher API for token expiration info
 // Returns the expiration time of the token, or zero time if token never expires
+// Successful lookups are cached per token name for the lifetime of the client.
 func (c *Client) GetTokenExpiration(token string) (time.Time, error) {
 	// 1. Parse token to extract token name
-	// Token format: <token-name>:<secret-key>
-	// Example: kubeconfig-u-abc123xyz:xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx
-	if token == "" {
-		return time.Time{}, fmt.Errorf("invalid token format: token cannot be empty")
+	tokenName, err := TokenName(token)
+	if err != nil {
+		return time.Time{}, err
 	}
-	
-	parts := strings.Split(token, ":")
-	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
-		return time.Time{}, fmt.Errorf("invalid token format: expected <token-name>:<secret-key>")
+
+	tokenInfo, err := c.cachedTokenInfo(tokenName)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// 4. Handle never-expiring tokens (TTL = 0)
+	// Rancher tokens with TTL = 0 never expire
+	if tokenInfo.TTL == 0 {
+		// Return zero time to indicate token never expires
+		return time.Time{}, nil
+	}
+
+	// 5. Parse expiration time
+	expiresAt, err := time.Parse(time.RFC3339, tokenInfo.ExpiresAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse expiration time: %w", err)
 	}
-	tokenName := parts[0]
 
+	return expiresAt, nil
+}
+
+// GetTokenCreated returns when a token was created.
+// Lookups share the cache of GetTokenExpiration.
+func (c *Client) GetTokenCreated(token string) (time.Time, error) {
+	tokenName, err := TokenName(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tokenInfo, err := c.cachedTokenInfo(tokenName)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	created, err := time.Parse(time.RFC3339, tokenInfo.Created)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse creation time: %w", err)
+	}
+	return created, nil
+}
+
+// cachedTokenInfo returns the details of the named token, querying Rancher only the first time
+func (c *Client) cachedTokenInfo(tokenName string) (*TokenInfo, error) {
+	c.tokenInfosMu.Lock()
+	tokenInfo, cached := c.tokenInfos[tokenName]
+	c.tokenInfosMu.Unlock()
+	if cached {
+		return tokenInfo, nil
+	}
+
+	tokenInfo, err := c.fetchTokenInfo(tokenName)
+	if err != nil {
+		return nil, err
+	}
+
+	c.tokenInfosMu.Lock()
+	if c.tokenInfos == nil {
+		c.tokenInfos = make(map[string]*TokenInfo)
+	}
+	c.tokenInfos[tokenName] = tokenInfo
+	c.tokenInfosMu.Unlock()
+
+	return tokenInfo, nil
+}
+
+// GetTokenInfo queries Rancher API for the details of a token, including its owner.
+// Returns ErrTokenNotFound if Rancher does not know the token.
+func (c *Client) GetTokenInfo(token string) (*TokenInfo, error) {
+	tokenName, err := TokenName(token)
+	if err != nil {
+		return nil, err
+	}
+	return c.fetchTokenInfo(tokenName)
+}
+
+// fetchTokenInfo queries the named token from the Rancher API
+// GET /v3/tokens/<token-name>
+func (c *Client) fetchTokenInfo(tokenName string) (*TokenInfo, error) {
 	// 2. Query Rancher API
 	url := fmt.Sprintf("%s/v3/tokens/%s", c.BaseURL, tokenName)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(c.context(), "GET", url, nil)
 	if err != nil {
-		return time.Time{}, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+c.token)
 
 	body, respCode, err := doRequest(c.httpClient, req)
 	if err != nil {
-		return time.Time{}, fmt.Errorf("failed to query token info: %w", err)
+		return nil, fmt.Errorf("failed to query token info: %w", err)
 	}
 
+	if respCode == http.StatusNotFound {
+		return nil, fmt.Errorf("failed to get token info, status %d: %w: %s", respCode, ErrTokenNotFound, tokenName)
+	}
 	if respCode != http.StatusOK {
-		return time.Time{}, fmt.Errorf("failed to get token info, status %d: %s", respCode, string(body))
+		return nil, fmt.Errorf("failed to get token info, status %d: %s", respCode, string(body))
 	}
 
 	// 3. Parse response
 	var tokenInfo TokenInfo
-	if err := json.Unmarshal(body, &tokenInfo); err != nil {
-		return time.Time{}, fmt.Errorf("failed to parse token info: %w", err)
+	if err := decodeResponse(body, &tokenInfo, "token"); err != nil {
+		return nil, fmt.Errorf("failed to parse token info: %w", c.withServerVersion(err))
 	}
 
-	// 4. Handle never-expiring tokens (TTL = 0)
-	// Rancher tokens with TTL = 0 never expire
-	if tokenInfo.TTL == 0 {
-		// Return zero time to indicate token never expires
+	return &tokenInfo, nil
+}
+
+// GetTokenLastUsed returns when the named token last authenticated a request, always asking
+// Rancher rather than the cache. The time is zero when Rancher doesn't record it.
+func (c *Client) GetTokenLastUsed(tokenName string) (time.Time, error) {
+	tokenInfo, err := c.fetchTokenInfo(tokenName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if tokenInfo.LastUsedAt == "" {
 		return time.Time{}, nil
 	}
+	lastUsed, err := time.Parse(time.RFC3339, tokenInfo.LastUsedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse last use time: %w", err)
+	}
+	return lastUsed, nil
+}
 
-	// 5. Parse expiration time
-	expiresAt, err := time.Parse(time.RFC3339, tokenInfo.ExpiresAt)
+// GetTokenScope returns the scope of a token.
+// Lookups share the cache of GetTokenExpiration.
+func (c *Client) GetTokenScope(token string) (TokenScope, error) {
+	tokenName, err := TokenName(token)
+	if err != nil {
+		return "", err
+	}
+	tokenInfo, err := c.cachedTokenInfo(tokenName)
+	if err != nil {
+		return "", err
+	}
+	return tokenInfo.Scope(), nil
+}
+
+// CheckTokenOwner verifies that a token belongs to the authenticated user and, if it is
+// scoped to a cluster, to clusterID. It returns an error wrapping ErrForeignToken otherwise.
+// Lookups share the cache of GetTokenExpiration, so checking a token whose expiry was
+// already looked up costs no extra call.
+func (c *Client) CheckTokenOwner(token, clusterID string) error {
+	tokenName, err := TokenName(token)
+	if err != nil {
+		return err
+	}
+	tokenInfo, err := c.cachedTokenInfo(tokenName)
+	if err != nil {
+		return err
+	}
+	userID, err := c.cachedUserID()
+	if err != nil {
+		return err
+	}
+
+	if tokenInfo.UserID != "" && tokenInfo.UserID != userID {
+		return fmt.Errorf("%w: token %s belongs to user %s, not %s", ErrForeignToken, tokenName, tokenInfo.UserID, userID)
+	}
+	if tokenInfo.ClusterID != "" && tokenInfo.ClusterID != clusterID {
+		return fmt.Errorf("%w: token %s is scoped to cluster %s, not %s", ErrForeignToken, tokenName, tokenInfo.ClusterID, clusterID)
+	}
+	return nil
+}
+
+// TokenName extracts the token name from a Rancher token.
+// Token format: <token-name>:<secret-key>
+// Example: kubeconfig-u-abc123xyz:xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx
+func TokenName(token string) (string, error) {
+	if token == "" {
+		return "", fmt.Errorf("invalid token format: token cannot be empty")
+	}
+
+	parts := strings.Split(token, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid token format: expected <token-name>:<secret-key>")
+	}
+	return parts[0], nil
+}
+
+// CreateToken creates a new API token with the given TTL, description and labels, scoped to
+// clusterID, or global if clusterID is empty.
+// A TTL of zero creates a token that never expires (if the server allows it).
+// Returns the full token value in <token-name>:<secret-key> format.
+// POST /v3/tokens
+func (c *Client) CreateToken(clusterID string, ttl time.Duration, description string, labels map[string]string) (string, error) {
+	type createTokenResponse struct {
+		Token string `json:"token"`
+	}
+
+	body := map[string]interface{}{
+		"type":        "token",
+		"clusterId":   clusterID,
+		"ttl":         ttl.Milliseconds(),
+		"description": description,
+	}
+	if len(labels) > 0 {
+		body["labels"] = labels
+	}
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v3/tokens", c.BaseURL)
+	req, err := http.NewRequestWithContext(c.context(), "POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	respBody, respCode, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token: %w", err)
+	}
+	if respCode != http.StatusCreated && respCode != http.StatusOK {
+		return "", fmt.Errorf("failed to create token, status %d: %s", respCode, string(respBody))
+	}
+
+	var result createTokenResponse
+	if err := decodeResponse(respBody, &result, "token creation", "token"); err != nil {
+		return "", fmt.Errorf("failed to parse token creation response: %w", c.withServerVersion(err))
+	}
+
+	return result.Token, nil
+}
+
+// AnnotateToken sets the description of a token and adds labels to it, so Rancher admins can
+// tell where a token came from. A PUT replaces the token's labels, so the labels the token
+// already has, such as the ones Rancher sets itself, are read first and kept. Rancher versions
+// that don't allow changing tokens answer with ErrTokenUpdateUnsupported; the client then
+// skips further attempts.
+// GET, then PUT /v3/tokens/<token-name>
+func (c *Client) AnnotateToken(tokenName, description string, labels map[string]string) error {
+	if c.tokenUpdatesUnsupported.Load() {
+		return ErrTokenUpdateUnsupported
+	}
+
+	tokenInfo, err := c.fetchTokenInfo(tokenName)
+	if err != nil {
+		return fmt.Errorf("failed to read token labels: %w", err)
+	}
+	merged := make(map[string]string, len(tokenInfo.Labels)+len(labels))
+	maps.Copy(merged, tokenInfo.Labels)
+	maps.Copy(merged, labels)
+
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"description": description,
+		"labels":      merged,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v3/tokens/%s", c.BaseURL, tokenName)
+	req, err := http.NewRequestWithContext(c.context(), "PUT", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	body, respCode, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return fmt.Errorf("failed to annotate token: %w", err)
+	}
+
+	switch respCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusMethodNotAllowed:
+		c.tokenUpdatesUnsupported.Store(true)
+		return ErrTokenUpdateUnsupported
+	default:
+		return fmt.Errorf("failed to annotate token, status %d: %s", respCode, string(body))
+	}
+}
+
+// RenewToken extends the TTL of a token so that it expires its original lifetime from now,
+// keeping its name and secret. Rancher counts the TTL from the token's creation, so the new
+// TTL covers the token's age as well. Rancher versions that don't allow changing tokens answer
+// with ErrTokenUpdateUnsupported, versions that accept the request but keep the expiry with
+// ErrTokenRenewalUnsupported; the client then skips further attempts. Returns the new expiry.
+// PUT /v3/tokens/<token-name>
+func (c *Client) RenewToken(token string) (time.Time, error) {
+	if c.tokenUpdatesUnsupported.Load() {
+		return time.Time{}, ErrTokenUpdateUnsupported
+	}
+	if c.tokenRenewalUnsupported.Load() {
+		return time.Time{}, ErrTokenRenewalUnsupported
+	}
+	tokenName, err := TokenName(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	info, err := c.fetchTokenInfo(tokenName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if info.TTL == 0 {
+		return time.Time{}, fmt.Errorf("token %s never expires", tokenName)
+	}
+	created, err := time.Parse(time.RFC3339, info.Created)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse creation time: %w", err)
+	}
+	oldExpiresAt, err := time.Parse(time.RFC3339, info.ExpiresAt)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to parse expiration time: %w", err)
 	}
+	ttl := time.Since(created) + time.Duration(info.TTL)*time.Millisecond
 
+	jsonBody, err := json.Marshal(map[string]interface{}{"ttl": ttl.Milliseconds()})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	url := fmt.Sprintf("%s/v3/tokens/%s", c.BaseURL, tokenName)
+	req, err := http.NewRequestWithContext(c.context(), "PUT", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	body, respCode, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to renew token: %w", err)
+	}
+	switch respCode {
+	case http.StatusOK:
+	case http.StatusMethodNotAllowed:
+		c.tokenUpdatesUnsupported.Store(true)
+		return time.Time{}, ErrTokenUpdateUnsupported
+	default:
+		return time.Time{}, fmt.Errorf("failed to renew token, status %d: %s", respCode, string(body))
+	}
+
+	// Rancher ignores fields it doesn't allow changing, so the expiry is read back
+	renewed, err := c.fetchTokenInfo(tokenName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	c.tokenInfosMu.Lock()
+	if c.tokenInfos == nil {
+		c.tokenInfos = make(map[string]*TokenInfo)
+	}
+	c.tokenInfos[tokenName] = renewed
+	c.tokenInfosMu.Unlock()
+
+	expiresAt, err := time.Parse(time.RFC3339, renewed.ExpiresAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse expiration time: %w", err)
+	}
+	if !expiresAt.After(oldExpiresAt) {
+		c.tokenRenewalUnsupported.Store(true)
+		return time.Time{}, ErrTokenRenewalUnsupported
+	}
 	return expiresAt, nil
 }
 
+// RevokeToken deletes a token by name. Deleting a token that no longer exists is not an error.
+// DELETE /v3/tokens/<token-name>
+func (c *Client) RevokeToken(tokenName string) error {
+	url := fmt.Sprintf("%s/v3/tokens/%s", c.BaseURL, tokenName)
+	req, err := http.NewRequestWithContext(c.context(), "DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	body, respCode, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	switch respCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		c.tokenInfosMu.Lock()
+		delete(c.tokenInfos, tokenName)
+		c.tokenInfosMu.Unlock()
+		return nil
+	default:
+		return fmt.Errorf("failed to revoke token, status %d: %s", respCode, string(body))
+	}
+}
+
 // ShouldRefreshToken checks if token needs refresh based on expiration time and threshold
 // Returns true if token should be refreshed, false otherwise
 // Parameters:
 //   - expiresAt: Token expiration time (zero time means never expires)
 //   - thresholdDays: Refresh threshold in days before expiration
 func ShouldRefreshToken(expiresAt time.Time, thresholdDays int) bool {
+	return ShouldRefreshTokenAt(SystemClock, expiresAt, thresholdDays)
+}
+
+// ShouldRefreshTokenAt is ShouldRefreshToken as of the time of clock.
+func ShouldRefreshTokenAt(clock Clock, expiresAt time.Time, thresholdDays int) bool {
 	// Token never expires (zero time)
 	if expiresAt.IsZero() {
 		return false
@@ -89,8 +478,8 @@ func ShouldRefreshToken(expiresAt time.Time, thresholdDays int) bool {
 	threshold := time.Duration(thresholdDays) * 24 * time.Hour
 
 	// Check if token expires within the threshold period
-	// time.Until returns negative duration if time has passed
-	return time.Until(expiresAt) <= threshold
+	// The duration is negative if the token has already expired
+	return expiresAt.Sub(clock.Now()) <= threshold
 }
 
 // RegenerationReason represents the reason for token regeneration decision
@@ -111,6 +500,12 @@ const (
 	ReasonNeverExpiresButRefreshRequired RegenerationReason = "never_expires_but_refresh_required"
 	// ReasonExpirationCheckFailed indicates failed to check token expiration
 	ReasonExpirationCheckFailed RegenerationReason = "expiration_check_failed"
+	// ReasonPolicyAlways indicates a rotation policy replaces the token on every run
+	ReasonPolicyAlways RegenerationReason = "policy_always"
+	// ReasonTokenTooOld indicates token was created longer ago than the maximum token age
+	ReasonTokenTooOld RegenerationReason = "token_too_old"
+	// ReasonWrongTokenScope indicates token does not have the requested scope
+	ReasonWrongTokenScope RegenerationReason = "wrong_token_scope"
 )
 
 // TokenRegenerationDecision represents the decision and context for token regeneration
@@ -119,9 +514,12 @@ type TokenRegenerationDecision struct {
 	Reason           RegenerationReason
 	ExpiresAt        time.Time
 	DaysUntilExpiry  float64
+	// CreatedAt is only set when the token's age was checked
+	CreatedAt time.Time
 }
 
 // DetermineTokenRegeneration decides whether a token should be regenerated
+// as of the client's time (see WithClock)
 // Returns a decision with reason for logging purposes
 // Parameters:
 //   - client: Rancher client for API calls
@@ -159,8 +557,15 @@ func (c *Client) DetermineTokenRegeneration(currentToken string, forceRefresh bo
 		}
 	}
 
+	return DecideByExpiry(c, expiresAt, thresholdDays)
+}
+
+// DecideByExpiry decides whether a token expiring at expiresAt (zero if it never expires)
+// should be regenerated as of the time of clock: when it expires within thresholdDays.
+func DecideByExpiry(clock Clock, expiresAt time.Time, thresholdDays int) TokenRegenerationDecision {
 	// Check if token needs refresh based on expiration and threshold
-	shouldRefresh := ShouldRefreshToken(expiresAt, thresholdDays)
+	shouldRefresh := ShouldRefreshTokenAt(clock, expiresAt, thresholdDays)
+	daysUntilExpiry := expiresAt.Sub(clock.Now()).Hours() / 24
 
 	if !shouldRefresh {
 		// Token is still valid
@@ -175,7 +580,7 @@ func (c *Client) DetermineTokenRegeneration(currentToken string, forceRefresh bo
 			ShouldRegenerate: false,
 			Reason:           ReasonStillValid,
 			ExpiresAt:        expiresAt,
-			DaysUntilExpiry:  time.Until(expiresAt).Hours() / 24,
+			DaysUntilExpiry:  daysUntilExpiry,
 		}
 	}
 
@@ -194,6 +599,6 @@ func (c *Client) DetermineTokenRegeneration(currentToken string, forceRefresh bo
 		ShouldRegenerate: true,
 		Reason:           ReasonExpiresSoon,
 		ExpiresAt:        expiresAt,
-		DaysUntilExpiry:  time.Until(expiresAt).Hours() / 24,
+		DaysUntilExpiry:  daysUntilExpiry,
 	}
 }
@@ -2,6 +2,8 @@ package rancher
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"testing"
@@ -38,10 +40,11 @@ func TestGetTokenExpiration_Success(t *testing.T) {
 
 	logger := zap.NewNop()
 	client := &Client{
-		token:      "test-token",
-		httpClient: mockClient,
-		BaseURL:    "https://rancher.example.com",
-		logger:     logger,
+		token:       "test-token",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
 	// Test with valid token format
@@ -78,10 +81,11 @@ func TestGetTokenExpiration_NeverExpires(t *testing.T) {
 
 	logger := zap.NewNop()
 	client := &Client{
-		token:      "test-token",
-		httpClient: mockClient,
-		BaseURL:    "https://rancher.example.com",
-		logger:     logger,
+		token:       "test-token",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
 	token := "kubeconfig-u-abc123:secretkey123"
@@ -103,10 +107,11 @@ func TestGetTokenExpiration_InvalidTokenFormat(t *testing.T) {
 
 	logger := zap.NewNop()
 	client := &Client{
-		token:      "test-token",
-		httpClient: mockClient,
-		BaseURL:    "https://rancher.example.com",
-		logger:     logger,
+		token:       "test-token",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
 	tests := []struct {
@@ -167,10 +172,11 @@ func TestGetTokenExpiration_APIError(t *testing.T) {
 
 			logger := zap.NewNop()
 			client := &Client{
-				token:      "test-token",
-				httpClient: mockClient,
-				BaseURL:    "https://rancher.example.com",
-				logger:     logger,
+				token:       "test-token",
+				httpClient:  mockClient,
+				BaseURL:     "https://rancher.example.com",
+				logger:      logger,
+				clientState: &clientState{},
 			}
 
 			token := "kubeconfig-u-abc123:secretkey123"
@@ -195,10 +201,11 @@ func TestGetTokenExpiration_InvalidJSON(t *testing.T) {
 
 	logger := zap.NewNop()
 	client := &Client{
-		token:      "test-token",
-		httpClient: mockClient,
-		BaseURL:    "https://rancher.example.com",
-		logger:     logger,
+		token:       "test-token",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
 	token := "kubeconfig-u-abc123:secretkey123"
@@ -429,10 +436,11 @@ func TestDetermineTokenRegeneration(t *testing.T) {
 			}
 
 			client := &Client{
-				token:      "test-token",
-				httpClient: mockClient,
-				BaseURL:    "https://rancher.example.com",
-				logger:     logger,
+				token:       "test-token",
+				httpClient:  mockClient,
+				BaseURL:     "https://rancher.example.com",
+				logger:      logger,
+				clientState: &clientState{},
 			}
 
 			decision := client.DetermineTokenRegeneration(tt.currentToken, tt.forceRefresh, tt.thresholdDays, "test-cluster")
@@ -463,10 +471,11 @@ func TestDetermineTokenRegeneration_WithInvalidToken(t *testing.T) {
 	}
 
 	client := &Client{
-		token:      "test-token",
-		httpClient: mockClient,
-		BaseURL:    "https://rancher.example.com",
-		logger:     logger,
+		token:       "test-token",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      logger,
+		clientState: &clientState{},
 	}
 
 	// Test with invalid token format (should trigger expiration check failure)
@@ -475,3 +484,449 @@ func TestDetermineTokenRegeneration_WithInvalidToken(t *testing.T) {
 	assert.True(t, decision.ShouldRegenerate, "Invalid token should trigger regeneration")
 	assert.Equal(t, ReasonExpirationCheckFailed, decision.Reason)
 }
+
+// TestTokenName tests extracting the token name from a token value
+func TestTokenName(t *testing.T) {
+	name, err := TokenName("kubeconfig-u-abc123:secretkey123")
+	assert.NoError(t, err)
+	assert.Equal(t, "kubeconfig-u-abc123", name)
+
+	for _, token := range []string{"", "no-secret", ":secret", "name:", "a:b:c"} {
+		_, err := TokenName(token)
+		assert.Error(t, err, "token %q should be rejected", token)
+	}
+}
+
+// TestCreateToken_Success tests creating a cluster-scoped token with a TTL
+func TestCreateToken_Success(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "POST", req.Method)
+			assert.Equal(t, "/v3/tokens", req.URL.Path)
+			assert.Equal(t, "Bearer test-token", req.Header.Get("Authorization"))
+
+			var body map[string]interface{}
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+			assert.Equal(t, "c-m-12345", body["clusterId"])
+			assert.Equal(t, float64(3600000), body["ttl"])
+			assert.Equal(t, "ci run", body["description"])
+			assert.Equal(t, map[string]interface{}{"run-id": "abc"}, body["labels"])
+
+			return &http.Response{
+				StatusCode: http.StatusCreated,
+				Body:       io.NopCloser(bytes.NewBufferString(`{"name": "token-abcde", "token": "token-abcde:secret"}`)),
+			}, nil
+		},
+	}
+
+	client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+	token, err := client.CreateToken("c-m-12345", time.Hour, "ci run", map[string]string{"run-id": "abc"})
+	assert.NoError(t, err)
+	assert.Equal(t, "token-abcde:secret", token)
+}
+
+// TestCreateToken_APIError tests error handling when token creation is rejected
+func TestCreateToken_APIError(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusForbidden,
+				Body:       io.NopCloser(bytes.NewBufferString(`{"message": "forbidden"}`)),
+			}, nil
+		},
+	}
+
+	client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+	_, err := client.CreateToken("c-m-12345", time.Hour, "", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "status 403")
+}
+
+// TestRevokeToken tests token revocation responses
+func TestRevokeToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		expectErr  bool
+	}{
+		{name: "deleted", statusCode: http.StatusOK},
+		{name: "no content", statusCode: http.StatusNoContent},
+		{name: "already gone", statusCode: http.StatusNotFound},
+		{name: "forbidden", statusCode: http.StatusForbidden, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockHTTPClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "DELETE", req.Method)
+					assert.Equal(t, "/v3/tokens/token-abcde", req.URL.Path)
+					return &http.Response{
+						StatusCode: tt.statusCode,
+						Body:       io.NopCloser(bytes.NewBufferString(`{}`)),
+					}, nil
+				},
+			}
+
+			client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+			err := client.RevokeToken("token-abcde")
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestAnnotateToken tests setting the description and labels of a token
+func TestAnnotateToken(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "/v3/tokens/kubeconfig-u-abc", req.URL.Path)
+			if req.Method == http.MethodGet {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(
+					`{"name": "kubeconfig-u-abc", "labels": {"authn.management.cattle.io/token-userId": "u-abc", "run-id": "old"}}`))}, nil
+			}
+			assert.Equal(t, "PUT", req.Method)
+
+			var body map[string]interface{}
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+			assert.Equal(t, "made by the updater", body["description"])
+			assert.Equal(t, map[string]interface{}{
+				"authn.management.cattle.io/token-userId": "u-abc",
+				"run-id": "abc",
+			}, body["labels"], "labels already on the token are kept")
+
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(`{}`))}, nil
+		},
+	}
+	client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+	assert.NoError(t, client.AnnotateToken("kubeconfig-u-abc", "made by the updater", map[string]string{"run-id": "abc"}))
+}
+
+// TestAnnotateToken_Unsupported tests that a server refusing token updates is not asked again
+func TestAnnotateToken_Unsupported(t *testing.T) {
+	updates := 0
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodGet {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(`{"name": "kubeconfig-u-a"}`))}, nil
+			}
+			updates++
+			return &http.Response{StatusCode: http.StatusMethodNotAllowed, Body: io.NopCloser(bytes.NewBufferString(`{}`))}, nil
+		},
+	}
+	client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+	assert.ErrorIs(t, client.AnnotateToken("kubeconfig-u-a", "d", nil), ErrTokenUpdateUnsupported)
+	assert.ErrorIs(t, client.AnnotateToken("kubeconfig-u-b", "d", nil), ErrTokenUpdateUnsupported)
+	assert.Equal(t, 1, updates)
+}
+
+// TestAnnotateToken_APIError tests that other failures are reported and retried for the next token
+func TestAnnotateToken_APIError(t *testing.T) {
+	calls := 0
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			calls++
+			return &http.Response{StatusCode: http.StatusForbidden, Body: io.NopCloser(bytes.NewBufferString(`{"message": "forbidden"}`))}, nil
+		},
+	}
+	client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+	err := client.AnnotateToken("kubeconfig-u-a", "d", nil)
+	assert.ErrorContains(t, err, "status 403")
+	assert.NotErrorIs(t, err, ErrTokenUpdateUnsupported)
+	assert.Error(t, client.AnnotateToken("kubeconfig-u-b", "d", nil))
+	assert.Equal(t, 2, calls)
+}
+
+// TestGetTokenExpiration_CachedPerTokenName tests that a token shared by several entries is only looked up once
+func TestGetTokenExpiration_CachedPerTokenName(t *testing.T) {
+	calls := 0
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			calls++
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString(`{"expiresAt": "2030-01-01T00:00:00Z", "ttl": 1000}`)),
+			}, nil
+		},
+	}
+
+	client := &Client{
+		token:       "test-token",
+		httpClient:  mockClient,
+		BaseURL:     "https://rancher.example.com",
+		logger:      zap.NewNop(),
+		clientState: &clientState{},
+	}
+
+	for i := 0; i < 3; i++ {
+		expiration, err := client.GetTokenExpiration("kubeconfig-u-abc123:secretkey123")
+		assert.NoError(t, err)
+		assert.Equal(t, 2030, expiration.Year())
+	}
+	assert.Equal(t, 1, calls)
+
+	_, err := client.GetTokenExpiration("kubeconfig-u-def456:othersecret")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+// TestCheckTokenOwner tests verifying the owner and cluster of a token
+func TestCheckTokenOwner(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenJSON string
+		wantErr   string
+	}{
+		{name: "own unscoped token", tokenJSON: `{"name": "kubeconfig-u-abc", "userId": "u-me", "ttl": 0}`},
+		{name: "own token for the cluster", tokenJSON: `{"name": "kubeconfig-u-abc", "userId": "u-me", "clusterId": "c-m-prod", "ttl": 0}`},
+		{name: "other user", tokenJSON: `{"name": "kubeconfig-u-abc", "userId": "u-other", "ttl": 0}`, wantErr: "belongs to user u-other, not u-me"},
+		{name: "other cluster", tokenJSON: `{"name": "kubeconfig-u-abc", "userId": "u-me", "clusterId": "c-m-dev", "ttl": 0}`, wantErr: "scoped to cluster c-m-dev, not c-m-prod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userLookups := 0
+			mockClient := &MockHTTPClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					body := tt.tokenJSON
+					if req.URL.Path == "/v3/users" {
+						userLookups++
+						body = `{"data": [{"id": "u-me"}]}`
+					}
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+				},
+			}
+			client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+			err := client.CheckTokenOwner("kubeconfig-u-abc:secret", "c-m-prod")
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrForeignToken)
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+
+			_ = client.CheckTokenOwner("kubeconfig-u-abc:secret", "c-m-prod")
+			assert.Equal(t, 1, userLookups, "the current user is looked up once")
+		})
+	}
+}
+
+// TestCheckTokenOwner_SharesExpirationLookup tests that a token whose expiry was checked is not queried again
+func TestCheckTokenOwner_SharesExpirationLookup(t *testing.T) {
+	tokenLookups := 0
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			body := `{"data": [{"id": "u-me"}]}`
+			if req.URL.Path == "/v3/tokens/kubeconfig-u-abc" {
+				tokenLookups++
+				body = `{"userId": "u-me", "expiresAt": "2030-01-01T00:00:00Z", "ttl": 1000}`
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+		},
+	}
+	client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+	_, err := client.GetTokenExpiration("kubeconfig-u-abc:secret")
+	assert.NoError(t, err)
+	assert.NoError(t, client.CheckTokenOwner("kubeconfig-u-abc:secret", "c-m-prod"))
+	assert.Equal(t, 1, tokenLookups)
+}
+
+// TestCheckTokenOwner_LookupFailure tests that lookup failures are not reported as foreign tokens
+func TestCheckTokenOwner_LookupFailure(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(bytes.NewBufferString(`{}`))}, nil
+		},
+	}
+	client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+	err := client.CheckTokenOwner("kubeconfig-u-abc:secret", "c-m-prod")
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	assert.NotErrorIs(t, err, ErrForeignToken)
+}
+
+// TestGetTokenCreated tests reading the creation time of a token
+func TestGetTokenCreated(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "created", body: `{"created": "2024-01-01T00:00:00Z"}`, want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "missing", body: `{}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockHTTPClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(tt.body))}, nil
+				},
+			}
+			client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+			created, err := client.GetTokenCreated("kubeconfig-u-abc:secret")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tt.want.Equal(created))
+		})
+	}
+}
+
+func TestGetTokenLastUsed(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "used", body: `{"lastUsedAt": "2024-01-01T00:00:00Z"}`, want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "not recorded", body: `{}`},
+		{name: "invalid", body: `{"lastUsedAt": "yesterday"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockHTTPClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "/v3/tokens/kubeconfig-u-abc", req.URL.Path)
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(tt.body))}, nil
+				},
+			}
+			client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+			lastUsed, err := client.GetTokenLastUsed("kubeconfig-u-abc")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tt.want.Equal(lastUsed))
+		})
+	}
+}
+
+// renewServer returns a mock Rancher that extends the expiry of a token by its TTL change,
+// or keeps it when extend is false, and counts the requests
+func renewServer(t *testing.T, extend bool, calls *int) *MockHTTPClient {
+	created := time.Now().Add(-20 * 24 * time.Hour).UTC()
+	ttl := int64(30 * 24 * time.Hour / time.Millisecond)
+	return &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			*calls++
+			assert.Equal(t, "/v3/tokens/kubeconfig-u-abc", req.URL.Path)
+			if req.Method == "PUT" {
+				var body map[string]int64
+				assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+				if extend {
+					ttl = body["ttl"]
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(`{}`))}, nil
+			}
+			expiresAt := created.Add(time.Duration(ttl) * time.Millisecond).Format(time.RFC3339)
+			info := fmt.Sprintf(`{"created": %q, "expiresAt": %q, "ttl": %d}`, created.Format(time.RFC3339), expiresAt, ttl)
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(info))}, nil
+		},
+	}
+}
+
+// TestRenewToken tests that a renewed token expires its original lifetime from now
+func TestRenewToken(t *testing.T) {
+	calls := 0
+	client := &Client{token: "test-token", httpClient: renewServer(t, true, &calls), BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+	expiresAt, err := client.RenewToken("kubeconfig-u-abc:secret")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), expiresAt, time.Minute)
+	assert.Equal(t, 3, calls)
+
+	cached, err := client.GetTokenExpiration("kubeconfig-u-abc:secret")
+	assert.NoError(t, err)
+	assert.True(t, expiresAt.Equal(cached), "the renewed expiry is cached")
+	assert.Equal(t, 3, calls)
+}
+
+// TestRenewToken_ExpiryKept tests that a server ignoring the new TTL is not asked again
+func TestRenewToken_ExpiryKept(t *testing.T) {
+	calls := 0
+	client := &Client{token: "test-token", httpClient: renewServer(t, false, &calls), BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+	_, err := client.RenewToken("kubeconfig-u-abc:secret")
+	assert.ErrorIs(t, err, ErrTokenRenewalUnsupported)
+	_, err = client.RenewToken("kubeconfig-u-abc:secret")
+	assert.ErrorIs(t, err, ErrTokenRenewalUnsupported)
+	assert.Equal(t, 3, calls)
+}
+
+// TestRenewToken_Unsupported tests that a server refusing token updates is reported
+func TestRenewToken_Unsupported(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			if req.Method == "PUT" {
+				return &http.Response{StatusCode: http.StatusMethodNotAllowed, Body: io.NopCloser(bytes.NewBufferString(`{}`))}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(
+				`{"created": "2024-01-01T00:00:00Z", "expiresAt": "2024-01-31T00:00:00Z", "ttl": 2592000000}`))}, nil
+		},
+	}
+	client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(), clientState: &clientState{}}
+
+	_, err := client.RenewToken("kubeconfig-u-abc:secret")
+	assert.ErrorIs(t, err, ErrTokenUpdateUnsupported)
+}
+
+// TestDecideByExpiry tests decisions as of a fixed time
+func TestDecideByExpiry(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	clock := FixedClock(now)
+
+	decision := DecideByExpiry(clock, now.Add(45*24*time.Hour), 30)
+	assert.False(t, decision.ShouldRegenerate)
+	assert.Equal(t, ReasonStillValid, decision.Reason)
+	assert.InDelta(t, 45, decision.DaysUntilExpiry, 0.001)
+
+	decision = DecideByExpiry(clock, now.Add(10*24*time.Hour), 30)
+	assert.True(t, decision.ShouldRegenerate)
+	assert.Equal(t, ReasonExpiresSoon, decision.Reason)
+	assert.InDelta(t, 10, decision.DaysUntilExpiry, 0.001)
+
+	decision = DecideByExpiry(clock, time.Time{}, 30)
+	assert.False(t, decision.ShouldRegenerate)
+	assert.Equal(t, ReasonNeverExpires, decision.Reason)
+
+	// Thirty days later the first token is due as well
+	later := FixedClock(now.Add(30 * 24 * time.Hour))
+	assert.True(t, ShouldRefreshTokenAt(later, now.Add(45*24*time.Hour), 30))
+	assert.False(t, ShouldRefreshTokenAt(clock, now.Add(45*24*time.Hour), 30))
+}
+
+// TestDetermineTokenRegeneration_WithClock tests that the client decides as of its clock
+func TestDetermineTokenRegeneration_WithClock(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(`{"expiresAt": "2030-01-31T00:00:00Z", "ttl": 1000}`))}, nil
+		},
+	}
+	client := &Client{token: "test-token", httpClient: mockClient, BaseURL: "https://rancher.example.com", logger: zap.NewNop(),
+		clock: FixedClock(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)), clientState: &clientState{}}
+
+	decision := client.DetermineTokenRegeneration("kubeconfig-u-abc:secret", false, 30, "prod")
+	assert.True(t, decision.ShouldRegenerate)
+	assert.Equal(t, ReasonExpiresSoon, decision.Reason)
+	assert.InDelta(t, 30, decision.DaysUntilExpiry, 0.001)
+}
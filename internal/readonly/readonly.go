@@ -0,0 +1,34 @@
+// Package readonly implements --read-only. Every code path that creates, changes or removes a
+// file asks Check first, so once read-only mode is enabled no write can slip through, even
+// from a command that was not expected to write.
+package readonly
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrReadOnly is returned for writes attempted in read-only mode.
+var ErrReadOnly = errors.New("read-only mode")
+
+var enabled atomic.Bool
+
+// Set enables or disables read-only mode.
+func Set(on bool) {
+	enabled.Store(on)
+}
+
+// Enabled reports whether read-only mode is on.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Check returns an error wrapping ErrReadOnly if read-only mode is on. path names the file
+// that was about to be written.
+func Check(path string) error {
+	if enabled.Load() {
+		return fmt.Errorf("%w: refusing to write %s", ErrReadOnly, path)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package readonly
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	t.Cleanup(func() { Set(false) })
+
+	assert.False(t, Enabled())
+	assert.NoError(t, Check("/tmp/config"))
+
+	Set(true)
+	assert.True(t, Enabled())
+	err := Check("/tmp/config")
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.Contains(t, err.Error(), "/tmp/config")
+}
@@ -0,0 +1,86 @@
+// Package schedule decides when daemon mode runs the next update: every fixed interval or at
+// the times of one or more cron expressions.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule returns the time of the next update after a given time.
+type Schedule interface {
+	Next(after time.Time) time.Time
+	String() string
+}
+
+// interval runs an update every fixed duration
+type interval time.Duration
+
+// Every returns a schedule running an update every d.
+func Every(d time.Duration) Schedule {
+	return interval(d)
+}
+
+func (i interval) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(i))
+}
+
+func (i interval) String() string {
+	return "every " + time.Duration(i).String()
+}
+
+// crons runs an update at the earliest time any of its expressions matches
+type crons struct {
+	specs     []string
+	schedules []cron.Schedule
+	location  *time.Location
+}
+
+// Parse parses standard five-field cron expressions such as "0 6 * * 1-5", or descriptors
+// such as "@daily" or "@every 2h". The times of all expressions are combined, e.g. an
+// aggressive expression for business hours and a relaxed one for the rest of the week. The
+// expressions are evaluated in location; an expression may choose its own with a
+// CRON_TZ=Europe/Berlin prefix.
+func Parse(specs []string, location *time.Location) (Schedule, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("no cron expression given")
+	}
+	c := &crons{location: location}
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		s, err := ParseSpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+		}
+		c.specs = append(c.specs, spec)
+		c.schedules = append(c.schedules, s)
+	}
+	return c, nil
+}
+
+// ParseSpec parses a single cron expression in the dialect of Parse, for other cron settings
+// that must accept the same expressions, such as the maintenance windows of a policy. The
+// schedule uses the local time unless the expression has a CRON_TZ= prefix.
+func ParseSpec(spec string) (cron.Schedule, error) {
+	return cron.ParseStandard(spec)
+}
+
+func (c *crons) Next(after time.Time) time.Time {
+	after = after.In(c.location)
+	var next time.Time
+	for _, s := range c.schedules {
+		// A zero time means the expression never matches again, e.g. February 30th
+		if t := s.Next(after); !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	return next
+}
+
+func (c *crons) String() string {
+	return strings.Join(c.specs, "; ") + " (" + c.location.String() + ")"
+}
@@ -0,0 +1,49 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvery(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	s := Every(6 * time.Hour)
+	assert.Equal(t, now.Add(6*time.Hour), s.Next(now))
+	assert.Equal(t, "every 6h0m0s", s.String())
+}
+
+func TestParse(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	// Business hours every 15 minutes, otherwise once a day
+	s, err := Parse([]string{"*/15 9-17 * * 1-5", " 0 6 * * * "}, berlin)
+	require.NoError(t, err)
+	assert.Equal(t, "*/15 9-17 * * 1-5; 0 6 * * * (Europe/Berlin)", s.String())
+
+	// Monday 2026-03-02, 10:05 in Berlin
+	monday := time.Date(2026, 3, 2, 10, 5, 0, 0, berlin)
+	assert.Equal(t, time.Date(2026, 3, 2, 10, 15, 0, 0, berlin), s.Next(monday))
+	// After business hours the daily expression comes first
+	evening := time.Date(2026, 3, 2, 18, 0, 0, 0, berlin)
+	assert.Equal(t, time.Date(2026, 3, 3, 6, 0, 0, 0, berlin), s.Next(evening))
+	// The time zone applies whatever zone the current time is in
+	assert.True(t, s.Next(evening.UTC()).Equal(time.Date(2026, 3, 3, 6, 0, 0, 0, berlin)))
+}
+
+func TestParse_Descriptors(t *testing.T) {
+	s, err := Parse([]string{"@every 2h", "CRON_TZ=Asia/Taipei 0 9 * * *"}, time.UTC)
+	require.NoError(t, err)
+	now := time.Date(2026, 3, 2, 0, 30, 0, 0, time.UTC)
+	// 09:00 in Taipei is 01:00 UTC, before the next two-hour tick
+	assert.True(t, s.Next(now).Equal(time.Date(2026, 3, 2, 1, 0, 0, 0, time.UTC)))
+}
+
+func TestParse_Invalid(t *testing.T) {
+	_, err := Parse([]string{"0 6 * *"}, time.UTC)
+	assert.ErrorContains(t, err, `invalid cron expression "0 6 * *"`)
+	_, err = Parse(nil, time.UTC)
+	assert.Error(t, err)
+}
@@ -0,0 +1,43 @@
+//go:build windows
+
+package secretstore
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// protect encrypts data with DPAPI (CryptProtectData) for the current user
+func protect(data []byte) ([]byte, error) {
+	return dpapi(data, func(in, out *windows.DataBlob) error {
+		return windows.CryptProtectData(in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, out)
+	})
+}
+
+// unprotect decrypts data encrypted by protect
+func unprotect(data []byte) ([]byte, error) {
+	return dpapi(data, func(in, out *windows.DataBlob) error {
+		return windows.CryptUnprotectData(in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, out)
+	})
+}
+
+// dpapi runs a DPAPI call and copies its LocalAlloc'ed output into Go memory
+func dpapi(data []byte, call func(in, out *windows.DataBlob) error) ([]byte, error) {
+	if len(data) == 0 {
+		return []byte{}, nil
+	}
+
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	if err := call(&in, &out); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, _ = windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	}()
+
+	result := make([]byte, out.Size)
+	copy(result, unsafe.Slice(out.Data, out.Size))
+	return result, nil
+}
@@ -0,0 +1,110 @@
+// Package secretstore persists small secrets (Rancher session tokens, passwords) in the user profile.
+// On Windows secrets are encrypted with DPAPI so only the current user can decrypt them;
+// on other platforms they are stored in files readable only by the owner.
+package secretstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/appdir"
+	"rancher-kubeconfig-updater/internal/readonly"
+)
+
+// ErrNotFound is returned by Load when no secret is stored under the key.
+var ErrNotFound = errors.New("secret not found")
+
+// Store saves secrets as individual files in a directory.
+type Store struct {
+	dir string
+}
+
+// New creates a Store rooted at dir.
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// DefaultDir returns the default secret directory in the tool's directory (see appdir.Dir).
+func DefaultDir() (string, error) {
+	dir, err := appdir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "secrets"), nil
+}
+
+// ServerDir returns DefaultDir, or on a shared machine (see appdir.SetShared) a directory of
+// its own for the Rancher server at serverURL. The name is derived from a hash, so it does
+// not reveal the server.
+func ServerDir(serverURL string) (string, error) {
+	dir, err := DefaultDir()
+	if err != nil || !appdir.Shared() {
+		return dir, err
+	}
+	sum := sha256.Sum256([]byte(serverURL))
+	return filepath.Join(dir, "server-"+hex.EncodeToString(sum[:8])), nil
+}
+
+// Save encrypts (where supported) and stores secret under key, replacing any previous value.
+func (s *Store) Save(key string, secret []byte) error {
+	if err := readonly.Check(s.path(key)); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create secret directory: %w", err)
+	}
+
+	data, err := protect(secret)
+	if err != nil {
+		return fmt.Errorf("failed to protect secret: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated secret behind
+	path := s.path(key)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secret: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write secret: %w", err)
+	}
+	return nil
+}
+
+// Load returns the secret stored under key, or ErrNotFound.
+func (s *Store) Load(key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %w", err)
+	}
+
+	secret, err := unprotect(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unprotect secret: %w", err)
+	}
+	return secret, nil
+}
+
+// Delete removes the secret stored under key. Deleting a missing secret is not an error.
+func (s *Store) Delete(key string) error {
+	if err := readonly.Check(s.path(key)); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete secret: %w", err)
+	}
+	return nil
+}
+
+// path maps a key to a file name that does not reveal the key (which may contain URLs or usernames)
+func (s *Store) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".secret")
+}
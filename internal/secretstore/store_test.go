@@ -0,0 +1,96 @@
+package secretstore
+
+import (
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/appdir"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_SaveLoadDelete(t *testing.T) {
+	store := New(filepath.Join(t.TempDir(), "secrets"))
+
+	require.NoError(t, store.Save("session:https://rancher.example.com|admin", []byte("token-abc:secret")))
+
+	secret, err := store.Load("session:https://rancher.example.com|admin")
+	require.NoError(t, err)
+	assert.Equal(t, "token-abc:secret", string(secret))
+
+	require.NoError(t, store.Delete("session:https://rancher.example.com|admin"))
+	_, err = store.Load("session:https://rancher.example.com|admin")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Deleting again is not an error
+	assert.NoError(t, store.Delete("session:https://rancher.example.com|admin"))
+}
+
+func TestStore_Overwrite(t *testing.T) {
+	store := New(t.TempDir())
+
+	require.NoError(t, store.Save("key", []byte("first")))
+	require.NoError(t, store.Save("key", []byte("second")))
+
+	secret, err := store.Load("key")
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(secret))
+}
+
+func TestStore_FileNameDoesNotLeakKey(t *testing.T) {
+	dir := t.TempDir()
+	store := New(dir)
+	require.NoError(t, store.Save("password:https://rancher.example.com|admin", []byte("hunter2")))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.NotContains(t, entries[0].Name(), "rancher")
+	assert.NotContains(t, entries[0].Name(), "admin")
+	assert.True(t, strings.HasSuffix(entries[0].Name(), ".secret"))
+
+	if runtime.GOOS != "windows" {
+		info, err := entries[0].Info()
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestProtect_RoundTrip(t *testing.T) {
+	data := []byte("token-abc:secret")
+
+	protected, err := protect(data)
+	require.NoError(t, err)
+	if runtime.GOOS == "windows" {
+		assert.NotEqual(t, data, protected, "DPAPI output must not be plaintext")
+	}
+
+	plain, err := unprotect(protected)
+	require.NoError(t, err)
+	assert.Equal(t, data, plain)
+}
+
+func TestServerDir(t *testing.T) {
+	t.Cleanup(func() {
+		appdir.Set("")
+		appdir.SetShared(false)
+	})
+	appdir.Set(t.TempDir())
+
+	defaultDir, err := DefaultDir()
+	require.NoError(t, err)
+	dir, err := ServerDir("https://rancher.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, defaultDir, dir, "servers share the directory unless the machine is shared")
+
+	appdir.SetShared(true)
+	first, err := ServerDir("https://rancher.example.com")
+	require.NoError(t, err)
+	second, err := ServerDir("https://rancher.lab.example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.NotContains(t, first, "rancher.example.com")
+}
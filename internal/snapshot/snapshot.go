@@ -0,0 +1,265 @@
+// Package snapshot stores the kubeconfigs of all clusters in one archive for break-glass use.
+//
+// A snapshot is a tar.gz archive holding manifest.json and one standalone kubeconfig per
+// cluster under clusters/. With a passphrase the whole archive is encrypted with AES-256-GCM,
+// using a key derived from the passphrase with PBKDF2-SHA256.
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"time"
+)
+
+const (
+	// manifestName is the archive member describing the snapshot
+	manifestName = "manifest.json"
+	// clusterDir is the archive directory of the per-cluster kubeconfigs
+	clusterDir = "clusters"
+
+	// magic starts encrypted snapshots, followed by the salt, the nonce and the ciphertext
+	magic           = "RKU-SNAPSHOT-1\n"
+	saltSize        = 16
+	kdfIterations   = 600000
+	maxArchiveBytes = 256 << 20
+)
+
+// ErrPassphraseRequired is returned when an encrypted snapshot is read without a passphrase.
+var ErrPassphraseRequired = errors.New("snapshot is encrypted: a passphrase is required")
+
+// Manifest describes the snapshot.
+type Manifest struct {
+	// CreatedAt is when the snapshot was taken
+	CreatedAt time.Time `json:"createdAt"`
+	// Server is the Rancher server the kubeconfigs come from
+	Server string `json:"server"`
+	// Clusters are the clusters whose kubeconfig is in the snapshot
+	Clusters []Cluster `json:"clusters"`
+	// Failed are the clusters whose kubeconfig could not be fetched
+	Failed []Failure `json:"failed,omitempty"`
+}
+
+// Cluster is a cluster in the snapshot.
+type Cluster struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+	// File is the archive path of the cluster's kubeconfig
+	File string `json:"file"`
+	// Contexts are the kubeconfig's contexts, including direct (authorized endpoint) ones
+	Contexts []string `json:"contexts"`
+}
+
+// Failure is a cluster left out of the snapshot.
+type Failure struct {
+	Name  string `json:"name"`
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// Snapshot is the manifest and the kubeconfigs by archive path.
+type Snapshot struct {
+	Manifest Manifest
+	Files    map[string][]byte
+}
+
+// unsafeFileName matches characters that are replaced in cluster file names
+var unsafeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// New returns an empty snapshot of server taken at createdAt.
+func New(server string, createdAt time.Time) *Snapshot {
+	return &Snapshot{
+		Manifest: Manifest{CreatedAt: createdAt.UTC(), Server: server, Clusters: []Cluster{}},
+		Files:    map[string][]byte{},
+	}
+}
+
+// Add stores the kubeconfig of a cluster with the given contexts. Files are named after the
+// cluster; the cluster ID keeps names of clusters that only differ in special characters apart.
+func (s *Snapshot) Add(name, id string, contexts []string, kubeconfig []byte) {
+	file := path.Join(clusterDir, unsafeFileName.ReplaceAllString(name, "_")+".yaml")
+	if _, taken := s.Files[file]; taken {
+		file = path.Join(clusterDir, unsafeFileName.ReplaceAllString(name+"-"+id, "_")+".yaml")
+	}
+	s.Files[file] = kubeconfig
+	s.Manifest.Clusters = append(s.Manifest.Clusters, Cluster{Name: name, ID: id, File: file, Contexts: contexts})
+}
+
+// AddFailure records a cluster whose kubeconfig could not be fetched.
+func (s *Snapshot) AddFailure(name, id string, err error) {
+	s.Manifest.Failed = append(s.Manifest.Failed, Failure{Name: name, ID: id, Error: err.Error()})
+}
+
+// Write writes the snapshot as a tar.gz archive to w, encrypted if passphrase is not empty.
+func (s *Snapshot) Write(w io.Writer, passphrase []byte) error {
+	var archive bytes.Buffer
+	if err := s.writeArchive(&archive); err != nil {
+		return err
+	}
+	if len(passphrase) == 0 {
+		_, err := archive.WriteTo(w)
+		return err
+	}
+	sealed, err := encrypt(archive.Bytes(), passphrase)
+	clear(archive.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(sealed)
+	return err
+}
+
+func (s *Snapshot) writeArchive(w io.Writer) error {
+	manifest, err := json.MarshalIndent(s.Manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: s.Manifest.CreatedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := add(manifestName, manifest); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	for _, c := range s.Manifest.Clusters {
+		if err := add(c.File, s.Files[c.File]); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return gz.Close()
+}
+
+// Read reads a snapshot written by Write. passphrase is only needed for encrypted snapshots.
+func Read(r io.Reader, passphrase []byte) (*Snapshot, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxArchiveBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if bytes.HasPrefix(data, []byte(magic)) {
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		if data, err = decrypt(data, passphrase); err != nil {
+			return nil, err
+		}
+		defer clear(data)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("not a snapshot archive: %w", err)
+	}
+	s := &Snapshot{Files: map[string][]byte{}}
+	foundManifest := false
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if header.Name == manifestName {
+			if err := json.Unmarshal(content, &s.Manifest); err != nil {
+				return nil, fmt.Errorf("invalid snapshot manifest: %w", err)
+			}
+			foundManifest = true
+			continue
+		}
+		s.Files[header.Name] = content
+	}
+	if !foundManifest {
+		return nil, errors.New("invalid snapshot: manifest.json is missing")
+	}
+	for _, c := range s.Manifest.Clusters {
+		// Restoring writes files named after these paths, so they must stay inside clusters/
+		if path.Dir(c.File) != clusterDir || path.Ext(c.File) != ".yaml" {
+			return nil, fmt.Errorf("invalid snapshot: unexpected file %q for cluster %s", c.File, c.Name)
+		}
+		if _, ok := s.Files[c.File]; !ok {
+			return nil, fmt.Errorf("invalid snapshot: kubeconfig of cluster %s is missing", c.Name)
+		}
+	}
+	return s, nil
+}
+
+// encrypt seals data with a key derived from passphrase
+func encrypt(data, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	out := make([]byte, 0, len(magic)+saltSize+len(nonce)+len(data)+gcm.Overhead())
+	out = append(out, magic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, []byte(magic)), nil
+}
+
+// decrypt opens data sealed by encrypt
+func decrypt(data, passphrase []byte) ([]byte, error) {
+	data = data[len(magic):]
+	if len(data) < saltSize {
+		return nil, errors.New("encrypted snapshot is truncated")
+	}
+	gcm, err := newGCM(passphrase, data[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	data = data[saltSize:]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted snapshot is truncated")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(magic))
+	if err != nil {
+		return nil, errors.New("failed to decrypt snapshot: wrong passphrase or damaged file")
+	}
+	return plain, nil
+}
+
+func newGCM(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, kdfIterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	defer clear(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
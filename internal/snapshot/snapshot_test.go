@@ -0,0 +1,81 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSnapshot() *Snapshot {
+	s := New("https://rancher.example.com", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	s.Add("prod", "c-prod", []string{"prod", "prod-node1"}, []byte("prod-kubeconfig"))
+	s.Add("team/a", "c-a", []string{"team/a"}, []byte("a-kubeconfig"))
+	s.Add("team:a", "c-b", []string{"team:a"}, []byte("b-kubeconfig"))
+	s.AddFailure("broken", "c-broken", errors.New("status 503"))
+	return s
+}
+
+func TestAdd_FileNames(t *testing.T) {
+	s := newTestSnapshot()
+
+	files := make([]string, len(s.Manifest.Clusters))
+	for i, c := range s.Manifest.Clusters {
+		files[i] = c.File
+	}
+	assert.Equal(t, []string{"clusters/prod.yaml", "clusters/team_a.yaml", "clusters/team_a-c-b.yaml"}, files)
+}
+
+func TestWriteRead_RoundTrip(t *testing.T) {
+	s := newTestSnapshot()
+
+	var buf bytes.Buffer
+	require.NoError(t, s.Write(&buf, nil))
+	got, err := Read(&buf, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, s.Manifest, got.Manifest)
+	assert.Equal(t, s.Files, got.Files)
+}
+
+func TestWriteRead_Encrypted(t *testing.T) {
+	s := newTestSnapshot()
+
+	var buf bytes.Buffer
+	require.NoError(t, s.Write(&buf, []byte("correct horse")))
+	assert.NotContains(t, buf.String(), "prod")
+	data := buf.Bytes()
+
+	_, err := Read(bytes.NewReader(data), nil)
+	assert.ErrorIs(t, err, ErrPassphraseRequired)
+
+	_, err = Read(bytes.NewReader(data), []byte("wrong"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "wrong passphrase")
+
+	got, err := Read(bytes.NewReader(data), []byte("correct horse"))
+	require.NoError(t, err)
+	assert.Equal(t, s.Manifest, got.Manifest)
+	assert.Equal(t, s.Files, got.Files)
+}
+
+func TestRead_RejectsFilesOutsideClusters(t *testing.T) {
+	s := New("https://rancher.example.com", time.Now())
+	s.Manifest.Clusters = []Cluster{{Name: "evil", File: "../evil.yaml"}}
+	s.Files["../evil.yaml"] = []byte("x")
+
+	var buf bytes.Buffer
+	require.NoError(t, s.Write(&buf, nil))
+	_, err := Read(&buf, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected file")
+}
+
+func TestRead_NotASnapshot(t *testing.T) {
+	_, err := Read(bytes.NewReader([]byte("hello")), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a snapshot archive")
+}
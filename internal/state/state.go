@@ -0,0 +1,174 @@
+// Package state persists what the tool last wrote to each kubeconfig file,
+// so entries changed by something else since the last run can be detected,
+// and the replaced tokens waiting to be revoked.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/appdir"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"sync"
+	"time"
+)
+
+// State maps kubeconfig file paths to the checksums of the entries the tool manages in them.
+// It is safe for concurrent use.
+type State struct {
+	path  string
+	mu    sync.Mutex
+	Files map[string]map[string]string `json:"files"`
+	// Retired are replaced tokens that are revoked once their grace period has passed
+	Retired []RetiredToken `json:"retired,omitempty"`
+}
+
+// RetiredToken is a token that was replaced by a new one.
+type RetiredToken struct {
+	// Server is the Rancher server the token belongs to
+	Server string `json:"server"`
+	// Name is the token name; the secret is never stored
+	Name      string    `json:"name"`
+	RetiredAt time.Time `json:"retiredAt"`
+}
+
+// DefaultPath returns the default state file in the tool's directory (see appdir.Dir).
+func DefaultPath() (string, error) {
+	dir, err := appdir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "state.json"), nil
+}
+
+// Load reads the state file at path. A missing file yields an empty state.
+func Load(path string) (*State, error) {
+	s := &State{path: path, Files: make(map[string]map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]map[string]string)
+	}
+	return s, nil
+}
+
+// Checksum returns the checksum recorded for an entry of a kubeconfig file.
+func (s *State) Checksum(kubeconfigPath, entry string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sum, ok := s.Files[kubeconfigPath][entry]
+	return sum, ok
+}
+
+// SetChecksum records the checksum of an entry the tool has just written.
+func (s *State) SetChecksum(kubeconfigPath, entry, checksum string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, ok := s.Files[kubeconfigPath]
+	if !ok {
+		entries = make(map[string]string)
+		s.Files[kubeconfigPath] = entries
+	}
+	entries[entry] = checksum
+}
+
+// Retire records that a token of server was replaced at the given time. A token that is
+// already recorded keeps its original time.
+func (s *State) Retire(server, tokenName string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.Retired {
+		if t.Server == server && t.Name == tokenName {
+			return
+		}
+	}
+	s.Retired = append(s.Retired, RetiredToken{Server: server, Name: tokenName, RetiredAt: at.UTC()})
+}
+
+// Due returns the retired tokens of server that were replaced at least grace before now.
+func (s *State) Due(server string, grace time.Duration, now time.Time) []RetiredToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []RetiredToken
+	for _, t := range s.Retired {
+		if t.Server == server && now.Sub(t.RetiredAt) >= grace {
+			due = append(due, t)
+		}
+	}
+	return due
+}
+
+// Forget removes a retired token, e.g. once it was revoked.
+func (s *State) Forget(server, tokenName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.Retired[:0]
+	for _, t := range s.Retired {
+		if t.Server != server || t.Name != tokenName {
+			kept = append(kept, t)
+		}
+	}
+	s.Retired = kept
+}
+
+// Stager collects file writes that are committed together.
+type Stager interface {
+	Stage(path string, data []byte, perm os.FileMode)
+}
+
+// Stage adds the state file to a set of writes committed together, so the state
+// never disagrees with the kubeconfig it describes.
+func (s *State) Stage(tx Stager) error {
+	data, err := s.prepare()
+	if err != nil {
+		return err
+	}
+	tx.Stage(s.path, data, 0600)
+	return nil
+}
+
+// Save writes the state back to the file it was loaded from.
+func (s *State) Save() error {
+	data, err := s.prepare()
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// prepare creates the state directory and encodes the state
+func (s *State) prepare() ([]byte, error) {
+	if err := readonly.Check(s.path); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,89 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"rancher-kubeconfig-updater/internal/readonly"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_MissingFile(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, err)
+
+	_, ok := s.Checksum("/home/user/.kube/config", "prod")
+	assert.False(t, ok)
+}
+
+func TestState_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "state.json")
+	s, err := Load(path)
+	require.NoError(t, err)
+
+	s.SetChecksum("/kube/a", "prod", "sum-a")
+	s.SetChecksum("/kube/b", "prod", "sum-b")
+	require.NoError(t, s.Save())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	if os.PathSeparator == '/' {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	sum, ok := loaded.Checksum("/kube/a", "prod")
+	assert.True(t, ok)
+	assert.Equal(t, "sum-a", sum)
+	sum, _ = loaded.Checksum("/kube/b", "prod")
+	assert.Equal(t, "sum-b", sum)
+}
+
+func TestState_SaveReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := Load(path)
+	require.NoError(t, err)
+	s.SetChecksum("/kube/a", "prod", "sum-a")
+
+	readonly.Set(true)
+	t.Cleanup(func() { readonly.Set(false) })
+	require.ErrorIs(t, s.Save(), readonly.ErrReadOnly)
+	assert.NoFileExists(t, path)
+}
+
+func TestLoad_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0600))
+
+	_, err := Load(path)
+	assert.Error(t, err)
+}
+
+func TestState_RetiredTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := Load(path)
+	require.NoError(t, err)
+
+	replaced := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.Retire("https://a.example.com", "kubeconfig-u-old", replaced)
+	s.Retire("https://a.example.com", "kubeconfig-u-old", replaced.Add(time.Hour))
+	s.Retire("https://a.example.com", "kubeconfig-u-recent", replaced.Add(2*time.Hour))
+	s.Retire("https://b.example.com", "kubeconfig-u-other", replaced)
+	require.NoError(t, s.Save())
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	due := loaded.Due("https://a.example.com", time.Hour, replaced.Add(2*time.Hour))
+	require.Len(t, due, 1, "only tokens past the grace period of this server")
+	assert.Equal(t, "kubeconfig-u-old", due[0].Name)
+	assert.True(t, replaced.Equal(due[0].RetiredAt), "retiring again keeps the original time")
+
+	loaded.Forget("https://a.example.com", "kubeconfig-u-old")
+	assert.Empty(t, loaded.Due("https://a.example.com", time.Hour, replaced.Add(2*time.Hour)))
+	assert.Len(t, loaded.Due("https://a.example.com", 0, replaced.Add(2*time.Hour)), 1)
+	assert.Len(t, loaded.Due("https://b.example.com", 0, replaced), 1)
+}
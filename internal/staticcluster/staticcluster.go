@@ -0,0 +1,149 @@
+// Package staticcluster describes clusters outside Rancher whose kubeconfig entries the
+// updater maintains next to the Rancher ones.
+//
+// Each cluster is given by its API server, CA and a command printing a token, e.g. from
+// Vault or a cloud CLI. Every run writes the entry with a freshly fetched token, so a single
+// tool owns the whole kubeconfig.
+package staticcluster
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Cluster is one statically defined cluster.
+type Cluster struct {
+	// Name is the name of the cluster, context and user entries
+	Name string `yaml:"name"`
+	// Server is the URL of the Kubernetes API server
+	Server string `yaml:"server"`
+	// CertificateAuthority is a CA file, relative to the config; CertificateAuthorityData
+	// holds the base64-encoded CA instead. Without either the system roots are used.
+	CertificateAuthority     string `yaml:"certificate-authority,omitempty"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify,omitempty"`
+	// Namespace is the default namespace of the context (default: none)
+	Namespace string `yaml:"namespace,omitempty"`
+	// TokenCommand is a shell command printing the bearer token
+	TokenCommand string `yaml:"token-command"`
+}
+
+// Config is the ordered list of static clusters.
+type Config struct {
+	Clusters []Cluster `yaml:"clusters"`
+}
+
+// Load reads and validates the static clusters at path. Relative CA files are resolved
+// against the directory of path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static clusters: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid static clusters %s: %w", path, err)
+	}
+	for i, c := range cfg.Clusters {
+		if c.CertificateAuthority != "" && !filepath.IsAbs(c.CertificateAuthority) {
+			cfg.Clusters[i].CertificateAuthority = filepath.Join(filepath.Dir(path), c.CertificateAuthority)
+		}
+	}
+	return cfg, nil
+}
+
+// Parse decodes and validates static clusters of the form
+//
+//	clusters:
+//	- name: homelab
+//	  server: https://10.0.0.5:6443
+//	  certificate-authority: homelab-ca.crt
+//	  token-command: vault read -field=token kubernetes/creds/homelab
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(cfg.Clusters) == 0 {
+		return nil, errors.New("no clusters defined")
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for i, c := range cfg.Clusters {
+		if err := c.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("cluster %d: %v", i+1, err))
+			continue
+		}
+		if seen[c.Name] {
+			problems = append(problems, fmt.Sprintf("cluster %d: name %q is used twice", i+1, c.Name))
+		}
+		seen[c.Name] = true
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return &cfg, nil
+}
+
+func (c Cluster) validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	u, err := url.Parse(c.Server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid server %q: must be an http:// or https:// URL", c.Server)
+	}
+	if c.CertificateAuthority != "" && c.CertificateAuthorityData != "" {
+		return errors.New("certificate-authority and certificate-authority-data both provide the CA: use only one of them")
+	}
+	if c.CertificateAuthorityData != "" {
+		if _, err := base64.StdEncoding.DecodeString(c.CertificateAuthorityData); err != nil {
+			return fmt.Errorf("invalid certificate-authority-data: %w", err)
+		}
+	}
+	if strings.TrimSpace(c.TokenCommand) == "" {
+		return errors.New("token-command is required")
+	}
+	return nil
+}
+
+// Kubeconfig returns a kubeconfig holding the cluster, context and user entries of c, all
+// named after c, with token as the bearer token.
+func (c Cluster) Kubeconfig(token string) *api.Config {
+	cluster := api.NewCluster()
+	cluster.Server = c.Server
+	cluster.CertificateAuthority = c.CertificateAuthority
+	if c.CertificateAuthorityData != "" {
+		// Validated by Parse
+		cluster.CertificateAuthorityData, _ = base64.StdEncoding.DecodeString(c.CertificateAuthorityData)
+	}
+	cluster.InsecureSkipTLSVerify = c.InsecureSkipTLSVerify
+
+	context := api.NewContext()
+	context.Cluster = c.Name
+	context.AuthInfo = c.Name
+	context.Namespace = c.Namespace
+
+	authInfo := api.NewAuthInfo()
+	authInfo.Token = token
+
+	cfg := api.NewConfig()
+	cfg.Clusters[c.Name] = cluster
+	cfg.Contexts[c.Name] = context
+	cfg.AuthInfos[c.Name] = authInfo
+	cfg.CurrentContext = c.Name
+	return cfg
+}
@@ -0,0 +1,66 @@
+package staticcluster
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "static.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+clusters:
+- name: homelab
+  server: https://10.0.0.5:6443
+  certificate-authority: homelab-ca.crt
+  namespace: apps
+  token-command: echo token
+- name: kind
+  server: https://127.0.0.1:6443
+  certificate-authority-data: Y2E=
+  token-command: echo token
+`), 0600))
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, cfg.Clusters, 2)
+	assert.Equal(t, filepath.Join(dir, "homelab-ca.crt"), cfg.Clusters[0].CertificateAuthority, "CA files are relative to the config")
+
+	entry := cfg.Clusters[0].Kubeconfig("secret")
+	assert.Equal(t, "homelab", entry.CurrentContext)
+	assert.Equal(t, "https://10.0.0.5:6443", entry.Clusters["homelab"].Server)
+	assert.Equal(t, "apps", entry.Contexts["homelab"].Namespace)
+	assert.Equal(t, "homelab", entry.Contexts["homelab"].AuthInfo)
+	assert.Equal(t, "secret", entry.AuthInfos["homelab"].Token)
+	assert.Nil(t, entry.Clusters["homelab"].CertificateAuthorityData)
+
+	assert.Equal(t, []byte("ca"), cfg.Clusters[1].Kubeconfig("secret").Clusters["kind"].CertificateAuthorityData)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"empty", "", "no clusters defined"},
+		{"unknown key", "clusters:\n- name: a\n  server: https://a\n  token-command: x\n  token: y\n", "field token not found"},
+		{"missing name", "clusters:\n- server: https://a\n  token-command: x\n", "cluster 1: name is required"},
+		{"invalid server", "clusters:\n- name: a\n  server: a:6443\n  token-command: x\n", `cluster 1: invalid server "a:6443"`},
+		{"two CAs", "clusters:\n- name: a\n  server: https://a\n  certificate-authority: ca.crt\n  certificate-authority-data: Y2E=\n  token-command: x\n", "use only one of them"},
+		{"invalid CA data", "clusters:\n- name: a\n  server: https://a\n  certificate-authority-data: '%%'\n  token-command: x\n", "invalid certificate-authority-data"},
+		{"missing token command", "clusters:\n- name: a\n  server: https://a\n", "cluster 1: token-command is required"},
+		{"duplicate name", "clusters:\n- name: a\n  server: https://a\n  token-command: x\n- name: a\n  server: https://b\n  token-command: x\n", `cluster 2: name "a" is used twice`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
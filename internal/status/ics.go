@@ -0,0 +1,85 @@
+package status
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// icsTime is the UTC date-time format of iCalendar
+const icsTime = "20060102T150405Z"
+
+// WriteICS writes an iCalendar (RFC 5545) feed with one event per token expiry to w.
+// Tokens that never expire or whose expiry is unknown have no event. Event UIDs are
+// derived from the Rancher server and cluster, so a subscribed calendar moves an event
+// when the token is rotated instead of adding a new one. With remindDays above zero
+// every event carries an alarm that many days before the expiry.
+func WriteICS(w io.Writer, entries []Entry, rancherURL string, remindDays int, now time.Time) error {
+	host := rancherURL
+	if u, err := url.Parse(rancherURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		b.WriteString(foldLine(fmt.Sprintf(format, args...)))
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//rancher-kubeconfig-updater//status//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:%s", escapeText("Rancher token expirations ("+host+")"))
+	for _, e := range entries {
+		if e.ExpiresAt.IsZero() {
+			continue
+		}
+		line("BEGIN:VEVENT")
+		line("UID:%s", escapeText(fmt.Sprintf("%s.%s@%s", e.ClusterID, e.Context, host)))
+		line("DTSTAMP:%s", now.UTC().Format(icsTime))
+		line("DTSTART:%s", e.ExpiresAt.UTC().Format(icsTime))
+		line("DTEND:%s", e.ExpiresAt.UTC().Format(icsTime))
+		line("SUMMARY:%s", escapeText("Rancher token for "+e.Context+" expires"))
+		line("DESCRIPTION:%s", escapeText(fmt.Sprintf(
+			"The kubeconfig token %s of cluster %s (%s) on %s expires. Run rancher-kubeconfig-updater before then to rotate it.",
+			e.TokenName, e.Context, e.ClusterID, rancherURL)))
+		line("TRANSP:TRANSPARENT")
+		if remindDays > 0 {
+			line("BEGIN:VALARM")
+			line("ACTION:DISPLAY")
+			line("TRIGGER:-P%dD", remindDays)
+			line("DESCRIPTION:%s", escapeText(fmt.Sprintf("Rancher token for %s expires in %d days", e.Context, remindDays)))
+			line("END:VALARM")
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// escapeText escapes a TEXT value as required by RFC 5545
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// foldLine terminates a content line with CRLF, folding it into lines of at most 75
+// octets without splitting UTF-8 sequences
+func foldLine(s string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		n := len(string(r))
+		if width+n > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += n
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
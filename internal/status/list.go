@@ -0,0 +1,70 @@
+package status
+
+import (
+	"sort"
+	"time"
+
+	"rancher-kubeconfig-updater/internal/rancher"
+)
+
+// ClusterStatus is one Rancher cluster and the token of its kubeconfig entry, if it has one.
+type ClusterStatus struct {
+	Cluster   string `json:"cluster" yaml:"cluster"`
+	ClusterID string `json:"clusterId" yaml:"clusterId"`
+	// Description, KubernetesVersion, Provider and NodeCount describe the Rancher cluster
+	Description       string `json:"description,omitempty" yaml:"description,omitempty"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty" yaml:"kubernetesVersion,omitempty"`
+	Provider          string `json:"provider,omitempty" yaml:"provider,omitempty"`
+	NodeCount         int    `json:"nodeCount,omitempty" yaml:"nodeCount,omitempty"`
+	// InKubeconfig is set when the kubeconfig has an entry for the cluster
+	InKubeconfig bool `json:"inKubeconfig" yaml:"inKubeconfig"`
+	// Context is the entry's context; with several, the one whose token expires first
+	Context string `json:"context,omitempty" yaml:"context,omitempty"`
+	// ExpiresAt is zero when the token never expires, its expiry is unknown or there is no entry
+	ExpiresAt    time.Time `json:"expiresAt,omitzero" yaml:"expiresAt,omitempty"`
+	NeverExpires bool      `json:"neverExpires,omitempty" yaml:"neverExpires,omitempty"`
+	// DaysLeft is the days until ExpiresAt, rounded down (nil without an expiry)
+	DaysLeft *int `json:"daysLeft,omitempty" yaml:"daysLeft,omitempty"`
+	// Error explains why the expiry is unknown
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ListClusters returns the status of every Rancher cluster, sorted by name, with the token of
+// its entry among entries as collected by Collect. Entries of clusters Rancher doesn't list
+// are left out.
+func ListClusters(entries []Entry, clusters rancher.Clusters, now time.Time) []ClusterStatus {
+	// entries are sorted soonest expiry first, so the first entry of a cluster is the most urgent
+	byID := make(map[string]Entry, len(entries))
+	for _, e := range entries {
+		if _, seen := byID[e.ClusterID]; !seen {
+			byID[e.ClusterID] = e
+		}
+	}
+
+	list := make([]ClusterStatus, 0, len(clusters))
+	for _, c := range clusters {
+		s := ClusterStatus{
+			Cluster:           c.Name,
+			ClusterID:         c.ID,
+			Description:       c.Description,
+			KubernetesVersion: c.KubernetesVersion(),
+			Provider:          c.ProviderName(),
+			NodeCount:         c.NodeCount,
+		}
+		if e, ok := byID[c.ID]; ok {
+			s.InKubeconfig = true
+			s.Context = e.Context
+			s.ExpiresAt = e.ExpiresAt
+			s.NeverExpires = e.NeverExpires
+			s.Error = e.Error
+			if days, ok := e.DaysLeft(now); ok {
+				s.DaysLeft = &days
+			}
+		}
+		list = append(list, s)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Cluster < list[j].Cluster
+	})
+	return list
+}
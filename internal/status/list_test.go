@@ -0,0 +1,35 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"rancher-kubeconfig-updater/internal/rancher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListClusters(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Context: "prod", ClusterID: "c-prod", ExpiresAt: now.Add(10*24*time.Hour + time.Hour)},
+		{Context: "prod-direct", ClusterID: "c-prod", ExpiresAt: now.Add(20 * 24 * time.Hour)},
+		{Context: "dev", ClusterID: "c-dev", NeverExpires: true},
+		{Context: "gone", ClusterID: "c-gone", ExpiresAt: now.Add(time.Hour)},
+	}
+	clusters := rancher.Clusters{
+		{ID: "c-prod", Name: "prod"},
+		{ID: "c-new", Name: "new", Description: "Staging", Version: rancher.ClusterVersion{GitVersion: "v1.30.4+rke2r1"}, Provider: "rke2", NodeCount: 3},
+		{ID: "c-dev", Name: "dev"},
+	}
+
+	list := ListClusters(entries, clusters, now)
+	require.Len(t, list, 3, "clusters Rancher doesn't list are left out")
+
+	assert.Equal(t, ClusterStatus{Cluster: "dev", ClusterID: "c-dev", InKubeconfig: true, Context: "dev", NeverExpires: true}, list[0])
+	assert.Equal(t, ClusterStatus{Cluster: "new", ClusterID: "c-new", Description: "Staging", KubernetesVersion: "v1.30.4+rke2r1", Provider: "rke2", NodeCount: 3}, list[1])
+	assert.Equal(t, "prod", list[2].Context, "the context whose token expires first")
+	require.NotNil(t, list[2].DaysLeft)
+	assert.Equal(t, 10, *list[2].DaysLeft)
+}
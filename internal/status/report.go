@@ -0,0 +1,136 @@
+package status
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportDays is how close to its expiry a token is highlighted in reports
+const reportDays = 7
+
+// reportRow is an entry formatted for the reports
+type reportRow struct {
+	Context, ClusterID, Owner      string
+	Version, Provider, Nodes       string
+	Description, VersionWarning    string
+	Expires, DaysLeft, LastRotated string
+	ExpiresSort, DaysSort          string
+	Urgent                         bool
+}
+
+// reportRows formats entries for the reports. Sort keys put tokens that never expire
+// after all others and unknown expiries last.
+func reportRows(entries []Entry, now time.Time) []reportRow {
+	rows := make([]reportRow, 0, len(entries))
+	for _, e := range entries {
+		row := reportRow{
+			Context:     e.Context,
+			ClusterID:   e.ClusterID,
+			Owner:       e.Owner,
+			Version:     e.KubernetesVersion,
+			Provider:    e.Provider,
+			Nodes:       "-",
+			Description: e.Description,
+			Expires:     "unknown",
+			DaysLeft:    "-",
+			LastRotated: "-",
+			ExpiresSort: "~~",
+			DaysSort:    "1000000",
+		}
+		switch {
+		case e.NeverExpires:
+			row.Expires, row.ExpiresSort, row.DaysSort = "never", "~", "999999"
+		case !e.ExpiresAt.IsZero():
+			days, _ := e.DaysLeft(now)
+			row.Expires = e.ExpiresAt.Format(time.RFC3339)
+			row.ExpiresSort = row.Expires
+			row.DaysLeft = strconv.Itoa(days)
+			row.DaysSort = row.DaysLeft
+			row.Urgent = days < reportDays
+		}
+		row.VersionWarning = e.VersionWarning
+		if e.NodeCount > 0 {
+			row.Nodes = strconv.Itoa(e.NodeCount)
+		}
+		if e.Error != "" {
+			row.Expires = "unknown: " + e.Error
+		}
+		if !e.LastRotated.IsZero() {
+			row.LastRotated = e.LastRotated.Format(time.RFC3339)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+//go:embed report.html
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Parse(reportHTML))
+
+// WriteHTML writes a self-contained HTML page with a sortable table of the entries to w.
+// Tokens expiring within a week are highlighted.
+func WriteHTML(w io.Writer, entries []Entry, rancherURL string, now time.Time) error {
+	return reportTemplate.Execute(w, struct {
+		RancherURL, Generated string
+		Rows                  []reportRow
+	}{rancherURL, now.UTC().Format(time.RFC3339), reportRows(entries, now)})
+}
+
+// WriteMarkdown writes the entries as a Markdown table to w, for wikis and emails.
+// Tokens expiring within a week are marked in bold.
+func WriteMarkdown(w io.Writer, entries []Entry, rancherURL string, now time.Time) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Rancher token expiry report\n\n")
+	fmt.Fprintf(&b, "Rancher server: %s  \nGenerated: %s\n\n", markdownCell(rancherURL), now.UTC().Format(time.RFC3339))
+	if len(entries) == 0 {
+		b.WriteString("No Rancher entries found in the kubeconfig for this server.\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	b.WriteString("| Cluster | Cluster ID | Owner | Version | Provider | Nodes | Expires | Days left | Last rotated | Description |\n")
+	b.WriteString("| --- | --- | --- | --- | --- | ---: | --- | ---: | --- | --- |\n")
+	for _, row := range reportRows(entries, now) {
+		daysLeft := row.DaysLeft
+		if row.Urgent {
+			daysLeft = "**" + daysLeft + "**"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %s | %s | %s | %s |\n",
+			markdownCell(row.Context), markdownCell(row.ClusterID), markdownCell(row.Owner),
+			markdownCell(row.Version), markdownCell(row.Provider), row.Nodes,
+			markdownCell(row.Expires), daysLeft, row.LastRotated, markdownCell(row.Description))
+	}
+	if warnings := VersionWarnings(entries); len(warnings) > 0 {
+		b.WriteString("\n## Version skew\n\n")
+		for _, warning := range warnings {
+			fmt.Fprintf(&b, "- %s\n", markdownCell(warning))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// VersionWarnings returns the version warnings of entries, each prefixed with its context
+func VersionWarnings(entries []Entry) []string {
+	var warnings []string
+	for _, e := range entries {
+		if e.VersionWarning != "" {
+			warnings = append(warnings, e.Context+": "+e.VersionWarning)
+		}
+	}
+	return warnings
+}
+
+// markdownCell escapes text for a Markdown table cell
+func markdownCell(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "*", `\*`, "_", `\_`, "`", "\\`").Replace(s)
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,99 @@
+package status
+
+import (
+	"strings"
+	"testing"
+
+	"rancher-kubeconfig-updater/internal/rancher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reportEntries() []Entry {
+	return []Entry{
+		{Context: "edge|1", ClusterID: "c-m-edge", Owner: "team-edge", ExpiresAt: soon, LastRotated: rotated},
+		{Context: "prod", ClusterID: "c-m-prod", ExpiresAt: later,
+			Description: "Payments", KubernetesVersion: "v1.30.4+rke2r1", Provider: "rke2", NodeCount: 5,
+			VersionWarning: "Kubernetes v1.30.4+rke2r1 is 3 minor versions newer than kubectl v1.27.1 (supported: 1)"},
+		{Context: "dev", ClusterID: "c-m-dev", NeverExpires: true},
+		{Context: "<old>", ClusterID: "c-m-old", Error: "token not found in Rancher"},
+	}
+}
+
+func TestSetOwners(t *testing.T) {
+	entries := []Entry{{ClusterID: "c-m-prod"}, {ClusterID: "c-m-dev"}, {ClusterID: "c-m-gone"}}
+	SetOwners(entries, rancher.Clusters{
+		{ID: "c-m-prod", Labels: map[string]string{"team": "platform"}},
+		{ID: "c-m-dev", Labels: map[string]string{"owner": "someone"}},
+	}, "team")
+
+	assert.Equal(t, "platform", entries[0].Owner)
+	assert.Empty(t, entries[1].Owner)
+	assert.Empty(t, entries[2].Owner)
+}
+
+func TestSetDetails(t *testing.T) {
+	entries := []Entry{{ClusterID: "c-m-prod"}, {ClusterID: "c-m-gone"}}
+	SetDetails(entries, rancher.Clusters{{
+		ID: "c-m-prod", Description: "Payments", Version: rancher.ClusterVersion{GitVersion: "v1.30.4+rke2r1"},
+		Driver: "imported", NodeCount: 5,
+	}})
+
+	assert.Equal(t, Entry{ClusterID: "c-m-prod", Description: "Payments", KubernetesVersion: "v1.30.4+rke2r1", Provider: "imported", NodeCount: 5}, entries[0])
+	assert.Equal(t, Entry{ClusterID: "c-m-gone"}, entries[1])
+}
+
+func TestReportRows(t *testing.T) {
+	rows := reportRows(reportEntries(), now)
+	require.Len(t, rows, 4)
+
+	assert.Equal(t, "3", rows[0].DaysLeft)
+	assert.True(t, rows[0].Urgent)
+	assert.Equal(t, "2026-02-01T08:00:00Z", rows[0].LastRotated)
+	assert.False(t, rows[1].Urgent)
+	assert.Equal(t, "5", rows[1].Nodes)
+	assert.Equal(t, "-", rows[2].Nodes)
+	assert.Equal(t, "never", rows[2].Expires)
+	assert.Equal(t, "unknown: token not found in Rancher", rows[3].Expires)
+
+	// Sort keys order expiring tokens first, then never-expiring, then unknown
+	assert.Less(t, rows[1].ExpiresSort, rows[2].ExpiresSort)
+	assert.Less(t, rows[2].ExpiresSort, rows[3].ExpiresSort)
+}
+
+func TestWriteHTML(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteHTML(&b, reportEntries(), testHost, now))
+	html := b.String()
+
+	assert.Contains(t, html, "<!DOCTYPE html>")
+	assert.Contains(t, html, "Rancher server: https://rancher.example.com")
+	assert.Contains(t, html, `<tr class="urgent"><td>edge|1</td><td>c-m-edge</td><td>team-edge</td>`)
+	assert.Contains(t, html, "&lt;old&gt;", "values are escaped")
+	assert.Contains(t, html, `data-sort="999999">-</td>`)
+	assert.Contains(t, html, `<td class="warn" title="Kubernetes v1.30.4&#43;rke2r1 is 3 minor versions newer than kubectl v1.27.1 (supported: 1)">v1.30.4&#43;rke2r1</td><td>rke2</td><td class="num" data-sort="5">5</td>`)
+	assert.Contains(t, html, "<script>")
+
+	b.Reset()
+	require.NoError(t, WriteHTML(&b, nil, testHost, now))
+	assert.Contains(t, b.String(), "No Rancher entries")
+	assert.NotContains(t, b.String(), "<table>")
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteMarkdown(&b, reportEntries(), testHost, now))
+	md := b.String()
+
+	assert.Contains(t, md, "Generated: 2026-03-01T12:00:00Z")
+	assert.Contains(t, md, "| Cluster | Cluster ID | Owner | Version | Provider | Nodes | Expires | Days left | Last rotated | Description |\n")
+	assert.Contains(t, md, `| edge\|1 | c-m-edge | team-edge | - | - | - | 2026-03-04T12:00:00Z | **3** | 2026-02-01T08:00:00Z | - |`)
+	assert.Contains(t, md, "| prod | c-m-prod | - | v1.30.4+rke2r1 | rke2 | 5 | 2026-04-10T12:00:00Z | 40 | - | Payments |")
+	assert.Contains(t, md, "| dev | c-m-dev | - | - | - | - | never | - | - | - |")
+	assert.Contains(t, md, "\n## Version skew\n\n- prod: Kubernetes v1.30.4+rke2r1 is 3 minor versions newer than kubectl v1.27.1 (supported: 1)\n")
+
+	b.Reset()
+	require.NoError(t, WriteMarkdown(&b, nil, testHost, now))
+	assert.Contains(t, b.String(), "No Rancher entries")
+}
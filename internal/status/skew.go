@@ -0,0 +1,50 @@
+package status
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// minorVersion matches the major and minor version of a Kubernetes version such as
+// "v1.30.4+rke2r1" or "1.29"
+var minorVersion = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// parseMinor returns the major and minor version of a Kubernetes version
+func parseMinor(version string) (major, minor int, ok bool) {
+	m := minorVersion.FindStringSubmatch(version)
+	if m == nil {
+		return 0, 0, false
+	}
+	major, _ = strconv.Atoi(m[1])
+	minor, _ = strconv.Atoi(m[2])
+	return major, minor, true
+}
+
+// CheckVersionSkew sets the version warning of every entry whose cluster runs a Kubernetes
+// version more than maxSkew minor versions older or newer than kubectlVersion, the version
+// of the local kubectl. kubectl supports one minor version of skew, so clusters outside that
+// range tend to break in other ways than an expired token. Entries whose cluster version is
+// unknown get no warning.
+func CheckVersionSkew(entries []Entry, kubectlVersion string, maxSkew int) error {
+	clientMajor, clientMinor, ok := parseMinor(kubectlVersion)
+	if !ok {
+		return fmt.Errorf("invalid kubectl version %q", kubectlVersion)
+	}
+	for i, e := range entries {
+		major, minor, ok := parseMinor(e.KubernetesVersion)
+		if !ok {
+			continue
+		}
+		skew := minor - clientMinor
+		switch {
+		case major != clientMajor:
+			entries[i].VersionWarning = fmt.Sprintf("Kubernetes %s has another major version than kubectl %s", e.KubernetesVersion, kubectlVersion)
+		case skew < -maxSkew:
+			entries[i].VersionWarning = fmt.Sprintf("Kubernetes %s is %d minor versions older than kubectl %s (supported: %d)", e.KubernetesVersion, -skew, kubectlVersion, maxSkew)
+		case skew > maxSkew:
+			entries[i].VersionWarning = fmt.Sprintf("Kubernetes %s is %d minor versions newer than kubectl %s (supported: %d)", e.KubernetesVersion, skew, kubectlVersion, maxSkew)
+		}
+	}
+	return nil
+}
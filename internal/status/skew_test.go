@@ -0,0 +1,31 @@
+package status
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckVersionSkew(t *testing.T) {
+	entries := []Entry{
+		{Context: "current", KubernetesVersion: "v1.30.4+rke2r1"},
+		{Context: "previous", KubernetesVersion: "v1.29.8-eks-a737599"},
+		{Context: "old", KubernetesVersion: "v1.24.17+k3s1"},
+		{Context: "new", KubernetesVersion: "v1.33.0"},
+		{Context: "unknown"},
+	}
+
+	require.NoError(t, CheckVersionSkew(entries, "v1.30.2", 1))
+	assert.Empty(t, entries[0].VersionWarning)
+	assert.Empty(t, entries[1].VersionWarning)
+	assert.Equal(t, "Kubernetes v1.24.17+k3s1 is 6 minor versions older than kubectl v1.30.2 (supported: 1)", entries[2].VersionWarning)
+	assert.Equal(t, "Kubernetes v1.33.0 is 3 minor versions newer than kubectl v1.30.2 (supported: 1)", entries[3].VersionWarning)
+	assert.Empty(t, entries[4].VersionWarning)
+	assert.Equal(t, []string{
+		"old: " + entries[2].VersionWarning,
+		"new: " + entries[3].VersionWarning,
+	}, VersionWarnings(entries))
+
+	assert.Error(t, CheckVersionSkew(entries, "unknown", 1))
+}
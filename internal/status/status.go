@@ -0,0 +1,157 @@
+// Package status reports when the Rancher tokens in a kubeconfig expire.
+package status
+
+import (
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"rancher-kubeconfig-updater/internal/export"
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/rancher"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Entry is the token status of one Rancher context of a kubeconfig.
+type Entry struct {
+	Context   string `json:"context"`
+	ClusterID string `json:"clusterId"`
+	// Owner is taken from a label of the Rancher cluster, see SetOwners
+	Owner string `json:"owner,omitempty"`
+	// Description, KubernetesVersion, Provider and NodeCount describe the Rancher cluster, see SetDetails
+	Description       string `json:"description,omitempty"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	Provider          string `json:"provider,omitempty"`
+	NodeCount         int    `json:"nodeCount,omitempty"`
+	// VersionWarning explains how far the cluster's version is from kubectl's, see CheckVersionSkew
+	VersionWarning string `json:"versionWarning,omitempty"`
+	TokenName      string `json:"tokenName,omitempty"`
+	// ExpiresAt is zero when the token never expires or its expiry is unknown
+	ExpiresAt    time.Time `json:"expiresAt,omitzero"`
+	NeverExpires bool      `json:"neverExpires,omitempty"`
+	// LastRotated is when this tool last wrote the entry's token, if it recorded it
+	LastRotated time.Time `json:"lastRotated,omitzero"`
+	// Error explains why the expiry is unknown
+	Error string `json:"error,omitempty"`
+}
+
+// DaysLeft returns the days until the token expires, rounded down, and false when it
+// never expires or its expiry is unknown.
+func (e Entry) DaysLeft(now time.Time) (int, bool) {
+	if e.ExpiresAt.IsZero() {
+		return 0, false
+	}
+	return int(math.Floor(e.ExpiresAt.Sub(now).Hours() / 24)), true
+}
+
+// Rancher is the subset of the Rancher client used to look up token expiry.
+type Rancher interface {
+	GetTokenExpiration(token string) (time.Time, error)
+}
+
+// Collect looks up the token expiry of every context in kubecfg that belongs to the
+// Rancher server at rancherURL. Entries are sorted by expiry, soonest first; tokens that
+// never expire and tokens whose expiry is unknown come last. Lookup failures are recorded
+// on the entry rather than returned, so one revoked token doesn't hide the others.
+func Collect(kubecfg *api.Config, rancherURL string, r Rancher) []Entry {
+	rancherURL = strings.TrimSuffix(rancherURL, "/")
+	var entries []Entry
+	for _, c := range export.Clusters(kubecfg) {
+		md, annotated := kubeconfig.GetMetadata(kubecfg, c.Context)
+		if annotated && md.RancherURL != "" {
+			if md.RancherURL != rancherURL {
+				continue
+			}
+		} else if !sameHost(c.Server, rancherURL) {
+			continue
+		}
+
+		entry := Entry{Context: c.Context, ClusterID: c.ClusterID, LastRotated: md.LastRotated}
+		token := contextToken(kubecfg, c.Context)
+		if token == "" {
+			entry.Error = "no token in kubeconfig"
+			entries = append(entries, entry)
+			continue
+		}
+		entry.TokenName, _ = rancher.TokenName(token)
+
+		expiresAt, err := r.GetTokenExpiration(token)
+		switch {
+		case err != nil:
+			entry.Error = err.Error()
+		case expiresAt.IsZero():
+			entry.NeverExpires = true
+		default:
+			entry.ExpiresAt = expiresAt.UTC()
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].ExpiresAt, entries[j].ExpiresAt
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		return a.Before(b)
+	})
+	return entries
+}
+
+// SetOwners sets the owner of every entry to the value of the label on its Rancher cluster.
+// Entries of clusters without the label keep an empty owner.
+func SetOwners(entries []Entry, clusters rancher.Clusters, label string) {
+	owners := make(map[string]string, len(clusters))
+	for _, c := range clusters {
+		owners[c.ID] = c.Labels[label]
+	}
+	for i := range entries {
+		entries[i].Owner = owners[entries[i].ClusterID]
+	}
+}
+
+// SetDetails sets the description, Kubernetes version, provider and node count of every entry
+// from its Rancher cluster, so clusters named by opaque IDs can be told apart.
+func SetDetails(entries []Entry, clusters rancher.Clusters) {
+	byID := make(map[string]rancher.Cluster, len(clusters))
+	for _, c := range clusters {
+		byID[c.ID] = c
+	}
+	for i := range entries {
+		c, ok := byID[entries[i].ClusterID]
+		if !ok {
+			continue
+		}
+		entries[i].Description = c.Description
+		entries[i].KubernetesVersion = c.KubernetesVersion()
+		entries[i].Provider = c.ProviderName()
+		entries[i].NodeCount = c.NodeCount
+	}
+}
+
+// contextToken returns the bearer token the context authenticates with
+func contextToken(kubecfg *api.Config, contextName string) string {
+	ctx := kubecfg.Contexts[contextName]
+	if ctx == nil {
+		return ""
+	}
+	if authInfo, ok := kubecfg.AuthInfos[ctx.AuthInfo]; ok && authInfo != nil {
+		return authInfo.Token
+	}
+	return ""
+}
+
+// sameHost reports whether server points at the same host as rancherURL
+func sameHost(server, rancherURL string) bool {
+	s, err := url.Parse(server)
+	if err != nil {
+		return false
+	}
+	r, err := url.Parse(rancherURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(s.Host, r.Host)
+}
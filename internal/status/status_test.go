@@ -0,0 +1,120 @@
+package status
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"rancher-kubeconfig-updater/internal/kubeconfig"
+	"rancher-kubeconfig-updater/internal/rancher"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// fakeRancher answers token expiry lookups by token name
+type fakeRancher map[string]time.Time
+
+func (f fakeRancher) GetTokenExpiration(token string) (time.Time, error) {
+	name, err := rancher.TokenName(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	expiresAt, ok := f[name]
+	if !ok {
+		return time.Time{}, rancher.ErrTokenNotFound
+	}
+	return expiresAt, nil
+}
+
+var (
+	now      = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rotated  = time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)
+	soon     = now.Add(3 * 24 * time.Hour)
+	later    = now.Add(40 * 24 * time.Hour)
+	tokens   = fakeRancher{"kubeconfig-u-prod": later, "kubeconfig-u-edge": soon, "kubeconfig-u-dev": {}}
+	testHost = "https://rancher.example.com"
+)
+
+func newTestKubeconfig(t *testing.T) *api.Config {
+	t.Helper()
+	kubecfg := api.NewConfig()
+	add := func(name, server, token string) {
+		kubecfg.Clusters[name] = &api.Cluster{Server: server}
+		kubecfg.AuthInfos[name] = &api.AuthInfo{Token: token}
+		kubecfg.Contexts[name] = &api.Context{Cluster: name, AuthInfo: name}
+	}
+	add("prod", testHost+"/k8s/clusters/c-m-prod", "kubeconfig-u-prod:secret")
+	add("Edge-1", "https://10.0.0.5:6443", "kubeconfig-u-edge:secret")
+	add("dev", testHost+"/k8s/clusters/c-m-dev", "kubeconfig-u-dev:secret")
+	add("revoked", testHost+"/k8s/clusters/c-m-old", "kubeconfig-u-gone:secret")
+	add("other", "https://rancher.other.com/k8s/clusters/c-m-x", "kubeconfig-u-x:secret")
+	add("kind", "https://127.0.0.1:6443", "kind-token")
+	require.NoError(t, kubeconfig.SetMetadata(kubecfg, "Edge-1", kubeconfig.NewMetadata(testHost, "c-m-edge", rotated)))
+	return kubecfg
+}
+
+func TestCollect(t *testing.T) {
+	entries := Collect(newTestKubeconfig(t), testHost+"/", tokens)
+
+	require.Len(t, entries, 4)
+	assert.Equal(t, Entry{Context: "Edge-1", ClusterID: "c-m-edge", TokenName: "kubeconfig-u-edge", ExpiresAt: soon, LastRotated: rotated}, entries[0])
+	assert.Equal(t, Entry{Context: "prod", ClusterID: "c-m-prod", TokenName: "kubeconfig-u-prod", ExpiresAt: later}, entries[1])
+	assert.Equal(t, Entry{Context: "dev", ClusterID: "c-m-dev", TokenName: "kubeconfig-u-dev", NeverExpires: true}, entries[2])
+	assert.Equal(t, "revoked", entries[3].Context)
+	assert.Contains(t, entries[3].Error, "token not found")
+}
+
+func TestEntry_DaysLeft(t *testing.T) {
+	days, ok := Entry{ExpiresAt: soon}.DaysLeft(now)
+	assert.True(t, ok)
+	assert.Equal(t, 3, days)
+
+	days, ok = Entry{ExpiresAt: now.Add(-time.Hour)}.DaysLeft(now)
+	assert.True(t, ok)
+	assert.Equal(t, -1, days, "expired tokens have negative days left")
+
+	_, ok = Entry{NeverExpires: true}.DaysLeft(now)
+	assert.False(t, ok)
+}
+
+func TestWriteICS(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteICS(&b, Collect(newTestKubeconfig(t), testHost, tokens), testHost, 7, now))
+	ics := b.String()
+
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(ics, "END:VCALENDAR\r\n"))
+	assert.Equal(t, 2, strings.Count(ics, "BEGIN:VEVENT"), "only tokens with an expiry get an event")
+	assert.Contains(t, ics, "UID:c-m-edge.Edge-1@rancher.example.com\r\n")
+	assert.Contains(t, ics, "DTSTART:20260304T120000Z\r\n")
+	assert.Contains(t, ics, "DTSTAMP:20260301T120000Z\r\n")
+	assert.Contains(t, ics, "SUMMARY:Rancher token for prod expires\r\n")
+	assert.Contains(t, ics, "TRIGGER:-P7D\r\n")
+
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, line)
+	}
+	assert.NotContains(t, strings.ReplaceAll(ics, "\r\n", ""), "\n", "lines end with CRLF")
+}
+
+func TestWriteICS_NoReminder(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteICS(&b, []Entry{{Context: "prod", ClusterID: "c-m-prod", ExpiresAt: later}}, testHost, 0, now))
+	assert.NotContains(t, b.String(), "VALARM")
+}
+
+func TestEscapeText(t *testing.T) {
+	assert.Equal(t, `a\\b\;c\,d\ne`, escapeText("a\\b;c,d\ne"))
+}
+
+func TestFoldLine(t *testing.T) {
+	folded := foldLine("DESCRIPTION:" + strings.Repeat("é", 60))
+	lines := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n ")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+	assert.Equal(t, "DESCRIPTION:"+strings.Repeat("é", 60), strings.Join(lines, ""))
+}
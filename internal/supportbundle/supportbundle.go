@@ -0,0 +1,119 @@
+// Package supportbundle writes archives of diagnostic data, free of secrets, to attach to bug
+// reports.
+package supportbundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// redacted replaces secret values in the bundle
+const redacted = "[REDACTED]"
+
+// Bundle collects the files of a support bundle in the order they are added
+type Bundle struct {
+	CreatedAt time.Time
+	names     []string
+	files     map[string][]byte
+}
+
+// New returns an empty bundle created at createdAt.
+func New(createdAt time.Time) *Bundle {
+	return &Bundle{CreatedAt: createdAt, files: make(map[string][]byte)}
+}
+
+// Add adds a file to the bundle, replacing an earlier file with the same name. Callers are
+// responsible for removing secrets from data.
+func (b *Bundle) Add(name string, data []byte) {
+	if _, ok := b.files[name]; !ok {
+		b.names = append(b.names, name)
+	}
+	b.files[name] = data
+}
+
+// AddJSON adds v encoded as indented JSON.
+func (b *Bundle) AddJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	b.Add(name, append(data, '\n'))
+	return nil
+}
+
+// Names returns the names of the files in the bundle, in the order they were added.
+func (b *Bundle) Names() []string {
+	return append([]string(nil), b.names...)
+}
+
+// Write writes the bundle as a tar.gz archive with every file below a support-bundle directory.
+func (b *Bundle) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range b.names {
+		data := b.files[name]
+		header := &tar.Header{Name: path.Join("support-bundle", name), Mode: 0o600, Size: int64(len(data)), ModTime: b.CreatedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write support bundle: %w", err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return fmt.Errorf("failed to write support bundle: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write support bundle: %w", err)
+	}
+	return gz.Close()
+}
+
+// RedactKubeconfig returns a copy of cfg that keeps its structure (contexts, clusters, users,
+// servers and extensions) but none of its secrets: tokens keep only their name, and
+// certificates, keys, passwords, exec environment values and auth provider settings are
+// replaced. cfg is not modified.
+func RedactKubeconfig(cfg *api.Config, tokenName func(token string) (string, error)) *api.Config {
+	out := cfg.DeepCopy()
+	for _, cluster := range out.Clusters {
+		if cluster != nil && len(cluster.CertificateAuthorityData) > 0 {
+			cluster.CertificateAuthorityData = []byte(redacted)
+		}
+	}
+	for _, authInfo := range out.AuthInfos {
+		if authInfo == nil {
+			continue
+		}
+		if authInfo.Token != "" {
+			if name, err := tokenName(authInfo.Token); err == nil {
+				authInfo.Token = name + ":" + redacted
+			} else {
+				authInfo.Token = redacted
+			}
+		}
+		if len(authInfo.ClientCertificateData) > 0 {
+			authInfo.ClientCertificateData = []byte(redacted)
+		}
+		if len(authInfo.ClientKeyData) > 0 {
+			authInfo.ClientKeyData = []byte(redacted)
+		}
+		if authInfo.Password != "" {
+			authInfo.Password = redacted
+		}
+		if authInfo.Exec != nil {
+			for i := range authInfo.Exec.Env {
+				authInfo.Exec.Env[i].Value = redacted
+			}
+		}
+		if authInfo.AuthProvider != nil {
+			for key := range authInfo.AuthProvider.Config {
+				authInfo.AuthProvider.Config[key] = redacted
+			}
+		}
+	}
+	return out
+}
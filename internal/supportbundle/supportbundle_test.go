@@ -0,0 +1,84 @@
+package supportbundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestBundle_Write(t *testing.T) {
+	b := New(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	b.Add("diagnostics.log", []byte("first"))
+	require.NoError(t, b.AddJSON("versions.json", map[string]string{"go": "go1.25"}))
+	b.Add("diagnostics.log", []byte("replaced"))
+	assert.Equal(t, []string{"diagnostics.log", "versions.json"}, b.Names())
+
+	var buf bytes.Buffer
+	require.NoError(t, b.Write(&buf))
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	var names, contents []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, int64(0o600), header.Mode)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		contents = append(contents, string(data))
+	}
+	assert.Equal(t, []string{"support-bundle/diagnostics.log", "support-bundle/versions.json"}, names)
+	assert.Equal(t, "replaced", contents[0])
+	assert.Equal(t, "{\n  \"go\": \"go1.25\"\n}\n", contents[1])
+}
+
+func TestRedactKubeconfig(t *testing.T) {
+	cfg := api.NewConfig()
+	cfg.Clusters["prod"] = &api.Cluster{Server: "https://rancher.example.com/k8s/clusters/c-prod", CertificateAuthorityData: []byte("ca")}
+	cfg.Contexts["prod"] = &api.Context{Cluster: "prod", AuthInfo: "prod", Namespace: "apps"}
+	cfg.AuthInfos["prod"] = &api.AuthInfo{Token: "kubeconfig-u-1:secret"}
+	cfg.AuthInfos["opaque"] = &api.AuthInfo{Token: "opaque-secret"}
+	cfg.AuthInfos["certs"] = &api.AuthInfo{ClientCertificateData: []byte("cert"), ClientKeyData: []byte("key"), Username: "admin", Password: "pw"}
+	cfg.AuthInfos["exec"] = &api.AuthInfo{Exec: &api.ExecConfig{Command: "tsh", Env: []api.ExecEnvVar{{Name: "TOKEN", Value: "secret"}}}}
+	cfg.AuthInfos["provider"] = &api.AuthInfo{AuthProvider: &api.AuthProviderConfig{Name: "oidc", Config: map[string]string{"id-token": "secret"}}}
+
+	tokenName := func(token string) (string, error) {
+		name, _, ok := strings.Cut(token, ":")
+		if !ok {
+			return "", errors.New("not a Rancher token")
+		}
+		return name, nil
+	}
+	out := RedactKubeconfig(cfg, tokenName)
+
+	assert.Equal(t, "https://rancher.example.com/k8s/clusters/c-prod", out.Clusters["prod"].Server)
+	assert.Equal(t, []byte(redacted), out.Clusters["prod"].CertificateAuthorityData)
+	assert.Equal(t, "apps", out.Contexts["prod"].Namespace)
+	assert.Equal(t, "kubeconfig-u-1:[REDACTED]", out.AuthInfos["prod"].Token)
+	assert.Equal(t, redacted, out.AuthInfos["opaque"].Token)
+	assert.Equal(t, []byte(redacted), out.AuthInfos["certs"].ClientCertificateData)
+	assert.Equal(t, []byte(redacted), out.AuthInfos["certs"].ClientKeyData)
+	assert.Equal(t, "admin", out.AuthInfos["certs"].Username)
+	assert.Equal(t, redacted, out.AuthInfos["certs"].Password)
+	assert.Equal(t, "tsh", out.AuthInfos["exec"].Exec.Command)
+	assert.Equal(t, redacted, out.AuthInfos["exec"].Exec.Env[0].Value)
+	assert.Equal(t, redacted, out.AuthInfos["provider"].AuthProvider.Config["id-token"])
+
+	// The original keeps its secrets
+	assert.Equal(t, "kubeconfig-u-1:secret", cfg.AuthInfos["prod"].Token)
+	assert.Equal(t, "secret", cfg.AuthInfos["exec"].Exec.Env[0].Value)
+}
@@ -0,0 +1,52 @@
+// Package terminal reads from and inspects the console the same way on every supported platform
+// (linux/amd64, linux/arm64, darwin/arm64 and windows/amd64), so callers need neither syscall
+// nor build tags.
+package terminal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// IsTerminal reports whether f is a terminal (a console on Windows)
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// ReadPassword reads a line from f without echoing it if f is a terminal. Otherwise, e.g. when
+// the secret is piped in, the line is read as is. The line ending is not returned.
+func ReadPassword(f *os.File) ([]byte, error) {
+	if IsTerminal(f) {
+		return term.ReadPassword(int(f.Fd()))
+	}
+	return readLine(f)
+}
+
+// readLine reads up to the next newline, one byte at a time so that nothing after the line
+// is consumed from r
+func readLine(r io.Reader) ([]byte, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				return bytes.TrimSuffix(line, []byte("\r")), nil
+			}
+			line = append(line, buf[0])
+		}
+		if errors.Is(err, io.EOF) {
+			if len(line) == 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return bytes.TrimSuffix(line, []byte("\r")), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
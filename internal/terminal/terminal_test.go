@@ -0,0 +1,54 @@
+package terminal
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPassword_Piped(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	_, err = w.WriteString("s3cret\r\nnext line\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	assert.False(t, IsTerminal(r))
+	password, err := ReadPassword(r)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", string(password))
+
+	// Only the first line is consumed
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "next line\n", string(rest))
+}
+
+func TestReadLine(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+		wantErr           bool
+	}{
+		{name: "newline", input: "secret\n", want: "secret"},
+		{name: "windows line ending", input: "secret\r\n", want: "secret"},
+		{name: "no line ending", input: "secret", want: "secret"},
+		{name: "empty line", input: "\n", want: ""},
+		{name: "no input", input: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := readLine(strings.NewReader(tt.input))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(line))
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Package textfile writes the outcome of a run and the token expiry of every context as a
+// .prom file for node_exporter's textfile collector, so hosts without a daemon can be monitored.
+package textfile
+
+import (
+	"fmt"
+	"io"
+	"rancher-kubeconfig-updater/internal/history"
+	"rancher-kubeconfig-updater/internal/status"
+	"strings"
+)
+
+// FileName is the name of the file written to the collector's directory
+const FileName = "rancher_kubeconfig_updater.prom"
+
+// Expiry is the token status of a context of the Rancher server at Server
+type Expiry struct {
+	Server string
+	Entry  status.Entry
+}
+
+// Results counted by rancher_kubeconfig_updater_last_run_clusters, in the order they are written
+var results = []string{history.ResultUpdated, history.ResultCreated, history.ResultPruned, history.ResultSkipped, history.ResultFailed}
+
+// Write writes run and the token expiry of expiries in the Prometheus text exposition format.
+// Tokens that never expire or whose expiry is unknown have no expiry sample.
+func Write(w io.Writer, run history.Run, expiries []Expiry) error {
+	var b strings.Builder
+
+	b.WriteString("# HELP rancher_kubeconfig_updater_token_expiry_timestamp_seconds Unix time when the Rancher token of a kubeconfig context expires.\n")
+	b.WriteString("# TYPE rancher_kubeconfig_updater_token_expiry_timestamp_seconds gauge\n")
+	for _, e := range expiries {
+		if e.Entry.ExpiresAt.IsZero() {
+			continue
+		}
+		fmt.Fprintf(&b, "rancher_kubeconfig_updater_token_expiry_timestamp_seconds{%s} %d\n", contextLabels(e), e.Entry.ExpiresAt.Unix())
+	}
+	b.WriteString("# HELP rancher_kubeconfig_updater_token_never_expires Whether the Rancher token of a kubeconfig context never expires.\n")
+	b.WriteString("# TYPE rancher_kubeconfig_updater_token_never_expires gauge\n")
+	for _, e := range expiries {
+		if e.Entry.Error == "" {
+			fmt.Fprintf(&b, "rancher_kubeconfig_updater_token_never_expires{%s} %s\n", contextLabels(e), boolValue(e.Entry.NeverExpires))
+		}
+	}
+
+	b.WriteString("# HELP rancher_kubeconfig_updater_last_run_timestamp_seconds Unix time when the last run finished.\n")
+	b.WriteString("# TYPE rancher_kubeconfig_updater_last_run_timestamp_seconds gauge\n")
+	fmt.Fprintf(&b, "rancher_kubeconfig_updater_last_run_timestamp_seconds %d\n", run.FinishedAt.Unix())
+	b.WriteString("# HELP rancher_kubeconfig_updater_last_run_success Whether the last run succeeded for every cluster.\n")
+	b.WriteString("# TYPE rancher_kubeconfig_updater_last_run_success gauge\n")
+	fmt.Fprintf(&b, "rancher_kubeconfig_updater_last_run_success %s\n", boolValue(run.Outcome == history.OutcomeSucceeded))
+	b.WriteString("# HELP rancher_kubeconfig_updater_last_run_outcome Outcome of the last run, 1 for the outcome it had.\n")
+	b.WriteString("# TYPE rancher_kubeconfig_updater_last_run_outcome gauge\n")
+	for _, outcome := range []string{history.OutcomeSucceeded, history.OutcomePartial, history.OutcomeFailed} {
+		fmt.Fprintf(&b, "rancher_kubeconfig_updater_last_run_outcome{outcome=%q} %s\n", outcome, boolValue(run.Outcome == outcome))
+	}
+	b.WriteString("# HELP rancher_kubeconfig_updater_last_run_clusters Clusters of the last run by result.\n")
+	b.WriteString("# TYPE rancher_kubeconfig_updater_last_run_clusters gauge\n")
+	counts := make(map[string]int)
+	for _, c := range run.Clusters {
+		counts[c.Result]++
+	}
+	for _, result := range results {
+		fmt.Fprintf(&b, "rancher_kubeconfig_updater_last_run_clusters{result=%q} %d\n", result, counts[result])
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// contextLabels returns the labels identifying the context of e
+func contextLabels(e Expiry) string {
+	return fmt.Sprintf("context=%s,cluster_id=%s,server=%s", quote(e.Entry.Context), quote(e.Entry.ClusterID), quote(e.Server))
+}
+
+// quote quotes a label value; Prometheus escapes only backslashes, double quotes and newlines
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// boolValue returns the sample value of b
+func boolValue(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,50 @@
+package textfile
+
+import (
+	"rancher-kubeconfig-updater/internal/history"
+	"rancher-kubeconfig-updater/internal/status"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	run := history.Run{
+		FinishedAt: time.Unix(1760000000, 0),
+		Outcome:    history.OutcomePartial,
+		Clusters: []history.Cluster{
+			{Cluster: "prod", Result: history.ResultUpdated},
+			{Cluster: "dev", Result: history.ResultSkipped},
+			{Cluster: "edge", Result: history.ResultFailed},
+		},
+	}
+	expiries := []Expiry{
+		{Server: "https://rancher.example.com", Entry: status.Entry{Context: "prod", ClusterID: "c-prod", ExpiresAt: time.Unix(1770000000, 0)}},
+		{Server: "https://rancher.example.com", Entry: status.Entry{Context: "dev", ClusterID: "c-dev", NeverExpires: true}},
+		{Server: "https://rancher.example.com", Entry: status.Entry{Context: `odd"name`, ClusterID: "c-odd", Error: "token not found"}},
+	}
+
+	var b strings.Builder
+	require.NoError(t, Write(&b, run, expiries))
+	text := b.String()
+
+	assert.Contains(t, text, "# TYPE rancher_kubeconfig_updater_token_expiry_timestamp_seconds gauge\n")
+	assert.Contains(t, text, `rancher_kubeconfig_updater_token_expiry_timestamp_seconds{context="prod",cluster_id="c-prod",server="https://rancher.example.com"} 1770000000`+"\n")
+	assert.Contains(t, text, `rancher_kubeconfig_updater_token_never_expires{context="prod",cluster_id="c-prod",server="https://rancher.example.com"} 0`+"\n")
+	assert.Contains(t, text, `rancher_kubeconfig_updater_token_never_expires{context="dev",cluster_id="c-dev",server="https://rancher.example.com"} 1`+"\n")
+	assert.NotContains(t, text, "c-odd", "tokens whose expiry is unknown have no samples")
+	assert.Contains(t, text, "rancher_kubeconfig_updater_last_run_timestamp_seconds 1760000000\n")
+	assert.Contains(t, text, "rancher_kubeconfig_updater_last_run_success 0\n")
+	assert.Contains(t, text, `rancher_kubeconfig_updater_last_run_outcome{outcome="partial"} 1`+"\n")
+	assert.Contains(t, text, `rancher_kubeconfig_updater_last_run_outcome{outcome="succeeded"} 0`+"\n")
+	assert.Contains(t, text, `rancher_kubeconfig_updater_last_run_clusters{result="updated"} 1`+"\n")
+	assert.Contains(t, text, `rancher_kubeconfig_updater_last_run_clusters{result="created"} 0`+"\n")
+	assert.Contains(t, text, `rancher_kubeconfig_updater_last_run_clusters{result="failed"} 1`+"\n")
+}
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, `"a\"b\\c\nd"`, quote("a\"b\\c\nd"))
+}
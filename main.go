@@ -3,16 +3,23 @@ package main
 //go:generate go tool goversioninfo -platform-specific versioninfo.json
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"rancher-kubeconfig-updater/cmd"
-
-	_ "github.com/joho/godotenv/autoload"
 )
 
 func main() {
 	rootCmd := cmd.NewRootCmd()
 
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *cmd.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+		if hint := cmd.Hint(err); hint != "" {
+			_, _ = fmt.Fprintln(os.Stderr, "Hint:", hint)
+		}
 		os.Exit(1)
 	}
 }